@@ -0,0 +1,93 @@
+package gmqtt
+
+import (
+	"context"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/DrmagicE/gmqtt/pkg/packets"
+)
+
+const (
+	autoSubscribeClientID = "%c"
+	autoSubscribeUsername = "%u"
+)
+
+// expandAutoSubscription replaces the placeholders in the topic filter of the auto subscription.
+// It returns false if the value of the placeholder is empty or contains the topic separator or wildcards.
+func expandAutoSubscription(topic, clientID, username string) (string, bool) {
+	for _, v := range []struct {
+		placeholder string
+		value       string
+	}{
+		{placeholder: autoSubscribeClientID, value: clientID},
+		{placeholder: autoSubscribeUsername, value: username},
+	} {
+		if !strings.Contains(topic, v.placeholder) {
+			continue
+		}
+		if v.value == "" || strings.ContainsAny(v.value, "/+#") {
+			return "", false
+		}
+		topic = strings.Replace(topic, v.placeholder, v.value, -1)
+	}
+	return topic, packets.ValidTopicFilter([]byte(topic))
+}
+
+// autoSubscribe adds the Config.AutoSubscriptions for the connected client.
+// The retained messages are delivered for the subscriptions which did not exist in the session.
+func (srv *server) autoSubscribe(client *client) {
+	if len(srv.config.AutoSubscriptions) == 0 {
+		return
+	}
+	clientID := client.opts.clientID
+	existing := make(map[string]bool)
+	for _, v := range srv.subscriptionsDB.GetClientSubscriptions(clientID) {
+		existing[v.Name] = true
+	}
+	var msgs []packets.Message
+	for _, v := range srv.config.AutoSubscriptions {
+		name, ok := expandAutoSubscription(v.Name, clientID, client.opts.username)
+		if !ok {
+			subscriptionLog().Warn("invalid auto subscription",
+				zap.String("topic", v.Name),
+				zap.String("client_id", clientID),
+			)
+			continue
+		}
+		topic := packets.Topic{Name: name, Qos: v.Qos}
+		if rs := srv.subscriptionsDB.Subscribe(clientID, topic); rs[0].Err != nil {
+			subscriptionLog().Info("auto subscription rejected by the store",
+				zap.String("topic", name),
+				zap.Error(rs[0].Err),
+				zap.String("client_id", clientID),
+			)
+			continue
+		}
+		if srv.hooks.OnSubscribed != nil {
+			srv.hooks.OnSubscribed(context.Background(), client, topic)
+		}
+		subscriptionLog().Info("auto subscribed",
+			zap.String("topic", name),
+			zap.Uint8("qos", v.Qos),
+			zap.String("client_id", clientID),
+		)
+		if !existing[name] {
+			msgs = append(msgs, srv.retainedDB.GetMatchedMessages(name)...)
+		}
+	}
+	if len(msgs) == 0 {
+		return
+	}
+	// the retained messages are routed asynchronously since autoSubscribe is called in the event loop.
+	go func() {
+		for _, msg := range msgs {
+			select {
+			case <-srv.exitChan:
+				return
+			case srv.msgRouter <- &msgRouter{msg: msg, match: false, clientID: clientID}:
+			}
+		}
+	}()
+}
@@ -0,0 +1,91 @@
+package gmqtt
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/DrmagicE/gmqtt/pkg/packets"
+)
+
+func TestExpandAutoSubscription(t *testing.T) {
+	a := assert.New(t)
+	var tt = []struct {
+		topic    string
+		clientID string
+		username string
+		expected string
+		ok       bool
+	}{
+		{topic: "devices/%c/cmd", clientID: "id", expected: "devices/id/cmd", ok: true},
+		{topic: "users/%u/#", clientID: "id", username: "user", expected: "users/user/#", ok: true},
+		{topic: "broadcast", clientID: "id", expected: "broadcast", ok: true},
+		{topic: "users/%u/#", clientID: "id", ok: false},
+		{topic: "devices/%c/cmd", clientID: "a/b", ok: false},
+		{topic: "devices/%c/cmd", clientID: "+", ok: false},
+		{topic: "devices/#/cmd", clientID: "id", ok: false},
+	}
+	for _, v := range tt {
+		topic, ok := expandAutoSubscription(v.topic, v.clientID, v.username)
+		a.Equal(v.ok, ok, v.topic)
+		if v.ok {
+			a.Equal(v.expected, topic, v.topic)
+		}
+	}
+}
+
+func TestAutoSubscribe(t *testing.T) {
+	a := assert.New(t)
+	ln, err := net.Listen("tcp", "127.0.0.1:1883")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	config := DefaultConfig
+	config.AutoSubscriptions = []packets.Topic{
+		{Name: "devices/%c/cmd", Qos: packets.QOS_1},
+		{Name: "users/%u/#", Qos: packets.QOS_0},
+	}
+	var subscribed []string
+	srv := NewServer(WithTCPListener(ln), WithConfig(config), WithHook(Hooks{
+		OnSubscribed: func(ctx context.Context, client Client, topic packets.Topic) {
+			subscribed = append(subscribed, topic.Name)
+		},
+	}))
+	defer srv.Stop(context.Background())
+	srv.retainedDB.AddOrReplace(NewMessage("devices/id/cmd", []byte("retained"), packets.QOS_1, Retained(true)))
+	srv.Run()
+
+	c, err := net.Dial("tcp", "127.0.0.1:1883")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer c.Close()
+	connect := defaultConnectPacket()
+	connect.ClientID = []byte("id")
+	packets.NewWriter(c).WriteAndFlush(connect)
+	// the retained message may be sent right after the connack, so the reader is shared.
+	r := packets.NewReader(c)
+	c.SetReadDeadline(time.Now().Add(time.Second))
+	p, err := r.ReadPacket()
+	a.NoError(err)
+	a.EqualValues(packets.CodeAccepted, p.(*packets.Connack).Code)
+
+	p, err = r.ReadPacket()
+	a.NoError(err)
+	pub := p.(*packets.Publish)
+	a.Equal("devices/id/cmd", string(pub.TopicName))
+	a.True(pub.Retain)
+	a.Equal([]string{"devices/id/cmd", "users/testuser/#"}, subscribed)
+	a.ElementsMatch([]packets.Topic{
+		{Name: "devices/id/cmd", Qos: packets.QOS_1},
+		{Name: "users/testuser/#", Qos: packets.QOS_0},
+	}, srv.subscriptionsDB.GetClientSubscriptions("id"))
+
+	srv.PublishService().Publish(NewMessage("users/testuser/a", []byte("payload"), packets.QOS_0))
+	p, err = r.ReadPacket()
+	a.NoError(err)
+	a.Equal("users/testuser/a", string(p.(*packets.Publish).TopicName))
+}
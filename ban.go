@@ -0,0 +1,474 @@
+package gmqtt
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	persistence_ban "github.com/DrmagicE/gmqtt/persistence/ban"
+	"github.com/DrmagicE/gmqtt/pkg/packets"
+)
+
+// banCheckInterval is the interval to remove the expired bans and the stale flapping records.
+const banCheckInterval = time.Second
+
+// ErrInvalidBan is the error of banning an invalid value, such as a malformed IP address or CIDR.
+var ErrInvalidBan = errors.New("invalid ban value")
+
+// BanKind is the kind of the banned value.
+type BanKind int
+
+const (
+	// BanClientID bans the client id.
+	BanClientID BanKind = iota
+	// BanIP bans the source IP address.
+	BanIP
+	// BanCIDR bans the source addresses in the network, e.g: "10.0.0.0/8".
+	BanCIDR
+	// BanClientIDPattern bans the client ids which match the pattern,
+	// '*' matches any sequence of characters and '?' matches any single character.
+	BanClientIDPattern
+)
+
+func (k BanKind) String() string {
+	switch k {
+	case BanClientID:
+		return "client_id"
+	case BanIP:
+		return "ip"
+	case BanCIDR:
+		return "cidr"
+	case BanClientIDPattern:
+		return "client_id_pattern"
+	default:
+		return "unknown"
+	}
+}
+
+// Ban is a banned client id, IP address, network or client id pattern.
+// The connections of the banned clients are rejected with CodeNotAuthorized.
+type Ban struct {
+	Kind BanKind
+	// Value is the client id, IP address, CIDR or client id pattern.
+	Value string
+	// At is the time when the ban was added.
+	At time.Time
+	// Until is the time when the ban expires, zero means the ban never expires.
+	Until time.Time
+	// Flapping is whether the ban was added by the flapping detection, see Config.FlappingMaxDisconnects.
+	Flapping bool
+}
+
+// BanService provides the ability to inspect and manage the bans.
+// The bans are persisted if the store is set by WithBanPersistence.
+type BanService interface {
+	// Bans returns the active bans, ordered by Until, Kind and Value. The bans which never expire come last.
+	Bans() []Ban
+	// Ban bans the value for the duration, 0 means the ban never expires. It returns ErrInvalidBan
+	// if the value is not valid for the kind. The ban replaces the existing one of the same kind and value,
+	// and the online clients which match the ban are closed.
+	Ban(kind BanKind, value string, duration time.Duration) error
+	// Unban removes the ban, and returns whether the ban existed.
+	Unban(kind BanKind, value string) bool
+}
+
+type banKey struct {
+	kind  BanKind
+	value string
+}
+
+type banEntry struct {
+	Ban
+	// network is the parsed value of the BanCIDR ban.
+	network *net.IPNet
+}
+
+func (e *banEntry) match(clientID string, ip net.IP) bool {
+	switch e.Kind {
+	case BanClientID:
+		return e.Value == clientID
+	case BanIP:
+		return ip != nil && e.Value == ip.String()
+	case BanCIDR:
+		return ip != nil && e.network.Contains(ip)
+	case BanClientIDPattern:
+		return matchPattern(e.Value, clientID)
+	}
+	return false
+}
+
+func (e *banEntry) expired(now time.Time) bool {
+	return !e.Until.IsZero() && !now.Before(e.Until)
+}
+
+// matchPattern reports whether s matches the pattern, '*' matches any sequence of characters
+// and '?' matches any single character.
+func matchPattern(pattern, s string) bool {
+	p, i := 0, 0
+	// the position of the last '*' in the pattern and the position in s it matches up to.
+	star, mark := -1, 0
+	for i < len(s) {
+		switch {
+		case p < len(pattern) && (pattern[p] == '?' || pattern[p] == s[i]):
+			p++
+			i++
+		case p < len(pattern) && pattern[p] == '*':
+			star, mark = p, i
+			p++
+		case star != -1:
+			p = star + 1
+			mark++
+			i = mark
+		default:
+			return false
+		}
+	}
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
+
+// newBanEntry validates and normalizes the value of the ban.
+func newBanEntry(ban Ban) (*banEntry, error) {
+	e := &banEntry{Ban: ban}
+	switch ban.Kind {
+	case BanClientID, BanClientIDPattern:
+		if ban.Value == "" {
+			return nil, ErrInvalidBan
+		}
+	case BanIP:
+		ip := net.ParseIP(ban.Value)
+		if ip == nil {
+			return nil, ErrInvalidBan
+		}
+		e.Value = ip.String()
+	case BanCIDR:
+		_, network, err := net.ParseCIDR(ban.Value)
+		if err != nil {
+			return nil, ErrInvalidBan
+		}
+		e.network = network
+		e.Value = network.String()
+	default:
+		return nil, ErrInvalidBan
+	}
+	return e, nil
+}
+
+// flapRecord counts the disconnections within the flapping window which starts at since.
+type flapRecord struct {
+	since time.Time
+	count int
+}
+
+type banService struct {
+	server *server
+	mu     sync.Mutex
+	bans   map[banKey]*banEntry
+	// wildcards is the number of the BanCIDR and BanClientIDPattern bans, which can not be looked up by the key.
+	wildcards int
+	flaps     map[banKey]*flapRecord
+}
+
+func newBanService(srv *server) *banService {
+	return &banService{
+		server: srv,
+		bans:   make(map[banKey]*banEntry),
+		flaps:  make(map[banKey]*flapRecord),
+	}
+}
+
+func isWildcard(kind BanKind) bool {
+	return kind == BanCIDR || kind == BanClientIDPattern
+}
+
+// put adds or replaces the ban, it must be called with mu held.
+func (b *banService) put(e *banEntry) {
+	key := banKey{kind: e.Kind, value: e.Value}
+	if _, ok := b.bans[key]; !ok && isWildcard(e.Kind) {
+		b.wildcards++
+	}
+	b.bans[key] = e
+}
+
+// remove removes the ban, it must be called with mu held.
+func (b *banService) remove(key banKey) (*banEntry, bool) {
+	e, ok := b.bans[key]
+	if !ok {
+		return nil, false
+	}
+	delete(b.bans, key)
+	if isWildcard(key.kind) {
+		b.wildcards--
+	}
+	return e, true
+}
+
+func (b *banService) Bans() []Ban {
+	now := time.Now()
+	b.mu.Lock()
+	rs := make([]Ban, 0, len(b.bans))
+	for _, v := range b.bans {
+		if !v.expired(now) {
+			rs = append(rs, v.Ban)
+		}
+	}
+	b.mu.Unlock()
+	sort.Slice(rs, func(i, j int) bool {
+		if !rs[i].Until.Equal(rs[j].Until) {
+			if rs[i].Until.IsZero() || rs[j].Until.IsZero() {
+				return !rs[i].Until.IsZero()
+			}
+			return rs[i].Until.Before(rs[j].Until)
+		}
+		if rs[i].Kind != rs[j].Kind {
+			return rs[i].Kind < rs[j].Kind
+		}
+		return rs[i].Value < rs[j].Value
+	})
+	return rs
+}
+
+func (b *banService) Ban(kind BanKind, value string, duration time.Duration) error {
+	return b.add(kind, value, duration, false)
+}
+
+func (b *banService) add(kind BanKind, value string, duration time.Duration, flapping bool) error {
+	now := time.Now()
+	ban := Ban{Kind: kind, Value: value, At: now, Flapping: flapping}
+	if duration != 0 {
+		ban.Until = now.Add(duration)
+	}
+	e, err := newBanEntry(ban)
+	if err != nil {
+		return err
+	}
+	b.mu.Lock()
+	b.put(e)
+	b.mu.Unlock()
+	serverLog().Info("ban added",
+		zap.String("kind", kind.String()),
+		zap.String("value", e.Value),
+		zap.Duration("duration", duration),
+		zap.Bool("flapping", flapping),
+	)
+	srv := b.server
+	srv.persistBan(e.Ban)
+	if srv.hooks.OnBanned != nil {
+		srv.hooks.OnBanned(context.Background(), e.Ban)
+	}
+	srv.mu.RLock()
+	var banned []*client
+	for _, c := range srv.clients {
+		if e.match(c.opts.clientID, c.remoteIP) {
+			banned = append(banned, c)
+		}
+	}
+	srv.mu.RUnlock()
+	for _, c := range banned {
+		c.Close()
+	}
+	return nil
+}
+
+func (b *banService) Unban(kind BanKind, value string) bool {
+	// normalize the value in the same way as it is added.
+	if e, err := newBanEntry(Ban{Kind: kind, Value: value}); err == nil {
+		value = e.Value
+	}
+	b.mu.Lock()
+	e, ok := b.remove(banKey{kind: kind, value: value})
+	b.mu.Unlock()
+	if !ok {
+		return false
+	}
+	b.unbanned(e)
+	return true
+}
+
+func (b *banService) unbanned(e *banEntry) {
+	serverLog().Info("ban removed",
+		zap.String("kind", e.Kind.String()),
+		zap.String("value", e.Value),
+	)
+	b.server.removePersistedBan(e.Ban)
+	if b.server.hooks.OnUnbanned != nil {
+		b.server.hooks.OnUnbanned(context.Background(), e.Ban)
+	}
+}
+
+// banned returns whether the client id or the IP address is banned.
+func (b *banService) banned(clientID string, ip net.IP, now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.bans) == 0 {
+		return false
+	}
+	keys := []banKey{{kind: BanClientID, value: clientID}}
+	if ip != nil {
+		keys = append(keys, banKey{kind: BanIP, value: ip.String()})
+	}
+	for _, k := range keys {
+		if e, ok := b.bans[k]; ok && !e.expired(now) {
+			return true
+		}
+	}
+	if b.wildcards == 0 {
+		return false
+	}
+	for _, e := range b.bans {
+		if isWildcard(e.Kind) && !e.expired(now) && e.match(clientID, ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// disconnected counts the disconnection of the connected client, and bans the client if it is flapping.
+func (b *banService) disconnected(client *client, now time.Time) {
+	config := b.server.config
+	if config.FlappingMaxDisconnects <= 0 {
+		return
+	}
+	key := banKey{kind: config.FlappingBanBy, value: client.opts.clientID}
+	if key.kind == BanIP {
+		if client.remoteIP == nil {
+			return
+		}
+		key.value = client.remoteIP.String()
+	}
+	b.mu.Lock()
+	r, ok := b.flaps[key]
+	if !ok || now.Sub(r.since) > config.FlappingWindow {
+		r = &flapRecord{since: now}
+		b.flaps[key] = r
+	}
+	r.count++
+	flapping := r.count >= config.FlappingMaxDisconnects
+	if flapping {
+		delete(b.flaps, key)
+	}
+	b.mu.Unlock()
+	if flapping {
+		serverLog().Warn("flapping detected",
+			zap.String("client_id", client.opts.clientID),
+			zap.String("remote_addr", client.rwc.RemoteAddr().String()),
+		)
+		b.add(key.kind, key.value, config.FlappingBanDuration, true)
+	}
+}
+
+// removeExpired removes the expired bans and the flapping records which are out of the window.
+func (b *banService) removeExpired(now time.Time) {
+	var expired []*banEntry
+	b.mu.Lock()
+	for k, v := range b.bans {
+		if v.expired(now) {
+			b.remove(k)
+			expired = append(expired, v)
+		}
+	}
+	for k, v := range b.flaps {
+		if now.Sub(v.since) > b.server.config.FlappingWindow {
+			delete(b.flaps, k)
+		}
+	}
+	b.mu.Unlock()
+	for _, v := range expired {
+		b.unbanned(v)
+	}
+}
+
+func (b *banService) loop() {
+	ticker := time.NewTicker(banCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-b.server.exitChan:
+			return
+		case now := <-ticker.C:
+			b.removeExpired(now)
+		}
+	}
+}
+
+// persistBan saves the ban if the ban persistence is enabled.
+func (srv *server) persistBan(ban Ban) {
+	if srv.banStore == nil {
+		return
+	}
+	err := srv.banStore.Save(&persistence_ban.Entry{
+		Kind:     int(ban.Kind),
+		Value:    ban.Value,
+		At:       ban.At,
+		Until:    ban.Until,
+		Flapping: ban.Flapping,
+	})
+	if err != nil {
+		persistenceLog().Error("persisting ban error", zap.String("value", ban.Value), zap.Error(err))
+	}
+}
+
+// removePersistedBan removes the persisted ban if the ban persistence is enabled.
+func (srv *server) removePersistedBan(ban Ban) {
+	if srv.banStore == nil {
+		return
+	}
+	if err := srv.banStore.Remove(int(ban.Kind), ban.Value); err != nil {
+		persistenceLog().Error("removing persisted ban error", zap.String("value", ban.Value), zap.Error(err))
+	}
+}
+
+// restoreBans loads the persisted bans, the expired and invalid bans are removed from the store.
+func (srv *server) restoreBans() error {
+	if srv.banStore == nil {
+		return nil
+	}
+	var entries []*persistence_ban.Entry
+	err := srv.banStore.Iterate(func(entry *persistence_ban.Entry) bool {
+		entries = append(entries, entry)
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	b := srv.banService
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, v := range entries {
+		e, err := newBanEntry(Ban{
+			Kind:     BanKind(v.Kind),
+			Value:    v.Value,
+			At:       v.At,
+			Until:    v.Until,
+			Flapping: v.Flapping,
+		})
+		if err != nil || e.expired(now) {
+			if err := srv.banStore.Remove(v.Kind, v.Value); err != nil {
+				return err
+			}
+			continue
+		}
+		b.put(e)
+	}
+	return nil
+}
+
+// checkBan returns the code of the connack packet, the banned clients are rejected with CodeNotAuthorized.
+func (client *client) checkBan() (code uint8) {
+	if !client.server.banService.banned(client.opts.clientID, client.remoteIP, time.Now()) {
+		return packets.CodeAccepted
+	}
+	serverLog().Warn("client banned, rejecting connection",
+		zap.String("remote_addr", client.rwc.RemoteAddr().String()),
+		zap.String("client_id", client.opts.clientID),
+	)
+	return packets.CodeNotAuthorized
+}
@@ -0,0 +1,222 @@
+package gmqtt
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	persistence_ban "github.com/DrmagicE/gmqtt/persistence/ban"
+	"github.com/DrmagicE/gmqtt/pkg/packets"
+)
+
+func TestBanService(t *testing.T) {
+	a := assert.New(t)
+	srv := NewServer()
+	var banned, unbanned []string
+	srv.hooks.OnBanned = func(ctx context.Context, ban Ban) {
+		banned = append(banned, ban.Value)
+	}
+	srv.hooks.OnUnbanned = func(ctx context.Context, ban Ban) {
+		unbanned = append(unbanned, ban.Value)
+	}
+	b := srv.banService
+	a.NoError(b.Ban(BanIP, "10.0.0.1", 0))
+	a.NoError(b.Ban(BanClientID, "id2", 2*time.Minute))
+	a.NoError(b.Ban(BanClientID, "id1", time.Minute))
+
+	bans := b.Bans()
+	a.Len(bans, 3)
+	a.Equal("id1", bans[0].Value)
+	a.Equal("id2", bans[1].Value)
+	a.Equal("10.0.0.1", bans[2].Value)
+	a.True(bans[2].Until.IsZero())
+	a.Equal([]string{"10.0.0.1", "id2", "id1"}, banned)
+
+	now := time.Now()
+	a.True(b.banned("id1", nil, now))
+	a.True(b.banned("other", net.ParseIP("10.0.0.1"), now))
+	a.False(b.banned("other", net.ParseIP("10.0.0.2"), now))
+
+	a.True(b.Unban(BanClientID, "id2"))
+	a.False(b.Unban(BanClientID, "id2"))
+	a.Equal([]string{"id2"}, unbanned)
+
+	// the expired bans are removed.
+	later := now.Add(time.Hour)
+	a.False(b.banned("id1", nil, later))
+	b.removeExpired(later)
+	a.Equal([]string{"id2", "id1"}, unbanned)
+	a.Len(b.Bans(), 1)
+}
+
+func TestBanService_Wildcard(t *testing.T) {
+	a := assert.New(t)
+	b := NewServer().banService
+	a.Equal(ErrInvalidBan, b.Ban(BanIP, "10.0.0", 0))
+	a.Equal(ErrInvalidBan, b.Ban(BanCIDR, "10.0.0.1", 0))
+	a.Equal(ErrInvalidBan, b.Ban(BanClientIDPattern, "", 0))
+	a.Len(b.Bans(), 0)
+
+	a.NoError(b.Ban(BanCIDR, "10.0.1.1/24", 0))
+	a.NoError(b.Ban(BanClientIDPattern, "test-*", 0))
+	a.Equal("10.0.1.0/24", b.Bans()[0].Value)
+	a.Equal(2, b.wildcards)
+
+	now := time.Now()
+	a.True(b.banned("id", net.ParseIP("10.0.1.100"), now))
+	a.False(b.banned("id", net.ParseIP("10.0.2.1"), now))
+	a.True(b.banned("test-1", nil, now))
+	a.False(b.banned("1-test", nil, now))
+
+	a.True(b.Unban(BanCIDR, "10.0.1.1/24"))
+	a.True(b.Unban(BanClientIDPattern, "test-*"))
+	a.Zero(b.wildcards)
+}
+
+func TestMatchPattern(t *testing.T) {
+	a := assert.New(t)
+	var tt = []struct {
+		pattern string
+		s       string
+		match   bool
+	}{
+		{pattern: "*", s: "", match: true},
+		{pattern: "*", s: "abc", match: true},
+		{pattern: "a*c", s: "abbbc", match: true},
+		{pattern: "a*c", s: "abcb", match: false},
+		{pattern: "a?c", s: "abc", match: true},
+		{pattern: "a?c", s: "ac", match: false},
+		{pattern: "*b*", s: "a/b/c", match: true},
+		{pattern: "abc", s: "abc", match: true},
+		{pattern: "abc", s: "abcd", match: false},
+		{pattern: "a**", s: "a", match: true},
+	}
+	for _, v := range tt {
+		a.Equal(v.match, matchPattern(v.pattern, v.s), "%s %s", v.pattern, v.s)
+	}
+}
+
+type testBanStore struct {
+	entries map[string]*persistence_ban.Entry
+}
+
+func (s *testBanStore) Save(entry *persistence_ban.Entry) error {
+	s.entries[entry.Value] = entry
+	return nil
+}
+
+func (s *testBanStore) Remove(kind int, value string) error {
+	delete(s.entries, value)
+	return nil
+}
+
+func (s *testBanStore) Iterate(fn func(entry *persistence_ban.Entry) bool) error {
+	for _, v := range s.entries {
+		if !fn(v) {
+			return nil
+		}
+	}
+	return nil
+}
+
+func TestBanService_Persistence(t *testing.T) {
+	a := assert.New(t)
+	store := &testBanStore{entries: make(map[string]*persistence_ban.Entry)}
+	srv := NewServer(WithBanPersistence(store))
+	a.NoError(srv.banService.Ban(BanCIDR, "10.0.0.0/8", 0))
+	a.NoError(srv.banService.Ban(BanClientID, "id", time.Minute))
+	a.NoError(srv.banService.Ban(BanClientID, "removed", time.Minute))
+	a.True(srv.banService.Unban(BanClientID, "removed"))
+	a.Len(store.entries, 2)
+	store.entries["expired"] = &persistence_ban.Entry{Kind: int(BanClientID), Value: "expired", Until: time.Now()}
+
+	srv = NewServer(WithBanPersistence(store))
+	a.NoError(srv.restoreBans())
+	bans := srv.banService.Bans()
+	a.Len(bans, 2)
+	a.Equal("id", bans[0].Value)
+	a.Equal(BanCIDR, bans[1].Kind)
+	a.True(srv.banService.banned("other", net.ParseIP("10.1.1.1"), time.Now()))
+	a.Len(store.entries, 2)
+}
+
+func TestBanService_Flapping(t *testing.T) {
+	a := assert.New(t)
+	config := DefaultConfig
+	config.FlappingMaxDisconnects = 3
+	config.FlappingWindow = time.Minute
+	config.FlappingBanDuration = time.Minute
+	srv := NewServer(WithConfig(config))
+	var bans []Ban
+	srv.hooks.OnBanned = func(ctx context.Context, ban Ban) {
+		bans = append(bans, ban)
+	}
+	c := srv.newClient(&rwTestConn{})
+	c.opts.clientID = "id"
+	b := srv.banService
+	now := time.Now()
+	b.disconnected(c, now)
+	b.disconnected(c, now.Add(10*time.Second))
+	// the window restarts
+	b.disconnected(c, now.Add(2*time.Minute))
+	a.Len(bans, 0)
+	b.disconnected(c, now.Add(2*time.Minute+time.Second))
+	b.disconnected(c, now.Add(2*time.Minute+2*time.Second))
+	a.Len(bans, 1)
+	a.Equal(BanClientID, bans[0].Kind)
+	a.Equal("id", bans[0].Value)
+	a.True(bans[0].Flapping)
+	a.Empty(b.flaps)
+}
+
+func TestBanService_Server(t *testing.T) {
+	a := assert.New(t)
+	ln, err := net.Listen("tcp", "127.0.0.1:1883")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	config := DefaultConfig
+	config.FlappingMaxDisconnects = 2
+	config.FlappingBanBy = BanIP
+	var mu sync.Mutex
+	var bans []Ban
+	srv := NewServer(WithTCPListener(ln), WithConfig(config), WithHook(Hooks{
+		OnBanned: func(ctx context.Context, ban Ban) {
+			mu.Lock()
+			defer mu.Unlock()
+			bans = append(bans, ban)
+		},
+	}))
+	defer srv.Stop(context.Background())
+	srv.Run()
+
+	for i := 0; i < 2; i++ {
+		c, code := dialAndConnect(t, "id1")
+		a.EqualValues(packets.CodeAccepted, code)
+		c.Close()
+	}
+	a.Eventually(func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(bans) == 1
+	}, time.Second, 10*time.Millisecond)
+	a.Equal("127.0.0.1", srv.BanService().Bans()[0].Value)
+	c, code := dialAndConnect(t, "id2")
+	c.Close()
+	a.EqualValues(packets.CodeNotAuthorized, code)
+
+	a.True(srv.BanService().Unban(BanIP, "127.0.0.1"))
+	c, code = dialAndConnect(t, "id2")
+	defer c.Close()
+	a.EqualValues(packets.CodeAccepted, code)
+
+	// the online client is closed once it is banned.
+	a.NoError(srv.BanService().Ban(BanClientID, "id2", time.Minute))
+	c.SetReadDeadline(time.Now().Add(time.Second))
+	_, err = packets.NewReader(c).ReadPacket()
+	a.Error(err)
+}
@@ -0,0 +1,106 @@
+package gmqtt
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+
+	"go.uber.org/zap"
+
+	"github.com/DrmagicE/gmqtt/pkg/packets"
+)
+
+// CertIdentityMode is how the identities of the client certificate are used, see Config.CertIdentity.
+type CertIdentityMode byte
+
+const (
+	// CertIdentityNone ignores the client certificate.
+	CertIdentityNone CertIdentityMode = iota
+	// CertIdentityAsClientID uses the first identity as the client id.
+	CertIdentityAsClientID
+	// CertIdentityAsUsername uses the first identity as the username.
+	CertIdentityAsUsername
+	// CertIdentityVerifyClientID rejects the client if its client id is not one of the identities.
+	CertIdentityVerifyClientID
+	// CertIdentityVerifyUsername rejects the client if its username is not one of the identities.
+	CertIdentityVerifyUsername
+)
+
+// DefaultCertIdentity returns the subject common name followed by the DNS, email and URI SANs of the leaf certificate.
+// It is the default OnCertIdentity hook.
+func DefaultCertIdentity(ctx context.Context, client Client, chain []*x509.Certificate) (identities []string) {
+	if len(chain) == 0 {
+		return nil
+	}
+	leaf := chain[0]
+	if leaf.Subject.CommonName != "" {
+		identities = append(identities, leaf.Subject.CommonName)
+	}
+	identities = append(identities, leaf.DNSNames...)
+	identities = append(identities, leaf.EmailAddresses...)
+	for _, u := range leaf.URIs {
+		identities = append(identities, u.String())
+	}
+	return identities
+}
+
+// tlsConnectionState returns the state of the TLS connection, ok is false if the connection is not a TLS connection.
+func tlsConnectionState(c net.Conn) (state tls.ConnectionState, ok bool) {
+	if ws, isWs := c.(*wsConn); isWs {
+		c = ws.Conn
+	}
+	tc, ok := c.(*tls.Conn)
+	if !ok {
+		return state, false
+	}
+	return tc.ConnectionState(), true
+}
+
+// applyCertIdentity applies Config.CertIdentity to the client and returns the code of the connack packet.
+// It must be called after the CONNECT packet has been read, so that the TLS handshake has been done.
+// The non-TLS connections are not affected.
+func (client *client) applyCertIdentity(tlsConn bool) (code uint8) {
+	mode := client.server.config.CertIdentity
+	if mode == CertIdentityNone || !tlsConn {
+		return packets.CodeAccepted
+	}
+	identity := client.server.hooks.OnCertIdentity
+	if identity == nil {
+		identity = DefaultCertIdentity
+	}
+	identities := identity(context.Background(), client, client.opts.peerCertificates)
+	var ok bool
+	switch mode {
+	case CertIdentityAsClientID:
+		if ok = len(identities) != 0; ok {
+			client.opts.clientID = identities[0]
+		}
+	case CertIdentityAsUsername:
+		if ok = len(identities) != 0; ok {
+			client.opts.username = identities[0]
+		}
+	case CertIdentityVerifyClientID:
+		ok = containsString(identities, client.opts.clientID)
+	case CertIdentityVerifyUsername:
+		ok = containsString(identities, client.opts.username)
+	}
+	if !ok {
+		clientLog().Info("client certificate identity rejected",
+			zap.String("remote_addr", client.rwc.RemoteAddr().String()),
+			zap.String("client_id", client.opts.clientID),
+			zap.Strings("identities", identities),
+		)
+		return packets.CodeNotAuthorized
+	}
+	return packets.CodeAccepted
+}
+
+func containsString(s []string, v string) bool {
+	for _, e := range s {
+		if e == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,183 @@
+package gmqtt
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/DrmagicE/gmqtt/pkg/packets"
+)
+
+func newTestCertificate(t *testing.T, cn string, dnsNames ...string) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	tpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: cn},
+		DNSNames:     dnsNames,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tpl, tpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// tlsConnect connects to the TLS server with the client certificate and returns the connack code.
+func tlsConnect(t *testing.T, addr string, cert *tls.Certificate, connect *packets.Connect) uint8 {
+	cfg := &tls.Config{InsecureSkipVerify: true}
+	if cert != nil {
+		cfg.Certificates = []tls.Certificate{*cert}
+	}
+	c, err := tls.Dial("tcp", addr, cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	w := packets.NewWriter(c)
+	r := packets.NewReader(c)
+	w.WriteAndFlush(connect)
+	p, err := r.ReadPacket()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	return p.(*packets.Connack).Code
+}
+
+func TestCertIdentity(t *testing.T) {
+	a := assert.New(t)
+	serverCert := newTestCertificate(t, "localhost")
+	clientCert := newTestCertificate(t, "device1", "device1.example.com")
+	var tt = []struct {
+		name     string
+		mode     CertIdentityMode
+		cert     *tls.Certificate
+		clientID string
+		username string
+		code     uint8
+		// wantClientID and wantUsername are the options of the accepted client.
+		wantClientID string
+		wantUsername string
+	}{
+		{name: "none", mode: CertIdentityNone, cert: &clientCert, clientID: "id", username: "user",
+			code: packets.CodeAccepted, wantClientID: "id", wantUsername: "user"},
+		{name: "as_client_id", mode: CertIdentityAsClientID, cert: &clientCert, clientID: "id", username: "user",
+			code: packets.CodeAccepted, wantClientID: "device1", wantUsername: "user"},
+		{name: "as_username", mode: CertIdentityAsUsername, cert: &clientCert, clientID: "id", username: "user",
+			code: packets.CodeAccepted, wantClientID: "id", wantUsername: "device1"},
+		{name: "as_client_id_no_cert", mode: CertIdentityAsClientID, clientID: "id", code: packets.CodeNotAuthorized},
+		{name: "verify_client_id_san", mode: CertIdentityVerifyClientID, cert: &clientCert, clientID: "device1.example.com",
+			code: packets.CodeAccepted, wantClientID: "device1.example.com"},
+		{name: "verify_client_id_mismatch", mode: CertIdentityVerifyClientID, cert: &clientCert, clientID: "device2",
+			code: packets.CodeNotAuthorized},
+		{name: "verify_username", mode: CertIdentityVerifyUsername, cert: &clientCert, clientID: "id", username: "device1",
+			code: packets.CodeAccepted, wantClientID: "id", wantUsername: "device1"},
+		{name: "verify_username_mismatch", mode: CertIdentityVerifyUsername, cert: &clientCert, clientID: "id", username: "user",
+			code: packets.CodeNotAuthorized},
+	}
+	for _, v := range tt {
+		t.Run(v.name, func(t *testing.T) {
+			ln, err := tls.Listen("tcp", "127.0.0.1:1883", &tls.Config{
+				Certificates: []tls.Certificate{serverCert},
+				ClientAuth:   tls.RequestClientCert,
+			})
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			config := DefaultConfig
+			config.CertIdentity = v.mode
+			var connected = make(chan Client, 1)
+			srv := NewServer(WithTCPListener(ln), WithConfig(config), WithHook(Hooks{
+				OnConnected: func(ctx context.Context, client Client) {
+					connected <- client
+				},
+			}))
+			defer srv.Stop(context.Background())
+			srv.Run()
+
+			connect := defaultConnectPacket()
+			connect.ClientID = []byte(v.clientID)
+			connect.Username = []byte(v.username)
+			a.Equal(v.code, tlsConnect(t, "127.0.0.1:1883", v.cert, connect))
+			if v.code != packets.CodeAccepted {
+				return
+			}
+			select {
+			case c := <-connected:
+				a.Equal(v.wantClientID, c.OptionsReader().ClientID())
+				a.Equal(v.wantUsername, c.OptionsReader().Username())
+				a.Len(c.OptionsReader().PeerCertificates(), 1)
+			case <-time.After(time.Second):
+				t.Fatal("OnConnected timeout")
+			}
+		})
+	}
+}
+
+func TestCertIdentity_Hook(t *testing.T) {
+	a := assert.New(t)
+	serverCert := newTestCertificate(t, "localhost")
+	clientCert := newTestCertificate(t, "device1")
+	ln, err := tls.Listen("tcp", "127.0.0.1:1883", &tls.Config{
+		Certificates: []tls.Certificate{serverCert},
+		ClientAuth:   tls.RequireAnyClientCert,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	config := DefaultConfig
+	config.CertIdentity = CertIdentityVerifyClientID
+	srv := NewServer(WithTCPListener(ln), WithConfig(config), WithHook(Hooks{
+		OnCertIdentity: func(ctx context.Context, client Client, chain []*x509.Certificate) (identities []string) {
+			return []string{"tenant/" + chain[0].Subject.CommonName}
+		},
+	}))
+	defer srv.Stop(context.Background())
+	srv.Run()
+
+	connect := defaultConnectPacket()
+	connect.ClientID = []byte("tenant/device1")
+	a.EqualValues(packets.CodeAccepted, tlsConnect(t, "127.0.0.1:1883", &clientCert, connect))
+	connect.ClientID = []byte("device1")
+	a.EqualValues(packets.CodeNotAuthorized, tlsConnect(t, "127.0.0.1:1883", &clientCert, connect))
+}
+
+func TestCertIdentity_NonTLS(t *testing.T) {
+	a := assert.New(t)
+	ln, err := net.Listen("tcp", "127.0.0.1:1883")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	config := DefaultConfig
+	config.CertIdentity = CertIdentityAsClientID
+	srv := NewServer(WithTCPListener(ln), WithConfig(config))
+	defer srv.Stop(context.Background())
+	srv.Run()
+
+	c, err := net.Dial("tcp", "127.0.0.1:1883")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer c.Close()
+	packets.NewWriter(c).WriteAndFlush(defaultConnectPacket())
+	p, err := packets.NewReader(c).ReadPacket()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	a.EqualValues(packets.CodeAccepted, p.(*packets.Connack).Code)
+}
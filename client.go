@@ -7,12 +7,14 @@ import (
 	"context"
 	"crypto/md5"
 	"crypto/rand"
+	"crypto/x509"
 	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
 	"net"
 	"os"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -90,6 +92,17 @@ type Client interface {
 	Close() <-chan struct{}
 
 	GetSessionStatsManager() SessionStatsManager
+	// GetClientStats returns the statistics of the current connection of the client, which is reset on reconnecting.
+	GetClientStats() *ConnectionStats
+	// Session returns the key/value attributes of the session of the client.
+	Session() ClientSession
+	// CredentialExpiry returns the time the credential of the client expires, the zero time means it never expires.
+	CredentialExpiry() time.Time
+	// SetCredentialExpiry sets the time the credential of the client expires, e.g: the exp claim of the JWT,
+	// the zero time cancels the expiry. The client is disconnected once the credential expires,
+	// unless the OnCredentialExpiry hooks extend it. It replaces the expiry set before,
+	// including the certificate expiry set by Config.DisconnectOnCertExpiry.
+	SetCredentialExpiry(expiry time.Time)
 }
 
 // Client represents a MQTT client and implements the Client interface
@@ -119,12 +132,41 @@ type client struct {
 	disconnectedAt int64
 
 	statsManager SessionStatsManager
+	// listener is the statistics of the listener which accepted the connection.
+	listener *ListenerStats
+	// ln is the tcp listener which accepted the connection, nil for the websocket connections.
+	ln net.Listener
+	// remoteIP is the source address of the connection, nil if it is not an IP address.
+	remoteIP net.IP
+	// keepAlive is the effective keep alive in seconds, which can be overridden by ClientService.SetKeepAlive.
+	keepAlive uint32
+	// attributes is the key/value attributes of the session, see ClientSession.
+	attributes *clientSession
+	// packetStats is the statistics of the packets of the current connection.
+	packetStats PacketStats
+	// lastSeen is the unix nano time of the last packet received from the client.
+	lastSeen int64
+	// credential is the credential expiry of the client, see SetCredentialExpiry.
+	credential credentialExpiry
 }
 
 func (client *client) GetSessionStatsManager() SessionStatsManager {
 	return client.statsManager
 }
 
+func (client *client) GetClientStats() *ConnectionStats {
+	rs := &ConnectionStats{
+		PacketStats:  client.packetStats.copy(),
+		SessionStats: client.statsManager.GetStats(),
+	}
+	rs.BytesReceived = rs.PacketStats.BytesReceived.total()
+	rs.BytesSent = rs.PacketStats.BytesSent.total()
+	if t := atomic.LoadInt64(&client.lastSeen); t != 0 {
+		rs.LastSeen = time.Unix(0, t)
+	}
+	return rs
+}
+
 func (client *client) setConnectedAt(time time.Time) {
 	atomic.StoreInt64(&client.connectedAt, time.Unix())
 }
@@ -201,6 +243,12 @@ type ClientOptionsReader interface {
 	WillPayload() []byte
 	LocalAddr() net.Addr
 	RemoteAddr() net.Addr
+	// PeerCertificates returns the certificate chain presented by the client over TLS, nil for the non-TLS connections.
+	PeerCertificates() []*x509.Certificate
+	// ProtocolLevel returns the protocol level of the CONNECT packet, see packets.Version31 and packets.Version311.
+	ProtocolLevel() byte
+	// ListenerProfile returns the profile of the listener which accepted the connection, nil if it has no profile.
+	ListenerProfile() *ListenerProfile
 }
 
 // options client options
@@ -217,6 +265,10 @@ type options struct {
 	willPayload  []byte
 	localAddr    net.Addr
 	remoteAddr   net.Addr
+
+	peerCertificates []*x509.Certificate
+	protocolLevel    byte
+	profile          *ListenerProfile
 }
 
 // ClientID return clientID
@@ -268,12 +320,29 @@ func (o *options) LocalAddr() net.Addr {
 func (o *options) RemoteAddr() net.Addr {
 	return o.remoteAddr
 }
+func (o *options) PeerCertificates() []*x509.Certificate {
+	return o.peerCertificates
+}
+func (o *options) ProtocolLevel() byte {
+	return o.protocolLevel
+}
+func (o *options) ListenerProfile() *ListenerProfile {
+	return o.profile
+}
+
+// onProtocolViolation logs the protocol violation tolerated in the packets.Lenient level.
+func (client *client) onProtocolViolation(fh *packets.FixHeader, err error) {
+	clientLog().Warn("protocol violation tolerated", client.logFields(
+		zap.Uint8("control_packet_type", fh.PacketType),
+		zap.Error(err),
+	)...)
+}
 
 func (client *client) setError(err error) {
 	select {
 	case client.error <- err:
 		if err != nil && err != io.EOF {
-			zaplog.Error("connection lost", zap.String("error_msg", err.Error()))
+			clientLog().Error("connection lost", client.logFields(zap.Error(err))...)
 		}
 	default:
 	}
@@ -288,30 +357,104 @@ func (client *client) writeLoop() {
 		client.setError(err)
 		client.wg.Done()
 	}()
+	var flushTimer *time.Timer
+	// flushC is not nil if the flush timer is armed for the buffered packets.
+	var flushC <-chan time.Time
 	for {
 		select {
 		case <-client.close: //关闭
 			return
+		case <-flushC:
+			flushC = nil
+			if err = client.packetWriter.Flush(); err != nil {
+				return
+			}
 		case packet := <-client.out:
-			zaplog.Debug("sending packet",
-				zap.String("packet", packet.String()),
-				zap.String("client_id", client.opts.clientID),
-				zap.String("remote_addr", client.rwc.RemoteAddr().String()),
-			)
-			err = client.writePacket(packet)
+			var delivery *Delivery
+			// original is the publish before OnDeliverRewrite.
+			var original *packets.Publish
+			if pub, d := unwrapDelivery(packet); pub != nil {
+				original = pub
+				packet, delivery = client.rewriteDeliver(pub), d
+			}
+			if ce := clientLog().Check(zap.DebugLevel, "sending packet"); ce != nil {
+				ce.Write(client.logFields(
+					zap.String("packet_type", packetType(packet)),
+					zap.String("packet", packet.String()),
+				)...)
+			}
+			err = client.packetWriter.WritePacket(packet)
 			if err != nil {
 				return
 			}
+			if client.shouldFlush(packet) {
+				if err = client.packetWriter.Flush(); err != nil {
+					return
+				}
+			} else if interval := client.server.config.WriteFlushInterval; interval > 0 && flushC == nil {
+				if flushTimer == nil {
+					flushTimer = time.NewTimer(interval)
+					defer flushTimer.Stop()
+				} else {
+					flushTimer.Reset(interval)
+				}
+				flushC = flushTimer.C
+			}
 			client.server.statsManager.packetSent(packet)
+			client.listener.packetSent(packet)
+			client.packetStats.add(packet, false)
 			if pub, ok := packet.(*packets.Publish); ok {
+				client.server.traceService.record(TraceDelivered, client.opts.clientID, pub, "")
+				client.server.telemetry.delivered.Add(context.Background(), 1, qosAttr(pub.Qos))
 				client.server.statsManager.messageSent(pub.Qos)
 				client.statsManager.messageSent(pub.Qos)
+				if ts := client.server.topicStats; ts != nil {
+					ts.messageOut(string(original.TopicName), len(original.Payload))
+				}
+				if client.server.hooks.OnDelivered != nil {
+					if delivery == nil {
+						delivery = client.newDelivery(pub)
+					}
+					client.server.hooks.OnDelivered(context.Background(), client, delivery)
+				}
 			}
 		}
 
 	}
 }
 
+// rewriteDeliver returns the copy of the publish with the topic name rewritten by OnDeliverRewrite,
+// or the publish itself if the topic name is not rewritten.
+func (client *client) rewriteDeliver(pub *packets.Publish) *packets.Publish {
+	if client.server.hooks.OnDeliverRewrite == nil {
+		return pub
+	}
+	name := client.server.hooks.OnDeliverRewrite(context.Background(), client, string(pub.TopicName))
+	if name == string(pub.TopicName) {
+		return pub
+	}
+	if !packets.ValidTopicName([]byte(name)) {
+		clientLog().Warn("invalid rewritten delivery topic name, sending original topic", client.logFields(
+			zap.String("topic", string(pub.TopicName)),
+			zap.String("rewritten", name),
+		)...)
+		return pub
+	}
+	rewritten := *pub
+	rewritten.TopicName = []byte(name)
+	return &rewritten
+}
+
+// shouldFlush returns whether the buffered packets should be flushed after writing the packet,
+// see Config.WriteFlushInterval and Config.WriteFlushThreshold.
+func (client *client) shouldFlush(packet packets.Packet) bool {
+	if _, ok := packet.(*packets.Publish); !ok || client.server.config.WriteFlushInterval <= 0 {
+		return true
+	}
+	threshold := client.server.config.WriteFlushThreshold
+	return threshold > 0 && client.bufw.Buffered() >= threshold
+}
+
 func (client *client) writePacket(packet packets.Packet) error {
 	err := client.packetWriter.WritePacket(packet)
 	if err != nil {
@@ -332,20 +475,25 @@ func (client *client) readLoop() {
 	for {
 		var packet packets.Packet
 		if client.IsConnected() {
-			if keepAlive := client.opts.keepAlive; keepAlive != 0 { //KeepAlive
-				client.rwc.SetReadDeadline(time.Now().Add(time.Duration(keepAlive/2+keepAlive) * time.Second))
+			client.server.overload.waitResume(client.close)
+			if keepAlive := client.getKeepAlive(); keepAlive != 0 { //KeepAlive
+				client.rwc.SetReadDeadline(time.Now().Add(keepAliveTimeout(keepAlive)))
 			}
 		}
 		packet, err = client.packetReader.ReadPacket()
 		if err != nil {
 			return
 		}
-		zaplog.Debug("received packet",
-			zap.String("packet", packet.String()),
-			zap.String("remote", client.rwc.RemoteAddr().String()),
-			zap.String("client_id", client.opts.clientID),
-		)
+		if ce := clientLog().Check(zap.DebugLevel, "received packet"); ce != nil {
+			ce.Write(client.logFields(
+				zap.String("packet_type", packetType(packet)),
+				zap.String("packet", packet.String()),
+			)...)
+		}
 		client.server.statsManager.packetReceived(packet)
+		client.listener.packetReceived(packet)
+		client.packetStats.add(packet, true)
+		atomic.StoreInt64(&client.lastSeen, time.Now().UnixNano())
 		if pub, ok := packet.(*packets.Publish); ok {
 			client.server.statsManager.messageReceived(pub.Qos)
 		}
@@ -456,8 +604,42 @@ func (client *client) connectWithTimeOut() (ok bool) {
 	client.opts.willRetain = conn.WillRetain
 	client.opts.remoteAddr = client.rwc.RemoteAddr()
 	client.opts.localAddr = client.rwc.LocalAddr()
-	if keepAlive := client.opts.keepAlive; keepAlive != 0 { //KeepAlive
-		client.rwc.SetReadDeadline(time.Now().Add(time.Duration(keepAlive/2+keepAlive) * time.Second))
+	client.opts.protocolLevel = conn.ProtocolLevel
+	span := client.server.telemetry.startConnect(client)
+	defer func() {
+		client.server.telemetry.endConnect(span, conn.AckCode, err)
+	}()
+	state, tlsConn := tlsConnectionState(client.rwc)
+	client.opts.peerCertificates = state.PeerCertificates
+	keepAlive := client.opts.keepAlive
+	if k := client.server.config.ServerKeepAlive; k != 0 {
+		keepAlive = k
+	}
+	client.setKeepAlive(keepAlive)
+	if keepAlive != 0 { //KeepAlive
+		client.rwc.SetReadDeadline(time.Now().Add(keepAliveTimeout(keepAlive)))
+	}
+	if !client.allowProtocolLevel(conn.ProtocolLevel) && conn.AckCode == packets.CodeAccepted {
+		conn.AckCode = packets.CodeUnacceptableProtocolVersion
+	}
+	if max := client.server.config.MaxClientIDLength; max > 0 && len(conn.ClientID) > max &&
+		conn.AckCode == packets.CodeAccepted {
+		conn.AckCode = packets.CodeIdentifierRejected
+	}
+	if conn.AckCode == packets.CodeAccepted {
+		conn.AckCode = client.checkBan()
+	}
+	if conn.AckCode == packets.CodeAccepted {
+		conn.AckCode = client.checkConnQuota()
+	}
+	if conn.AckCode == packets.CodeAccepted {
+		conn.AckCode = client.checkOverload()
+	}
+	if conn.AckCode == packets.CodeAccepted {
+		conn.AckCode = client.applyCertIdentity(tlsConn)
+	}
+	if conn.AckCode == packets.CodeAccepted {
+		conn.AckCode = client.authenticate()
 	}
 	register := &register{
 		client:  client,
@@ -477,15 +659,59 @@ func (client *client) connectWithTimeOut() (ok bool) {
 	return
 }
 
+// authenticate calls the OnConnect hook and returns the code of the connack packet.
+// If Config.MaxConcurrentAuth is set, the client has to acquire an authentication slot before calling the hook,
+// and it will be rejected with CodeServerUnavaliable if no slot is available within Config.AuthWaitTimeout.
+func (client *client) authenticate() (code uint8) {
+	srv := client.server
+	if srv.hooks.OnConnect == nil {
+		return packets.CodeAccepted
+	}
+	if sem := srv.authSem; sem != nil {
+		select {
+		case sem <- struct{}{}:
+		default:
+			if !client.waitAuthSlot(sem) {
+				clientLog().Warn("too many concurrent authentications, rejecting connection", client.logFields()...)
+				return packets.CodeServerUnavaliable
+			}
+		}
+		defer func() {
+			<-sem
+		}()
+	}
+	return srv.hooks.OnConnect(context.Background(), client)
+}
+
+// waitAuthSlot waits for a free authentication slot within Config.AuthWaitTimeout.
+func (client *client) waitAuthSlot(sem chan struct{}) bool {
+	timeout := client.server.config.AuthWaitTimeout
+	if timeout <= 0 {
+		return false
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case sem <- struct{}{}:
+		return true
+	case <-timer.C:
+		return false
+	case <-client.close:
+		return false
+	}
+}
+
 func (client *client) newSession() {
 	s := &session{
-		unackpublish: make(map[packets.PacketID]bool),
-		inflight:     list.New(),
-		awaitRel:     list.New(),
-		msgQueue:     list.New(),
-		lockedPid:    make(map[packets.PacketID]bool),
-		freePid:      1,
-		config:       &client.server.config,
+		unackpublish:     make(map[packets.PacketID]bool),
+		inflight:         list.New(),
+		awaitRel:         list.New(),
+		msgQueue:         list.New(),
+		msgQueueAt:       make(map[*packets.Publish]time.Time),
+		msgQueuePriority: make(map[*packets.Publish]int),
+		lockedPid:        make(map[packets.PacketID]bool),
+		freePid:          1,
+		config:           &client.server.config,
 	}
 	client.session = s
 }
@@ -499,19 +725,25 @@ func (client *client) internalClose() {
 	}
 	putBufioReader(client.bufr)
 	putBufioWriter(client.bufw)
+	client.SetCredentialExpiry(time.Time{})
 
 	// onClose hooks
 	if client.server.hooks.OnClose != nil {
 		client.server.hooks.OnClose(context.Background(), client, client.err)
 	}
 	client.setDisconnectedAt(time.Now())
+	if atomic.LoadInt64(&client.connectedAt) != 0 {
+		client.server.banService.disconnected(client, time.Now())
+	}
 	client.server.statsManager.addClientDisconnected()
 	client.server.statsManager.decSessionActive()
 }
 
 // 这里的publish都是已经copy后的publish了
 // 从msgRouter过来的publish 的dup不可能是true
-func (client *client) onlinePublish(publish *packets.Publish) {
+func (client *client) onlinePublish(ctx context.Context, publish *packets.Publish, delivery *Delivery) {
+	span := client.server.telemetry.startDeliver(ctx, client, publish)
+	defer span.End()
 	if publish.Qos >= packets.QOS_1 {
 		if publish.Dup {
 			//redelivery on reconnect,use the original packet id
@@ -519,19 +751,27 @@ func (client *client) onlinePublish(publish *packets.Publish) {
 		} else {
 			publish.PacketID = client.session.getPacketID()
 		}
-		if !client.setInflight(publish) {
-			return
-		}
 	}
-	client.sendMsg(publish)
+	if delivery != nil {
+		delivery.Qos = publish.Qos
+		delivery.PacketID = publish.PacketID
+	}
+	if publish.Qos >= packets.QOS_1 && !client.setInflight(publish, span.SpanContext(), delivery) {
+		return
+	}
+	client.sendMsg(publish, delivery)
 }
 
 // sendMsg wrap the hook function and session stats
-func (client *client) sendMsg(publish *packets.Publish) {
+func (client *client) sendMsg(publish *packets.Publish, delivery *Delivery) {
+	var p packets.Packet = publish
+	if delivery != nil {
+		p = &deliveryPublish{Publish: publish, delivery: delivery}
+	}
 	select {
 	case <-client.close:
 		return
-	case client.out <- publish:
+	case client.out <- p:
 		// onDeliver hook
 		if client.server.hooks.OnDeliver != nil {
 			client.server.hooks.OnDeliver(context.Background(), client, messageFromPublish(publish))
@@ -539,9 +779,13 @@ func (client *client) sendMsg(publish *packets.Publish) {
 	}
 }
 
-func (client *client) publish(publish *packets.Publish) {
+func (client *client) publish(ctx context.Context, publish *packets.Publish, delivery *Delivery) {
+	if publish.Qos == packets.QOS_0 && client.server.overload.active(OverloadShedQos0) {
+		client.msgDropped(publish, DroppedOverload, "overload")
+		return
+	}
 	if client.IsConnected() { //在线消息
-		client.onlinePublish(publish)
+		client.onlinePublish(ctx, publish, delivery)
 	} else { //离线消息
 		client.msgEnQueue(publish)
 	}
@@ -558,39 +802,134 @@ func (client *client) write(packets packets.Packet) {
 //Subscribe handler
 func (client *client) subscribeHandler(sub *packets.Subscribe) {
 	srv := client.server
+	// history is the number of the messages requested by the history subscriptions, key by the index of the topic.
+	var history map[int]int
+	if srv.config.MaxTopicHistory > 0 {
+		for k, v := range sub.Topics {
+			if !strings.HasPrefix(v.Name, historyTopicPrefix) {
+				continue
+			}
+			n, filter, ok := parseHistoryFilter(v.Name)
+			if !ok {
+				subscriptionLog().Warn("invalid history topic filter", client.logFields(zap.String("topic", v.Name))...)
+				sub.Topics[k].Qos = packets.SUBSCRIBE_FAILURE
+				continue
+			}
+			if history == nil {
+				history = make(map[int]int)
+			}
+			history[k] = n
+			sub.Topics[k].Name = filter
+		}
+	}
+	if srv.hooks.OnTopicRewrite != nil {
+		for k, v := range sub.Topics {
+			name := srv.hooks.OnTopicRewrite(context.Background(), client, RewriteSubscribe, v.Name)
+			if name == v.Name {
+				continue
+			}
+			if !packets.ValidTopicFilter([]byte(name)) {
+				subscriptionLog().Warn("invalid rewritten topic filter", client.logFields(
+					zap.String("topic", v.Name),
+					zap.String("rewritten", name),
+				)...)
+				sub.Topics[k].Qos = packets.SUBSCRIBE_FAILURE
+				continue
+			}
+			sub.Topics[k].Name = name
+		}
+	}
+	// reqs and requested are the subscriptions modified by OnSubscribeRewrite and the topic filters before the rewrite.
+	var reqs []SubscribeRequest
+	var requested []string
+	if srv.hooks.OnSubscribeRewrite != nil {
+		reqs = make([]SubscribeRequest, len(sub.Topics))
+		requested = make([]string, len(sub.Topics))
+		for k, v := range sub.Topics {
+			requested[k] = v.Name
+			reqs[k].Topic = v
+			if v.Qos == packets.SUBSCRIBE_FAILURE {
+				continue
+			}
+			srv.hooks.OnSubscribeRewrite(context.Background(), client, &reqs[k])
+			t := &reqs[k].Topic
+			if t.Qos != packets.SUBSCRIBE_FAILURE {
+				if !packets.ValidTopicFilter([]byte(t.Name)) {
+					subscriptionLog().Warn("invalid rewritten topic filter", client.logFields(
+						zap.String("topic", v.Name),
+						zap.String("rewritten", t.Name),
+					)...)
+					t.Qos = packets.SUBSCRIBE_FAILURE
+				} else if t.Qos > v.Qos {
+					t.Qos = v.Qos
+				}
+			}
+			sub.Topics[k] = *t
+		}
+	}
+	client.applySubscriptionPolicy(sub.Topics)
 	if srv.hooks.OnSubscribe != nil {
 		for k, v := range sub.Topics {
+			if v.Qos == packets.SUBSCRIBE_FAILURE {
+				continue
+			}
 			qos := srv.hooks.OnSubscribe(context.Background(), client, v)
 			sub.Topics[k].Qos = qos
 		}
 	}
 	var msgs []packets.Message
 	suback := sub.NewSubBack()
+	quota := client.newSubscriptionQuota()
 	for k, v := range sub.Topics {
 		if v.Qos != packets.SUBSCRIBE_FAILURE {
+			if !quota.allow(v.Name) {
+				suback.Payload[k] = packets.SUBSCRIBE_FAILURE
+				subscriptionLog().Info("subscribe rejected by the policy", client.logFields(
+					zap.String("topic", v.Name),
+					zap.String("reason", "quota exceeded"),
+				)...)
+				continue
+			}
 			topic := packets.Topic{
 				Name: v.Name,
 				Qos:  suback.Payload[k],
 			}
-			srv.subscriptionsDB.Subscribe(client.opts.clientID, topic)
+			rs := srv.subscriptionsDB.Subscribe(client.opts.clientID, topic)
+			if rs[0].Err != nil {
+				suback.Payload[k] = packets.SUBSCRIBE_FAILURE
+				subscriptionLog().Info("subscribe rejected by the store", client.logFields(
+					zap.String("topic", v.Name),
+					zap.Error(rs[0].Err),
+				)...)
+				continue
+			}
+			retainHandling := RetainSendOnSubscribe
+			if reqs != nil {
+				srv.setSubscriptionState(client.opts.clientID, topic.Name, subscriptionState{
+					requested: requested[k],
+					noLocal:   reqs[k].NoLocal,
+				})
+				retainHandling = reqs[k].RetainHandling
+			}
 			if srv.hooks.OnSubscribed != nil {
 				srv.hooks.OnSubscribed(context.Background(), client, topic)
 			}
-			zaplog.Info("subscribe succeeded",
+			subscriptionLog().Info("subscribe succeeded", client.logFields(
 				zap.String("topic", v.Name),
 				zap.Uint8("qos", suback.Payload[k]),
-				zap.String("client_id", client.opts.clientID),
-				zap.String("remote_addr", client.rwc.RemoteAddr().String()),
-			)
-			// matched retained messages
-			msgs = srv.retainedDB.GetMatchedMessages(topic.Name)
+			)...)
+			if n, ok := history[k]; ok {
+				// the history messages are replayed instead of the retained messages.
+				msgs = append(msgs, srv.historyService.Messages(topic.Name, n)...)
+			} else if retainHandling == RetainSendOnSubscribe || (retainHandling == RetainSendIfNew && !rs[0].AlreadyExisted) {
+				// matched retained messages
+				msgs = append(msgs, srv.retainedDB.GetMatchedMessages(topic.Name)...)
+			}
 		} else {
-			zaplog.Info("subscribe failed",
+			subscriptionLog().Info("subscribe failed", client.logFields(
 				zap.String("topic", v.Name),
 				zap.Uint8("qos", suback.Payload[k]),
-				zap.String("client_id", client.opts.clientID),
-				zap.String("remote_addr", client.rwc.RemoteAddr().String()),
-			)
+			)...)
 		}
 	}
 	client.write(suback)
@@ -603,6 +942,9 @@ func (client *client) subscribeHandler(sub *packets.Subscribe) {
 func (client *client) publishHandler(pub *packets.Publish) {
 	s := client.session
 	srv := client.server
+	srv.traceService.record(TraceReceived, client.opts.clientID, pub, "")
+	ctx, span := srv.telemetry.startPublish(client, pub)
+	defer span.End()
 	var dup bool
 	if pub.Qos == packets.QOS_1 {
 		puback := pub.NewPuback()
@@ -617,22 +959,42 @@ func (client *client) publishHandler(pub *packets.Publish) {
 			s.unackpublish[pub.PacketID] = true
 		}
 	}
+	if srv.hooks.OnTopicRewrite != nil {
+		name := srv.hooks.OnTopicRewrite(context.Background(), client, RewritePublish, string(pub.TopicName))
+		if name != string(pub.TopicName) {
+			if !packets.ValidTopicName([]byte(name)) {
+				clientLog().Warn("invalid rewritten topic name, dropping message", client.logFields(
+					zap.String("topic", string(pub.TopicName)),
+					zap.String("rewritten", name),
+				)...)
+				srv.traceService.record(TraceDropped, client.opts.clientID, pub, "invalid rewritten topic name")
+				return
+			}
+			pub.TopicName = []byte(name)
+		}
+	}
 	msg := messageFromPublish(pub)
-	if pub.Retain {
-		if len(pub.Payload) == 0 {
-			srv.retainedDB.Remove(string(pub.TopicName))
-		} else {
-			srv.retainedDB.AddOrReplace(msg)
+	if srv.config.DelayedPublish && strings.HasPrefix(msg.topic, delayedTopicPrefix) {
+		if !dup {
+			client.delayPublish(msg)
 		}
+		return
+	}
+	if pub.Retain && !srv.retain(msg, client.opts.clientID) {
+		srv.traceService.record(TraceDropped, client.opts.clientID, pub, "retained message over quota")
+		return
 	}
 	if !dup {
 		var valid = true
 		if srv.hooks.OnMsgArrived != nil {
 			valid = srv.hooks.OnMsgArrived(context.Background(), client, msg)
 		}
+		if !valid {
+			srv.traceService.record(TraceDropped, client.opts.clientID, pub, "rejected by OnMsgArrived")
+		}
 		if valid {
 			pub.Retain = false
-			msgRouter := &msgRouter{msg: messageFromPublish(pub), match: true}
+			msgRouter := &msgRouter{ctx: ctx, publisher: client.opts.clientID, msg: messageFromPublish(pub), match: true}
 			select {
 			case <-client.close:
 				return
@@ -641,6 +1003,27 @@ func (client *client) publishHandler(pub *packets.Publish) {
 		}
 	}
 }
+
+// retain stores or removes the retained message, it returns false if the message should be dropped.
+func (srv *server) retain(msg *msg, clientID string) bool {
+	if len(msg.payload) == 0 {
+		srv.retainedDB.Remove(msg.topic)
+	} else if srv.retainedOverQuota(msg) {
+		srv.statsManager.retainedDropped()
+		retainedLog().Warn("retained message over quota",
+			zap.String("topic", msg.topic),
+			zap.Int("payload_size", len(msg.payload)),
+			zap.String("client_id", clientID),
+		)
+		if srv.config.RetainedOverQuota == RetainedDropMessage {
+			return false
+		}
+	} else {
+		srv.retainedDB.AddOrReplace(msg)
+	}
+	return true
+}
+
 func (client *client) pubackHandler(puback *packets.Puback) {
 	client.unsetInflight(puback)
 }
@@ -667,6 +1050,10 @@ func (client *client) unsubscribeHandler(unSub *packets.Unsubscribe) {
 	unSuback := unSub.NewUnSubBack()
 	client.write(unSuback)
 	for _, topicName := range unSub.Topics {
+		if srv.hooks.OnTopicRewrite != nil {
+			topicName = srv.hooks.OnTopicRewrite(context.Background(), client, RewriteSubscribe, topicName)
+		}
+		topicName = srv.unsubscribeFilter(client.opts.clientID, topicName)
 		if srv.hooks.OnUnsubscribe != nil {
 			srv.hooks.OnUnsubscribe(context.Background(), client, topicName)
 		}
@@ -674,11 +1061,7 @@ func (client *client) unsubscribeHandler(unSub *packets.Unsubscribe) {
 		if srv.hooks.OnUnsubscribed != nil {
 			srv.hooks.OnUnsubscribed(context.Background(), client, topicName)
 		}
-		zaplog.Info("unsubscribed",
-			zap.String("topic", topicName),
-			zap.String("client_id", client.opts.clientID),
-			zap.String("remote_addr", client.rwc.RemoteAddr().String()),
-		)
+		subscriptionLog().Info("unsubscribed", client.logFields(zap.String("topic", topicName))...)
 	}
 
 }
@@ -693,6 +1076,8 @@ func (client *client) readHandle() {
 		client.setError(err)
 		client.wg.Done()
 	}()
+	gen := atomic.LoadUint64(&client.server.rateLimitGen)
+	limiter := client.newRateLimiter()
 	for {
 		select {
 		case <-client.close:
@@ -702,6 +1087,14 @@ func (client *client) readHandle() {
 			case *packets.Subscribe:
 				client.subscribeHandler(packet.(*packets.Subscribe))
 			case *packets.Publish:
+				var ok bool
+				if g := atomic.LoadUint64(&client.server.rateLimitGen); g != gen {
+					// the rate limits are reloaded.
+					gen, limiter = g, client.newRateLimiter()
+				}
+				if ok, err = client.throttle(limiter, packet.(*packets.Publish)); !ok {
+					return
+				}
 				client.publishHandler(packet.(*packets.Publish))
 			case *packets.Puback:
 				client.pubackHandler(packet.(*packets.Puback))
@@ -784,6 +1177,11 @@ func (client *client) redeliver() {
 
 //server goroutine结束的条件:1客户端断开连接 或 2发生错误
 func (client *client) serve() {
+	client.listener.connectionOpened()
+	defer client.listener.connectionClosed()
+	client.remoteIP = remoteIP(client.rwc.RemoteAddr())
+	client.server.connQuota.opened(client.remoteIP)
+	defer client.server.connQuota.closed(client.remoteIP)
 	defer client.internalClose()
 	client.wg.Add(3)
 	go client.errorWatch()
@@ -0,0 +1,120 @@
+package gmqtt
+
+import (
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// ClientService provides the ability to inspect and manage the clients.
+type ClientService interface {
+	// Get returns the client specified by clientID, nil if not found.
+	// The clients of the offline sessions are returned as well, see Client.IsConnected.
+	Get(clientID string) Client
+	// List returns at most n clients from the offset, ordered by client id, n <= 0 means no limit.
+	// total is the number of all clients.
+	List(offset, n int) (clients []Client, total int)
+	// Kick closes the connection of the online client, and returns whether the client was online.
+	// MQTT 3.1.1 does not allow the server to send DISCONNECT, so the reason is logged only.
+	// The session is kept unless it is a clean session.
+	Kick(clientID string, reason string) bool
+	// SetKeepAlive overrides the keep alive in seconds of the online client, 0 disables the keep alive check.
+	// It returns whether the client was online. The override lasts until the client disconnects,
+	// ClientOptionsReader.KeepAlive keeps returning the keep alive in the CONNECT packet.
+	SetKeepAlive(clientID string, keepAlive uint16) bool
+	// SetQueueLimits overrides the message queue limits of the client, see Server.SetQueueLimits.
+	SetQueueLimits(clientID string, limits *QueueLimits)
+}
+
+type clientService struct {
+	server *server
+}
+
+func (c *clientService) Get(clientID string) Client {
+	return c.server.Client(clientID)
+}
+
+func (c *clientService) List(offset, n int) ([]Client, int) {
+	srv := c.server
+	srv.mu.RLock()
+	ids := make([]string, 0, len(srv.clients))
+	for id := range srv.clients {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	total := len(ids)
+	if offset < 0 {
+		offset = 0
+	}
+	if offset > total {
+		offset = total
+	}
+	ids = ids[offset:]
+	if n > 0 && n < len(ids) {
+		ids = ids[:n]
+	}
+	rs := make([]Client, 0, len(ids))
+	for _, id := range ids {
+		rs = append(rs, srv.clients[id])
+	}
+	srv.mu.RUnlock()
+	return rs, total
+}
+
+// online returns the online client specified by clientID, nil if the client is offline or not found.
+func (c *clientService) online(clientID string) *client {
+	srv := c.server
+	srv.mu.RLock()
+	defer srv.mu.RUnlock()
+	if client, ok := srv.clients[clientID]; ok && client.IsConnected() {
+		return client
+	}
+	return nil
+}
+
+func (c *clientService) Kick(clientID string, reason string) bool {
+	client := c.online(clientID)
+	if client == nil {
+		return false
+	}
+	clientLog().Info("kicking client", client.logFields(zap.String("reason", reason))...)
+	client.Close()
+	return true
+}
+
+func (c *clientService) SetKeepAlive(clientID string, keepAlive uint16) bool {
+	client := c.online(clientID)
+	if client == nil {
+		return false
+	}
+	client.setKeepAlive(keepAlive)
+	// the read deadline is set before reading each packet, reset it to apply the override to the pending read.
+	if keepAlive != 0 {
+		client.rwc.SetReadDeadline(time.Now().Add(keepAliveTimeout(keepAlive)))
+	} else {
+		client.rwc.SetReadDeadline(time.Time{})
+	}
+	clientLog().Info("keep alive overridden", client.logFields(zap.Uint16("keep_alive", keepAlive))...)
+	return true
+}
+
+func (c *clientService) SetQueueLimits(clientID string, limits *QueueLimits) {
+	c.server.SetQueueLimits(clientID, limits)
+}
+
+// keepAliveTimeout returns the read timeout of the keep alive, which is one and a half times the keep alive.
+func keepAliveTimeout(keepAlive uint16) time.Duration {
+	return time.Duration(keepAlive/2+keepAlive) * time.Second
+}
+
+// setKeepAlive sets the effective keep alive of the client.
+func (client *client) setKeepAlive(keepAlive uint16) {
+	atomic.StoreUint32(&client.keepAlive, uint32(keepAlive))
+}
+
+// getKeepAlive returns the effective keep alive of the client.
+func (client *client) getKeepAlive() uint16 {
+	return uint16(atomic.LoadUint32(&client.keepAlive))
+}
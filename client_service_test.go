@@ -0,0 +1,82 @@
+package gmqtt
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/DrmagicE/gmqtt/pkg/packets"
+)
+
+func TestClientService(t *testing.T) {
+	a := assert.New(t)
+	srv := newTestServer()
+	defer srv.Stop(context.Background())
+	srv.Run()
+	cs := srv.ClientService()
+	for _, id := range []string{"id3", "id1", "id2"} {
+		conn := defaultConnectPacket()
+		conn.ClientID = []byte(id)
+		conn.CleanSession = false
+		conn.KeepAlive = 60
+		connectTestClient(srv, conn)
+	}
+
+	a.Nil(cs.Get("not-exist"))
+	a.Equal("id1", cs.Get("id1").OptionsReader().ClientID())
+
+	clients, total := cs.List(0, 0)
+	a.Equal(3, total)
+	var ids []string
+	for _, c := range clients {
+		ids = append(ids, c.OptionsReader().ClientID())
+	}
+	a.Equal([]string{"id1", "id2", "id3"}, ids)
+	clients, total = cs.List(1, 1)
+	a.Equal(3, total)
+	a.Len(clients, 1)
+	a.Equal("id2", clients[0].OptionsReader().ClientID())
+	clients, _ = cs.List(5, 1)
+	a.Len(clients, 0)
+
+	a.False(cs.SetKeepAlive("not-exist", 10))
+	a.True(cs.SetKeepAlive("id1", 10))
+	a.EqualValues(10, srv.clients["id1"].getKeepAlive())
+	a.EqualValues(60, cs.Get("id1").OptionsReader().KeepAlive())
+
+	a.False(cs.Kick("not-exist", "test"))
+	a.True(cs.Kick("id1", "test"))
+	a.Eventually(func() bool {
+		return !cs.Get("id1").IsConnected()
+	}, time.Second, 10*time.Millisecond)
+	// the session is kept, but the offline client can not be kicked.
+	_, total = cs.List(0, 0)
+	a.Equal(3, total)
+	a.False(cs.Kick("id1", "test"))
+	a.False(cs.SetKeepAlive("id1", 10))
+
+	cs.SetQueueLimits("id2", &QueueLimits{MaxMsgQueue: 1})
+	a.Equal(1, srv.queueLimitsOf("id2", &srv.config).MaxMsgQueue)
+	cs.SetQueueLimits("id2", nil)
+	a.Equal(srv.config.MaxMsgQueue, srv.queueLimitsOf("id2", &srv.config).MaxMsgQueue)
+}
+
+func TestClientService_SetKeepAlive(t *testing.T) {
+	a := assert.New(t)
+	srv := newTestServer()
+	defer srv.Stop(context.Background())
+	srv.Run()
+	conn := defaultConnectPacket()
+	conn.KeepAlive = 0
+	c := connectTestClient(srv, conn)
+	a.EqualValues(0, srv.clients["MQTT"].getKeepAlive())
+	a.True(srv.ClientService().SetKeepAlive("MQTT", 30))
+	// the client keeps working with the overridden keep alive.
+	writePacket(c, &packets.Pingreq{})
+	p, err := readPacket(c)
+	a.NoError(err)
+	a.IsType(&packets.Pingresp{}, p)
+	a.EqualValues(30, srv.clients["MQTT"].getKeepAlive())
+}
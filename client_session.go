@@ -0,0 +1,85 @@
+package gmqtt
+
+import (
+	"sync"
+)
+
+// ClientSession is the key/value attributes of the session of the client,
+// which can be used by the hooks and plugins to carry the metadata of the client,
+// e.g: the tenant id resolved by OnConnect can be read by OnMsgArrived for the routing decisions.
+// The attributes are kept across the connections of the session, and persisted with the session
+// if the session persistence is enabled, see WithSessionPersistence.
+// The attributes set before the session is resumed, e.g: by OnConnect, take precedence over the attributes of the resumed session.
+type ClientSession interface {
+	// Get returns the value of the key, and whether the key exists.
+	Get(key string) (value string, ok bool)
+	// Set sets the value of the key.
+	Set(key string, value string)
+	// Delete removes the key.
+	Delete(key string)
+	// All returns a copy of all attributes.
+	All() map[string]string
+}
+
+// clientSession implements ClientSession, it is safe for concurrent use.
+type clientSession struct {
+	mu    sync.RWMutex
+	attrs map[string]string
+}
+
+func newClientSession(attrs map[string]string) *clientSession {
+	s := &clientSession{attrs: make(map[string]string, len(attrs))}
+	for k, v := range attrs {
+		s.attrs[k] = v
+	}
+	return s
+}
+
+func (s *clientSession) Get(key string) (string, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	v, ok := s.attrs[key]
+	return v, ok
+}
+
+func (s *clientSession) Set(key string, value string) {
+	s.mu.Lock()
+	s.attrs[key] = value
+	s.mu.Unlock()
+}
+
+func (s *clientSession) Delete(key string) {
+	s.mu.Lock()
+	delete(s.attrs, key)
+	s.mu.Unlock()
+}
+
+func (s *clientSession) All() map[string]string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if len(s.attrs) == 0 {
+		return nil
+	}
+	rs := make(map[string]string, len(s.attrs))
+	for k, v := range s.attrs {
+		rs[k] = v
+	}
+	return rs
+}
+
+// inherit copies the attributes of the resumed session which are not set in s.
+func (s *clientSession) inherit(resumed *clientSession) {
+	attrs := resumed.All()
+	s.mu.Lock()
+	for k, v := range attrs {
+		if _, ok := s.attrs[k]; !ok {
+			s.attrs[k] = v
+		}
+	}
+	s.mu.Unlock()
+}
+
+// Session returns the attributes of the session of the client.
+func (client *client) Session() ClientSession {
+	return client.attributes
+}
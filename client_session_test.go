@@ -0,0 +1,83 @@
+package gmqtt
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/DrmagicE/gmqtt/pkg/packets"
+)
+
+func TestClientSession(t *testing.T) {
+	a := assert.New(t)
+	s := newClientSession(map[string]string{"a": "1"})
+	v, ok := s.Get("a")
+	a.True(ok)
+	a.Equal("1", v)
+	s.Set("b", "2")
+	s.Delete("a")
+	_, ok = s.Get("a")
+	a.False(ok)
+	all := s.All()
+	a.Equal(map[string]string{"b": "2"}, all)
+	// All returns a copy.
+	all["b"] = "3"
+	v, _ = s.Get("b")
+	a.Equal("2", v)
+
+	s.inherit(newClientSession(map[string]string{"b": "old", "c": "old"}))
+	a.Equal(map[string]string{"b": "2", "c": "old"}, s.All())
+	a.Nil(newClientSession(nil).All())
+}
+
+func TestClientSession_Resume(t *testing.T) {
+	a := assert.New(t)
+	tenant := make(chan string, 1)
+	srv := NewServer(WithHook(Hooks{
+		OnConnect: func(ctx context.Context, client Client) (code uint8) {
+			// the attribute set at auth time takes precedence over the resumed one.
+			client.Session().Set("auth", string(client.OptionsReader().Username()))
+			return packets.CodeAccepted
+		},
+		OnMsgArrived: func(ctx context.Context, client Client, msg packets.Message) (valid bool) {
+			v, _ := client.Session().Get("tenant")
+			tenant <- v
+			return true
+		},
+	}))
+	srv.tcpListener = append(srv.tcpListener, &testListener{acceptReady: make(chan struct{})})
+	defer srv.Stop(context.Background())
+	srv.Run()
+	conn := defaultConnectPacket()
+	conn.CleanSession = false
+	conn.Username = []byte("user1")
+	c := connectTestClient(srv, conn)
+	srv.Client("MQTT").Session().Set("tenant", "t1")
+	srv.Client("MQTT").Session().Set("auth", "old")
+	writePacket(c, &packets.Disconnect{})
+	a.Eventually(func() bool {
+		return !srv.Client("MQTT").IsConnected()
+	}, time.Second, 10*time.Millisecond)
+
+	conn.Username = []byte("user2")
+	c = connectTestClient(srv, conn)
+	a.Equal(map[string]string{"tenant": "t1", "auth": "user2"}, srv.Client("MQTT").Session().All())
+	writePacket(c, &packets.Publish{Qos: packets.QOS_0, TopicName: []byte("a")})
+	select {
+	case v := <-tenant:
+		a.Equal("t1", v)
+	case <-time.After(time.Second):
+		t.Fatal("OnMsgArrived timeout")
+	}
+
+	// a new session does not inherit the attributes.
+	writePacket(c, &packets.Disconnect{})
+	a.Eventually(func() bool {
+		return !srv.Client("MQTT").IsConnected()
+	}, time.Second, 10*time.Millisecond)
+	conn.CleanSession = true
+	connectTestClient(srv, conn)
+	a.Equal(map[string]string{"auth": "user2"}, srv.Client("MQTT").Session().All())
+}
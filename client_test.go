@@ -5,9 +5,11 @@ import (
 	"container/list"
 	"context"
 	"errors"
+	"fmt"
 	"io"
 	"net"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
@@ -15,6 +17,7 @@ import (
 	"go.uber.org/zap"
 
 	"github.com/DrmagicE/gmqtt/pkg/packets"
+	subscription_trie "github.com/DrmagicE/gmqtt/subscription/trie"
 )
 
 const testRedeliveryInternal = 10 * time.Second
@@ -738,6 +741,30 @@ func TestServer_PublishToClientWithoutMatch(t *testing.T) {
 	}
 }
 
+func TestServer_PublishToOverlappingSubscriptions(t *testing.T) {
+	a := assert.New(t)
+	srv, conn := connectedServer(nil)
+	defer srv.Stop(context.Background())
+	c := conn.(*rwTestConn)
+	srv.subscriptionsDB.Subscribe("MQTT",
+		packets.Topic{Qos: packets.QOS_1, Name: "a/#"},
+		packets.Topic{Qos: packets.QOS_2, Name: "a/b/#"},
+	)
+	srv.publishService.Publish(NewMessage("a/b/c", []byte("payload"), packets.QOS_2))
+
+	packet, err := readPacket(c)
+	a.Nil(err)
+	if p, ok := packet.(*packets.Publish); ok {
+		a.Equal("a/b/c", string(p.TopicName))
+		// deliver once with the maximum qos of the matched subscriptions
+		a.Equal(packets.QOS_2, p.Qos)
+	} else {
+		t.Fatalf("unexpected Packet Type, want %v, got %v", reflect.TypeOf(&packets.Publish{}), reflect.TypeOf(packet))
+	}
+	_, err = readPacketWithTimeOut(c, 100*time.Millisecond)
+	a.Equal(errTestReadTimeout, err, "the message should be delivered only once")
+}
+
 func TestUnsubscribe(t *testing.T) {
 	srv, conn := connectedServer(nil)
 	defer srv.Stop(context.Background())
@@ -845,6 +872,29 @@ func TestOnSubscribe(t *testing.T) {
 
 }
 
+func TestSubscribeRejectedByStore(t *testing.T) {
+	a := assert.New(t)
+	srv := newTestServer()
+	srv.subscriptionsDB = subscription_trie.NewStore(subscription_trie.WithMaxTopicLevels(2))
+	conn := doconnect(srv, nil)
+	defer srv.Stop(context.Background())
+	c := conn.(*rwTestConn)
+
+	a.Nil(writePacket(c, &packets.Subscribe{
+		PacketID: 10,
+		Topics: []packets.Topic{
+			{Name: "a/b", Qos: packets.QOS_1},
+			{Name: "a/b/c", Qos: packets.QOS_1},
+		},
+	}))
+	packet, err := readPacket(c)
+	a.Nil(err)
+	if a.IsType(&packets.Suback{}, packet) {
+		a.Equal([]byte{packets.QOS_1, packets.SUBSCRIBE_FAILURE}, packet.(*packets.Suback).Payload)
+	}
+	a.Len(srv.subscriptionsDB.GetClientSubscriptions("MQTT"), 1)
+}
+
 func TestRetainMsg(t *testing.T) {
 	a := assert.New(t)
 	srv, conn := connectedServer(nil)
@@ -946,6 +996,97 @@ func TestRetainMsg(t *testing.T) {
 
 }
 
+func TestPublishWildcardTopicName(t *testing.T) {
+	a := assert.New(t)
+	for _, topicName := range []string{"a/+/c", "a/#"} {
+		srv, conn := connectedServer(nil)
+		c := conn.(*rwTestConn)
+		pub := &packets.Publish{
+			Qos:       packets.QOS_1,
+			Retain:    true,
+			TopicName: []byte(topicName),
+			PacketID:  10,
+			Payload:   []byte("Payload"),
+		}
+		a.Nil(writePacket(c, pub))
+		// the server must close the network connection without puback
+		_, err := readPacket(c)
+		a.Equal(io.EOF, err, topicName)
+		a.Nil(srv.retainedDB.GetRetainedMessage(topicName), topicName)
+		srv.Stop(context.Background())
+	}
+
+	srv, conn := connectedServer(nil)
+	defer srv.Stop(context.Background())
+	c := conn.(*rwTestConn)
+	pub := &packets.Publish{
+		Qos:       packets.QOS_1,
+		Retain:    true,
+		TopicName: []byte("a/b/c"),
+		PacketID:  10,
+		Payload:   []byte("Payload"),
+	}
+	a.Nil(writePacket(c, pub))
+	p, err := readPacket(c)
+	a.Nil(err)
+	a.IsType(&packets.Puback{}, p)
+	a.NotNil(srv.retainedDB.GetRetainedMessage("a/b/c"))
+}
+
+func TestRetainedQuota(t *testing.T) {
+	for _, policy := range []RetainedOverQuotaPolicy{RetainedDiscard, RetainedDropMessage} {
+		testRetainedQuota(t, policy)
+	}
+}
+
+func testRetainedQuota(t *testing.T, policy RetainedOverQuotaPolicy) {
+	a := assert.New(t)
+	srv, conn := connectedServer(nil)
+	defer srv.Stop(context.Background())
+	srv.config.MaxRetainedMessages = 1
+	srv.config.MaxRetainedPayloadSize = 3
+	srv.config.RetainedOverQuota = policy
+	c := conn.(*rwTestConn)
+	srv.subscriptionsDB.Subscribe("MQTT", packets.Topic{Name: "#", Qos: packets.QOS_0})
+
+	publish := func(topicName string, payload []byte, retained bool) {
+		pub := &packets.Publish{
+			Qos:       packets.QOS_1,
+			Retain:    true,
+			TopicName: []byte(topicName),
+			PacketID:  10,
+			Payload:   payload,
+		}
+		a.Nil(writePacket(c, pub))
+		p, err := readPacket(c)
+		a.Nil(err)
+		a.IsType(&packets.Puback{}, p)
+		delivered := policy == RetainedDiscard || retained
+		p, err = readPacketWithTimeOut(c, 100*time.Millisecond)
+		if delivered {
+			a.Nil(err, topicName)
+			a.IsType(&packets.Publish{}, p)
+		} else {
+			a.Equal(errTestReadTimeout, err, topicName)
+		}
+		if retained {
+			a.NotNil(srv.retainedDB.GetRetainedMessage(topicName), topicName)
+		}
+	}
+	// payload too large
+	publish("a", []byte("abcd"), false)
+	a.Nil(srv.retainedDB.GetRetainedMessage("a"))
+	publish("a", []byte("abc"), true)
+	// too many retained messages
+	publish("b", []byte("abc"), false)
+	a.Nil(srv.retainedDB.GetRetainedMessage("b"))
+	// replacing is allowed
+	publish("a", []byte("d"), true)
+	a.Equal([]byte("d"), srv.retainedDB.GetRetainedMessage("a").Payload())
+
+	a.EqualValues(2, srv.statsManager.GetStats().RetainedStats.DroppedTotal)
+}
+
 func TestPingPong(t *testing.T) {
 	srv, conn := connectedServer(nil)
 	defer srv.Stop(context.Background())
@@ -1221,6 +1362,184 @@ func TestRedeliveryOnReconnect(t *testing.T) {
 
 }
 
+func TestQos2ResumptionOnReconnect(t *testing.T) {
+	a := assert.New(t)
+	senderConnect := defaultConnectPacket()
+	senderConnect.ClientID = []byte("sender")
+	senderConnect.CleanSession = false
+	receiverConnect := defaultConnectPacket()
+	receiverConnect.ClientID = []byte("receiver")
+	receiverConnect.CleanSession = false
+	srv, s, r := connectedServerWith2Client(senderConnect, receiverConnect)
+	defer srv.Stop(context.Background())
+	sender := s.(*rwTestConn)
+	receiver := r.(*rwTestConn)
+
+	a.Nil(writePacket(receiver, &packets.Subscribe{
+		PacketID: 1,
+		Topics:   []packets.Topic{{Name: "a", Qos: packets.QOS_2}},
+	}))
+	readPacket(receiver) //suback
+
+	pub := &packets.Publish{
+		Qos:       packets.QOS_2,
+		TopicName: []byte("a"),
+		PacketID:  10,
+		Payload:   []byte("payload"),
+	}
+	a.Nil(writePacket(sender, pub))
+	p, err := readPacket(sender)
+	a.Nil(err)
+	a.IsType(&packets.Pubrec{}, p)
+
+	p, err = readPacket(receiver)
+	a.Nil(err)
+	a.IsType(&packets.Publish{}, p)
+	delivered := p.(*packets.Publish)
+	a.Nil(writePacket(receiver, delivered.NewPubrec()))
+	p, err = readPacket(receiver)
+	a.Nil(err)
+	a.IsType(&packets.Pubrel{}, p)
+
+	// both connections are lost in the middle of the qos2 handshakes.
+	sender.Close()
+	receiver.Close()
+	reconnect := func(connect *packets.Connect) *rwTestConn {
+		conn := &rwTestConn{
+			closec:    make(chan struct{}),
+			readChan:  make(chan []byte, 1024),
+			writeChan: make(chan []byte, 1024),
+		}
+		srv.tcpListener[0].(*testListener).conn.PushBack(conn)
+		srv.tcpListener[0].(*testListener).acceptReady <- struct{}{}
+		a.Nil(writePacket(conn, connect))
+		p, err := readPacket(conn)
+		a.Nil(err)
+		if a.IsType(&packets.Connack{}, p) {
+			a.Equal(1, p.(*packets.Connack).SessionPresent)
+		}
+		return conn
+	}
+
+	// inbound: the retried publish is acknowledged again but not delivered again.
+	sender = reconnect(senderConnect)
+	pub.Dup = true
+	a.Nil(writePacket(sender, pub))
+	p, err = readPacket(sender)
+	a.Nil(err)
+	if a.IsType(&packets.Pubrec{}, p) {
+		a.Equal(pub.PacketID, p.(*packets.Pubrec).PacketID)
+	}
+	a.Nil(writePacket(sender, p.(*packets.Pubrec).NewPubrel()))
+	p, err = readPacket(sender)
+	a.Nil(err)
+	if a.IsType(&packets.Pubcomp{}, p) {
+		a.Equal(pub.PacketID, p.(*packets.Pubcomp).PacketID)
+	}
+
+	// outbound: the pubrel is resent with the original packet id.
+	receiver = reconnect(receiverConnect)
+	p, err = readPacket(receiver)
+	a.Nil(err)
+	if a.IsType(&packets.Pubrel{}, p) {
+		a.Equal(delivered.PacketID, p.(*packets.Pubrel).PacketID)
+	}
+	a.Nil(writePacket(receiver, p.(*packets.Pubrel).NewPubcomp()))
+	_, err = readPacketWithTimeOut(receiver, 200*time.Millisecond)
+	a.Equal(errTestReadTimeout, err, "the message should not be delivered again")
+
+	srv.mu.RLock()
+	rc := srv.clients["receiver"]
+	srv.mu.RUnlock()
+	a.Eventually(func() bool {
+		rc.session.awaitRelMu.Lock()
+		defer rc.session.awaitRelMu.Unlock()
+		return rc.session.awaitRel.Len() == 0
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestDeliveryOrder(t *testing.T) {
+	for _, order := range []DeliveryOrder{CatchUpFirst, Interleave} {
+		testDeliveryOrder(t, order)
+	}
+}
+
+func testDeliveryOrder(t *testing.T, order DeliveryOrder) {
+	a := assert.New(t)
+	c := DefaultConfig
+	c.DeliveryOrder = order
+	srv = NewServer(WithConfig(c), WithLogger(zap.NewNop()))
+	defer func() {
+		srv = nil
+	}()
+	receiverConnect := defaultConnectPacket()
+	receiverConnect.ClientID = []byte("receiver")
+	receiverConnect.CleanSession = false
+	s, sender, r := connectedServerWith2Client(nil, receiverConnect)
+	defer s.Stop(context.Background())
+	receiver := r.(*rwTestConn)
+	a.Nil(writePacket(receiver, &packets.Subscribe{
+		PacketID: 1,
+		Topics:   []packets.Topic{{Name: "a", Qos: packets.QOS_1}},
+	}))
+	readPacket(receiver) //suback
+	receiver.Close()
+	a.Eventually(func() bool {
+		s.mu.RLock()
+		defer s.mu.RUnlock()
+		_, ok := s.offlineClients["receiver"]
+		return ok
+	}, time.Second, 10*time.Millisecond)
+
+	publish := func(payload string) {
+		a.Nil(writePacket(sender.(*rwTestConn), &packets.Publish{
+			Qos:       packets.QOS_1,
+			TopicName: []byte("a"),
+			PacketID:  1,
+			Payload:   []byte(payload),
+		}))
+		readPacket(sender.(*rwTestConn)) //puback
+	}
+	for i := 0; i < 5; i++ {
+		publish(fmt.Sprintf("queued%d", i))
+	}
+	a.Eventually(func() bool {
+		return s.statsManager.GetStats().MessageStats.QueuedCurrent == 5
+	}, time.Second, 10*time.Millisecond)
+
+	receiver = &rwTestConn{
+		closec:    make(chan struct{}),
+		readChan:  make(chan []byte, 1024),
+		writeChan: make(chan []byte, 1024),
+	}
+	s.tcpListener[0].(*testListener).conn.PushBack(receiver)
+	s.tcpListener[0].(*testListener).acceptReady <- struct{}{}
+	a.Nil(writePacket(receiver, receiverConnect))
+	readPacket(receiver) //connack
+	publish("live")
+
+	var got []string
+	for i := 0; i < 6; i++ {
+		p, err := readPacketWithTimeOut(receiver, time.Second)
+		a.Nil(err)
+		if a.IsType(&packets.Publish{}, p) {
+			got = append(got, string(p.(*packets.Publish).Payload))
+		}
+	}
+	if order == CatchUpFirst {
+		a.Equal([]string{"queued0", "queued1", "queued2", "queued3", "queued4", "live"}, got)
+	} else {
+		a.ElementsMatch([]string{"queued0", "queued1", "queued2", "queued3", "queued4", "live"}, got)
+		var queued []string
+		for _, v := range got {
+			if v != "live" {
+				queued = append(queued, v)
+			}
+		}
+		a.Equal([]string{"queued0", "queued1", "queued2", "queued3", "queued4"}, queued)
+	}
+}
+
 func TestOfflineMessageQueueing(t *testing.T) {
 	a := assert.New(t)
 	c := DefaultConfig
@@ -1322,6 +1641,73 @@ func TestOfflineMessageQueueing(t *testing.T) {
 	a.EqualValues(0, stats.QueuedCurrent)
 }
 
+func TestClient_GetClientStats(t *testing.T) {
+	a := assert.New(t)
+	srv := newTestServer()
+	defer srv.Stop(context.Background())
+	srv.Run()
+	c := connectTestClient(srv, defaultConnectPacket())
+	cl := srv.Client("MQTT")
+	stats := cl.GetClientStats()
+	a.EqualValues(1, stats.PacketStats.ReceivedTotal.Connect)
+	a.EqualValues(1, stats.PacketStats.SentTotal.Connack)
+	a.False(stats.LastSeen.IsZero())
+
+	pub := &packets.Publish{Qos: packets.QOS_1, TopicName: []byte("a"), PacketID: 1, Payload: []byte("abc")}
+	a.NoError(writePacket(c, pub))
+	_, err := readPacket(c) // puback
+	a.NoError(err)
+	a.Eventually(func() bool {
+		return cl.GetClientStats().PacketStats.SentTotal.Puback == 1
+	}, time.Second, 10*time.Millisecond)
+	stats = cl.GetClientStats()
+	a.EqualValues(1, stats.PacketStats.ReceivedTotal.Publish)
+	a.EqualValues(packets.TotalBytes(pub), stats.PacketStats.BytesReceived.Publish)
+	a.Equal(stats.PacketStats.BytesReceived.Connect+stats.PacketStats.BytesReceived.Publish, stats.BytesReceived)
+	a.Equal(stats.PacketStats.BytesSent.Connack+stats.PacketStats.BytesSent.Puback, stats.BytesSent)
+	a.NotNil(stats.SessionStats)
+}
+
+func TestClient_WriteFlushInterval(t *testing.T) {
+	a := assert.New(t)
+	config := DefaultConfig
+	config.WriteFlushInterval = 100 * time.Millisecond
+	srv := NewServer(WithConfig(config))
+	srv.tcpListener = append(srv.tcpListener, &testListener{acceptReady: make(chan struct{})})
+	defer srv.Stop(context.Background())
+	srv.Run()
+	conn := defaultConnectPacket()
+	conn.WillFlag = false
+	conn.WillQos = packets.QOS_0
+	conn.WillTopic = nil
+	conn.WillMsg = nil
+	c := connectTestClient(srv, conn)
+	srv.subscriptionsDB.Subscribe("MQTT", packets.Topic{Name: "a", Qos: packets.QOS_0})
+	for i := 0; i < 3; i++ {
+		srv.PublishService().Publish(NewMessage("a", []byte{byte(i)}, packets.QOS_0))
+	}
+	// the publishes are coalesced into one write after the flush interval.
+	select {
+	case b := <-c.writeChan:
+		r := packets.NewReader(bytes.NewBuffer(b))
+		for i := 0; i < 3; i++ {
+			p, err := r.ReadPacket()
+			if !a.NoError(err) {
+				return
+			}
+			a.Equal([]byte{byte(i)}, p.(*packets.Publish).Payload)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("flush timeout")
+	}
+
+	// the non-PUBLISH packets are flushed at once.
+	a.NoError(writePacket(c, &packets.Pingreq{}))
+	p, err := readPacketWithTimeOut(c, 50*time.Millisecond)
+	a.NoError(err)
+	a.IsType(&packets.Pingresp{}, p)
+}
+
 func TestWillMsg(t *testing.T) {
 	srv, s, r := connectedServerWith2Client()
 	defer srv.Stop(context.Background())
@@ -1397,3 +1783,92 @@ func TestEmptyClientID(t *testing.T) {
 		}
 	}
 }
+
+func TestClient_TopicRewrite(t *testing.T) {
+	a := assert.New(t)
+	srv := NewServer()
+	srv.msgRouter = make(chan *msgRouter, 1)
+	var subscribed, arrived []string
+	srv.hooks.OnTopicRewrite = func(ctx context.Context, client Client, action TopicRewriteAction, topic string) string {
+		if action == RewritePublish {
+			return "new/" + topic
+		}
+		if topic == "invalid" {
+			return "a/#/b"
+		}
+		return "new/" + topic
+	}
+	srv.hooks.OnSubscribe = func(ctx context.Context, client Client, topic packets.Topic) (qos uint8) {
+		subscribed = append(subscribed, topic.Name)
+		return topic.Qos
+	}
+	srv.hooks.OnMsgArrived = func(ctx context.Context, client Client, msg packets.Message) (valid bool) {
+		arrived = append(arrived, msg.Topic())
+		return true
+	}
+	c := srv.newClient(&rwTestConn{})
+	c.opts.clientID = "id"
+	c.subscribeHandler(&packets.Subscribe{
+		PacketID: 1,
+		Topics: []packets.Topic{
+			{Name: "a/+", Qos: packets.QOS_1},
+			{Name: "invalid", Qos: packets.QOS_1},
+		},
+	})
+	a.Equal([]string{"new/a/+"}, subscribed)
+	suback := (<-c.out).(*packets.Suback)
+	a.Equal([]byte{packets.QOS_1, packets.SUBSCRIBE_FAILURE}, suback.Payload)
+	a.Equal([]packets.Topic{{Name: "new/a/+", Qos: packets.QOS_1}}, srv.subscriptionsDB.GetClientSubscriptions("id"))
+
+	c.publishHandler(&packets.Publish{Qos: packets.QOS_0, TopicName: []byte("a/b")})
+	a.Equal([]string{"new/a/b"}, arrived)
+	a.Equal("new/a/b", (<-srv.msgRouter).msg.Topic())
+
+	c.unsubscribeHandler(&packets.Unsubscribe{PacketID: 2, Topics: []string{"a/+"}})
+	a.Empty(srv.subscriptionsDB.GetClientSubscriptions("id"))
+}
+
+func TestClient_DeliverRewrite(t *testing.T) {
+	a := assert.New(t)
+	srv := newTestServer()
+	srv.hooks.OnTopicRewrite = func(ctx context.Context, client Client, action TopicRewriteAction, topic string) string {
+		return "tenant/" + topic
+	}
+	srv.hooks.OnDeliverRewrite = func(ctx context.Context, client Client, topicName string) string {
+		if topicName == "tenant/a/invalid" {
+			return "a/#"
+		}
+		return strings.TrimPrefix(topicName, "tenant/")
+	}
+	srv.Run()
+	defer srv.Stop(context.Background())
+	conn := defaultConnectPacket()
+	conn.WillFlag = false
+	conn.WillQos = packets.QOS_0
+	conn.WillTopic = nil
+	c := connectTestClient(srv, conn)
+	writePacket(c, &packets.Subscribe{PacketID: 1, Topics: []packets.Topic{{Name: "a/+", Qos: packets.QOS_1}}})
+	_, err := readPacket(c)
+	a.NoError(err)
+	a.Equal([]packets.Topic{{Name: "tenant/a/+", Qos: packets.QOS_1}}, srv.subscriptionsDB.GetClientSubscriptions("MQTT"))
+
+	writePacket(c, &packets.Publish{Qos: packets.QOS_1, PacketID: 2, Retain: true, TopicName: []byte("a/b"), Payload: []byte("b")})
+	writePacket(c, &packets.Publish{Qos: packets.QOS_0, TopicName: []byte("a/invalid")})
+	topics := make(map[string]bool)
+	for len(topics) < 2 {
+		p, err := readPacketWithTimeOut(c, time.Second)
+		if !a.NoError(err) {
+			return
+		}
+		if pub, ok := p.(*packets.Publish); ok {
+			topics[string(pub.TopicName)] = true
+			if pub.Qos == packets.QOS_1 {
+				writePacket(c, pub.NewPuback())
+			}
+		}
+	}
+	// the invalid rewritten topic is not sent, the message is sent with the original topic instead.
+	a.Equal(map[string]bool{"a/b": true, "tenant/a/invalid": true}, topics)
+	a.NotNil(srv.retainedDB.GetRetainedMessage("tenant/a/b"))
+	a.Nil(srv.retainedDB.GetRetainedMessage("a/b"))
+}
@@ -12,6 +12,7 @@ import (
 	"go.uber.org/zap"
 
 	"github.com/DrmagicE/gmqtt"
+	"github.com/DrmagicE/gmqtt/plugin/admin"
 	"github.com/DrmagicE/gmqtt/plugin/management"
 	"github.com/DrmagicE/gmqtt/plugin/prometheus"
 )
@@ -31,8 +32,10 @@ func main() {
 		panic(err)
 	}
 
-	l, _ := zap.NewProduction()
-	//l, _ := zap.NewDevelopment()
+	level := zap.NewAtomicLevel()
+	cfg := zap.NewProductionConfig()
+	cfg.Level = level
+	l, _ := cfg.Build()
 	s := gmqtt.NewServer(
 		gmqtt.WithTCPListener(ln),
 		gmqtt.WithWebsocketServer(ws),
@@ -40,12 +43,23 @@ func main() {
 		gmqtt.WithPlugin(prometheus.New(&http.Server{
 			Addr: ":8082",
 		}, "/metrics")),
+		gmqtt.WithPlugin(admin.New(":8083")),
 		gmqtt.WithLogger(l),
+		gmqtt.WithLogLevel(level),
 	)
 	s.Run()
 	signalCh := make(chan os.Signal, 1)
-	signal.Notify(signalCh, os.Interrupt, syscall.SIGTERM)
-	<-signalCh
+	signal.Notify(signalCh, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	for sig := range signalCh {
+		if sig == syscall.SIGHUP {
+			// reload the plugins, e.g: acl rules and passwords.
+			if err := s.ReloadConfig(s.GetConfig()); err != nil {
+				l.Error("reload error", zap.Error(err))
+			}
+			continue
+		}
+		break
+	}
 	s.Stop(context.Background())
 
 }
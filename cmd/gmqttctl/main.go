@@ -0,0 +1,373 @@
+// Command gmqttctl is the command-line tool which talks to the gRPC admin api served by the admin plugin.
+//
+// Usage:
+//
+//	gmqttctl [-addr host:port] [-timeout duration] <command> [arguments]
+//
+// The commands are:
+//
+//	clients [-page n] [-page-size n]       list the clients
+//	subscriptions <client_id>              show the subscriptions of the client
+//	kick <client_id>                       close the connection of the client
+//	publish [-qos n] [-retain] [-client id] <topic> <payload>
+//	                                       publish a message
+//	stats [client_id]                      show the subscription stats
+//	bans [-page n] [-page-size n]          list the bans
+//	ban [-kind k] [-duration d] <value>    ban the client id, ip, cidr or client_id_pattern
+//	unban [-kind k] <value>                remove the ban
+//	log-level [-module m] [-clear] [level] change the log level of the server or the module
+//	log-levels                             list the overridden log levels of the modules
+//	trace [-topic] <client_id|topic_filter>
+//	                                       trace the messages of the client or the topic filter until interrupted
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"google.golang.org/grpc"
+
+	"github.com/DrmagicE/gmqtt/plugin/admin"
+)
+
+var (
+	addr    = flag.String("addr", "127.0.0.1:8083", "the address of the admin api")
+	timeout = flag.Duration("timeout", 5*time.Second, "the timeout of each request")
+)
+
+func usage() {
+	fmt.Fprintf(flag.CommandLine.Output(), `Usage: gmqttctl [flags] <command> [arguments]
+
+Commands:
+  clients [-page n] [-page-size n]       list the clients
+  subscriptions <client_id>              show the subscriptions of the client
+  kick <client_id>                       close the connection of the client
+  publish [-qos n] [-retain] [-client id] <topic> <payload>
+                                         publish a message
+  stats [client_id]                      show the subscription stats
+  bans [-page n] [-page-size n]          list the bans
+  ban [-kind k] [-duration d] <value>    ban the client id, ip, cidr or client_id_pattern
+  unban [-kind k] <value>                remove the ban
+  log-level [-module m] [-clear] [level] change the log level of the server or the module
+  log-levels                             list the overridden log levels of the modules
+  trace [-topic] <client_id|topic_filter>
+                                         trace the messages of the client or the topic filter until interrupted
+
+Flags:
+`)
+	flag.PrintDefaults()
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+	conn, err := grpc.Dial(*addr, grpc.WithInsecure())
+	if err != nil {
+		fatal(err)
+	}
+	defer conn.Close()
+	c := admin.NewAdminClient(conn)
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	args := flag.Args()[1:]
+	switch cmd := flag.Arg(0); cmd {
+	case "clients":
+		err = listClients(ctx, c, args)
+	case "subscriptions":
+		err = listSubscriptions(ctx, c, args)
+	case "kick":
+		err = kick(ctx, c, args)
+	case "publish":
+		err = publish(ctx, c, args)
+	case "stats":
+		err = stats(ctx, c, args)
+	case "bans":
+		err = listBans(ctx, c, args)
+	case "ban":
+		err = ban(ctx, c, args)
+	case "unban":
+		err = unban(ctx, c, args)
+	case "log-level":
+		err = setLogLevel(ctx, c, args)
+	case "log-levels":
+		err = listLogLevels(ctx, c, args)
+	case "trace":
+		// the trace streams until interrupted, so the timeout is not applied.
+		err = trace(context.Background(), c, args)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n", cmd)
+		usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		fatal(err)
+	}
+}
+
+func fatal(err error) {
+	fmt.Fprintln(os.Stderr, "error:", err)
+	os.Exit(1)
+}
+
+// requireArgs returns an error unless the number of the arguments is n.
+func requireArgs(args []string, n int, usage string) error {
+	if len(args) != n {
+		return fmt.Errorf("usage: gmqttctl %s", usage)
+	}
+	return nil
+}
+
+func listClients(ctx context.Context, c admin.AdminClient, args []string) error {
+	fs := flag.NewFlagSet("clients", flag.ExitOnError)
+	page := fs.Uint("page", 1, "the page number")
+	pageSize := fs.Uint("page-size", 20, "the page size")
+	fs.Parse(args)
+	rs, err := c.ListClients(ctx, &admin.ListClientsRequest{
+		Pager: &admin.Pager{Page: uint32(*page), PageSize: uint32(*pageSize)},
+	})
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "CLIENT ID\tSTATUS\tREMOTE ADDR\tSUBSCRIPTIONS\tINFLIGHT\tQUEUED\tCONNECTED AT")
+	for _, v := range rs.Clients {
+		st := "offline"
+		if v.Connected {
+			st = "online"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%d\t%d\t%s\n", v.ClientId, st, v.RemoteAddr, v.Subscriptions,
+			v.InflightLen, v.MsgQueueLen, time.Unix(v.ConnectedAt, 0).Format(time.RFC3339))
+	}
+	w.Flush()
+	fmt.Printf("total: %d\n", rs.Total)
+	return nil
+}
+
+func listSubscriptions(ctx context.Context, c admin.AdminClient, args []string) error {
+	if err := requireArgs(args, 1, "subscriptions <client_id>"); err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "TOPIC FILTER\tQOS")
+	var total uint32
+	// walk through all pages
+	for page := uint32(1); ; page++ {
+		rs, err := c.ListSubscriptions(ctx, &admin.ListSubscriptionsRequest{
+			ClientId: args[0],
+			Pager:    &admin.Pager{Page: page, PageSize: 100},
+		})
+		if err != nil {
+			return err
+		}
+		for _, v := range rs.Subscriptions {
+			fmt.Fprintf(w, "%s\t%d\n", v.TopicFilter, v.Qos)
+		}
+		total = rs.Total
+		if len(rs.Subscriptions) == 0 || page*100 >= rs.Total {
+			break
+		}
+	}
+	w.Flush()
+	fmt.Printf("total: %d\n", total)
+	return nil
+}
+
+func kick(ctx context.Context, c admin.AdminClient, args []string) error {
+	if err := requireArgs(args, 1, "kick <client_id>"); err != nil {
+		return err
+	}
+	_, err := c.CloseClient(ctx, &admin.CloseClientRequest{ClientId: args[0]})
+	return err
+}
+
+func publish(ctx context.Context, c admin.AdminClient, args []string) error {
+	fs := flag.NewFlagSet("publish", flag.ExitOnError)
+	qos := fs.Uint("qos", 0, "the qos of the message")
+	retain := fs.Bool("retain", false, "whether the message is retained")
+	clientID := fs.String("client", "", "publish the message to the client only")
+	fs.Parse(args)
+	if err := requireArgs(fs.Args(), 2, "publish [-qos n] [-retain] [-client id] <topic> <payload>"); err != nil {
+		return err
+	}
+	_, err := c.Publish(ctx, &admin.PublishRequest{
+		TopicName: fs.Arg(0),
+		Payload:   []byte(fs.Arg(1)),
+		Qos:       uint32(*qos),
+		Retained:  *retain,
+		ClientId:  *clientID,
+	})
+	return err
+}
+
+func stats(ctx context.Context, c admin.AdminClient, args []string) error {
+	req := &admin.GetSubscriptionStatsRequest{}
+	if len(args) > 1 {
+		return requireArgs(args, 1, "stats [client_id]")
+	}
+	if len(args) == 1 {
+		req.ClientId = args[0]
+	}
+	rs, err := c.GetSubscriptionStats(ctx, req)
+	if err != nil {
+		return err
+	}
+	fmt.Println("subscriptions_total: " + strconv.FormatUint(rs.SubscriptionsTotal, 10))
+	fmt.Println("subscriptions_current: " + strconv.FormatUint(rs.SubscriptionsCurrent, 10))
+	return nil
+}
+
+// parseBanKind parses the kind flag, which is one of client_id, ip, cidr and client_id_pattern.
+func parseBanKind(kind string) (admin.Ban_Kind, error) {
+	v, ok := admin.Ban_Kind_value[strings.ToUpper(kind)]
+	if !ok {
+		return 0, fmt.Errorf("invalid kind %q", kind)
+	}
+	return admin.Ban_Kind(v), nil
+}
+
+func listBans(ctx context.Context, c admin.AdminClient, args []string) error {
+	fs := flag.NewFlagSet("bans", flag.ExitOnError)
+	page := fs.Uint("page", 1, "the page number")
+	pageSize := fs.Uint("page-size", 20, "the page size")
+	fs.Parse(args)
+	rs, err := c.ListBans(ctx, &admin.ListBansRequest{
+		Pager: &admin.Pager{Page: uint32(*page), PageSize: uint32(*pageSize)},
+	})
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "KIND\tVALUE\tFLAPPING\tAT\tUNTIL")
+	for _, v := range rs.Bans {
+		until := "never"
+		if v.Until != 0 {
+			until = time.Unix(v.Until, 0).Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%t\t%s\t%s\n", strings.ToLower(v.Kind.String()), v.Value, v.Flapping,
+			time.Unix(v.At, 0).Format(time.RFC3339), until)
+	}
+	w.Flush()
+	fmt.Printf("total: %d\n", rs.Total)
+	return nil
+}
+
+func ban(ctx context.Context, c admin.AdminClient, args []string) error {
+	fs := flag.NewFlagSet("ban", flag.ExitOnError)
+	kind := fs.String("kind", "client_id", "the kind of the value: client_id, ip, cidr or client_id_pattern")
+	duration := fs.Duration("duration", 0, "the duration of the ban, 0 means the ban never expires")
+	fs.Parse(args)
+	if err := requireArgs(fs.Args(), 1, "ban [-kind k] [-duration d] <value>"); err != nil {
+		return err
+	}
+	k, err := parseBanKind(*kind)
+	if err != nil {
+		return err
+	}
+	_, err = c.Ban(ctx, &admin.BanRequest{
+		Kind:     k,
+		Value:    fs.Arg(0),
+		Duration: uint32(duration.Seconds()),
+	})
+	return err
+}
+
+func unban(ctx context.Context, c admin.AdminClient, args []string) error {
+	fs := flag.NewFlagSet("unban", flag.ExitOnError)
+	kind := fs.String("kind", "client_id", "the kind of the value: client_id, ip, cidr or client_id_pattern")
+	fs.Parse(args)
+	if err := requireArgs(fs.Args(), 1, "unban [-kind k] <value>"); err != nil {
+		return err
+	}
+	k, err := parseBanKind(*kind)
+	if err != nil {
+		return err
+	}
+	_, err = c.Unban(ctx, &admin.UnbanRequest{Kind: k, Value: fs.Arg(0)})
+	return err
+}
+
+func setLogLevel(ctx context.Context, c admin.AdminClient, args []string) error {
+	fs := flag.NewFlagSet("log-level", flag.ExitOnError)
+	module := fs.String("module", "", "the log module, e.g: subscription or plugin/acl, default to the server")
+	clearLevel := fs.Bool("clear", false, "remove the level override of the module")
+	fs.Parse(args)
+	req := &admin.SetLogLevelRequest{Module: *module, Clear: *clearLevel}
+	if !*clearLevel {
+		if err := requireArgs(fs.Args(), 1, "log-level [-module m] [-clear] [level]"); err != nil {
+			return err
+		}
+		req.Level = fs.Arg(0)
+	}
+	_, err := c.SetLogLevel(ctx, req)
+	return err
+}
+
+func listLogLevels(ctx context.Context, c admin.AdminClient, args []string) error {
+	if err := requireArgs(args, 0, "log-levels"); err != nil {
+		return err
+	}
+	rs, err := c.ListLogLevels(ctx, &admin.ListLogLevelsRequest{})
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "MODULE\tLEVEL")
+	for _, v := range rs.Levels {
+		fmt.Fprintf(w, "%s\t%s\n", v.Module, v.Level)
+	}
+	w.Flush()
+	return nil
+}
+
+func trace(ctx context.Context, c admin.AdminClient, args []string) error {
+	fs := flag.NewFlagSet("trace", flag.ExitOnError)
+	topic := fs.Bool("topic", false, "trace the topic filter instead of the client id")
+	fs.Parse(args)
+	if err := requireArgs(fs.Args(), 1, "trace [-topic] <client_id|topic_filter>"); err != nil {
+		return err
+	}
+	req := &admin.TraceRequest{Kind: admin.TraceRequest_CLIENT_ID, Value: fs.Arg(0)}
+	if *topic {
+		req.Kind = admin.TraceRequest_TOPIC
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	signalCh := make(chan os.Signal, 1)
+	signal.Notify(signalCh, os.Interrupt)
+	go func() {
+		<-signalCh
+		cancel()
+	}()
+	stream, err := c.Trace(ctx, req)
+	if err != nil {
+		return err
+	}
+	for {
+		e, err := stream.Recv()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		fmt.Printf("%s %-9s client_id=%s topic=%s qos=%d retained=%t packet_id=%d payload=%q",
+			time.Unix(0, e.Time).Format(time.RFC3339Nano), strings.ToLower(e.Hop.String()),
+			e.ClientId, e.TopicName, e.Qos, e.Retained, e.PacketId, e.Payload)
+		if e.Reason != "" {
+			fmt.Printf(" reason=%q", e.Reason)
+		}
+		fmt.Println()
+	}
+}
@@ -0,0 +1,322 @@
+// Command gmqttd runs the broker from the YAML configuration file, see pkg/config and gmqttd.yml.
+//
+// Usage:
+//
+//	gmqttd [-config path] [-config-check]
+//
+// The -config-check flag validates the configuration file, loads the TLS certificates and exits.
+// The broker reloads the plugins on SIGHUP, and stops gracefully on SIGINT or SIGTERM.
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/gin-gonic/gin"
+	redigo "github.com/gomodule/redigo/redis"
+	"go.etcd.io/bbolt"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
+	"github.com/DrmagicE/gmqtt"
+	"github.com/DrmagicE/gmqtt/persistence/bolt"
+	persistence_redis "github.com/DrmagicE/gmqtt/persistence/redis"
+	"github.com/DrmagicE/gmqtt/pkg/config"
+	"github.com/DrmagicE/gmqtt/pkg/proxyproto"
+	"github.com/DrmagicE/gmqtt/plugin/acl"
+	"github.com/DrmagicE/gmqtt/plugin/admin"
+	"github.com/DrmagicE/gmqtt/plugin/exhook"
+	"github.com/DrmagicE/gmqtt/plugin/management"
+	"github.com/DrmagicE/gmqtt/plugin/passwdfile"
+	"github.com/DrmagicE/gmqtt/plugin/prometheus"
+	retained_redis "github.com/DrmagicE/gmqtt/retained/redis"
+	subscription_redis "github.com/DrmagicE/gmqtt/subscription/redis"
+)
+
+var (
+	configPath  = flag.String("config", "gmqttd.yml", "the path of the configuration file")
+	configCheck = flag.Bool("config-check", false, "validate the configuration file and exit")
+)
+
+func main() {
+	flag.Parse()
+	c, err := config.Load(*configPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if *configCheck {
+		if err := checkTLS(c); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		fmt.Println("the configuration file is ok")
+		return
+	}
+	if err := run(c); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// checkTLS loads the certificates of the listeners.
+func checkTLS(c config.Config) error {
+	for i, l := range c.Listeners {
+		if l.TLS == nil {
+			continue
+		}
+		if _, err := l.TLS.TLSConfig(); err != nil {
+			return fmt.Errorf("listeners[%d].tls: %s", i, err)
+		}
+	}
+	return nil
+}
+
+func newLogger(c config.Log) (*zap.Logger, zap.AtomicLevel, error) {
+	var level zapcore.Level
+	level.UnmarshalText([]byte(c.Level))
+	atomicLevel := zap.NewAtomicLevelAt(level)
+	cfg := zap.NewProductionConfig()
+	if c.Format == "console" {
+		cfg = zap.NewDevelopmentConfig()
+	}
+	cfg.Level = atomicLevel
+	l, err := cfg.Build()
+	return l, atomicLevel, err
+}
+
+func run(c config.Config) error {
+	l, level, err := newLogger(c.Log)
+	if err != nil {
+		return err
+	}
+	opts := []gmqtt.Options{
+		gmqtt.WithConfig(c.ServerConfig()),
+		gmqtt.WithLogger(l),
+		gmqtt.WithLogLevel(level),
+	}
+	listenerOpts, err := listeners(c.Listeners)
+	if err != nil {
+		return err
+	}
+	opts = append(opts, listenerOpts...)
+	persistenceOpts, closePersistence, err := persistence(c.Persistence)
+	if err != nil {
+		return err
+	}
+	defer closePersistence()
+	opts = append(opts, persistenceOpts...)
+	opts = append(opts, plugins(c.Plugins)...)
+
+	s := gmqtt.NewServer(opts...)
+	for module, v := range c.Log.Modules {
+		var level zapcore.Level
+		level.UnmarshalText([]byte(v))
+		s.SetModuleLogLevel(module, level)
+	}
+	s.Run()
+	signalCh := make(chan os.Signal, 1)
+	signal.Notify(signalCh, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	for sig := range signalCh {
+		if sig == syscall.SIGHUP {
+			if err := s.ReloadConfig(s.GetConfig()); err != nil {
+				l.Error("reload error", zap.Error(err))
+			}
+			continue
+		}
+		break
+	}
+	return s.Stop(context.Background())
+}
+
+func listeners(ls []config.Listener) ([]gmqtt.Options, error) {
+	var opts []gmqtt.Options
+	for i, l := range ls {
+		if l.Websocket != nil {
+			path := l.Websocket.Path
+			if path == "" {
+				path = "/"
+			}
+			ws := &gmqtt.WsServer{
+				Server: &http.Server{Addr: strings.TrimPrefix(l.Address, "tcp://")},
+				Path:   path,
+			}
+			if l.TLS != nil {
+				ws.CertFile = l.TLS.CertFile
+				ws.KeyFile = l.TLS.KeyFile
+			}
+			if l.Profile != nil {
+				profile := l.Profile.ListenerProfile()
+				ws.Profile = &profile
+			}
+			opts = append(opts, gmqtt.WithWebsocketServer(ws))
+			continue
+		}
+		var tlsConfig *tls.Config
+		if l.TLS != nil {
+			var err error
+			if tlsConfig, err = l.TLS.TLSConfig(); err != nil {
+				return nil, fmt.Errorf("listeners[%d].tls: %s", i, err)
+			}
+		}
+		ln, err := gmqtt.Listen(l.Address)
+		if err != nil {
+			return nil, fmt.Errorf("listeners[%d]: %s", i, err)
+		}
+		if l.ProxyProtocol {
+			ln = proxyproto.NewListener(ln, proxyproto.WithRequired())
+		}
+		if tlsConfig != nil {
+			ln = tls.NewListener(ln, tlsConfig)
+		}
+		if l.Profile != nil {
+			opts = append(opts, gmqtt.WithListenerProfile(l.Profile.ListenerProfile(), ln))
+			continue
+		}
+		opts = append(opts, gmqtt.WithTCPListener(ln))
+	}
+	return opts, nil
+}
+
+// persistence returns the options of the persistence backend and the function to close the backend.
+func persistence(p config.Persistence) ([]gmqtt.Options, func(), error) {
+	switch p.Type {
+	case config.PersistenceBolt:
+		return boltPersistence(p.Bolt)
+	case config.PersistenceRedis:
+		return redisPersistence(p.Redis)
+	}
+	return nil, func() {}, nil
+}
+
+func boltPersistence(c config.Bolt) ([]gmqtt.Options, func(), error) {
+	db, err := bbolt.Open(c.Path, 0600, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	closeDB := func() {
+		db.Close()
+	}
+	sessions, err := bolt.NewSessionStore(db)
+	if err != nil {
+		closeDB()
+		return nil, nil, err
+	}
+	queues, err := bolt.NewQueueStore(db)
+	if err != nil {
+		closeDB()
+		return nil, nil, err
+	}
+	inflight, err := bolt.NewInflightStore(db)
+	if err != nil {
+		closeDB()
+		return nil, nil, err
+	}
+	bans, err := bolt.NewBanStore(db)
+	if err != nil {
+		closeDB()
+		return nil, nil, err
+	}
+	delayed, err := bolt.NewDelayedStore(db)
+	if err != nil {
+		closeDB()
+		return nil, nil, err
+	}
+	return []gmqtt.Options{
+		gmqtt.WithSessionPersistence(sessions, queues),
+		gmqtt.WithInflightPersistence(inflight),
+		gmqtt.WithBanPersistence(bans),
+		gmqtt.WithDelayedPersistence(delayed),
+	}, closeDB, nil
+}
+
+func redisPersistence(c config.Redis) ([]gmqtt.Options, func(), error) {
+	pool := &redigo.Pool{
+		MaxIdle: c.MaxIdle,
+		Dial: func() (redigo.Conn, error) {
+			return redigo.Dial("tcp", c.Addr, redigo.DialPassword(c.Password), redigo.DialDatabase(c.Database))
+		},
+	}
+	conn := pool.Get()
+	_, err := conn.Do("PING")
+	conn.Close()
+	if err != nil {
+		pool.Close()
+		return nil, nil, err
+	}
+	var (
+		storeOpts        []persistence_redis.Option
+		subscriptionOpts []subscription_redis.Option
+		retainedOpts     []retained_redis.Option
+	)
+	if c.KeyPrefix != "" {
+		storeOpts = append(storeOpts, persistence_redis.WithKeyPrefix(c.KeyPrefix))
+		subscriptionOpts = append(subscriptionOpts, subscription_redis.WithKeyPrefix(c.KeyPrefix))
+		retainedOpts = append(retainedOpts, retained_redis.WithKeyPrefix(c.KeyPrefix))
+	}
+	return []gmqtt.Options{
+		gmqtt.WithSessionPersistence(persistence_redis.NewSessionStore(pool, storeOpts...),
+			persistence_redis.NewQueueStore(pool, storeOpts...)),
+		gmqtt.WithInflightPersistence(persistence_redis.NewInflightStore(pool, storeOpts...)),
+		gmqtt.WithSubscriptionStore(subscription_redis.New(pool, subscriptionOpts...)),
+		gmqtt.WithRetainedStore(retained_redis.New(pool, retainedOpts...)),
+	}, func() { pool.Close() }, nil
+}
+
+func plugins(p config.Plugins) []gmqtt.Options {
+	var opts []gmqtt.Options
+	if p.Passwdfile != nil {
+		opts = append(opts, gmqtt.WithPlugin(passwdfile.New(p.Passwdfile.File)))
+	}
+	if p.ACL != nil {
+		aclOpts := []acl.Option{acl.WithFile(p.ACL.File)}
+		if p.ACL.NoMatch != "" {
+			aclOpts = append(aclOpts, acl.WithNoMatch(acl.Permission(p.ACL.NoMatch)))
+		}
+		opts = append(opts, gmqtt.WithPlugin(acl.New(aclOpts...)))
+	}
+	if p.Management != nil {
+		var accounts gin.Accounts
+		if len(p.Management.Accounts) != 0 {
+			accounts = gin.Accounts(p.Management.Accounts)
+		}
+		var managementOpts []management.Option
+		if p.Management.Token != "" {
+			managementOpts = append(managementOpts, management.WithToken(p.Management.Token))
+		}
+		opts = append(opts, gmqtt.WithPlugin(management.New(p.Management.Address, accounts, managementOpts...)))
+	}
+	if p.Prometheus != nil {
+		path := p.Prometheus.Path
+		if path == "" {
+			path = "/metrics"
+		}
+		opts = append(opts, gmqtt.WithPlugin(prometheus.New(&http.Server{Addr: p.Prometheus.Address}, path)))
+	}
+	if p.Admin != nil {
+		opts = append(opts, gmqtt.WithPlugin(admin.New(p.Admin.Address)))
+	}
+	for _, e := range p.ExHook {
+		var exhookOpts []exhook.Option
+		if e.Name != "" {
+			exhookOpts = append(exhookOpts, exhook.WithName(e.Name))
+		}
+		if len(e.Command) != 0 {
+			exhookOpts = append(exhookOpts, exhook.WithCommand(e.Command[0], e.Command[1:]...))
+		}
+		if e.FailPolicy == "open" {
+			for _, h := range []exhook.Hook{exhook.OnConnect, exhook.OnSubscribe, exhook.OnMsgArrived} {
+				exhookOpts = append(exhookOpts, exhook.WithFailPolicy(h, exhook.FailOpen))
+			}
+		}
+		opts = append(opts, gmqtt.WithPlugin(exhook.New(e.Address, exhookOpts...)))
+	}
+	return opts
+}
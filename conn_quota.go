@@ -0,0 +1,138 @@
+package gmqtt
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+
+	"go.uber.org/zap"
+
+	"github.com/DrmagicE/gmqtt/pkg/packets"
+)
+
+// IPConnectionQuota limits the total concurrent connections from the addresses in the CIDR.
+type IPConnectionQuota struct {
+	// CIDR is the network of the source addresses, e.g: "10.0.0.0/8".
+	CIDR string
+	// MaxConnections is the maximum number of the concurrent connections from the network.
+	MaxConnections int
+}
+
+type cidrQuota struct {
+	network *net.IPNet
+	max     int
+	current int
+}
+
+// connQuota counts the concurrent connections of each source address and each network of Config.IPConnectionQuotas.
+// The connections are counted from being accepted to being closed, including the ones which have not sent CONNECT yet.
+type connQuota struct {
+	maxPerIP int
+	mu       sync.Mutex
+	ips      map[string]int
+	cidrs    []*cidrQuota
+}
+
+func newConnQuota(config Config) (*connQuota, error) {
+	q := &connQuota{
+		maxPerIP: config.MaxConnectionsPerIP,
+		ips:      make(map[string]int),
+	}
+	for _, v := range config.IPConnectionQuotas {
+		_, network, err := net.ParseCIDR(v.CIDR)
+		if err != nil {
+			return nil, err
+		}
+		q.cidrs = append(q.cidrs, &cidrQuota{network: network, max: v.MaxConnections})
+	}
+	return q, nil
+}
+
+// remoteIP returns the source address of the connection, nil if it is not an IP address.
+func remoteIP(addr net.Addr) net.IP {
+	if addr == nil {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		host = addr.String()
+	}
+	return net.ParseIP(host)
+}
+
+// opened counts the connection of the address.
+func (q *connQuota) opened(ip net.IP) {
+	if q == nil || ip == nil {
+		return
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.ips[ip.String()]++
+	for _, c := range q.cidrs {
+		if c.network.Contains(ip) {
+			c.current++
+		}
+	}
+}
+
+// closed uncounts the connection of the address.
+func (q *connQuota) closed(ip net.IP) {
+	if q == nil || ip == nil {
+		return
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	key := ip.String()
+	if q.ips[key]--; q.ips[key] <= 0 {
+		delete(q.ips, key)
+	}
+	for _, c := range q.cidrs {
+		if c.network.Contains(ip) {
+			c.current--
+		}
+	}
+}
+
+// exceeded returns whether the connections of the address exceed the quotas, the connection itself is counted.
+func (q *connQuota) exceeded(ip net.IP) bool {
+	if q == nil || ip == nil {
+		return false
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.maxPerIP > 0 && q.ips[ip.String()] > q.maxPerIP {
+		return true
+	}
+	for _, c := range q.cidrs {
+		if c.network.Contains(ip) && c.current > c.max {
+			return true
+		}
+	}
+	return false
+}
+
+// checkConnQuota returns the code of the connack packet according to the connection quotas,
+// the connections over the quotas are rejected with CodeServerUnavaliable.
+func (client *client) checkConnQuota() (code uint8) {
+	srv := client.server
+	if max := srv.config.MaxConnectionsPerListener; max > 0 && client.listener != nil &&
+		atomic.LoadUint64(&client.listener.ConnectionsCurrent) > uint64(max) {
+		atomic.AddUint64(&client.listener.RejectedListenerQuota, 1)
+		clientLog().Warn("too many connections of the listener, rejecting connection",
+			zap.String("remote_addr", client.rwc.RemoteAddr().String()),
+			zap.String("client_id", client.opts.clientID),
+		)
+		return packets.CodeServerUnavaliable
+	}
+	if srv.connQuota.exceeded(client.remoteIP) {
+		if client.listener != nil {
+			atomic.AddUint64(&client.listener.RejectedIPQuota, 1)
+		}
+		clientLog().Warn("too many connections from the address, rejecting connection",
+			zap.String("remote_addr", client.rwc.RemoteAddr().String()),
+			zap.String("client_id", client.opts.clientID),
+		)
+		return packets.CodeServerUnavaliable
+	}
+	return packets.CodeAccepted
+}
@@ -0,0 +1,130 @@
+package gmqtt
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/DrmagicE/gmqtt/pkg/packets"
+)
+
+func TestConnQuota(t *testing.T) {
+	a := assert.New(t)
+	q, err := newConnQuota(Config{
+		MaxConnectionsPerIP: 2,
+		IPConnectionQuotas:  []IPConnectionQuota{{CIDR: "10.0.0.0/24", MaxConnections: 2}},
+	})
+	a.NoError(err)
+	ip1 := net.ParseIP("10.0.0.1")
+	ip2 := net.ParseIP("10.0.0.2")
+	ip3 := net.ParseIP("192.168.0.1")
+
+	q.opened(ip1)
+	a.False(q.exceeded(ip1))
+	q.opened(ip1)
+	a.False(q.exceeded(ip1))
+	q.opened(ip1)
+	a.True(q.exceeded(ip1))
+	q.closed(ip1)
+
+	// the network quota is shared by the addresses in the network.
+	q.opened(ip2)
+	a.True(q.exceeded(ip2))
+	q.closed(ip2)
+	a.False(q.exceeded(ip1))
+
+	q.opened(ip3)
+	q.opened(ip3)
+	a.False(q.exceeded(ip3))
+	q.closed(ip3)
+	q.closed(ip3)
+	q.closed(ip1)
+	q.closed(ip1)
+	a.Empty(q.ips)
+	a.Zero(q.cidrs[0].current)
+
+	// the connections without IP addresses are not limited.
+	a.False(q.exceeded(nil))
+	a.Nil(remoteIP(dummyAddr("remote-addr")))
+	a.Equal("127.0.0.1", remoteIP(&net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 1883}).String())
+
+	_, err = newConnQuota(Config{IPConnectionQuotas: []IPConnectionQuota{{CIDR: "invalid", MaxConnections: 1}}})
+	a.Error(err)
+}
+
+func dialAndConnect(t *testing.T, clientID string) (net.Conn, uint8) {
+	c, err := net.Dial("tcp", "127.0.0.1:1883")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	connect := defaultConnectPacket()
+	connect.ClientID = []byte(clientID)
+	packets.NewWriter(c).WriteAndFlush(connect)
+	p, err := packets.NewReader(c).ReadPacket()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	return c, p.(*packets.Connack).Code
+}
+
+func TestConnQuota_Server(t *testing.T) {
+	var tt = []struct {
+		name   string
+		config func(c *Config)
+		stats  func(l *ListenerStats) uint64
+	}{
+		{
+			name:   "per_listener",
+			config: func(c *Config) { c.MaxConnectionsPerListener = 2 },
+			stats:  func(l *ListenerStats) uint64 { return l.RejectedListenerQuota },
+		},
+		{
+			name:   "per_ip",
+			config: func(c *Config) { c.MaxConnectionsPerIP = 2 },
+			stats:  func(l *ListenerStats) uint64 { return l.RejectedIPQuota },
+		},
+		{
+			name: "cidr",
+			config: func(c *Config) {
+				c.IPConnectionQuotas = []IPConnectionQuota{{CIDR: "127.0.0.0/8", MaxConnections: 2}}
+			},
+			stats: func(l *ListenerStats) uint64 { return l.RejectedIPQuota },
+		},
+	}
+	for _, v := range tt {
+		t.Run(v.name, func(t *testing.T) {
+			a := assert.New(t)
+			ln, err := net.Listen("tcp", "127.0.0.1:1883")
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			config := DefaultConfig
+			v.config(&config)
+			srv := NewServer(WithTCPListener(ln), WithConfig(config))
+			defer srv.Stop(context.Background())
+			srv.Run()
+
+			c1, code := dialAndConnect(t, "id1")
+			a.EqualValues(packets.CodeAccepted, code)
+			c2, code := dialAndConnect(t, "id2")
+			a.EqualValues(packets.CodeAccepted, code)
+			c3, code := dialAndConnect(t, "id3")
+			a.EqualValues(packets.CodeServerUnavaliable, code)
+			c3.Close()
+			c2.Close()
+			defer c1.Close()
+
+			listener := srv.GetStatsManager().GetStats().ListenerStats[tcpListenerName(ln)]
+			a.EqualValues(1, v.stats(listener))
+			// the quota is released once the connection is closed.
+			a.Eventually(func() bool {
+				c, code := dialAndConnect(t, "id4")
+				defer c.Close()
+				return code == packets.CodeAccepted
+			}, time.Second, 20*time.Millisecond)
+		})
+	}
+}
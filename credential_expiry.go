@@ -0,0 +1,100 @@
+package gmqtt
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// credentialExpiry disconnects the client once its credential expires, see Client.SetCredentialExpiry.
+type credentialExpiry struct {
+	mu     sync.Mutex
+	expiry time.Time
+	timer  *time.Timer
+}
+
+// CredentialExpiry returns the time the credential of the client expires, the zero time means it never expires.
+func (client *client) CredentialExpiry() time.Time {
+	c := &client.credential
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.expiry
+}
+
+// SetCredentialExpiry replaces the credential expiry of the client, the zero time cancels it.
+// The OnCredentialExpiry hooks are called Config.CredentialExpiryNotice before the expiry,
+// and the client is disconnected at the expiry unless the hooks extend it.
+func (client *client) SetCredentialExpiry(expiry time.Time) {
+	c := &client.credential
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.timer != nil {
+		c.timer.Stop()
+		c.timer = nil
+	}
+	c.expiry = expiry
+	if expiry.IsZero() {
+		return
+	}
+	notice := client.server.config.CredentialExpiryNotice
+	if client.server.hooks.OnCredentialExpiry == nil {
+		notice = 0
+	}
+	c.timer = time.AfterFunc(time.Until(expiry.Add(-notice)), func() {
+		client.credentialExpiring(expiry)
+	})
+}
+
+// credentialExpiring calls the OnCredentialExpiry hooks and schedules the disconnection if the expiry is not extended.
+func (client *client) credentialExpiring(expiry time.Time) {
+	if client.IsDisConnected() {
+		return
+	}
+	rs := expiry
+	if hook := client.server.hooks.OnCredentialExpiry; hook != nil {
+		rs = hook(context.Background(), client, expiry)
+	}
+	c := &client.credential
+	c.mu.Lock()
+	if !c.expiry.Equal(expiry) {
+		// replaced by the hooks or by the plugins.
+		c.mu.Unlock()
+		return
+	}
+	if !rs.Equal(expiry) {
+		c.mu.Unlock()
+		clientLog().Info("credential expiry extended", client.logFields(zap.Time("expiry", rs))...)
+		client.SetCredentialExpiry(rs)
+		return
+	}
+	c.timer = time.AfterFunc(time.Until(expiry), func() {
+		client.credentialExpired(expiry)
+	})
+	c.mu.Unlock()
+}
+
+// credentialExpired disconnects the client. MQTT 3.1.1 does not allow the server to send DISCONNECT,
+// so the connection is closed without notice.
+func (client *client) credentialExpired(expiry time.Time) {
+	c := &client.credential
+	c.mu.Lock()
+	expired := c.expiry.Equal(expiry)
+	c.mu.Unlock()
+	if !expired {
+		return
+	}
+	clientLog().Info("credential expired, disconnecting client", client.logFields(zap.Time("expiry", expiry))...)
+	client.Close()
+}
+
+// setCertExpiry sets the credential expiry to the NotAfter of the client certificate, see Config.DisconnectOnCertExpiry.
+func (client *client) setCertExpiry() {
+	if !client.server.config.DisconnectOnCertExpiry {
+		return
+	}
+	if certs := client.opts.peerCertificates; len(certs) != 0 {
+		client.SetCredentialExpiry(certs[0].NotAfter)
+	}
+}
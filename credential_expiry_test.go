@@ -0,0 +1,63 @@
+package gmqtt
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServer_CredentialExpiry(t *testing.T) {
+	a := assert.New(t)
+	var mu sync.Mutex
+	notified := make(map[string]time.Duration)
+	var events []string
+	plugin := &testPlugin{name: "expiry", events: &events, hooks: HookWrapper{
+		OnConnectedWrapper: func(next OnConnected) OnConnected {
+			return func(ctx context.Context, client Client) {
+				client.SetCredentialExpiry(time.Now().Add(300 * time.Millisecond))
+				next(ctx, client)
+			}
+		},
+		OnCredentialExpiryWrapper: func(next OnCredentialExpiry) OnCredentialExpiry {
+			return func(ctx context.Context, client Client, expiry time.Time) time.Time {
+				clientID := client.OptionsReader().ClientID()
+				mu.Lock()
+				notified[clientID] = time.Until(expiry)
+				mu.Unlock()
+				if clientID == "extended" {
+					return expiry.Add(time.Hour)
+				}
+				return next(ctx, client, expiry)
+			}
+		},
+	}}
+	config := DefaultConfig
+	config.CredentialExpiryNotice = 200 * time.Millisecond
+	srv := NewServer(WithConfig(config), WithPlugin(plugin))
+	srv.tcpListener = append(srv.tcpListener, &testListener{acceptReady: make(chan struct{})})
+	defer srv.Stop(context.Background())
+	srv.Run()
+
+	connectTestClient(srv, defaultConnectPacket())
+	extended := defaultConnectPacket()
+	extended.ClientID = []byte("extended")
+	connectTestClient(srv, extended)
+
+	// the clean session of the expired client is removed after it is closed.
+	a.Eventually(func() bool {
+		return srv.Client("MQTT") == nil
+	}, 2*time.Second, 10*time.Millisecond)
+	c := srv.Client("extended")
+	if a.NotNil(c) {
+		a.True(c.IsConnected())
+		a.True(time.Until(c.CredentialExpiry()) > 50*time.Minute)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	// the hooks are called before the expiry.
+	a.True(notified["MQTT"] > 0)
+	a.True(notified["extended"] > 0)
+}
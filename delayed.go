@@ -0,0 +1,197 @@
+package gmqtt
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	persistence_delayed "github.com/DrmagicE/gmqtt/persistence/delayed"
+	"github.com/DrmagicE/gmqtt/pkg/packets"
+	"github.com/DrmagicE/gmqtt/pkg/timerwheel"
+)
+
+// delayedTopicPrefix is the topic prefix of the delayed publishes: $delayed/<seconds>/<topic>.
+const delayedTopicPrefix = "$delayed/"
+
+const (
+	// delayedWheelTick is the precision of the delayed publishes.
+	delayedWheelTick = time.Second
+	// delayedWheelSlots is the number of slots of the delayed publish timer wheel.
+	delayedWheelSlots = 3600
+)
+
+var errInvalidDelayedTopic = errors.New("invalid delayed topic")
+
+// parseDelayedTopic returns the delay and the topic name of the delayed topic $delayed/<seconds>/<topic>.
+func parseDelayedTopic(topic string) (delay time.Duration, target string, err error) {
+	rest := strings.TrimPrefix(topic, delayedTopicPrefix)
+	i := strings.IndexByte(rest, '/')
+	if i == -1 {
+		return 0, "", errInvalidDelayedTopic
+	}
+	seconds, err := strconv.ParseUint(rest[:i], 10, 32)
+	if err != nil {
+		return 0, "", errInvalidDelayedTopic
+	}
+	target = rest[i+1:]
+	if !packets.ValidTopicName([]byte(target)) || strings.HasPrefix(target, delayedTopicPrefix) {
+		return 0, "", errInvalidDelayedTopic
+	}
+	return time.Duration(seconds) * time.Second, target, nil
+}
+
+// delayedService holds the delayed messages until their delays elapse.
+type delayedService struct {
+	server *server
+	mu     sync.Mutex
+	// pending is the pending delayed messages keyed by the message id.
+	pending map[string]*persistence_delayed.Message
+	wheel   *timerwheel.TimerWheel
+}
+
+func newDelayedService(srv *server) *delayedService {
+	return &delayedService{
+		server:  srv,
+		pending: make(map[string]*persistence_delayed.Message),
+		wheel:   timerwheel.New(delayedWheelTick, delayedWheelSlots),
+	}
+}
+
+// schedule schedules the message, it returns false if the number of the pending messages reaches the limit.
+func (d *delayedService) schedule(m *msg, delay time.Duration) bool {
+	dm := &persistence_delayed.Message{
+		ID:        getRandomUUID(),
+		Qos:       m.qos,
+		Retained:  m.retained,
+		Topic:     m.topic,
+		Payload:   m.payload,
+		PublishAt: time.Now().Add(delay),
+	}
+	d.mu.Lock()
+	if max := d.server.config.MaxDelayedMessages; max > 0 && len(d.pending) >= max {
+		d.mu.Unlock()
+		return false
+	}
+	d.pending[dm.ID] = dm
+	d.mu.Unlock()
+	d.server.persistDelayed(dm)
+	d.add(dm, delay)
+	return true
+}
+
+func (d *delayedService) add(dm *persistence_delayed.Message, delay time.Duration) {
+	d.wheel.Add(dm.ID, delay, func() {
+		d.fire(dm.ID)
+	})
+}
+
+// fire publishes the delayed message.
+func (d *delayedService) fire(id string) {
+	d.mu.Lock()
+	dm, ok := d.pending[id]
+	delete(d.pending, id)
+	d.mu.Unlock()
+	if !ok {
+		return
+	}
+	srv := d.server
+	srv.removePersistedDelayed(id)
+	m := &msg{
+		qos:      dm.Qos,
+		retained: dm.Retained,
+		topic:    dm.Topic,
+		payload:  dm.Payload,
+	}
+	serverLog().Debug("publishing delayed message", zap.String("topic", m.topic))
+	if m.retained && !srv.retain(m, "") {
+		return
+	}
+	select {
+	case <-srv.exitChan:
+	case srv.msgRouter <- &msgRouter{msg: NewMessage(m.topic, m.payload, m.qos), match: true}:
+	}
+}
+
+// len returns the number of the pending delayed messages.
+func (d *delayedService) len() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return len(d.pending)
+}
+
+// delayPublish schedules the message published to the delayed topic.
+// OnMsgArrived is called with the message of the target topic before the message is scheduled.
+func (client *client) delayPublish(m *msg) {
+	srv := client.server
+	delay, target, err := parseDelayedTopic(m.topic)
+	if err != nil {
+		serverLog().Warn("invalid delayed topic, dropping message",
+			zap.String("topic", m.topic),
+			zap.String("client_id", client.opts.clientID),
+		)
+		return
+	}
+	m.topic = target
+	if srv.hooks.OnMsgArrived != nil && !srv.hooks.OnMsgArrived(context.Background(), client, m) {
+		return
+	}
+	if !srv.delayedService.schedule(m, delay) {
+		serverLog().Warn("too many delayed messages, dropping message",
+			zap.String("topic", target),
+			zap.String("client_id", client.opts.clientID),
+		)
+	}
+}
+
+// persistDelayed saves the delayed message if the delayed message persistence is enabled.
+func (srv *server) persistDelayed(dm *persistence_delayed.Message) {
+	if srv.delayedStore == nil {
+		return
+	}
+	if err := srv.delayedStore.Save(dm); err != nil {
+		persistenceLog().Error("persisting delayed message error", zap.String("topic", dm.Topic), zap.Error(err))
+	}
+}
+
+// removePersistedDelayed removes the persisted delayed message if the delayed message persistence is enabled.
+func (srv *server) removePersistedDelayed(id string) {
+	if srv.delayedStore == nil {
+		return
+	}
+	if err := srv.delayedStore.Remove(id); err != nil {
+		persistenceLog().Error("removing persisted delayed message error", zap.String("id", id), zap.Error(err))
+	}
+}
+
+// restoreDelayed reschedules the persisted delayed messages, the overdue messages are published on the next tick.
+func (srv *server) restoreDelayed() error {
+	if srv.delayedStore == nil {
+		return nil
+	}
+	var msgs []*persistence_delayed.Message
+	err := srv.delayedStore.Iterate(func(msg *persistence_delayed.Message) bool {
+		msgs = append(msgs, msg)
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	d := srv.delayedService
+	now := time.Now()
+	for _, v := range msgs {
+		d.mu.Lock()
+		d.pending[v.ID] = v
+		d.mu.Unlock()
+		delay := v.PublishAt.Sub(now)
+		if delay < 0 {
+			delay = 0
+		}
+		d.add(v, delay)
+	}
+	return nil
+}
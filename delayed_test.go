@@ -0,0 +1,150 @@
+package gmqtt
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	persistence_delayed "github.com/DrmagicE/gmqtt/persistence/delayed"
+	"github.com/DrmagicE/gmqtt/pkg/packets"
+)
+
+func TestParseDelayedTopic(t *testing.T) {
+	a := assert.New(t)
+	var tt = []struct {
+		topic  string
+		delay  time.Duration
+		target string
+		valid  bool
+	}{
+		{topic: "$delayed/10/a/b", delay: 10 * time.Second, target: "a/b", valid: true},
+		{topic: "$delayed/0/a", delay: 0, target: "a", valid: true},
+		{topic: "$delayed/10", valid: false},
+		{topic: "$delayed/-1/a", valid: false},
+		{topic: "$delayed/abc/a", valid: false},
+		{topic: "$delayed/10/", valid: false},
+		{topic: "$delayed/10/a/+", valid: false},
+		{topic: "$delayed/10/$delayed/10/a", valid: false},
+	}
+	for _, v := range tt {
+		delay, target, err := parseDelayedTopic(v.topic)
+		if !v.valid {
+			a.Equal(errInvalidDelayedTopic, err, v.topic)
+			continue
+		}
+		a.NoError(err, v.topic)
+		a.Equal(v.delay, delay, v.topic)
+		a.Equal(v.target, target, v.topic)
+	}
+}
+
+func TestClient_DelayPublish(t *testing.T) {
+	a := assert.New(t)
+	config := DefaultConfig
+	config.DelayedPublish = true
+	config.MaxDelayedMessages = 1
+	srv := NewServer(WithConfig(config))
+	srv.msgRouter = make(chan *msgRouter, 1)
+	var arrived []string
+	srv.hooks.OnMsgArrived = func(ctx context.Context, client Client, msg packets.Message) bool {
+		arrived = append(arrived, msg.Topic())
+		return true
+	}
+	c := srv.newClient(&rwTestConn{})
+	c.opts.clientID = "id"
+	c.publishHandler(&packets.Publish{
+		Qos:       packets.QOS_0,
+		TopicName: []byte("$delayed/10/a/b"),
+		Payload:   []byte("payload"),
+	})
+	// over the limit
+	c.publishHandler(&packets.Publish{
+		Qos:       packets.QOS_0,
+		TopicName: []byte("$delayed/10/c"),
+	})
+	// invalid delayed topic
+	c.publishHandler(&packets.Publish{
+		Qos:       packets.QOS_0,
+		TopicName: []byte("$delayed/a/b"),
+	})
+	a.Equal([]string{"a/b", "c"}, arrived)
+	a.Equal(1, srv.delayedService.len())
+	a.Len(srv.msgRouter, 0)
+
+	var id string
+	for k := range srv.delayedService.pending {
+		id = k
+	}
+	srv.delayedService.fire(id)
+	a.Zero(srv.delayedService.len())
+	a.Len(srv.msgRouter, 1)
+	router := <-srv.msgRouter
+	a.True(router.match)
+	a.Equal("a/b", router.msg.Topic())
+	a.Equal([]byte("payload"), router.msg.Payload())
+}
+
+func TestDelayedService_Retained(t *testing.T) {
+	a := assert.New(t)
+	srv := NewServer()
+	srv.msgRouter = make(chan *msgRouter, 1)
+	a.True(srv.delayedService.schedule(&msg{
+		qos:      packets.QOS_1,
+		retained: true,
+		topic:    "a",
+		payload:  []byte("payload"),
+	}, time.Minute))
+	a.Nil(srv.retainedDB.GetRetainedMessage("a"))
+	for k := range srv.delayedService.pending {
+		srv.delayedService.fire(k)
+	}
+	a.NotNil(srv.retainedDB.GetRetainedMessage("a"))
+	router := <-srv.msgRouter
+	a.False(router.msg.Retained())
+	a.EqualValues(packets.QOS_1, router.msg.Qos())
+}
+
+type testDelayedStore struct {
+	msgs map[string]*persistence_delayed.Message
+}
+
+func (s *testDelayedStore) Save(msg *persistence_delayed.Message) error {
+	s.msgs[msg.ID] = msg
+	return nil
+}
+
+func (s *testDelayedStore) Remove(id string) error {
+	delete(s.msgs, id)
+	return nil
+}
+
+func (s *testDelayedStore) Iterate(fn func(msg *persistence_delayed.Message) bool) error {
+	for _, v := range s.msgs {
+		if !fn(v) {
+			return nil
+		}
+	}
+	return nil
+}
+
+func TestDelayedService_Persistence(t *testing.T) {
+	a := assert.New(t)
+	store := &testDelayedStore{msgs: make(map[string]*persistence_delayed.Message)}
+	srv := NewServer(WithDelayedPersistence(store))
+	a.True(srv.delayedService.schedule(&msg{topic: "a"}, time.Hour))
+	a.True(srv.delayedService.schedule(&msg{topic: "b"}, time.Hour))
+	a.Len(store.msgs, 2)
+	store.msgs["overdue"] = &persistence_delayed.Message{ID: "overdue", Topic: "c", PublishAt: time.Now().Add(-time.Minute)}
+
+	srv = NewServer(WithDelayedPersistence(store))
+	srv.msgRouter = make(chan *msgRouter, 1)
+	a.NoError(srv.restoreDelayed())
+	a.Equal(3, srv.delayedService.len())
+	a.Equal(3, srv.delayedService.wheel.Len())
+	srv.delayedService.fire("overdue")
+	a.Len(store.msgs, 2)
+	router := <-srv.msgRouter
+	a.Equal("c", router.msg.Topic())
+}
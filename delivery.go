@@ -0,0 +1,54 @@
+package gmqtt
+
+import (
+	"github.com/DrmagicE/gmqtt/pkg/packets"
+)
+
+// deliveryPublish is the PUBLISH packet in the write queue which carries the delivery for the OnDelivered hook.
+type deliveryPublish struct {
+	*packets.Publish
+	delivery *Delivery
+}
+
+// unwrapDelivery returns the PUBLISH packet and the delivery of the packet in the write queue,
+// the returned packet is nil if p is not a PUBLISH packet.
+func unwrapDelivery(p packets.Packet) (*packets.Publish, *Delivery) {
+	switch p := p.(type) {
+	case *deliveryPublish:
+		return p.Publish, p.delivery
+	case *packets.Publish:
+		return p, nil
+	}
+	return nil, nil
+}
+
+// newDelivery returns the delivery of the message routed by the subscription,
+// nil if neither OnDelivered nor OnAcked is set.
+func (srv *server) newDelivery(msg packets.Message, subscription packets.Topic) *Delivery {
+	if srv.hooks.OnDelivered == nil && srv.hooks.OnAcked == nil {
+		return nil
+	}
+	return &Delivery{
+		Message:      msg,
+		Subscription: subscription,
+	}
+}
+
+// newDelivery returns the delivery of the publish which does not carry the delivery,
+// such as the messages restored from the message queue. The subscription is looked up from the subscription store.
+func (client *client) newDelivery(publish *packets.Publish) *Delivery {
+	d := &Delivery{
+		Message:      messageFromPublish(publish),
+		Subscription: packets.Topic{Name: string(publish.TopicName), Qos: publish.Qos},
+		Qos:          publish.Qos,
+		PacketID:     publish.PacketID,
+	}
+	var matched bool
+	for _, t := range client.server.subscriptionsDB.GetClientSubscriptions(client.opts.clientID) {
+		if packets.TopicMatch(publish.TopicName, []byte(t.Name)) && (!matched || t.Qos > d.Subscription.Qos) {
+			d.Subscription = t
+			matched = true
+		}
+	}
+	return d
+}
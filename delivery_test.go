@@ -0,0 +1,132 @@
+package gmqtt
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/DrmagicE/gmqtt/pkg/packets"
+)
+
+func TestOnDeliveredAndOnAcked(t *testing.T) {
+	a := assert.New(t)
+	delivered := make(chan *Delivery, 10)
+	acked := make(chan *Delivery, 10)
+	srv := NewServer(WithHook(Hooks{
+		OnDelivered: func(ctx context.Context, client Client, delivery *Delivery) {
+			a.Equal("sub", client.OptionsReader().ClientID())
+			delivered <- delivery
+		},
+		OnAcked: func(ctx context.Context, client Client, delivery *Delivery) {
+			a.Equal("sub", client.OptionsReader().ClientID())
+			acked <- delivery
+		},
+	}))
+	srv.tcpListener = append(srv.tcpListener, &testListener{acceptReady: make(chan struct{})})
+	srv.Run()
+	defer srv.Stop(context.Background())
+	subConnect := defaultConnectPacket()
+	subConnect.ClientID = []byte("sub")
+	sub := connectTestClient(srv, subConnect)
+	pubConnect := defaultConnectPacket()
+	pubConnect.ClientID = []byte("pub")
+	pub := connectTestClient(srv, pubConnect)
+	writePacket(sub, &packets.Subscribe{
+		PacketID: 1,
+		Topics: []packets.Topic{
+			{Name: "a/+", Qos: packets.QOS_1},
+			{Name: "b/#", Qos: packets.QOS_0},
+		},
+	})
+	_, err := readPacket(sub)
+	a.NoError(err)
+
+	writePacket(pub, &packets.Publish{
+		Qos:       packets.QOS_2,
+		PacketID:  10,
+		TopicName: []byte("a/b"),
+		Payload:   []byte("payload"),
+	})
+	p, err := readPacket(sub)
+	a.NoError(err)
+	publish := p.(*packets.Publish)
+	var d *Delivery
+	select {
+	case d = <-delivered:
+	case <-time.After(time.Second):
+		t.Fatal("OnDelivered timeout")
+	}
+	a.Equal("a/b", d.Message.Topic())
+	a.Equal(packets.QOS_2, d.Message.Qos())
+	a.Equal([]byte("payload"), d.Message.Payload())
+	a.Equal(packets.Topic{Name: "a/+", Qos: packets.QOS_1}, d.Subscription)
+	a.Equal(packets.QOS_1, d.Qos)
+	a.Equal(publish.PacketID, d.PacketID)
+	a.Len(acked, 0)
+
+	writePacket(sub, publish.NewPuback())
+	select {
+	case ad := <-acked:
+		a.Equal(d, ad)
+	case <-time.After(time.Second):
+		t.Fatal("OnAcked timeout")
+	}
+
+	// QoS 0 messages are not acked.
+	writePacket(pub, &packets.Publish{
+		Qos:       packets.QOS_0,
+		TopicName: []byte("b/c"),
+		Payload:   []byte("payload"),
+	})
+	_, err = readPacket(sub)
+	a.NoError(err)
+	select {
+	case d = <-delivered:
+		a.Equal(packets.Topic{Name: "b/#", Qos: packets.QOS_0}, d.Subscription)
+		a.Equal(packets.QOS_0, d.Qos)
+	case <-time.After(time.Second):
+		t.Fatal("OnDelivered timeout")
+	}
+	a.Len(acked, 0)
+}
+
+func TestOnDelivered_queued(t *testing.T) {
+	a := assert.New(t)
+	delivered := make(chan *Delivery, 10)
+	srv := NewServer(WithHook(Hooks{
+		OnDelivered: func(ctx context.Context, client Client, delivery *Delivery) {
+			delivered <- delivery
+		},
+	}))
+	srv.tcpListener = append(srv.tcpListener, &testListener{acceptReady: make(chan struct{})})
+	srv.Run()
+	defer srv.Stop(context.Background())
+	subConnect := defaultConnectPacket()
+	subConnect.ClientID = []byte("sub")
+	subConnect.CleanSession = false
+	sub := connectTestClient(srv, subConnect)
+	writePacket(sub, &packets.Subscribe{
+		PacketID: 1,
+		Topics:   []packets.Topic{{Name: "a/#", Qos: packets.QOS_1}},
+	})
+	_, err := readPacket(sub)
+	a.NoError(err)
+	writePacket(sub, &packets.Disconnect{})
+	time.Sleep(100 * time.Millisecond)
+
+	srv.PublishService().Publish(NewMessage("a/b", []byte("payload"), packets.QOS_1))
+	time.Sleep(100 * time.Millisecond)
+	sub = connectTestClient(srv, subConnect)
+	p, err := readPacket(sub)
+	a.NoError(err)
+	select {
+	case d := <-delivered:
+		// the subscription of the queued message is looked up from the subscription store.
+		a.Equal(packets.Topic{Name: "a/#", Qos: packets.QOS_1}, d.Subscription)
+		a.Equal(p.(*packets.Publish).PacketID, d.PacketID)
+	case <-time.After(time.Second):
+		t.Fatal("OnDelivered timeout")
+	}
+}
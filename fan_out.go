@@ -0,0 +1,320 @@
+package gmqtt
+
+import (
+	"container/list"
+	"context"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"github.com/DrmagicE/gmqtt/pkg/packets"
+)
+
+// DefaultFanOutQueueLen is the default number of the messages waiting in the fan-out queue for each subscriber,
+// see Config.FanOutQueueLen.
+const DefaultFanOutQueueLen = 1024
+
+// fanOutJob is the publish to be delivered to a subscriber by the fan-out workers,
+// or the function to be run in the order of the deliveries to the subscriber.
+type fanOutJob struct {
+	ctx context.Context
+	// client is the subscriber when the message was routed. If its session has been taken over since then,
+	// the message is queued in the old session, which is delivered to the new client by the resume job.
+	client   *client
+	publish  *packets.Publish
+	delivery *Delivery
+	// fn is run instead of delivering the publish if it is set, stopped is true if it is run by stop,
+	// in which case it must not block.
+	fn       func(stopped bool)
+	queuedAt time.Time
+}
+
+// fanOutQueue is the queue of a worker.
+type fanOutQueue struct {
+	jobs   *list.List
+	notify chan struct{}
+}
+
+// fanOut is the worker pool delivering the published messages to the subscribers, see Config.FanOutWorkers.
+// The deliveries of each client id are always handled by the same worker, so the messages are delivered
+// to a subscriber in the order they were routed, which keeps the order of each publisher and topic.
+// Routing the messages never blocks: once a subscriber has FanOutQueueLen messages waiting, the waiting and the
+// following messages are queued in its session, subject to the queue limits of the session, until the worker
+// catches up with the subscriber.
+type fanOut struct {
+	server   *server
+	queueLen int
+	stopc    chan struct{}
+
+	mu     sync.Mutex
+	queues []*fanOutQueue
+	// queued is the total number of the waiting and delivering publishes.
+	queued int
+	// pending is the number of the waiting and delivering publishes of each subscriber.
+	pending map[*client]int
+	// overflowed is the subscribers whose messages are queued in their sessions, see overflow.
+	overflowed map[*client]bool
+	// running is the number of the waiting functions of each client. The publishes of the client do not overflow
+	// before the functions are run, since the functions may deliver the messages queued in the session.
+	running map[*client]int
+	stopped bool
+}
+
+// newFanOut returns the fan-out worker pool, nil if Config.FanOutWorkers is 0.
+func newFanOut(srv *server) *fanOut {
+	n := srv.config.FanOutWorkers
+	if n <= 0 {
+		return nil
+	}
+	queueLen := srv.config.FanOutQueueLen
+	if queueLen <= 0 {
+		queueLen = DefaultFanOutQueueLen
+	}
+	f := &fanOut{
+		server:     srv,
+		queueLen:   queueLen,
+		stopc:      make(chan struct{}),
+		queues:     make([]*fanOutQueue, n),
+		pending:    make(map[*client]int),
+		overflowed: make(map[*client]bool),
+		running:    make(map[*client]int),
+	}
+	for i := range f.queues {
+		f.queues[i] = &fanOutQueue{jobs: list.New(), notify: make(chan struct{}, 1)}
+	}
+	return f
+}
+
+// start starts the workers, which exit once the pool is stopped.
+func (f *fanOut) start() {
+	for _, q := range f.queues {
+		go f.work(q)
+	}
+}
+
+// queueOf returns the queue of the client id, it must be called with f.mu held.
+func (f *fanOut) queueOf(clientID string) *fanOutQueue {
+	h := fnv.New32a()
+	h.Write([]byte(clientID))
+	return f.queues[h.Sum32()%uint32(len(f.queues))]
+}
+
+// push adds the job to the queue of its client, it must be called with f.mu held.
+func (f *fanOut) push(job *fanOutJob) {
+	q := f.queueOf(job.client.opts.clientID)
+	q.jobs.PushBack(job)
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+}
+
+// dispatch queues the jobs for the workers. If the subscriber of a publish has too many messages waiting,
+// or the pool is stopped, the publish is queued in the session of the subscriber instead.
+func (f *fanOut) dispatch(jobs []*fanOutJob) {
+	srv := f.server
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	now := time.Now()
+	for _, job := range jobs {
+		c := job.client
+		if !f.stopped && !f.overflowed[c] && f.pending[c] >= f.queueLen && f.running[c] == 0 {
+			f.overflow(c)
+		}
+		if f.stopped || f.overflowed[c] {
+			// the session queue is filled under f.mu, so the order is kept with the waiting messages.
+			srv.statsManager.dispatchOverflowed()
+			c.msgEnQueue(job.publish)
+			continue
+		}
+		job.queuedAt = now
+		f.queued++
+		f.pending[c]++
+		srv.statsManager.dispatchEnqueue()
+		f.push(job)
+	}
+}
+
+// overflow moves the waiting messages of the subscriber to its session queue, the following messages are
+// queued in the session too until the catch-up job of the subscriber delivers the session queue.
+// It must be called with f.mu held.
+func (f *fanOut) overflow(c *client) {
+	srv := f.server
+	f.overflowed[c] = true
+	q := f.queueOf(c.opts.clientID)
+	for e := q.jobs.Front(); e != nil; {
+		next := e.Next()
+		if job := e.Value.(*fanOutJob); job.client == c && job.fn == nil {
+			q.jobs.Remove(e)
+			f.queued--
+			f.pending[c]--
+			srv.statsManager.dispatchDequeue()
+			srv.statsManager.dispatchOverflowed()
+			c.msgEnQueue(job.publish)
+		}
+		e = next
+	}
+	if f.pending[c] <= 0 {
+		delete(f.pending, c)
+	}
+	f.running[c]++
+	f.push(&fanOutJob{client: c, fn: func(stopped bool) {
+		if stopped {
+			return
+		}
+		f.mu.Lock()
+		delete(f.overflowed, c)
+		f.mu.Unlock()
+		c.flushQueued()
+	}})
+}
+
+// run queues the function to be run after the messages which are waiting for the client id,
+// it is run immediately if the pool is stopped.
+func (f *fanOut) run(c *client, fn func(stopped bool)) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.stopped {
+		fn(true)
+		return
+	}
+	f.running[c]++
+	f.push(&fanOutJob{client: c, fn: fn})
+}
+
+// len returns the number of the publishes which are waiting or being delivered.
+func (f *fanOut) len() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.queued
+}
+
+// stop stops the workers, the waiting publishes are queued in the sessions of the subscribers in order,
+// so they are persisted with the sessions. The publishes being delivered are not waited for.
+func (f *fanOut) stop() {
+	srv := f.server
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.stopped {
+		return
+	}
+	f.stopped = true
+	close(f.stopc)
+	for _, q := range f.queues {
+		for e := q.jobs.Front(); e != nil; e = e.Next() {
+			job := e.Value.(*fanOutJob)
+			if job.fn != nil {
+				job.fn(true)
+				continue
+			}
+			srv.statsManager.dispatchDequeue()
+			job.client.msgEnQueue(job.publish)
+		}
+		q.jobs.Init()
+	}
+}
+
+// next returns the next job of the queue, false if the pool is stopped.
+func (f *fanOut) next(q *fanOutQueue) (*fanOutJob, bool) {
+	for {
+		f.mu.Lock()
+		if f.stopped {
+			f.mu.Unlock()
+			return nil, false
+		}
+		if e := q.jobs.Front(); e != nil {
+			q.jobs.Remove(e)
+			f.mu.Unlock()
+			return e.Value.(*fanOutJob), true
+		}
+		f.mu.Unlock()
+		select {
+		case <-f.stopc:
+		case <-q.notify:
+		}
+	}
+}
+
+// done marks the publish of the client delivered.
+func (f *fanOut) done(c *client) {
+	f.mu.Lock()
+	f.queued--
+	if f.pending[c]--; f.pending[c] <= 0 {
+		delete(f.pending, c)
+	}
+	f.mu.Unlock()
+}
+
+// deliver delivers the publish of the job. The publish to an offline client is queued in its session under f.mu,
+// so the order is kept with the messages queued by dispatch.
+func (f *fanOut) deliver(job *fanOutJob) {
+	c := job.client
+	if !c.IsConnected() {
+		f.mu.Lock()
+		c.publish(job.ctx, job.publish, job.delivery)
+		f.mu.Unlock()
+	} else {
+		c.publish(job.ctx, job.publish, job.delivery)
+	}
+	f.done(c)
+}
+
+func (f *fanOut) work(q *fanOutQueue) {
+	srv := f.server
+	for {
+		job, ok := f.next(q)
+		if !ok {
+			return
+		}
+		if job.fn != nil {
+			job.fn(false)
+			f.mu.Lock()
+			if f.running[job.client]--; f.running[job.client] <= 0 {
+				delete(f.running, job.client)
+			}
+			f.mu.Unlock()
+			continue
+		}
+		srv.statsManager.dispatchDequeue()
+		srv.statsManager.dispatched(time.Since(job.queuedAt))
+		f.deliver(job)
+	}
+}
+
+// flushQueued delivers the queued messages of the online client until its inflight window is full,
+// the rest are delivered as the inflight messages are acknowledged.
+func (client *client) flushQueued() {
+	s := client.session
+	for client.IsConnected() {
+		s.inflightMu.Lock()
+		full := s.config.MaxInflight != 0 && s.inflight.Len() >= s.config.MaxInflight
+		s.inflightMu.Unlock()
+		if full {
+			return
+		}
+		publish := client.msgDequeue()
+		if publish == nil {
+			return
+		}
+		client.onlinePublish(context.Background(), publish, nil)
+	}
+}
+
+// resumeQueued delivers the messages queued in the old session to the client which resumes the session,
+// it is run by the fan-out worker of the client after the messages which are still waiting for the old client,
+// so the queued messages are not overtaken by the messages routed later. Config.DeliveryOrder does not apply.
+// If the pool is stopped, the messages are moved to the queue of the client instead of being sent.
+func (srv *server) resumeQueued(client *client, old *session, stopped bool) {
+	old.msgQueueMu.Lock()
+	defer old.msgQueueMu.Unlock()
+	for e := old.msgQueue.Front(); e != nil; e = e.Next() {
+		if publish, ok := e.Value.(*packets.Publish); ok {
+			client.statsManager.messageDequeue(1)
+			if stopped {
+				client.msgEnQueue(publish)
+			} else {
+				client.onlinePublish(context.Background(), publish, nil)
+			}
+		}
+	}
+}
@@ -0,0 +1,228 @@
+package gmqtt
+
+import (
+	"bytes"
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/DrmagicE/gmqtt/pkg/packets"
+)
+
+func TestServer_FanOutWorkers(t *testing.T) {
+	a := assert.New(t)
+	config := DefaultConfig
+	config.FanOutWorkers = 4
+	config.FanOutQueueLen = 2
+	srv := NewServer(WithConfig(config))
+	srv.tcpListener = append(srv.tcpListener, &testListener{acceptReady: make(chan struct{})})
+	defer srv.Stop(context.Background())
+	srv.Run()
+
+	var subscribers []*rwTestConn
+	for _, id := range []string{"sub1", "sub2", "sub3"} {
+		connect := defaultConnectPacket()
+		connect.ClientID = []byte(id)
+		c := connectTestClient(srv, connect)
+		a.NoError(writePacket(c, &packets.Subscribe{PacketID: 1, Topics: []packets.Topic{{Name: "a/#", Qos: packets.QOS_0}}}))
+		_, err := readPacketWithTimeOut(c, time.Second)
+		a.NoError(err)
+		subscribers = append(subscribers, c)
+	}
+	pub := connectTestClient(srv, defaultConnectPacket())
+	n := 50
+	for i := 0; i < n; i++ {
+		a.NoError(writePacket(pub, &packets.Publish{
+			Qos:       packets.QOS_0,
+			TopicName: []byte("a/" + strconv.Itoa(i%2)),
+			Payload:   []byte(strconv.Itoa(i)),
+		}))
+	}
+	// the messages of the publisher are delivered to each subscriber in order.
+	for _, c := range subscribers {
+		for i := 0; i < n; i++ {
+			p, err := readPacketWithTimeOut(c, time.Second)
+			if !a.NoError(err) {
+				return
+			}
+			a.Equal(strconv.Itoa(i), string(p.(*packets.Publish).Payload))
+		}
+	}
+	st := srv.GetStatsManager().GetStats().DispatchStats
+	// the deliveries beyond the fan-out queues are queued in the sessions.
+	a.EqualValues(3*n, st.DispatchedTotal+st.OverflowedTotal)
+	a.EqualValues(0, st.QueuedCurrent)
+}
+
+// readPublishes reads n publishes from the connection, the qos 1 publishes are acknowledged.
+func readPublishes(c *rwTestConn, n int) ([]string, error) {
+	var payloads []string
+	for len(payloads) < n {
+		select {
+		case b := <-c.writeChan:
+			r := packets.NewReader(bytes.NewBuffer(b))
+			for {
+				p, err := r.ReadPacket()
+				if err != nil {
+					break
+				}
+				if pub, ok := p.(*packets.Publish); ok {
+					payloads = append(payloads, string(pub.Payload))
+					if pub.Qos == packets.QOS_1 {
+						writePacket(c, pub.NewPuback())
+					}
+				}
+			}
+		case <-time.After(2 * time.Second):
+			return payloads, errTestReadTimeout
+		}
+	}
+	return payloads, nil
+}
+
+func sequence(from, to int) []string {
+	var s []string
+	for i := from; i < to; i++ {
+		s = append(s, strconv.Itoa(i))
+	}
+	return s
+}
+
+func TestServer_FanOutSlowSubscriber(t *testing.T) {
+	a := assert.New(t)
+	config := DefaultConfig
+	config.FanOutWorkers = 1
+	config.FanOutQueueLen = 2
+	srv := NewServer(WithConfig(config))
+	ln := &testListener{acceptReady: make(chan struct{})}
+	srv.tcpListener = append(srv.tcpListener, ln)
+	defer srv.Stop(context.Background())
+	srv.Run()
+
+	// the subscriber does not read until all messages are published.
+	slow := &rwTestConn{
+		closec:    make(chan struct{}),
+		readChan:  make(chan []byte, 1024),
+		writeChan: make(chan []byte),
+	}
+	connect := defaultConnectPacket()
+	connect.ClientID = []byte("slow")
+	ln.conn.PushBack(slow)
+	ln.acceptReady <- struct{}{}
+	a.NoError(writePacket(slow, connect))
+	_, err := readPacketWithTimeOut(slow, time.Second)
+	a.NoError(err)
+	a.NoError(writePacket(slow, &packets.Subscribe{PacketID: 1, Topics: []packets.Topic{{Name: "a/#", Qos: packets.QOS_1}}}))
+	_, err = readPacketWithTimeOut(slow, time.Second)
+	a.NoError(err)
+
+	pub := connectTestClient(srv, defaultConnectPacket())
+	n := 200
+	for i := 0; i < n; i++ {
+		a.NoError(writePacket(pub, &packets.Publish{
+			Qos:       packets.QOS_0,
+			TopicName: []byte("a/b"),
+			Payload:   []byte(strconv.Itoa(i)),
+		}))
+	}
+	// the event loop is not blocked by the slow subscriber.
+	connected := make(chan struct{})
+	go func() {
+		c := defaultConnectPacket()
+		c.ClientID = []byte("other")
+		connectTestClient(srv, c)
+		close(connected)
+	}()
+	select {
+	case <-connected:
+	case <-time.After(time.Second):
+		t.Fatal("connecting is blocked by the slow subscriber")
+	}
+	// the messages beyond the fan-out queue are queued in the session and delivered in order.
+	payloads, err := readPublishes(slow, n)
+	a.NoError(err)
+	a.Equal(sequence(0, n), payloads)
+	a.Eventually(func() bool {
+		return srv.fanOut.len() == 0
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestServer_FanOutResume(t *testing.T) {
+	a := assert.New(t)
+	config := DefaultConfig
+	config.FanOutWorkers = 1
+	config.FanOutQueueLen = 4
+	srv := NewServer(WithConfig(config))
+	srv.tcpListener = append(srv.tcpListener, &testListener{acceptReady: make(chan struct{})})
+	defer srv.Stop(context.Background())
+	srv.Run()
+
+	connect := defaultConnectPacket()
+	connect.ClientID = []byte("sub")
+	connect.CleanSession = false
+	connect.WillFlag = false
+	connect.WillQos = packets.QOS_0
+	connect.WillTopic = nil
+	connect.WillMsg = nil
+	sub := connectTestClient(srv, connect)
+	a.NoError(writePacket(sub, &packets.Subscribe{PacketID: 1, Topics: []packets.Topic{{Name: "a/#", Qos: packets.QOS_1}}}))
+	_, err := readPacketWithTimeOut(sub, time.Second)
+	a.NoError(err)
+	a.NoError(writePacket(sub, &packets.Disconnect{}))
+	a.Eventually(func() bool {
+		c := srv.Client("sub")
+		return c != nil && !c.IsConnected()
+	}, time.Second, 10*time.Millisecond)
+
+	pub := connectTestClient(srv, defaultConnectPacket())
+	n := 100
+	publish := func(from, to int) {
+		for i := from; i < to; i++ {
+			writePacket(pub, &packets.Publish{
+				Qos:       packets.QOS_1,
+				PacketID:  packets.PacketID(i + 1),
+				TopicName: []byte("a/b"),
+				Payload:   []byte(strconv.Itoa(i)),
+			})
+		}
+	}
+	publish(0, n)
+	// the session is resumed while the messages are still being routed, the queued messages
+	// are not overtaken by the newer ones.
+	done := make(chan struct{})
+	go func() {
+		publish(n, 2*n)
+		close(done)
+	}()
+	sub = connectTestClient(srv, connect)
+	<-done
+	payloads, err := readPublishes(sub, 2*n)
+	a.NoError(err)
+	a.Equal(sequence(0, 2*n), payloads)
+}
+
+func TestServer_FanOutStop(t *testing.T) {
+	a := assert.New(t)
+	config := DefaultConfig
+	config.FanOutWorkers = 1
+	srv := NewServer(WithConfig(config))
+	srv.tcpListener = append(srv.tcpListener, &testListener{acceptReady: make(chan struct{})})
+	srv.Run()
+	connect := defaultConnectPacket()
+	connect.ClientID = []byte("sub")
+	sub := connectTestClient(srv, connect)
+	a.NoError(writePacket(sub, &packets.Subscribe{PacketID: 1, Topics: []packets.Topic{{Name: "a/#", Qos: packets.QOS_1}}}))
+	_, err := readPacketWithTimeOut(sub, time.Second)
+	a.NoError(err)
+	c := srv.Client("sub").(*client)
+
+	// the waiting messages are queued in the session once the pool is stopped.
+	srv.fanOut.stop()
+	srv.fanOut.dispatch([]*fanOutJob{{client: c, publish: &packets.Publish{Qos: packets.QOS_1, TopicName: []byte("a/b")}}})
+	a.Equal(0, srv.fanOut.len())
+	a.Equal(1, c.session.msgQueue.Len())
+	a.NoError(srv.Stop(context.Background()))
+}
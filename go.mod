@@ -3,11 +3,27 @@ module github.com/DrmagicE/gmqtt
 go 1.12
 
 require (
+	github.com/alicebob/miniredis/v2 v2.11.4
+	github.com/fsnotify/fsnotify v1.4.7
 	github.com/gin-gonic/gin v1.5.0
+	github.com/golang/protobuf v1.3.2
+	github.com/gomodule/redigo v1.7.1-0.20190322064113-39e2c31b7ca3
 	github.com/gorilla/websocket v1.4.1
+	github.com/hashicorp/memberlist v0.2.2
 	github.com/modern-go/concurrent v0.0.0-20180306012644-bacd9c7ef1dd // indirect
 	github.com/modern-go/reflect2 v1.0.1 // indirect
+	github.com/nats-io/nats.go v1.9.2
 	github.com/prometheus/client_golang v1.4.0
-	github.com/stretchr/testify v1.4.0
+	github.com/prometheus/client_model v0.2.0
+	github.com/segmentio/kafka-go v0.3.10
+	github.com/stretchr/testify v1.8.4
+	go.etcd.io/bbolt v1.3.5
+	go.opentelemetry.io/otel v1.24.0
+	go.opentelemetry.io/otel/metric v1.24.0
+	go.opentelemetry.io/otel/sdk v1.24.0
+	go.opentelemetry.io/otel/trace v1.24.0
 	go.uber.org/zap v1.13.0
+	golang.org/x/crypto v0.0.0-20200323165209-0ec3e9974c59
+	google.golang.org/grpc v1.27.0
+	gopkg.in/yaml.v2 v2.2.5
 )
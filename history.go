@@ -0,0 +1,116 @@
+package gmqtt
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/DrmagicE/gmqtt/pkg/packets"
+)
+
+// historyTopicPrefix is the topic filter prefix of the history subscriptions: $history/<n>/<topic filter>.
+// The client subscribing to it subscribes the topic filter, and receives the last n messages of each matched topic
+// instead of the retained messages.
+const historyTopicPrefix = "$history/"
+
+// HistoryService provides the recent messages of the topics, see Config.MaxTopicHistory.
+type HistoryService interface {
+	// Messages returns at most n latest messages of each topic matched by the topic filter,
+	// the messages of a topic are ordered from the oldest to the newest. n <= 0 means all kept messages.
+	Messages(topicFilter string, n int) []packets.Message
+}
+
+// parseHistoryFilter returns the number of the requested messages and the topic filter of the history subscription.
+// ok is false if the topic filter is not a valid history subscription.
+func parseHistoryFilter(topicFilter string) (n int, target string, ok bool) {
+	rest := strings.TrimPrefix(topicFilter, historyTopicPrefix)
+	i := strings.IndexByte(rest, '/')
+	if i == -1 {
+		return 0, "", false
+	}
+	v, err := strconv.ParseUint(rest[:i], 10, 31)
+	if err != nil || v == 0 {
+		return 0, "", false
+	}
+	target = rest[i+1:]
+	if !packets.ValidTopicFilter([]byte(target)) || strings.HasPrefix(target, historyTopicPrefix) {
+		return 0, "", false
+	}
+	return int(v), target, true
+}
+
+type topicHistory struct {
+	msgs []packets.Message
+	// bytes is the total payload size of msgs.
+	bytes int
+}
+
+// historyService keeps the last Config.MaxTopicHistory messages of each topic. The $SYS topics are not kept.
+type historyService struct {
+	server *server
+	mu     sync.RWMutex
+	topics map[string]*topicHistory
+}
+
+func newHistoryService(srv *server) *historyService {
+	return &historyService{
+		server: srv,
+		topics: make(map[string]*topicHistory),
+	}
+}
+
+// HistoryService returns the HistoryService
+func (srv *server) HistoryService() HistoryService {
+	return srv.historyService
+}
+
+// record keeps the message published to the topic, the oldest messages beyond the limits are dropped.
+func (h *historyService) record(msg packets.Message) {
+	config := h.server.config
+	if config.MaxTopicHistory <= 0 || strings.HasPrefix(msg.Topic(), "$") {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	th, ok := h.topics[msg.Topic()]
+	if !ok {
+		if config.MaxHistoryTopics > 0 && len(h.topics) >= config.MaxHistoryTopics {
+			return
+		}
+		th = &topicHistory{}
+		h.topics[msg.Topic()] = th
+	}
+	th.msgs = append(th.msgs, msg)
+	th.bytes += len(msg.Payload())
+	for len(th.msgs) > config.MaxTopicHistory ||
+		(config.MaxTopicHistoryBytes > 0 && th.bytes > config.MaxTopicHistoryBytes && len(th.msgs) > 0) {
+		th.bytes -= len(th.msgs[0].Payload())
+		th.msgs[0] = nil
+		th.msgs = th.msgs[1:]
+	}
+	if len(th.msgs) == 0 {
+		delete(h.topics, msg.Topic())
+	}
+}
+
+func (h *historyService) Messages(topicFilter string, n int) []packets.Message {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	var topics []string
+	for topic := range h.topics {
+		if packets.TopicMatch([]byte(topic), []byte(topicFilter)) {
+			topics = append(topics, topic)
+		}
+	}
+	sort.Strings(topics)
+	var rs []packets.Message
+	for _, topic := range topics {
+		msgs := h.topics[topic].msgs
+		if n > 0 && n < len(msgs) {
+			msgs = msgs[len(msgs)-n:]
+		}
+		rs = append(rs, msgs...)
+	}
+	return rs
+}
@@ -0,0 +1,84 @@
+package gmqtt
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/DrmagicE/gmqtt/pkg/packets"
+)
+
+func TestParseHistoryFilter(t *testing.T) {
+	a := assert.New(t)
+	n, filter, ok := parseHistoryFilter("$history/10/a/#")
+	a.True(ok)
+	a.Equal(10, n)
+	a.Equal("a/#", filter)
+	for _, v := range []string{"$history/a", "$history/0/a", "$history/x/a", "$history/1/a/#/b", "$history/1/$history/1/a"} {
+		_, _, ok = parseHistoryFilter(v)
+		a.False(ok, v)
+	}
+}
+
+func TestHistoryService(t *testing.T) {
+	a := assert.New(t)
+	srv := &server{config: DefaultConfig}
+	srv.config.MaxTopicHistory = 3
+	srv.config.MaxTopicHistoryBytes = 5
+	srv.config.MaxHistoryTopics = 2
+	h := newHistoryService(srv)
+	for _, v := range []string{"1", "2", "3", "4"} {
+		h.record(NewMessage("a/1", []byte(v), packets.QOS_0))
+	}
+	h.record(NewMessage("a/2", []byte("1234"), packets.QOS_0))
+	h.record(NewMessage("a/2", []byte("56"), packets.QOS_0))
+	// the topics beyond the limit and the $SYS topics are not kept.
+	h.record(NewMessage("a/3", []byte("1"), packets.QOS_0))
+	h.record(NewMessage(SysTopicVersion, []byte("1"), packets.QOS_0))
+
+	payloads := func(msgs []packets.Message) (rs []string) {
+		for _, v := range msgs {
+			rs = append(rs, string(v.Payload()))
+		}
+		return rs
+	}
+	a.Equal([]string{"2", "3", "4", "56"}, payloads(h.Messages("a/+", 0)))
+	a.Equal([]string{"4", "56"}, payloads(h.Messages("#", 1)))
+	a.Nil(h.Messages("a/3", 0))
+}
+
+func TestServer_HistorySubscription(t *testing.T) {
+	a := assert.New(t)
+	config := DefaultConfig
+	config.MaxTopicHistory = 10
+	srv := NewServer(WithConfig(config))
+	srv.tcpListener = append(srv.tcpListener, &testListener{acceptReady: make(chan struct{})})
+	srv.Run()
+	defer srv.Stop(context.Background())
+
+	for _, v := range []string{"1", "2", "3"} {
+		srv.PublishService().Publish(NewMessage("a/b", []byte(v), packets.QOS_0))
+	}
+	a.Eventually(func() bool {
+		return len(srv.HistoryService().Messages("a/b", 0)) == 3
+	}, time.Second, 10*time.Millisecond)
+
+	conn := connectTestClient(srv, defaultConnectPacket())
+	a.NoError(writePacket(conn, &packets.Subscribe{PacketID: 1, Topics: []packets.Topic{
+		{Name: "$history/2/a/+", Qos: packets.QOS_1},
+		{Name: "$history/x/a/+", Qos: packets.QOS_1},
+	}}))
+	p, err := readPacketWithTimeOut(conn, time.Second)
+	a.NoError(err)
+	a.Equal([]byte{packets.QOS_1, packets.SUBSCRIBE_FAILURE}, p.(*packets.Suback).Payload)
+	for _, v := range []string{"2", "3"} {
+		p, err = readPacketWithTimeOut(conn, time.Second)
+		if a.NoError(err) {
+			a.Equal(v, string(p.(*packets.Publish).Payload))
+		}
+	}
+	a.Len(srv.subscriptionsDB.GetClientSubscriptions("MQTT"), 1)
+	a.Equal("a/+", srv.subscriptionsDB.GetClientSubscriptions("MQTT")[0].Name)
+}
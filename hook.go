@@ -2,7 +2,9 @@ package gmqtt
 
 import (
 	"context"
+	"crypto/x509"
 	"net"
+	"time"
 
 	"github.com/DrmagicE/gmqtt/pkg/packets"
 )
@@ -20,10 +22,25 @@ type Hooks struct {
 	OnSessionCreated
 	OnSessionResumed
 	OnSessionTerminated
+	OnSessionExpired
 	OnDeliver
 	OnAcked
 	OnClose
 	OnMsgDropped
+	OnCertIdentity
+	OnRateLimit
+	OnOverload
+	OnBanned
+	OnUnbanned
+	OnTopicRewrite
+	OnSessionTakeover
+	OnSessionTakenOver
+	OnDelivered
+	OnSubscribeRewrite
+	OnWillPublish
+	OnWillPublished
+	OnDeliverRewrite
+	OnCredentialExpiry
 }
 
 // OnAccept 会在新连接建立的时候调用，只在TCP server中有效。如果返回false，则会直接关闭连接
@@ -51,6 +68,17 @@ type OnSubscribe func(ctx context.Context, client Client, topic packets.Topic) (
 
 type OnSubscribeWrapper func(OnSubscribe) OnSubscribe
 
+// OnSubscribeRewrite 在OnSubscribe之前调用, 可以重写订阅的topic, 降低QoS或者强制设置订阅选项
+//
+// OnSubscribeRewrite will be called for each subscription of the SUBSCRIBE packet after OnTopicRewrite and before OnSubscribe.
+// It can rewrite the topic filter, downgrade or reject the QoS and force the NoLocal and RetainHandling options,
+// see SubscribeRequest. The QoS can not be upgraded, and the subscription with the invalid rewritten topic filter is rejected.
+// OnSubscribe authorizes the modified subscription, and the SUBACK carries the granted QoS of it.
+// The client can unsubscribe the rewritten subscription by the topic filter in the SUBSCRIBE packet.
+type OnSubscribeRewrite func(ctx context.Context, client Client, req *SubscribeRequest)
+
+type OnSubscribeRewriteWrapper func(OnSubscribeRewrite) OnSubscribeRewrite
+
 // OnSubscribed will be called after the topic subscribe successfully
 type OnSubscribed func(ctx context.Context, client Client, topic packets.Topic)
 
@@ -81,10 +109,14 @@ type OnClose func(ctx context.Context, client Client, err error)
 
 type OnCloseWrapper func(OnClose) OnClose
 
-// OnConnect 当合法的connect报文到达的时候触发，返回connack中响应码
+// OnConnect 当合法的connect报文到达的时候触发，返回connack中响应码。
+// OnConnect 在各客户端自己的goroutine中被并发调用，实现必须是并发安全的。
 //
 // OnConnect will be called when a valid connect packet is received.
-// It returns the code of the connack packet
+// It returns the code of the connack packet.
+// OnConnect is called in the goroutine of the connecting client rather than the server event loop,
+// so it can be called concurrently for different clients and must be safe for concurrent use.
+// The number of the concurrent calls can be limited by Config.MaxConcurrentAuth.
 type OnConnect func(ctx context.Context, client Client) (code uint8)
 
 type OnConnectWrapper func(OnConnect) OnConnect
@@ -125,6 +157,12 @@ type OnSessionTerminated func(ctx context.Context, client Client, reason Session
 
 type OnSessionTerminatedWrapper func(OnSessionTerminated) OnSessionTerminated
 
+// OnSessionExpired will be called when the offline session expires, before OnSessionTerminated is called
+// with ExpiredTermination.
+type OnSessionExpired func(ctx context.Context, client Client)
+
+type OnSessionExpiredWrapper func(OnSessionExpired) OnSessionExpired
+
 // OnDeliver 分发消息时触发
 //
 //  OnDeliver will be called when publishing a message to a client.
@@ -132,16 +170,191 @@ type OnDeliver func(ctx context.Context, client Client, msg packets.Message)
 
 type OnDeliverWrapper func(OnDeliver) OnDeliver
 
+// Delivery is the delivery of a message to a subscriber, see OnDelivered and OnAcked.
+type Delivery struct {
+	// Message is the original message published by the publisher.
+	// For the messages restored from the message queue or the inflight queue, it is the copy sent to the subscriber.
+	Message packets.Message
+	// Subscription is the subscription of the subscriber which matches the message.
+	// For the messages sent to the specified client, such as the retained messages and the messages published by
+	// PublishService.PublishToClient without matching, the name of the subscription is the topic name of the message.
+	Subscription packets.Topic
+	// Qos and PacketID are the QoS level and the packet id of the PUBLISH packet sent to the subscriber.
+	Qos      uint8
+	PacketID packets.PacketID
+}
+
+// OnDelivered 消息写入订阅者连接之后触发
+//
+// OnDelivered will be called after the message has been written to the connection of the subscriber,
+// unlike OnDeliver, which is called when the message is put into the write queue of the subscriber.
+type OnDelivered func(ctx context.Context, client Client, delivery *Delivery)
+
+type OnDeliveredWrapper func(OnDelivered) OnDelivered
+
 // OnAcked 当客户端对qos1或qos2返回确认的时候调用
 //
-// OnAcked  will be called when receiving the ack packet for a published qos1 or qos2 message.
-type OnAcked func(ctx context.Context, client Client, msg packets.Message)
+// OnAcked  will be called when receiving the ack packet for a published qos1 or qos2 message,
+// that is the PUBACK for QoS 1 and the PUBREC for QoS 2.
+type OnAcked func(ctx context.Context, client Client, delivery *Delivery)
 
 type OnAckedWrapper func(OnAcked) OnAcked
 
+// MsgDroppedReason is the reason why a message is dropped.
+type MsgDroppedReason byte
+
+const (
+	// DroppedQueueFull means the message is dropped because the message queue reaches the length limit.
+	DroppedQueueFull MsgDroppedReason = iota
+	// DroppedQueueBytesFull means the message is dropped because the message queue reaches the bytes limit.
+	DroppedQueueBytesFull
+	// DroppedExpired means the message is dropped because it has been queued longer than Config.MessageExpiry.
+	DroppedExpired
+	// DroppedOverload means the qos0 message is dropped because the server is overloaded, see Config.OverloadActions.
+	DroppedOverload
+)
+
+func (r MsgDroppedReason) String() string {
+	switch r {
+	case DroppedQueueFull:
+		return "queue_full"
+	case DroppedQueueBytesFull:
+		return "queue_bytes_full"
+	case DroppedExpired:
+		return "expired"
+	case DroppedOverload:
+		return "overload"
+	default:
+		return "unknown"
+	}
+}
+
 // OnMessageDropped 丢弃报文后触发
 //
 // OnMsgDropped will be called after the msg dropped
-type OnMsgDropped func(ctx context.Context, client Client, msg packets.Message)
+type OnMsgDropped func(ctx context.Context, client Client, msg packets.Message, reason MsgDroppedReason)
 
 type OnMsgDroppedWrapper func(OnMsgDropped) OnMsgDropped
+
+// OnCertIdentity 返回客户端证书的身份标识
+//
+// OnCertIdentity returns the identities of the certificate chain presented by the client over TLS,
+// which are used as or validated against the client id or username according to Config.CertIdentity.
+// The chain is empty if the client presents no certificate. Default to DefaultCertIdentity.
+type OnCertIdentity func(ctx context.Context, client Client, chain []*x509.Certificate) (identities []string)
+
+type OnCertIdentityWrapper func(OnCertIdentity) OnCertIdentity
+
+// OnRateLimit 返回客户端的发布速率限制
+//
+// OnRateLimit returns the publish rate limit of the client, it is called once the client has connected.
+// Default to the limit in Config (MaxPublishRate, MaxPublishBytesRate and PublishRateLimitPolicy).
+type OnRateLimit func(ctx context.Context, client Client) (limit RateLimit)
+
+type OnRateLimitWrapper func(OnRateLimit) OnRateLimit
+
+// OnOverload 服务端过载状态变化时触发
+//
+// OnOverload will be called when the server enters or leaves the overloaded state, see Config.OverloadActions.
+type OnOverload func(ctx context.Context, status OverloadStatus)
+
+type OnOverloadWrapper func(OnOverload) OnOverload
+
+// OnBanned 添加封禁后触发
+//
+// OnBanned will be called after a client id or IP address is banned, see BanService.
+type OnBanned func(ctx context.Context, ban Ban)
+
+type OnBannedWrapper func(OnBanned) OnBanned
+
+// OnUnbanned 解除封禁后触发
+//
+// OnUnbanned will be called after a ban is removed or expired.
+type OnUnbanned func(ctx context.Context, ban Ban)
+
+type OnUnbannedWrapper func(OnUnbanned) OnUnbanned
+
+// TopicRewriteAction is the request which the topic being rewritten belongs to.
+type TopicRewriteAction byte
+
+const (
+	// RewritePublish is the topic name of the publish.
+	RewritePublish TopicRewriteAction = iota
+	// RewriteSubscribe is the topic filter of the subscribe or unsubscribe.
+	RewriteSubscribe
+)
+
+func (a TopicRewriteAction) String() string {
+	switch a {
+	case RewritePublish:
+		return "publish"
+	case RewriteSubscribe:
+		return "subscribe"
+	default:
+		return "unknown"
+	}
+}
+
+// OnTopicRewrite 返回重写后的topic, 在OnMsgArrived, OnSubscribe和OnUnsubscribe之前调用
+//
+// OnTopicRewrite returns the rewritten topic name of the publish or the rewritten topic filter of the subscribe
+// and unsubscribe. It is called before OnMsgArrived, OnSubscribe and OnUnsubscribe, so the ACL checks are applied
+// to the rewritten topic. The publish is dropped and the subscription is rejected if the rewritten topic is invalid.
+type OnTopicRewrite func(ctx context.Context, client Client, action TopicRewriteAction, topic string) string
+
+type OnTopicRewriteWrapper func(OnTopicRewrite) OnTopicRewrite
+
+// OnSessionTakeover 当客户端使用在线客户端的client id连接时, 在关闭旧连接之前调用, 返回false则拒绝新连接
+//
+// OnSessionTakeover will be called when a client connects with the client id of an online client,
+// before the old connection is closed. If returns false, the takeover is vetoed: the old connection is kept
+// and the new connection is rejected with CodeIdentifierRejected.
+type OnSessionTakeover func(ctx context.Context, oldClient Client, newClient Client) bool
+
+type OnSessionTakeoverWrapper func(OnSessionTakeover) OnSessionTakeover
+
+// OnSessionTakenOver 在线客户端被新连接接管后触发
+//
+// OnSessionTakenOver will be called after an online client has been taken over by a new connection with the same
+// client id. The old connection has been closed (MQTT v3.1.1 has no DISCONNECT from the server, so it is closed
+// without notice), and the session of the new connection has been created or resumed.
+// Plugins can migrate the state kept for the old connection here.
+type OnSessionTakenOver func(ctx context.Context, oldClient Client, newClient Client)
+
+type OnSessionTakenOverWrapper func(OnSessionTakenOver) OnSessionTakenOver
+
+// OnWillPublish 遗嘱消息发布之前调用, 返回修改后的遗嘱消息, 返回nil则不发布
+//
+// OnWillPublish will be called before publishing the will message of the client, including the delayed will message.
+// It returns the will message to publish, which can be modified by NewMessage, or nil to suppress the will message,
+// e.g. to avoid the will storms during the rolling restarts. The will message with an invalid topic name or QoS is dropped.
+type OnWillPublish func(ctx context.Context, client Client, msg packets.Message) packets.Message
+
+type OnWillPublishWrapper func(OnWillPublish) OnWillPublish
+
+// OnWillPublished 遗嘱消息发布之后调用
+//
+// OnWillPublished will be called after the will message of the client has been published.
+type OnWillPublished func(ctx context.Context, client Client, msg packets.Message)
+
+type OnWillPublishedWrapper func(OnWillPublished) OnWillPublished
+
+// OnDeliverRewrite 返回投递给客户端的消息的topic, 在发送PUBLISH报文之前调用
+//
+// OnDeliverRewrite returns the topic name of the PUBLISH packet sent to the client. It is called before writing
+// each PUBLISH packet, including the retained, queued and redelivered messages, and is the reverse of OnTopicRewrite,
+// e.g. to strip the prefix added by OnTopicRewrite. The stored message is not modified,
+// and the original topic name is sent if the rewritten topic name is invalid.
+type OnDeliverRewrite func(ctx context.Context, client Client, topicName string) string
+
+type OnDeliverRewriteWrapper func(OnDeliverRewrite) OnDeliverRewrite
+
+// OnCredentialExpiry 在客户端凭证过期之前调用, 返回新的过期时间, 返回原过期时间则在过期时断开连接
+//
+// OnCredentialExpiry will be called Config.CredentialExpiryNotice before the credential of the client expires,
+// see Client.SetCredentialExpiry. It returns the new expiry: the client is disconnected at the returned expiry
+// if it is not changed, a different time reschedules the expiry and the zero time cancels it.
+// In MQTT v3.1.1, the connection is closed without DISCONNECT.
+type OnCredentialExpiry func(ctx context.Context, client Client, expiry time.Time) time.Time
+
+type OnCredentialExpiryWrapper func(OnCredentialExpiry) OnCredentialExpiry
@@ -0,0 +1,47 @@
+package gmqtt
+
+import (
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// idleLoop periodically closes the connections which are idle longer than Config.MaxIdleTime until the server exits.
+func (srv *server) idleLoop() {
+	interval := srv.config.IdleCheckInterval
+	if interval == 0 {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-srv.exitChan:
+			return
+		case now := <-ticker.C:
+			srv.mu.RLock()
+			clients := make([]*client, 0, len(srv.clients))
+			for _, c := range srv.clients {
+				if c.IsConnected() {
+					clients = append(clients, c)
+				}
+			}
+			srv.mu.RUnlock()
+			for _, c := range clients {
+				if idle := c.idleTime(now); idle > srv.config.MaxIdleTime {
+					clientLog().Info("idle connection closed", c.logFields(zap.Duration("idle", idle))...)
+					c.Close()
+				}
+			}
+		}
+	}
+}
+
+// idleTime returns the time since the last packet received from the client.
+func (client *client) idleTime(now time.Time) time.Duration {
+	if t := atomic.LoadInt64(&client.lastSeen); t != 0 {
+		return now.Sub(time.Unix(0, t))
+	}
+	return now.Sub(client.ConnectedAt())
+}
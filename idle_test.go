@@ -0,0 +1,59 @@
+package gmqtt
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/DrmagicE/gmqtt/pkg/packets"
+)
+
+func TestServer_MaxIdleTime(t *testing.T) {
+	a := assert.New(t)
+	config := DefaultConfig
+	config.MaxIdleTime = 300 * time.Millisecond
+	config.IdleCheckInterval = 20 * time.Millisecond
+	srv := NewServer(WithConfig(config))
+	srv.tcpListener = append(srv.tcpListener, &testListener{acceptReady: make(chan struct{})})
+	defer srv.Stop(context.Background())
+	srv.Run()
+
+	idle := defaultConnectPacket()
+	idle.KeepAlive = 0
+	connectTestClient(srv, idle)
+	active := defaultConnectPacket()
+	active.ClientID = []byte("active")
+	active.KeepAlive = 0
+	c := connectTestClient(srv, active)
+
+	deadline := time.Now().Add(600 * time.Millisecond)
+	for time.Now().Before(deadline) {
+		a.NoError(writePacket(c, &packets.Pingreq{}))
+		_, err := readPacketWithTimeOut(c, time.Second)
+		a.NoError(err)
+		time.Sleep(50 * time.Millisecond)
+	}
+	// the clean session of the idle client is removed after it is closed.
+	a.Nil(srv.Client("MQTT"))
+	a.True(srv.Client("active").IsConnected())
+}
+
+func TestServer_ServerKeepAlive(t *testing.T) {
+	a := assert.New(t)
+	config := DefaultConfig
+	config.ServerKeepAlive = 30
+	srv := NewServer(WithConfig(config))
+	srv.tcpListener = append(srv.tcpListener, &testListener{acceptReady: make(chan struct{})})
+	defer srv.Stop(context.Background())
+	srv.Run()
+
+	conn := defaultConnectPacket()
+	conn.KeepAlive = 0
+	connectTestClient(srv, conn)
+	cl := srv.Client("MQTT").(*client)
+	a.EqualValues(30, cl.getKeepAlive())
+	// the keep alive in the CONNECT packet is kept.
+	a.EqualValues(0, cl.OptionsReader().KeepAlive())
+}
@@ -0,0 +1,48 @@
+// Package testutil provides the fakes shared by the plugin tests.
+package testutil
+
+import (
+	"net"
+
+	"github.com/DrmagicE/gmqtt"
+)
+
+// ClientOptions is the fake gmqtt.ClientOptionsReader which returns the values of its fields.
+// The methods without a field are left to the embedded reader and panic if it is nil.
+type ClientOptions struct {
+	gmqtt.ClientOptionsReader
+	ID     string
+	User   string
+	Pass   string
+	Keep   uint16
+	Clean  bool
+	Local  net.Addr
+	Remote net.Addr
+	// Profile is the listener profile returned by ListenerProfile.
+	Profile *gmqtt.ListenerProfile
+}
+
+func (o *ClientOptions) ClientID() string     { return o.ID }
+func (o *ClientOptions) Username() string     { return o.User }
+func (o *ClientOptions) Password() string     { return o.Pass }
+func (o *ClientOptions) KeepAlive() uint16    { return o.Keep }
+func (o *ClientOptions) CleanSession() bool   { return o.Clean }
+func (o *ClientOptions) LocalAddr() net.Addr  { return o.Local }
+func (o *ClientOptions) RemoteAddr() net.Addr { return o.Remote }
+func (o *ClientOptions) ListenerProfile() *gmqtt.ListenerProfile {
+	return o.Profile
+}
+
+// Client is the fake gmqtt.Client which only implements OptionsReader,
+// embed it to override the other methods.
+type Client struct {
+	gmqtt.Client
+	Opts *ClientOptions
+}
+
+// NewClient returns the fake client with the given client id and username.
+func NewClient(clientID, username string) *Client {
+	return &Client{Opts: &ClientOptions{ID: clientID, User: username}}
+}
+
+func (c *Client) OptionsReader() gmqtt.ClientOptionsReader { return c.Opts }
@@ -0,0 +1,52 @@
+package gmqtt
+
+import (
+	"errors"
+	"net"
+	"os"
+	"strings"
+)
+
+const unixScheme = "unix://"
+
+var errAddrInUse = errors.New("address already in use")
+
+// DefaultUnixSocketMode is the file permission of the unix domain socket created by Listen.
+const DefaultUnixSocketMode os.FileMode = 0660
+
+// Listen announces on the address, which can be a tcp address such as ":1883" and "tcp://127.0.0.1:1883",
+// or a unix domain socket path with the "unix://" prefix, such as "unix:///var/run/gmqtt.sock".
+// The unix domain socket is created with DefaultUnixSocketMode, use ListenUnix to set another mode.
+//
+// The returned listener can be used with WithTCPListener and WsServer.Listener,
+// and the address is also accepted by the plugins which listen on an address, such as admin, management and prometheus.
+func Listen(address string) (net.Listener, error) {
+	if strings.HasPrefix(address, unixScheme) {
+		return ListenUnix(strings.TrimPrefix(address, unixScheme), DefaultUnixSocketMode)
+	}
+	return net.Listen("tcp", strings.TrimPrefix(address, "tcp://"))
+}
+
+// ListenUnix announces on the unix domain socket path and sets the file permission of the socket to mode.
+// The stale socket file left by the previous process is removed before listening,
+// the socket which is still accepted by another process is not.
+func ListenUnix(path string, mode os.FileMode) (net.Listener, error) {
+	if fi, err := os.Stat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		if c, err := net.Dial("unix", path); err == nil {
+			c.Close()
+			return nil, &net.OpError{Op: "listen", Net: "unix", Addr: &net.UnixAddr{Name: path, Net: "unix"}, Err: errAddrInUse}
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	return ln, nil
+}
@@ -0,0 +1,85 @@
+package gmqtt
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/DrmagicE/gmqtt/pkg/packets"
+)
+
+func TestListen(t *testing.T) {
+	a := assert.New(t)
+	dir, err := ioutil.TempDir("", "gmqtt")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "gmqtt.sock")
+
+	ln, err := Listen("unix://" + path)
+	a.NoError(err)
+	a.Equal("unix", ln.Addr().Network())
+	fi, err := os.Stat(path)
+	a.NoError(err)
+	a.Equal(DefaultUnixSocketMode, fi.Mode().Perm())
+
+	// the socket is in use.
+	_, err = ListenUnix(path, 0600)
+	a.Error(err)
+	ln.Close()
+
+	// the stale socket is removed.
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		stale, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+		a.NoError(err)
+		stale.SetUnlinkOnClose(false)
+		stale.Close()
+	}
+	ln, err = ListenUnix(path, 0600)
+	a.NoError(err)
+	fi, err = os.Stat(path)
+	a.NoError(err)
+	a.Equal(os.FileMode(0600), fi.Mode().Perm())
+	ln.Close()
+
+	ln, err = Listen("tcp://127.0.0.1:0")
+	a.NoError(err)
+	a.Equal("tcp", ln.Addr().Network())
+	ln.Close()
+}
+
+func TestUnixListener(t *testing.T) {
+	a := assert.New(t)
+	dir, err := ioutil.TempDir("", "gmqtt")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "gmqtt.sock")
+	ln, err := ListenUnix(path, 0600)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	srv := NewServer(WithTCPListener(ln))
+	defer srv.Stop(context.Background())
+	srv.Run()
+
+	c, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer c.Close()
+	packets.NewWriter(c).WriteAndFlush(defaultConnectPacket())
+	c.SetReadDeadline(time.Now().Add(time.Second))
+	p, err := packets.NewReader(c).ReadPacket()
+	a.NoError(err)
+	a.EqualValues(packets.CodeAccepted, p.(*packets.Connack).Code)
+	a.NotNil(srv.GetStatsManager().GetStats().ListenerStats["unix://"+path])
+}
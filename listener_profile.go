@@ -0,0 +1,95 @@
+package gmqtt
+
+import (
+	"net"
+
+	"github.com/DrmagicE/gmqtt/pkg/packets"
+)
+
+// ListenerProfile overrides the config for the clients connected to a listener, so that one server can expose
+// e.g: an internal trusted listener and a locked-down public listener at the same time.
+// See WithListenerProfile and WsServer.Profile.
+type ListenerProfile struct {
+	// ProtocolLevels is the allowed protocol levels, see packets.Version31 and packets.Version311.
+	// The clients of the other levels are rejected with CodeUnacceptableProtocolVersion.
+	// Empty means Config.AllowMQTT31 decides.
+	ProtocolLevels []byte
+	// AuthPlugins is the names of the plugins whose OnConnect hooks authenticate the clients, the OnConnect hooks
+	// of the other plugins are skipped. nil means all plugins, and an empty slice means none.
+	// The plugins which use the OnConnect hook for other purposes, such as the tenancy plugin, must be listed as well.
+	AuthPlugins []string
+	// MaxRemainLength overrides Config.MaxRemainLength if it is not 0.
+	MaxRemainLength int
+	// RateLimit overrides the publish rate limits in the config if it is not nil, the OnRateLimit hooks still apply.
+	RateLimit *RateLimit
+	// Tenant is the tenant of the clients, which is used by the tenancy plugin, see tenancy.ByListenerProfile.
+	Tenant string
+}
+
+// WithListenerProfile adds the tcp listeners whose clients use the profile.
+func WithListenerProfile(profile ListenerProfile, lns ...net.Listener) Options {
+	return func(srv *server) {
+		srv.tcpListener = append(srv.tcpListener, lns...)
+		for _, l := range lns {
+			srv.listenerProfiles[l] = &profile
+		}
+	}
+}
+
+// listenerProfile returns the profile of the tcp listener, nil if the listener has no profile.
+func (srv *server) listenerProfile(l net.Listener) *ListenerProfile {
+	srv.listenerMu.Lock()
+	defer srv.listenerMu.Unlock()
+	return srv.listenerProfiles[l]
+}
+
+// setProfile sets the profile of the listener which accepted the connection, it must be called before serving the client.
+func (client *client) setProfile(profile *ListenerProfile) {
+	if profile == nil {
+		return
+	}
+	client.opts.profile = profile
+	if profile.MaxRemainLength != 0 {
+		srv := client.server
+		client.packetReader.SetDecodeOptions(packets.DecodeOptions{
+			Strictness:      srv.config.Strictness,
+			MaxRemainLength: profile.MaxRemainLength,
+			OnViolation:     client.onProtocolViolation,
+		})
+	}
+}
+
+// allowProtocolLevel returns whether the protocol level is allowed for the client.
+func (client *client) allowProtocolLevel(level byte) bool {
+	if p := client.opts.profile; p != nil && len(p.ProtocolLevels) != 0 {
+		for _, v := range p.ProtocolLevels {
+			if v == level {
+				return true
+			}
+		}
+		return false
+	}
+	return level != packets.Version31 || client.server.config.AllowMQTT31
+}
+
+// authenticatedBy returns whether the OnConnect hook of the plugin authenticates the client, see ListenerProfile.AuthPlugins.
+func authenticatedBy(c Client, plugin string) bool {
+	profile := c.OptionsReader().ListenerProfile()
+	if profile == nil || profile.AuthPlugins == nil {
+		return true
+	}
+	for _, v := range profile.AuthPlugins {
+		if v == plugin {
+			return true
+		}
+	}
+	return false
+}
+
+// clientRateLimit returns the publish rate limit of the client before the OnRateLimit hooks are applied.
+func (srv *server) clientRateLimit(c Client) RateLimit {
+	if profile := c.OptionsReader().ListenerProfile(); profile != nil && profile.RateLimit != nil {
+		return *profile.RateLimit
+	}
+	return srv.configRateLimit()
+}
@@ -0,0 +1,80 @@
+package gmqtt
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/DrmagicE/gmqtt/pkg/packets"
+)
+
+func TestServer_ListenerProfile(t *testing.T) {
+	a := assert.New(t)
+	var events []string
+	auth := &testPlugin{name: "auth", events: &events, hooks: HookWrapper{
+		OnConnectWrapper: func(next OnConnect) OnConnect {
+			return func(ctx context.Context, client Client) (code uint8) {
+				return packets.CodeBadUsernameorPsw
+			}
+		},
+	}}
+	public := &testListener{acceptReady: make(chan struct{})}
+	internal := &testListener{acceptReady: make(chan struct{})}
+	limit := &RateLimit{MsgRate: 10}
+	srv := NewServer(
+		WithPlugin(auth),
+		WithTCPListener(public),
+		WithListenerProfile(ListenerProfile{
+			ProtocolLevels: []byte{packets.Version311},
+			AuthPlugins:    []string{},
+			RateLimit:      limit,
+			Tenant:         "internal",
+		}, internal),
+	)
+	srv.Run()
+	defer srv.Stop(context.Background())
+
+	connack := func(ln *testListener, level byte) (*packets.Connack, *rwTestConn) {
+		conn := &rwTestConn{
+			closec:    make(chan struct{}),
+			readChan:  make(chan []byte, 1024),
+			writeChan: make(chan []byte, 1024),
+		}
+		ln.conn.PushBack(conn)
+		ln.acceptReady <- struct{}{}
+		connect := defaultConnectPacket()
+		connect.ProtocolLevel = level
+		if level == packets.Version31 {
+			connect.ProtocolName = []byte("MQIsdp")
+		}
+		writePacket(conn, connect)
+		p, err := readPacketWithTimeOut(conn, time.Second)
+		if !a.NoError(err) {
+			return &packets.Connack{}, conn
+		}
+		return p.(*packets.Connack), conn
+	}
+	// rejected waits for the rejected connection to be closed by the server,
+	// so that its client goroutine is not left running after the test.
+	rejected := func(ack *packets.Connack, conn *rwTestConn) uint8 {
+		select {
+		case <-conn.closec:
+		case <-time.After(time.Second):
+			t.Fatal("the rejected connection is not closed")
+		}
+		return ack.Code
+	}
+	// the auth plugin applies to the public listener only.
+	a.Equal(uint8(packets.CodeBadUsernameorPsw), rejected(connack(public, packets.Version311)))
+	ack, _ := connack(internal, packets.Version311)
+	a.Equal(uint8(packets.CodeAccepted), ack.Code)
+	a.Equal(uint8(packets.CodeUnacceptableProtocolVersion), rejected(connack(internal, packets.Version31)))
+
+	c := srv.Client("MQTT")
+	if a.NotNil(c) {
+		a.Equal("internal", c.OptionsReader().ListenerProfile().Tenant)
+		a.Equal(*limit, srv.clientRateLimit(c))
+	}
+}
@@ -0,0 +1,211 @@
+package gmqtt
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
+	"github.com/DrmagicE/gmqtt/pkg/packets"
+)
+
+// The log modules of the server, the logs of each module have the "module" field
+// and the level of each module can be overridden by SetModuleLogLevel.
+// The plugins log with the "plugin/<plugin name>" modules, see Logger.
+const (
+	// LogModuleServer is the module of the server lifecycle, the listeners, bans and overload.
+	LogModuleServer = "server"
+	// LogModuleClient is the module of the connections and the packets.
+	LogModuleClient = "client"
+	// LogModuleSession is the module of the sessions, the inflight messages and the message queues.
+	LogModuleSession = "session"
+	// LogModuleSubscription is the module of the subscriptions.
+	LogModuleSubscription = "subscription"
+	// LogModuleRetained is the module of the retained messages.
+	LogModuleRetained = "retained"
+	// LogModulePersistence is the module of the persistence stores.
+	LogModulePersistence = "persistence"
+)
+
+// moduleLoggers is the logger set by WithLogger and the loggers of the modules derived from it,
+// it is replaced as a whole by setLogger, so a server can be created while the others are logging.
+type moduleLoggers struct {
+	root         *zap.Logger
+	server       *zap.Logger
+	client       *zap.Logger
+	session      *zap.Logger
+	subscription *zap.Logger
+	retained     *zap.Logger
+	persistence  *zap.Logger
+}
+
+var loggers atomic.Value // *moduleLoggers
+
+func currentLoggers() *moduleLoggers {
+	return loggers.Load().(*moduleLoggers)
+}
+
+func serverLog() *zap.Logger       { return currentLoggers().server }
+func clientLog() *zap.Logger       { return currentLoggers().client }
+func sessionLog() *zap.Logger      { return currentLoggers().session }
+func subscriptionLog() *zap.Logger { return currentLoggers().subscription }
+func retainedLog() *zap.Logger     { return currentLoggers().retained }
+func persistenceLog() *zap.Logger  { return currentLoggers().persistence }
+
+// setLogger sets the logger of the server and creates the loggers of the modules.
+func setLogger(logger *zap.Logger) {
+	loggers.Store(&moduleLoggers{
+		root:         logger,
+		server:       moduleLogger(logger, LogModuleServer),
+		client:       moduleLogger(logger, LogModuleClient),
+		session:      moduleLogger(logger, LogModuleSession),
+		subscription: moduleLogger(logger, LogModuleSubscription),
+		retained:     moduleLogger(logger, LogModuleRetained),
+		persistence:  moduleLogger(logger, LogModulePersistence),
+	})
+}
+
+// moduleLevel is the level override of a module.
+type moduleLevel struct {
+	set   int32
+	level int32
+}
+
+func (m *moduleLevel) get() (zapcore.Level, bool) {
+	if atomic.LoadInt32(&m.set) == 0 {
+		return 0, false
+	}
+	return zapcore.Level(atomic.LoadInt32(&m.level)), true
+}
+
+var moduleLevels = struct {
+	sync.Mutex
+	m map[string]*moduleLevel
+}{m: make(map[string]*moduleLevel)}
+
+func getModuleLevel(module string) *moduleLevel {
+	moduleLevels.Lock()
+	defer moduleLevels.Unlock()
+	l, ok := moduleLevels.m[module]
+	if !ok {
+		l = &moduleLevel{}
+		moduleLevels.m[module] = l
+	}
+	return l
+}
+
+// moduleCore is the core which overrides the level of the wrapped core if the level of the module is set.
+type moduleCore struct {
+	zapcore.Core
+	level *moduleLevel
+}
+
+func (c *moduleCore) Enabled(level zapcore.Level) bool {
+	if l, ok := c.level.get(); ok {
+		return l.Enabled(level)
+	}
+	return c.Core.Enabled(level)
+}
+
+func (c *moduleCore) With(fields []zapcore.Field) zapcore.Core {
+	return &moduleCore{Core: c.Core.With(fields), level: c.level}
+}
+
+func (c *moduleCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if l, ok := c.level.get(); ok {
+		// the level of the wrapped core is bypassed, so a module can be more verbose than the logger.
+		if l.Enabled(ent.Level) {
+			return ce.AddCore(ent, c)
+		}
+		return ce
+	}
+	return c.Core.Check(ent, ce)
+}
+
+// Logger returns the logger of the module which is derived from the logger set by WithLogger,
+// the level of the logger can be overridden by SetModuleLogLevel.
+// Like LoggerWithField, it must be called after the server is created, plugins can call it in Load:
+//
+//	log = gmqtt.Logger("plugin/" + name)
+func Logger(module string, fields ...zap.Field) *zap.Logger {
+	return moduleLogger(currentLoggers().root, module, fields...)
+}
+
+func moduleLogger(logger *zap.Logger, module string, fields ...zap.Field) *zap.Logger {
+	level := getModuleLevel(module)
+	return logger.WithOptions(zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+		return &moduleCore{Core: core, level: level}
+	})).With(append([]zap.Field{zap.String("module", module)}, fields...)...)
+}
+
+// SetModuleLogLevel overrides the level of the module, the level can be lower than the level of the logger.
+// The levels are shared by the servers in the process since the logger is, see WithLogger.
+func (srv *server) SetModuleLogLevel(module string, level zapcore.Level) {
+	l := getModuleLevel(module)
+	atomic.StoreInt32(&l.level, int32(level))
+	atomic.StoreInt32(&l.set, 1)
+	serverLog().Info("module log level changed", zap.String("log_module", module), zap.String("level", level.String()))
+}
+
+// ResetModuleLogLevel removes the level override of the module.
+func (srv *server) ResetModuleLogLevel(module string) {
+	atomic.StoreInt32(&getModuleLevel(module).set, 0)
+	serverLog().Info("module log level reset", zap.String("log_module", module))
+}
+
+// ModuleLogLevels returns the overridden levels of the modules.
+func (srv *server) ModuleLogLevels() map[string]zapcore.Level {
+	moduleLevels.Lock()
+	defer moduleLevels.Unlock()
+	levels := make(map[string]zapcore.Level)
+	for module, l := range moduleLevels.m {
+		if level, ok := l.get(); ok {
+			levels[module] = level
+		}
+	}
+	return levels
+}
+
+// packetType returns the type name of the packet for the "packet_type" field.
+func packetType(p packets.Packet) string {
+	switch p.(type) {
+	case *packets.Connect:
+		return "CONNECT"
+	case *packets.Connack:
+		return "CONNACK"
+	case *packets.Publish:
+		return "PUBLISH"
+	case *packets.Puback:
+		return "PUBACK"
+	case *packets.Pubrec:
+		return "PUBREC"
+	case *packets.Pubrel:
+		return "PUBREL"
+	case *packets.Pubcomp:
+		return "PUBCOMP"
+	case *packets.Subscribe:
+		return "SUBSCRIBE"
+	case *packets.Suback:
+		return "SUBACK"
+	case *packets.Unsubscribe:
+		return "UNSUBSCRIBE"
+	case *packets.Unsuback:
+		return "UNSUBACK"
+	case *packets.Pingreq:
+		return "PINGREQ"
+	case *packets.Pingresp:
+		return "PINGRESP"
+	case *packets.Disconnect:
+		return "DISCONNECT"
+	}
+	return "UNKNOWN"
+}
+
+// logFields returns the fields with the client_id and remote_addr fields of the client prepended.
+func (client *client) logFields(fields ...zap.Field) []zap.Field {
+	return append([]zap.Field{
+		zap.String("client_id", client.opts.clientID),
+		zap.String("remote_addr", client.rwc.RemoteAddr().String()),
+	}, fields...)
+}
@@ -0,0 +1,57 @@
+package gmqtt
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestLogger(t *testing.T) {
+	a := assert.New(t)
+	core, observed := observer.New(zapcore.InfoLevel)
+	srv := NewServer(WithLogger(zap.New(core)))
+	defer setLogger(zap.NewNop())
+	// takes the logs of the test module only.
+	take := func() []observer.LoggedEntry {
+		entries := observed.FilterField(zap.String("module", "test")).All()
+		observed.TakeAll()
+		return entries
+	}
+
+	l := Logger("test", zap.String("k", "v"))
+	l.Debug("debug")
+	l.Info("info")
+	entries := take()
+	a.Len(entries, 1)
+	entry := entries[0]
+	a.Equal("info", entry.Message)
+	a.Equal(map[string]interface{}{"module": "test", "k": "v"}, entry.ContextMap())
+
+	// the module can be more verbose than the logger.
+	srv.SetModuleLogLevel("test", zapcore.DebugLevel)
+	l.Debug("debug")
+	l.With(zap.Int("n", 1)).Debug("debug with")
+	entries = take()
+	a.Len(entries, 2)
+	a.Equal("debug", entries[0].Message)
+	a.EqualValues(1, entries[1].ContextMap()["n"])
+	// the other modules are not affected.
+	clientLog().Debug("debug")
+	a.Len(observed.FilterField(zap.String("module", LogModuleClient)).All(), 0)
+
+	srv.SetModuleLogLevel("test", zapcore.ErrorLevel)
+	l.Info("info")
+	l.Error("error")
+	entries = take()
+	a.Len(entries, 1)
+	a.Equal("error", entries[0].Message)
+	a.Equal(map[string]zapcore.Level{"test": zapcore.ErrorLevel}, srv.ModuleLogLevels())
+
+	srv.ResetModuleLogLevel("test")
+	l.Info("info")
+	a.Len(take(), 1)
+	a.Empty(srv.ModuleLogLevels())
+}
@@ -0,0 +1,87 @@
+package gmqtt
+
+import (
+	"time"
+
+	"github.com/DrmagicE/gmqtt/pkg/packets"
+)
+
+// messageExpiryLoop periodically purges the expired messages of all sessions until the server exits.
+func (srv *server) messageExpiryLoop() {
+	interval := srv.config.MessageExpiryCheckInterval
+	if interval == 0 {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-srv.exitChan:
+			return
+		case now := <-ticker.C:
+			srv.mu.RLock()
+			clients := make([]*client, 0, len(srv.clients))
+			for _, c := range srv.clients {
+				clients = append(clients, c)
+			}
+			srv.mu.RUnlock()
+			for _, c := range clients {
+				c.purgeExpiredMessages(now)
+			}
+		}
+	}
+}
+
+// msgExpired returns whether the message which was queued at the given time has expired.
+func (client *client) msgExpired(at time.Time, now time.Time) bool {
+	expiry := client.server.config.MessageExpiry
+	return expiry != 0 && now.Sub(at) > expiry
+}
+
+// purgeExpiredMessages removes the messages which have been queued longer than Config.MessageExpiry.
+// The expired messages in the inflight queue are removed only if the client is offline,
+// the delivery of the inflight messages of an online client has started and is not interrupted.
+func (client *client) purgeExpiredMessages(now time.Time) {
+	if client.server.config.MessageExpiry == 0 {
+		return
+	}
+	s := client.session
+	s.msgQueueMu.Lock()
+	var removed bool
+	for e := s.msgQueue.Front(); e != nil; {
+		next := e.Next()
+		pub := e.Value.(*packets.Publish)
+		// the messages are queued in order, so the rest of the queue has not expired.
+		if !client.msgExpired(s.msgQueueAt[pub], now) {
+			break
+		}
+		s.removeQueued(e)
+		client.server.statsManager.messageDequeue(1)
+		client.statsManager.messageDequeue(1)
+		client.msgDropped(pub, DroppedExpired, "in queue")
+		removed = true
+		e = next
+	}
+	if removed {
+		client.persistQueue(nil, true)
+	}
+	s.msgQueueMu.Unlock()
+
+	if client.IsConnected() {
+		return
+	}
+	s.inflightMu.Lock()
+	for e := s.inflight.Front(); e != nil; {
+		next := e.Next()
+		elem := e.Value.(*inflightElem)
+		if client.msgExpired(elem.at, now) {
+			s.inflight.Remove(e)
+			s.freePacketID(elem.packet.PacketID)
+			client.persistInflightRemove(elem.packet.PacketID)
+			client.statsManager.decInflightCurrent(1)
+			client.msgDropped(elem.packet, DroppedExpired, "inflight")
+		}
+		e = next
+	}
+	s.inflightMu.Unlock()
+}
@@ -0,0 +1,59 @@
+package gmqtt
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/DrmagicE/gmqtt/pkg/packets"
+)
+
+func TestPurgeExpiredMessages(t *testing.T) {
+	a := assert.New(t)
+	c := fullInflightSessionQos1()
+	var reasons []MsgDroppedReason
+	c.server.hooks.OnMsgDropped = func(ctx context.Context, client Client, msg packets.Message, reason MsgDroppedReason) {
+		reasons = append(reasons, reason)
+	}
+	c.server.config.MessageExpiry = time.Minute
+	for i := 1; i <= 3; i++ {
+		c.msgEnQueue(&packets.Publish{PacketID: packets.PacketID(testMaxInflightLen + i), Qos: packets.QOS_1})
+	}
+	now := time.Now()
+	// the first message has been queued for 2 minutes
+	c.session.msgQueueAt[c.session.msgQueue.Front().Value.(*packets.Publish)] = now.Add(-2 * time.Minute)
+
+	c.purgeExpiredMessages(now)
+	a.Equal([]packets.PacketID{testMaxInflightLen + 2, testMaxInflightLen + 3}, queuedPacketIDs(c))
+	a.Len(c.session.msgQueueAt, 2)
+	a.Equal([]MsgDroppedReason{DroppedExpired}, reasons)
+	a.Equal(testMaxInflightLen, c.session.inflight.Len())
+
+	// the inflight messages of the offline client expire as well
+	c.purgeExpiredMessages(now.Add(2 * time.Minute))
+	a.Len(queuedPacketIDs(c), 0)
+	a.Equal(0, c.session.inflight.Len())
+	a.EqualValues(0, c.statsManager.GetStats().InflightCurrent)
+	a.Len(reasons, 3+testMaxInflightLen)
+}
+
+func TestMsgDequeue_Expired(t *testing.T) {
+	a := assert.New(t)
+	c := fullInflightSessionQos1()
+	var reasons []MsgDroppedReason
+	c.server.hooks.OnMsgDropped = func(ctx context.Context, client Client, msg packets.Message, reason MsgDroppedReason) {
+		reasons = append(reasons, reason)
+	}
+	c.server.config.MessageExpiry = time.Minute
+	c.msgEnQueue(&packets.Publish{PacketID: 100, Qos: packets.QOS_1})
+	c.msgEnQueue(&packets.Publish{PacketID: 101, Qos: packets.QOS_1})
+	c.session.msgQueueAt[c.session.msgQueue.Front().Value.(*packets.Publish)] = time.Now().Add(-2 * time.Minute)
+
+	pub := c.msgDequeue()
+	a.NotNil(pub)
+	a.EqualValues(101, pub.PacketID)
+	a.Equal([]MsgDroppedReason{DroppedExpired}, reasons)
+	a.Nil(c.msgDequeue())
+}
@@ -3,7 +3,17 @@ package gmqtt
 import (
 	"net"
 
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
+
+	persistence_ban "github.com/DrmagicE/gmqtt/persistence/ban"
+	persistence_delayed "github.com/DrmagicE/gmqtt/persistence/delayed"
+	"github.com/DrmagicE/gmqtt/persistence/inflight"
+	"github.com/DrmagicE/gmqtt/persistence/queue"
+	persistence_session "github.com/DrmagicE/gmqtt/persistence/session"
+	"github.com/DrmagicE/gmqtt/retained"
+	"github.com/DrmagicE/gmqtt/subscription"
 )
 
 type Options func(srv *server)
@@ -43,8 +53,88 @@ func WithHook(hooks Hooks) Options {
 	}
 }
 
+// WithRetainedStore set the retained.Store of the server. Default to the in-memory store.
+func WithRetainedStore(store retained.Store) Options {
+	return func(srv *server) {
+		srv.retainedDB = store
+	}
+}
+
+// WithSubscriptionStore set the subscription.Store of the server. Default to the in-memory store.
+func WithSubscriptionStore(store subscription.Store) Options {
+	return func(srv *server) {
+		srv.subscriptionsDB = store
+		if sm, ok := srv.statsManager.(*statsManager); ok {
+			sm.subStatsReader = store
+		}
+	}
+}
+
+// WithSessionPersistence set the stores which persist the sessions of the clients with clean session = false,
+// so the sessions can be restored after the server restarts. Default to no persistence.
+// Notice:
+// The subscriptions are not persisted by the stores, use a persistent subscription.Store (such as subscription/redis)
+// with WithSubscriptionStore to restore the subscriptions as well.
+// The session of an online client is persisted when the client disconnects or the server stops gracefully,
+// it is lost if the server crashes while the client is online.
+func WithSessionPersistence(sessions persistence_session.Store, queues queue.Store) Options {
+	return func(srv *server) {
+		srv.sessionStore = sessions
+		srv.queueStore = queues
+	}
+}
+
+// WithInflightPersistence set the store which persists the inflight messages of the online clients
+// with clean session = false, so the QoS 1 and QoS 2 flows can be resumed even if the server crashes.
+// It requires WithSessionPersistence.
+func WithInflightPersistence(store inflight.Store) Options {
+	return func(srv *server) {
+		srv.inflightStore = store
+	}
+}
+
+// WithBanPersistence set the store which persists the bans, so the bans survive the server restarts.
+// Default to no persistence.
+func WithBanPersistence(store persistence_ban.Store) Options {
+	return func(srv *server) {
+		srv.banStore = store
+	}
+}
+
+// WithDelayedPersistence set the store which persists the pending delayed messages,
+// so the delayed messages survive the server restarts. Default to no persistence.
+func WithDelayedPersistence(store persistence_delayed.Store) Options {
+	return func(srv *server) {
+		srv.delayedStore = store
+	}
+}
+
+// WithLogger set the logger of the server, the modules and the plugins log with the loggers derived from it, see Logger.
 func WithLogger(logger *zap.Logger) Options {
 	return func(srv *server) {
-		zaplog = logger
+		setLogger(logger)
+	}
+}
+
+// WithTracerProvider set the OpenTelemetry TracerProvider of the server, see SpanConnect for the spans.
+// Default to the no-op provider.
+func WithTracerProvider(tp trace.TracerProvider) Options {
+	return func(srv *server) {
+		srv.tracerProvider = tp
+	}
+}
+
+// WithMeterProvider set the OpenTelemetry MeterProvider of the server, see MetricConnects for the metrics.
+// Default to the no-op provider.
+func WithMeterProvider(mp metric.MeterProvider) Options {
+	return func(srv *server) {
+		srv.meterProvider = mp
+	}
+}
+
+// WithLogLevel set the level of the logger set by WithLogger, so the level can be changed at runtime by SetLogLevel.
+func WithLogLevel(level zap.AtomicLevel) Options {
+	return func(srv *server) {
+		srv.logLevel = &level
 	}
 }
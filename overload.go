@@ -0,0 +1,189 @@
+package gmqtt
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/DrmagicE/gmqtt/pkg/packets"
+)
+
+// OverloadAction is the action which is taken by the server when it is overloaded.
+// The actions can be combined, e.g: OverloadRejectConnections | OverloadShedQos0.
+type OverloadAction byte
+
+const (
+	// OverloadRejectConnections rejects the new connections with CodeServerUnavaliable.
+	OverloadRejectConnections OverloadAction = 1 << iota
+	// OverloadShedQos0 drops the qos0 messages delivered to the subscribers with the DroppedOverload reason.
+	OverloadShedQos0
+	// OverloadPauseReads stops reading from the connected clients until the server recovers, which applies
+	// the backpressure to the publishers. Notice that the clients may time out waiting for the PINGRESP.
+	OverloadPauseReads
+)
+
+// overloadRecoverRatio is the ratio of the thresholds which all the metrics must be below to leave the overloaded state.
+// It prevents the server from flipping between the states when a metric stays around its threshold.
+const overloadRecoverRatio = 0.9
+
+// OverloadStatus is the status of the overload protector, which is passed to the OnOverload hook.
+type OverloadStatus struct {
+	// Overloaded is whether the server is overloaded.
+	Overloaded bool
+	// HeapBytes is the bytes of the allocated heap objects, it is 0 if Config.MaxHeapBytes is not set.
+	HeapBytes uint64
+	// QueuedMessages is the number of the messages queued in all sessions.
+	QueuedMessages uint64
+	// PendingWrites is the number of the packets waiting to be written to all clients.
+	PendingWrites uint64
+}
+
+// overloadProtector decides whether the server is overloaded according to the thresholds in the config.
+type overloadProtector struct {
+	maxHeapBytes      uint64
+	maxQueuedMessages uint64
+	maxPendingWrites  uint64
+	actions           OverloadAction
+
+	overloaded int32
+	mu         sync.Mutex
+	// resume is closed when the server leaves the overloaded state.
+	resume chan struct{}
+}
+
+func newOverloadProtector(config Config) *overloadProtector {
+	resume := make(chan struct{})
+	close(resume)
+	return &overloadProtector{
+		maxHeapBytes:      config.MaxHeapBytes,
+		maxQueuedMessages: config.MaxQueuedMessages,
+		maxPendingWrites:  config.MaxPendingWrites,
+		actions:           config.OverloadActions,
+		resume:            resume,
+	}
+}
+
+// over returns whether any metric of the status reaches its threshold multiplied by ratio.
+func (o *overloadProtector) over(status OverloadStatus, ratio float64) bool {
+	reach := func(v, max uint64) bool {
+		return max != 0 && float64(v) >= float64(max)*ratio
+	}
+	return reach(status.HeapBytes, o.maxHeapBytes) ||
+		reach(status.QueuedMessages, o.maxQueuedMessages) ||
+		reach(status.PendingWrites, o.maxPendingWrites)
+}
+
+// update updates the state according to the status and returns whether the state is changed.
+// status.Overloaded is set to the new state.
+func (o *overloadProtector) update(status *OverloadStatus) (changed bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	overloaded := atomic.LoadInt32(&o.overloaded) == 1
+	if overloaded {
+		status.Overloaded = o.over(*status, overloadRecoverRatio)
+	} else {
+		status.Overloaded = o.over(*status, 1)
+	}
+	if status.Overloaded == overloaded {
+		return false
+	}
+	if status.Overloaded {
+		o.resume = make(chan struct{})
+		atomic.StoreInt32(&o.overloaded, 1)
+	} else {
+		atomic.StoreInt32(&o.overloaded, 0)
+		close(o.resume)
+	}
+	return true
+}
+
+// active returns whether the server is overloaded and the action should be taken.
+// It accepts the nil receiver, which means the overload protection is disabled.
+func (o *overloadProtector) active(action OverloadAction) bool {
+	return o != nil && o.actions&action != 0 && atomic.LoadInt32(&o.overloaded) == 1
+}
+
+// waitResume blocks until the server leaves the overloaded state or done is closed,
+// if the OverloadPauseReads action is active.
+func (o *overloadProtector) waitResume(done <-chan struct{}) {
+	if !o.active(OverloadPauseReads) {
+		return
+	}
+	o.mu.Lock()
+	resume := o.resume
+	o.mu.Unlock()
+	select {
+	case <-resume:
+	case <-done:
+	}
+}
+
+// overloadStatus collects the metrics of the server.
+func (srv *server) overloadStatus() OverloadStatus {
+	var status OverloadStatus
+	if srv.config.MaxHeapBytes != 0 {
+		var m runtime.MemStats
+		runtime.ReadMemStats(&m)
+		status.HeapBytes = m.HeapAlloc
+	}
+	status.QueuedMessages = srv.statsManager.GetStats().MessageStats.QueuedCurrent
+	srv.mu.RLock()
+	for _, c := range srv.clients {
+		status.PendingWrites += uint64(len(c.out))
+	}
+	srv.mu.RUnlock()
+	return status
+}
+
+func (srv *server) overloadLoop() {
+	interval := srv.config.OverloadCheckInterval
+	if interval == 0 {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-srv.exitChan:
+			return
+		case <-ticker.C:
+			status := srv.overloadStatus()
+			if !srv.overload.update(&status) {
+				continue
+			}
+			fields := []zap.Field{
+				zap.Uint64("heap_bytes", status.HeapBytes),
+				zap.Uint64("queued_messages", status.QueuedMessages),
+				zap.Uint64("pending_writes", status.PendingWrites),
+			}
+			if status.Overloaded {
+				serverLog().Warn("server overloaded", fields...)
+			} else {
+				serverLog().Info("server recovered from overload", fields...)
+			}
+			if srv.hooks.OnOverload != nil {
+				srv.hooks.OnOverload(context.Background(), status)
+			}
+		}
+	}
+}
+
+// checkOverload returns the code of the connack packet according to the overload state,
+// the new connections are rejected with CodeServerUnavaliable if the OverloadRejectConnections action is active.
+func (client *client) checkOverload() (code uint8) {
+	if !client.server.overload.active(OverloadRejectConnections) {
+		return packets.CodeAccepted
+	}
+	if client.listener != nil {
+		atomic.AddUint64(&client.listener.RejectedOverload, 1)
+	}
+	serverLog().Warn("server overloaded, rejecting connection",
+		zap.String("remote_addr", client.rwc.RemoteAddr().String()),
+		zap.String("client_id", client.opts.clientID),
+	)
+	return packets.CodeServerUnavaliable
+}
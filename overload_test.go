@@ -0,0 +1,117 @@
+package gmqtt
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/DrmagicE/gmqtt/pkg/packets"
+)
+
+func TestOverloadProtector(t *testing.T) {
+	a := assert.New(t)
+	o := newOverloadProtector(Config{
+		MaxQueuedMessages: 100,
+		MaxPendingWrites:  10,
+		OverloadActions:   OverloadShedQos0 | OverloadPauseReads,
+	})
+	status := OverloadStatus{QueuedMessages: 99, PendingWrites: 9}
+	a.False(o.update(&status))
+	a.False(status.Overloaded)
+
+	status = OverloadStatus{QueuedMessages: 99, PendingWrites: 10}
+	a.True(o.update(&status))
+	a.True(status.Overloaded)
+	a.True(o.active(OverloadShedQos0))
+	a.False(o.active(OverloadRejectConnections))
+
+	// stays overloaded until all the metrics are below 90% of the thresholds.
+	status = OverloadStatus{QueuedMessages: 90, PendingWrites: 0}
+	a.False(o.update(&status))
+	a.True(status.Overloaded)
+
+	done := make(chan struct{})
+	go func() {
+		o.waitResume(nil)
+		close(done)
+	}()
+	select {
+	case <-done:
+		t.Fatalf("waitResume returned while overloaded")
+	case <-time.After(50 * time.Millisecond):
+	}
+	status = OverloadStatus{QueuedMessages: 89, PendingWrites: 8}
+	a.True(o.update(&status))
+	a.False(status.Overloaded)
+	a.False(o.active(OverloadShedQos0))
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("waitResume did not return after recovery")
+	}
+
+	var nilProtector *overloadProtector
+	a.False(nilProtector.active(OverloadShedQos0))
+	nilProtector.waitResume(nil)
+}
+
+func TestOverload_ShedQos0(t *testing.T) {
+	a := assert.New(t)
+	c := mockClient()
+	var reasons []MsgDroppedReason
+	c.server.hooks.OnMsgDropped = func(ctx context.Context, client Client, msg packets.Message, reason MsgDroppedReason) {
+		reasons = append(reasons, reason)
+	}
+	c.server.overload = newOverloadProtector(Config{MaxQueuedMessages: 1, OverloadActions: OverloadShedQos0})
+	c.server.overload.update(&OverloadStatus{QueuedMessages: 1})
+
+	c.publish(context.Background(), &packets.Publish{Qos: packets.QOS_0, TopicName: []byte("a")}, nil)
+	c.publish(context.Background(), &packets.Publish{Qos: packets.QOS_1, TopicName: []byte("b")}, nil)
+	a.Equal(1, c.session.msgQueue.Len())
+	a.Equal([]MsgDroppedReason{DroppedOverload}, reasons)
+}
+
+func TestOverload_Server(t *testing.T) {
+	a := assert.New(t)
+	ln, err := net.Listen("tcp", "127.0.0.1:1883")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	config := DefaultConfig
+	config.MaxQueuedMessages = 1
+	config.OverloadCheckInterval = 10 * time.Millisecond
+	var mu sync.Mutex
+	var states []bool
+	srv := NewServer(WithTCPListener(ln), WithConfig(config), WithHook(Hooks{
+		OnOverload: func(ctx context.Context, status OverloadStatus) {
+			mu.Lock()
+			defer mu.Unlock()
+			states = append(states, status.Overloaded)
+		},
+	}))
+	defer srv.Stop(context.Background())
+	srv.Run()
+
+	srv.statsManager.messageEnqueue(1)
+	a.Eventually(func() bool {
+		c, code := dialAndConnect(t, "id1")
+		defer c.Close()
+		return code == packets.CodeServerUnavaliable
+	}, time.Second, 20*time.Millisecond)
+	listener := srv.GetStatsManager().GetStats().ListenerStats[tcpListenerName(ln)]
+	a.NotZero(listener.RejectedOverload)
+
+	srv.statsManager.messageDequeue(1)
+	a.Eventually(func() bool {
+		c, code := dialAndConnect(t, "id1")
+		defer c.Close()
+		return code == packets.CodeAccepted
+	}, time.Second, 20*time.Millisecond)
+	mu.Lock()
+	a.Equal([]bool{true, false}, states)
+	mu.Unlock()
+}
@@ -0,0 +1,274 @@
+package gmqtt
+
+import (
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/DrmagicE/gmqtt/persistence/inflight"
+	"github.com/DrmagicE/gmqtt/persistence/queue"
+	persistence_session "github.com/DrmagicE/gmqtt/persistence/session"
+	"github.com/DrmagicE/gmqtt/pkg/packets"
+)
+
+func publishToQueueMessage(p *packets.Publish) *queue.Message {
+	return &queue.Message{
+		Dup:      p.Dup,
+		Qos:      p.Qos,
+		Retained: p.Retain,
+		Topic:    string(p.TopicName),
+		PacketID: p.PacketID,
+		Payload:  p.Payload,
+	}
+}
+
+func queueMessageToPublish(m *queue.Message) *packets.Publish {
+	return &packets.Publish{
+		Dup:       m.Dup,
+		Qos:       m.Qos,
+		Retain:    m.Retained,
+		TopicName: []byte(m.Topic),
+		PacketID:  m.PacketID,
+		Payload:   m.Payload,
+	}
+}
+
+func (srv *server) persistenceEnabled() bool {
+	return srv.sessionStore != nil && srv.queueStore != nil
+}
+
+// persistSession saves the offline session of the client and its message queue.
+func (srv *server) persistSession(client *client) {
+	if !srv.persistenceEnabled() {
+		return
+	}
+	s := client.session
+	sess := &persistence_session.Session{
+		ClientID:       client.opts.clientID,
+		DisconnectedAt: time.Now(),
+		Attributes:     client.attributes.All(),
+	}
+	// the inflight messages have been persisted by the inflight store if it is set.
+	if srv.inflightStore == nil {
+		s.inflightMu.Lock()
+		for e := s.inflight.Front(); e != nil; e = e.Next() {
+			sess.Inflight = append(sess.Inflight, publishToQueueMessage(e.Value.(*inflightElem).packet))
+		}
+		s.inflightMu.Unlock()
+		s.awaitRelMu.Lock()
+		for e := s.awaitRel.Front(); e != nil; e = e.Next() {
+			sess.AwaitRel = append(sess.AwaitRel, e.Value.(*awaitRelElem).pid)
+		}
+		s.awaitRelMu.Unlock()
+	}
+	for pid := range s.unackpublish {
+		sess.UnackPublish = append(sess.UnackPublish, pid)
+	}
+	if err := srv.sessionStore.Save(sess); err != nil {
+		persistenceLog().Error("persisting session error", zap.String("client_id", sess.ClientID), zap.Error(err))
+	}
+	// hold the lock to prevent the concurrent enqueued messages from being persisted before the whole queue.
+	s.msgQueueMu.Lock()
+	defer s.msgQueueMu.Unlock()
+	if err := srv.queueStore.Replace(sess.ClientID, client.queuedMessages()); err != nil {
+		persistenceLog().Error("persisting message queue error", zap.String("client_id", sess.ClientID), zap.Error(err))
+	}
+}
+
+// queuedMessages returns the messages in the message queue, it must be called with msgQueueMu held.
+func (client *client) queuedMessages() []*queue.Message {
+	s := client.session
+	msgs := make([]*queue.Message, 0, s.msgQueue.Len())
+	for e := s.msgQueue.Front(); e != nil; e = e.Next() {
+		msgs = append(msgs, publishToQueueMessage(e.Value.(*packets.Publish)))
+	}
+	return msgs
+}
+
+// persistQueue persists the change of the message queue of the offline client.
+// If the queue has been changed other than appending the publish, the whole queue is replaced.
+// It must be called with msgQueueMu held.
+func (client *client) persistQueue(publish *packets.Publish, replace bool) {
+	srv := client.server
+	if !srv.persistenceEnabled() || client.IsConnected() {
+		return
+	}
+	var err error
+	if replace {
+		err = srv.queueStore.Replace(client.opts.clientID, client.queuedMessages())
+	} else {
+		err = srv.queueStore.Append(client.opts.clientID, publishToQueueMessage(publish))
+	}
+	if err != nil {
+		persistenceLog().Error("persisting message queue error", zap.String("client_id", client.opts.clientID), zap.Error(err))
+	}
+}
+
+// persistInflight applies fn to the inflight store if the inflight messages of the client are persisted.
+func (client *client) persistInflight(fn func(store inflight.Store, clientID string) error) {
+	srv := client.server
+	if !srv.persistenceEnabled() || srv.inflightStore == nil || client.opts.cleanSession {
+		return
+	}
+	if err := fn(srv.inflightStore, client.opts.clientID); err != nil {
+		persistenceLog().Error("persisting inflight message error", zap.String("client_id", client.opts.clientID), zap.Error(err))
+	}
+}
+
+func (client *client) persistInflightAdd(publish *packets.Publish) {
+	client.persistInflight(func(store inflight.Store, clientID string) error {
+		return store.Add(clientID, publishToQueueMessage(publish))
+	})
+}
+
+func (client *client) persistInflightRelease(pid packets.PacketID) {
+	client.persistInflight(func(store inflight.Store, clientID string) error {
+		return store.Release(clientID, pid)
+	})
+}
+
+func (client *client) persistInflightRemove(pid packets.PacketID) {
+	client.persistInflight(func(store inflight.Store, clientID string) error {
+		return store.Remove(clientID, pid)
+	})
+}
+
+// persistConnectedSession updates the persisted session once the client has connected.
+// If the inflight store is set, the session of the online client is kept in the session store,
+// so that its inflight messages can be recovered even if the server crashes.
+func (srv *server) persistConnectedSession(client *client, sessionReuse bool) {
+	if !srv.persistenceEnabled() {
+		return
+	}
+	clientID := client.opts.clientID
+	if !sessionReuse && srv.inflightStore != nil {
+		if err := srv.inflightStore.RemoveAll(clientID); err != nil {
+			persistenceLog().Error("removing persisted inflight messages error", zap.String("client_id", clientID), zap.Error(err))
+		}
+	}
+	if client.opts.cleanSession || srv.inflightStore == nil {
+		srv.removePersistedSession(clientID)
+		return
+	}
+	// the zero DisconnectedAt indicates the client was online.
+	sess := &persistence_session.Session{ClientID: clientID, Attributes: client.attributes.All()}
+	if err := srv.sessionStore.Save(sess); err != nil {
+		persistenceLog().Error("persisting session error", zap.String("client_id", clientID), zap.Error(err))
+	}
+	// the queued messages have been delivered.
+	if err := srv.queueStore.Remove(clientID); err != nil {
+		persistenceLog().Error("removing persisted message queue error", zap.String("client_id", clientID), zap.Error(err))
+	}
+}
+
+// removePersistedSession removes the persisted session of the client, it is called when the session is
+// resumed, replaced or terminated.
+func (srv *server) removePersistedSession(clientID string) {
+	if !srv.persistenceEnabled() {
+		return
+	}
+	if err := srv.sessionStore.Remove(clientID); err != nil {
+		persistenceLog().Error("removing persisted session error", zap.String("client_id", clientID), zap.Error(err))
+	}
+	if err := srv.queueStore.Remove(clientID); err != nil {
+		persistenceLog().Error("removing persisted message queue error", zap.String("client_id", clientID), zap.Error(err))
+	}
+	if srv.inflightStore != nil {
+		if err := srv.inflightStore.RemoveAll(clientID); err != nil {
+			persistenceLog().Error("removing persisted inflight messages error", zap.String("client_id", clientID), zap.Error(err))
+		}
+	}
+}
+
+// restoreSessions recovers the persisted sessions as offline sessions, it is called before the server starts.
+func (srv *server) restoreSessions() error {
+	if !srv.persistenceEnabled() {
+		return nil
+	}
+	var sessions []*persistence_session.Session
+	err := srv.sessionStore.Iterate(func(sess *persistence_session.Session) bool {
+		sessions = append(sessions, sess)
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	for _, sess := range sessions {
+		msgs, err := srv.queueStore.Get(sess.ClientID)
+		if err != nil {
+			return err
+		}
+		if srv.inflightStore != nil {
+			elems, err := srv.inflightStore.Get(sess.ClientID)
+			if err != nil {
+				return err
+			}
+			sess.Inflight, sess.AwaitRel = nil, nil
+			for _, v := range elems {
+				if v.Released {
+					sess.AwaitRel = append(sess.AwaitRel, v.Message.PacketID)
+				} else {
+					sess.Inflight = append(sess.Inflight, v.Message)
+				}
+			}
+		}
+		if sess.DisconnectedAt.IsZero() {
+			// the server exited while the client was online.
+			sess.DisconnectedAt = time.Now()
+		}
+		client := srv.newRestoredClient(sess, msgs)
+		srv.clients[sess.ClientID] = client
+		srv.offlineClients[sess.ClientID] = sess.DisconnectedAt
+		srv.scheduleSessionExpiry(sess.ClientID, sess.DisconnectedAt)
+		srv.statsManager.addSessionInactive()
+		srv.statsManager.messageEnqueue(uint64(len(msgs)))
+	}
+	if len(sessions) != 0 {
+		persistenceLog().Info("sessions restored", zap.Int("count", len(sessions)))
+	}
+	return nil
+}
+
+// newRestoredClient creates an offline client with the persisted session.
+// The client has no connection, it only holds the session until the client reconnects or the session expires.
+func (srv *server) newRestoredClient(sess *persistence_session.Session, msgs []*queue.Message) *client {
+	client := &client{
+		server:        srv,
+		close:         make(chan struct{}),
+		closeComplete: make(chan struct{}),
+		error:         make(chan error, 1),
+		status:        Disconnected,
+		opts: &options{
+			clientID:     sess.ClientID,
+			cleanSession: false,
+		},
+		ready:        make(chan struct{}),
+		statsManager: newSessionStatsManager(),
+		attributes:   newClientSession(sess.Attributes),
+		packetStats:  newPacketStats(),
+	}
+	close(client.close)
+	close(client.closeComplete)
+	close(client.ready)
+	client.setDisconnectedAt(sess.DisconnectedAt)
+	client.newSession()
+	s := client.session
+	now := time.Now()
+	for _, v := range sess.Inflight {
+		s.inflight.PushBack(&inflightElem{at: now, packet: queueMessageToPublish(v)})
+	}
+	client.statsManager.addInflightCurrent(uint64(len(sess.Inflight)))
+	for _, pid := range sess.AwaitRel {
+		s.awaitRel.PushBack(&awaitRelElem{at: now, pid: pid})
+	}
+	client.statsManager.addAwaitCurrent(uint64(len(sess.AwaitRel)))
+	for _, pid := range sess.UnackPublish {
+		s.unackpublish[pid] = true
+	}
+	for _, v := range msgs {
+		pub := queueMessageToPublish(v)
+		s.pushQueued(pub, now, srv.queuePriority(pub.TopicName))
+	}
+	client.statsManager.messageEnqueue(uint64(len(msgs)))
+	return client
+}
@@ -0,0 +1,26 @@
+// Package ban defines the interface of the persistent store of the bans,
+// which makes the bans survive the broker restarts.
+package ban
+
+import "time"
+
+// Entry is the persisted ban.
+type Entry struct {
+	// Kind is the gmqtt.BanKind of the ban.
+	Kind  int       `json:"kind"`
+	Value string    `json:"value"`
+	At    time.Time `json:"at"`
+	// Until is the time when the ban expires, zero means the ban never expires.
+	Until    time.Time `json:"until"`
+	Flapping bool      `json:"flapping"`
+}
+
+// Store is the interface used by gmqtt.server to persist the bans.
+type Store interface {
+	// Save adds or replaces the ban with the same kind and value.
+	Save(entry *Entry) error
+	// Remove removes the ban.
+	Remove(kind int, value string) error
+	// Iterate iterates all bans. If fn returns false, the iteration will be stopped.
+	Iterate(fn func(entry *Entry) bool) error
+}
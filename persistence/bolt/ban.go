@@ -0,0 +1,68 @@
+package bolt
+
+import (
+	"encoding/json"
+	"strconv"
+
+	"go.etcd.io/bbolt"
+
+	"github.com/DrmagicE/gmqtt/persistence/ban"
+)
+
+var _ ban.Store = (*BanStore)(nil)
+
+// bucketBans contains the bans keyed by "<kind>/<value>".
+var bucketBans = []byte("bans")
+
+// BanStore is the BoltDB backed ban.Store.
+type BanStore struct {
+	db *bbolt.DB
+}
+
+// NewBanStore returns a BanStore which stores the bans in the db.
+func NewBanStore(db *bbolt.DB) (*BanStore, error) {
+	err := db.Update(func(tx *bbolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(bucketBans)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &BanStore{db: db}, nil
+}
+
+func banKey(kind int, value string) []byte {
+	return []byte(strconv.Itoa(kind) + "/" + value)
+}
+
+func (b *BanStore) Save(entry *ban.Entry) error {
+	v, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	return b.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(bucketBans).Put(banKey(entry.Kind, entry.Value), v)
+	})
+}
+
+func (b *BanStore) Remove(kind int, value string) error {
+	return b.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(bucketBans).Delete(banKey(kind, value))
+	})
+}
+
+func (b *BanStore) Iterate(fn func(entry *ban.Entry) bool) error {
+	return b.db.View(func(tx *bbolt.Tx) error {
+		c := tx.Bucket(bucketBans).Cursor()
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			entry := &ban.Entry{}
+			if err := json.Unmarshal(v, entry); err != nil {
+				return err
+			}
+			if !fn(entry) {
+				return nil
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,165 @@
+// Package bolt provides the session.Store, queue.Store, inflight.Store, ban.Store and delayed.Store
+// backed by the embedded BoltDB, which requires no external service.
+package bolt
+
+import (
+	"encoding/binary"
+	"encoding/json"
+
+	"go.etcd.io/bbolt"
+
+	"github.com/DrmagicE/gmqtt/persistence/queue"
+	"github.com/DrmagicE/gmqtt/persistence/session"
+)
+
+var (
+	_ session.Store = (*SessionStore)(nil)
+	_ queue.Store   = (*QueueStore)(nil)
+)
+
+var (
+	bucketSessions = []byte("sessions")
+	// bucketQueues contains a nested bucket for each client, the messages are keyed by the bucket sequence.
+	bucketQueues = []byte("queues")
+)
+
+// SessionStore is the BoltDB backed session.Store.
+type SessionStore struct {
+	db *bbolt.DB
+}
+
+// NewSessionStore returns a SessionStore which stores the sessions in the db.
+func NewSessionStore(db *bbolt.DB) (*SessionStore, error) {
+	err := db.Update(func(tx *bbolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(bucketSessions)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &SessionStore{db: db}, nil
+}
+
+func (s *SessionStore) Save(sess *session.Session) error {
+	b, err := json.Marshal(sess)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(bucketSessions).Put([]byte(sess.ClientID), b)
+	})
+}
+
+func (s *SessionStore) Remove(clientID string) error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(bucketSessions).Delete([]byte(clientID))
+	})
+}
+
+func (s *SessionStore) Iterate(fn func(sess *session.Session) bool) error {
+	return s.db.View(func(tx *bbolt.Tx) error {
+		c := tx.Bucket(bucketSessions).Cursor()
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			sess := &session.Session{}
+			if err := json.Unmarshal(v, sess); err != nil {
+				return err
+			}
+			if !fn(sess) {
+				return nil
+			}
+		}
+		return nil
+	})
+}
+
+// QueueStore is the BoltDB backed queue.Store.
+type QueueStore struct {
+	db *bbolt.DB
+}
+
+// NewQueueStore returns a QueueStore which stores the queues in the db.
+func NewQueueStore(db *bbolt.DB) (*QueueStore, error) {
+	err := db.Update(func(tx *bbolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(bucketQueues)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &QueueStore{db: db}, nil
+}
+
+func appendMessages(b *bbolt.Bucket, msgs ...*queue.Message) error {
+	for _, msg := range msgs {
+		v, err := json.Marshal(msg)
+		if err != nil {
+			return err
+		}
+		seq, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+		k := make([]byte, 8)
+		binary.BigEndian.PutUint64(k, seq)
+		if err := b.Put(k, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (q *QueueStore) Append(clientID string, msg *queue.Message) error {
+	return q.db.Update(func(tx *bbolt.Tx) error {
+		b, err := tx.Bucket(bucketQueues).CreateBucketIfNotExists([]byte(clientID))
+		if err != nil {
+			return err
+		}
+		return appendMessages(b, msg)
+	})
+}
+
+func (q *QueueStore) Replace(clientID string, msgs []*queue.Message) error {
+	return q.db.Update(func(tx *bbolt.Tx) error {
+		queues := tx.Bucket(bucketQueues)
+		if err := queues.DeleteBucket([]byte(clientID)); err != nil && err != bbolt.ErrBucketNotFound {
+			return err
+		}
+		if len(msgs) == 0 {
+			return nil
+		}
+		b, err := queues.CreateBucket([]byte(clientID))
+		if err != nil {
+			return err
+		}
+		return appendMessages(b, msgs...)
+	})
+}
+
+func (q *QueueStore) Get(clientID string) ([]*queue.Message, error) {
+	var rs []*queue.Message
+	err := q.db.View(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(bucketQueues).Bucket([]byte(clientID))
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, v []byte) error {
+			msg := &queue.Message{}
+			if err := json.Unmarshal(v, msg); err != nil {
+				return err
+			}
+			rs = append(rs, msg)
+			return nil
+		})
+	})
+	return rs, err
+}
+
+func (q *QueueStore) Remove(clientID string) error {
+	return q.db.Update(func(tx *bbolt.Tx) error {
+		err := tx.Bucket(bucketQueues).DeleteBucket([]byte(clientID))
+		if err == bbolt.ErrBucketNotFound {
+			return nil
+		}
+		return err
+	})
+}
@@ -0,0 +1,216 @@
+package bolt
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.etcd.io/bbolt"
+
+	"github.com/DrmagicE/gmqtt/persistence/ban"
+	"github.com/DrmagicE/gmqtt/persistence/delayed"
+	"github.com/DrmagicE/gmqtt/persistence/inflight"
+	"github.com/DrmagicE/gmqtt/persistence/queue"
+	"github.com/DrmagicE/gmqtt/persistence/session"
+	"github.com/DrmagicE/gmqtt/pkg/packets"
+)
+
+func newTestDB(t *testing.T) (*bbolt.DB, func()) {
+	dir, err := ioutil.TempDir("", "gmqtt-bolt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := bbolt.Open(filepath.Join(dir, "test.db"), 0600, nil)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return db, func() {
+		db.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestSessionStore(t *testing.T) {
+	a := assert.New(t)
+	db, clean := newTestDB(t)
+	defer clean()
+	s, err := NewSessionStore(db)
+	a.Nil(err)
+
+	now := time.Unix(time.Now().Unix(), 0).UTC()
+	sessions := map[string]*session.Session{
+		"id0": {
+			ClientID:       "id0",
+			DisconnectedAt: now,
+			Inflight: []*queue.Message{
+				{Qos: packets.QOS_1, Topic: "a/b", PacketID: 1, Payload: []byte("payload")},
+			},
+			AwaitRel:     []packets.PacketID{2},
+			UnackPublish: []packets.PacketID{3},
+		},
+		"id1": {
+			ClientID:       "id1",
+			DisconnectedAt: now,
+		},
+	}
+	for _, v := range sessions {
+		a.Nil(s.Save(v))
+	}
+	got := make(map[string]*session.Session)
+	a.Nil(s.Iterate(func(sess *session.Session) bool {
+		sess.DisconnectedAt = sess.DisconnectedAt.UTC()
+		got[sess.ClientID] = sess
+		return true
+	}))
+	a.Equal(sessions, got)
+
+	var n int
+	a.Nil(s.Iterate(func(sess *session.Session) bool {
+		n++
+		return false
+	}))
+	a.Equal(1, n)
+
+	a.Nil(s.Remove("id0"))
+	a.Nil(s.Remove("not_exists"))
+	got = make(map[string]*session.Session)
+	a.Nil(s.Iterate(func(sess *session.Session) bool {
+		got[sess.ClientID] = sess
+		return true
+	}))
+	a.Len(got, 1)
+	a.Contains(got, "id1")
+}
+
+func TestQueueStore(t *testing.T) {
+	a := assert.New(t)
+	db, clean := newTestDB(t)
+	defer clean()
+	q, err := NewQueueStore(db)
+	a.Nil(err)
+
+	msgs := []*queue.Message{
+		{Qos: packets.QOS_0, Topic: "a", Payload: []byte("0")},
+		{Qos: packets.QOS_1, Topic: "b", Payload: []byte("1"), Retained: true},
+		{Qos: packets.QOS_2, Topic: "c", Payload: []byte("2"), Dup: true, PacketID: 10},
+	}
+	for _, v := range msgs {
+		a.Nil(q.Append("id0", v))
+	}
+	got, err := q.Get("id0")
+	a.Nil(err)
+	a.Equal(msgs, got)
+
+	a.Nil(q.Replace("id0", msgs[1:]))
+	got, err = q.Get("id0")
+	a.Nil(err)
+	a.Equal(msgs[1:], got)
+
+	a.Nil(q.Replace("id0", nil))
+	got, err = q.Get("id0")
+	a.Nil(err)
+	a.Len(got, 0)
+
+	a.Nil(q.Append("id1", msgs[0]))
+	a.Nil(q.Remove("id1"))
+	a.Nil(q.Remove("not_exists"))
+	got, err = q.Get("id1")
+	a.Nil(err)
+	a.Len(got, 0)
+}
+
+func TestInflightStore(t *testing.T) {
+	a := assert.New(t)
+	db, clean := newTestDB(t)
+	defer clean()
+	i, err := NewInflightStore(db)
+	a.Nil(err)
+
+	msgs := []*queue.Message{
+		{Qos: packets.QOS_2, Topic: "a", Payload: []byte("0"), PacketID: 3},
+		{Qos: packets.QOS_1, Topic: "b", Payload: []byte("1"), PacketID: 1},
+		{Qos: packets.QOS_2, Topic: "c", Payload: []byte("2"), PacketID: 2},
+	}
+	for _, v := range msgs {
+		a.Nil(i.Add("id0", v))
+	}
+	a.Nil(i.Release("id0", 3))
+	a.Nil(i.Release("id0", 10))
+	a.Nil(i.Remove("id0", 1))
+	a.Nil(i.Remove("id1", 1))
+	got, err := i.Get("id0")
+	a.Nil(err)
+	a.Equal([]*inflight.Elem{
+		{Message: &queue.Message{Qos: packets.QOS_2, PacketID: 3}, Released: true},
+		{Message: msgs[2]},
+	}, got)
+
+	a.Nil(i.RemoveAll("id0"))
+	a.Nil(i.RemoveAll("id1"))
+	got, err = i.Get("id0")
+	a.Nil(err)
+	a.Len(got, 0)
+}
+
+func TestBanStore(t *testing.T) {
+	a := assert.New(t)
+	db, clean := newTestDB(t)
+	defer clean()
+	b, err := NewBanStore(db)
+	a.Nil(err)
+
+	now := time.Unix(time.Now().Unix(), 0).UTC()
+	entries := []*ban.Entry{
+		{Kind: 0, Value: "id0", At: now, Until: now.Add(time.Minute), Flapping: true},
+		{Kind: 1, Value: "id0", At: now},
+		{Kind: 2, Value: "10.0.0.0/8", At: now},
+	}
+	for _, v := range entries {
+		a.Nil(b.Save(v))
+	}
+	// replaces the existing one
+	entries[1].Until = now.Add(time.Hour)
+	a.Nil(b.Save(entries[1]))
+	a.Nil(b.Remove(2, "10.0.0.0/8"))
+	a.Nil(b.Remove(2, "not-exist"))
+
+	var got []*ban.Entry
+	a.Nil(b.Iterate(func(entry *ban.Entry) bool {
+		entry.At = entry.At.UTC()
+		entry.Until = entry.Until.UTC()
+		got = append(got, entry)
+		return true
+	}))
+	a.Equal(entries[:2], got)
+}
+
+func TestDelayedStore(t *testing.T) {
+	a := assert.New(t)
+	db, clean := newTestDB(t)
+	defer clean()
+	d, err := NewDelayedStore(db)
+	a.Nil(err)
+
+	now := time.Unix(time.Now().Unix(), 0).UTC()
+	msgs := []*delayed.Message{
+		{ID: "0", Qos: packets.QOS_1, Topic: "a", Payload: []byte("0"), PublishAt: now},
+		{ID: "1", Qos: packets.QOS_0, Topic: "b", Payload: []byte("1"), Retained: true, PublishAt: now.Add(time.Minute)},
+		{ID: "2", Qos: packets.QOS_2, Topic: "c", Payload: []byte("2"), PublishAt: now},
+	}
+	for _, v := range msgs {
+		a.Nil(d.Save(v))
+	}
+	a.Nil(d.Remove("2"))
+	a.Nil(d.Remove("not-exist"))
+	var got []*delayed.Message
+	a.Nil(d.Iterate(func(msg *delayed.Message) bool {
+		msg.PublishAt = msg.PublishAt.UTC()
+		got = append(got, msg)
+		return true
+	}))
+	a.Equal(msgs[:2], got)
+}
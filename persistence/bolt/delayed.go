@@ -0,0 +1,63 @@
+package bolt
+
+import (
+	"encoding/json"
+
+	"go.etcd.io/bbolt"
+
+	"github.com/DrmagicE/gmqtt/persistence/delayed"
+)
+
+var _ delayed.Store = (*DelayedStore)(nil)
+
+// bucketDelayed contains the delayed messages keyed by the message id.
+var bucketDelayed = []byte("delayed")
+
+// DelayedStore is the BoltDB backed delayed.Store.
+type DelayedStore struct {
+	db *bbolt.DB
+}
+
+// NewDelayedStore returns a DelayedStore which stores the delayed messages in the db.
+func NewDelayedStore(db *bbolt.DB) (*DelayedStore, error) {
+	err := db.Update(func(tx *bbolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(bucketDelayed)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &DelayedStore{db: db}, nil
+}
+
+func (d *DelayedStore) Save(msg *delayed.Message) error {
+	v, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return d.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(bucketDelayed).Put([]byte(msg.ID), v)
+	})
+}
+
+func (d *DelayedStore) Remove(id string) error {
+	return d.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(bucketDelayed).Delete([]byte(id))
+	})
+}
+
+func (d *DelayedStore) Iterate(fn func(msg *delayed.Message) bool) error {
+	return d.db.View(func(tx *bbolt.Tx) error {
+		c := tx.Bucket(bucketDelayed).Cursor()
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			msg := &delayed.Message{}
+			if err := json.Unmarshal(v, msg); err != nil {
+				return err
+			}
+			if !fn(msg) {
+				return nil
+			}
+		}
+		return nil
+	})
+}
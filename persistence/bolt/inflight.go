@@ -0,0 +1,143 @@
+package bolt
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"sort"
+
+	"go.etcd.io/bbolt"
+
+	"github.com/DrmagicE/gmqtt/persistence/inflight"
+	"github.com/DrmagicE/gmqtt/persistence/queue"
+	"github.com/DrmagicE/gmqtt/pkg/packets"
+)
+
+var _ inflight.Store = (*InflightStore)(nil)
+
+// bucketInflight contains a nested bucket for each client, the elements are keyed by the packet id.
+var bucketInflight = []byte("inflight")
+
+type inflightRecord struct {
+	Seq uint64 `json:"seq"`
+	*inflight.Elem
+}
+
+// InflightStore is the BoltDB backed inflight.Store.
+type InflightStore struct {
+	db *bbolt.DB
+}
+
+// NewInflightStore returns a InflightStore which stores the inflight elements in the db.
+func NewInflightStore(db *bbolt.DB) (*InflightStore, error) {
+	err := db.Update(func(tx *bbolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(bucketInflight)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &InflightStore{db: db}, nil
+}
+
+func pidKey(pid packets.PacketID) []byte {
+	k := make([]byte, 2)
+	binary.BigEndian.PutUint16(k, pid)
+	return k
+}
+
+func putRecord(b *bbolt.Bucket, r *inflightRecord) error {
+	v, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	return b.Put(pidKey(r.Message.PacketID), v)
+}
+
+func (i *InflightStore) Add(clientID string, msg *queue.Message) error {
+	return i.db.Update(func(tx *bbolt.Tx) error {
+		parent := tx.Bucket(bucketInflight)
+		b, err := parent.CreateBucketIfNotExists([]byte(clientID))
+		if err != nil {
+			return err
+		}
+		seq, err := parent.NextSequence()
+		if err != nil {
+			return err
+		}
+		return putRecord(b, &inflightRecord{
+			Seq:  seq,
+			Elem: &inflight.Elem{Message: msg},
+		})
+	})
+}
+
+func (i *InflightStore) Release(clientID string, pid packets.PacketID) error {
+	return i.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(bucketInflight).Bucket([]byte(clientID))
+		if b == nil {
+			return nil
+		}
+		v := b.Get(pidKey(pid))
+		if v == nil {
+			return nil
+		}
+		r := &inflightRecord{}
+		if err := json.Unmarshal(v, r); err != nil {
+			return err
+		}
+		r.Elem = &inflight.Elem{
+			Message:  &queue.Message{Qos: packets.QOS_2, PacketID: pid},
+			Released: true,
+		}
+		return putRecord(b, r)
+	})
+}
+
+func (i *InflightStore) Remove(clientID string, pid packets.PacketID) error {
+	return i.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(bucketInflight).Bucket([]byte(clientID))
+		if b == nil {
+			return nil
+		}
+		return b.Delete(pidKey(pid))
+	})
+}
+
+func (i *InflightStore) Get(clientID string) ([]*inflight.Elem, error) {
+	var records []*inflightRecord
+	err := i.db.View(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(bucketInflight).Bucket([]byte(clientID))
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, v []byte) error {
+			r := &inflightRecord{}
+			if err := json.Unmarshal(v, r); err != nil {
+				return err
+			}
+			records = append(records, r)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].Seq < records[j].Seq
+	})
+	rs := make([]*inflight.Elem, len(records))
+	for k, v := range records {
+		rs[k] = v.Elem
+	}
+	return rs, nil
+}
+
+func (i *InflightStore) RemoveAll(clientID string) error {
+	return i.db.Update(func(tx *bbolt.Tx) error {
+		err := tx.Bucket(bucketInflight).DeleteBucket([]byte(clientID))
+		if err == bbolt.ErrBucketNotFound {
+			return nil
+		}
+		return err
+	})
+}
@@ -0,0 +1,28 @@
+// Package delayed defines the interface of the persistent store of the pending delayed messages,
+// which makes the delayed publishes survive the broker restarts.
+package delayed
+
+import "time"
+
+// Message is the persisted delayed message.
+type Message struct {
+	// ID is the unique id of the delayed message.
+	ID       string `json:"id"`
+	Qos      uint8  `json:"qos"`
+	Retained bool   `json:"retained"`
+	// Topic is the topic name to publish the message to, without the $delayed prefix.
+	Topic   string `json:"topic"`
+	Payload []byte `json:"payload"`
+	// PublishAt is the time when the message will be published.
+	PublishAt time.Time `json:"publish_at"`
+}
+
+// Store is the interface used by gmqtt.server to persist the pending delayed messages.
+type Store interface {
+	// Save adds the delayed message.
+	Save(msg *Message) error
+	// Remove removes the delayed message specified by the id.
+	Remove(id string) error
+	// Iterate iterates all delayed messages. If fn returns false, the iteration will be stopped.
+	Iterate(fn func(msg *Message) bool) error
+}
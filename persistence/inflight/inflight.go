@@ -0,0 +1,34 @@
+// Package inflight defines the interface of the persistent store of the inflight messages,
+// which makes the QoS 1 and QoS 2 flows of the clients with clean session = false survive the broker restarts.
+package inflight
+
+import (
+	"github.com/DrmagicE/gmqtt/persistence/queue"
+	"github.com/DrmagicE/gmqtt/pkg/packets"
+)
+
+// Elem is the persisted inflight element.
+type Elem struct {
+	// Message is the sent PUBLISH packet which is waiting for PUBACK or PUBREC.
+	// Only the packet id is kept once the message is released.
+	Message *queue.Message `json:"message"`
+	// Released indicates the PUBREC of the QoS 2 message has been received and the PUBREL has been sent,
+	// the element is waiting for PUBCOMP.
+	Released bool `json:"released"`
+}
+
+// Store is the interface used by gmqtt.server to persist the inflight messages of the clients while they are online.
+// The elements of each client are keyed by the packet id.
+type Store interface {
+	// Add adds the sent message of the client, an existing element with the same packet id is replaced.
+	Add(clientID string, msg *queue.Message) error
+	// Release marks the QoS 2 message identified by the packet id as released.
+	Release(clientID string, pid packets.PacketID) error
+	// Remove removes the element identified by the packet id.
+	Remove(clientID string, pid packets.PacketID) error
+	// Get returns the elements of the client in the order they were added.
+	// Releasing an element does not change its position.
+	Get(clientID string) ([]*Elem, error)
+	// RemoveAll removes all elements of the client.
+	RemoveAll(clientID string) error
+}
@@ -0,0 +1,31 @@
+// Package queue defines the interface of the persistent message queue of the offline sessions.
+package queue
+
+import (
+	"github.com/DrmagicE/gmqtt/pkg/packets"
+)
+
+// Message is the persisted PUBLISH packet.
+type Message struct {
+	Dup      bool             `json:"dup"`
+	Qos      uint8            `json:"qos"`
+	Retained bool             `json:"retained"`
+	Topic    string           `json:"topic"`
+	PacketID packets.PacketID `json:"packet_id"`
+	Payload  []byte           `json:"payload"`
+}
+
+// Store is the interface used by gmqtt.server to persist the message queues of the offline sessions,
+// so the queued messages can be recovered after a restart.
+// The messages of each client must be kept in order.
+type Store interface {
+	// Append appends the message to the end of the queue of the client.
+	Append(clientID string, msg *Message) error
+	// Replace replaces the whole queue of the client.
+	Replace(clientID string, msgs []*Message) error
+	// Get returns the messages in the queue of the client, in order.
+	// It returns an empty result if the client has no queue.
+	Get(clientID string) ([]*Message, error)
+	// Remove removes the queue of the client.
+	Remove(clientID string) error
+}
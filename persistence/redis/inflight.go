@@ -0,0 +1,130 @@
+package redis
+
+import (
+	"encoding/json"
+	"sort"
+	"strconv"
+
+	redigo "github.com/gomodule/redigo/redis"
+
+	"github.com/DrmagicE/gmqtt/persistence/inflight"
+	"github.com/DrmagicE/gmqtt/persistence/queue"
+	"github.com/DrmagicE/gmqtt/pkg/packets"
+)
+
+var _ inflight.Store = (*InflightStore)(nil)
+
+const (
+	// keyInflight is the prefix of the HASH of packet id -> encoded inflightRecord of each client.
+	keyInflight = "inflight:"
+	// keyInflightSeq is the counter which is used to keep the order of the inflight elements.
+	keyInflightSeq = "inflight_seq"
+)
+
+type inflightRecord struct {
+	Seq uint64 `json:"seq"`
+	*inflight.Elem
+}
+
+// InflightStore is the redis backed inflight.Store.
+type InflightStore struct {
+	pool   *redigo.Pool
+	prefix string
+	seqKey string
+}
+
+// NewInflightStore returns a InflightStore which uses the connections from the pool.
+func NewInflightStore(pool *redigo.Pool, opts ...Option) *InflightStore {
+	o := newOptions(opts)
+	return &InflightStore{
+		pool:   pool,
+		prefix: o.prefix + keyInflight,
+		seqKey: o.prefix + keyInflightSeq,
+	}
+}
+
+func pidField(pid packets.PacketID) string {
+	return strconv.Itoa(int(pid))
+}
+
+func (i *InflightStore) put(conn redigo.Conn, clientID string, r *inflightRecord) error {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	_, err = conn.Do("HSET", i.prefix+clientID, pidField(r.Message.PacketID), b)
+	return err
+}
+
+func (i *InflightStore) Add(clientID string, msg *queue.Message) error {
+	conn := i.pool.Get()
+	defer conn.Close()
+	seq, err := redigo.Uint64(conn.Do("INCR", i.seqKey))
+	if err != nil {
+		return err
+	}
+	return i.put(conn, clientID, &inflightRecord{
+		Seq:  seq,
+		Elem: &inflight.Elem{Message: msg},
+	})
+}
+
+func (i *InflightStore) Release(clientID string, pid packets.PacketID) error {
+	conn := i.pool.Get()
+	defer conn.Close()
+	b, err := redigo.Bytes(conn.Do("HGET", i.prefix+clientID, pidField(pid)))
+	if err == redigo.ErrNil {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	r := &inflightRecord{}
+	if err := json.Unmarshal(b, r); err != nil {
+		return err
+	}
+	r.Elem = &inflight.Elem{
+		Message:  &queue.Message{Qos: packets.QOS_2, PacketID: pid},
+		Released: true,
+	}
+	return i.put(conn, clientID, r)
+}
+
+func (i *InflightStore) Remove(clientID string, pid packets.PacketID) error {
+	conn := i.pool.Get()
+	defer conn.Close()
+	_, err := conn.Do("HDEL", i.prefix+clientID, pidField(pid))
+	return err
+}
+
+func (i *InflightStore) Get(clientID string) ([]*inflight.Elem, error) {
+	conn := i.pool.Get()
+	defer conn.Close()
+	values, err := redigo.ByteSlices(conn.Do("HVALS", i.prefix+clientID))
+	if err != nil {
+		return nil, err
+	}
+	records := make([]*inflightRecord, 0, len(values))
+	for _, v := range values {
+		r := &inflightRecord{}
+		if err := json.Unmarshal(v, r); err != nil {
+			return nil, err
+		}
+		records = append(records, r)
+	}
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].Seq < records[j].Seq
+	})
+	rs := make([]*inflight.Elem, len(records))
+	for k, v := range records {
+		rs[k] = v.Elem
+	}
+	return rs, nil
+}
+
+func (i *InflightStore) RemoveAll(clientID string) error {
+	conn := i.pool.Get()
+	defer conn.Close()
+	_, err := conn.Do("DEL", i.prefix+clientID)
+	return err
+}
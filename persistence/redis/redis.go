@@ -0,0 +1,187 @@
+// Package redis provides the redis backed session.Store, queue.Store and inflight.Store.
+package redis
+
+import (
+	"encoding/json"
+
+	redigo "github.com/gomodule/redigo/redis"
+
+	"github.com/DrmagicE/gmqtt/persistence/queue"
+	"github.com/DrmagicE/gmqtt/persistence/session"
+)
+
+var (
+	_ session.Store = (*SessionStore)(nil)
+	_ queue.Store   = (*QueueStore)(nil)
+)
+
+// DefaultKeyPrefix is the default prefix of the redis keys.
+const DefaultKeyPrefix = "gmqtt:"
+
+const (
+	// keySessions is the HASH of client id -> encoded session.
+	keySessions = "sessions"
+	// keyQueue is the prefix of the LIST of the encoded queued messages of each client.
+	keyQueue = "queue:"
+)
+
+// Option is the option of the stores.
+type Option func(o *options)
+
+type options struct {
+	prefix string
+}
+
+// WithKeyPrefix sets the prefix of the redis keys, default to DefaultKeyPrefix.
+func WithKeyPrefix(prefix string) Option {
+	return func(o *options) {
+		o.prefix = prefix
+	}
+}
+
+func newOptions(opts []Option) options {
+	o := options{prefix: DefaultKeyPrefix}
+	for _, fn := range opts {
+		fn(&o)
+	}
+	return o
+}
+
+// SessionStore is the redis backed session.Store.
+type SessionStore struct {
+	pool *redigo.Pool
+	key  string
+}
+
+// NewSessionStore returns a SessionStore which uses the connections from the pool.
+func NewSessionStore(pool *redigo.Pool, opts ...Option) *SessionStore {
+	o := newOptions(opts)
+	return &SessionStore{
+		pool: pool,
+		key:  o.prefix + keySessions,
+	}
+}
+
+func (s *SessionStore) Save(sess *session.Session) error {
+	b, err := json.Marshal(sess)
+	if err != nil {
+		return err
+	}
+	conn := s.pool.Get()
+	defer conn.Close()
+	_, err = conn.Do("HSET", s.key, sess.ClientID, b)
+	return err
+}
+
+func (s *SessionStore) Remove(clientID string) error {
+	conn := s.pool.Get()
+	defer conn.Close()
+	_, err := conn.Do("HDEL", s.key, clientID)
+	return err
+}
+
+func (s *SessionStore) Iterate(fn func(sess *session.Session) bool) error {
+	conn := s.pool.Get()
+	defer conn.Close()
+	cursor := "0"
+	for {
+		values, err := redigo.Values(conn.Do("HSCAN", s.key, cursor))
+		if err != nil {
+			return err
+		}
+		var fields [][]byte
+		if _, err := redigo.Scan(values, &cursor, &fields); err != nil {
+			return err
+		}
+		// fields is a flat list of client id and session pairs.
+		for i := 1; i < len(fields); i += 2 {
+			sess := &session.Session{}
+			if err := json.Unmarshal(fields[i], sess); err != nil {
+				return err
+			}
+			if !fn(sess) {
+				return nil
+			}
+		}
+		if cursor == "0" {
+			return nil
+		}
+	}
+}
+
+// QueueStore is the redis backed queue.Store.
+type QueueStore struct {
+	pool   *redigo.Pool
+	prefix string
+}
+
+// NewQueueStore returns a QueueStore which uses the connections from the pool.
+func NewQueueStore(pool *redigo.Pool, opts ...Option) *QueueStore {
+	o := newOptions(opts)
+	return &QueueStore{
+		pool:   pool,
+		prefix: o.prefix + keyQueue,
+	}
+}
+
+func (q *QueueStore) Append(clientID string, msg *queue.Message) error {
+	b, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	conn := q.pool.Get()
+	defer conn.Close()
+	_, err = conn.Do("RPUSH", q.prefix+clientID, b)
+	return err
+}
+
+func (q *QueueStore) Replace(clientID string, msgs []*queue.Message) error {
+	args := redigo.Args{q.prefix + clientID}
+	for _, v := range msgs {
+		b, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		args = append(args, b)
+	}
+	conn := q.pool.Get()
+	defer conn.Close()
+	if err := conn.Send("MULTI"); err != nil {
+		return err
+	}
+	if err := conn.Send("DEL", q.prefix+clientID); err != nil {
+		return err
+	}
+	if len(msgs) != 0 {
+		if err := conn.Send("RPUSH", args...); err != nil {
+			return err
+		}
+	}
+	_, err := conn.Do("EXEC")
+	return err
+}
+
+func (q *QueueStore) Get(clientID string) ([]*queue.Message, error) {
+	conn := q.pool.Get()
+	defer conn.Close()
+	values, err := redigo.ByteSlices(conn.Do("LRANGE", q.prefix+clientID, 0, -1))
+	if err != nil {
+		return nil, err
+	}
+	rs := make([]*queue.Message, 0, len(values))
+	for _, v := range values {
+		msg := &queue.Message{}
+		if err := json.Unmarshal(v, msg); err != nil {
+			return nil, err
+		}
+		rs = append(rs, msg)
+	}
+	return rs, nil
+}
+
+func (q *QueueStore) Remove(clientID string) error {
+	conn := q.pool.Get()
+	defer conn.Close()
+	_, err := conn.Do("DEL", q.prefix+clientID)
+	return err
+}
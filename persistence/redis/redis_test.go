@@ -0,0 +1,158 @@
+package redis
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	redigo "github.com/gomodule/redigo/redis"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/DrmagicE/gmqtt/persistence/inflight"
+	"github.com/DrmagicE/gmqtt/persistence/queue"
+	"github.com/DrmagicE/gmqtt/persistence/session"
+	"github.com/DrmagicE/gmqtt/pkg/packets"
+)
+
+func newTestPool(t *testing.T) (*redigo.Pool, *miniredis.Miniredis) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := mr.Addr()
+	return &redigo.Pool{
+		Dial: func() (redigo.Conn, error) {
+			return redigo.Dial("tcp", addr)
+		},
+	}, mr
+}
+
+func TestSessionStore(t *testing.T) {
+	a := assert.New(t)
+	pool, mr := newTestPool(t)
+	defer mr.Close()
+	s := NewSessionStore(pool)
+
+	now := time.Unix(time.Now().Unix(), 0).UTC()
+	sessions := map[string]*session.Session{
+		"id0": {
+			ClientID:       "id0",
+			DisconnectedAt: now,
+			Inflight: []*queue.Message{
+				{Qos: packets.QOS_1, Topic: "a/b", PacketID: 1, Payload: []byte("payload")},
+			},
+			AwaitRel:     []packets.PacketID{2},
+			UnackPublish: []packets.PacketID{3},
+		},
+		"id1": {
+			ClientID:       "id1",
+			DisconnectedAt: now,
+		},
+	}
+	for _, v := range sessions {
+		a.Nil(s.Save(v))
+	}
+	got := make(map[string]*session.Session)
+	a.Nil(s.Iterate(func(sess *session.Session) bool {
+		sess.DisconnectedAt = sess.DisconnectedAt.UTC()
+		got[sess.ClientID] = sess
+		return true
+	}))
+	a.Equal(sessions, got)
+
+	var n int
+	a.Nil(s.Iterate(func(sess *session.Session) bool {
+		n++
+		return false
+	}))
+	a.Equal(1, n)
+
+	a.Nil(s.Remove("id0"))
+	a.Nil(s.Remove("not_exists"))
+	got = make(map[string]*session.Session)
+	a.Nil(s.Iterate(func(sess *session.Session) bool {
+		got[sess.ClientID] = sess
+		return true
+	}))
+	a.Len(got, 1)
+	a.Contains(got, "id1")
+}
+
+func TestQueueStore(t *testing.T) {
+	a := assert.New(t)
+	pool, mr := newTestPool(t)
+	defer mr.Close()
+	q := NewQueueStore(pool, WithKeyPrefix("test:"))
+
+	msgs := []*queue.Message{
+		{Qos: packets.QOS_0, Topic: "a", Payload: []byte("0")},
+		{Qos: packets.QOS_1, Topic: "b", Payload: []byte("1"), Retained: true},
+		{Qos: packets.QOS_2, Topic: "c", Payload: []byte("2"), Dup: true, PacketID: 10},
+	}
+	for _, v := range msgs {
+		a.Nil(q.Append("id0", v))
+	}
+	a.True(mr.Exists("test:queue:id0"))
+	got, err := q.Get("id0")
+	a.Nil(err)
+	a.Equal(msgs, got)
+
+	a.Nil(q.Replace("id0", msgs[1:]))
+	got, err = q.Get("id0")
+	a.Nil(err)
+	a.Equal(msgs[1:], got)
+
+	a.Nil(q.Replace("id0", nil))
+	got, err = q.Get("id0")
+	a.Nil(err)
+	a.Len(got, 0)
+
+	a.Nil(q.Append("id1", msgs[0]))
+	a.Nil(q.Remove("id1"))
+	got, err = q.Get("id1")
+	a.Nil(err)
+	a.Len(got, 0)
+}
+
+func TestStore_Error(t *testing.T) {
+	a := assert.New(t)
+	pool, mr := newTestPool(t)
+	mr.Close()
+	s := NewSessionStore(pool)
+	q := NewQueueStore(pool)
+	a.NotNil(s.Save(&session.Session{ClientID: "id0"}))
+	a.NotNil(s.Iterate(func(sess *session.Session) bool { return true }))
+	a.NotNil(q.Append("id0", &queue.Message{}))
+	_, err := q.Get("id0")
+	a.NotNil(err)
+}
+
+func TestInflightStore(t *testing.T) {
+	a := assert.New(t)
+	pool, mr := newTestPool(t)
+	defer mr.Close()
+	i := NewInflightStore(pool)
+
+	msgs := []*queue.Message{
+		{Qos: packets.QOS_2, Topic: "a", Payload: []byte("0"), PacketID: 3},
+		{Qos: packets.QOS_1, Topic: "b", Payload: []byte("1"), PacketID: 1},
+		{Qos: packets.QOS_2, Topic: "c", Payload: []byte("2"), PacketID: 2},
+	}
+	for _, v := range msgs {
+		a.Nil(i.Add("id0", v))
+	}
+	a.Nil(i.Release("id0", 3))
+	a.Nil(i.Release("id0", 10))
+	a.Nil(i.Remove("id0", 1))
+	got, err := i.Get("id0")
+	a.Nil(err)
+	a.Equal([]*inflight.Elem{
+		{Message: &queue.Message{Qos: packets.QOS_2, PacketID: 3}, Released: true},
+		{Message: msgs[2]},
+	}, got)
+
+	a.Nil(i.RemoveAll("id0"))
+	got, err = i.Get("id0")
+	a.Nil(err)
+	a.Len(got, 0)
+}
@@ -0,0 +1,36 @@
+// Package session defines the interface of the persistent store of the offline sessions.
+package session
+
+import (
+	"time"
+
+	"github.com/DrmagicE/gmqtt/persistence/queue"
+	"github.com/DrmagicE/gmqtt/pkg/packets"
+)
+
+// Session is the persisted state of an offline session (clean session = false).
+// The subscriptions of the session are persisted by the subscription.Store,
+// and the queued messages are persisted by the queue.Store.
+type Session struct {
+	ClientID       string    `json:"client_id"`
+	DisconnectedAt time.Time `json:"disconnected_at"`
+	// Inflight is the QoS 1 and QoS 2 messages which have been sent but not acknowledged.
+	Inflight []*queue.Message `json:"inflight"`
+	// AwaitRel is the packet ids of the sent QoS 2 messages which are waiting for PUBCOMP.
+	AwaitRel []packets.PacketID `json:"await_rel"`
+	// UnackPublish is the packet ids of the received QoS 2 messages which are waiting for PUBREL.
+	UnackPublish []packets.PacketID `json:"unack_publish"`
+	// Attributes is the key/value attributes of the session set by the hooks and plugins.
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+// Store is the interface used by gmqtt.server to persist the offline sessions,
+// so the sessions can be recovered after a restart.
+type Store interface {
+	// Save adds or replaces the session.
+	Save(session *Session) error
+	// Remove removes the session of the client.
+	Remove(clientID string) error
+	// Iterate iterates all sessions. If fn returns false, the iteration will be stopped.
+	Iterate(fn func(session *Session) bool) error
+}
@@ -0,0 +1,264 @@
+package gmqtt
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.etcd.io/bbolt"
+	"go.uber.org/zap"
+
+	"github.com/DrmagicE/gmqtt/persistence/bolt"
+	persistence_session "github.com/DrmagicE/gmqtt/persistence/session"
+	"github.com/DrmagicE/gmqtt/pkg/packets"
+	"github.com/DrmagicE/gmqtt/subscription"
+	subscription_trie "github.com/DrmagicE/gmqtt/subscription/trie"
+)
+
+func newPersistentTestServer(t *testing.T, db *bbolt.DB, subStore subscription.Store, withInflight bool) *server {
+	sessions, err := bolt.NewSessionStore(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	queues, err := bolt.NewQueueStore(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := []Options{
+		WithLogger(zap.NewNop()),
+		WithSessionPersistence(sessions, queues),
+		WithSubscriptionStore(subStore),
+	}
+	if withInflight {
+		store, err := bolt.NewInflightStore(db)
+		if err != nil {
+			t.Fatal(err)
+		}
+		opts = append(opts, WithInflightPersistence(store))
+	}
+	s := NewServer(opts...)
+	s.tcpListener = append(s.tcpListener, &testListener{acceptReady: make(chan struct{})})
+	return s
+}
+
+func connectPersistentClient(srv *server) (*rwTestConn, packets.Packet) {
+	ln := srv.tcpListener[0].(*testListener)
+	conn := &rwTestConn{
+		closec:    make(chan struct{}),
+		readChan:  make(chan []byte, 1024),
+		writeChan: make(chan []byte, 1024),
+	}
+	ln.conn.PushBack(conn)
+	ln.acceptReady <- struct{}{}
+	connect := defaultConnectPacket()
+	connect.CleanSession = false
+	connect.WillFlag = false
+	connect.WillQos = packets.QOS_0
+	connect.WillTopic = nil
+	connect.WillMsg = nil
+	connect.ClientID = []byte("id")
+	writePacket(conn, connect)
+	p, _ := readPacketWithTimeOut(conn, time.Second)
+	return conn, p
+}
+
+func newTestBoltDB(t *testing.T) (*bbolt.DB, func()) {
+	dir, err := ioutil.TempDir("", "gmqtt-persistence")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := bbolt.Open(filepath.Join(dir, "test.db"), 0600, nil)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return db, func() {
+		db.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestSessionPersistence(t *testing.T) {
+	a := assert.New(t)
+	db, clean := newTestBoltDB(t)
+	defer clean()
+	subStore := subscription_trie.NewStore()
+
+	srv1 := newPersistentTestServer(t, db, subStore, false)
+	srv1.Run()
+	conn, _ := connectPersistentClient(srv1)
+	subStore.Subscribe("id", packets.Topic{Name: "a", Qos: packets.QOS_1})
+	conn.Close()
+	a.Eventually(func() bool {
+		srv1.mu.RLock()
+		defer srv1.mu.RUnlock()
+		_, ok := srv1.offlineClients["id"]
+		return ok
+	}, time.Second, 10*time.Millisecond)
+
+	srv1.PublishService().Publish(NewMessage("a", []byte("offline"), packets.QOS_1))
+	a.Eventually(func() bool {
+		msgs, err := srv1.queueStore.Get("id")
+		return err == nil && len(msgs) == 1
+	}, time.Second, 10*time.Millisecond)
+	a.Nil(srv1.Stop(context.Background()))
+
+	// restart the server with the same stores
+	srv2 := newPersistentTestServer(t, db, subStore, false)
+	srv2.Run()
+	defer srv2.Stop(context.Background())
+	srv2.mu.RLock()
+	_, ok := srv2.offlineClients["id"]
+	srv2.mu.RUnlock()
+	a.True(ok)
+	a.EqualValues(1, srv2.GetStatsManager().GetStats().MessageStats.QueuedCurrent)
+
+	conn, p := connectPersistentClient(srv2)
+	if a.IsType(&packets.Connack{}, p) {
+		a.EqualValues(1, p.(*packets.Connack).SessionPresent)
+	}
+	p, err := readPacketWithTimeOut(conn, time.Second)
+	a.Nil(err)
+	if a.IsType(&packets.Publish{}, p) {
+		a.Equal("a", string(p.(*packets.Publish).TopicName))
+		a.Equal([]byte("offline"), p.(*packets.Publish).Payload)
+	}
+	// the resumed session is removed from the stores.
+	a.Eventually(func() bool {
+		msgs, err := srv2.queueStore.Get("id")
+		return err == nil && len(msgs) == 0
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestSessionPersistence_Attributes(t *testing.T) {
+	a := assert.New(t)
+	db, clean := newTestBoltDB(t)
+	defer clean()
+	subStore := subscription_trie.NewStore()
+
+	srv1 := newPersistentTestServer(t, db, subStore, false)
+	srv1.Run()
+	conn, _ := connectPersistentClient(srv1)
+	srv1.Client("id").Session().Set("tenant", "t1")
+	conn.Close()
+	a.Eventually(func() bool {
+		srv1.mu.RLock()
+		defer srv1.mu.RUnlock()
+		_, ok := srv1.offlineClients["id"]
+		return ok
+	}, time.Second, 10*time.Millisecond)
+	a.Nil(srv1.Stop(context.Background()))
+
+	srv2 := newPersistentTestServer(t, db, subStore, false)
+	srv2.Run()
+	defer srv2.Stop(context.Background())
+	v, ok := srv2.Client("id").Session().Get("tenant")
+	a.True(ok)
+	a.Equal("t1", v)
+	connectPersistentClient(srv2)
+	v, _ = srv2.Client("id").Session().Get("tenant")
+	a.Equal("t1", v)
+}
+
+func TestInflightPersistence(t *testing.T) {
+	a := assert.New(t)
+	db, clean := newTestBoltDB(t)
+	defer clean()
+	subStore := subscription_trie.NewStore()
+
+	srv1 := newPersistentTestServer(t, db, subStore, true)
+	srv1.Run()
+	conn, _ := connectPersistentClient(srv1)
+	subStore.Subscribe("id",
+		packets.Topic{Name: "qos1", Qos: packets.QOS_1},
+		packets.Topic{Name: "qos2", Qos: packets.QOS_2},
+	)
+	srv1.PublishService().Publish(NewMessage("qos1", []byte("qos1"), packets.QOS_1))
+	p, err := readPacketWithTimeOut(conn, time.Second)
+	a.Nil(err)
+	if !a.IsType(&packets.Publish{}, p) {
+		return
+	}
+	qos1 := p.(*packets.Publish)
+	srv1.PublishService().Publish(NewMessage("qos2", []byte("qos2"), packets.QOS_2))
+	p, err = readPacketWithTimeOut(conn, time.Second)
+	a.Nil(err)
+	if !a.IsType(&packets.Publish{}, p) {
+		return
+	}
+	qos2 := p.(*packets.Publish)
+	// leave the qos1 message unacknowledged and release the qos2 message.
+	a.Nil(writePacket(conn, qos2.NewPubrec()))
+	p, err = readPacketWithTimeOut(conn, time.Second)
+	a.Nil(err)
+	a.IsType(&packets.Pubrel{}, p)
+	a.Eventually(func() bool {
+		elems, err := srv1.inflightStore.Get("id")
+		return err == nil && len(elems) == 2 && elems[1].Released
+	}, time.Second, 10*time.Millisecond)
+
+	// start a new server with the same stores, while the client of srv1 is still online.
+	srv2 := newPersistentTestServer(t, db, subStore, true)
+	srv2.Run()
+	defer srv2.Stop(context.Background())
+	defer srv1.Stop(context.Background())
+
+	conn, p = connectPersistentClient(srv2)
+	if a.IsType(&packets.Connack{}, p) {
+		a.EqualValues(1, p.(*packets.Connack).SessionPresent)
+	}
+	p, err = readPacketWithTimeOut(conn, time.Second)
+	a.Nil(err)
+	if a.IsType(&packets.Publish{}, p) {
+		pub := p.(*packets.Publish)
+		a.True(pub.Dup)
+		a.Equal(qos1.PacketID, pub.PacketID)
+		a.Equal(qos1.Payload, pub.Payload)
+	}
+	p, err = readPacketWithTimeOut(conn, time.Second)
+	a.Nil(err)
+	if a.IsType(&packets.Pubrel{}, p) {
+		a.Equal(qos2.PacketID, p.(*packets.Pubrel).PacketID)
+	}
+	a.Nil(writePacket(conn, &packets.Puback{PacketID: qos1.PacketID}))
+	a.Nil(writePacket(conn, &packets.Pubcomp{PacketID: qos2.PacketID}))
+	a.Eventually(func() bool {
+		elems, err := srv2.inflightStore.Get("id")
+		return err == nil && len(elems) == 0
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestSessionPersistence_Expiry(t *testing.T) {
+	a := assert.New(t)
+	db, clean := newTestBoltDB(t)
+	defer clean()
+	srv := newPersistentTestServer(t, db, subscription_trie.NewStore(), false)
+	srv.config.SessionExpiryInterval = time.Minute
+	srv.config.SessionExpiryCheckInterval = 10 * time.Millisecond
+	a.Nil(srv.sessionStore.Save(&persistence_session.Session{
+		ClientID:       "expired",
+		DisconnectedAt: time.Now().Add(-time.Hour),
+	}))
+	a.Nil(srv.sessionStore.Save(&persistence_session.Session{
+		ClientID:       "id",
+		DisconnectedAt: time.Now(),
+	}))
+	srv.Run()
+	defer srv.Stop(context.Background())
+	a.Eventually(func() bool {
+		srv.mu.RLock()
+		defer srv.mu.RUnlock()
+		_, ok := srv.clients["expired"]
+		return !ok
+	}, time.Second, 10*time.Millisecond)
+	var ids []string
+	a.Nil(srv.sessionStore.Iterate(func(sess *persistence_session.Session) bool {
+		ids = append(ids, sess.ClientID)
+		return true
+	}))
+	a.Equal([]string{"id"}, ids)
+}
@@ -0,0 +1,613 @@
+// Package config provides the YAML configuration file of the broker, it covers the listeners, TLS,
+// persistence backends, plugins, logging and limits. The missing keys are set to their defaults,
+// and the file is validated on loading, the errors point at the offending keys, e.g:
+//
+//	listeners[0].tls.cert_file: is required
+//
+// See cmd/gmqttd for the command which runs the broker from the configuration file.
+package config
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+	"gopkg.in/yaml.v2"
+
+	"github.com/DrmagicE/gmqtt"
+	"github.com/DrmagicE/gmqtt/pkg/packets"
+)
+
+// The persistence types.
+const (
+	PersistenceMemory = "memory"
+	PersistenceBolt   = "bolt"
+	PersistenceRedis  = "redis"
+)
+
+// Config is the configuration file of the broker.
+type Config struct {
+	Listeners   []Listener  `yaml:"listeners"`
+	Persistence Persistence `yaml:"persistence"`
+	Plugins     Plugins     `yaml:"plugins"`
+	Log         Log         `yaml:"log"`
+	Limits      Limits      `yaml:"limits"`
+}
+
+// Listener is the configuration of a listener.
+type Listener struct {
+	// Address is the tcp address, e.g: ":1883", or the unix socket path prefixed with "unix://".
+	Address string `yaml:"address"`
+	// TLS enables TLS on the listener.
+	TLS *TLS `yaml:"tls"`
+	// Websocket serves the MQTT over websocket on the address instead of the raw tcp.
+	Websocket *Websocket `yaml:"websocket"`
+	// ProxyProtocol requires the PROXY protocol header on the connections, see pkg/proxyproto.
+	ProxyProtocol bool `yaml:"proxy_protocol"`
+	// Profile overrides the limits for the clients of the listener.
+	Profile *Profile `yaml:"profile"`
+}
+
+// Profile is the configuration of a listener profile, see gmqtt.ListenerProfile.
+type Profile struct {
+	// ProtocolVersions is the allowed protocol versions, "3.1" and "3.1.1". Empty means 3.1.1 only.
+	ProtocolVersions []string `yaml:"protocol_versions"`
+	// AuthPlugins is the plugins which authenticate the clients. Not set means all plugins, and [] means none.
+	AuthPlugins         []string `yaml:"auth_plugins"`
+	MaxPacketSize       int      `yaml:"max_packet_size"`
+	MaxPublishRate      float64  `yaml:"max_publish_rate"`
+	MaxPublishBytesRate float64  `yaml:"max_publish_bytes_rate"`
+	// Tenant is the tenant of the clients, see tenancy.ByListenerProfile.
+	Tenant string `yaml:"tenant"`
+}
+
+// protocolLevels maps the protocol versions of the listener profiles to the protocol levels.
+var protocolLevels = map[string]byte{
+	"3.1":   packets.Version31,
+	"3.1.1": packets.Version311,
+}
+
+// TLS is the TLS configuration of a listener.
+type TLS struct {
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+	// CAFile is the CA certificates to verify the client certificates.
+	CAFile string `yaml:"ca_file"`
+	// VerifyClient requires and verifies the client certificates, it requires CAFile.
+	VerifyClient bool `yaml:"verify_client"`
+}
+
+// Websocket is the websocket configuration of a listener.
+type Websocket struct {
+	// Path is the url path, default to "/".
+	Path string `yaml:"path"`
+}
+
+// Persistence is the configuration of the persistence backend.
+type Persistence struct {
+	// Type is one of memory, bolt and redis, default to memory which means the sessions are not persisted.
+	Type  string `yaml:"type"`
+	Bolt  Bolt   `yaml:"bolt"`
+	Redis Redis  `yaml:"redis"`
+}
+
+// Bolt is the configuration of the bolt persistence.
+type Bolt struct {
+	// Path is the path of the database file.
+	Path string `yaml:"path"`
+}
+
+// Redis is the configuration of the redis persistence.
+type Redis struct {
+	Addr      string `yaml:"addr"`
+	Password  string `yaml:"password"`
+	Database  int    `yaml:"database"`
+	KeyPrefix string `yaml:"key_prefix"`
+	MaxIdle   int    `yaml:"max_idle"`
+}
+
+// Plugins is the configuration of the plugins, the plugin is disabled if its key is absent.
+type Plugins struct {
+	Management *Management `yaml:"management"`
+	Prometheus *Prometheus `yaml:"prometheus"`
+	Admin      *Admin      `yaml:"admin"`
+	ACL        *ACL        `yaml:"acl"`
+	Passwdfile *Passwdfile `yaml:"passwdfile"`
+	ExHook     []ExHook    `yaml:"exhook"`
+}
+
+// Management is the configuration of the management plugin.
+type Management struct {
+	Address string `yaml:"address"`
+	// Accounts is the username and password pairs of the basic auth.
+	Accounts map[string]string `yaml:"accounts"`
+	// Token is the bearer token.
+	Token string `yaml:"token"`
+}
+
+// Prometheus is the configuration of the prometheus plugin.
+type Prometheus struct {
+	Address string `yaml:"address"`
+	// Path is the url path of the metrics, default to "/metrics".
+	Path string `yaml:"path"`
+}
+
+// Admin is the configuration of the admin plugin.
+type Admin struct {
+	Address string `yaml:"address"`
+}
+
+// ACL is the configuration of the acl plugin.
+type ACL struct {
+	// File is the JSON rule file.
+	File string `yaml:"file"`
+	// NoMatch is the permission when no rule matches, allow or deny, default to deny.
+	NoMatch string `yaml:"no_match"`
+}
+
+// Passwdfile is the configuration of the passwdfile plugin.
+type Passwdfile struct {
+	File string `yaml:"file"`
+}
+
+// ExHook is the configuration of an exhook plugin, which delegates the hooks to an external HookProvider service.
+type ExHook struct {
+	// Name is the name of the plugin, default to "exhook". The names must be unique.
+	Name string `yaml:"name"`
+	// Address is the address of the HookProvider service, it is ignored if Command is set.
+	Address string `yaml:"address"`
+	// Command is the path and arguments of the external plugin process which serves the HookProvider service,
+	// the process is restarted if it exits.
+	Command []string `yaml:"command"`
+	// FailPolicy is the behaviour of the decision hooks when the service is unavailable, closed or open, default to closed.
+	FailPolicy string `yaml:"fail_policy"`
+}
+
+// Log is the configuration of the logger.
+type Log struct {
+	// Level is one of debug, info, warn and error, default to info.
+	Level string `yaml:"level"`
+	// Format is json or console, default to json.
+	Format string `yaml:"format"`
+	// Modules overrides the levels of the log modules, e.g: "subscription: debug", see gmqtt.Logger.
+	Modules map[string]string `yaml:"modules"`
+}
+
+// Limits is the configuration of the server limits, see gmqtt.Config for the details.
+type Limits struct {
+	RetryInterval             time.Duration `yaml:"retry_interval"`
+	SessionExpiryInterval     time.Duration `yaml:"session_expiry_interval"`
+	QueueQos0Messages         bool          `yaml:"queue_qos0_messages"`
+	MaxInflight               int           `yaml:"max_inflight"`
+	MaxAwaitRel               int           `yaml:"max_await_rel"`
+	MaxMsgQueue               int           `yaml:"max_msg_queue"`
+	MaxMsgQueueBytes          int           `yaml:"max_msg_queue_bytes"`
+	MessageExpiry             time.Duration `yaml:"message_expiry"`
+	MaxConcurrentAuth         int           `yaml:"max_concurrent_auth"`
+	AuthWaitTimeout           time.Duration `yaml:"auth_wait_timeout"`
+	MaxClientIDLength         int           `yaml:"max_client_id_length"`
+	MaxRetainedMessages       int           `yaml:"max_retained_messages"`
+	MaxRetainedPayloadSize    int           `yaml:"max_retained_payload_size"`
+	WillDelayInterval         time.Duration `yaml:"will_delay_interval"`
+	SysInterval               time.Duration `yaml:"sys_interval"`
+	MaxPublishRate            float64       `yaml:"max_publish_rate"`
+	MaxPublishBytesRate       float64       `yaml:"max_publish_bytes_rate"`
+	MaxConnectionsPerListener int           `yaml:"max_connections_per_listener"`
+	MaxConnectionsPerIP       int           `yaml:"max_connections_per_ip"`
+	DelayedPublish            bool          `yaml:"delayed_publish"`
+	MaxGrantedQos             uint8         `yaml:"max_granted_qos"`
+	NoWildcardSubscriptions   bool          `yaml:"no_wildcard_subscriptions"`
+	NoSharedSubscriptions     bool          `yaml:"no_shared_subscriptions"`
+	MaxSubscriptionsPerClient int           `yaml:"max_subscriptions_per_client"`
+	MaxTopicHistory           int           `yaml:"max_topic_history"`
+	MaxTopicHistoryBytes      int           `yaml:"max_topic_history_bytes"`
+	MaxHistoryTopics          int           `yaml:"max_history_topics"`
+	DisconnectOnCertExpiry    bool          `yaml:"disconnect_on_cert_expiry"`
+	CredentialExpiryNotice    time.Duration `yaml:"credential_expiry_notice"`
+	FanOutWorkers             int           `yaml:"fan_out_workers"`
+	FanOutQueueLen            int           `yaml:"fan_out_queue_len"`
+
+	// QueuePriorities is matched in order, the first matched QueuePriority applies.
+	QueuePriorities []QueuePriority `yaml:"queue_priorities"`
+}
+
+// QueuePriority is the priority of the queued messages of the topics matching the topic filter, see gmqtt.QueuePriority.
+type QueuePriority struct {
+	TopicFilter string `yaml:"topic_filter"`
+	Priority    int    `yaml:"priority"`
+}
+
+// Default returns the default configuration, which serves MQTT on ":1883" without persistence and plugins.
+func Default() Config {
+	c := gmqtt.DefaultConfig
+	return Config{
+		Listeners: []Listener{
+			{Address: ":1883"},
+		},
+		Persistence: Persistence{
+			Type: PersistenceMemory,
+		},
+		Log: Log{
+			Level:  "info",
+			Format: "json",
+		},
+		Limits: Limits{
+			RetryInterval:             c.RetryInterval,
+			SessionExpiryInterval:     c.SessionExpiryInterval,
+			QueueQos0Messages:         c.QueueQos0Messages,
+			MaxInflight:               c.MaxInflight,
+			MaxAwaitRel:               c.MaxAwaitRel,
+			MaxMsgQueue:               c.MaxMsgQueue,
+			MaxMsgQueueBytes:          c.MaxMsgQueueBytes,
+			MessageExpiry:             c.MessageExpiry,
+			MaxConcurrentAuth:         c.MaxConcurrentAuth,
+			AuthWaitTimeout:           c.AuthWaitTimeout,
+			MaxClientIDLength:         c.MaxClientIDLength,
+			MaxRetainedMessages:       c.MaxRetainedMessages,
+			MaxRetainedPayloadSize:    c.MaxRetainedPayloadSize,
+			WillDelayInterval:         c.WillDelayInterval,
+			SysInterval:               c.SysInterval,
+			MaxPublishRate:            c.MaxPublishRate,
+			MaxPublishBytesRate:       c.MaxPublishBytesRate,
+			MaxConnectionsPerListener: c.MaxConnectionsPerListener,
+			MaxConnectionsPerIP:       c.MaxConnectionsPerIP,
+			DelayedPublish:            c.DelayedPublish,
+			MaxGrantedQos:             c.MaxGrantedQos,
+			NoWildcardSubscriptions:   c.NoWildcardSubscriptions,
+			NoSharedSubscriptions:     c.NoSharedSubscriptions,
+			MaxSubscriptionsPerClient: c.MaxSubscriptionsPerClient,
+			MaxTopicHistory:           c.MaxTopicHistory,
+			MaxTopicHistoryBytes:      c.MaxTopicHistoryBytes,
+			MaxHistoryTopics:          c.MaxHistoryTopics,
+			DisconnectOnCertExpiry:    c.DisconnectOnCertExpiry,
+			CredentialExpiryNotice:    c.CredentialExpiryNotice,
+			FanOutWorkers:             c.FanOutWorkers,
+			FanOutQueueLen:            c.FanOutQueueLen,
+		},
+	}
+}
+
+// Parse parses the YAML configuration on top of the defaults and validates it.
+// The unknown keys are rejected.
+func Parse(b []byte) (Config, error) {
+	c := Default()
+	if err := yaml.UnmarshalStrict(b, &c); err != nil {
+		return c, err
+	}
+	return c, c.Validate()
+}
+
+// Load reads and parses the configuration file.
+func Load(path string) (Config, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return Default(), err
+	}
+	c, err := Parse(b)
+	if err != nil {
+		return c, fmt.Errorf("%s: %s", path, err)
+	}
+	return c, nil
+}
+
+// FieldError is the validation error of a key.
+type FieldError struct {
+	// Key is the path of the key, e.g: listeners[0].tls.cert_file.
+	Key string
+	Msg string
+}
+
+func (e *FieldError) Error() string {
+	return e.Key + ": " + e.Msg
+}
+
+// Errors is the validation errors returned by Validate.
+type Errors []*FieldError
+
+func (e Errors) Error() string {
+	s := make([]string, len(e))
+	for i, v := range e {
+		s[i] = v.Error()
+	}
+	return strings.Join(s, "\n")
+}
+
+type validator struct {
+	errs Errors
+}
+
+func (v *validator) errorf(key string, format string, args ...interface{}) {
+	v.errs = append(v.errs, &FieldError{Key: key, Msg: fmt.Sprintf(format, args...)})
+}
+
+func (v *validator) required(key string, value string) {
+	if value == "" {
+		v.errorf(key, "is required")
+	}
+}
+
+func (v *validator) file(key string, path string) {
+	if path == "" {
+		v.errorf(key, "is required")
+		return
+	}
+	if _, err := os.Stat(path); err != nil {
+		v.errorf(key, "%s", err)
+	}
+}
+
+func (v *validator) address(key string, addr string) {
+	if addr == "" {
+		v.errorf(key, "is required")
+		return
+	}
+	if strings.HasPrefix(addr, "unix://") {
+		return
+	}
+	if _, _, err := net.SplitHostPort(strings.TrimPrefix(addr, "tcp://")); err != nil {
+		v.errorf(key, "invalid address %q", addr)
+	}
+}
+
+func (v *validator) nonNegative(key string, value float64) {
+	if value < 0 {
+		v.errorf(key, "must not be negative")
+	}
+}
+
+// Validate validates the configuration, the returned error is Errors which contains all the invalid keys.
+func (c *Config) Validate() error {
+	v := &validator{}
+	if len(c.Listeners) == 0 {
+		v.errorf("listeners", "at least one listener is required")
+	}
+	addrs := make(map[string]bool)
+	for i, l := range c.Listeners {
+		key := fmt.Sprintf("listeners[%d]", i)
+		v.address(key+".address", l.Address)
+		if addrs[l.Address] {
+			v.errorf(key+".address", "duplicate address %q", l.Address)
+		}
+		addrs[l.Address] = true
+		if l.TLS != nil {
+			v.file(key+".tls.cert_file", l.TLS.CertFile)
+			v.file(key+".tls.key_file", l.TLS.KeyFile)
+			if l.TLS.CAFile != "" {
+				v.file(key+".tls.ca_file", l.TLS.CAFile)
+			} else if l.TLS.VerifyClient {
+				v.errorf(key+".tls.ca_file", "is required by verify_client")
+			}
+		}
+		if l.Websocket != nil {
+			if strings.HasPrefix(l.Address, "unix://") {
+				v.errorf(key+".address", "unix socket is not supported by websocket")
+			}
+			if l.ProxyProtocol {
+				v.errorf(key+".proxy_protocol", "is not supported by websocket")
+			}
+			if l.TLS != nil && l.TLS.CAFile != "" {
+				v.errorf(key+".tls.ca_file", "is not supported by websocket")
+			}
+		}
+		if p := l.Profile; p != nil {
+			for j, version := range p.ProtocolVersions {
+				if _, ok := protocolLevels[version]; !ok {
+					v.errorf(fmt.Sprintf("%s.profile.protocol_versions[%d]", key, j),
+						"unknown version %q, must be one of 3.1 and 3.1.1", version)
+				}
+			}
+			v.nonNegative(key+".profile.max_packet_size", float64(p.MaxPacketSize))
+			v.nonNegative(key+".profile.max_publish_rate", p.MaxPublishRate)
+			v.nonNegative(key+".profile.max_publish_bytes_rate", p.MaxPublishBytesRate)
+		}
+	}
+
+	switch c.Persistence.Type {
+	case PersistenceMemory:
+	case PersistenceBolt:
+		v.required("persistence.bolt.path", c.Persistence.Bolt.Path)
+	case PersistenceRedis:
+		v.required("persistence.redis.addr", c.Persistence.Redis.Addr)
+	default:
+		v.errorf("persistence.type", "unknown type %q, must be one of memory, bolt and redis", c.Persistence.Type)
+	}
+
+	p := c.Plugins
+	if p.Management != nil {
+		v.address("plugins.management.address", p.Management.Address)
+	}
+	if p.Prometheus != nil {
+		v.address("plugins.prometheus.address", p.Prometheus.Address)
+	}
+	if p.Admin != nil {
+		v.address("plugins.admin.address", p.Admin.Address)
+	}
+	if p.ACL != nil {
+		v.file("plugins.acl.file", p.ACL.File)
+		if p.ACL.NoMatch != "" && p.ACL.NoMatch != "allow" && p.ACL.NoMatch != "deny" {
+			v.errorf("plugins.acl.no_match", "unknown permission %q, must be allow or deny", p.ACL.NoMatch)
+		}
+	}
+	if p.Passwdfile != nil {
+		v.file("plugins.passwdfile.file", p.Passwdfile.File)
+	}
+	names := make(map[string]bool)
+	for i, e := range p.ExHook {
+		key := fmt.Sprintf("plugins.exhook[%d]", i)
+		name := e.Name
+		if name == "" {
+			name = "exhook"
+		}
+		if names[name] {
+			v.errorf(key+".name", "duplicate name %q", name)
+		}
+		names[name] = true
+		if len(e.Command) == 0 {
+			v.required(key+".address", e.Address)
+		}
+		if e.FailPolicy != "" && e.FailPolicy != "closed" && e.FailPolicy != "open" {
+			v.errorf(key+".fail_policy", "unknown fail policy %q, must be closed or open", e.FailPolicy)
+		}
+	}
+
+	var level zapcore.Level
+	if err := level.UnmarshalText([]byte(c.Log.Level)); err != nil {
+		v.errorf("log.level", "unknown level %q", c.Log.Level)
+	}
+	for module, l := range c.Log.Modules {
+		if err := level.UnmarshalText([]byte(l)); err != nil {
+			v.errorf("log.modules."+module, "unknown level %q", l)
+		}
+	}
+	if c.Log.Format != "json" && c.Log.Format != "console" {
+		v.errorf("log.format", "unknown format %q, must be json or console", c.Log.Format)
+	}
+
+	l := c.Limits
+	v.nonNegative("limits.retry_interval", float64(l.RetryInterval))
+	if l.RetryInterval == 0 {
+		v.errorf("limits.retry_interval", "must be positive")
+	}
+	v.nonNegative("limits.session_expiry_interval", float64(l.SessionExpiryInterval))
+	if l.MaxInflight <= 0 || l.MaxInflight > 65535 {
+		v.errorf("limits.max_inflight", "must be between 1 and 65535")
+	}
+	if l.MaxAwaitRel <= 0 {
+		v.errorf("limits.max_await_rel", "must be positive")
+	}
+	if l.MaxMsgQueue <= 0 {
+		v.errorf("limits.max_msg_queue", "must be positive")
+	}
+	v.nonNegative("limits.max_msg_queue_bytes", float64(l.MaxMsgQueueBytes))
+	v.nonNegative("limits.message_expiry", float64(l.MessageExpiry))
+	v.nonNegative("limits.max_concurrent_auth", float64(l.MaxConcurrentAuth))
+	v.nonNegative("limits.auth_wait_timeout", float64(l.AuthWaitTimeout))
+	v.nonNegative("limits.max_client_id_length", float64(l.MaxClientIDLength))
+	v.nonNegative("limits.max_retained_messages", float64(l.MaxRetainedMessages))
+	v.nonNegative("limits.max_retained_payload_size", float64(l.MaxRetainedPayloadSize))
+	v.nonNegative("limits.will_delay_interval", float64(l.WillDelayInterval))
+	v.nonNegative("limits.sys_interval", float64(l.SysInterval))
+	v.nonNegative("limits.max_publish_rate", l.MaxPublishRate)
+	v.nonNegative("limits.max_publish_bytes_rate", l.MaxPublishBytesRate)
+	v.nonNegative("limits.max_connections_per_listener", float64(l.MaxConnectionsPerListener))
+	v.nonNegative("limits.max_connections_per_ip", float64(l.MaxConnectionsPerIP))
+	if l.MaxGrantedQos > packets.QOS_2 {
+		v.errorf("limits.max_granted_qos", "must be 0, 1 or 2")
+	}
+	v.nonNegative("limits.max_subscriptions_per_client", float64(l.MaxSubscriptionsPerClient))
+	v.nonNegative("limits.max_topic_history", float64(l.MaxTopicHistory))
+	v.nonNegative("limits.max_topic_history_bytes", float64(l.MaxTopicHistoryBytes))
+	v.nonNegative("limits.max_history_topics", float64(l.MaxHistoryTopics))
+	v.nonNegative("limits.credential_expiry_notice", float64(l.CredentialExpiryNotice))
+	v.nonNegative("limits.fan_out_workers", float64(l.FanOutWorkers))
+	v.nonNegative("limits.fan_out_queue_len", float64(l.FanOutQueueLen))
+	for i, p := range l.QueuePriorities {
+		if !packets.ValidTopicFilter([]byte(p.TopicFilter)) {
+			v.errorf(fmt.Sprintf("limits.queue_priorities[%d].topic_filter", i), "invalid topic filter %q", p.TopicFilter)
+		}
+	}
+
+	if len(v.errs) != 0 {
+		return v.errs
+	}
+	return nil
+}
+
+// ServerConfig returns the server config with the limits applied.
+func (c *Config) ServerConfig() gmqtt.Config {
+	config := gmqtt.DefaultConfig
+	l := c.Limits
+	config.RetryInterval = l.RetryInterval
+	config.RetryCheckInterval = l.RetryInterval
+	config.SessionExpiryInterval = l.SessionExpiryInterval
+	config.QueueQos0Messages = l.QueueQos0Messages
+	config.MaxInflight = l.MaxInflight
+	config.MaxAwaitRel = l.MaxAwaitRel
+	config.MaxMsgQueue = l.MaxMsgQueue
+	config.MaxMsgQueueBytes = l.MaxMsgQueueBytes
+	config.MessageExpiry = l.MessageExpiry
+	config.MaxConcurrentAuth = l.MaxConcurrentAuth
+	config.AuthWaitTimeout = l.AuthWaitTimeout
+	config.MaxClientIDLength = l.MaxClientIDLength
+	config.MaxRetainedMessages = l.MaxRetainedMessages
+	config.MaxRetainedPayloadSize = l.MaxRetainedPayloadSize
+	config.WillDelayInterval = l.WillDelayInterval
+	config.SysInterval = l.SysInterval
+	config.MaxPublishRate = l.MaxPublishRate
+	config.MaxPublishBytesRate = l.MaxPublishBytesRate
+	config.MaxConnectionsPerListener = l.MaxConnectionsPerListener
+	config.MaxConnectionsPerIP = l.MaxConnectionsPerIP
+	config.DelayedPublish = l.DelayedPublish
+	config.MaxGrantedQos = l.MaxGrantedQos
+	config.NoWildcardSubscriptions = l.NoWildcardSubscriptions
+	config.NoSharedSubscriptions = l.NoSharedSubscriptions
+	config.MaxSubscriptionsPerClient = l.MaxSubscriptionsPerClient
+	config.MaxTopicHistory = l.MaxTopicHistory
+	config.MaxTopicHistoryBytes = l.MaxTopicHistoryBytes
+	config.MaxHistoryTopics = l.MaxHistoryTopics
+	config.DisconnectOnCertExpiry = l.DisconnectOnCertExpiry
+	config.CredentialExpiryNotice = l.CredentialExpiryNotice
+	config.FanOutWorkers = l.FanOutWorkers
+	config.FanOutQueueLen = l.FanOutQueueLen
+	for _, p := range l.QueuePriorities {
+		config.QueuePriorities = append(config.QueuePriorities, gmqtt.QueuePriority{
+			TopicFilter: p.TopicFilter,
+			Priority:    p.Priority,
+		})
+	}
+	return config
+}
+
+// ListenerProfile returns the gmqtt.ListenerProfile of the profile. The publish rate limits of the profile
+// override the limits in the config only if one of them is set.
+func (p *Profile) ListenerProfile() gmqtt.ListenerProfile {
+	profile := gmqtt.ListenerProfile{
+		AuthPlugins:     p.AuthPlugins,
+		MaxRemainLength: p.MaxPacketSize,
+		Tenant:          p.Tenant,
+	}
+	for _, version := range p.ProtocolVersions {
+		profile.ProtocolLevels = append(profile.ProtocolLevels, protocolLevels[version])
+	}
+	if p.MaxPublishRate != 0 || p.MaxPublishBytesRate != 0 {
+		profile.RateLimit = &gmqtt.RateLimit{
+			MsgRate:   p.MaxPublishRate,
+			BytesRate: p.MaxPublishBytesRate,
+		}
+	}
+	return profile
+}
+
+// TLSConfig loads the certificates and returns the tls.Config of the listener.
+func (t *TLS) TLSConfig() (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	config := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+	}
+	if t.CAFile != "" {
+		b, err := ioutil.ReadFile(t.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(b) {
+			return nil, errors.New("no valid certificate in " + t.CAFile)
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+		if t.VerifyClient {
+			config.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	}
+	return config, nil
+}
@@ -0,0 +1,175 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/DrmagicE/gmqtt"
+	"github.com/DrmagicE/gmqtt/pkg/packets"
+)
+
+func TestParse_Default(t *testing.T) {
+	a := assert.New(t)
+	c, err := Parse(nil)
+	a.NoError(err)
+	a.Equal(Default(), c)
+	a.Equal(gmqtt.DefaultConfig, c.ServerConfig())
+}
+
+func TestParse(t *testing.T) {
+	a := assert.New(t)
+	c, err := Parse([]byte(`
+listeners:
+  - address: ":1883"
+  - address: "unix:///tmp/gmqtt.sock"
+  - address: ":8080"
+    websocket:
+      path: /ws
+    profile:
+      protocol_versions: ["3.1", "3.1.1"]
+      auth_plugins: []
+      max_packet_size: 1024
+      max_publish_rate: 10
+      tenant: acme
+persistence:
+  type: redis
+  redis:
+    addr: 127.0.0.1:6379
+plugins:
+  management:
+    address: ":8081"
+    accounts:
+      admin: admin
+log:
+  level: debug
+limits:
+  retry_interval: 5s
+  max_inflight: 10
+  max_publish_rate: 1.5
+`))
+	a.NoError(err)
+	a.Len(c.Listeners, 3)
+	a.Equal("unix:///tmp/gmqtt.sock", c.Listeners[1].Address)
+	a.Equal("/ws", c.Listeners[2].Websocket.Path)
+	a.Nil(c.Listeners[0].Profile)
+	a.Equal(gmqtt.ListenerProfile{
+		ProtocolLevels:  []byte{packets.Version31, packets.Version311},
+		AuthPlugins:     []string{},
+		MaxRemainLength: 1024,
+		RateLimit:       &gmqtt.RateLimit{MsgRate: 10},
+		Tenant:          "acme",
+	}, c.Listeners[2].Profile.ListenerProfile())
+	a.Equal(PersistenceRedis, c.Persistence.Type)
+	a.Equal(map[string]string{"admin": "admin"}, c.Plugins.Management.Accounts)
+	a.Nil(c.Plugins.Admin)
+	a.Equal("debug", c.Log.Level)
+	a.Equal("json", c.Log.Format)
+
+	config := c.ServerConfig()
+	a.Equal(5*time.Second, config.RetryInterval)
+	a.Equal(10, config.MaxInflight)
+	a.Equal(1.5, config.MaxPublishRate)
+	// the absent keys are set to the defaults.
+	a.Equal(gmqtt.DefaultConfig.MaxMsgQueue, config.MaxMsgQueue)
+}
+
+func TestParse_UnknownKey(t *testing.T) {
+	a := assert.New(t)
+	_, err := Parse([]byte(`
+limits:
+  max_inflite: 10
+`))
+	a.Error(err)
+	a.Contains(err.Error(), "line 3")
+	a.Contains(err.Error(), "max_inflite")
+}
+
+func TestValidate(t *testing.T) {
+	a := assert.New(t)
+	_, err := Parse([]byte(`
+listeners:
+  - address: "1883"
+  - address: ":8883"
+    tls:
+      cert_file: not_exist.crt
+      key_file: not_exist.key
+      verify_client: true
+  - address: ":8883"
+    websocket: {}
+    proxy_protocol: true
+    profile:
+      protocol_versions: ["5"]
+      max_packet_size: -1
+persistence:
+  type: mysql
+plugins:
+  acl:
+    file: ""
+    no_match: reject
+  exhook:
+    - fail_policy: maybe
+    - command: [/usr/local/bin/provider]
+log:
+  level: verbose
+  modules:
+    subscription: loud
+limits:
+  max_inflight: 0
+  max_publish_rate: -1
+  max_granted_qos: 3
+  queue_priorities:
+    - topic_filter: "alarms/#/a"
+      priority: 1
+`))
+	errs, ok := err.(Errors)
+	a.True(ok)
+	var keys []string
+	for _, v := range errs {
+		keys = append(keys, v.Key)
+	}
+	a.Equal([]string{
+		"listeners[0].address",
+		"listeners[1].tls.cert_file",
+		"listeners[1].tls.key_file",
+		"listeners[1].tls.ca_file",
+		"listeners[2].address",
+		"listeners[2].proxy_protocol",
+		"listeners[2].profile.protocol_versions[0]",
+		"listeners[2].profile.max_packet_size",
+		"persistence.type",
+		"plugins.acl.file",
+		"plugins.acl.no_match",
+		"plugins.exhook[0].address",
+		"plugins.exhook[0].fail_policy",
+		"plugins.exhook[1].name",
+		"log.level",
+		"log.modules.subscription",
+		"limits.max_inflight",
+		"limits.max_publish_rate",
+		"limits.max_granted_qos",
+		"limits.queue_priorities[0].topic_filter",
+	}, keys)
+	a.Contains(err.Error(), `listeners[2].address: duplicate address ":8883"`)
+}
+
+func TestLoad(t *testing.T) {
+	a := assert.New(t)
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "gmqttd.yml")
+	a.NoError(ioutil.WriteFile(path, []byte("persistence:\n  type: bolt\n"), 0644))
+	_, err = Load(path)
+	a.EqualError(err, path+": persistence.bolt.path: is required")
+
+	// the sample configuration file is valid.
+	_, err = Load("../../cmd/gmqttd/gmqttd.yml")
+	a.NoError(err)
+}
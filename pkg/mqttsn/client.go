@@ -0,0 +1,585 @@
+package mqttsn
+
+import (
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/DrmagicE/gmqtt/pkg/packets"
+)
+
+const (
+	// stateWillTopic waits for the WILLTOPIC.
+	stateWillTopic = iota
+	// stateWillMsg waits for the WILLMSG.
+	stateWillMsg
+	// stateConnecting waits for the CONNACK from the broker.
+	stateConnecting
+	stateActive
+	// stateAsleep is the sleeping client, the messages to the client are buffered.
+	stateAsleep
+	stateDisconnected
+)
+
+// conn is the broker side of the pipe, which reports the udp address of the MQTT-SN client as the remote address.
+type conn struct {
+	net.Conn
+	local  net.Addr
+	remote net.Addr
+}
+
+// LocalAddr returns the address of the gateway.
+func (c *conn) LocalAddr() net.Addr {
+	return c.local
+}
+
+// RemoteAddr returns the address of the MQTT-SN client.
+func (c *conn) RemoteAddr() net.Addr {
+	return c.remote
+}
+
+type bufferedMessage struct {
+	typ   byte
+	msgID uint16
+	b     []byte
+}
+
+// client translates the messages between a MQTT-SN client and its MQTT connection.
+type client struct {
+	g        *Gateway
+	clientID string
+	connect  *packets.Connect
+	// conn is the gateway side of the pipe.
+	conn net.Conn
+	out  chan packets.Packet
+
+	mu sync.Mutex
+	// addr is nil for the publisher connection.
+	addr      *net.UDPAddr
+	state     int
+	stateTime time.Time
+	// duration is the keep alive of the active client or the sleep duration of the sleeping client.
+	duration time.Duration
+	lastSeen time.Time
+	lastPing time.Time
+
+	topicIDs    map[string]uint16
+	topicNames  map[uint16]string
+	nextTopicID uint16
+	// registered is the topic ids known by the client.
+	registered map[uint16]bool
+	nextMsgID  uint16
+	// pubTopics is the topic ids of the QoS 1 publishes from the client, which are used in the PUBACK.
+	pubTopics map[uint16]uint16
+	// subTopics is the topic ids of the subscriptions, which are used in the SUBACK.
+	subTopics map[uint16]uint16
+	buffered  []bufferedMessage
+
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+func newClient(g *Gateway, addr *net.UDPAddr, connect *packets.Connect) *client {
+	now := time.Now()
+	return &client{
+		g:          g,
+		clientID:   string(connect.ClientID),
+		connect:    connect,
+		out:        make(chan packets.Packet, outQueueSize),
+		addr:       addr,
+		state:      stateConnecting,
+		stateTime:  now,
+		duration:   time.Duration(connect.KeepAlive) * time.Second,
+		lastSeen:   now,
+		topicIDs:   make(map[string]uint16),
+		topicNames: make(map[uint16]string),
+		registered: make(map[uint16]bool),
+		pubTopics:  make(map[uint16]uint16),
+		subTopics:  make(map[uint16]uint16),
+		done:       make(chan struct{}),
+	}
+}
+
+// start creates the MQTT connection and sends the CONNECT.
+func (c *client) start() {
+	server, gw := net.Pipe()
+	c.conn = gw
+	var remote net.Addr = c.g.Addr()
+	if c.addr != nil {
+		remote = c.addr
+	}
+	go c.writeLoop(&conn{Conn: server, local: c.g.Addr(), remote: remote})
+	go c.readLoop()
+	c.send(c.connect)
+}
+
+// send sends the packet to the broker, the packet is dropped if the queue is full.
+func (c *client) send(p packets.Packet) {
+	select {
+	case c.out <- p:
+	case <-c.done:
+	default:
+	}
+}
+
+func (c *client) writeLoop(server net.Conn) {
+	select {
+	case c.g.accept <- server:
+	case <-c.done:
+		server.Close()
+		return
+	case <-c.g.closed:
+		server.Close()
+		return
+	}
+	w := packets.NewWriter(c.conn)
+	for {
+		select {
+		case p := <-c.out:
+			if err := w.WriteAndFlush(p); err != nil {
+				c.close()
+				return
+			}
+			if _, ok := p.(*packets.Disconnect); ok {
+				c.close()
+				return
+			}
+		case <-c.done:
+			return
+		}
+	}
+}
+
+func (c *client) readLoop() {
+	r := packets.NewReader(c.conn)
+	for {
+		p, err := r.ReadPacket()
+		if err != nil {
+			c.lost()
+			return
+		}
+		c.mu.Lock()
+		c.handleBroker(p)
+		c.mu.Unlock()
+	}
+}
+
+// lost is called when the MQTT connection is closed,
+// the client is notified with DISCONNECT if the connection is closed by the broker.
+func (c *client) lost() {
+	c.mu.Lock()
+	if c.state != stateDisconnected {
+		c.state = stateDisconnected
+		if c.addr != nil {
+			c.g.write(c.addr, encode(msgDisconnect))
+		}
+	}
+	c.mu.Unlock()
+	c.g.remove(c)
+	c.close()
+}
+
+func (c *client) close() {
+	c.closeOnce.Do(func() {
+		close(c.done)
+		if c.conn != nil {
+			c.conn.Close()
+		}
+	})
+}
+
+// stop closes the client without notifying it.
+func (c *client) stop() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.setState(stateDisconnected)
+	c.close()
+}
+
+func (c *client) setAddr(addr *net.UDPAddr) {
+	c.mu.Lock()
+	c.addr = addr
+	c.mu.Unlock()
+}
+
+func (c *client) setState(state int) {
+	c.state = state
+	c.stateTime = time.Now()
+}
+
+// resume handles the CONNECT from the existing client. It returns false if a new connection should be created.
+func (c *client) resume(f flags, duration uint16) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lastSeen = time.Now()
+	switch c.state {
+	case stateWillTopic:
+		// the CONNECT is retransmitted.
+		c.g.write(c.addr, encode(msgWillTopicReq))
+		return true
+	case stateWillMsg:
+		c.g.write(c.addr, encode(msgWillMsgReq))
+		return true
+	case stateConnecting:
+		return true
+	case stateAsleep:
+		if f.cleanSession() {
+			return false
+		}
+		// the sleeping client becomes active, the MQTT session is kept.
+		c.setState(stateActive)
+		c.duration = time.Duration(duration) * time.Second
+		c.g.write(c.addr, encode(msgConnack, []byte{rcAccepted}))
+		c.flush()
+		return true
+	}
+	return false
+}
+
+// check closes the sleeping client which does not wake up in time, and keeps its MQTT connection alive.
+// c.mu must not be held.
+func (c *client) check(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	switch c.state {
+	case stateWillTopic, stateWillMsg:
+		if now.Sub(c.stateTime) > willTimeout {
+			c.setState(stateDisconnected)
+			c.g.remove(c)
+			c.close()
+		}
+	case stateAsleep:
+		if c.duration > 0 && now.Sub(c.lastSeen) > c.duration*3/2 {
+			// the client is lost, the will message is published by the broker.
+			c.setState(stateDisconnected)
+			c.g.remove(c)
+			c.close()
+			return
+		}
+		if keepAlive := time.Duration(c.connect.KeepAlive) * time.Second; keepAlive > 0 && now.Sub(c.lastPing) >= keepAlive/2 {
+			c.lastPing = now
+			c.send(&packets.Pingreq{})
+		}
+	}
+}
+
+// toClient sends the message to the client, or buffers it if the client is asleep.
+// The retransmitted messages replace the buffered ones with the same message id.
+func (c *client) toClient(typ byte, msgID uint16, b []byte) {
+	if c.state != stateAsleep {
+		c.g.write(c.addr, b)
+		return
+	}
+	if msgID != 0 {
+		for i, m := range c.buffered {
+			if m.typ == typ && m.msgID == msgID {
+				c.buffered[i].b = b
+				return
+			}
+		}
+	}
+	if len(c.buffered) >= c.g.maxBuffered {
+		return
+	}
+	c.buffered = append(c.buffered, bufferedMessage{typ: typ, msgID: msgID, b: b})
+}
+
+// flush sends the buffered messages.
+func (c *client) flush() {
+	for _, m := range c.buffered {
+		c.g.write(c.addr, m.b)
+	}
+	c.buffered = nil
+}
+
+func hasWildcard(topic string) bool {
+	return strings.ContainsAny(topic, "+#")
+}
+
+// topicID returns the topic id of the topic name, a new id is assigned if the topic has not been registered.
+func (c *client) topicID(name string) uint16 {
+	if id, ok := c.topicIDs[name]; ok {
+		return id
+	}
+	c.nextTopicID++
+	if c.nextTopicID == 0 || c.nextTopicID == 0xffff {
+		c.nextTopicID = 1
+	}
+	id := c.nextTopicID
+	if old, ok := c.topicNames[id]; ok {
+		delete(c.topicIDs, old)
+		delete(c.registered, id)
+	}
+	c.topicIDs[name] = id
+	c.topicNames[id] = name
+	return id
+}
+
+// topicName returns the topic name of the topic id in the message.
+func (c *client) topicName(topicIDType byte, b []byte) (string, bool) {
+	id := uint16(b[0])<<8 | uint16(b[1])
+	switch topicIDType {
+	case topicIDNormal:
+		name, ok := c.topicNames[id]
+		return name, ok
+	case topicIDPredefined:
+		name, ok := c.g.predefined[id]
+		return name, ok
+	case topicIDShort:
+		return string(b[:2]), true
+	}
+	return "", false
+}
+
+func (c *client) handle(msg *message) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lastSeen = time.Now()
+	body := msg.body
+	switch msg.typ {
+	case msgWillTopic:
+		// Flags(1) WillTopic(n), the empty WILLTOPIC means no will message.
+		if c.state != stateWillTopic {
+			return
+		}
+		if len(body) == 0 {
+			c.connect.WillFlag = false
+			c.setState(stateConnecting)
+			c.start()
+			return
+		}
+		f := flags(body[0])
+		qos := f.qos()
+		if qos < 0 {
+			qos = 0
+		}
+		c.connect.WillFlag = true
+		c.connect.WillQos = uint8(qos)
+		c.connect.WillRetain = f.retain()
+		c.connect.WillTopic = body[1:]
+		c.setState(stateWillMsg)
+		c.g.write(c.addr, encode(msgWillMsgReq))
+	case msgWillMsg:
+		if c.state != stateWillMsg {
+			return
+		}
+		c.connect.WillMsg = body
+		c.setState(stateConnecting)
+		c.start()
+	case msgRegister:
+		// TopicId(2) MsgId(2) TopicName(n)
+		if len(body) < 4 {
+			return
+		}
+		name := string(body[4:])
+		if name == "" || hasWildcard(name) {
+			c.g.write(c.addr, encode(msgRegack, u16(0), body[2:4], []byte{rcNotSupported}))
+			return
+		}
+		id := c.topicID(name)
+		c.registered[id] = true
+		c.g.write(c.addr, encode(msgRegack, u16(id), body[2:4], []byte{rcAccepted}))
+	case msgRegack:
+		// TopicId(2) MsgId(2) ReturnCode(1)
+		if len(body) < 5 {
+			return
+		}
+		if body[4] != rcAccepted {
+			delete(c.registered, uint16(body[0])<<8|uint16(body[1]))
+		}
+	case msgPublish:
+		// Flags(1) TopicId(2) MsgId(2) Data(n)
+		if len(body) < 5 || (c.state != stateActive && c.state != stateAsleep) {
+			return
+		}
+		f := flags(body[0])
+		topic, ok := c.topicName(f.topicIDType(), body[1:3])
+		if !ok {
+			c.g.write(c.addr, encode(msgPuback, body[1:3], body[3:5], []byte{rcInvalidTopicID}))
+			return
+		}
+		msgID := uint16(body[3])<<8 | uint16(body[4])
+		qos := f.qos()
+		if qos < 0 {
+			qos = 0
+		}
+		if qos == 1 {
+			c.pubTopics[msgID] = uint16(body[1])<<8 | uint16(body[2])
+		}
+		c.send(&packets.Publish{
+			Dup:       f.dup(),
+			Qos:       uint8(qos),
+			Retain:    f.retain(),
+			TopicName: []byte(topic),
+			PacketID:  msgID,
+			Payload:   body[5:],
+		})
+	case msgPuback:
+		// TopicId(2) MsgId(2) ReturnCode(1)
+		if len(body) < 5 {
+			return
+		}
+		if body[4] == rcInvalidTopicID {
+			// the topic id is unknown by the client, it is registered again when the message is retransmitted.
+			delete(c.registered, uint16(body[0])<<8|uint16(body[1]))
+		}
+		c.send(&packets.Puback{PacketID: uint16(body[2])<<8 | uint16(body[3])})
+	case msgPubrec, msgPubrel, msgPubcomp:
+		// MsgId(2)
+		if len(body) < 2 {
+			return
+		}
+		msgID := uint16(body[0])<<8 | uint16(body[1])
+		switch msg.typ {
+		case msgPubrec:
+			c.send(&packets.Pubrec{PacketID: msgID})
+		case msgPubrel:
+			c.send(&packets.Pubrel{PacketID: msgID})
+		case msgPubcomp:
+			c.send(&packets.Pubcomp{PacketID: msgID})
+		}
+	case msgSubscribe, msgUnsubscribe:
+		// Flags(1) MsgId(2) TopicName(n) or TopicId(2)
+		if len(body) < 5 || c.state != stateActive {
+			return
+		}
+		f := flags(body[0])
+		msgID := uint16(body[1])<<8 | uint16(body[2])
+		var name string
+		var id uint16
+		if f.topicIDType() == topicIDNormal {
+			name = string(body[3:])
+			if !hasWildcard(name) {
+				id = c.topicID(name)
+				c.registered[id] = true
+			}
+		} else {
+			var ok bool
+			name, ok = c.topicName(f.topicIDType(), body[3:5])
+			if !ok {
+				if msg.typ == msgSubscribe {
+					c.g.write(c.addr, encode(msgSuback, []byte{0}, body[3:5], body[1:3], []byte{rcInvalidTopicID}))
+				}
+				return
+			}
+			id = uint16(body[3])<<8 | uint16(body[4])
+		}
+		if msg.typ == msgUnsubscribe {
+			c.send(&packets.Unsubscribe{PacketID: msgID, Topics: []string{name}})
+			return
+		}
+		qos := f.qos()
+		if qos < 0 {
+			qos = 0
+		}
+		c.subTopics[msgID] = id
+		c.send(&packets.Subscribe{PacketID: msgID, Topics: []packets.Topic{{Name: name, Qos: uint8(qos)}}})
+	case msgPingreq:
+		if c.state == stateAsleep {
+			// the sleeping client is awake, the buffered messages are sent before the PINGRESP.
+			c.flush()
+			c.g.write(c.addr, encode(msgPingresp))
+			return
+		}
+		c.send(&packets.Pingreq{})
+	case msgDisconnect:
+		// Duration(2) is present if the client goes to sleep.
+		if len(body) >= 2 && c.state == stateActive {
+			if duration := uint16(body[0])<<8 | uint16(body[1]); duration > 0 {
+				c.setState(stateAsleep)
+				c.duration = time.Duration(duration) * time.Second
+				c.lastPing = time.Now()
+				c.g.write(c.addr, encode(msgDisconnect))
+				return
+			}
+		}
+		c.setState(stateDisconnected)
+		c.g.write(c.addr, encode(msgDisconnect))
+		c.g.remove(c)
+		if c.conn == nil {
+			// the client is still in the will flow.
+			c.close()
+			return
+		}
+		c.send(&packets.Disconnect{})
+	}
+}
+
+// handleBroker translates the packet from the broker. c.mu must be held.
+func (c *client) handleBroker(p packets.Packet) {
+	if c.addr == nil {
+		// the publisher connection ignores everything.
+		return
+	}
+	switch p := p.(type) {
+	case *packets.Connack:
+		if p.Code != packets.CodeAccepted {
+			rc := rcNotSupported
+			if p.Code == packets.CodeServerUnavaliable {
+				rc = rcCongestion
+			}
+			c.setState(stateDisconnected)
+			c.g.write(c.addr, encode(msgConnack, []byte{rc}))
+			return
+		}
+		c.setState(stateActive)
+		c.g.write(c.addr, encode(msgConnack, []byte{rcAccepted}))
+	case *packets.Publish:
+		c.deliver(p)
+	case *packets.Puback:
+		topicID := c.pubTopics[p.PacketID]
+		delete(c.pubTopics, p.PacketID)
+		c.toClient(msgPuback, p.PacketID, encode(msgPuback, u16(topicID), u16(p.PacketID), []byte{rcAccepted}))
+	case *packets.Pubrec:
+		c.toClient(msgPubrec, p.PacketID, encode(msgPubrec, u16(p.PacketID)))
+	case *packets.Pubrel:
+		c.toClient(msgPubrel, p.PacketID, encode(msgPubrel, u16(p.PacketID)))
+	case *packets.Pubcomp:
+		c.toClient(msgPubcomp, p.PacketID, encode(msgPubcomp, u16(p.PacketID)))
+	case *packets.Suback:
+		topicID := c.subTopics[p.PacketID]
+		delete(c.subTopics, p.PacketID)
+		var qos, rc byte
+		if len(p.Payload) > 0 {
+			qos = p.Payload[0]
+		}
+		if qos == packets.SUBSCRIBE_FAILURE {
+			qos, rc = 0, rcNotSupported
+		}
+		c.toClient(msgSuback, p.PacketID, encode(msgSuback, []byte{byte(newFlags(false, int8(qos), false, topicIDNormal))},
+			u16(topicID), u16(p.PacketID), []byte{rc}))
+	case *packets.Unsuback:
+		c.toClient(msgUnsuback, p.PacketID, encode(msgUnsuback, u16(p.PacketID)))
+	case *packets.Pingresp:
+		// the PINGRESP of the keep alive sent for the sleeping client is dropped.
+		if c.state == stateActive {
+			c.g.write(c.addr, encode(msgPingresp))
+		}
+	}
+}
+
+// deliver sends the publish from the broker to the client.
+// The topic which is not a predefined or short topic name is registered with REGISTER first.
+func (c *client) deliver(p *packets.Publish) {
+	topic := string(p.TopicName)
+	var topicIDType byte
+	var id uint16
+	if pid, ok := c.g.predefinedIDs[topic]; ok {
+		topicIDType, id = topicIDPredefined, pid
+	} else if len(topic) == 2 {
+		topicIDType, id = topicIDShort, uint16(topic[0])<<8|uint16(topic[1])
+	} else {
+		id = c.topicID(topic)
+		if !c.registered[id] {
+			c.nextMsgID++
+			if c.nextMsgID == 0 {
+				c.nextMsgID = 1
+			}
+			c.registered[id] = true
+			c.toClient(msgRegister, 0, encode(msgRegister, u16(id), u16(c.nextMsgID), p.TopicName))
+		}
+	}
+	f := newFlags(p.Dup, int8(p.Qos), p.Retain, topicIDType)
+	c.toClient(msgPublish, p.PacketID, encode(msgPublish, []byte{byte(f)}, u16(id), u16(p.PacketID), p.Payload))
+}
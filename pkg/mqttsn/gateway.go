@@ -0,0 +1,346 @@
+// Package mqttsn provides the MQTT-SN v1.2 gateway which lets the constrained sensors talk to gmqtt over UDP.
+// The Gateway is a net.Listener, each MQTT-SN client is translated into a MQTT connection accepted by the listener,
+// so the clients have their own sessions in the broker and are seen by the hooks, the bans and the quotas like
+// the other clients:
+//
+//	gw, _ := mqttsn.Listen(":1884", mqttsn.WithPredefinedTopics(map[uint16]string{1: "sensor/temperature"}))
+//	gmqtt.NewServer(gmqtt.WithTCPListener(gw))
+//
+// The gateway supports the topic id registration in both directions, the predefined and short topic names,
+// the QoS -1 publishes and the sleeping clients. The messages sent to a sleeping client are buffered by the gateway
+// and delivered when the client wakes up. The MQTT-SN clients connect without username and password.
+package mqttsn
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/DrmagicE/gmqtt/pkg/packets"
+)
+
+const (
+	defaultGatewayID         = 1
+	defaultPublisherClientID = "mqttsn-gateway"
+	defaultMaxBuffered       = 100
+	// willTimeout is the time to wait for the WILLTOPIC and WILLMSG.
+	willTimeout  = 10 * time.Second
+	maxDatagram  = 65535
+	outQueueSize = 64
+)
+
+var errGatewayClosed = errors.New("mqtt-sn gateway closed")
+
+// Option is the option of the Gateway.
+type Option func(g *Gateway)
+
+// WithGatewayID sets the gateway id in the GWINFO responding to SEARCHGW. Default to 1.
+func WithGatewayID(id byte) Option {
+	return func(g *Gateway) {
+		g.gatewayID = id
+	}
+}
+
+// WithPredefinedTopics sets the predefined topic ids, which can be used by the clients without registration.
+func WithPredefinedTopics(topics map[uint16]string) Option {
+	return func(g *Gateway) {
+		for id, name := range topics {
+			g.predefined[id] = name
+			g.predefinedIDs[name] = id
+		}
+	}
+}
+
+// WithPublisherClientID sets the client id of the connection which is used to publish the QoS -1 messages.
+// Default to "mqttsn-gateway".
+func WithPublisherClientID(clientID string) Option {
+	return func(g *Gateway) {
+		g.publisherID = clientID
+	}
+}
+
+// WithMaxBufferedMessages sets the maximum number of the messages buffered for a sleeping client,
+// the messages exceeding the limit are dropped. Default to 100.
+func WithMaxBufferedMessages(n int) Option {
+	return func(g *Gateway) {
+		g.maxBuffered = n
+	}
+}
+
+// Gateway is the MQTT-SN gateway listening on a UDP address.
+type Gateway struct {
+	conn          *net.UDPConn
+	gatewayID     byte
+	predefined    map[uint16]string
+	predefinedIDs map[string]uint16
+	publisherID   string
+	maxBuffered   int
+
+	mu sync.Mutex
+	// clients are the MQTT-SN clients, the key is the udp address.
+	clients   map[string]*client
+	publisher *client
+
+	accept    chan net.Conn
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+// Listen returns the Gateway which listens on the udp address.
+func Listen(address string, opts ...Option) (*Gateway, error) {
+	addr, err := net.ResolveUDPAddr("udp", address)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.ListenUDP("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	g := &Gateway{
+		conn:          conn,
+		gatewayID:     defaultGatewayID,
+		predefined:    make(map[uint16]string),
+		predefinedIDs: make(map[string]uint16),
+		publisherID:   defaultPublisherClientID,
+		maxBuffered:   defaultMaxBuffered,
+		clients:       make(map[string]*client),
+		accept:        make(chan net.Conn),
+		closed:        make(chan struct{}),
+	}
+	for _, fn := range opts {
+		fn(g)
+	}
+	go g.readLoop()
+	go g.checkLoop()
+	return g, nil
+}
+
+// Accept returns the MQTT connection of the next MQTT-SN client.
+func (g *Gateway) Accept() (net.Conn, error) {
+	select {
+	case c := <-g.accept:
+		return c, nil
+	case <-g.closed:
+		return nil, errGatewayClosed
+	}
+}
+
+// Close closes the gateway and the connections of all clients.
+func (g *Gateway) Close() error {
+	var err error
+	g.closeOnce.Do(func() {
+		close(g.closed)
+		err = g.conn.Close()
+		g.mu.Lock()
+		clients := make([]*client, 0, len(g.clients)+1)
+		for _, c := range g.clients {
+			clients = append(clients, c)
+		}
+		if g.publisher != nil {
+			clients = append(clients, g.publisher)
+		}
+		g.mu.Unlock()
+		for _, c := range clients {
+			c.stop()
+		}
+	})
+	return err
+}
+
+// Addr returns the udp address of the gateway.
+func (g *Gateway) Addr() net.Addr {
+	return g.conn.LocalAddr()
+}
+
+func (g *Gateway) write(addr *net.UDPAddr, b []byte) {
+	g.conn.WriteToUDP(b, addr)
+}
+
+func (g *Gateway) readLoop() {
+	buf := make([]byte, maxDatagram)
+	for {
+		n, addr, err := g.conn.ReadFromUDP(buf)
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				continue
+			}
+			return
+		}
+		msg, err := decode(append([]byte(nil), buf[:n]...))
+		if err != nil {
+			continue
+		}
+		g.handle(addr, msg)
+	}
+}
+
+func (g *Gateway) handle(addr *net.UDPAddr, msg *message) {
+	switch msg.typ {
+	case msgSearchGW:
+		g.write(addr, encode(msgGWInfo, []byte{g.gatewayID}))
+		return
+	case msgConnect:
+		g.handleConnect(addr, msg)
+		return
+	case msgPublish:
+		if len(msg.body) > 0 && flags(msg.body[0]).qos() == -1 {
+			g.publishQos0(msg)
+			return
+		}
+	}
+	g.mu.Lock()
+	c := g.clients[addr.String()]
+	rebound := false
+	if c == nil && msg.typ == msgPingreq && len(msg.body) > 0 {
+		// the sleeping client may wake up with another address.
+		c = g.rebind(string(msg.body), addr)
+		rebound = c != nil
+	}
+	g.mu.Unlock()
+	if rebound {
+		c.setAddr(addr)
+	}
+	if c == nil {
+		if msg.typ != msgDisconnect && msg.typ != msgAdvertise && msg.typ != msgGWInfo {
+			g.write(addr, encode(msgDisconnect))
+		}
+		return
+	}
+	c.handle(msg)
+}
+
+// rebind moves the client to the new address, g.mu must be held.
+func (g *Gateway) rebind(clientID string, addr *net.UDPAddr) *client {
+	for k, c := range g.clients {
+		if c.clientID == clientID {
+			delete(g.clients, k)
+			g.clients[addr.String()] = c
+			return c
+		}
+	}
+	return nil
+}
+
+func (g *Gateway) handleConnect(addr *net.UDPAddr, msg *message) {
+	// Flags(1) ProtocolId(1) Duration(2) ClientId(n)
+	if len(msg.body) < 4 {
+		return
+	}
+	f := flags(msg.body[0])
+	if msg.body[1] != protocolID {
+		g.write(addr, encode(msgConnack, []byte{rcNotSupported}))
+		return
+	}
+	duration := uint16(msg.body[2])<<8 | uint16(msg.body[3])
+	clientID := string(msg.body[4:])
+	g.mu.Lock()
+	old := g.clients[addr.String()]
+	g.mu.Unlock()
+	if old != nil && old.clientID == clientID {
+		if old.resume(f, duration) {
+			return
+		}
+	}
+	if old != nil {
+		old.stop()
+	}
+	c := newClient(g, addr, &packets.Connect{
+		ProtocolName:  []byte("MQTT"),
+		ProtocolLevel: 0x04,
+		CleanSession:  f.cleanSession(),
+		KeepAlive:     duration,
+		ClientID:      []byte(clientID),
+	})
+	g.mu.Lock()
+	g.clients[addr.String()] = c
+	g.mu.Unlock()
+	if f.will() {
+		c.mu.Lock()
+		c.state = stateWillTopic
+		c.mu.Unlock()
+		g.write(addr, encode(msgWillTopicReq))
+		return
+	}
+	c.start()
+}
+
+// publishQos0 publishes the QoS -1 message with QoS 0 through the publisher connection.
+// Only the predefined topic ids and the short topic names can be used.
+func (g *Gateway) publishQos0(msg *message) {
+	// Flags(1) TopicId(2) MsgId(2) Data(n)
+	if len(msg.body) < 5 {
+		return
+	}
+	f := flags(msg.body[0])
+	var topic string
+	switch f.topicIDType() {
+	case topicIDPredefined:
+		name, ok := g.predefined[uint16(msg.body[1])<<8|uint16(msg.body[2])]
+		if !ok {
+			return
+		}
+		topic = name
+	case topicIDShort:
+		topic = string(msg.body[1:3])
+	default:
+		return
+	}
+	g.mu.Lock()
+	p := g.publisher
+	if p == nil {
+		p = newClient(g, nil, &packets.Connect{
+			ProtocolName:  []byte("MQTT"),
+			ProtocolLevel: 0x04,
+			CleanSession:  true,
+			ClientID:      []byte(g.publisherID),
+		})
+		g.publisher = p
+		p.start()
+	}
+	g.mu.Unlock()
+	p.send(&packets.Publish{
+		Qos:       packets.QOS_0,
+		Retain:    f.retain(),
+		TopicName: []byte(topic),
+		Payload:   msg.body[5:],
+	})
+}
+
+// remove removes the client from the gateway.
+func (g *Gateway) remove(c *client) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.publisher == c {
+		g.publisher = nil
+		return
+	}
+	for k, v := range g.clients {
+		if v == c {
+			delete(g.clients, k)
+			return
+		}
+	}
+}
+
+// checkLoop checks the sleeping clients and the clients which do not finish the will flow.
+func (g *Gateway) checkLoop() {
+	t := time.NewTicker(time.Second)
+	defer t.Stop()
+	for {
+		select {
+		case <-g.closed:
+			return
+		case now := <-t.C:
+			g.mu.Lock()
+			clients := make([]*client, 0, len(g.clients))
+			for _, c := range g.clients {
+				clients = append(clients, c)
+			}
+			g.mu.Unlock()
+			for _, c := range clients {
+				c.check(now)
+			}
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package mqttsn
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/DrmagicE/gmqtt"
+)
+
+func TestEncodeDecode(t *testing.T) {
+	a := assert.New(t)
+	b := encode(msgPublish, []byte{0x20}, u16(1), u16(2), []byte("payload"))
+	a.EqualValues(len(b), b[0])
+	msg, err := decode(b)
+	a.NoError(err)
+	a.Equal(msgPublish, msg.typ)
+	a.Equal(append([]byte{0x20, 0, 1, 0, 2}, "payload"...), msg.body)
+
+	long := bytes.Repeat([]byte("a"), 300)
+	b = encode(msgPublish, long)
+	a.EqualValues(0x01, b[0])
+	a.Len(b, 304)
+	msg, err = decode(b)
+	a.NoError(err)
+	a.Equal(long, msg.body)
+
+	_, err = decode([]byte{5, msgPingreq})
+	a.Equal(errInvalidMessage, err)
+	_, err = decode([]byte{1})
+	a.Equal(errInvalidMessage, err)
+}
+
+func TestFlags(t *testing.T) {
+	a := assert.New(t)
+	f := newFlags(true, -1, true, topicIDShort)
+	a.True(f.dup())
+	a.EqualValues(-1, f.qos())
+	a.True(f.retain())
+	a.Equal(topicIDShort, f.topicIDType())
+	f = newFlags(false, 2, false, topicIDNormal)
+	a.False(f.dup())
+	a.EqualValues(2, f.qos())
+	a.False(f.retain())
+	a.Equal(topicIDNormal, f.topicIDType())
+}
+
+type testClient struct {
+	t    *testing.T
+	conn *net.UDPConn
+}
+
+func newTestClient(t *testing.T, addr net.Addr) *testClient {
+	c, err := net.DialUDP("udp", nil, addr.(*net.UDPAddr))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	return &testClient{t: t, conn: c}
+}
+
+func (c *testClient) send(typ byte, body ...[]byte) {
+	c.conn.Write(encode(typ, body...))
+}
+
+func (c *testClient) read() *message {
+	buf := make([]byte, maxDatagram)
+	c.conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	n, err := c.conn.Read(buf)
+	if err != nil {
+		c.t.Fatalf("unexpected error: %s", err)
+	}
+	msg, err := decode(buf[:n])
+	if err != nil {
+		c.t.Fatalf("unexpected error: %s", err)
+	}
+	return msg
+}
+
+// expect reads the messages until the message of typ arrives.
+func (c *testClient) expect(typ byte) *message {
+	for {
+		if msg := c.read(); msg.typ == typ {
+			return msg
+		}
+	}
+}
+
+func (c *testClient) connect(clientID string, f flags, duration uint16) {
+	c.send(msgConnect, []byte{byte(f), protocolID}, u16(duration), []byte(clientID))
+}
+
+func TestGateway(t *testing.T) {
+	a := assert.New(t)
+	gw, err := Listen("127.0.0.1:0", WithPredefinedTopics(map[uint16]string{1: "sensor/temperature"}))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	srv := gmqtt.NewServer(gmqtt.WithTCPListener(gw))
+	srv.Run()
+	defer srv.Stop(context.Background())
+
+	c := newTestClient(t, gw.Addr())
+	defer c.conn.Close()
+
+	c.send(msgSearchGW, []byte{0})
+	a.Equal([]byte{defaultGatewayID}, c.expect(msgGWInfo).body)
+
+	// connect with will
+	c.connect("sn", flagCleanSession|flagWill, 60)
+	c.expect(msgWillTopicReq)
+	c.send(msgWillTopic, []byte{byte(newFlags(false, 1, false, 0))}, []byte("will"))
+	c.expect(msgWillMsgReq)
+	c.send(msgWillMsg, []byte("bye"))
+	a.Equal([]byte{rcAccepted}, c.expect(msgConnack).body)
+	a.NotNil(srv.Client("sn"))
+
+	// register and subscribe
+	c.send(msgRegister, u16(0), u16(1), []byte("a/b"))
+	regack := c.expect(msgRegack)
+	topicID := regack.body[0:2]
+	a.Equal([]byte{0, 1, rcAccepted}, regack.body[2:])
+	c.send(msgSubscribe, []byte{byte(newFlags(false, 1, false, topicIDNormal))}, u16(2), []byte("a/b"))
+	suback := c.expect(msgSuback)
+	a.Equal(append(append([]byte{byte(newFlags(false, 1, false, 0))}, topicID...), 0, 2, rcAccepted), suback.body)
+
+	// publish to the registered topic
+	c.send(msgPublish, []byte{byte(newFlags(false, 1, false, topicIDNormal))}, topicID, u16(3), []byte("hello"))
+	var puback, publish *message
+	for puback == nil || publish == nil {
+		msg := c.read()
+		switch msg.typ {
+		case msgPuback:
+			puback = msg
+		case msgPublish:
+			publish = msg
+		}
+	}
+	a.Equal(append(append([]byte{}, topicID...), 0, 3, rcAccepted), puback.body)
+	a.Equal(topicID, publish.body[1:3])
+	a.Equal([]byte("hello"), publish.body[5:])
+	c.send(msgPuback, topicID, publish.body[3:5], []byte{rcAccepted})
+
+	// the invalid topic id
+	c.send(msgPublish, []byte{byte(newFlags(false, 0, false, topicIDNormal))}, u16(100), u16(0), []byte("hello"))
+	a.Equal([]byte{0, 100, 0, 0, rcInvalidTopicID}, c.expect(msgPuback).body)
+
+	// subscribe with wildcard and publish to the predefined topic with QoS -1.
+	c.send(msgSubscribe, []byte{byte(newFlags(false, 0, false, topicIDNormal))}, u16(4), []byte("sensor/#"))
+	suback = c.expect(msgSuback)
+	a.Equal([]byte{0, 0, 0, 0, 4, rcAccepted}, suback.body)
+	anonymous := newTestClient(t, gw.Addr())
+	defer anonymous.conn.Close()
+	anonymous.send(msgPublish, []byte{byte(newFlags(false, -1, false, topicIDPredefined))}, u16(1), u16(0), []byte("25"))
+	publish = c.expect(msgPublish)
+	a.Equal(topicIDPredefined, flags(publish.body[0]).topicIDType())
+	a.Equal([]byte{0, 1}, publish.body[1:3])
+	a.Equal([]byte("25"), publish.body[5:])
+
+	// short topic name
+	c.send(msgSubscribe, []byte{byte(newFlags(false, 0, false, topicIDNormal))}, u16(5), []byte("sensor/+/x"))
+	c.expect(msgSuback)
+	c.send(msgSubscribe, []byte{byte(newFlags(false, 0, false, topicIDShort))}, u16(6), []byte("st"))
+	c.expect(msgSuback)
+	c.send(msgPublish, []byte{byte(newFlags(false, 0, false, topicIDShort))}, []byte("st"), u16(0), []byte("short"))
+	publish = c.expect(msgPublish)
+	a.Equal(topicIDShort, flags(publish.body[0]).topicIDType())
+	a.Equal([]byte("st"), publish.body[1:3])
+
+	// the topic is registered by the gateway before delivered.
+	c2 := newTestClient(t, gw.Addr())
+	defer c2.conn.Close()
+	c2.connect("sn2", flagCleanSession, 60)
+	c2.expect(msgConnack)
+	c2.send(msgRegister, u16(0), u16(1), []byte("sensor/humidity"))
+	regack = c2.expect(msgRegack)
+	c2.send(msgPublish, []byte{byte(newFlags(false, 0, false, topicIDNormal))}, regack.body[0:2], u16(0), []byte("60"))
+	register := c.expect(msgRegister)
+	a.Equal([]byte("sensor/humidity"), register.body[4:])
+	c.send(msgRegack, register.body[0:4], []byte{rcAccepted})
+	publish = c.expect(msgPublish)
+	a.Equal(topicIDNormal, flags(publish.body[0]).topicIDType())
+	a.Equal(register.body[0:2], publish.body[1:3])
+	a.Equal([]byte("60"), publish.body[5:])
+
+	// sleep
+	c.send(msgDisconnect, u16(30))
+	c.expect(msgDisconnect)
+	anonymous.send(msgPublish, []byte{byte(newFlags(false, -1, false, topicIDPredefined))}, u16(1), u16(0), []byte("26"))
+	time.Sleep(100 * time.Millisecond)
+	a.NotNil(srv.Client("sn"))
+	c.send(msgPingreq, []byte("sn"))
+	publish = c.expect(msgPublish)
+	a.Equal([]byte("26"), publish.body[5:])
+	c.expect(msgPingresp)
+
+	// wake up
+	c.connect("sn", 0, 60)
+	a.Equal([]byte{rcAccepted}, c.expect(msgConnack).body)
+	c.send(msgPingreq)
+	c.expect(msgPingresp)
+
+	// disconnect
+	c.send(msgDisconnect)
+	c.expect(msgDisconnect)
+	time.Sleep(100 * time.Millisecond)
+	a.Nil(srv.Client("sn"))
+
+	// the client is unknown
+	c.send(msgPingreq)
+	c.expect(msgDisconnect)
+}
@@ -0,0 +1,157 @@
+package mqttsn
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// The message types of MQTT-SN v1.2.
+const (
+	msgAdvertise    byte = 0x00
+	msgSearchGW     byte = 0x01
+	msgGWInfo       byte = 0x02
+	msgConnect      byte = 0x04
+	msgConnack      byte = 0x05
+	msgWillTopicReq byte = 0x06
+	msgWillTopic    byte = 0x07
+	msgWillMsgReq   byte = 0x08
+	msgWillMsg      byte = 0x09
+	msgRegister     byte = 0x0A
+	msgRegack       byte = 0x0B
+	msgPublish      byte = 0x0C
+	msgPuback       byte = 0x0D
+	msgPubcomp      byte = 0x0E
+	msgPubrec       byte = 0x0F
+	msgPubrel       byte = 0x10
+	msgSubscribe    byte = 0x12
+	msgSuback       byte = 0x13
+	msgUnsubscribe  byte = 0x14
+	msgUnsuback     byte = 0x15
+	msgPingreq      byte = 0x16
+	msgPingresp     byte = 0x17
+	msgDisconnect   byte = 0x18
+)
+
+// The return codes of MQTT-SN v1.2.
+const (
+	rcAccepted       byte = 0x00
+	rcCongestion     byte = 0x01
+	rcInvalidTopicID byte = 0x02
+	rcNotSupported   byte = 0x03
+)
+
+// The topic id types in the flags.
+const (
+	topicIDNormal     byte = 0x00
+	topicIDPredefined byte = 0x01
+	topicIDShort      byte = 0x02
+)
+
+const (
+	flagDup          = 0x80
+	flagRetain       = 0x10
+	flagWill         = 0x08
+	flagCleanSession = 0x04
+)
+
+// protocolID is the only protocol id defined by MQTT-SN v1.2.
+const protocolID = 0x01
+
+var errInvalidMessage = errors.New("invalid mqtt-sn message")
+
+// message is the decoded MQTT-SN message, body is the variable part following the message type.
+type message struct {
+	typ  byte
+	body []byte
+}
+
+// decode decodes the datagram into the message. The length field must be equal to the length of the datagram.
+func decode(b []byte) (*message, error) {
+	if len(b) < 2 {
+		return nil, errInvalidMessage
+	}
+	length, header := int(b[0]), 1
+	if b[0] == 0x01 {
+		// the 3 bytes length field
+		if len(b) < 4 {
+			return nil, errInvalidMessage
+		}
+		length, header = int(binary.BigEndian.Uint16(b[1:3])), 3
+	}
+	if length != len(b) {
+		return nil, errInvalidMessage
+	}
+	return &message{typ: b[header], body: b[header+1:]}, nil
+}
+
+// encode encodes the message type and the body parts into a datagram.
+func encode(typ byte, body ...[]byte) []byte {
+	length := 2
+	for _, v := range body {
+		length += len(v)
+	}
+	var b []byte
+	if length > 0xff {
+		length += 2
+		b = make([]byte, 3, length)
+		b[0] = 0x01
+		binary.BigEndian.PutUint16(b[1:3], uint16(length))
+	} else {
+		b = make([]byte, 1, length)
+		b[0] = byte(length)
+	}
+	b = append(b, typ)
+	for _, v := range body {
+		b = append(b, v...)
+	}
+	return b
+}
+
+func u16(v uint16) []byte {
+	b := make([]byte, 2)
+	binary.BigEndian.PutUint16(b, v)
+	return b
+}
+
+// flags is the flags field of the MQTT-SN messages.
+type flags byte
+
+func newFlags(dup bool, qos int8, retain bool, topicIDType byte) flags {
+	f := flags(topicIDType & 0x03)
+	if dup {
+		f |= flagDup
+	}
+	if retain {
+		f |= flagRetain
+	}
+	return f | flags(qos&0x03)<<5
+}
+
+func (f flags) dup() bool {
+	return f&flagDup != 0
+}
+
+// qos returns the QoS level, -1 for the QoS -1 publish.
+func (f flags) qos() int8 {
+	q := int8(f>>5) & 0x03
+	if q == 3 {
+		return -1
+	}
+	return q
+}
+
+func (f flags) retain() bool {
+	return f&flagRetain != 0
+}
+
+func (f flags) will() bool {
+	return f&flagWill != 0
+}
+
+func (f flags) cleanSession() bool {
+	return f&flagCleanSession != 0
+}
+
+func (f flags) topicIDType() byte {
+	return byte(f) & 0x03
+}
@@ -43,6 +43,9 @@ func (c *Connack) Pack(w io.Writer) error {
 
 // Unpack read the packet bytes from io.Reader and decodes it into the packet struct
 func (c *Connack) Unpack(r io.Reader) error {
+	if c.FixHeader.RemainLength != 2 {
+		return ErrInvalRemainLength
+	}
 	restBuffer := make([]byte, c.FixHeader.RemainLength)
 	_, err := io.ReadFull(r, restBuffer)
 	if err != nil {
@@ -7,6 +7,25 @@ import (
 	"io"
 )
 
+// The protocol levels of the supported MQTT versions.
+const (
+	// Version31 is the protocol level of MQTT 3.1, whose protocol name is "MQIsdp".
+	Version31 byte = 0x03
+	// Version311 is the protocol level of MQTT 3.1.1, whose protocol name is "MQTT".
+	Version311 byte = 0x04
+)
+
+// MaxClientIDLengthV31 is the maximum length of the client identifier in MQTT 3.1.
+const MaxClientIDLengthV31 = 23
+
+// protocolName returns the protocol name of the protocol level.
+func protocolName(level byte) []byte {
+	if level == Version31 {
+		return []byte("MQIsdp")
+	}
+	return []byte("MQTT")
+}
+
 // Connect represents the MQTT Connect  packet
 type Connect struct {
 	FixHeader *FixHeader
@@ -41,7 +60,11 @@ func (c *Connect) String() string {
 func (c *Connect) Pack(w io.Writer) error {
 	var err error
 	c.FixHeader = &FixHeader{PacketType: CONNECT, Flags: FLAG_RESERVED}
-	remainLength := 10 + len(c.ClientID) + 2
+	protoName := c.ProtocolName
+	if len(protoName) == 0 {
+		protoName = protocolName(c.ProtocolLevel)
+	}
+	remainLength := 2 + len(protoName) + 4 + len(c.ClientID) + 2
 	if c.WillFlag {
 		remainLength += len(c.WillTopic) + 2 + len(c.WillMsg) + 2
 	}
@@ -56,9 +79,10 @@ func (c *Connect) Pack(w io.Writer) error {
 	if err != nil {
 		return err
 	}
-	lenProtocolName := []byte{0, 4}
+	lenProtocolName := make([]byte, 2)
+	binary.BigEndian.PutUint16(lenProtocolName, uint16(len(protoName)))
 	w.Write(lenProtocolName)
-	w.Write(c.ProtocolName)
+	w.Write(protoName)
 
 	w.Write([]byte{c.ProtocolLevel})
 	var (
@@ -134,15 +158,30 @@ func (c *Connect) Unpack(r io.Reader) error {
 	if err != nil {
 		return err
 	}
-	if !bytes.Equal(restBuffer[0:6], []byte{0, 4, 77, 81, 84, 84}) { //protocol name
-		return ErrInvalProtocolName // [MQTT-3.1.2-1] 不符合的protocol name直接关闭
+	protoName, size, err := c.FixHeader.decodeUTF8String(restBuffer)
+	if err != nil {
+		return ErrInvalProtocolName
 	}
-	c.ProtocolName = []byte{77, 81, 84, 84}
-	c.ProtocolLevel = restBuffer[6]
-	if c.ProtocolLevel != 0x04 {
-		c.AckCode = CodeUnacceptableProtocolVersion // [MQTT-3.1.2-2]
+	restBuffer = restBuffer[size:]
+	if len(restBuffer) < 4 {
+		return ErrInvalRemainLength
 	}
-	connectFlags := restBuffer[7]
+	c.ProtocolLevel = restBuffer[0]
+	// the protocol level which does not match the protocol name is unacceptable.
+	switch {
+	case bytes.Equal(protoName, protocolName(Version311)):
+		if c.ProtocolLevel != Version311 {
+			c.AckCode = CodeUnacceptableProtocolVersion // [MQTT-3.1.2-2]
+		}
+	case bytes.Equal(protoName, protocolName(Version31)):
+		if c.ProtocolLevel != Version31 {
+			c.AckCode = CodeUnacceptableProtocolVersion
+		}
+	default:
+		return ErrInvalProtocolName // [MQTT-3.1.2-1] 不符合的protocol name直接关闭
+	}
+	c.ProtocolName = protoName
+	connectFlags := restBuffer[1]
 	reserved := 1 & connectFlags
 	if reserved != 0 { //[MQTT-3.1.2-3]
 		return ErrInvalConnFlags
@@ -153,62 +192,78 @@ func (c *Connect) Unpack(r io.Reader) error {
 	if !c.WillFlag && c.WillQos != 0 { //[MQTT-3.1.2-11]
 		return ErrInvalWillQos
 	}
+	if c.WillQos > QOS_2 { //[MQTT-3.1.2-14]
+		return ErrInvalWillQos
+	}
 	c.WillRetain = (1 & (connectFlags >> 5)) > 0
 	if !c.WillFlag && c.WillRetain { //[MQTT-3.1.2-11]
 		return ErrInvalWillRetain
 	}
 	c.PasswordFlag = (1 & (connectFlags >> 6)) > 0
 	c.UsernameFlag = (1 & (connectFlags >> 7)) > 0
-	c.KeepAlive = binary.BigEndian.Uint16(restBuffer[8:10])
-	return c.unpackPayload(restBuffer[10:])
+	c.KeepAlive = binary.BigEndian.Uint16(restBuffer[2:4])
+	restBuffer, err = c.unpackPayload(restBuffer[4:])
+	if err != nil {
+		return err
+	}
+	if len(restBuffer) != 0 {
+		return c.FixHeader.violation(ErrInvalRemainLength)
+	}
+	return nil
 }
 
-func (c *Connect) unpackPayload(restBuffer []byte) error {
+// unpackPayload decodes the payload and returns the trailing bytes.
+func (c *Connect) unpackPayload(restBuffer []byte) ([]byte, error) {
 	var vh []byte
 	var size int
 	var err error
-	vh, size, err = DecodeUTF8String(restBuffer)
+	vh, size, err = c.FixHeader.decodeUTF8String(restBuffer)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	restBuffer = restBuffer[size:]
 	c.ClientID = vh
 	if len(c.ClientID) == 0 && !c.CleanSession { //[MQTT-3.1.3-7]
 		c.AckCode = CodeIdentifierRejected //[MQTT-3.1.3-8]
 	}
+	// MQTT 3.1 requires the client identifier to be between 1 and 23 characters.
+	if c.ProtocolLevel == Version31 && c.AckCode == CodeAccepted &&
+		(len(c.ClientID) == 0 || len(c.ClientID) > MaxClientIDLengthV31) {
+		c.AckCode = CodeIdentifierRejected
+	}
 
 	if c.WillFlag {
-		vh, size, err = DecodeUTF8String(restBuffer)
+		vh, size, err = c.FixHeader.decodeUTF8String(restBuffer)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		restBuffer = restBuffer[size:]
 		c.WillTopic = vh
-		vh, size, err = DecodeUTF8String(restBuffer)
+		vh, size, err = c.FixHeader.decodeUTF8String(restBuffer)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		restBuffer = restBuffer[size:]
 		c.WillMsg = vh
 	}
 
 	if c.UsernameFlag {
-		vh, size, err = DecodeUTF8String(restBuffer)
+		vh, size, err = c.FixHeader.decodeUTF8String(restBuffer)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		restBuffer = restBuffer[size:]
 		c.Username = vh
 	}
 	if c.PasswordFlag {
-		vh, size, err = DecodeUTF8String(restBuffer)
+		vh, size, err = c.FixHeader.decodeUTF8String(restBuffer)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		restBuffer = restBuffer[size:]
 		c.Password = vh
 	}
-	return nil
+	return restBuffer, nil
 }
 
 // NewConnectPacket returns a Connect instance by the given FixHeader and io.Reader
@@ -240,7 +295,8 @@ func (c *Connect) NewConnackPacket(sessionReuse bool) *Connack {
 			ack.SessionPresent = 0 //[MQTT-3.2.2-3]
 		}
 	}
-	if ack.Code != CodeAccepted {
+	// the session present flag is reserved in MQTT 3.1.
+	if ack.Code != CodeAccepted || c.ProtocolLevel == Version31 {
 		ack.SessionPresent = 0
 	}
 	return ack
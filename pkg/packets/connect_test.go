@@ -151,6 +151,74 @@ func TestConnect_NewConnackPacket_Success(t *testing.T) {
 	}
 }
 
+func TestReadConnectPacket_V31(t *testing.T) {
+	var tt = []struct {
+		protocolName  []byte
+		protocolLevel byte
+		clientID      []byte
+		ackCode       uint8
+	}{
+		{protocolName: []byte("MQIsdp"), protocolLevel: 0x03, clientID: []byte("client1"), ackCode: CodeAccepted},
+		{protocolName: []byte("MQIsdp"), protocolLevel: 0x04, clientID: []byte("client1"), ackCode: CodeUnacceptableProtocolVersion},
+		{protocolName: []byte("MQTT"), protocolLevel: 0x03, clientID: []byte("client1"), ackCode: CodeUnacceptableProtocolVersion},
+		// MQTT 3.1 requires the client identifier to be between 1 and 23 characters.
+		{protocolName: []byte("MQIsdp"), protocolLevel: 0x03, clientID: []byte(""), ackCode: CodeIdentifierRejected},
+		{protocolName: []byte("MQIsdp"), protocolLevel: 0x03, clientID: bytes.Repeat([]byte("a"), 24), ackCode: CodeIdentifierRejected},
+		{protocolName: []byte("MQTT"), protocolLevel: 0x04, clientID: bytes.Repeat([]byte("a"), 24), ackCode: CodeAccepted},
+	}
+	for _, v := range tt {
+		buf := &bytes.Buffer{}
+		con := &Connect{
+			ProtocolName:  v.protocolName,
+			ProtocolLevel: v.protocolLevel,
+			CleanSession:  true,
+			ClientID:      v.clientID,
+		}
+		if err := NewWriter(buf).WriteAndFlush(con); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		packet, err := NewReader(buf).ReadPacket()
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		p := packet.(*Connect)
+		if p.AckCode != v.ackCode {
+			t.Fatalf("AckCode error, want %d, got %d, protocol name: %s, protocol level: %d",
+				v.ackCode, p.AckCode, v.protocolName, v.protocolLevel)
+		}
+		if !bytes.Equal(p.ProtocolName, v.protocolName) {
+			t.Fatalf("ProtocolName error,want %s, got %s", v.protocolName, p.ProtocolName)
+		}
+	}
+
+	// the session present flag is reserved in MQTT 3.1.
+	con := &Connect{ProtocolLevel: Version31, ClientID: []byte("client1")}
+	if ack := con.NewConnackPacket(true); ack.SessionPresent != 0 {
+		t.Fatalf("SessionPresent error,want %d, got %d", 0, ack.SessionPresent)
+	}
+
+	// the protocol name is set by the protocol level if it is empty.
+	buf := &bytes.Buffer{}
+	if err := NewWriter(buf).WriteAndFlush(&Connect{ProtocolLevel: Version31, ClientID: []byte("client1")}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	packet, err := NewReader(buf).ReadPacket()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if p := packet.(*Connect); !bytes.Equal(p.ProtocolName, []byte("MQIsdp")) {
+		t.Fatalf("ProtocolName error,want %s, got %s", "MQIsdp", p.ProtocolName)
+	}
+
+	// invalid protocol name
+	b := []byte{16, 14, 0, 6, 77, 81, 73, 115, 100, 112, 3, 2, 0, 0, 0, 0}
+	b[9] = 'x'
+	_, err = NewReader(bytes.NewBuffer(b)).ReadPacket()
+	if err != ErrInvalProtocolName {
+		t.Fatalf("ReadPacket() err error,want %s,got %v", ErrInvalProtocolName, err)
+	}
+}
+
 func TestWriteConnect(t *testing.T) {
 	var tt = []struct {
 		protocolLevel byte
@@ -175,6 +243,7 @@ func TestWriteConnect(t *testing.T) {
 		{protocolLevel: 0x04, usernameFlag: true, protocolName: []byte("MQTT"), passwordFlag: true, willRetain: false, willQos: 0, willFlag: false, willTopic: []byte(""), willMsg: []byte(""), cleanSession: false, keepAlive: 60, clientID: []byte("client5"), username: []byte("admin4"), password: []byte("1235")},
 		{protocolLevel: 0x04, usernameFlag: false, protocolName: []byte("MQTT"), passwordFlag: false, willRetain: false, willQos: 0, willFlag: false, willTopic: []byte(""), willMsg: []byte(""), cleanSession: true, keepAlive: 60, clientID: []byte(""), username: []byte(""), password: []byte("")},
 		{protocolLevel: 0x04, usernameFlag: false, protocolName: []byte("MQTT"), passwordFlag: false, willRetain: true, willQos: 2, willFlag: true, willTopic: []byte("messageTopic3"), willMsg: []byte("messageContent3"), cleanSession: true, keepAlive: 60, clientID: []byte("client6"), username: []byte(""), password: []byte("")},
+		{protocolLevel: 0x03, usernameFlag: true, protocolName: []byte("MQIsdp"), passwordFlag: true, willRetain: true, willQos: 1, willFlag: true, willTopic: []byte("messageTopic4"), willMsg: []byte("messageContent4"), cleanSession: false, keepAlive: 60, clientID: []byte("client7"), username: []byte("admin5"), password: []byte("1237")},
 	}
 
 	for _, v := range tt {
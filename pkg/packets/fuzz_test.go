@@ -0,0 +1,90 @@
+package packets
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+// fuzzCorpus returns the encoded packets of all types used as the seeds of the fuzz test.
+func fuzzCorpus(t *testing.T) [][]byte {
+	pkts := []Packet{
+		&Connect{ProtocolLevel: Version311, ProtocolName: []byte("MQTT"), CleanSession: true, KeepAlive: 60,
+			ClientID: []byte("client"), WillFlag: true, WillQos: 1, WillTopic: []byte("will"), WillMsg: []byte("msg"),
+			UsernameFlag: true, Username: []byte("user"), PasswordFlag: true, Password: []byte("pass")},
+		&Connect{ProtocolLevel: Version31, ProtocolName: []byte("MQIsdp"), ClientID: []byte("client")},
+		&Connack{Code: CodeAccepted, SessionPresent: 1},
+		&Publish{Qos: QOS_0, TopicName: []byte("a/b"), Payload: []byte("payload")},
+		&Publish{Qos: QOS_2, Dup: true, Retain: true, PacketID: 10, TopicName: []byte("a/b"), Payload: []byte("payload")},
+		&Puback{PacketID: 1},
+		&Pubrec{PacketID: 2},
+		&Pubrel{PacketID: 3},
+		&Pubcomp{PacketID: 4},
+		&Subscribe{PacketID: 5, Topics: []Topic{{Name: "a/+", Qos: QOS_1}, {Name: "#", Qos: QOS_2}}},
+		&Suback{FixHeader: &FixHeader{PacketType: SUBACK, RemainLength: 4}, PacketID: 5, Payload: []byte{QOS_1, SUBSCRIBE_FAILURE}},
+		&Unsubscribe{PacketID: 6, Topics: []string{"a/+", "#"}},
+		&Unsuback{PacketID: 6},
+		&Pingreq{},
+		&Pingresp{},
+		&Disconnect{},
+	}
+	var corpus [][]byte
+	for _, p := range pkts {
+		buf := &bytes.Buffer{}
+		if err := NewWriter(buf).WriteAndFlush(p); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		corpus = append(corpus, buf.Bytes())
+	}
+	return corpus
+}
+
+// mutate returns a copy of b with random bit flips, byte replacements, truncation or appended bytes.
+func mutate(rnd *rand.Rand, b []byte) []byte {
+	m := append([]byte(nil), b...)
+	for n := rnd.Intn(4) + 1; n > 0; n-- {
+		switch rnd.Intn(4) {
+		case 0:
+			i := rnd.Intn(len(m))
+			m[i] ^= 1 << uint(rnd.Intn(8))
+		case 1:
+			m[rnd.Intn(len(m))] = byte(rnd.Intn(256))
+		case 2:
+			m = m[:rnd.Intn(len(m))+1]
+		case 3:
+			m = append(m, byte(rnd.Intn(256)))
+		}
+	}
+	return m
+}
+
+// TestReader_Fuzz feeds the mutated packets into the decoder in both strictness levels.
+// The decoder must not panic, and the decoded packets must be encoded and decoded again into the same packets.
+func TestReader_Fuzz(t *testing.T) {
+	corpus := fuzzCorpus(t)
+	rnd := rand.New(rand.NewSource(1))
+	for i := 0; i < 100000; i++ {
+		in := mutate(rnd, corpus[rnd.Intn(len(corpus))])
+		for _, strictness := range []Strictness{Strict, Lenient} {
+			r := NewReader(bytes.NewBuffer(in))
+			r.SetDecodeOptions(DecodeOptions{Strictness: strictness, MaxRemainLength: 1024})
+			p, err := r.ReadPacket()
+			if err != nil {
+				continue
+			}
+			buf := &bytes.Buffer{}
+			if err := NewWriter(buf).WriteAndFlush(p); err != nil {
+				t.Fatalf("WriteAndFlush() error, input: %v, packet: %s, err: %s", in, p, err)
+			}
+			r = NewReader(buf)
+			r.SetDecodeOptions(DecodeOptions{Strictness: Lenient})
+			p2, err := r.ReadPacket()
+			if err != nil {
+				t.Fatalf("ReadPacket() error after re-encoding, input: %v, packet: %s, err: %s", in, p, err)
+			}
+			if p.String() != p2.String() {
+				t.Fatalf("packet mismatch after re-encoding, input: %v, want %s, got %s", in, p, p2)
+			}
+		}
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/binary"
 	"errors"
 	"io"
+	"sync"
 	"unicode/utf8"
 )
 
@@ -24,6 +25,8 @@ var (
 	ErrInvalWillQos              = errors.New("invalid Will Qos")
 	ErrInvalWillRetain           = errors.New("invalid Will Retain")
 	ErrInvalUTF8String           = errors.New("invalid utf-8 string")
+	ErrControlCharacter          = errors.New("utf-8 string contains control characters")
+	ErrPacketTooLarge            = errors.New("packet too large")
 )
 
 //Packet type
@@ -90,6 +93,64 @@ type FixHeader struct {
 	PacketType   byte
 	Flags        byte
 	RemainLength int
+	// opts is the decode options of the Reader which reads the packet, nil means the default options.
+	opts *DecodeOptions
+}
+
+// Strictness is the level of the protocol conformance checks of the decoder.
+// The ill-formed UTF-8 strings, the U+0000 characters and the remaining lengths beyond
+// DecodeOptions.MaxRemainLength are rejected in all levels.
+type Strictness byte
+
+const (
+	// Strict rejects all packets violating the specification.
+	Strict Strictness = iota
+	// Lenient tolerates the violations which do not affect the decoding of the packet, they are reported to
+	// DecodeOptions.OnViolation instead:
+	// the control characters U+0001..U+001F and U+007F..U+009F in the UTF-8 strings, which the specification
+	// only recommends against, the reserved flags of the PUBACK, PUBREC, PUBREL and PUBCOMP packets,
+	// and the trailing bytes after the payload of the CONNECT packet.
+	Lenient
+)
+
+// DecodeOptions is the options of the Reader.
+type DecodeOptions struct {
+	Strictness Strictness
+	// MaxRemainLength is the maximum remaining length of the packets, 0 means no limit
+	// other than the 256MB limit of the specification. The oversized packets are rejected with ErrPacketTooLarge.
+	MaxRemainLength int
+	// OnViolation is called with the fix header of the packet and the violation tolerated in the Lenient level.
+	OnViolation func(fh *FixHeader, err error)
+}
+
+// violation returns the err if the violation can not be tolerated, otherwise reports the violation and returns nil.
+func (fh *FixHeader) violation(err error) error {
+	if fh.opts == nil || fh.opts.Strictness == Strict {
+		return err
+	}
+	if fh.opts.OnViolation != nil {
+		fh.opts.OnViolation(fh, err)
+	}
+	return nil
+}
+
+// checkFlags checks the reserved flags of the fix header.
+func (fh *FixHeader) checkFlags(flags byte) error {
+	if fh.Flags != flags {
+		return fh.violation(ErrInvalFlags)
+	}
+	return nil
+}
+
+// decodeUTF8String is like DecodeUTF8String but tolerates the control characters in the Lenient level.
+func (fh *FixHeader) decodeUTF8String(buf []byte) (b []byte, size int, err error) {
+	b, size, err = decodeUTF8String(buf)
+	if err == ErrControlCharacter {
+		if err = fh.violation(err); err != nil {
+			return nil, 0, ErrInvalUTF8String
+		}
+	}
+	return b, size, err
 }
 
 // Topic represents the MQTT Topic
@@ -101,6 +162,7 @@ type Topic struct {
 // Reader is used to read data from bufio.Reader and create MQTT packet instance.
 type Reader struct {
 	bufr *bufio.Reader
+	opts DecodeOptions
 }
 
 // Writer is used to encode MQTT packet into bytes and write it to bufio.Writer.
@@ -119,6 +181,11 @@ type ReadWriter struct {
 	*Writer
 }
 
+// SetDecodeOptions sets the decode options of the Reader, the default options are the zero value of DecodeOptions.
+func (r *Reader) SetDecodeOptions(opts DecodeOptions) {
+	r.opts = opts
+}
+
 // NewReader returns a new Reader.
 func NewReader(r io.Reader) *Reader {
 	if bufr, ok := r.(*bufio.Reader); ok {
@@ -143,11 +210,14 @@ func (r *Reader) ReadPacket() (Packet, error) {
 	if err != nil {
 		return nil, err
 	}
-	fh := &FixHeader{PacketType: first >> 4, Flags: first & 15} //设置FixHeader
+	fh := &FixHeader{PacketType: first >> 4, Flags: first & 15, opts: &r.opts} //设置FixHeader
 	length, err := EncodeRemainLength(r.bufr)
 	if err != nil {
 		return nil, err
 	}
+	if max := r.opts.MaxRemainLength; max > 0 && length > max {
+		return nil, ErrPacketTooLarge
+	}
 	fh.RemainLength = length
 	packet, err := NewPacket(fh, r.bufr)
 	return packet, err
@@ -172,18 +242,53 @@ func (w *Writer) WriteAndFlush(packet Packet) error {
 	return w.Flush()
 }
 
+// maxPooledBufSize is the maximum capacity of the buffers put back into encodeBufPool,
+// the buffers grown by the large topic names are dropped.
+const maxPooledBufSize = 1024
+
+// encodeBufPool is the pool of the buffers used to encode the packet headers.
+var encodeBufPool = sync.Pool{
+	New: func() interface{} {
+		b := make([]byte, 0, 128)
+		return &b
+	},
+}
+
+func putEncodeBuf(bufp *[]byte, b []byte) {
+	if cap(b) <= maxPooledBufSize {
+		*bufp = b
+		encodeBufPool.Put(bufp)
+	}
+}
+
+// appendRemainLength appends the encoded remaining length.
+func appendRemainLength(b []byte, length int) ([]byte, error) {
+	if length < 0 || length >= 268435456 {
+		return b, ErrInvalRemainLength
+	}
+	for {
+		encodedByte := byte(length % 128)
+		length /= 128
+		// if there are more data to encode, set the top bit of this byte
+		if length > 0 {
+			encodedByte |= 128
+		}
+		b = append(b, encodedByte)
+		if length == 0 {
+			return b, nil
+		}
+	}
+}
+
 // Pack encodes the FixHeader struct into bytes and writes it into io.Writer.
 func (fh *FixHeader) Pack(w io.Writer) error {
-	var err error
-	b := make([]byte, 1)
-	packetType := fh.PacketType << 4
-	b[0] = packetType | fh.Flags
-	length, err := DecodeRemainLength(fh.RemainLength)
-	if err != nil {
-		return err
+	bufp := encodeBufPool.Get().(*[]byte)
+	b := append((*bufp)[:0], fh.PacketType<<4|fh.Flags)
+	b, err := appendRemainLength(b, fh.RemainLength)
+	if err == nil {
+		_, err = w.Write(b)
 	}
-	b = append(b, length...)
-	_, err = w.Write(b)
+	putEncodeBuf(bufp, b)
 	return err
 }
 
@@ -262,6 +367,16 @@ func EncodeUTF8String(buf []byte) (b []byte, size int, err error) {
 
 // DecodeUTF8String decodes the  UTF-8 encoded strings into bytes, returns the decoded bytes, bytes size and error.
 func DecodeUTF8String(buf []byte) (b []byte, size int, err error) {
+	b, size, err = decodeUTF8String(buf)
+	if err != nil {
+		return nil, 0, ErrInvalUTF8String
+	}
+	return b, size, nil
+}
+
+// decodeUTF8String decodes the UTF-8 encoded string, returns ErrControlCharacter if the string is well-formed
+// but contains the control characters other than U+0000.
+func decodeUTF8String(buf []byte) (b []byte, size int, err error) {
 	buflen := len(buf)
 	if buflen < 2 {
 		return nil, 0, ErrInvalUTF8String
@@ -271,10 +386,9 @@ func DecodeUTF8String(buf []byte) (b []byte, size int, err error) {
 		return nil, 0, ErrInvalUTF8String
 	}
 	payload := buf[2 : length+2]
-	if !ValidUTF8(payload) {
-		return nil, 0, ErrInvalUTF8String
+	if err = validUTF8(payload); err != nil {
+		return payload, length + 2, err
 	}
-
 	return payload, length + 2, nil
 }
 
@@ -319,25 +433,32 @@ func NewPacket(fh *FixHeader, r io.Reader) (Packet, error) {
 //
 // ValidUTF8 returns whether the given bytes is in UTF-8 form.
 func ValidUTF8(p []byte) bool {
+	return validUTF8(p) == nil
+}
+
+// validUTF8 returns ErrInvalUTF8String if the bytes is ill-formed or contains U+0000,
+// and returns ErrControlCharacter if the bytes contains the other control characters.
+func validUTF8(p []byte) error {
+	var rs error
 	for {
 		if len(p) == 0 {
-			return true
+			return rs
 		}
 		ru, size := utf8.DecodeRune(p)
-		if ru >= '\u0000' && ru <= '\u001f' { //[MQTT-1.5.3-2]
-			return false
+		if ru == '\u0000' { //[MQTT-1.5.3-2]
+			return ErrInvalUTF8String
 		}
-		if ru >= '\u007f' && ru <= '\u009f' {
-			return false
+		if (ru > '\u0000' && ru <= '\u001f') || (ru >= '\u007f' && ru <= '\u009f') {
+			rs = ErrControlCharacter
 		}
 		if ru == utf8.RuneError {
-			return false
+			return ErrInvalUTF8String
 		}
 		if !utf8.ValidRune(ru) {
-			return false
+			return ErrInvalUTF8String
 		}
 		if size == 0 {
-			return true
+			return rs
 		}
 		p = p[size:]
 	}
@@ -352,7 +473,7 @@ func ValidTopicName(p []byte) bool {
 	}
 	for {
 		ru, size := utf8.DecodeRune(p)
-		if !utf8.ValidRune(ru) {
+		if !utf8.ValidRune(ru) || (size != 0 && ru == '\u0000') { //[MQTT-4.7.3-2]
 			return false
 		}
 		if size == 1 {
@@ -379,7 +500,7 @@ func ValidTopicFilter(p []byte) bool {
 	var isSetPrevByte bool
 	for {
 		ru, size := utf8.DecodeRune(p)
-		if !utf8.ValidRune(ru) {
+		if !utf8.ValidRune(ru) || (size != 0 && ru == '\u0000') { //[MQTT-4.7.3-2]
 			return false
 		}
 		if size == 1 && isSetPrevByte {
@@ -187,3 +187,48 @@ func TestTopicMatch(t *testing.T) {
 		}
 	}
 }
+
+func TestReader_Strictness(t *testing.T) {
+	var tt = []struct {
+		name       string
+		buf        []byte
+		strictErr  error
+		lenientErr error
+		// violation is whether the violation is reported in the Lenient level.
+		violation bool
+	}{
+		{name: "control character", buf: []byte{0x30, 5, 0, 3, 'a', 0x01, 'b'}, strictErr: ErrInvalUTF8String, violation: true},
+		{name: "null character", buf: []byte{0x30, 5, 0, 3, 'a', 0x00, 'b'}, strictErr: ErrInvalUTF8String, lenientErr: ErrInvalUTF8String},
+		{name: "ill-formed utf-8", buf: []byte{0x30, 4, 0, 2, 0xc3, 0x28}, strictErr: ErrInvalUTF8String, lenientErr: ErrInvalUTF8String},
+		{name: "reserved flags of puback", buf: []byte{0x41, 2, 0, 1}, strictErr: ErrInvalFlags, violation: true},
+		{name: "reserved flags of pubrel", buf: []byte{0x60, 2, 0, 1}, strictErr: ErrInvalFlags, violation: true},
+		{name: "reserved flags of subscribe", buf: []byte{0x80, 6, 0, 1, 0, 1, 'a', 0}, strictErr: ErrInvalFlags, lenientErr: ErrInvalFlags},
+		{name: "trailing bytes of connect", buf: []byte{0x10, 15, 0, 4, 'M', 'Q', 'T', 'T', 4, 2, 0, 0, 0, 1, 'a', 0xff, 0xff},
+			strictErr: ErrInvalRemainLength, violation: true},
+		{name: "oversized remaining length", buf: []byte{0x30, 0x80, 0x01}, strictErr: ErrPacketTooLarge, lenientErr: ErrPacketTooLarge},
+	}
+	for _, v := range tt {
+		for _, strictness := range []Strictness{Strict, Lenient} {
+			var violations []error
+			r := NewReader(bytes.NewBuffer(v.buf))
+			r.SetDecodeOptions(DecodeOptions{
+				Strictness:      strictness,
+				MaxRemainLength: 100,
+				OnViolation: func(fh *FixHeader, err error) {
+					violations = append(violations, err)
+				},
+			})
+			_, err := r.ReadPacket()
+			want := v.strictErr
+			if strictness == Lenient {
+				want = v.lenientErr
+			}
+			if err != want {
+				t.Fatalf("%s: ReadPacket() error with strictness %d, want %v, got %v", v.name, strictness, want, err)
+			}
+			if reported := len(violations) != 0; reported != (strictness == Lenient && v.violation) {
+				t.Fatalf("%s: violations error with strictness %d, got %v", v.name, strictness, violations)
+			}
+		}
+	}
+}
@@ -19,6 +19,9 @@ func (p *Puback) String() string {
 // NewPubackPacket returns a Puback instance by the given FixHeader and io.Reader
 func NewPubackPacket(fh *FixHeader, r io.Reader) (*Puback, error) {
 	p := &Puback{FixHeader: fh}
+	if err := fh.checkFlags(FLAG_RESERVED); err != nil {
+		return nil, err
+	}
 	err := p.Unpack(r)
 	if err != nil {
 		return nil, err
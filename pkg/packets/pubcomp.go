@@ -19,6 +19,9 @@ func (p *Pubcomp) String() string {
 // NewPubcompPacket returns a Pubcomp instance by the given FixHeader and io.Reader
 func NewPubcompPacket(fh *FixHeader, r io.Reader) (*Pubcomp, error) {
 	p := &Pubcomp{FixHeader: fh}
+	if err := fh.checkFlags(FLAG_RESERVED); err != nil {
+		return nil, err
+	}
 	err := p.Unpack(r)
 	if err != nil {
 		return nil, err
@@ -3,6 +3,7 @@ package packets
 import (
 	"encoding/binary"
 	"io"
+	"sync"
 
 	"fmt"
 )
@@ -25,6 +26,33 @@ type Publish struct {
 	TopicName []byte //主题名
 	PacketID         //报文标识符
 	Payload   []byte
+	// encoding is shared by the copies of the publish, see ShareEncoding.
+	encoding *publishEncoding
+}
+
+// publishEncoding is the encoded remaining length and topic name shared by the copies of a publish.
+// They are indexed by whether the packet identifier is present, which changes the remaining length.
+type publishEncoding struct {
+	topicName []byte
+	payload   []byte
+	once      [2]sync.Once
+	encoded   [2][]byte
+	err       [2]error
+}
+
+// sameBytes returns whether a and b refer to the same bytes.
+func sameBytes(a, b []byte) bool {
+	return len(a) == len(b) && (len(a) == 0 || &a[0] == &b[0])
+}
+
+// appendVariableHeader appends the remaining length and the topic name.
+func appendVariableHeader(b []byte, remainLength int, topicName []byte) ([]byte, error) {
+	b, err := appendRemainLength(b, remainLength)
+	if err != nil {
+		return b, err
+	}
+	b = append(b, byte(len(topicName)>>8), byte(len(topicName)))
+	return append(b, topicName...), nil
 }
 
 func (p *Publish) String() string {
@@ -43,6 +71,7 @@ func (p *Publish) CopyPublish() *Publish {
 		PacketID:  p.PacketID,
 		TopicName: p.TopicName,
 		Payload:   p.Payload,
+		encoding:  p.encoding,
 	}
 	/*	pub.Payload = make([]byte, len(p.Payload))
 		pub.TopicName = make([]byte, len(p.TopicName))
@@ -51,6 +80,34 @@ func (p *Publish) CopyPublish() *Publish {
 	return pub
 }
 
+// ShareEncoding makes the copies of the publish returned by CopyPublish share the encoded topic name,
+// so that the message delivered to many subscribers is encoded once instead of once per subscriber.
+// The TopicName and Payload must not be modified after calling ShareEncoding,
+// the copies whose TopicName or Payload are replaced are encoded as usual.
+func (p *Publish) ShareEncoding() {
+	p.encoding = &publishEncoding{topicName: p.TopicName, payload: p.Payload}
+}
+
+// appendHeader appends the encoded remaining length and topic name,
+// which are reused from the shared encoding if possible.
+func (p *Publish) appendHeader(b []byte, remainLength int, withID bool) ([]byte, error) {
+	e := p.encoding
+	if e == nil || !sameBytes(e.topicName, p.TopicName) || !sameBytes(e.payload, p.Payload) {
+		return appendVariableHeader(b, remainLength, p.TopicName)
+	}
+	i := 0
+	if withID {
+		i = 1
+	}
+	e.once[i].Do(func() {
+		e.encoded[i], e.err[i] = appendVariableHeader(nil, remainLength, p.TopicName)
+	})
+	if e.err[i] != nil {
+		return b, e.err[i]
+	}
+	return append(b, e.encoded[i]...), nil
+}
+
 // NewPublishPacket returns a Publish instance by the given FixHeader and io.Reader.
 func NewPublishPacket(fh *FixHeader, r io.Reader) (*Publish, error) {
 	p := &Publish{FixHeader: fh}
@@ -85,25 +142,28 @@ func (p *Publish) Pack(w io.Writer) error {
 		retain = 1
 	}
 	p.FixHeader.Flags = dup | retain | (p.Qos << 1)
-	topicLength := uint16(len(p.TopicName))
-	lenByte := make([]byte, 2)
-	binary.BigEndian.PutUint16(lenByte, topicLength)
-	remainLength := int(topicLength) + 2 + len(p.Payload) //4 : 2个字节packetid 2个字节的topiclen
-	if p.Qos == QOS_1 || p.Qos == QOS_2 {
+	withID := p.Qos == QOS_1 || p.Qos == QOS_2
+	remainLength := len(p.TopicName) + 2 + len(p.Payload) //4 : 2个字节packetid 2个字节的topiclen
+	if withID {
 		remainLength += 2
 	}
 	p.FixHeader.RemainLength = remainLength
-	p.FixHeader.Pack(w)
-	w.Write(lenByte)
-	w.Write(p.TopicName)
-	if p.Qos == QOS_1 || p.Qos == QOS_2 {
-		pid := make([]byte, 2)
-		binary.BigEndian.PutUint16(pid, p.PacketID)
-		w.Write(pid)
-	}
-	_, err := w.Write(p.Payload)
-	return err
 
+	bufp := encodeBufPool.Get().(*[]byte)
+	b := append((*bufp)[:0], PUBLISH<<4|p.FixHeader.Flags)
+	b, err := p.appendHeader(b, remainLength, withID)
+	if err == nil {
+		if withID {
+			b = append(b, byte(p.PacketID>>8), byte(p.PacketID))
+		}
+		_, err = w.Write(b)
+	}
+	putEncodeBuf(bufp, b)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(p.Payload)
+	return err
 }
 
 // Unpack read the packet bytes from io.Reader and decodes it into the packet struct.
@@ -115,7 +175,7 @@ func (p *Publish) Unpack(r io.Reader) error {
 	if err != nil {
 		return err
 	}
-	p.TopicName, size, err = DecodeUTF8String(restBuffer)
+	p.TopicName, size, err = p.FixHeader.decodeUTF8String(restBuffer)
 	if err != nil {
 		return err
 	}
@@ -124,6 +184,9 @@ func (p *Publish) Unpack(r io.Reader) error {
 		return ErrInvalTopicName
 	}
 	if p.Qos > QOS_0 {
+		if len(restBuffer) < 2 {
+			return ErrInvalRemainLength
+		}
 		p.PacketID = binary.BigEndian.Uint16(restBuffer[0:2])
 		restBuffer = restBuffer[2:]
 	}
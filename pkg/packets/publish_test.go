@@ -131,3 +131,68 @@ func TestPublish_NewPubrec(t *testing.T) {
 		t.Fatalf("packet id error ,want %d, got %d", pid, puback.PacketID)
 	}
 }
+
+func TestReadPublishPacket_WildcardTopicName(t *testing.T) {
+	for _, topicName := range []string{"a/+/c", "a/#"} {
+		buf := &bytes.Buffer{}
+		pub := &Publish{
+			Qos:       QOS_1,
+			TopicName: []byte(topicName),
+			PacketID:  10,
+			Payload:   []byte("payload"),
+		}
+		if err := NewWriter(buf).WriteAndFlush(pub); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if _, err := NewReader(buf).ReadPacket(); err != ErrInvalTopicName {
+			t.Fatalf("ReadPacket() error, want %s, got %v", ErrInvalTopicName, err)
+		}
+	}
+}
+
+func TestPublish_ShareEncoding(t *testing.T) {
+	encode := func(p *Publish) []byte {
+		buf := &bytes.Buffer{}
+		if err := NewWriter(buf).WriteAndFlush(p); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		return buf.Bytes()
+	}
+	base := &Publish{
+		Qos:       QOS_2,
+		TopicName: []byte("test topic name"),
+		Payload:   bytes.Repeat([]byte("a"), 200),
+	}
+	base.ShareEncoding()
+	copies := make([]*Publish, 0)
+	for qos := QOS_0; qos <= QOS_2; qos++ {
+		p := base.CopyPublish()
+		p.Qos = qos
+		p.PacketID = PacketID(qos) + 1
+		copies = append(copies, p)
+	}
+	dup := base.CopyPublish()
+	dup.Dup = true
+	dup.PacketID = 10
+	rewritten := base.CopyPublish()
+	rewritten.TopicName = []byte("rewritten")
+	rewritten.PacketID = 11
+	copies = append(copies, dup, rewritten)
+
+	// encode twice to use the shared encoding.
+	for i := 0; i < 2; i++ {
+		for _, p := range copies {
+			want := encode(&Publish{
+				Dup:       p.Dup,
+				Qos:       p.Qos,
+				Retain:    p.Retain,
+				TopicName: p.TopicName,
+				PacketID:  p.PacketID,
+				Payload:   p.Payload,
+			})
+			if got := encode(p); !bytes.Equal(want, got) {
+				t.Fatalf("encoding error, want % x, got % x", want, got)
+			}
+		}
+	}
+}
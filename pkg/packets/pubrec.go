@@ -19,6 +19,9 @@ func (p *Pubrec) String() string {
 // NewPubrecPacket returns a Pubrec instance by the given FixHeader and io.Reader.
 func NewPubrecPacket(fh *FixHeader, r io.Reader) (*Pubrec, error) {
 	p := &Pubrec{FixHeader: fh}
+	if err := fh.checkFlags(FLAG_RESERVED); err != nil {
+		return nil, err
+	}
 	err := p.Unpack(r)
 	if err != nil {
 		return nil, err
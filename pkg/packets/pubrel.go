@@ -21,6 +21,9 @@ func (p *Pubrel) String() string {
 // NewPubrelPacket returns a Pubrel instance by the given FixHeader and io.Reader.
 func NewPubrelPacket(fh *FixHeader, r io.Reader) (*Pubrel, error) {
 	p := &Pubrel{FixHeader: fh}
+	if err := fh.checkFlags(FLAG_PUBREL); err != nil {
+		return nil, err
+	}
 	err := p.Unpack(r)
 	if err != nil {
 		return nil, err
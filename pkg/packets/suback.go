@@ -45,6 +45,9 @@ func (p *Suback) Unpack(r io.Reader) error {
 	if err != nil {
 		return err
 	}
+	if len(restBuffer) < 2 {
+		return ErrInvalRemainLength
+	}
 	p.PacketID = binary.BigEndian.Uint16(restBuffer[0:2])
 	p.Payload = restBuffer[2:]
 	return nil
@@ -66,11 +66,14 @@ func (p *Unsubscribe) Unpack(r io.Reader) error {
 	if err != nil {
 		return err
 	}
+	if len(restBuffer) < 2 {
+		return ErrInvalRemainLength
+	}
 	p.PacketID = binary.BigEndian.Uint16(restBuffer[0:2])
 
 	restBuffer = restBuffer[2:]
 	for {
-		topicName, size, err := DecodeUTF8String(restBuffer)
+		topicName, size, err := p.FixHeader.decodeUTF8String(restBuffer)
 		if err != nil {
 			return err
 		}
@@ -96,11 +96,11 @@ func TestWriteUnSubscribePacket(t *testing.T) {
 		}
 		err := NewWriter(buf).WriteAndFlush(uns)
 		if err != nil {
-			t.Fatalf("unexpected error: %s,%v", err.Error(), string(v.packetID))
+			t.Fatalf("unexpected error: %s,%v", err.Error(), v.packetID)
 		}
 		packet, err := NewReader(buf).ReadPacket()
 		if err != nil {
-			t.Fatalf("unexpected error: %s,%v", err.Error(), string(v.packetID))
+			t.Fatalf("unexpected error: %s,%v", err.Error(), v.packetID)
 		}
 		n, err := buf.ReadByte()
 		if err != io.EOF {
@@ -0,0 +1,166 @@
+package proxyproto
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrNoHeader is returned if the header is required but the connection does not start with it.
+	ErrNoHeader = errors.New("proxy protocol header required")
+	// ErrInvalidHeader is returned if the header is malformed.
+	ErrInvalidHeader = errors.New("invalid proxy protocol header")
+)
+
+const (
+	// v1MaxLength is the maximum length of the v1 header, including the CRLF.
+	v1MaxLength = 107
+	v2HeaderLen = 16
+)
+
+var (
+	v1Prefix    = []byte("PROXY ")
+	v2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+)
+
+// Header is the addresses carried by the PROXY protocol header.
+// Source and Destination are nil if the header does not carry the addresses,
+// such as the v1 UNKNOWN header and the v2 LOCAL command, the addresses of the connection are used then.
+type Header struct {
+	Version     int
+	Source      *net.TCPAddr
+	Destination *net.TCPAddr
+}
+
+// readHeader reads the PROXY protocol header from r. It returns nil if the stream does not start with the header.
+// The first byte of the stream tells whether there may be a header: the v1 header starts with "P" and
+// the v2 header starts with "\r", the MQTT streams never do. The rest of the prefix is peeked only in these cases,
+// so the streams without header are not blocked waiting for more bytes.
+func readHeader(r *bufio.Reader) (*Header, error) {
+	b, err := r.Peek(1)
+	if err != nil {
+		return nil, err
+	}
+	var prefix []byte
+	var read func(r *bufio.Reader) (*Header, error)
+	switch b[0] {
+	case v1Prefix[0]:
+		prefix, read = v1Prefix, readV1
+	case v2Signature[0]:
+		prefix, read = v2Signature, readV2
+	default:
+		return nil, nil
+	}
+	b, err = r.Peek(len(prefix))
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(b, prefix) {
+		return nil, nil
+	}
+	return read(r)
+}
+
+func readV1(r *bufio.Reader) (*Header, error) {
+	var line []byte
+	for len(line) < v1MaxLength {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+	}
+	if !bytes.HasPrefix(line, v1Prefix) || !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, ErrInvalidHeader
+	}
+	fields := strings.Split(string(line[len(v1Prefix):len(line)-2]), " ")
+	h := &Header{Version: 1}
+	switch fields[0] {
+	case "UNKNOWN":
+		// the receiver must ignore the rest of the line.
+		return h, nil
+	case "TCP4", "TCP6":
+	default:
+		return nil, ErrInvalidHeader
+	}
+	if len(fields) != 5 {
+		return nil, ErrInvalidHeader
+	}
+	src, err := parseV1Addr(fields[0], fields[1], fields[3])
+	if err != nil {
+		return nil, err
+	}
+	dst, err := parseV1Addr(fields[0], fields[2], fields[4])
+	if err != nil {
+		return nil, err
+	}
+	h.Source, h.Destination = src, dst
+	return h, nil
+}
+
+func parseV1Addr(proto, ip, port string) (*net.TCPAddr, error) {
+	addr := net.ParseIP(ip)
+	if addr == nil || (proto == "TCP4") != (addr.To4() != nil) {
+		return nil, ErrInvalidHeader
+	}
+	p, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return nil, ErrInvalidHeader
+	}
+	return &net.TCPAddr{IP: addr, Port: int(p)}, nil
+}
+
+func readV2(r *bufio.Reader) (*Header, error) {
+	b := make([]byte, v2HeaderLen)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(b[:len(v2Signature)], v2Signature) || b[12]>>4 != 2 {
+		return nil, ErrInvalidHeader
+	}
+	payload := make([]byte, binary.BigEndian.Uint16(b[14:16]))
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, err
+	}
+	h := &Header{Version: 2}
+	switch b[12] & 0x0f {
+	case 0x00:
+		// LOCAL command, the connection is established by the proxy itself.
+		return h, nil
+	case 0x01:
+	default:
+		return nil, ErrInvalidHeader
+	}
+	var ipLen int
+	switch b[13] {
+	case 0x11: // TCP over IPv4
+		ipLen = net.IPv4len
+	case 0x21: // TCP over IPv6
+		ipLen = net.IPv6len
+	default:
+		// the other families, such as UDP and unix sockets, are not tcp addresses.
+		return h, nil
+	}
+	if len(payload) < ipLen*2+4 {
+		return nil, ErrInvalidHeader
+	}
+	// the TLVs after the addresses are ignored.
+	h.Source = &net.TCPAddr{
+		IP:   net.IP(payload[:ipLen]),
+		Port: int(binary.BigEndian.Uint16(payload[ipLen*2:])),
+	}
+	h.Destination = &net.TCPAddr{
+		IP:   net.IP(payload[ipLen : ipLen*2]),
+		Port: int(binary.BigEndian.Uint16(payload[ipLen*2+2:])),
+	}
+	return h, nil
+}
@@ -0,0 +1,185 @@
+// Package proxyproto parses the PROXY protocol v1 and v2 headers sent by the load balancers such as HAProxy and
+// AWS NLB, so that the connections report the address of the real client instead of the proxy:
+//
+//	ln, _ := net.Listen("tcp", ":1883")
+//	gmqtt.WithTCPListener(proxyproto.NewListener(ln, proxyproto.WithRequired()))
+//
+// The header is read before the connection is returned by Accept, so the RemoteAddr of the connection is
+// the source address in the header, which is seen by the hooks, the connection quotas, the rate limits and the bans.
+package proxyproto
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+const defaultHeaderTimeout = 5 * time.Second
+
+// Option is the option of the Listener.
+type Option func(l *Listener)
+
+// WithRequired rejects the connections which do not start with the header.
+// By default, the connections without header are accepted with their own addresses.
+func WithRequired() Option {
+	return func(l *Listener) {
+		l.required = true
+	}
+}
+
+// WithHeaderTimeout sets the time to wait for the header, the connection is closed if the timeout is exceeded.
+// Default to 5 seconds.
+func WithHeaderTimeout(timeout time.Duration) Option {
+	return func(l *Listener) {
+		l.headerTimeout = timeout
+	}
+}
+
+// WithErrorHandler sets the callback called when the header of a connection can not be read,
+// the connection is closed after the callback returns.
+func WithErrorHandler(fn func(conn net.Conn, err error)) Option {
+	return func(l *Listener) {
+		l.onError = fn
+	}
+}
+
+// Conn is the connection accepted by the Listener.
+type Conn struct {
+	net.Conn
+	r      *bufio.Reader
+	header *Header
+}
+
+// Read reads the data following the header.
+func (c *Conn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
+
+// RemoteAddr returns the source address in the header, or the address of the connection if the header does not
+// carry the addresses.
+func (c *Conn) RemoteAddr() net.Addr {
+	if c.header != nil && c.header.Source != nil {
+		return c.header.Source
+	}
+	return c.Conn.RemoteAddr()
+}
+
+// LocalAddr returns the destination address in the header, or the address of the connection if the header does not
+// carry the addresses.
+func (c *Conn) LocalAddr() net.Addr {
+	if c.header != nil && c.header.Destination != nil {
+		return c.header.Destination
+	}
+	return c.Conn.LocalAddr()
+}
+
+// Header returns the PROXY protocol header of the connection, nil if the connection does not start with a header.
+func (c *Conn) Header() *Header {
+	return c.header
+}
+
+type acceptResult struct {
+	conn net.Conn
+	err  error
+}
+
+// Listener is the net.Listener which reads the PROXY protocol header of the accepted connections.
+// The headers are read concurrently, so a slow connection does not block the others.
+type Listener struct {
+	net.Listener
+	required      bool
+	headerTimeout time.Duration
+	onError       func(conn net.Conn, err error)
+
+	once      sync.Once
+	closeOnce sync.Once
+	ready     chan acceptResult
+	closed    chan struct{}
+}
+
+// NewListener returns the Listener which wraps l.
+func NewListener(l net.Listener, opts ...Option) *Listener {
+	ln := &Listener{
+		Listener:      l,
+		headerTimeout: defaultHeaderTimeout,
+		ready:         make(chan acceptResult),
+		closed:        make(chan struct{}),
+	}
+	for _, fn := range opts {
+		fn(ln)
+	}
+	return ln
+}
+
+// Accept returns the next connection whose header has been read.
+func (l *Listener) Accept() (net.Conn, error) {
+	l.once.Do(func() {
+		go l.acceptLoop()
+	})
+	select {
+	case rs := <-l.ready:
+		return rs.conn, rs.err
+	case <-l.closed:
+		return nil, errListenerClosed
+	}
+}
+
+// Close closes the listener.
+func (l *Listener) Close() error {
+	l.closeOnce.Do(func() {
+		close(l.closed)
+	})
+	return l.Listener.Close()
+}
+
+var errListenerClosed = errors.New("use of closed network connection")
+
+func (l *Listener) acceptLoop() {
+	for {
+		c, err := l.Listener.Accept()
+		if err != nil {
+			select {
+			case l.ready <- acceptResult{err: err}:
+			case <-l.closed:
+				return
+			}
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				continue
+			}
+			return
+		}
+		go l.readHeader(c)
+	}
+}
+
+func (l *Listener) readHeader(c net.Conn) {
+	conn := &Conn{
+		Conn: c,
+		r:    bufio.NewReader(c),
+	}
+	if l.headerTimeout > 0 {
+		c.SetReadDeadline(time.Now().Add(l.headerTimeout))
+	}
+	h, err := readHeader(conn.r)
+	if err == nil && h == nil && l.required {
+		err = ErrNoHeader
+	}
+	if err != nil {
+		if l.onError != nil {
+			l.onError(c, err)
+		}
+		c.Close()
+		return
+	}
+	if l.headerTimeout > 0 {
+		c.SetReadDeadline(time.Time{})
+	}
+	conn.header = h
+	select {
+	case l.ready <- acceptResult{conn: conn}:
+	case <-l.closed:
+		c.Close()
+	}
+}
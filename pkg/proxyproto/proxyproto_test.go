@@ -0,0 +1,174 @@
+package proxyproto
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func v2Header(cmd, family byte, addrs []byte) []byte {
+	b := append([]byte{}, v2Signature...)
+	b = append(b, 0x20|cmd, family, 0, 0)
+	binary.BigEndian.PutUint16(b[14:], uint16(len(addrs)))
+	return append(b, addrs...)
+}
+
+func TestReadHeader(t *testing.T) {
+	a := assert.New(t)
+	ipv4 := []byte{192, 168, 0, 1, 10, 0, 0, 1, 0x30, 0x39, 0x07, 0x5b}
+	ipv6 := append(append(net.ParseIP("2001:db8::1").To16(), net.ParseIP("2001:db8::2").To16()...), 0x30, 0x39, 0x07, 0x5b)
+	var tt = []struct {
+		name   string
+		input  []byte
+		header *Header
+		err    error
+	}{
+		{
+			name:  "v1_tcp4",
+			input: []byte("PROXY TCP4 192.168.0.1 10.0.0.1 12345 1883\r\n"),
+			header: &Header{
+				Version:     1,
+				Source:      &net.TCPAddr{IP: net.ParseIP("192.168.0.1"), Port: 12345},
+				Destination: &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 1883},
+			},
+		},
+		{
+			name:  "v1_tcp6",
+			input: []byte("PROXY TCP6 2001:db8::1 2001:db8::2 12345 1883\r\n"),
+			header: &Header{
+				Version:     1,
+				Source:      &net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 12345},
+				Destination: &net.TCPAddr{IP: net.ParseIP("2001:db8::2"), Port: 1883},
+			},
+		},
+		{
+			name:   "v1_unknown",
+			input:  []byte("PROXY UNKNOWN ignored\r\n"),
+			header: &Header{Version: 1},
+		},
+		{
+			name:  "v1_family_mismatch",
+			input: []byte("PROXY TCP4 2001:db8::1 2001:db8::2 12345 1883\r\n"),
+			err:   ErrInvalidHeader,
+		},
+		{
+			name:  "v1_invalid_port",
+			input: []byte("PROXY TCP4 192.168.0.1 10.0.0.1 123456 1883\r\n"),
+			err:   ErrInvalidHeader,
+		},
+		{
+			name:  "v1_too_long",
+			input: append([]byte("PROXY TCP4 "), bytes.Repeat([]byte("1"), 120)...),
+			err:   ErrInvalidHeader,
+		},
+		{
+			name:  "v2_ipv4",
+			input: v2Header(0x01, 0x11, ipv4),
+			header: &Header{
+				Version:     2,
+				Source:      &net.TCPAddr{IP: net.IP{192, 168, 0, 1}, Port: 12345},
+				Destination: &net.TCPAddr{IP: net.IP{10, 0, 0, 1}, Port: 1883},
+			},
+		},
+		{
+			name:  "v2_ipv6_with_tlv",
+			input: v2Header(0x01, 0x21, append(ipv6, 0x04, 0x00, 0x01, 0xff)),
+			header: &Header{
+				Version:     2,
+				Source:      &net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 12345},
+				Destination: &net.TCPAddr{IP: net.ParseIP("2001:db8::2"), Port: 1883},
+			},
+		},
+		{
+			name:   "v2_local",
+			input:  v2Header(0x00, 0x00, nil),
+			header: &Header{Version: 2},
+		},
+		{
+			name:  "v2_short_addresses",
+			input: v2Header(0x01, 0x11, ipv4[:8]),
+			err:   ErrInvalidHeader,
+		},
+		{
+			name:  "no_header",
+			input: []byte{0x10, 0x0c},
+		},
+		{
+			name:  "not_proxy",
+			input: []byte("PUT / HTTP/1.1\r\n"),
+		},
+	}
+	for _, v := range tt {
+		t.Run(v.name, func(t *testing.T) {
+			h, err := readHeader(bufio.NewReader(bytes.NewReader(v.input)))
+			a.Equal(v.err, err)
+			if v.header == nil {
+				a.Nil(h)
+				return
+			}
+			a.Equal(v.header.Version, h.Version)
+			if v.header.Source == nil {
+				a.Nil(h.Source)
+				a.Nil(h.Destination)
+				return
+			}
+			a.Equal(v.header.Source.String(), h.Source.String())
+			a.Equal(v.header.Destination.String(), h.Destination.String())
+		})
+	}
+}
+
+func TestListener(t *testing.T) {
+	a := assert.New(t)
+	raw, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	errs := make(chan error, 1)
+	ln := NewListener(raw, WithRequired(), WithHeaderTimeout(time.Second), WithErrorHandler(func(conn net.Conn, err error) {
+		errs <- err
+	}))
+	defer ln.Close()
+
+	// a connection without header is rejected and does not block the next one.
+	c1, err := net.Dial("tcp", raw.Addr().String())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer c1.Close()
+	c1.Write([]byte{0x10, 0x0c})
+
+	c2, err := net.Dial("tcp", raw.Addr().String())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer c2.Close()
+	c2.Write([]byte("PROXY TCP4 192.168.0.1 10.0.0.1 12345 1883\r\npayload"))
+	c2.(*net.TCPConn).CloseWrite()
+
+	conn, err := ln.Accept()
+	a.NoError(err)
+	a.Equal("192.168.0.1:12345", conn.RemoteAddr().String())
+	a.Equal("10.0.0.1:1883", conn.LocalAddr().String())
+	b, err := ioutil.ReadAll(conn)
+	a.NoError(err)
+	a.Equal("payload", string(b))
+	conn.Close()
+
+	select {
+	case err := <-errs:
+		a.Equal(ErrNoHeader, err)
+	case <-time.After(time.Second):
+		t.Fatal("error handler timeout")
+	}
+
+	ln.Close()
+	_, err = ln.Accept()
+	a.Error(err)
+}
@@ -0,0 +1,105 @@
+package revocation
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// crl is the parsed CRL.
+type crl struct {
+	list *pkix.CertificateList
+	// issuer is the distinguished name of the issuer of the CRL.
+	issuer string
+	// revoked is the serial numbers of the revoked certificates.
+	revoked map[string]struct{}
+
+	mu sync.Mutex
+	// verified caches the result of verifying the signature of the CRL, keyed by the raw issuer certificate.
+	verified map[string]error
+}
+
+func (c *Checker) loadCRL(src string) (*crl, error) {
+	var b []byte
+	var err error
+	if strings.HasPrefix(src, "http://") || strings.HasPrefix(src, "https://") {
+		b, err = c.fetch(src)
+	} else {
+		b, err = ioutil.ReadFile(src)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parseCRL(b)
+}
+
+func (c *Checker) fetch(url string) ([]byte, error) {
+	resp, err := c.httpClient.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+// parseCRL parses the PEM or DER encoded CRL.
+func parseCRL(b []byte) (*crl, error) {
+	list, err := x509.ParseCRL(b)
+	if err != nil {
+		return nil, err
+	}
+	var issuer pkix.Name
+	issuer.FillFromRDNSequence(&list.TBSCertList.Issuer)
+	l := &crl{
+		list:     list,
+		issuer:   issuer.String(),
+		revoked:  make(map[string]struct{}),
+		verified: make(map[string]error),
+	}
+	for _, v := range list.TBSCertList.RevokedCertificates {
+		l.revoked[v.SerialNumber.String()] = struct{}{}
+	}
+	return l, nil
+}
+
+// verify verifies the signature of the CRL by the issuer.
+func (l *crl) verify(issuer *x509.Certificate) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	key := string(issuer.Raw)
+	if err, ok := l.verified[key]; ok {
+		return err
+	}
+	err := issuer.CheckCRLSignature(l.list)
+	l.verified[key] = err
+	return err
+}
+
+// checkCRL returns ErrRevoked if the certificate is in the CRL of its issuer.
+func (c *Checker) checkCRL(cert, issuer *x509.Certificate) error {
+	name := cert.Issuer.String()
+	serial := cert.SerialNumber.String()
+	c.crlMu.RLock()
+	defer c.crlMu.RUnlock()
+	for _, l := range c.crls {
+		if l.issuer != name {
+			continue
+		}
+		if _, ok := l.revoked[serial]; !ok {
+			continue
+		}
+		// the CRL may be issued by a different CA with the same name.
+		if err := l.verify(issuer); err != nil {
+			continue
+		}
+		return ErrRevoked
+	}
+	return nil
+}
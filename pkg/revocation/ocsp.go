@@ -0,0 +1,238 @@
+package revocation
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/crypto/ocsp"
+)
+
+type ocspEntry struct {
+	err      error
+	expireAt time.Time
+}
+
+// queryOCSP queries the status of the certificate from its OCSP responders.
+func queryOCSP(client *http.Client, cert, issuer *x509.Certificate) (*ocsp.Response, []byte, error) {
+	if len(cert.OCSPServer) == 0 {
+		return nil, nil, errors.New("no ocsp responder")
+	}
+	req, err := ocsp.CreateRequest(cert, issuer, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, server := range cert.OCSPServer {
+		var resp *http.Response
+		resp, err = client.Post(server, "application/ocsp-request", bytes.NewReader(req))
+		if err != nil {
+			continue
+		}
+		var b []byte
+		b, err = ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			continue
+		}
+		if resp.StatusCode != http.StatusOK {
+			err = fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+			continue
+		}
+		var rs *ocsp.Response
+		// ParseResponseForCert verifies the signature of the response as well.
+		rs, err = ocsp.ParseResponseForCert(b, cert, issuer)
+		if err != nil {
+			continue
+		}
+		return rs, b, nil
+	}
+	return nil, nil, err
+}
+
+// nextUpdate returns the time until which the response is valid.
+func nextUpdate(rs *ocsp.Response, now time.Time) time.Time {
+	if rs.NextUpdate.IsZero() {
+		return now.Add(defaultOCSPCacheTTL)
+	}
+	return rs.NextUpdate
+}
+
+// checkOCSP checks the certificate by OCSP. The certificates without the OCSP responders are not checked.
+func (c *Checker) checkOCSP(cert, issuer *x509.Certificate) error {
+	if len(cert.OCSPServer) == 0 {
+		return nil
+	}
+	key := cert.Issuer.String() + "/" + cert.SerialNumber.String()
+	now := time.Now()
+	c.ocspMu.Lock()
+	if e, ok := c.ocspCache[key]; ok && now.Before(e.expireAt) {
+		c.ocspMu.Unlock()
+		return e.err
+	}
+	c.ocspMu.Unlock()
+
+	rs, _, err := queryOCSP(c.httpClient, cert, issuer)
+	if err != nil {
+		// the errors are not cached.
+		c.log.Warn("querying ocsp error", zap.String("serial", cert.SerialNumber.String()), zap.Error(err))
+		if c.softFail {
+			return nil
+		}
+		return err
+	}
+	switch rs.Status {
+	case ocsp.Good:
+		err = nil
+	case ocsp.Revoked:
+		err = ErrRevoked
+	default:
+		err = ErrUnknownStatus
+	}
+	c.ocspMu.Lock()
+	for k, e := range c.ocspCache {
+		if !now.Before(e.expireAt) {
+			delete(c.ocspCache, k)
+		}
+	}
+	c.ocspCache[key] = &ocspEntry{err: err, expireAt: nextUpdate(rs, now)}
+	c.ocspMu.Unlock()
+	if err == ErrUnknownStatus && c.softFail {
+		return nil
+	}
+	return err
+}
+
+const (
+	// minStapleRefreshInterval is the minimum interval to refresh the stapled OCSP response.
+	minStapleRefreshInterval = time.Minute
+	// stapleRetryInterval is the interval to retry after the refreshing fails.
+	stapleRetryInterval = 5 * time.Minute
+)
+
+// Stapler staples the OCSP response of the server certificate to the TLS handshakes,
+// it is used as tls.Config.GetCertificate:
+//
+//	stapler, err := revocation.NewStapler(cert, nil)
+//	tlsConfig.GetCertificate = stapler.GetCertificate
+//
+// The response is refreshed at the half of its validity period.
+type Stapler struct {
+	cert       tls.Certificate
+	leaf       *x509.Certificate
+	issuer     *x509.Certificate
+	httpClient *http.Client
+
+	mu     sync.RWMutex
+	staple *tls.Certificate
+	// stapleExpireAt is the next update time of the stapled response,
+	// the expired response is not stapled any more.
+	stapleExpireAt time.Time
+
+	closeOnce sync.Once
+	done      chan struct{}
+	wg        sync.WaitGroup
+}
+
+// NewStapler returns the Stapler of the certificate, the issuer certificate must be the second certificate
+// of the chain. If client is nil, a client with 5 seconds timeout is used.
+// It returns the error if the OCSP response can not be fetched.
+func NewStapler(cert tls.Certificate, client *http.Client) (*Stapler, error) {
+	if len(cert.Certificate) < 2 {
+		return nil, errors.New("the certificate chain has no issuer")
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return nil, err
+	}
+	issuer, err := x509.ParseCertificate(cert.Certificate[1])
+	if err != nil {
+		return nil, err
+	}
+	if client == nil {
+		client = &http.Client{Timeout: defaultTimeout}
+	}
+	s := &Stapler{
+		cert:       cert,
+		leaf:       leaf,
+		issuer:     issuer,
+		httpClient: client,
+		done:       make(chan struct{}),
+	}
+	next, err := s.refresh()
+	if err != nil {
+		return nil, err
+	}
+	s.wg.Add(1)
+	go s.refreshLoop(next)
+	return s, nil
+}
+
+// refresh fetches the OCSP response and returns the time of the next refreshing.
+func (s *Stapler) refresh() (time.Time, error) {
+	rs, raw, err := queryOCSP(s.httpClient, s.leaf, s.issuer)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if rs.Status != ocsp.Good {
+		return time.Time{}, fmt.Errorf("unexpected ocsp status: %d", rs.Status)
+	}
+	cert := s.cert
+	cert.OCSPStaple = raw
+	now := time.Now()
+	expireAt := nextUpdate(rs, now)
+	s.mu.Lock()
+	s.staple = &cert
+	s.stapleExpireAt = expireAt
+	s.mu.Unlock()
+	interval := expireAt.Sub(now) / 2
+	if interval < minStapleRefreshInterval {
+		interval = minStapleRefreshInterval
+	}
+	return now.Add(interval), nil
+}
+
+func (s *Stapler) refreshLoop(next time.Time) {
+	defer s.wg.Done()
+	timer := time.NewTimer(time.Until(next))
+	defer timer.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-timer.C:
+			n, err := s.refresh()
+			if err != nil {
+				// keep stapling the previous response until it expires.
+				timer.Reset(stapleRetryInterval)
+				continue
+			}
+			timer.Reset(time.Until(n))
+		}
+	}
+}
+
+// GetCertificate returns the certificate with the stapled OCSP response,
+// or the certificate without the response if the response has expired.
+func (s *Stapler) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if !time.Now().Before(s.stapleExpireAt) {
+		return &s.cert, nil
+	}
+	return s.staple, nil
+}
+
+// Close stops refreshing the OCSP response.
+func (s *Stapler) Close() {
+	s.closeOnce.Do(func() {
+		close(s.done)
+	})
+	s.wg.Wait()
+}
@@ -0,0 +1,190 @@
+// Package revocation checks the revocation status of the TLS client certificates by the CRLs and OCSP,
+// so that the revoked certificates are rejected at handshake time:
+//
+//	checker, err := revocation.New(revocation.WithCRL("/etc/gmqtt/ca.crl"), revocation.WithOCSP())
+//	tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+//	tlsConfig.VerifyPeerCertificate = checker.VerifyPeerCertificate
+//
+// It also provides the Stapler which staples the OCSP response of the server certificate to the handshakes.
+package revocation
+
+import (
+	"crypto/x509"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+var (
+	// ErrRevoked is returned if the certificate has been revoked.
+	ErrRevoked = errors.New("certificate revoked")
+	// ErrUnknownStatus is returned if the OCSP responder does not know the certificate.
+	ErrUnknownStatus = errors.New("unknown certificate status")
+)
+
+const (
+	defaultCRLRefreshInterval = time.Hour
+	defaultTimeout            = 5 * time.Second
+	// defaultOCSPCacheTTL is the cache duration of the OCSP responses without the next update time.
+	defaultOCSPCacheTTL = time.Hour
+)
+
+// Option is the option of the Checker.
+type Option func(c *Checker)
+
+// WithCRL adds the CRL sources, each source is a file path or a http(s) url of the PEM or DER encoded CRL.
+// The CRLs are loaded by New and reloaded every refresh interval.
+func WithCRL(sources ...string) Option {
+	return func(c *Checker) {
+		c.crlSources = append(c.crlSources, sources...)
+	}
+}
+
+// WithCRLRefreshInterval sets the interval to reload the CRLs, default to 1 hour.
+// The previous CRL is kept if the reloading fails.
+func WithCRLRefreshInterval(interval time.Duration) Option {
+	return func(c *Checker) {
+		c.crlRefreshInterval = interval
+	}
+}
+
+// WithOCSP enables the OCSP checking, the responders are read from the authority information access
+// extension of the certificates. The responses are cached until their next update time.
+func WithOCSP() Option {
+	return func(c *Checker) {
+		c.ocsp = true
+	}
+}
+
+// WithSoftFail accepts the certificate if its OCSP status can not be determined, such as the responder
+// is unavailable or responds the unknown status. Default to reject the certificate.
+func WithSoftFail() Option {
+	return func(c *Checker) {
+		c.softFail = true
+	}
+}
+
+// WithHTTPClient sets the http client to fetch the CRLs and OCSP responses, default to a client with 5 seconds timeout.
+func WithHTTPClient(client *http.Client) Option {
+	return func(c *Checker) {
+		c.httpClient = client
+	}
+}
+
+// WithLogger sets the logger to log the refreshing errors, default to no logging.
+func WithLogger(logger *zap.Logger) Option {
+	return func(c *Checker) {
+		c.log = logger
+	}
+}
+
+// Checker checks the revocation status of the client certificates.
+type Checker struct {
+	crlSources         []string
+	crlRefreshInterval time.Duration
+	ocsp               bool
+	softFail           bool
+	httpClient         *http.Client
+	log                *zap.Logger
+
+	crlMu sync.RWMutex
+	// crls is the loaded CRLs, keyed by the source.
+	crls map[string]*crl
+
+	ocspMu    sync.Mutex
+	ocspCache map[string]*ocspEntry
+
+	closeOnce sync.Once
+	done      chan struct{}
+	wg        sync.WaitGroup
+}
+
+// New returns the Checker, it returns the error if any CRL can not be loaded.
+func New(opts ...Option) (*Checker, error) {
+	c := &Checker{
+		crlRefreshInterval: defaultCRLRefreshInterval,
+		httpClient:         &http.Client{Timeout: defaultTimeout},
+		log:                zap.NewNop(),
+		crls:               make(map[string]*crl),
+		ocspCache:          make(map[string]*ocspEntry),
+		done:               make(chan struct{}),
+	}
+	for _, fn := range opts {
+		fn(c)
+	}
+	for _, src := range c.crlSources {
+		l, err := c.loadCRL(src)
+		if err != nil {
+			return nil, err
+		}
+		c.crls[src] = l
+	}
+	if len(c.crlSources) != 0 && c.crlRefreshInterval > 0 {
+		c.wg.Add(1)
+		go c.refreshLoop()
+	}
+	return c, nil
+}
+
+// Close stops reloading the CRLs.
+func (c *Checker) Close() {
+	c.closeOnce.Do(func() {
+		close(c.done)
+	})
+	c.wg.Wait()
+}
+
+func (c *Checker) refreshLoop() {
+	defer c.wg.Done()
+	ticker := time.NewTicker(c.crlRefreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+			for _, src := range c.crlSources {
+				l, err := c.loadCRL(src)
+				if err != nil {
+					c.log.Error("reloading crl error", zap.String("source", src), zap.Error(err))
+					continue
+				}
+				c.crlMu.Lock()
+				c.crls[src] = l
+				c.crlMu.Unlock()
+			}
+		}
+	}
+}
+
+// VerifyPeerCertificate rejects the revoked client certificates, it is used as tls.Config.VerifyPeerCertificate.
+// It checks the verified chains only, so the ClientAuth of the tls.Config must verify the client certificates,
+// such as tls.RequireAndVerifyClientCert.
+func (c *Checker) VerifyPeerCertificate(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
+	var err error
+	for _, chain := range verifiedChains {
+		if err = c.checkChain(chain); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// checkChain checks each certificate of the chain except the root.
+func (c *Checker) checkChain(chain []*x509.Certificate) error {
+	for i := 0; i+1 < len(chain); i++ {
+		cert, issuer := chain[i], chain[i+1]
+		if err := c.checkCRL(cert, issuer); err != nil {
+			return err
+		}
+		if c.ocsp {
+			if err := c.checkOCSP(cert, issuer); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,231 @@
+package revocation
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ocsp"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  crypto.Signer
+}
+
+func newTestCA(t *testing.T, cn string) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	tpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tpl, tpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	return &testCA{cert: cert, key: key}
+}
+
+func (ca *testCA) issue(t *testing.T, serial int64, ocspServer ...string) (*x509.Certificate, crypto.Signer) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	tpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "device"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
+		OCSPServer:   ocspServer,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	return cert, key
+}
+
+func (ca *testCA) crl(t *testing.T, serials ...int64) []byte {
+	var revoked []pkix.RevokedCertificate
+	for _, v := range serials {
+		revoked = append(revoked, pkix.RevokedCertificate{SerialNumber: big.NewInt(v), RevocationTime: time.Now()})
+	}
+	b, err := ca.cert.CreateCRL(rand.Reader, ca.key, revoked, time.Now(), time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	return b
+}
+
+// ocspResponder returns the OCSP responder which responds the status of the serial numbers, the other
+// certificates are good.
+func (ca *testCA) ocspResponder(t *testing.T, status map[int64]int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		req, err := ocsp.ParseRequest(b)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		tpl := ocsp.Response{
+			Status:       status[req.SerialNumber.Int64()],
+			SerialNumber: req.SerialNumber,
+			ThisUpdate:   time.Now(),
+			NextUpdate:   time.Now().Add(time.Hour),
+		}
+		if tpl.Status == ocsp.Revoked {
+			tpl.RevokedAt = time.Now()
+		}
+		rs, err := ocsp.CreateResponse(ca.cert, ca.cert, tpl, ca.key)
+		if err != nil {
+			t.Errorf("unexpected error: %s", err)
+			return
+		}
+		w.Write(rs)
+	}))
+}
+
+func TestChecker_CRL(t *testing.T) {
+	a := assert.New(t)
+	ca := newTestCA(t, "ca")
+	// otherCA has the same name as ca, its CRL must not revoke the certificates issued by ca.
+	otherCA := newTestCA(t, "ca")
+	good, _ := ca.issue(t, 10)
+	revoked, _ := ca.issue(t, 11)
+	revokedByOther, _ := ca.issue(t, 12)
+
+	dir, err := ioutil.TempDir("", "revocation")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "ca.crl")
+	a.NoError(ioutil.WriteFile(path, ca.crl(t, 11), 0644))
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(otherCA.crl(t, 12))
+	}))
+	defer ts.Close()
+
+	c, err := New(WithCRL(path, ts.URL))
+	a.NoError(err)
+	defer c.Close()
+	a.NoError(c.VerifyPeerCertificate(nil, [][]*x509.Certificate{{good, ca.cert}}))
+	a.Equal(ErrRevoked, c.VerifyPeerCertificate(nil, [][]*x509.Certificate{{revoked, ca.cert}}))
+	a.NoError(c.VerifyPeerCertificate(nil, [][]*x509.Certificate{{revokedByOther, ca.cert}}))
+	// no client certificate
+	a.NoError(c.VerifyPeerCertificate(nil, nil))
+
+	_, err = New(WithCRL(filepath.Join(dir, "not_exist.crl")))
+	a.Error(err)
+}
+
+func TestChecker_CRLRefresh(t *testing.T) {
+	a := assert.New(t)
+	ca := newTestCA(t, "ca")
+	cert, _ := ca.issue(t, 10)
+	dir, err := ioutil.TempDir("", "revocation")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "ca.crl")
+	a.NoError(ioutil.WriteFile(path, ca.crl(t), 0644))
+
+	c, err := New(WithCRL(path), WithCRLRefreshInterval(10*time.Millisecond))
+	a.NoError(err)
+	defer c.Close()
+	chains := [][]*x509.Certificate{{cert, ca.cert}}
+	a.NoError(c.VerifyPeerCertificate(nil, chains))
+	a.NoError(ioutil.WriteFile(path, ca.crl(t, 10), 0644))
+	a.Eventually(func() bool {
+		return c.VerifyPeerCertificate(nil, chains) == ErrRevoked
+	}, time.Second, 10*time.Millisecond)
+	// the previous CRL is kept if the file is invalid.
+	a.NoError(ioutil.WriteFile(path, []byte("invalid"), 0644))
+	time.Sleep(50 * time.Millisecond)
+	a.Equal(ErrRevoked, c.VerifyPeerCertificate(nil, chains))
+}
+
+func TestChecker_OCSP(t *testing.T) {
+	a := assert.New(t)
+	ca := newTestCA(t, "ca")
+	ts := ca.ocspResponder(t, map[int64]int{11: ocsp.Revoked, 12: ocsp.Unknown})
+	defer ts.Close()
+	good, _ := ca.issue(t, 10, ts.URL)
+	revoked, _ := ca.issue(t, 11, ts.URL)
+	unknown, _ := ca.issue(t, 12, ts.URL)
+	unavailable, _ := ca.issue(t, 13, "http://127.0.0.1:1")
+	noResponder, _ := ca.issue(t, 14)
+
+	c, err := New(WithOCSP())
+	a.NoError(err)
+	defer c.Close()
+	a.NoError(c.VerifyPeerCertificate(nil, [][]*x509.Certificate{{good, ca.cert}}))
+	a.Equal(ErrRevoked, c.VerifyPeerCertificate(nil, [][]*x509.Certificate{{revoked, ca.cert}}))
+	a.Equal(ErrUnknownStatus, c.VerifyPeerCertificate(nil, [][]*x509.Certificate{{unknown, ca.cert}}))
+	a.Error(c.VerifyPeerCertificate(nil, [][]*x509.Certificate{{unavailable, ca.cert}}))
+	a.NoError(c.VerifyPeerCertificate(nil, [][]*x509.Certificate{{noResponder, ca.cert}}))
+
+	// the responses are cached.
+	ts.Close()
+	a.Equal(ErrRevoked, c.VerifyPeerCertificate(nil, [][]*x509.Certificate{{revoked, ca.cert}}))
+
+	c, err = New(WithOCSP(), WithSoftFail())
+	a.NoError(err)
+	defer c.Close()
+	a.NoError(c.VerifyPeerCertificate(nil, [][]*x509.Certificate{{unavailable, ca.cert}}))
+}
+
+func TestStapler(t *testing.T) {
+	a := assert.New(t)
+	ca := newTestCA(t, "ca")
+	ts := ca.ocspResponder(t, nil)
+	defer ts.Close()
+	cert, key := ca.issue(t, 10, ts.URL)
+
+	s, err := NewStapler(tls.Certificate{
+		Certificate: [][]byte{cert.Raw, ca.cert.Raw},
+		PrivateKey:  key,
+	}, nil)
+	a.NoError(err)
+	defer s.Close()
+	c, err := s.GetCertificate(nil)
+	a.NoError(err)
+	rs, err := ocsp.ParseResponseForCert(c.OCSPStaple, cert, ca.cert)
+	a.NoError(err)
+	a.Equal(ocsp.Good, rs.Status)
+
+	_, err = NewStapler(tls.Certificate{Certificate: [][]byte{cert.Raw}, PrivateKey: key}, nil)
+	a.Error(err)
+}
@@ -0,0 +1,465 @@
+// Package spool provides a FIFO queue of records stored in the segment files on disk, so that the messages of
+// an unreachable link can be kept without filling the memory, and drained in order once the link recovers.
+package spool
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultSegmentSize is the default maximum size of a segment file.
+	DefaultSegmentSize = 16 << 20
+	// headerSize is the size of the record header: length(4) | crc32(4) | unix nano time(8).
+	headerSize = 16
+	segmentExt = ".seg"
+	// cursorFile stores the sequence and the offset of the next record to read.
+	cursorFile = "cursor"
+)
+
+var (
+	// ErrEmpty is returned by Peek and Pop if the spool is empty.
+	ErrEmpty = errors.New("spool: empty")
+	// ErrClosed is returned if the spool is closed.
+	ErrClosed = errors.New("spool: closed")
+)
+
+// Options is the options of the Spool.
+type Options struct {
+	// SegmentSize is the maximum size of a segment file, default to DefaultSegmentSize.
+	SegmentSize int64
+	// MaxBytes is the maximum total size of the segment files, the oldest segments are removed once it is exceeded.
+	// The segment being written is never removed by the size limit, so it should be larger than SegmentSize.
+	// 0 means no limit.
+	MaxBytes int64
+	// MaxAge is the maximum age of the records, a segment is removed once its newest record is older than MaxAge.
+	// 0 means no limit.
+	MaxAge time.Duration
+	// Sync is whether to fsync the segment after each Push. Otherwise the records are written to the page cache
+	// only, and the records pushed shortly before a power loss or an OS crash can be lost.
+	// The read position is never synced, so the records popped shortly before a crash may be read again.
+	Sync bool
+}
+
+// Record is the record returned by PeekRecord.
+type Record struct {
+	Data []byte
+	// At is the time the record was pushed.
+	At time.Time
+	// seq and off are the position of the record.
+	seq uint64
+	off int64
+}
+
+type segment struct {
+	seq  uint64
+	size int64
+	// records is the number of the unread records.
+	records int
+	// modTime is the time of the newest record.
+	modTime time.Time
+}
+
+// Spool is a FIFO queue of records stored in the segment files of a directory. The records are appended to
+// the last segment, a new segment is started once the segment size is exceeded, and the segments are removed
+// once all their records are read or they are beyond the limits. The read position is kept across restarts.
+// It is safe for concurrent use.
+type Spool struct {
+	dir  string
+	opts Options
+
+	mu   sync.Mutex
+	segs []*segment
+	// w is the writer of the last segment.
+	w *os.File
+	// r is the reader of the first segment, nil if it is not opened.
+	r *os.File
+	// rOff is the offset of the next record in the first segment.
+	rOff    int64
+	cursor  *os.File
+	len     int
+	bytes   int64
+	dropped uint64
+	closed  bool
+}
+
+func (s *Spool) segmentPath(seq uint64) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%020d%s", seq, segmentExt))
+}
+
+// Open opens the spool in the directory, the directory is created if not exists.
+// The records written before are restored, the incomplete record at the end of the last segment is discarded.
+func Open(dir string, opts Options) (*Spool, error) {
+	if opts.SegmentSize <= 0 {
+		opts.SegmentSize = DefaultSegmentSize
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	s := &Spool{dir: dir, opts: opts}
+	var err error
+	s.cursor, err = os.OpenFile(filepath.Join(dir, cursorFile), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	var cur [16]byte
+	var curSeq uint64
+	var curOff int64
+	if _, err := s.cursor.ReadAt(cur[:], 0); err == nil {
+		curSeq = binary.BigEndian.Uint64(cur[0:])
+		curOff = int64(binary.BigEndian.Uint64(cur[8:]))
+	}
+	names, err := filepath.Glob(filepath.Join(dir, "*"+segmentExt))
+	if err != nil {
+		s.cursor.Close()
+		return nil, err
+	}
+	var seqs []uint64
+	for _, name := range names {
+		seq, err := strconv.ParseUint(strings.TrimSuffix(filepath.Base(name), segmentExt), 10, 64)
+		if err == nil {
+			seqs = append(seqs, seq)
+		}
+	}
+	sort.Slice(seqs, func(i, j int) bool { return seqs[i] < seqs[j] })
+	for _, seq := range seqs {
+		if seq < curSeq {
+			os.Remove(s.segmentPath(seq))
+			continue
+		}
+		var off int64
+		if seq == curSeq {
+			off = curOff
+		}
+		seg, err := scan(s.segmentPath(seq), seq, off)
+		if err != nil {
+			s.cursor.Close()
+			return nil, err
+		}
+		if len(s.segs) == 0 {
+			s.rOff = off
+		}
+		s.segs = append(s.segs, seg)
+		s.len += seg.records
+		s.bytes += seg.size
+	}
+	if len(s.segs) == 0 {
+		s.segs = append(s.segs, &segment{seq: curSeq, modTime: time.Now()})
+		s.rOff = 0
+	}
+	last := s.segs[len(s.segs)-1]
+	s.w, err = os.OpenFile(s.segmentPath(last.seq), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err == nil {
+		err = s.w.Truncate(last.size)
+	}
+	if err == nil {
+		err = s.writeCursor()
+	}
+	if err != nil {
+		s.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// scan returns the segment of the file, the valid records after off are counted.
+func scan(path string, seq uint64, off int64) (*segment, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	seg := &segment{seq: seq, modTime: fi.ModTime()}
+	var pos int64
+	for {
+		_, at, n, err := readRecord(f, pos, fi.Size())
+		if err != nil {
+			break
+		}
+		if pos >= off {
+			seg.records++
+		}
+		pos += n
+		seg.modTime = at
+	}
+	seg.size = pos
+	return seg, nil
+}
+
+// readRecord reads the record at the offset of the file of the size, it returns the size of the record.
+func readRecord(f *os.File, off int64, size int64) (data []byte, at time.Time, n int64, err error) {
+	var h [headerSize]byte
+	if _, err = f.ReadAt(h[:], off); err != nil {
+		return nil, at, 0, err
+	}
+	l := binary.BigEndian.Uint32(h[0:])
+	// the corrupted length must not allocate beyond the file.
+	if int64(l) > size-off-headerSize {
+		return nil, at, 0, io.ErrUnexpectedEOF
+	}
+	buf := make([]byte, 8+int(l))
+	copy(buf, h[8:])
+	if _, err = f.ReadAt(buf[8:], off+headerSize); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, at, 0, err
+	}
+	if crc32.ChecksumIEEE(buf) != binary.BigEndian.Uint32(h[4:]) {
+		return nil, at, 0, fmt.Errorf("spool: corrupted record at %d of %s", off, f.Name())
+	}
+	at = time.Unix(0, int64(binary.BigEndian.Uint64(h[8:])))
+	return buf[8:], at, headerSize + int64(l), nil
+}
+
+func (s *Spool) writeCursor() error {
+	var cur [16]byte
+	binary.BigEndian.PutUint64(cur[0:], s.segs[0].seq)
+	binary.BigEndian.PutUint64(cur[8:], uint64(s.rOff))
+	_, err := s.cursor.WriteAt(cur[:], 0)
+	return err
+}
+
+// roll starts a new segment.
+func (s *Spool) roll() error {
+	seq := s.segs[len(s.segs)-1].seq + 1
+	w, err := os.OpenFile(s.segmentPath(seq), os.O_WRONLY|os.O_CREATE|os.O_TRUNC|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	s.w.Close()
+	s.w = w
+	s.segs = append(s.segs, &segment{seq: seq, modTime: time.Now()})
+	return nil
+}
+
+// removeFirst removes the first segment, it must not be the last one.
+func (s *Spool) removeFirst() {
+	first := s.segs[0]
+	if s.r != nil {
+		s.r.Close()
+		s.r = nil
+	}
+	os.Remove(s.segmentPath(first.seq))
+	s.len -= first.records
+	s.bytes -= first.size
+	s.segs = s.segs[1:]
+	s.rOff = 0
+	s.writeCursor()
+}
+
+// expire removes the oldest segments beyond the limits, the unread records of them are dropped.
+func (s *Spool) expire(now time.Time) {
+	for {
+		first := s.segs[0]
+		overSize := s.opts.MaxBytes > 0 && s.bytes > s.opts.MaxBytes && len(s.segs) > 1
+		tooOld := s.opts.MaxAge > 0 && first.records > 0 && now.Sub(first.modTime) > s.opts.MaxAge
+		if !overSize && !tooOld {
+			return
+		}
+		if len(s.segs) == 1 {
+			if err := s.roll(); err != nil {
+				return
+			}
+		}
+		s.dropped += uint64(first.records)
+		s.removeFirst()
+	}
+}
+
+// Push appends the record.
+func (s *Spool) Push(data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrClosed
+	}
+	now := time.Now()
+	n := int64(headerSize + len(data))
+	if last := s.segs[len(s.segs)-1]; last.size > 0 && last.size+n > s.opts.SegmentSize {
+		if err := s.roll(); err != nil {
+			return err
+		}
+	}
+	last := s.segs[len(s.segs)-1]
+	buf := make([]byte, n)
+	binary.BigEndian.PutUint32(buf[0:], uint32(len(data)))
+	binary.BigEndian.PutUint64(buf[8:], uint64(now.UnixNano()))
+	copy(buf[headerSize:], data)
+	binary.BigEndian.PutUint32(buf[4:], crc32.ChecksumIEEE(buf[8:]))
+	_, err := s.w.Write(buf)
+	if err == nil && s.opts.Sync {
+		err = s.w.Sync()
+	}
+	if err != nil {
+		// discard the partially written record.
+		s.w.Truncate(last.size)
+		return err
+	}
+	last.size += n
+	last.records++
+	last.modTime = now
+	s.len++
+	s.bytes += n
+	s.expire(now)
+	return nil
+}
+
+// first returns the first segment with unread records, it must be called with records in the spool.
+func (s *Spool) first() *segment {
+	for s.segs[0].records == 0 {
+		s.removeFirst()
+	}
+	if s.r == nil {
+		if r, err := os.Open(s.segmentPath(s.segs[0].seq)); err == nil {
+			s.r = r
+		}
+	}
+	return s.segs[0]
+}
+
+// Peek returns the oldest record and the time it was pushed, ErrEmpty if the spool is empty.
+func (s *Spool) Peek() (data []byte, at time.Time, err error) {
+	r, err := s.PeekRecord()
+	if err != nil {
+		return nil, at, err
+	}
+	return r.Data, r.At, nil
+}
+
+// PeekRecord returns the oldest record, ErrEmpty if the spool is empty.
+// Unlike Peek and Pop, the record can be removed by Remove after it is processed,
+// which does not remove the next record if the record has been dropped by the limits in the meantime.
+func (s *Spool) PeekRecord() (*Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil, ErrClosed
+	}
+	s.expire(time.Now())
+	if s.len == 0 {
+		return nil, ErrEmpty
+	}
+	first := s.first()
+	if s.r == nil {
+		return nil, fmt.Errorf("spool: segment %d is not readable", first.seq)
+	}
+	data, at, _, err := readRecord(s.r, s.rOff, first.size)
+	if err != nil {
+		return nil, err
+	}
+	return &Record{Data: data, At: at, seq: first.seq, off: s.rOff}, nil
+}
+
+// Pop removes the oldest record, ErrEmpty if the spool is empty.
+func (s *Spool) Pop() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrClosed
+	}
+	return s.pop()
+}
+
+// Remove removes the record returned by PeekRecord if it is still the oldest record,
+// it does nothing if the record has been removed or dropped by the limits.
+func (s *Spool) Remove(r *Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrClosed
+	}
+	if s.len == 0 {
+		return nil
+	}
+	if first := s.first(); first.seq != r.seq || s.rOff != r.off {
+		return nil
+	}
+	return s.pop()
+}
+
+// pop removes the oldest record, it must be called with the lock held.
+func (s *Spool) pop() error {
+	if s.len == 0 {
+		return ErrEmpty
+	}
+	first := s.first()
+	if s.r == nil {
+		return fmt.Errorf("spool: segment %d is not readable", first.seq)
+	}
+	var h [4]byte
+	if _, err := s.r.ReadAt(h[:], s.rOff); err != nil {
+		return err
+	}
+	s.rOff += headerSize + int64(binary.BigEndian.Uint32(h[:]))
+	first.records--
+	s.len--
+	switch {
+	case first.records == 0 && len(s.segs) > 1:
+		s.removeFirst()
+	case s.len == 0:
+		// reuse the empty segment from the beginning.
+		if err := s.w.Truncate(0); err != nil {
+			return err
+		}
+		s.bytes -= first.size
+		first.size = 0
+		s.rOff = 0
+		return s.writeCursor()
+	default:
+		return s.writeCursor()
+	}
+	return nil
+}
+
+// Len returns the number of the records.
+func (s *Spool) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.len
+}
+
+// Bytes returns the total size of the segment files.
+func (s *Spool) Bytes() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.bytes
+}
+
+// Dropped returns the number of the records dropped by the limits since the spool is opened.
+func (s *Spool) Dropped() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.dropped
+}
+
+// Close closes the files, the records are kept in the directory.
+func (s *Spool) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	if s.r != nil {
+		s.r.Close()
+	}
+	if s.w != nil {
+		s.w.Close()
+	}
+	return s.cursor.Close()
+}
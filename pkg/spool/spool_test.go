@@ -0,0 +1,213 @@
+package spool
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "spool")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	return dir
+}
+
+func segments(t *testing.T, dir string) []string {
+	names, err := filepath.Glob(filepath.Join(dir, "*"+segmentExt))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	return names
+}
+
+func TestSpool_PushPop(t *testing.T) {
+	a := assert.New(t)
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	// each record is 17 bytes, a segment holds 3 records.
+	s, err := Open(dir, Options{SegmentSize: 60})
+	if !a.NoError(err) {
+		return
+	}
+	for i := 0; i < 10; i++ {
+		a.NoError(s.Push([]byte(strconv.Itoa(i))))
+	}
+	a.Equal(10, s.Len())
+	a.Len(segments(t, dir), 4)
+
+	for i := 0; i < 4; i++ {
+		data, at, err := s.Peek()
+		a.NoError(err)
+		a.Equal(strconv.Itoa(i), string(data))
+		a.WithinDuration(time.Now(), at, time.Second)
+		a.NoError(s.Pop())
+	}
+	// the read segment is removed.
+	a.Len(segments(t, dir), 3)
+	a.NoError(s.Close())
+
+	// the read position is kept across restarts.
+	s, err = Open(dir, Options{SegmentSize: 60})
+	if !a.NoError(err) {
+		return
+	}
+	a.Equal(6, s.Len())
+	for i := 4; i < 10; i++ {
+		data, _, err := s.Peek()
+		a.NoError(err)
+		a.Equal(strconv.Itoa(i), string(data))
+		a.NoError(s.Pop())
+	}
+	_, _, err = s.Peek()
+	a.Equal(ErrEmpty, err)
+	a.Equal(ErrEmpty, s.Pop())
+	a.EqualValues(0, s.Bytes())
+	a.Len(segments(t, dir), 1)
+	a.NoError(s.Close())
+	a.Equal(ErrClosed, s.Push([]byte("a")))
+}
+
+func TestSpool_IncompleteRecord(t *testing.T) {
+	a := assert.New(t)
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	s, err := Open(dir, Options{})
+	if !a.NoError(err) {
+		return
+	}
+	a.NoError(s.Push([]byte("a")))
+	a.NoError(s.Push([]byte("b")))
+	a.NoError(s.Close())
+
+	// simulates a crash in the middle of writing a record.
+	f, err := os.OpenFile(segments(t, dir)[0], os.O_WRONLY|os.O_APPEND, 0644)
+	if !a.NoError(err) {
+		return
+	}
+	f.Write([]byte{0, 0, 0, 10, 1, 2})
+	f.Close()
+
+	s, err = Open(dir, Options{})
+	if !a.NoError(err) {
+		return
+	}
+	defer s.Close()
+	a.Equal(2, s.Len())
+	a.NoError(s.Push([]byte("c")))
+	for _, v := range []string{"a", "b", "c"} {
+		data, _, err := s.Peek()
+		a.NoError(err)
+		a.Equal(v, string(data))
+		a.NoError(s.Pop())
+	}
+}
+
+func TestSpool_Limits(t *testing.T) {
+	a := assert.New(t)
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	s, err := Open(dir, Options{SegmentSize: 60, MaxBytes: 120})
+	if !a.NoError(err) {
+		return
+	}
+	for i := 0; i < 10; i++ {
+		a.NoError(s.Push([]byte(strconv.Itoa(i))))
+	}
+	// the oldest segments are dropped once the total size exceeds MaxBytes.
+	a.True(s.Bytes() <= 120)
+	a.EqualValues(10-s.Len(), s.Dropped())
+	data, _, err := s.Peek()
+	a.NoError(err)
+	a.Equal(strconv.Itoa(10-s.Len()), string(data))
+	a.NoError(s.Close())
+
+	dir2 := tempDir(t)
+	defer os.RemoveAll(dir2)
+	s, err = Open(dir2, Options{MaxAge: 50 * time.Millisecond})
+	if !a.NoError(err) {
+		return
+	}
+	defer s.Close()
+	a.NoError(s.Push([]byte("a")))
+	time.Sleep(100 * time.Millisecond)
+	// the records older than MaxAge are dropped.
+	_, _, err = s.Peek()
+	a.Equal(ErrEmpty, err)
+	a.EqualValues(1, s.Dropped())
+	a.NoError(s.Push([]byte("b")))
+	data, _, err = s.Peek()
+	a.NoError(err)
+	a.Equal("b", string(data))
+}
+
+func TestSpool_Remove(t *testing.T) {
+	a := assert.New(t)
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	s, err := Open(dir, Options{SegmentSize: 60, MaxBytes: 120, Sync: true})
+	if !a.NoError(err) {
+		return
+	}
+	defer s.Close()
+	a.NoError(s.Push([]byte("0")))
+	r, err := s.PeekRecord()
+	if !a.NoError(err) {
+		return
+	}
+	a.Equal("0", string(r.Data))
+	// the record being processed is dropped by the limits.
+	for i := 1; i < 10; i++ {
+		a.NoError(s.Push([]byte(strconv.Itoa(i))))
+	}
+	a.True(s.Dropped() > 0)
+	n := s.Len()
+	a.NoError(s.Remove(r))
+	a.Equal(n, s.Len())
+
+	r, err = s.PeekRecord()
+	if !a.NoError(err) {
+		return
+	}
+	a.NoError(s.Remove(r))
+	a.Equal(n-1, s.Len())
+	// removing the record twice does nothing.
+	a.NoError(s.Remove(r))
+	a.Equal(n-1, s.Len())
+}
+
+func TestSpool_CorruptedLength(t *testing.T) {
+	a := assert.New(t)
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	s, err := Open(dir, Options{})
+	if !a.NoError(err) {
+		return
+	}
+	a.NoError(s.Push([]byte("a")))
+	a.NoError(s.Close())
+
+	// the length of the appended record exceeds the file, it must not be allocated.
+	f, err := os.OpenFile(segments(t, dir)[0], os.O_WRONLY|os.O_APPEND, 0644)
+	if !a.NoError(err) {
+		return
+	}
+	f.Write([]byte{0xff, 0xff, 0xff, 0xff, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0})
+	f.Close()
+
+	s, err = Open(dir, Options{})
+	if !a.NoError(err) {
+		return
+	}
+	defer s.Close()
+	a.Equal(1, s.Len())
+	data, _, err := s.Peek()
+	a.NoError(err)
+	a.Equal("a", string(data))
+}
@@ -0,0 +1,146 @@
+// Package timerwheel provides a hashed timer wheel which schedules a large number of keyed timers
+// with a fixed tick precision, with O(1) adding and removing.
+package timerwheel
+
+import (
+	"sync"
+	"time"
+)
+
+type timer struct {
+	key string
+	// rounds is the number of the remaining revolutions before the timer fires.
+	rounds int
+	slot   int
+	fn     func()
+}
+
+// TimerWheel is a hashed timer wheel. Each timer is identified by a key,
+// adding a timer with an existing key replaces the old one.
+// The callbacks are called sequentially in the goroutine of the wheel, they must not block for long.
+type TimerWheel struct {
+	tick  time.Duration
+	mu    sync.Mutex
+	slots []map[string]*timer
+	// timers is the index of all timers, keyed by the timer key.
+	timers map[string]*timer
+	pos    int
+
+	stopOnce sync.Once
+	exit     chan struct{}
+	done     chan struct{}
+}
+
+// New returns a TimerWheel with the given tick duration and number of slots.
+// The tick is the precision of the timers, a timer fires at the first tick after its duration elapses.
+func New(tick time.Duration, slots int) *TimerWheel {
+	if tick <= 0 {
+		panic("timerwheel: non-positive tick")
+	}
+	if slots <= 0 {
+		panic("timerwheel: non-positive slots")
+	}
+	tw := &TimerWheel{
+		tick:   tick,
+		slots:  make([]map[string]*timer, slots),
+		timers: make(map[string]*timer),
+		exit:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	for i := range tw.slots {
+		tw.slots[i] = make(map[string]*timer)
+	}
+	return tw
+}
+
+// Start starts running the wheel in a new goroutine.
+func (tw *TimerWheel) Start() {
+	go tw.run()
+}
+
+// Stop stops the wheel and waits for the running callback to return. The pending timers will not fire.
+func (tw *TimerWheel) Stop() {
+	tw.stopOnce.Do(func() {
+		close(tw.exit)
+	})
+	<-tw.done
+}
+
+func (tw *TimerWheel) run() {
+	defer close(tw.done)
+	ticker := time.NewTicker(tw.tick)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-tw.exit:
+			return
+		case <-ticker.C:
+			for _, fn := range tw.advance() {
+				fn()
+			}
+		}
+	}
+}
+
+// advance moves the wheel forward one slot and returns the callbacks of the expired timers.
+func (tw *TimerWheel) advance() []func() {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	tw.pos = (tw.pos + 1) % len(tw.slots)
+	var fns []func()
+	for k, t := range tw.slots[tw.pos] {
+		if t.rounds > 0 {
+			t.rounds--
+			continue
+		}
+		delete(tw.slots[tw.pos], k)
+		delete(tw.timers, k)
+		fns = append(fns, t.fn)
+	}
+	return fns
+}
+
+// Add adds a timer which calls fn after d.
+// If a timer with the same key exists, it is replaced.
+func (tw *TimerWheel) Add(key string, d time.Duration, fn func()) {
+	// the timer fires at the first tick after d elapses, at least one tick.
+	ticks := int((d + tw.tick - 1) / tw.tick)
+	if ticks < 1 {
+		ticks = 1
+	}
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	tw.remove(key)
+	t := &timer{
+		key:    key,
+		rounds: (ticks - 1) / len(tw.slots),
+		slot:   (tw.pos + ticks) % len(tw.slots),
+		fn:     fn,
+	}
+	tw.slots[t.slot][key] = t
+	tw.timers[key] = t
+}
+
+func (tw *TimerWheel) remove(key string) bool {
+	t, ok := tw.timers[key]
+	if !ok {
+		return false
+	}
+	delete(tw.slots[t.slot], key)
+	delete(tw.timers, key)
+	return true
+}
+
+// Remove removes the timer of the key, and returns whether the timer existed.
+func (tw *TimerWheel) Remove(key string) bool {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	return tw.remove(key)
+}
+
+// Len returns the number of the pending timers.
+func (tw *TimerWheel) Len() int {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	return len(tw.timers)
+}
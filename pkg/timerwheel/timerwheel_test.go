@@ -0,0 +1,86 @@
+package timerwheel
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTimerWheel_Advance(t *testing.T) {
+	a := assert.New(t)
+	tw := New(time.Second, 4)
+	var fired []string
+	add := func(key string, d time.Duration) {
+		tw.Add(key, d, func() {
+			fired = append(fired, key)
+		})
+	}
+	add("0", 0)
+	add("1", time.Second)
+	add("2", 1500*time.Millisecond)
+	add("4", 4*time.Second)
+	add("9", 9*time.Second)
+	a.Equal(5, tw.Len())
+
+	expected := map[int][]string{
+		1: {"0", "1"},
+		2: {"2"},
+		4: {"4"},
+		9: {"9"},
+	}
+	for i := 1; i <= 10; i++ {
+		fired = nil
+		for _, fn := range tw.advance() {
+			fn()
+		}
+		a.ElementsMatch(expected[i], fired, "tick %d", i)
+	}
+	a.Equal(0, tw.Len())
+}
+
+func TestTimerWheel_ReplaceAndRemove(t *testing.T) {
+	a := assert.New(t)
+	tw := New(time.Second, 4)
+	var fired []string
+	tw.Add("a", time.Second, func() {
+		fired = append(fired, "old")
+	})
+	tw.Add("a", 2*time.Second, func() {
+		fired = append(fired, "new")
+	})
+	tw.Add("b", time.Second, func() {
+		fired = append(fired, "b")
+	})
+	a.Equal(2, tw.Len())
+	a.True(tw.Remove("b"))
+	a.False(tw.Remove("b"))
+
+	for i := 0; i < 3; i++ {
+		for _, fn := range tw.advance() {
+			fn()
+		}
+	}
+	a.Equal([]string{"new"}, fired)
+}
+
+func TestTimerWheel_StartStop(t *testing.T) {
+	a := assert.New(t)
+	tw := New(10*time.Millisecond, 8)
+	tw.Start()
+	var n int32
+	tw.Add("a", 20*time.Millisecond, func() {
+		atomic.AddInt32(&n, 1)
+	})
+	tw.Add("b", time.Hour, func() {
+		atomic.AddInt32(&n, 1)
+	})
+	a.Eventually(func() bool {
+		return atomic.LoadInt32(&n) == 1
+	}, time.Second, 5*time.Millisecond)
+	tw.Stop()
+	// stopping twice is safe
+	tw.Stop()
+	a.Equal(1, tw.Len())
+}
@@ -7,6 +7,7 @@ type HookWrapper struct {
 	OnSessionCreatedWrapper    OnSessionCreatedWrapper
 	OnSessionResumedWrapper    OnSessionResumedWrapper
 	OnSessionTerminatedWrapper OnSessionTerminatedWrapper
+	OnSessionExpiredWrapper    OnSessionExpiredWrapper
 	OnSubscribeWrapper         OnSubscribeWrapper
 	OnSubscribedWrapper        OnSubscribedWrapper
 	OnUnsubscribeWrapper       OnUnsubscribeWrapper
@@ -18,13 +19,29 @@ type HookWrapper struct {
 	OnCloseWrapper             OnCloseWrapper
 	OnAcceptWrapper            OnAcceptWrapper
 	OnStopWrapper              OnStopWrapper
+	OnCertIdentityWrapper      OnCertIdentityWrapper
+	OnRateLimitWrapper         OnRateLimitWrapper
+	OnOverloadWrapper          OnOverloadWrapper
+	OnBannedWrapper            OnBannedWrapper
+	OnUnbannedWrapper          OnUnbannedWrapper
+	OnTopicRewriteWrapper      OnTopicRewriteWrapper
+	OnSessionTakeoverWrapper   OnSessionTakeoverWrapper
+	OnSessionTakenOverWrapper  OnSessionTakenOverWrapper
+	OnDeliveredWrapper         OnDeliveredWrapper
+	OnSubscribeRewriteWrapper  OnSubscribeRewriteWrapper
+	OnWillPublishWrapper       OnWillPublishWrapper
+	OnWillPublishedWrapper     OnWillPublishedWrapper
+	OnDeliverRewriteWrapper    OnDeliverRewriteWrapper
+	OnCredentialExpiryWrapper  OnCredentialExpiryWrapper
 }
 
 // Plugable is the interface need to be implemented for every plugins.
 type Plugable interface {
 	// Load will be called in server.Run(). If return error, the server will panic.
+	// It is called again if the plugin is loaded by PluginService after it is unloaded.
 	Load(service Server) error
-	// Unload will be called when the server is shutdown, the return error is only for logging
+	// Unload will be called when the server is shutdown or the plugin is unloaded by PluginService,
+	// the return error is only for logging
 	Unload() error
 	// HookWrapper returns all hook wrappers that used by the plugin.
 	// Return a empty wrapper  if the plugin does not need any hooks
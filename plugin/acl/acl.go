@@ -0,0 +1,186 @@
+// Package acl authorizes the publish and subscribe requests by the ordered allow/deny rules,
+// the rules can be loaded from a JSON file or set by the API.
+package acl
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sync"
+
+	"go.uber.org/zap"
+
+	"github.com/DrmagicE/gmqtt"
+	"github.com/DrmagicE/gmqtt/pkg/packets"
+)
+
+const name = "acl"
+
+var log *zap.Logger
+
+// Option is the option of the ACL.
+type Option func(a *ACL)
+
+// WithFile sets the JSON file which the rules are loaded from on loading, see Reload.
+func WithFile(path string) Option {
+	return func(a *ACL) {
+		a.file = path
+	}
+}
+
+// WithRules sets the initial rules.
+func WithRules(rules ...Rule) Option {
+	return func(a *ACL) {
+		a.rules = rules
+	}
+}
+
+// WithNoMatch sets the permission when no rule matches, default to Deny.
+func WithNoMatch(permission Permission) Option {
+	return func(a *ACL) {
+		a.noMatch = permission
+	}
+}
+
+// file is the format of the rule file.
+type file struct {
+	Rules []Rule `json:"rules"`
+}
+
+// ACL is the plugin which authorizes the publish and subscribe requests.
+// The rules are evaluated in order, the first matched rule decides the permission.
+type ACL struct {
+	file    string
+	noMatch Permission
+
+	mu    sync.RWMutex
+	rules []Rule
+}
+
+// New returns the ACL plugin.
+func New(opts ...Option) *ACL {
+	a := &ACL{
+		noMatch: Deny,
+	}
+	for _, fn := range opts {
+		fn(a)
+	}
+	return a
+}
+
+func (a *ACL) Load(service gmqtt.Server) error {
+	log = gmqtt.Logger("plugin/" + name)
+	if a.file != "" {
+		return a.Reload()
+	}
+	return a.SetRules(a.rules)
+}
+
+func (a *ACL) Unload() error {
+	return nil
+}
+
+func (a *ACL) HookWrapper() gmqtt.HookWrapper {
+	return gmqtt.HookWrapper{
+		OnSubscribeWrapper:  a.OnSubscribeWrapper,
+		OnMsgArrivedWrapper: a.OnMsgArrivedWrapper,
+	}
+}
+
+func (a *ACL) Name() string {
+	return name
+}
+
+// Reload reloads the rules from the file.
+func (a *ACL) Reload() error {
+	b, err := ioutil.ReadFile(a.file)
+	if err != nil {
+		return err
+	}
+	var f file
+	if err := json.Unmarshal(b, &f); err != nil {
+		return err
+	}
+	return a.SetRules(f.Rules)
+}
+
+// SetRules validates and replaces the rules, the rules are not changed if any rule is invalid.
+func (a *ACL) SetRules(rules []Rule) error {
+	for i := range rules {
+		if err := rules[i].Validate(); err != nil {
+			return fmt.Errorf("rule %d: %s", i, err)
+		}
+	}
+	rs := make([]Rule, len(rules))
+	copy(rs, rules)
+	a.mu.Lock()
+	a.rules = rs
+	a.mu.Unlock()
+	return nil
+}
+
+// Rules returns the current rules.
+func (a *ACL) Rules() []Rule {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	rs := make([]Rule, len(a.rules))
+	copy(rs, a.rules)
+	return rs
+}
+
+// Authorize returns whether the client is allowed to publish to the topic name or subscribe to the topic filter,
+// and the maximum qos granted by the matched rule.
+func (a *ACL) Authorize(clientID, username string, action Action, topic string) (allowed bool, maxQos uint8) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	for i := range a.rules {
+		r := &a.rules[i]
+		if !r.matchClient(clientID, username, action) {
+			continue
+		}
+		for _, t := range r.Topics {
+			t, ok := expand(t, clientID, username)
+			if !ok || !r.matchTopic(t, topic, action) {
+				continue
+			}
+			if r.Permission == Deny {
+				return false, 0
+			}
+			if r.MaxQos != nil {
+				return true, *r.MaxQos
+			}
+			return true, packets.QOS_2
+		}
+	}
+	return a.noMatch == Allow, packets.QOS_2
+}
+
+// OnSubscribeWrapper rejects the denied subscriptions, the qos of the allowed subscriptions is capped by the rule.
+func (a *ACL) OnSubscribeWrapper(subscribe gmqtt.OnSubscribe) gmqtt.OnSubscribe {
+	return func(ctx context.Context, client gmqtt.Client, topic packets.Topic) (qos uint8) {
+		opts := client.OptionsReader()
+		allowed, maxQos := a.Authorize(opts.ClientID(), opts.Username(), Subscribe, topic.Name)
+		if !allowed {
+			log.Info("subscription denied", zap.String("client_id", opts.ClientID()), zap.String("topic", topic.Name))
+			return packets.SUBSCRIBE_FAILURE
+		}
+		if topic.Qos > maxQos {
+			topic.Qos = maxQos
+		}
+		return subscribe(ctx, client, topic)
+	}
+}
+
+// OnMsgArrivedWrapper drops the denied messages and the messages whose qos exceeds the cap of the rule.
+func (a *ACL) OnMsgArrivedWrapper(arrived gmqtt.OnMsgArrived) gmqtt.OnMsgArrived {
+	return func(ctx context.Context, client gmqtt.Client, msg packets.Message) (valid bool) {
+		opts := client.OptionsReader()
+		allowed, maxQos := a.Authorize(opts.ClientID(), opts.Username(), Publish, msg.Topic())
+		if !allowed || msg.Qos() > maxQos {
+			log.Info("publish denied", zap.String("client_id", opts.ClientID()), zap.String("topic", msg.Topic()), zap.Uint8("qos", msg.Qos()))
+			return false
+		}
+		return arrived(ctx, client, msg)
+	}
+}
@@ -0,0 +1,134 @@
+package acl
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/DrmagicE/gmqtt"
+	"github.com/DrmagicE/gmqtt/internal/testutil"
+	"github.com/DrmagicE/gmqtt/pkg/packets"
+)
+
+func qosPtr(qos uint8) *uint8 {
+	return &qos
+}
+
+func TestACL_Authorize(t *testing.T) {
+	a := assert.New(t)
+	acl := New(WithRules(
+		// the first matched rule decides the permission.
+		Rule{Permission: Deny, Action: All, Topics: []string{"private/#"}},
+		Rule{Permission: Allow, Action: All, Topics: []string{"private/admin/#"}, Username: "admin"},
+		Rule{Permission: Allow, Action: All, Topics: []string{"client/%c/#", "user/%u/#"}},
+		Rule{Permission: Allow, Action: Publish, Topics: []string{"upload/+"}, MaxQos: qosPtr(packets.QOS_1)},
+		Rule{Permission: Allow, Action: Subscribe, Topics: []string{"eq broadcast/#"}, ClientID: "id0"},
+		Rule{Permission: Deny, Action: Subscribe, Topics: []string{"news/secret"}},
+		Rule{Permission: Allow, Action: Subscribe, Topics: []string{"news/#"}, MaxQos: qosPtr(packets.QOS_0)},
+	))
+	if !a.NoError(acl.Load(nil)) {
+		return
+	}
+	var tt = []struct {
+		name               string
+		clientID, username string
+		action             Action
+		topic              string
+		allowed            bool
+		maxQos             uint8
+	}{
+		{name: "earlier deny wins", clientID: "id0", username: "admin", action: Publish, topic: "private/admin/a"},
+		{name: "client id placeholder", clientID: "id0", action: Publish, topic: "client/id0/a", allowed: true, maxQos: packets.QOS_2},
+		{name: "client id placeholder mismatch", clientID: "id0", action: Publish, topic: "client/id1/a"},
+		{name: "username placeholder", clientID: "id0", username: "user", action: Subscribe, topic: "user/user/+", allowed: true, maxQos: packets.QOS_2},
+		{name: "empty username placeholder", clientID: "id0", action: Subscribe, topic: "user//a"},
+		{name: "qos cap", clientID: "id0", action: Publish, topic: "upload/a", allowed: true, maxQos: packets.QOS_1},
+		{name: "action mismatch", clientID: "id0", action: Subscribe, topic: "upload/a"},
+		{name: "eq topic", clientID: "id0", action: Subscribe, topic: "broadcast/#", allowed: true, maxQos: packets.QOS_2},
+		{name: "eq topic mismatch", clientID: "id0", action: Subscribe, topic: "broadcast/a"},
+		{name: "eq topic other client", clientID: "id1", action: Subscribe, topic: "broadcast/#"},
+		{name: "deny overlapping subscription", clientID: "id0", action: Subscribe, topic: "news/+"},
+		{name: "allow covered subscription", clientID: "id0", action: Subscribe, topic: "news/sport/+", allowed: true, maxQos: packets.QOS_0},
+		{name: "deny by default", clientID: "id0", action: Publish, topic: "other"},
+	}
+	for _, v := range tt {
+		allowed, maxQos := acl.Authorize(v.clientID, v.username, v.action, v.topic)
+		a.Equal(v.allowed, allowed, v.name)
+		if v.allowed {
+			a.Equal(v.maxQos, maxQos, v.name)
+		}
+	}
+
+	acl = New(WithNoMatch(Allow))
+	allowed, maxQos := acl.Authorize("id0", "", Publish, "other")
+	a.True(allowed)
+	a.Equal(packets.QOS_2, maxQos)
+}
+
+func TestACL_Wrappers(t *testing.T) {
+	a := assert.New(t)
+	acl := New(WithRules(
+		Rule{Permission: Allow, Action: All, Topics: []string{"a/#"}, MaxQos: qosPtr(packets.QOS_1)},
+	))
+	if !a.NoError(acl.Load(nil)) {
+		return
+	}
+	c := testutil.NewClient("id0", "")
+
+	subscribe := acl.OnSubscribeWrapper(func(ctx context.Context, client gmqtt.Client, topic packets.Topic) uint8 {
+		return topic.Qos
+	})
+	a.Equal(packets.QOS_1, subscribe(context.Background(), c, packets.Topic{Name: "a/b", Qos: packets.QOS_2}))
+	a.Equal(packets.QOS_0, subscribe(context.Background(), c, packets.Topic{Name: "a/b", Qos: packets.QOS_0}))
+	a.EqualValues(packets.SUBSCRIBE_FAILURE, subscribe(context.Background(), c, packets.Topic{Name: "b", Qos: packets.QOS_0}))
+
+	arrived := acl.OnMsgArrivedWrapper(func(ctx context.Context, client gmqtt.Client, msg packets.Message) bool {
+		return true
+	})
+	a.True(arrived(context.Background(), c, gmqtt.NewMessage("a/b", nil, packets.QOS_1)))
+	// the messages exceeding the qos cap are dropped.
+	a.False(arrived(context.Background(), c, gmqtt.NewMessage("a/b", nil, packets.QOS_2)))
+	a.False(arrived(context.Background(), c, gmqtt.NewMessage("b", nil, packets.QOS_0)))
+}
+
+func TestACL_Reload(t *testing.T) {
+	a := assert.New(t)
+	dir, err := ioutil.TempDir("", "acl")
+	if !a.NoError(err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "acl.json")
+	write := func(content string) {
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(`{"rules":[{"permission":"allow","action":"publish","topics":["a"]}]}`)
+	acl := New(WithFile(path))
+	if !a.NoError(acl.Load(nil)) {
+		return
+	}
+	allowed, _ := acl.Authorize("id0", "", Publish, "a")
+	a.True(allowed)
+
+	write(`{"rules":[{"permission":"allow","action":"publish","topics":["b"]}]}`)
+	a.NoError(acl.Reload())
+	allowed, _ = acl.Authorize("id0", "", Publish, "a")
+	a.False(allowed)
+	allowed, _ = acl.Authorize("id0", "", Publish, "b")
+	a.True(allowed)
+
+	// the rules are kept if the file is invalid.
+	write(`{"rules":[{"permission":"allow","action":"publish","topics":[]}]}`)
+	a.Error(acl.Reload())
+	write(`{`)
+	a.Error(acl.Reload())
+	a.Len(acl.Rules(), 1)
+	allowed, _ = acl.Authorize("id0", "", Publish, "b")
+	a.True(allowed)
+}
@@ -0,0 +1,175 @@
+package acl
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/DrmagicE/gmqtt/pkg/packets"
+)
+
+// Permission is the permission of the rule.
+type Permission string
+
+const (
+	Allow Permission = "allow"
+	Deny  Permission = "deny"
+)
+
+// Action is the action which the rule applies to.
+type Action string
+
+const (
+	Publish   Action = "publish"
+	Subscribe Action = "subscribe"
+	// All applies to both publish and subscribe.
+	All Action = "all"
+)
+
+const (
+	placeholderClientID = "%c"
+	placeholderUsername = "%u"
+	// eqPrefix indicates the topic filter of the subscription must be equal to the rule topic literally,
+	// the wildcards in the rule topic are not applied.
+	eqPrefix = "eq "
+)
+
+// Rule is the ACL rule.
+type Rule struct {
+	Permission Permission `json:"permission"`
+	Action     Action     `json:"action"`
+	// ClientID matches the client id of the client, empty matches all clients.
+	ClientID string `json:"client_id,omitempty"`
+	// Username matches the username of the client, empty matches all clients.
+	Username string `json:"username,omitempty"`
+	// Topics is the topic filters of the rule, which can contain the placeholders %c (client id) and %u (username).
+	// The topic with the "eq " prefix matches the subscription with the equal topic filter only.
+	Topics []string `json:"topics"`
+	// MaxQos caps the qos of the allowed subscriptions and messages, nil means no cap.
+	MaxQos *uint8 `json:"max_qos,omitempty"`
+}
+
+// Validate returns the error if the rule is invalid.
+func (r *Rule) Validate() error {
+	if r.Permission != Allow && r.Permission != Deny {
+		return fmt.Errorf("invalid permission: %q", r.Permission)
+	}
+	if r.Action != Publish && r.Action != Subscribe && r.Action != All {
+		return fmt.Errorf("invalid action: %q", r.Action)
+	}
+	if len(r.Topics) == 0 {
+		return errors.New("empty topics")
+	}
+	for _, t := range r.Topics {
+		if !packets.ValidTopicFilter([]byte(strings.TrimPrefix(t, eqPrefix))) {
+			return fmt.Errorf("invalid topic: %q", t)
+		}
+	}
+	if r.MaxQos != nil && *r.MaxQos > packets.QOS_2 {
+		return fmt.Errorf("invalid max_qos: %d", *r.MaxQos)
+	}
+	return nil
+}
+
+// matchClient returns whether the rule applies to the client.
+func (r *Rule) matchClient(clientID, username string, action Action) bool {
+	if r.Action != All && r.Action != action {
+		return false
+	}
+	if r.ClientID != "" && r.ClientID != clientID {
+		return false
+	}
+	if r.Username != "" && r.Username != username {
+		return false
+	}
+	return true
+}
+
+// expand replaces the placeholders in the topic, ok is false if the value of the placeholder is empty
+// or contains the separator or wildcards, in which case the topic never matches.
+func expand(topic, clientID, username string) (string, bool) {
+	for _, v := range []struct{ placeholder, value string }{
+		{placeholderClientID, clientID},
+		{placeholderUsername, username},
+	} {
+		if !strings.Contains(topic, v.placeholder) {
+			continue
+		}
+		if v.value == "" || strings.ContainsAny(v.value, "/+#") {
+			return "", false
+		}
+		topic = strings.Replace(topic, v.placeholder, v.value, -1)
+	}
+	return topic, true
+}
+
+// matchTopic returns whether the rule topic matches the topic name of the publish or the topic filter of the subscription.
+// For the subscription, the allow rule matches if all topics matched by the subscription are matched by the rule,
+// and the deny rule matches if any topic matched by the subscription is matched by the rule.
+func (r *Rule) matchTopic(ruleTopic, topic string, action Action) bool {
+	if strings.HasPrefix(ruleTopic, eqPrefix) {
+		return action == Subscribe && strings.TrimPrefix(ruleTopic, eqPrefix) == topic
+	}
+	if action == Publish {
+		return packets.TopicMatch([]byte(topic), []byte(ruleTopic))
+	}
+	if r.Permission == Allow {
+		return covers(ruleTopic, topic)
+	}
+	return overlaps(ruleTopic, topic)
+}
+
+func sysMismatch(a, b string) bool {
+	return strings.HasPrefix(a, "$") != strings.HasPrefix(b, "$")
+}
+
+// covers returns whether all topics matched by the filter are matched by the rule filter.
+func covers(rule, filter string) bool {
+	if sysMismatch(rule, filter) {
+		return false
+	}
+	rl, fl := strings.Split(rule, "/"), strings.Split(filter, "/")
+	for i, l := range rl {
+		if l == "#" {
+			return true
+		}
+		if i >= len(fl) {
+			return false
+		}
+		switch {
+		case fl[i] == "#":
+			return false
+		case l == "+":
+		case l != fl[i]:
+			return false
+		}
+	}
+	return len(rl) == len(fl)
+}
+
+// overlaps returns whether any topic is matched by both filters.
+func overlaps(a, b string) bool {
+	if sysMismatch(a, b) {
+		return false
+	}
+	al, bl := strings.Split(a, "/"), strings.Split(b, "/")
+	for i := 0; i < len(al) && i < len(bl); i++ {
+		if al[i] == "#" || bl[i] == "#" {
+			return true
+		}
+		if al[i] != "+" && bl[i] != "+" && al[i] != bl[i] {
+			return false
+		}
+	}
+	if len(al) == len(bl) {
+		return true
+	}
+	// "a/#" matches "a" as well.
+	if len(al) == len(bl)+1 {
+		return al[len(al)-1] == "#"
+	}
+	if len(bl) == len(al)+1 {
+		return bl[len(bl)-1] == "#"
+	}
+	return false
+}
@@ -0,0 +1,102 @@
+package acl
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRule_Validate(t *testing.T) {
+	a := assert.New(t)
+	qos := uint8(3)
+	var tt = []struct {
+		rule Rule
+		ok   bool
+	}{
+		{rule: Rule{Permission: Allow, Action: All, Topics: []string{"a/#"}}, ok: true},
+		{rule: Rule{Permission: Deny, Action: Publish, Topics: []string{"eq a/+"}}, ok: true},
+		{rule: Rule{Permission: "grant", Action: All, Topics: []string{"a"}}},
+		{rule: Rule{Permission: Allow, Action: "read", Topics: []string{"a"}}},
+		{rule: Rule{Permission: Allow, Action: All}},
+		{rule: Rule{Permission: Allow, Action: All, Topics: []string{"a/#/b"}}},
+		{rule: Rule{Permission: Allow, Action: All, Topics: []string{"a"}, MaxQos: &qos}},
+	}
+	for _, v := range tt {
+		err := v.rule.Validate()
+		if v.ok {
+			a.NoError(err, "%+v", v.rule)
+		} else {
+			a.Error(err, "%+v", v.rule)
+		}
+	}
+}
+
+func TestExpand(t *testing.T) {
+	a := assert.New(t)
+	var tt = []struct {
+		topic, clientID, username string
+		expected                  string
+		ok                        bool
+	}{
+		{topic: "a/%c/%u", clientID: "id0", username: "user", expected: "a/id0/user", ok: true},
+		{topic: "%c/%c", clientID: "id0", expected: "id0/id0", ok: true},
+		{topic: "a/b", expected: "a/b", ok: true},
+		// the placeholders never match if the values are empty or contain the separator or wildcards.
+		{topic: "a/%u", clientID: "id0"},
+		{topic: "a/%c", clientID: "id/0"},
+		{topic: "a/%c", clientID: "#"},
+		{topic: "a/%u", username: "+"},
+	}
+	for _, v := range tt {
+		topic, ok := expand(v.topic, v.clientID, v.username)
+		a.Equal(v.ok, ok, v.topic)
+		if v.ok {
+			a.Equal(v.expected, topic)
+		}
+	}
+}
+
+func TestCovers(t *testing.T) {
+	a := assert.New(t)
+	var tt = []struct {
+		rule, filter string
+		expected     bool
+	}{
+		{"a/#", "a/b/c", true},
+		{"a/#", "a/+", true},
+		{"a/#", "a/#", true},
+		{"a/+", "a/b", true},
+		{"a/+", "a/+", true},
+		{"a/+", "a/#", false},
+		{"a/+", "a/b/c", false},
+		{"a/b", "a/+", false},
+		{"a/b", "a/b", true},
+		{"a/b", "a", false},
+		{"#", "$SYS/a", false},
+		{"$SYS/#", "$SYS/a", true},
+	}
+	for _, v := range tt {
+		a.Equal(v.expected, covers(v.rule, v.filter), "%s %s", v.rule, v.filter)
+	}
+}
+
+func TestOverlaps(t *testing.T) {
+	a := assert.New(t)
+	var tt = []struct {
+		a, b     string
+		expected bool
+	}{
+		{"a/b", "a/+", true},
+		{"a/+", "+/b", true},
+		{"a/b", "a/c", false},
+		{"a/#", "a", true},
+		{"a", "a/#", true},
+		{"a/b", "a/b/c", false},
+		{"#", "a/b/c", true},
+		{"#", "$SYS/a", false},
+		{"+/+", "a/b/c", false},
+	}
+	for _, v := range tt {
+		a.Equal(v.expected, overlaps(v.a, v.b), "%s %s", v.a, v.b)
+	}
+}
@@ -0,0 +1,687 @@
+// Package admin provides the gRPC admin api of the broker, see admin.proto.
+// Besides the management operations, it streams the client and subscription events,
+// so that external control planes can mirror the broker state.
+package admin
+
+//go:generate protoc --go_out=plugins=grpc,paths=source_relative:. admin.proto
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/DrmagicE/gmqtt"
+	"github.com/DrmagicE/gmqtt/pkg/packets"
+	"github.com/DrmagicE/gmqtt/subscription/notify"
+)
+
+var _ AdminServer = (*Admin)(nil)
+
+const name = "admin"
+
+// watchBufferSize is the number of the events buffered for each watcher,
+// the events are dropped for the watcher which falls behind.
+const watchBufferSize = 1024
+
+const (
+	defaultPage     = 1
+	defaultPageSize = 20
+)
+
+var log *zap.Logger
+
+// Admin is the plugin which serves the gRPC admin api.
+type Admin struct {
+	addr       string
+	opts       []grpc.ServerOption
+	grpcServer *grpc.Server
+	server     gmqtt.Server
+	// notified is true if the subscription events are received from the notify.NotifyingStore,
+	// otherwise the events are derived from the subscription hooks.
+	notified bool
+
+	clientMu sync.Mutex
+	clients  map[string]gmqtt.Client
+
+	watchMu       sync.Mutex
+	clientWatches map[chan *ClientEvent]struct{}
+	subWatches    map[chan *SubscriptionEvent]struct{}
+}
+
+// New returns the Admin plugin which listens on addr, the opts are passed to grpc.NewServer.
+func New(addr string, opts ...grpc.ServerOption) *Admin {
+	return &Admin{
+		addr:          addr,
+		opts:          opts,
+		clients:       make(map[string]gmqtt.Client),
+		clientWatches: make(map[chan *ClientEvent]struct{}),
+		subWatches:    make(map[chan *SubscriptionEvent]struct{}),
+	}
+}
+
+func (a *Admin) Load(service gmqtt.Server) error {
+	log = gmqtt.Logger("plugin/" + name)
+	a.server = service
+	if store, ok := service.SubscriptionStore().(*notify.NotifyingStore); ok {
+		a.notified = true
+		store.AddListener(a.onSubscriptionChanged)
+	}
+	ln, err := gmqtt.Listen(a.addr)
+	if err != nil {
+		return err
+	}
+	a.grpcServer = grpc.NewServer(a.opts...)
+	RegisterAdminServer(a.grpcServer, a)
+	go func() {
+		if err := a.grpcServer.Serve(ln); err != nil {
+			log.Error("grpc server error", zap.Error(err))
+		}
+	}()
+	return nil
+}
+
+func (a *Admin) Unload() error {
+	a.grpcServer.Stop()
+	return nil
+}
+
+func (a *Admin) HookWrapper() gmqtt.HookWrapper {
+	return gmqtt.HookWrapper{
+		OnConnectedWrapper:         a.OnConnectedWrapper,
+		OnCloseWrapper:             a.OnCloseWrapper,
+		OnSessionCreatedWrapper:    a.OnSessionCreatedWrapper,
+		OnSessionResumedWrapper:    a.OnSessionResumedWrapper,
+		OnSessionTerminatedWrapper: a.OnSessionTerminatedWrapper,
+		OnSubscribedWrapper:        a.OnSubscribedWrapper,
+		OnUnsubscribedWrapper:      a.OnUnsubscribedWrapper,
+	}
+}
+
+func (a *Admin) Name() string {
+	return name
+}
+
+// OnConnectedWrapper emits the CONNECTED event.
+func (a *Admin) OnConnectedWrapper(connected gmqtt.OnConnected) gmqtt.OnConnected {
+	return func(ctx context.Context, client gmqtt.Client) {
+		a.emitClientEvent(ClientEvent_CONNECTED, client)
+		connected(ctx, client)
+	}
+}
+
+// OnCloseWrapper emits the DISCONNECTED event.
+func (a *Admin) OnCloseWrapper(close gmqtt.OnClose) gmqtt.OnClose {
+	return func(ctx context.Context, client gmqtt.Client, err error) {
+		a.emitClientEvent(ClientEvent_DISCONNECTED, client)
+		close(ctx, client, err)
+	}
+}
+
+// OnSessionCreatedWrapper stores the client when session created.
+func (a *Admin) OnSessionCreatedWrapper(created gmqtt.OnSessionCreated) gmqtt.OnSessionCreated {
+	return func(ctx context.Context, client gmqtt.Client) {
+		a.addClient(client)
+		created(ctx, client)
+	}
+}
+
+// OnSessionResumedWrapper refreshes the client when session resumed.
+func (a *Admin) OnSessionResumedWrapper(resumed gmqtt.OnSessionResumed) gmqtt.OnSessionResumed {
+	return func(ctx context.Context, client gmqtt.Client) {
+		a.addClient(client)
+		resumed(ctx, client)
+	}
+}
+
+// OnSessionTerminatedWrapper removes the client and emits the SESSION_TERMINATED event.
+func (a *Admin) OnSessionTerminatedWrapper(terminated gmqtt.OnSessionTerminated) gmqtt.OnSessionTerminated {
+	return func(ctx context.Context, client gmqtt.Client, reason gmqtt.SessionTerminatedReason) {
+		a.deleteClient(client)
+		a.emitClientEvent(ClientEvent_SESSION_TERMINATED, client)
+		terminated(ctx, client, reason)
+	}
+}
+
+// OnSubscribedWrapper emits the SUBSCRIBED event unless the events are received from the notify.NotifyingStore.
+func (a *Admin) OnSubscribedWrapper(subscribed gmqtt.OnSubscribed) gmqtt.OnSubscribed {
+	return func(ctx context.Context, client gmqtt.Client, topic packets.Topic) {
+		if !a.notified {
+			a.emitSubscriptionEvent(&SubscriptionEvent{
+				Type:         SubscriptionEvent_SUBSCRIBED,
+				ClientId:     client.OptionsReader().ClientID(),
+				Subscription: &Subscription{TopicFilter: topic.Name, Qos: uint32(topic.Qos)},
+			})
+		}
+		subscribed(ctx, client, topic)
+	}
+}
+
+// OnUnsubscribedWrapper emits the UNSUBSCRIBED event unless the events are received from the notify.NotifyingStore.
+func (a *Admin) OnUnsubscribedWrapper(unsubscribed gmqtt.OnUnsubscribed) gmqtt.OnUnsubscribed {
+	return func(ctx context.Context, client gmqtt.Client, topicName string) {
+		if !a.notified {
+			a.emitSubscriptionEvent(&SubscriptionEvent{
+				Type:         SubscriptionEvent_UNSUBSCRIBED,
+				ClientId:     client.OptionsReader().ClientID(),
+				Subscription: &Subscription{TopicFilter: topicName},
+			})
+		}
+		unsubscribed(ctx, client, topicName)
+	}
+}
+
+// onSubscriptionChanged is the notify.Listener which emits the subscription events,
+// including the changes made by the admin api which do not trigger the hooks.
+func (a *Admin) onSubscriptionChanged(event notify.Event) {
+	switch e := event.(type) {
+	case *notify.SubscribeEvent:
+		a.emitSubscriptionEvent(&SubscriptionEvent{
+			Type:         SubscriptionEvent_SUBSCRIBED,
+			ClientId:     e.ClientID,
+			Subscription: &Subscription{TopicFilter: e.Topic.Name, Qos: uint32(e.Topic.Qos)},
+		})
+	case *notify.UnsubscribeEvent:
+		a.emitSubscriptionEvent(&SubscriptionEvent{
+			Type:         SubscriptionEvent_UNSUBSCRIBED,
+			ClientId:     e.ClientID,
+			Subscription: &Subscription{TopicFilter: e.TopicFilter},
+		})
+	}
+}
+
+func (a *Admin) addClient(client gmqtt.Client) {
+	a.clientMu.Lock()
+	defer a.clientMu.Unlock()
+	a.clients[client.OptionsReader().ClientID()] = client
+}
+
+func (a *Admin) deleteClient(client gmqtt.Client) {
+	a.clientMu.Lock()
+	defer a.clientMu.Unlock()
+	id := client.OptionsReader().ClientID()
+	if a.clients[id] == client {
+		delete(a.clients, id)
+	}
+}
+
+func (a *Admin) emitClientEvent(typ ClientEvent_Type, client gmqtt.Client) {
+	event := &ClientEvent{Type: typ, Client: a.newClient(client)}
+	a.watchMu.Lock()
+	defer a.watchMu.Unlock()
+	for ch := range a.clientWatches {
+		select {
+		case ch <- event:
+		default:
+			log.Warn("client event dropped, the watcher falls behind", zap.String("client_id", event.Client.ClientId))
+		}
+	}
+}
+
+func (a *Admin) emitSubscriptionEvent(event *SubscriptionEvent) {
+	a.watchMu.Lock()
+	defer a.watchMu.Unlock()
+	for ch := range a.subWatches {
+		select {
+		case ch <- event:
+		default:
+			log.Warn("subscription event dropped, the watcher falls behind", zap.String("client_id", event.ClientId))
+		}
+	}
+}
+
+func (a *Admin) newClient(client gmqtt.Client) *Client {
+	opts := client.OptionsReader()
+	clientStats := client.GetClientStats()
+	stats := clientStats.SessionStats
+	subStats, _ := a.server.SubscriptionStore().GetClientStats(opts.ClientID())
+	rs := &Client{
+		ClientId:        opts.ClientID(),
+		Username:        opts.Username(),
+		KeepAlive:       uint32(opts.KeepAlive()),
+		CleanSession:    opts.CleanSession(),
+		Connected:       client.IsConnected(),
+		ConnectedAt:     client.ConnectedAt().Unix(),
+		DisconnectedAt:  client.DisconnectedAt().Unix(),
+		InflightLen:     stats.InflightCurrent,
+		AwaitRelLen:     stats.AwaitRelCurrent,
+		MsgQueueLen:     stats.MessageStats.QueuedCurrent,
+		Subscriptions:   subStats.SubscriptionsCurrent,
+		BytesReceived:   clientStats.BytesReceived,
+		BytesSent:       clientStats.BytesSent,
+		PacketsReceived: packetCounts(clientStats.PacketStats.ReceivedTotal),
+		PacketsSent:     packetCounts(clientStats.PacketStats.SentTotal),
+	}
+	if !clientStats.LastSeen.IsZero() {
+		rs.LastSeenAt = clientStats.LastSeen.Unix()
+	}
+	if addr := opts.RemoteAddr(); addr != nil {
+		rs.RemoteAddr = addr.String()
+	}
+	if addr := opts.LocalAddr(); addr != nil {
+		rs.LocalAddr = addr.String()
+	}
+	return rs
+}
+
+// packetCounts returns the non-zero counts of the packet types, key by the packet type.
+func packetCounts(c *gmqtt.PacketCount) map[string]uint64 {
+	rs := make(map[string]uint64)
+	for k, v := range map[string]uint64{
+		"CONNECT":     c.Connect,
+		"CONNACK":     c.Connack,
+		"PUBLISH":     c.Publish,
+		"PUBACK":      c.Puback,
+		"PUBREC":      c.Pubrec,
+		"PUBREL":      c.Pubrel,
+		"PUBCOMP":     c.Pubcomp,
+		"SUBSCRIBE":   c.Subscribe,
+		"SUBACK":      c.Suback,
+		"UNSUBSCRIBE": c.Unsubscribe,
+		"UNSUBACK":    c.Unsuback,
+		"PINGREQ":     c.Pingreq,
+		"PINGRESP":    c.Pingresp,
+		"DISCONNECT":  c.Disconnect,
+	} {
+		if v != 0 {
+			rs[k] = v
+		}
+	}
+	return rs
+}
+
+// pageRange returns the range of the page in the list of the given length.
+func pageRange(pager *Pager, length int) (start, end int) {
+	page, pageSize := defaultPage, defaultPageSize
+	if pager != nil {
+		if pager.Page > 0 {
+			page = int(pager.Page)
+		}
+		if pager.PageSize > 0 {
+			pageSize = int(pager.PageSize)
+		}
+	}
+	start = (page - 1) * pageSize
+	if start > length {
+		start = length
+	}
+	end = start + pageSize
+	if end > length {
+		end = length
+	}
+	return start, end
+}
+
+func (a *Admin) ListClients(ctx context.Context, req *ListClientsRequest) (*ListClientsResponse, error) {
+	a.clientMu.Lock()
+	clients := make([]gmqtt.Client, 0, len(a.clients))
+	for _, c := range a.clients {
+		clients = append(clients, c)
+	}
+	a.clientMu.Unlock()
+	sort.Slice(clients, func(i, j int) bool {
+		return clients[i].OptionsReader().ClientID() < clients[j].OptionsReader().ClientID()
+	})
+	start, end := pageRange(req.Pager, len(clients))
+	rs := &ListClientsResponse{Total: uint32(len(clients))}
+	for _, c := range clients[start:end] {
+		rs.Clients = append(rs.Clients, a.newClient(c))
+	}
+	return rs, nil
+}
+
+func (a *Admin) GetClient(ctx context.Context, req *GetClientRequest) (*Client, error) {
+	a.clientMu.Lock()
+	client, ok := a.clients[req.ClientId]
+	a.clientMu.Unlock()
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "client %s not found", req.ClientId)
+	}
+	return a.newClient(client), nil
+}
+
+func (a *Admin) CloseClient(ctx context.Context, req *CloseClientRequest) (*Empty, error) {
+	clients := a.server.ClientService()
+	if clients.Get(req.ClientId) == nil {
+		return nil, status.Errorf(codes.NotFound, "client %s not found", req.ClientId)
+	}
+	clients.Kick(req.ClientId, "closed by the admin api")
+	return &Empty{}, nil
+}
+
+func (a *Admin) ListSubscriptions(ctx context.Context, req *ListSubscriptionsRequest) (*ListSubscriptionsResponse, error) {
+	if req.ClientId == "" {
+		return nil, status.Error(codes.InvalidArgument, "invalid client id")
+	}
+	topics := a.server.SubscriptionStore().GetClientSubscriptions(req.ClientId)
+	sort.Slice(topics, func(i, j int) bool {
+		return topics[i].Name < topics[j].Name
+	})
+	start, end := pageRange(req.Pager, len(topics))
+	rs := &ListSubscriptionsResponse{Total: uint32(len(topics))}
+	for _, t := range topics[start:end] {
+		rs.Subscriptions = append(rs.Subscriptions, &Subscription{TopicFilter: t.Name, Qos: uint32(t.Qos)})
+	}
+	return rs, nil
+}
+
+func (a *Admin) Subscribe(ctx context.Context, req *SubscribeRequest) (*Empty, error) {
+	if req.ClientId == "" {
+		return nil, status.Error(codes.InvalidArgument, "invalid client id")
+	}
+	topics := make([]packets.Topic, 0, len(req.Subscriptions))
+	for _, v := range req.Subscriptions {
+		if v.Qos > uint32(packets.QOS_2) {
+			return nil, status.Error(codes.InvalidArgument, packets.ErrInvalQos.Error())
+		}
+		if !packets.ValidTopicFilter([]byte(v.TopicFilter)) {
+			return nil, status.Error(codes.InvalidArgument, packets.ErrInvalTopicFilter.Error())
+		}
+		topics = append(topics, packets.Topic{Name: v.TopicFilter, Qos: uint8(v.Qos)})
+	}
+	for _, v := range a.server.SubscriptionStore().Subscribe(req.ClientId, topics...) {
+		if v.Err != nil {
+			return nil, status.Error(codes.FailedPrecondition, v.Err.Error())
+		}
+	}
+	return &Empty{}, nil
+}
+
+func (a *Admin) Unsubscribe(ctx context.Context, req *UnsubscribeRequest) (*Empty, error) {
+	if req.ClientId == "" {
+		return nil, status.Error(codes.InvalidArgument, "invalid client id")
+	}
+	for _, v := range req.TopicFilters {
+		if !packets.ValidTopicFilter([]byte(v)) {
+			return nil, status.Error(codes.InvalidArgument, packets.ErrInvalTopicFilter.Error())
+		}
+	}
+	a.server.SubscriptionStore().Unsubscribe(req.ClientId, req.TopicFilters...)
+	return &Empty{}, nil
+}
+
+func (a *Admin) GetSubscriptionStats(ctx context.Context, req *GetSubscriptionStatsRequest) (*SubscriptionStats, error) {
+	store := a.server.SubscriptionStore()
+	stats := store.GetStats()
+	if req.ClientId != "" {
+		var err error
+		if stats, err = store.GetClientStats(req.ClientId); err != nil {
+			return nil, status.Error(codes.NotFound, err.Error())
+		}
+	}
+	return &SubscriptionStats{
+		SubscriptionsTotal:   stats.SubscriptionsTotal,
+		SubscriptionsCurrent: stats.SubscriptionsCurrent,
+	}, nil
+}
+
+func (a *Admin) Publish(ctx context.Context, req *PublishRequest) (*Empty, error) {
+	if req.Qos > uint32(packets.QOS_2) {
+		return nil, status.Error(codes.InvalidArgument, packets.ErrInvalQos.Error())
+	}
+	if !packets.ValidTopicName([]byte(req.TopicName)) {
+		return nil, status.Error(codes.InvalidArgument, packets.ErrInvalTopicName.Error())
+	}
+	msg := gmqtt.NewMessage(req.TopicName, req.Payload, uint8(req.Qos), gmqtt.Retained(req.Retained))
+	if req.ClientId != "" {
+		a.server.PublishService().PublishToClient(req.ClientId, msg, true)
+	} else {
+		a.server.PublishService().Publish(msg)
+	}
+	return &Empty{}, nil
+}
+
+func (a *Admin) ListRetained(ctx context.Context, req *ListRetainedRequest) (*ListRetainedResponse, error) {
+	var msgs []packets.Message
+	if req.TopicFilter != "" {
+		if !packets.ValidTopicFilter([]byte(req.TopicFilter)) {
+			return nil, status.Error(codes.InvalidArgument, packets.ErrInvalTopicFilter.Error())
+		}
+		msgs = a.server.RetainedStore().GetMatchedMessages(req.TopicFilter)
+	} else {
+		a.server.RetainedStore().Iterate(func(message packets.Message) bool {
+			msgs = append(msgs, message)
+			return true
+		})
+	}
+	sort.Slice(msgs, func(i, j int) bool {
+		return msgs[i].Topic() < msgs[j].Topic()
+	})
+	start, end := pageRange(req.Pager, len(msgs))
+	rs := &ListRetainedResponse{Total: uint32(len(msgs))}
+	for _, m := range msgs[start:end] {
+		rs.Messages = append(rs.Messages, &RetainedMessage{TopicName: m.Topic(), Payload: m.Payload(), Qos: uint32(m.Qos())})
+	}
+	return rs, nil
+}
+
+// banKind returns the gmqtt.BanKind of the kind, the values of Ban_Kind are the same as gmqtt.BanKind.
+func banKind(kind Ban_Kind) (gmqtt.BanKind, error) {
+	if _, ok := Ban_Kind_name[int32(kind)]; !ok {
+		return 0, status.Error(codes.InvalidArgument, "invalid kind")
+	}
+	return gmqtt.BanKind(kind), nil
+}
+
+func (a *Admin) ListBans(ctx context.Context, req *ListBansRequest) (*ListBansResponse, error) {
+	bans := a.server.BanService().Bans()
+	start, end := pageRange(req.Pager, len(bans))
+	rs := &ListBansResponse{Total: uint32(len(bans))}
+	for _, b := range bans[start:end] {
+		ban := &Ban{
+			Kind:     Ban_Kind(b.Kind),
+			Value:    b.Value,
+			At:       b.At.Unix(),
+			Flapping: b.Flapping,
+		}
+		if !b.Until.IsZero() {
+			ban.Until = b.Until.Unix()
+		}
+		rs.Bans = append(rs.Bans, ban)
+	}
+	return rs, nil
+}
+
+func (a *Admin) Ban(ctx context.Context, req *BanRequest) (*Empty, error) {
+	kind, err := banKind(req.Kind)
+	if err != nil {
+		return nil, err
+	}
+	err = a.server.BanService().Ban(kind, req.Value, time.Duration(req.Duration)*time.Second)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	return &Empty{}, nil
+}
+
+func (a *Admin) Unban(ctx context.Context, req *UnbanRequest) (*Empty, error) {
+	kind, err := banKind(req.Kind)
+	if err != nil {
+		return nil, err
+	}
+	if !a.server.BanService().Unban(kind, req.Value) {
+		return nil, status.Errorf(codes.NotFound, "ban %s not found", req.Value)
+	}
+	return &Empty{}, nil
+}
+
+func (a *Admin) SetLogLevel(ctx context.Context, req *SetLogLevelRequest) (*Empty, error) {
+	if req.Clear {
+		if req.Module == "" {
+			return nil, status.Error(codes.InvalidArgument, "module is required")
+		}
+		a.server.ResetModuleLogLevel(req.Module)
+		return &Empty{}, nil
+	}
+	var level zapcore.Level
+	if err := level.UnmarshalText([]byte(req.Level)); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid level: %q", req.Level)
+	}
+	if req.Module != "" {
+		a.server.SetModuleLogLevel(req.Module, level)
+		return &Empty{}, nil
+	}
+	if err := a.server.SetLogLevel(level); err != nil {
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+	return &Empty{}, nil
+}
+
+func (a *Admin) ListLogLevels(ctx context.Context, req *ListLogLevelsRequest) (*ListLogLevelsResponse, error) {
+	rs := &ListLogLevelsResponse{}
+	for module, level := range a.server.ModuleLogLevels() {
+		rs.Levels = append(rs.Levels, &LogLevel{Module: module, Level: level.String()})
+	}
+	sort.Slice(rs.Levels, func(i, j int) bool {
+		return rs.Levels[i].Module < rs.Levels[j].Module
+	})
+	return rs, nil
+}
+
+func (a *Admin) WatchClients(req *WatchClientsRequest, stream Admin_WatchClientsServer) error {
+	ch := make(chan *ClientEvent, watchBufferSize)
+	a.watchMu.Lock()
+	a.clientWatches[ch] = struct{}{}
+	a.watchMu.Unlock()
+	defer func() {
+		a.watchMu.Lock()
+		delete(a.clientWatches, ch)
+		a.watchMu.Unlock()
+	}()
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case event := <-ch:
+			if err := stream.Send(event); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (a *Admin) WatchSubscriptions(req *WatchSubscriptionsRequest, stream Admin_WatchSubscriptionsServer) error {
+	ch := make(chan *SubscriptionEvent, watchBufferSize)
+	a.watchMu.Lock()
+	a.subWatches[ch] = struct{}{}
+	a.watchMu.Unlock()
+	defer func() {
+		a.watchMu.Lock()
+		delete(a.subWatches, ch)
+		a.watchMu.Unlock()
+	}()
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case event := <-ch:
+			if err := stream.Send(event); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (a *Admin) Trace(req *TraceRequest, stream Admin_TraceServer) error {
+	if _, ok := TraceRequest_Kind_name[int32(req.Kind)]; !ok {
+		return status.Error(codes.InvalidArgument, "invalid kind")
+	}
+	ch := make(chan *TraceEvent, watchBufferSize)
+	// the values of TraceRequest_Kind and TraceEvent_Hop are the same as gmqtt.TraceKind and gmqtt.TraceHop.
+	trace, err := a.server.TraceService().Start(gmqtt.TraceKind(req.Kind), req.Value, func(e *gmqtt.TraceEvent) {
+		event := &TraceEvent{
+			Time:      e.Time.UnixNano(),
+			Hop:       TraceEvent_Hop(e.Hop),
+			ClientId:  e.ClientID,
+			TopicName: e.Topic,
+			Qos:       uint32(e.Qos),
+			Retained:  e.Retained,
+			PacketId:  uint32(e.PacketID),
+			Payload:   e.Payload,
+			Reason:    e.Reason,
+		}
+		select {
+		case ch <- event:
+		default:
+			log.Warn("trace event dropped, the watcher falls behind", zap.String("value", req.Value))
+		}
+	})
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	defer a.server.TraceService().Stop(trace.ID)
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case event := <-ch:
+			if err := stream.Send(event); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (a *Admin) TopTopics(ctx context.Context, req *TopTopicsRequest) (*TopTopicsResponse, error) {
+	rs := &TopTopicsResponse{}
+	for _, v := range a.server.GetStatsManager().TopTopics(int(req.N)) {
+		rs.Topics = append(rs.Topics, &TopicStats{
+			TopicName:   v.Topic,
+			MessagesIn:  v.MessagesIn,
+			MessagesOut: v.MessagesOut,
+			BytesIn:     v.BytesIn,
+			BytesOut:    v.BytesOut,
+			Subscribers: v.Subscribers,
+		})
+	}
+	return rs, nil
+}
+
+func (a *Admin) ListPlugins(ctx context.Context, req *ListPluginsRequest) (*ListPluginsResponse, error) {
+	rs := &ListPluginsResponse{}
+	for _, v := range a.server.PluginService().List() {
+		rs.Plugins = append(rs.Plugins, &Plugin{
+			Name:     v.Name,
+			Requires: v.Requires,
+			Loaded:   v.Loaded,
+			Panics:   v.Panics,
+		})
+	}
+	return rs, nil
+}
+
+func (a *Admin) LoadPlugin(ctx context.Context, req *LoadPluginRequest) (*Empty, error) {
+	if err := pluginError(a.server.PluginService().Load(req.Name)); err != nil {
+		return nil, err
+	}
+	return &Empty{}, nil
+}
+
+func (a *Admin) UnloadPlugin(ctx context.Context, req *UnloadPluginRequest) (*Empty, error) {
+	// stopping the grpc server inside its own handler never returns.
+	if req.Name == name {
+		return nil, status.Error(codes.FailedPrecondition, "the admin plugin can not unload itself")
+	}
+	if err := pluginError(a.server.PluginService().Unload(req.Name)); err != nil {
+		return nil, err
+	}
+	return &Empty{}, nil
+}
+
+// pluginError converts the error of gmqtt.PluginService into the grpc status error.
+func pluginError(err error) error {
+	switch err {
+	case nil:
+		return nil
+	case gmqtt.ErrPluginNotFound:
+		return status.Error(codes.NotFound, err.Error())
+	default:
+		return status.Error(codes.FailedPrecondition, err.Error())
+	}
+}
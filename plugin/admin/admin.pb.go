@@ -0,0 +1,3375 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// source: admin.proto
+
+package admin
+
+import (
+	context "context"
+	fmt "fmt"
+	proto "github.com/golang/protobuf/proto"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+	math "math"
+)
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the proto package it is being compiled against.
+// A compilation error at this line likely means your copy of the
+// proto package needs to be updated.
+const _ = proto.ProtoPackageIsVersion3 // please upgrade the proto package
+
+type ClientEvent_Type int32
+
+const (
+	ClientEvent_CONNECTED          ClientEvent_Type = 0
+	ClientEvent_DISCONNECTED       ClientEvent_Type = 1
+	ClientEvent_SESSION_TERMINATED ClientEvent_Type = 2
+)
+
+var ClientEvent_Type_name = map[int32]string{
+	0: "CONNECTED",
+	1: "DISCONNECTED",
+	2: "SESSION_TERMINATED",
+}
+
+var ClientEvent_Type_value = map[string]int32{
+	"CONNECTED":          0,
+	"DISCONNECTED":       1,
+	"SESSION_TERMINATED": 2,
+}
+
+func (x ClientEvent_Type) String() string {
+	return proto.EnumName(ClientEvent_Type_name, int32(x))
+}
+
+func (ClientEvent_Type) EnumDescriptor() ([]byte, []int) {
+	return fileDescriptor_73a7fc70dcc2027c, []int{19, 0}
+}
+
+type SubscriptionEvent_Type int32
+
+const (
+	SubscriptionEvent_SUBSCRIBED   SubscriptionEvent_Type = 0
+	SubscriptionEvent_UNSUBSCRIBED SubscriptionEvent_Type = 1
+)
+
+var SubscriptionEvent_Type_name = map[int32]string{
+	0: "SUBSCRIBED",
+	1: "UNSUBSCRIBED",
+}
+
+var SubscriptionEvent_Type_value = map[string]int32{
+	"SUBSCRIBED":   0,
+	"UNSUBSCRIBED": 1,
+}
+
+func (x SubscriptionEvent_Type) String() string {
+	return proto.EnumName(SubscriptionEvent_Type_name, int32(x))
+}
+
+func (SubscriptionEvent_Type) EnumDescriptor() ([]byte, []int) {
+	return fileDescriptor_73a7fc70dcc2027c, []int{21, 0}
+}
+
+type Ban_Kind int32
+
+const (
+	Ban_CLIENT_ID Ban_Kind = 0
+	Ban_IP        Ban_Kind = 1
+	Ban_CIDR      Ban_Kind = 2
+	// CLIENT_ID_PATTERN matches the client ids by the pattern,
+	// '*' matches any sequence of characters and '?' matches any single character.
+	Ban_CLIENT_ID_PATTERN Ban_Kind = 3
+)
+
+var Ban_Kind_name = map[int32]string{
+	0: "CLIENT_ID",
+	1: "IP",
+	2: "CIDR",
+	3: "CLIENT_ID_PATTERN",
+}
+
+var Ban_Kind_value = map[string]int32{
+	"CLIENT_ID":         0,
+	"IP":                1,
+	"CIDR":              2,
+	"CLIENT_ID_PATTERN": 3,
+}
+
+func (x Ban_Kind) String() string {
+	return proto.EnumName(Ban_Kind_name, int32(x))
+}
+
+func (Ban_Kind) EnumDescriptor() ([]byte, []int) {
+	return fileDescriptor_73a7fc70dcc2027c, []int{22, 0}
+}
+
+type TraceRequest_Kind int32
+
+const (
+	TraceRequest_CLIENT_ID TraceRequest_Kind = 0
+	TraceRequest_TOPIC     TraceRequest_Kind = 1
+)
+
+var TraceRequest_Kind_name = map[int32]string{
+	0: "CLIENT_ID",
+	1: "TOPIC",
+}
+
+var TraceRequest_Kind_value = map[string]int32{
+	"CLIENT_ID": 0,
+	"TOPIC":     1,
+}
+
+func (x TraceRequest_Kind) String() string {
+	return proto.EnumName(TraceRequest_Kind_name, int32(x))
+}
+
+func (TraceRequest_Kind) EnumDescriptor() ([]byte, []int) {
+	return fileDescriptor_73a7fc70dcc2027c, []int{31, 0}
+}
+
+type TraceEvent_Hop int32
+
+const (
+	TraceEvent_RECEIVED  TraceEvent_Hop = 0
+	TraceEvent_QUEUED    TraceEvent_Hop = 1
+	TraceEvent_DELIVERED TraceEvent_Hop = 2
+	TraceEvent_ACKED     TraceEvent_Hop = 3
+	TraceEvent_DROPPED   TraceEvent_Hop = 4
+)
+
+var TraceEvent_Hop_name = map[int32]string{
+	0: "RECEIVED",
+	1: "QUEUED",
+	2: "DELIVERED",
+	3: "ACKED",
+	4: "DROPPED",
+}
+
+var TraceEvent_Hop_value = map[string]int32{
+	"RECEIVED":  0,
+	"QUEUED":    1,
+	"DELIVERED": 2,
+	"ACKED":     3,
+	"DROPPED":   4,
+}
+
+func (x TraceEvent_Hop) String() string {
+	return proto.EnumName(TraceEvent_Hop_name, int32(x))
+}
+
+func (TraceEvent_Hop) EnumDescriptor() ([]byte, []int) {
+	return fileDescriptor_73a7fc70dcc2027c, []int{32, 0}
+}
+
+type Empty struct {
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Empty) Reset()         { *m = Empty{} }
+func (m *Empty) String() string { return proto.CompactTextString(m) }
+func (*Empty) ProtoMessage()    {}
+func (*Empty) Descriptor() ([]byte, []int) {
+	return fileDescriptor_73a7fc70dcc2027c, []int{0}
+}
+
+func (m *Empty) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Empty.Unmarshal(m, b)
+}
+func (m *Empty) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Empty.Marshal(b, m, deterministic)
+}
+func (m *Empty) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Empty.Merge(m, src)
+}
+func (m *Empty) XXX_Size() int {
+	return xxx_messageInfo_Empty.Size(m)
+}
+func (m *Empty) XXX_DiscardUnknown() {
+	xxx_messageInfo_Empty.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Empty proto.InternalMessageInfo
+
+// Pager is the pagination of the list requests, page starts from 1.
+type Pager struct {
+	Page                 uint32   `protobuf:"varint,1,opt,name=page,proto3" json:"page,omitempty"`
+	PageSize             uint32   `protobuf:"varint,2,opt,name=page_size,json=pageSize,proto3" json:"page_size,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Pager) Reset()         { *m = Pager{} }
+func (m *Pager) String() string { return proto.CompactTextString(m) }
+func (*Pager) ProtoMessage()    {}
+func (*Pager) Descriptor() ([]byte, []int) {
+	return fileDescriptor_73a7fc70dcc2027c, []int{1}
+}
+
+func (m *Pager) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Pager.Unmarshal(m, b)
+}
+func (m *Pager) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Pager.Marshal(b, m, deterministic)
+}
+func (m *Pager) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Pager.Merge(m, src)
+}
+func (m *Pager) XXX_Size() int {
+	return xxx_messageInfo_Pager.Size(m)
+}
+func (m *Pager) XXX_DiscardUnknown() {
+	xxx_messageInfo_Pager.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Pager proto.InternalMessageInfo
+
+func (m *Pager) GetPage() uint32 {
+	if m != nil {
+		return m.Page
+	}
+	return 0
+}
+
+func (m *Pager) GetPageSize() uint32 {
+	if m != nil {
+		return m.PageSize
+	}
+	return 0
+}
+
+type Client struct {
+	ClientId     string `protobuf:"bytes,1,opt,name=client_id,json=clientId,proto3" json:"client_id,omitempty"`
+	Username     string `protobuf:"bytes,2,opt,name=username,proto3" json:"username,omitempty"`
+	KeepAlive    uint32 `protobuf:"varint,3,opt,name=keep_alive,json=keepAlive,proto3" json:"keep_alive,omitempty"`
+	CleanSession bool   `protobuf:"varint,4,opt,name=clean_session,json=cleanSession,proto3" json:"clean_session,omitempty"`
+	Connected    bool   `protobuf:"varint,5,opt,name=connected,proto3" json:"connected,omitempty"`
+	RemoteAddr   string `protobuf:"bytes,6,opt,name=remote_addr,json=remoteAddr,proto3" json:"remote_addr,omitempty"`
+	LocalAddr    string `protobuf:"bytes,7,opt,name=local_addr,json=localAddr,proto3" json:"local_addr,omitempty"`
+	// connected_at and disconnected_at are unix timestamps in seconds.
+	ConnectedAt    int64  `protobuf:"varint,8,opt,name=connected_at,json=connectedAt,proto3" json:"connected_at,omitempty"`
+	DisconnectedAt int64  `protobuf:"varint,9,opt,name=disconnected_at,json=disconnectedAt,proto3" json:"disconnected_at,omitempty"`
+	InflightLen    uint64 `protobuf:"varint,10,opt,name=inflight_len,json=inflightLen,proto3" json:"inflight_len,omitempty"`
+	AwaitRelLen    uint64 `protobuf:"varint,11,opt,name=await_rel_len,json=awaitRelLen,proto3" json:"await_rel_len,omitempty"`
+	MsgQueueLen    uint64 `protobuf:"varint,12,opt,name=msg_queue_len,json=msgQueueLen,proto3" json:"msg_queue_len,omitempty"`
+	Subscriptions  uint64 `protobuf:"varint,13,opt,name=subscriptions,proto3" json:"subscriptions,omitempty"`
+	// bytes_received, bytes_sent, packets_received and packets_sent are the statistics of the current connection,
+	// the packets are counted by the packet type, e.g: PUBLISH.
+	BytesReceived   uint64            `protobuf:"varint,14,opt,name=bytes_received,json=bytesReceived,proto3" json:"bytes_received,omitempty"`
+	BytesSent       uint64            `protobuf:"varint,15,opt,name=bytes_sent,json=bytesSent,proto3" json:"bytes_sent,omitempty"`
+	PacketsReceived map[string]uint64 `protobuf:"bytes,16,rep,name=packets_received,json=packetsReceived,proto3" json:"packets_received,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"varint,2,opt,name=value,proto3"`
+	PacketsSent     map[string]uint64 `protobuf:"bytes,17,rep,name=packets_sent,json=packetsSent,proto3" json:"packets_sent,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"varint,2,opt,name=value,proto3"`
+	// last_seen_at is the unix timestamp in seconds of the last packet received from the client, 0 if none.
+	LastSeenAt           int64    `protobuf:"varint,18,opt,name=last_seen_at,json=lastSeenAt,proto3" json:"last_seen_at,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Client) Reset()         { *m = Client{} }
+func (m *Client) String() string { return proto.CompactTextString(m) }
+func (*Client) ProtoMessage()    {}
+func (*Client) Descriptor() ([]byte, []int) {
+	return fileDescriptor_73a7fc70dcc2027c, []int{2}
+}
+
+func (m *Client) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Client.Unmarshal(m, b)
+}
+func (m *Client) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Client.Marshal(b, m, deterministic)
+}
+func (m *Client) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Client.Merge(m, src)
+}
+func (m *Client) XXX_Size() int {
+	return xxx_messageInfo_Client.Size(m)
+}
+func (m *Client) XXX_DiscardUnknown() {
+	xxx_messageInfo_Client.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Client proto.InternalMessageInfo
+
+func (m *Client) GetClientId() string {
+	if m != nil {
+		return m.ClientId
+	}
+	return ""
+}
+
+func (m *Client) GetUsername() string {
+	if m != nil {
+		return m.Username
+	}
+	return ""
+}
+
+func (m *Client) GetKeepAlive() uint32 {
+	if m != nil {
+		return m.KeepAlive
+	}
+	return 0
+}
+
+func (m *Client) GetCleanSession() bool {
+	if m != nil {
+		return m.CleanSession
+	}
+	return false
+}
+
+func (m *Client) GetConnected() bool {
+	if m != nil {
+		return m.Connected
+	}
+	return false
+}
+
+func (m *Client) GetRemoteAddr() string {
+	if m != nil {
+		return m.RemoteAddr
+	}
+	return ""
+}
+
+func (m *Client) GetLocalAddr() string {
+	if m != nil {
+		return m.LocalAddr
+	}
+	return ""
+}
+
+func (m *Client) GetConnectedAt() int64 {
+	if m != nil {
+		return m.ConnectedAt
+	}
+	return 0
+}
+
+func (m *Client) GetDisconnectedAt() int64 {
+	if m != nil {
+		return m.DisconnectedAt
+	}
+	return 0
+}
+
+func (m *Client) GetInflightLen() uint64 {
+	if m != nil {
+		return m.InflightLen
+	}
+	return 0
+}
+
+func (m *Client) GetAwaitRelLen() uint64 {
+	if m != nil {
+		return m.AwaitRelLen
+	}
+	return 0
+}
+
+func (m *Client) GetMsgQueueLen() uint64 {
+	if m != nil {
+		return m.MsgQueueLen
+	}
+	return 0
+}
+
+func (m *Client) GetSubscriptions() uint64 {
+	if m != nil {
+		return m.Subscriptions
+	}
+	return 0
+}
+
+func (m *Client) GetBytesReceived() uint64 {
+	if m != nil {
+		return m.BytesReceived
+	}
+	return 0
+}
+
+func (m *Client) GetBytesSent() uint64 {
+	if m != nil {
+		return m.BytesSent
+	}
+	return 0
+}
+
+func (m *Client) GetPacketsReceived() map[string]uint64 {
+	if m != nil {
+		return m.PacketsReceived
+	}
+	return nil
+}
+
+func (m *Client) GetPacketsSent() map[string]uint64 {
+	if m != nil {
+		return m.PacketsSent
+	}
+	return nil
+}
+
+func (m *Client) GetLastSeenAt() int64 {
+	if m != nil {
+		return m.LastSeenAt
+	}
+	return 0
+}
+
+type ListClientsRequest struct {
+	Pager                *Pager   `protobuf:"bytes,1,opt,name=pager,proto3" json:"pager,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ListClientsRequest) Reset()         { *m = ListClientsRequest{} }
+func (m *ListClientsRequest) String() string { return proto.CompactTextString(m) }
+func (*ListClientsRequest) ProtoMessage()    {}
+func (*ListClientsRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_73a7fc70dcc2027c, []int{3}
+}
+
+func (m *ListClientsRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ListClientsRequest.Unmarshal(m, b)
+}
+func (m *ListClientsRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ListClientsRequest.Marshal(b, m, deterministic)
+}
+func (m *ListClientsRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ListClientsRequest.Merge(m, src)
+}
+func (m *ListClientsRequest) XXX_Size() int {
+	return xxx_messageInfo_ListClientsRequest.Size(m)
+}
+func (m *ListClientsRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_ListClientsRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ListClientsRequest proto.InternalMessageInfo
+
+func (m *ListClientsRequest) GetPager() *Pager {
+	if m != nil {
+		return m.Pager
+	}
+	return nil
+}
+
+type ListClientsResponse struct {
+	Clients              []*Client `protobuf:"bytes,1,rep,name=clients,proto3" json:"clients,omitempty"`
+	Total                uint32    `protobuf:"varint,2,opt,name=total,proto3" json:"total,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}  `json:"-"`
+	XXX_unrecognized     []byte    `json:"-"`
+	XXX_sizecache        int32     `json:"-"`
+}
+
+func (m *ListClientsResponse) Reset()         { *m = ListClientsResponse{} }
+func (m *ListClientsResponse) String() string { return proto.CompactTextString(m) }
+func (*ListClientsResponse) ProtoMessage()    {}
+func (*ListClientsResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_73a7fc70dcc2027c, []int{4}
+}
+
+func (m *ListClientsResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ListClientsResponse.Unmarshal(m, b)
+}
+func (m *ListClientsResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ListClientsResponse.Marshal(b, m, deterministic)
+}
+func (m *ListClientsResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ListClientsResponse.Merge(m, src)
+}
+func (m *ListClientsResponse) XXX_Size() int {
+	return xxx_messageInfo_ListClientsResponse.Size(m)
+}
+func (m *ListClientsResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_ListClientsResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ListClientsResponse proto.InternalMessageInfo
+
+func (m *ListClientsResponse) GetClients() []*Client {
+	if m != nil {
+		return m.Clients
+	}
+	return nil
+}
+
+func (m *ListClientsResponse) GetTotal() uint32 {
+	if m != nil {
+		return m.Total
+	}
+	return 0
+}
+
+type GetClientRequest struct {
+	ClientId             string   `protobuf:"bytes,1,opt,name=client_id,json=clientId,proto3" json:"client_id,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *GetClientRequest) Reset()         { *m = GetClientRequest{} }
+func (m *GetClientRequest) String() string { return proto.CompactTextString(m) }
+func (*GetClientRequest) ProtoMessage()    {}
+func (*GetClientRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_73a7fc70dcc2027c, []int{5}
+}
+
+func (m *GetClientRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_GetClientRequest.Unmarshal(m, b)
+}
+func (m *GetClientRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_GetClientRequest.Marshal(b, m, deterministic)
+}
+func (m *GetClientRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_GetClientRequest.Merge(m, src)
+}
+func (m *GetClientRequest) XXX_Size() int {
+	return xxx_messageInfo_GetClientRequest.Size(m)
+}
+func (m *GetClientRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_GetClientRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_GetClientRequest proto.InternalMessageInfo
+
+func (m *GetClientRequest) GetClientId() string {
+	if m != nil {
+		return m.ClientId
+	}
+	return ""
+}
+
+type CloseClientRequest struct {
+	ClientId             string   `protobuf:"bytes,1,opt,name=client_id,json=clientId,proto3" json:"client_id,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *CloseClientRequest) Reset()         { *m = CloseClientRequest{} }
+func (m *CloseClientRequest) String() string { return proto.CompactTextString(m) }
+func (*CloseClientRequest) ProtoMessage()    {}
+func (*CloseClientRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_73a7fc70dcc2027c, []int{6}
+}
+
+func (m *CloseClientRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_CloseClientRequest.Unmarshal(m, b)
+}
+func (m *CloseClientRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_CloseClientRequest.Marshal(b, m, deterministic)
+}
+func (m *CloseClientRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_CloseClientRequest.Merge(m, src)
+}
+func (m *CloseClientRequest) XXX_Size() int {
+	return xxx_messageInfo_CloseClientRequest.Size(m)
+}
+func (m *CloseClientRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_CloseClientRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_CloseClientRequest proto.InternalMessageInfo
+
+func (m *CloseClientRequest) GetClientId() string {
+	if m != nil {
+		return m.ClientId
+	}
+	return ""
+}
+
+type Subscription struct {
+	TopicFilter          string   `protobuf:"bytes,1,opt,name=topic_filter,json=topicFilter,proto3" json:"topic_filter,omitempty"`
+	Qos                  uint32   `protobuf:"varint,2,opt,name=qos,proto3" json:"qos,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Subscription) Reset()         { *m = Subscription{} }
+func (m *Subscription) String() string { return proto.CompactTextString(m) }
+func (*Subscription) ProtoMessage()    {}
+func (*Subscription) Descriptor() ([]byte, []int) {
+	return fileDescriptor_73a7fc70dcc2027c, []int{7}
+}
+
+func (m *Subscription) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Subscription.Unmarshal(m, b)
+}
+func (m *Subscription) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Subscription.Marshal(b, m, deterministic)
+}
+func (m *Subscription) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Subscription.Merge(m, src)
+}
+func (m *Subscription) XXX_Size() int {
+	return xxx_messageInfo_Subscription.Size(m)
+}
+func (m *Subscription) XXX_DiscardUnknown() {
+	xxx_messageInfo_Subscription.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Subscription proto.InternalMessageInfo
+
+func (m *Subscription) GetTopicFilter() string {
+	if m != nil {
+		return m.TopicFilter
+	}
+	return ""
+}
+
+func (m *Subscription) GetQos() uint32 {
+	if m != nil {
+		return m.Qos
+	}
+	return 0
+}
+
+type ListSubscriptionsRequest struct {
+	ClientId             string   `protobuf:"bytes,1,opt,name=client_id,json=clientId,proto3" json:"client_id,omitempty"`
+	Pager                *Pager   `protobuf:"bytes,2,opt,name=pager,proto3" json:"pager,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ListSubscriptionsRequest) Reset()         { *m = ListSubscriptionsRequest{} }
+func (m *ListSubscriptionsRequest) String() string { return proto.CompactTextString(m) }
+func (*ListSubscriptionsRequest) ProtoMessage()    {}
+func (*ListSubscriptionsRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_73a7fc70dcc2027c, []int{8}
+}
+
+func (m *ListSubscriptionsRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ListSubscriptionsRequest.Unmarshal(m, b)
+}
+func (m *ListSubscriptionsRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ListSubscriptionsRequest.Marshal(b, m, deterministic)
+}
+func (m *ListSubscriptionsRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ListSubscriptionsRequest.Merge(m, src)
+}
+func (m *ListSubscriptionsRequest) XXX_Size() int {
+	return xxx_messageInfo_ListSubscriptionsRequest.Size(m)
+}
+func (m *ListSubscriptionsRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_ListSubscriptionsRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ListSubscriptionsRequest proto.InternalMessageInfo
+
+func (m *ListSubscriptionsRequest) GetClientId() string {
+	if m != nil {
+		return m.ClientId
+	}
+	return ""
+}
+
+func (m *ListSubscriptionsRequest) GetPager() *Pager {
+	if m != nil {
+		return m.Pager
+	}
+	return nil
+}
+
+type ListSubscriptionsResponse struct {
+	Subscriptions        []*Subscription `protobuf:"bytes,1,rep,name=subscriptions,proto3" json:"subscriptions,omitempty"`
+	Total                uint32          `protobuf:"varint,2,opt,name=total,proto3" json:"total,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}        `json:"-"`
+	XXX_unrecognized     []byte          `json:"-"`
+	XXX_sizecache        int32           `json:"-"`
+}
+
+func (m *ListSubscriptionsResponse) Reset()         { *m = ListSubscriptionsResponse{} }
+func (m *ListSubscriptionsResponse) String() string { return proto.CompactTextString(m) }
+func (*ListSubscriptionsResponse) ProtoMessage()    {}
+func (*ListSubscriptionsResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_73a7fc70dcc2027c, []int{9}
+}
+
+func (m *ListSubscriptionsResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ListSubscriptionsResponse.Unmarshal(m, b)
+}
+func (m *ListSubscriptionsResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ListSubscriptionsResponse.Marshal(b, m, deterministic)
+}
+func (m *ListSubscriptionsResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ListSubscriptionsResponse.Merge(m, src)
+}
+func (m *ListSubscriptionsResponse) XXX_Size() int {
+	return xxx_messageInfo_ListSubscriptionsResponse.Size(m)
+}
+func (m *ListSubscriptionsResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_ListSubscriptionsResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ListSubscriptionsResponse proto.InternalMessageInfo
+
+func (m *ListSubscriptionsResponse) GetSubscriptions() []*Subscription {
+	if m != nil {
+		return m.Subscriptions
+	}
+	return nil
+}
+
+func (m *ListSubscriptionsResponse) GetTotal() uint32 {
+	if m != nil {
+		return m.Total
+	}
+	return 0
+}
+
+type SubscribeRequest struct {
+	ClientId             string          `protobuf:"bytes,1,opt,name=client_id,json=clientId,proto3" json:"client_id,omitempty"`
+	Subscriptions        []*Subscription `protobuf:"bytes,2,rep,name=subscriptions,proto3" json:"subscriptions,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}        `json:"-"`
+	XXX_unrecognized     []byte          `json:"-"`
+	XXX_sizecache        int32           `json:"-"`
+}
+
+func (m *SubscribeRequest) Reset()         { *m = SubscribeRequest{} }
+func (m *SubscribeRequest) String() string { return proto.CompactTextString(m) }
+func (*SubscribeRequest) ProtoMessage()    {}
+func (*SubscribeRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_73a7fc70dcc2027c, []int{10}
+}
+
+func (m *SubscribeRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_SubscribeRequest.Unmarshal(m, b)
+}
+func (m *SubscribeRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_SubscribeRequest.Marshal(b, m, deterministic)
+}
+func (m *SubscribeRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_SubscribeRequest.Merge(m, src)
+}
+func (m *SubscribeRequest) XXX_Size() int {
+	return xxx_messageInfo_SubscribeRequest.Size(m)
+}
+func (m *SubscribeRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_SubscribeRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_SubscribeRequest proto.InternalMessageInfo
+
+func (m *SubscribeRequest) GetClientId() string {
+	if m != nil {
+		return m.ClientId
+	}
+	return ""
+}
+
+func (m *SubscribeRequest) GetSubscriptions() []*Subscription {
+	if m != nil {
+		return m.Subscriptions
+	}
+	return nil
+}
+
+type UnsubscribeRequest struct {
+	ClientId             string   `protobuf:"bytes,1,opt,name=client_id,json=clientId,proto3" json:"client_id,omitempty"`
+	TopicFilters         []string `protobuf:"bytes,2,rep,name=topic_filters,json=topicFilters,proto3" json:"topic_filters,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *UnsubscribeRequest) Reset()         { *m = UnsubscribeRequest{} }
+func (m *UnsubscribeRequest) String() string { return proto.CompactTextString(m) }
+func (*UnsubscribeRequest) ProtoMessage()    {}
+func (*UnsubscribeRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_73a7fc70dcc2027c, []int{11}
+}
+
+func (m *UnsubscribeRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_UnsubscribeRequest.Unmarshal(m, b)
+}
+func (m *UnsubscribeRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_UnsubscribeRequest.Marshal(b, m, deterministic)
+}
+func (m *UnsubscribeRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_UnsubscribeRequest.Merge(m, src)
+}
+func (m *UnsubscribeRequest) XXX_Size() int {
+	return xxx_messageInfo_UnsubscribeRequest.Size(m)
+}
+func (m *UnsubscribeRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_UnsubscribeRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_UnsubscribeRequest proto.InternalMessageInfo
+
+func (m *UnsubscribeRequest) GetClientId() string {
+	if m != nil {
+		return m.ClientId
+	}
+	return ""
+}
+
+func (m *UnsubscribeRequest) GetTopicFilters() []string {
+	if m != nil {
+		return m.TopicFilters
+	}
+	return nil
+}
+
+type GetSubscriptionStatsRequest struct {
+	ClientId             string   `protobuf:"bytes,1,opt,name=client_id,json=clientId,proto3" json:"client_id,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *GetSubscriptionStatsRequest) Reset()         { *m = GetSubscriptionStatsRequest{} }
+func (m *GetSubscriptionStatsRequest) String() string { return proto.CompactTextString(m) }
+func (*GetSubscriptionStatsRequest) ProtoMessage()    {}
+func (*GetSubscriptionStatsRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_73a7fc70dcc2027c, []int{12}
+}
+
+func (m *GetSubscriptionStatsRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_GetSubscriptionStatsRequest.Unmarshal(m, b)
+}
+func (m *GetSubscriptionStatsRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_GetSubscriptionStatsRequest.Marshal(b, m, deterministic)
+}
+func (m *GetSubscriptionStatsRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_GetSubscriptionStatsRequest.Merge(m, src)
+}
+func (m *GetSubscriptionStatsRequest) XXX_Size() int {
+	return xxx_messageInfo_GetSubscriptionStatsRequest.Size(m)
+}
+func (m *GetSubscriptionStatsRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_GetSubscriptionStatsRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_GetSubscriptionStatsRequest proto.InternalMessageInfo
+
+func (m *GetSubscriptionStatsRequest) GetClientId() string {
+	if m != nil {
+		return m.ClientId
+	}
+	return ""
+}
+
+type SubscriptionStats struct {
+	SubscriptionsTotal   uint64   `protobuf:"varint,1,opt,name=subscriptions_total,json=subscriptionsTotal,proto3" json:"subscriptions_total,omitempty"`
+	SubscriptionsCurrent uint64   `protobuf:"varint,2,opt,name=subscriptions_current,json=subscriptionsCurrent,proto3" json:"subscriptions_current,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *SubscriptionStats) Reset()         { *m = SubscriptionStats{} }
+func (m *SubscriptionStats) String() string { return proto.CompactTextString(m) }
+func (*SubscriptionStats) ProtoMessage()    {}
+func (*SubscriptionStats) Descriptor() ([]byte, []int) {
+	return fileDescriptor_73a7fc70dcc2027c, []int{13}
+}
+
+func (m *SubscriptionStats) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_SubscriptionStats.Unmarshal(m, b)
+}
+func (m *SubscriptionStats) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_SubscriptionStats.Marshal(b, m, deterministic)
+}
+func (m *SubscriptionStats) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_SubscriptionStats.Merge(m, src)
+}
+func (m *SubscriptionStats) XXX_Size() int {
+	return xxx_messageInfo_SubscriptionStats.Size(m)
+}
+func (m *SubscriptionStats) XXX_DiscardUnknown() {
+	xxx_messageInfo_SubscriptionStats.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_SubscriptionStats proto.InternalMessageInfo
+
+func (m *SubscriptionStats) GetSubscriptionsTotal() uint64 {
+	if m != nil {
+		return m.SubscriptionsTotal
+	}
+	return 0
+}
+
+func (m *SubscriptionStats) GetSubscriptionsCurrent() uint64 {
+	if m != nil {
+		return m.SubscriptionsCurrent
+	}
+	return 0
+}
+
+type PublishRequest struct {
+	TopicName string `protobuf:"bytes,1,opt,name=topic_name,json=topicName,proto3" json:"topic_name,omitempty"`
+	Payload   []byte `protobuf:"bytes,2,opt,name=payload,proto3" json:"payload,omitempty"`
+	Qos       uint32 `protobuf:"varint,3,opt,name=qos,proto3" json:"qos,omitempty"`
+	Retained  bool   `protobuf:"varint,4,opt,name=retained,proto3" json:"retained,omitempty"`
+	// client_id is the receiver of the message, empty means all matched subscribers.
+	ClientId             string   `protobuf:"bytes,5,opt,name=client_id,json=clientId,proto3" json:"client_id,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *PublishRequest) Reset()         { *m = PublishRequest{} }
+func (m *PublishRequest) String() string { return proto.CompactTextString(m) }
+func (*PublishRequest) ProtoMessage()    {}
+func (*PublishRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_73a7fc70dcc2027c, []int{14}
+}
+
+func (m *PublishRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_PublishRequest.Unmarshal(m, b)
+}
+func (m *PublishRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_PublishRequest.Marshal(b, m, deterministic)
+}
+func (m *PublishRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_PublishRequest.Merge(m, src)
+}
+func (m *PublishRequest) XXX_Size() int {
+	return xxx_messageInfo_PublishRequest.Size(m)
+}
+func (m *PublishRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_PublishRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_PublishRequest proto.InternalMessageInfo
+
+func (m *PublishRequest) GetTopicName() string {
+	if m != nil {
+		return m.TopicName
+	}
+	return ""
+}
+
+func (m *PublishRequest) GetPayload() []byte {
+	if m != nil {
+		return m.Payload
+	}
+	return nil
+}
+
+func (m *PublishRequest) GetQos() uint32 {
+	if m != nil {
+		return m.Qos
+	}
+	return 0
+}
+
+func (m *PublishRequest) GetRetained() bool {
+	if m != nil {
+		return m.Retained
+	}
+	return false
+}
+
+func (m *PublishRequest) GetClientId() string {
+	if m != nil {
+		return m.ClientId
+	}
+	return ""
+}
+
+type RetainedMessage struct {
+	TopicName            string   `protobuf:"bytes,1,opt,name=topic_name,json=topicName,proto3" json:"topic_name,omitempty"`
+	Payload              []byte   `protobuf:"bytes,2,opt,name=payload,proto3" json:"payload,omitempty"`
+	Qos                  uint32   `protobuf:"varint,3,opt,name=qos,proto3" json:"qos,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *RetainedMessage) Reset()         { *m = RetainedMessage{} }
+func (m *RetainedMessage) String() string { return proto.CompactTextString(m) }
+func (*RetainedMessage) ProtoMessage()    {}
+func (*RetainedMessage) Descriptor() ([]byte, []int) {
+	return fileDescriptor_73a7fc70dcc2027c, []int{15}
+}
+
+func (m *RetainedMessage) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_RetainedMessage.Unmarshal(m, b)
+}
+func (m *RetainedMessage) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_RetainedMessage.Marshal(b, m, deterministic)
+}
+func (m *RetainedMessage) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_RetainedMessage.Merge(m, src)
+}
+func (m *RetainedMessage) XXX_Size() int {
+	return xxx_messageInfo_RetainedMessage.Size(m)
+}
+func (m *RetainedMessage) XXX_DiscardUnknown() {
+	xxx_messageInfo_RetainedMessage.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_RetainedMessage proto.InternalMessageInfo
+
+func (m *RetainedMessage) GetTopicName() string {
+	if m != nil {
+		return m.TopicName
+	}
+	return ""
+}
+
+func (m *RetainedMessage) GetPayload() []byte {
+	if m != nil {
+		return m.Payload
+	}
+	return nil
+}
+
+func (m *RetainedMessage) GetQos() uint32 {
+	if m != nil {
+		return m.Qos
+	}
+	return 0
+}
+
+type ListRetainedRequest struct {
+	// topic_filter is the filter of the retained messages, empty means all retained messages.
+	TopicFilter          string   `protobuf:"bytes,1,opt,name=topic_filter,json=topicFilter,proto3" json:"topic_filter,omitempty"`
+	Pager                *Pager   `protobuf:"bytes,2,opt,name=pager,proto3" json:"pager,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ListRetainedRequest) Reset()         { *m = ListRetainedRequest{} }
+func (m *ListRetainedRequest) String() string { return proto.CompactTextString(m) }
+func (*ListRetainedRequest) ProtoMessage()    {}
+func (*ListRetainedRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_73a7fc70dcc2027c, []int{16}
+}
+
+func (m *ListRetainedRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ListRetainedRequest.Unmarshal(m, b)
+}
+func (m *ListRetainedRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ListRetainedRequest.Marshal(b, m, deterministic)
+}
+func (m *ListRetainedRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ListRetainedRequest.Merge(m, src)
+}
+func (m *ListRetainedRequest) XXX_Size() int {
+	return xxx_messageInfo_ListRetainedRequest.Size(m)
+}
+func (m *ListRetainedRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_ListRetainedRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ListRetainedRequest proto.InternalMessageInfo
+
+func (m *ListRetainedRequest) GetTopicFilter() string {
+	if m != nil {
+		return m.TopicFilter
+	}
+	return ""
+}
+
+func (m *ListRetainedRequest) GetPager() *Pager {
+	if m != nil {
+		return m.Pager
+	}
+	return nil
+}
+
+type ListRetainedResponse struct {
+	Messages             []*RetainedMessage `protobuf:"bytes,1,rep,name=messages,proto3" json:"messages,omitempty"`
+	Total                uint32             `protobuf:"varint,2,opt,name=total,proto3" json:"total,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}           `json:"-"`
+	XXX_unrecognized     []byte             `json:"-"`
+	XXX_sizecache        int32              `json:"-"`
+}
+
+func (m *ListRetainedResponse) Reset()         { *m = ListRetainedResponse{} }
+func (m *ListRetainedResponse) String() string { return proto.CompactTextString(m) }
+func (*ListRetainedResponse) ProtoMessage()    {}
+func (*ListRetainedResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_73a7fc70dcc2027c, []int{17}
+}
+
+func (m *ListRetainedResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ListRetainedResponse.Unmarshal(m, b)
+}
+func (m *ListRetainedResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ListRetainedResponse.Marshal(b, m, deterministic)
+}
+func (m *ListRetainedResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ListRetainedResponse.Merge(m, src)
+}
+func (m *ListRetainedResponse) XXX_Size() int {
+	return xxx_messageInfo_ListRetainedResponse.Size(m)
+}
+func (m *ListRetainedResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_ListRetainedResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ListRetainedResponse proto.InternalMessageInfo
+
+func (m *ListRetainedResponse) GetMessages() []*RetainedMessage {
+	if m != nil {
+		return m.Messages
+	}
+	return nil
+}
+
+func (m *ListRetainedResponse) GetTotal() uint32 {
+	if m != nil {
+		return m.Total
+	}
+	return 0
+}
+
+type WatchClientsRequest struct {
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *WatchClientsRequest) Reset()         { *m = WatchClientsRequest{} }
+func (m *WatchClientsRequest) String() string { return proto.CompactTextString(m) }
+func (*WatchClientsRequest) ProtoMessage()    {}
+func (*WatchClientsRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_73a7fc70dcc2027c, []int{18}
+}
+
+func (m *WatchClientsRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_WatchClientsRequest.Unmarshal(m, b)
+}
+func (m *WatchClientsRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_WatchClientsRequest.Marshal(b, m, deterministic)
+}
+func (m *WatchClientsRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_WatchClientsRequest.Merge(m, src)
+}
+func (m *WatchClientsRequest) XXX_Size() int {
+	return xxx_messageInfo_WatchClientsRequest.Size(m)
+}
+func (m *WatchClientsRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_WatchClientsRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_WatchClientsRequest proto.InternalMessageInfo
+
+type ClientEvent struct {
+	Type                 ClientEvent_Type `protobuf:"varint,1,opt,name=type,proto3,enum=gmqtt.admin.ClientEvent_Type" json:"type,omitempty"`
+	Client               *Client          `protobuf:"bytes,2,opt,name=client,proto3" json:"client,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}         `json:"-"`
+	XXX_unrecognized     []byte           `json:"-"`
+	XXX_sizecache        int32            `json:"-"`
+}
+
+func (m *ClientEvent) Reset()         { *m = ClientEvent{} }
+func (m *ClientEvent) String() string { return proto.CompactTextString(m) }
+func (*ClientEvent) ProtoMessage()    {}
+func (*ClientEvent) Descriptor() ([]byte, []int) {
+	return fileDescriptor_73a7fc70dcc2027c, []int{19}
+}
+
+func (m *ClientEvent) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ClientEvent.Unmarshal(m, b)
+}
+func (m *ClientEvent) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ClientEvent.Marshal(b, m, deterministic)
+}
+func (m *ClientEvent) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ClientEvent.Merge(m, src)
+}
+func (m *ClientEvent) XXX_Size() int {
+	return xxx_messageInfo_ClientEvent.Size(m)
+}
+func (m *ClientEvent) XXX_DiscardUnknown() {
+	xxx_messageInfo_ClientEvent.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ClientEvent proto.InternalMessageInfo
+
+func (m *ClientEvent) GetType() ClientEvent_Type {
+	if m != nil {
+		return m.Type
+	}
+	return ClientEvent_CONNECTED
+}
+
+func (m *ClientEvent) GetClient() *Client {
+	if m != nil {
+		return m.Client
+	}
+	return nil
+}
+
+type WatchSubscriptionsRequest struct {
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *WatchSubscriptionsRequest) Reset()         { *m = WatchSubscriptionsRequest{} }
+func (m *WatchSubscriptionsRequest) String() string { return proto.CompactTextString(m) }
+func (*WatchSubscriptionsRequest) ProtoMessage()    {}
+func (*WatchSubscriptionsRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_73a7fc70dcc2027c, []int{20}
+}
+
+func (m *WatchSubscriptionsRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_WatchSubscriptionsRequest.Unmarshal(m, b)
+}
+func (m *WatchSubscriptionsRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_WatchSubscriptionsRequest.Marshal(b, m, deterministic)
+}
+func (m *WatchSubscriptionsRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_WatchSubscriptionsRequest.Merge(m, src)
+}
+func (m *WatchSubscriptionsRequest) XXX_Size() int {
+	return xxx_messageInfo_WatchSubscriptionsRequest.Size(m)
+}
+func (m *WatchSubscriptionsRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_WatchSubscriptionsRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_WatchSubscriptionsRequest proto.InternalMessageInfo
+
+type SubscriptionEvent struct {
+	Type                 SubscriptionEvent_Type `protobuf:"varint,1,opt,name=type,proto3,enum=gmqtt.admin.SubscriptionEvent_Type" json:"type,omitempty"`
+	ClientId             string                 `protobuf:"bytes,2,opt,name=client_id,json=clientId,proto3" json:"client_id,omitempty"`
+	Subscription         *Subscription          `protobuf:"bytes,3,opt,name=subscription,proto3" json:"subscription,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}               `json:"-"`
+	XXX_unrecognized     []byte                 `json:"-"`
+	XXX_sizecache        int32                  `json:"-"`
+}
+
+func (m *SubscriptionEvent) Reset()         { *m = SubscriptionEvent{} }
+func (m *SubscriptionEvent) String() string { return proto.CompactTextString(m) }
+func (*SubscriptionEvent) ProtoMessage()    {}
+func (*SubscriptionEvent) Descriptor() ([]byte, []int) {
+	return fileDescriptor_73a7fc70dcc2027c, []int{21}
+}
+
+func (m *SubscriptionEvent) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_SubscriptionEvent.Unmarshal(m, b)
+}
+func (m *SubscriptionEvent) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_SubscriptionEvent.Marshal(b, m, deterministic)
+}
+func (m *SubscriptionEvent) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_SubscriptionEvent.Merge(m, src)
+}
+func (m *SubscriptionEvent) XXX_Size() int {
+	return xxx_messageInfo_SubscriptionEvent.Size(m)
+}
+func (m *SubscriptionEvent) XXX_DiscardUnknown() {
+	xxx_messageInfo_SubscriptionEvent.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_SubscriptionEvent proto.InternalMessageInfo
+
+func (m *SubscriptionEvent) GetType() SubscriptionEvent_Type {
+	if m != nil {
+		return m.Type
+	}
+	return SubscriptionEvent_SUBSCRIBED
+}
+
+func (m *SubscriptionEvent) GetClientId() string {
+	if m != nil {
+		return m.ClientId
+	}
+	return ""
+}
+
+func (m *SubscriptionEvent) GetSubscription() *Subscription {
+	if m != nil {
+		return m.Subscription
+	}
+	return nil
+}
+
+type Ban struct {
+	Kind  Ban_Kind `protobuf:"varint,1,opt,name=kind,proto3,enum=gmqtt.admin.Ban_Kind" json:"kind,omitempty"`
+	Value string   `protobuf:"bytes,2,opt,name=value,proto3" json:"value,omitempty"`
+	// at and until are unix timestamps in seconds, until is 0 if the ban never expires.
+	At    int64 `protobuf:"varint,3,opt,name=at,proto3" json:"at,omitempty"`
+	Until int64 `protobuf:"varint,4,opt,name=until,proto3" json:"until,omitempty"`
+	// flapping is true if the ban is added by the flapping detection.
+	Flapping             bool     `protobuf:"varint,5,opt,name=flapping,proto3" json:"flapping,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Ban) Reset()         { *m = Ban{} }
+func (m *Ban) String() string { return proto.CompactTextString(m) }
+func (*Ban) ProtoMessage()    {}
+func (*Ban) Descriptor() ([]byte, []int) {
+	return fileDescriptor_73a7fc70dcc2027c, []int{22}
+}
+
+func (m *Ban) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Ban.Unmarshal(m, b)
+}
+func (m *Ban) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Ban.Marshal(b, m, deterministic)
+}
+func (m *Ban) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Ban.Merge(m, src)
+}
+func (m *Ban) XXX_Size() int {
+	return xxx_messageInfo_Ban.Size(m)
+}
+func (m *Ban) XXX_DiscardUnknown() {
+	xxx_messageInfo_Ban.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Ban proto.InternalMessageInfo
+
+func (m *Ban) GetKind() Ban_Kind {
+	if m != nil {
+		return m.Kind
+	}
+	return Ban_CLIENT_ID
+}
+
+func (m *Ban) GetValue() string {
+	if m != nil {
+		return m.Value
+	}
+	return ""
+}
+
+func (m *Ban) GetAt() int64 {
+	if m != nil {
+		return m.At
+	}
+	return 0
+}
+
+func (m *Ban) GetUntil() int64 {
+	if m != nil {
+		return m.Until
+	}
+	return 0
+}
+
+func (m *Ban) GetFlapping() bool {
+	if m != nil {
+		return m.Flapping
+	}
+	return false
+}
+
+type ListBansRequest struct {
+	Pager                *Pager   `protobuf:"bytes,1,opt,name=pager,proto3" json:"pager,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ListBansRequest) Reset()         { *m = ListBansRequest{} }
+func (m *ListBansRequest) String() string { return proto.CompactTextString(m) }
+func (*ListBansRequest) ProtoMessage()    {}
+func (*ListBansRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_73a7fc70dcc2027c, []int{23}
+}
+
+func (m *ListBansRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ListBansRequest.Unmarshal(m, b)
+}
+func (m *ListBansRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ListBansRequest.Marshal(b, m, deterministic)
+}
+func (m *ListBansRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ListBansRequest.Merge(m, src)
+}
+func (m *ListBansRequest) XXX_Size() int {
+	return xxx_messageInfo_ListBansRequest.Size(m)
+}
+func (m *ListBansRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_ListBansRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ListBansRequest proto.InternalMessageInfo
+
+func (m *ListBansRequest) GetPager() *Pager {
+	if m != nil {
+		return m.Pager
+	}
+	return nil
+}
+
+type ListBansResponse struct {
+	Bans                 []*Ban   `protobuf:"bytes,1,rep,name=bans,proto3" json:"bans,omitempty"`
+	Total                uint32   `protobuf:"varint,2,opt,name=total,proto3" json:"total,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ListBansResponse) Reset()         { *m = ListBansResponse{} }
+func (m *ListBansResponse) String() string { return proto.CompactTextString(m) }
+func (*ListBansResponse) ProtoMessage()    {}
+func (*ListBansResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_73a7fc70dcc2027c, []int{24}
+}
+
+func (m *ListBansResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ListBansResponse.Unmarshal(m, b)
+}
+func (m *ListBansResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ListBansResponse.Marshal(b, m, deterministic)
+}
+func (m *ListBansResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ListBansResponse.Merge(m, src)
+}
+func (m *ListBansResponse) XXX_Size() int {
+	return xxx_messageInfo_ListBansResponse.Size(m)
+}
+func (m *ListBansResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_ListBansResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ListBansResponse proto.InternalMessageInfo
+
+func (m *ListBansResponse) GetBans() []*Ban {
+	if m != nil {
+		return m.Bans
+	}
+	return nil
+}
+
+func (m *ListBansResponse) GetTotal() uint32 {
+	if m != nil {
+		return m.Total
+	}
+	return 0
+}
+
+type BanRequest struct {
+	Kind  Ban_Kind `protobuf:"varint,1,opt,name=kind,proto3,enum=gmqtt.admin.Ban_Kind" json:"kind,omitempty"`
+	Value string   `protobuf:"bytes,2,opt,name=value,proto3" json:"value,omitempty"`
+	// duration is the duration of the ban in seconds, 0 means the ban never expires.
+	Duration             uint32   `protobuf:"varint,3,opt,name=duration,proto3" json:"duration,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *BanRequest) Reset()         { *m = BanRequest{} }
+func (m *BanRequest) String() string { return proto.CompactTextString(m) }
+func (*BanRequest) ProtoMessage()    {}
+func (*BanRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_73a7fc70dcc2027c, []int{25}
+}
+
+func (m *BanRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_BanRequest.Unmarshal(m, b)
+}
+func (m *BanRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_BanRequest.Marshal(b, m, deterministic)
+}
+func (m *BanRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_BanRequest.Merge(m, src)
+}
+func (m *BanRequest) XXX_Size() int {
+	return xxx_messageInfo_BanRequest.Size(m)
+}
+func (m *BanRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_BanRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_BanRequest proto.InternalMessageInfo
+
+func (m *BanRequest) GetKind() Ban_Kind {
+	if m != nil {
+		return m.Kind
+	}
+	return Ban_CLIENT_ID
+}
+
+func (m *BanRequest) GetValue() string {
+	if m != nil {
+		return m.Value
+	}
+	return ""
+}
+
+func (m *BanRequest) GetDuration() uint32 {
+	if m != nil {
+		return m.Duration
+	}
+	return 0
+}
+
+type UnbanRequest struct {
+	Kind                 Ban_Kind `protobuf:"varint,1,opt,name=kind,proto3,enum=gmqtt.admin.Ban_Kind" json:"kind,omitempty"`
+	Value                string   `protobuf:"bytes,2,opt,name=value,proto3" json:"value,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *UnbanRequest) Reset()         { *m = UnbanRequest{} }
+func (m *UnbanRequest) String() string { return proto.CompactTextString(m) }
+func (*UnbanRequest) ProtoMessage()    {}
+func (*UnbanRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_73a7fc70dcc2027c, []int{26}
+}
+
+func (m *UnbanRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_UnbanRequest.Unmarshal(m, b)
+}
+func (m *UnbanRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_UnbanRequest.Marshal(b, m, deterministic)
+}
+func (m *UnbanRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_UnbanRequest.Merge(m, src)
+}
+func (m *UnbanRequest) XXX_Size() int {
+	return xxx_messageInfo_UnbanRequest.Size(m)
+}
+func (m *UnbanRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_UnbanRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_UnbanRequest proto.InternalMessageInfo
+
+func (m *UnbanRequest) GetKind() Ban_Kind {
+	if m != nil {
+		return m.Kind
+	}
+	return Ban_CLIENT_ID
+}
+
+func (m *UnbanRequest) GetValue() string {
+	if m != nil {
+		return m.Value
+	}
+	return ""
+}
+
+type SetLogLevelRequest struct {
+	// module is the log module, such as "subscription" or "plugin/acl", empty means the level of the server.
+	Module string `protobuf:"bytes,1,opt,name=module,proto3" json:"module,omitempty"`
+	// level is one of debug, info, warn, error, dpanic, panic and fatal.
+	Level string `protobuf:"bytes,2,opt,name=level,proto3" json:"level,omitempty"`
+	// clear removes the level override of the module, level is ignored.
+	Clear                bool     `protobuf:"varint,3,opt,name=clear,proto3" json:"clear,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *SetLogLevelRequest) Reset()         { *m = SetLogLevelRequest{} }
+func (m *SetLogLevelRequest) String() string { return proto.CompactTextString(m) }
+func (*SetLogLevelRequest) ProtoMessage()    {}
+func (*SetLogLevelRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_73a7fc70dcc2027c, []int{27}
+}
+
+func (m *SetLogLevelRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_SetLogLevelRequest.Unmarshal(m, b)
+}
+func (m *SetLogLevelRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_SetLogLevelRequest.Marshal(b, m, deterministic)
+}
+func (m *SetLogLevelRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_SetLogLevelRequest.Merge(m, src)
+}
+func (m *SetLogLevelRequest) XXX_Size() int {
+	return xxx_messageInfo_SetLogLevelRequest.Size(m)
+}
+func (m *SetLogLevelRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_SetLogLevelRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_SetLogLevelRequest proto.InternalMessageInfo
+
+func (m *SetLogLevelRequest) GetModule() string {
+	if m != nil {
+		return m.Module
+	}
+	return ""
+}
+
+func (m *SetLogLevelRequest) GetLevel() string {
+	if m != nil {
+		return m.Level
+	}
+	return ""
+}
+
+func (m *SetLogLevelRequest) GetClear() bool {
+	if m != nil {
+		return m.Clear
+	}
+	return false
+}
+
+type ListLogLevelsRequest struct {
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ListLogLevelsRequest) Reset()         { *m = ListLogLevelsRequest{} }
+func (m *ListLogLevelsRequest) String() string { return proto.CompactTextString(m) }
+func (*ListLogLevelsRequest) ProtoMessage()    {}
+func (*ListLogLevelsRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_73a7fc70dcc2027c, []int{28}
+}
+
+func (m *ListLogLevelsRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ListLogLevelsRequest.Unmarshal(m, b)
+}
+func (m *ListLogLevelsRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ListLogLevelsRequest.Marshal(b, m, deterministic)
+}
+func (m *ListLogLevelsRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ListLogLevelsRequest.Merge(m, src)
+}
+func (m *ListLogLevelsRequest) XXX_Size() int {
+	return xxx_messageInfo_ListLogLevelsRequest.Size(m)
+}
+func (m *ListLogLevelsRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_ListLogLevelsRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ListLogLevelsRequest proto.InternalMessageInfo
+
+type LogLevel struct {
+	Module               string   `protobuf:"bytes,1,opt,name=module,proto3" json:"module,omitempty"`
+	Level                string   `protobuf:"bytes,2,opt,name=level,proto3" json:"level,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *LogLevel) Reset()         { *m = LogLevel{} }
+func (m *LogLevel) String() string { return proto.CompactTextString(m) }
+func (*LogLevel) ProtoMessage()    {}
+func (*LogLevel) Descriptor() ([]byte, []int) {
+	return fileDescriptor_73a7fc70dcc2027c, []int{29}
+}
+
+func (m *LogLevel) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_LogLevel.Unmarshal(m, b)
+}
+func (m *LogLevel) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_LogLevel.Marshal(b, m, deterministic)
+}
+func (m *LogLevel) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_LogLevel.Merge(m, src)
+}
+func (m *LogLevel) XXX_Size() int {
+	return xxx_messageInfo_LogLevel.Size(m)
+}
+func (m *LogLevel) XXX_DiscardUnknown() {
+	xxx_messageInfo_LogLevel.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_LogLevel proto.InternalMessageInfo
+
+func (m *LogLevel) GetModule() string {
+	if m != nil {
+		return m.Module
+	}
+	return ""
+}
+
+func (m *LogLevel) GetLevel() string {
+	if m != nil {
+		return m.Level
+	}
+	return ""
+}
+
+type ListLogLevelsResponse struct {
+	Levels               []*LogLevel `protobuf:"bytes,1,rep,name=levels,proto3" json:"levels,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}    `json:"-"`
+	XXX_unrecognized     []byte      `json:"-"`
+	XXX_sizecache        int32       `json:"-"`
+}
+
+func (m *ListLogLevelsResponse) Reset()         { *m = ListLogLevelsResponse{} }
+func (m *ListLogLevelsResponse) String() string { return proto.CompactTextString(m) }
+func (*ListLogLevelsResponse) ProtoMessage()    {}
+func (*ListLogLevelsResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_73a7fc70dcc2027c, []int{30}
+}
+
+func (m *ListLogLevelsResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ListLogLevelsResponse.Unmarshal(m, b)
+}
+func (m *ListLogLevelsResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ListLogLevelsResponse.Marshal(b, m, deterministic)
+}
+func (m *ListLogLevelsResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ListLogLevelsResponse.Merge(m, src)
+}
+func (m *ListLogLevelsResponse) XXX_Size() int {
+	return xxx_messageInfo_ListLogLevelsResponse.Size(m)
+}
+func (m *ListLogLevelsResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_ListLogLevelsResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ListLogLevelsResponse proto.InternalMessageInfo
+
+func (m *ListLogLevelsResponse) GetLevels() []*LogLevel {
+	if m != nil {
+		return m.Levels
+	}
+	return nil
+}
+
+type TraceRequest struct {
+	Kind TraceRequest_Kind `protobuf:"varint,1,opt,name=kind,proto3,enum=gmqtt.admin.TraceRequest_Kind" json:"kind,omitempty"`
+	// value is the client id or the topic filter.
+	Value                string   `protobuf:"bytes,2,opt,name=value,proto3" json:"value,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *TraceRequest) Reset()         { *m = TraceRequest{} }
+func (m *TraceRequest) String() string { return proto.CompactTextString(m) }
+func (*TraceRequest) ProtoMessage()    {}
+func (*TraceRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_73a7fc70dcc2027c, []int{31}
+}
+
+func (m *TraceRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_TraceRequest.Unmarshal(m, b)
+}
+func (m *TraceRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_TraceRequest.Marshal(b, m, deterministic)
+}
+func (m *TraceRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_TraceRequest.Merge(m, src)
+}
+func (m *TraceRequest) XXX_Size() int {
+	return xxx_messageInfo_TraceRequest.Size(m)
+}
+func (m *TraceRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_TraceRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_TraceRequest proto.InternalMessageInfo
+
+func (m *TraceRequest) GetKind() TraceRequest_Kind {
+	if m != nil {
+		return m.Kind
+	}
+	return TraceRequest_CLIENT_ID
+}
+
+func (m *TraceRequest) GetValue() string {
+	if m != nil {
+		return m.Value
+	}
+	return ""
+}
+
+type TraceEvent struct {
+	// time is the unix timestamp in nanoseconds.
+	Time int64          `protobuf:"varint,1,opt,name=time,proto3" json:"time,omitempty"`
+	Hop  TraceEvent_Hop `protobuf:"varint,2,opt,name=hop,proto3,enum=gmqtt.admin.TraceEvent_Hop" json:"hop,omitempty"`
+	// client_id is the publisher of the received message, or the subscriber of the other hops.
+	ClientId  string `protobuf:"bytes,3,opt,name=client_id,json=clientId,proto3" json:"client_id,omitempty"`
+	TopicName string `protobuf:"bytes,4,opt,name=topic_name,json=topicName,proto3" json:"topic_name,omitempty"`
+	Qos       uint32 `protobuf:"varint,5,opt,name=qos,proto3" json:"qos,omitempty"`
+	Retained  bool   `protobuf:"varint,6,opt,name=retained,proto3" json:"retained,omitempty"`
+	PacketId  uint32 `protobuf:"varint,7,opt,name=packet_id,json=packetId,proto3" json:"packet_id,omitempty"`
+	Payload   []byte `protobuf:"bytes,8,opt,name=payload,proto3" json:"payload,omitempty"`
+	// reason is the reason of the dropped message.
+	Reason               string   `protobuf:"bytes,9,opt,name=reason,proto3" json:"reason,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *TraceEvent) Reset()         { *m = TraceEvent{} }
+func (m *TraceEvent) String() string { return proto.CompactTextString(m) }
+func (*TraceEvent) ProtoMessage()    {}
+func (*TraceEvent) Descriptor() ([]byte, []int) {
+	return fileDescriptor_73a7fc70dcc2027c, []int{32}
+}
+
+func (m *TraceEvent) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_TraceEvent.Unmarshal(m, b)
+}
+func (m *TraceEvent) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_TraceEvent.Marshal(b, m, deterministic)
+}
+func (m *TraceEvent) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_TraceEvent.Merge(m, src)
+}
+func (m *TraceEvent) XXX_Size() int {
+	return xxx_messageInfo_TraceEvent.Size(m)
+}
+func (m *TraceEvent) XXX_DiscardUnknown() {
+	xxx_messageInfo_TraceEvent.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_TraceEvent proto.InternalMessageInfo
+
+func (m *TraceEvent) GetTime() int64 {
+	if m != nil {
+		return m.Time
+	}
+	return 0
+}
+
+func (m *TraceEvent) GetHop() TraceEvent_Hop {
+	if m != nil {
+		return m.Hop
+	}
+	return TraceEvent_RECEIVED
+}
+
+func (m *TraceEvent) GetClientId() string {
+	if m != nil {
+		return m.ClientId
+	}
+	return ""
+}
+
+func (m *TraceEvent) GetTopicName() string {
+	if m != nil {
+		return m.TopicName
+	}
+	return ""
+}
+
+func (m *TraceEvent) GetQos() uint32 {
+	if m != nil {
+		return m.Qos
+	}
+	return 0
+}
+
+func (m *TraceEvent) GetRetained() bool {
+	if m != nil {
+		return m.Retained
+	}
+	return false
+}
+
+func (m *TraceEvent) GetPacketId() uint32 {
+	if m != nil {
+		return m.PacketId
+	}
+	return 0
+}
+
+func (m *TraceEvent) GetPayload() []byte {
+	if m != nil {
+		return m.Payload
+	}
+	return nil
+}
+
+func (m *TraceEvent) GetReason() string {
+	if m != nil {
+		return m.Reason
+	}
+	return ""
+}
+
+type TopTopicsRequest struct {
+	// n is the maximum number of the returned topics, 0 means all collected topics.
+	N                    uint32   `protobuf:"varint,1,opt,name=n,proto3" json:"n,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *TopTopicsRequest) Reset()         { *m = TopTopicsRequest{} }
+func (m *TopTopicsRequest) String() string { return proto.CompactTextString(m) }
+func (*TopTopicsRequest) ProtoMessage()    {}
+func (*TopTopicsRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_73a7fc70dcc2027c, []int{33}
+}
+
+func (m *TopTopicsRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_TopTopicsRequest.Unmarshal(m, b)
+}
+func (m *TopTopicsRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_TopTopicsRequest.Marshal(b, m, deterministic)
+}
+func (m *TopTopicsRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_TopTopicsRequest.Merge(m, src)
+}
+func (m *TopTopicsRequest) XXX_Size() int {
+	return xxx_messageInfo_TopTopicsRequest.Size(m)
+}
+func (m *TopTopicsRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_TopTopicsRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_TopTopicsRequest proto.InternalMessageInfo
+
+func (m *TopTopicsRequest) GetN() uint32 {
+	if m != nil {
+		return m.N
+	}
+	return 0
+}
+
+type TopicStats struct {
+	TopicName   string `protobuf:"bytes,1,opt,name=topic_name,json=topicName,proto3" json:"topic_name,omitempty"`
+	MessagesIn  uint64 `protobuf:"varint,2,opt,name=messages_in,json=messagesIn,proto3" json:"messages_in,omitempty"`
+	MessagesOut uint64 `protobuf:"varint,3,opt,name=messages_out,json=messagesOut,proto3" json:"messages_out,omitempty"`
+	BytesIn     uint64 `protobuf:"varint,4,opt,name=bytes_in,json=bytesIn,proto3" json:"bytes_in,omitempty"`
+	BytesOut    uint64 `protobuf:"varint,5,opt,name=bytes_out,json=bytesOut,proto3" json:"bytes_out,omitempty"`
+	// subscribers is the number of the subscribers matched by the last message published to the topic.
+	Subscribers          uint64   `protobuf:"varint,6,opt,name=subscribers,proto3" json:"subscribers,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *TopicStats) Reset()         { *m = TopicStats{} }
+func (m *TopicStats) String() string { return proto.CompactTextString(m) }
+func (*TopicStats) ProtoMessage()    {}
+func (*TopicStats) Descriptor() ([]byte, []int) {
+	return fileDescriptor_73a7fc70dcc2027c, []int{34}
+}
+
+func (m *TopicStats) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_TopicStats.Unmarshal(m, b)
+}
+func (m *TopicStats) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_TopicStats.Marshal(b, m, deterministic)
+}
+func (m *TopicStats) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_TopicStats.Merge(m, src)
+}
+func (m *TopicStats) XXX_Size() int {
+	return xxx_messageInfo_TopicStats.Size(m)
+}
+func (m *TopicStats) XXX_DiscardUnknown() {
+	xxx_messageInfo_TopicStats.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_TopicStats proto.InternalMessageInfo
+
+func (m *TopicStats) GetTopicName() string {
+	if m != nil {
+		return m.TopicName
+	}
+	return ""
+}
+
+func (m *TopicStats) GetMessagesIn() uint64 {
+	if m != nil {
+		return m.MessagesIn
+	}
+	return 0
+}
+
+func (m *TopicStats) GetMessagesOut() uint64 {
+	if m != nil {
+		return m.MessagesOut
+	}
+	return 0
+}
+
+func (m *TopicStats) GetBytesIn() uint64 {
+	if m != nil {
+		return m.BytesIn
+	}
+	return 0
+}
+
+func (m *TopicStats) GetBytesOut() uint64 {
+	if m != nil {
+		return m.BytesOut
+	}
+	return 0
+}
+
+func (m *TopicStats) GetSubscribers() uint64 {
+	if m != nil {
+		return m.Subscribers
+	}
+	return 0
+}
+
+type TopTopicsResponse struct {
+	Topics               []*TopicStats `protobuf:"bytes,1,rep,name=topics,proto3" json:"topics,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}      `json:"-"`
+	XXX_unrecognized     []byte        `json:"-"`
+	XXX_sizecache        int32         `json:"-"`
+}
+
+func (m *TopTopicsResponse) Reset()         { *m = TopTopicsResponse{} }
+func (m *TopTopicsResponse) String() string { return proto.CompactTextString(m) }
+func (*TopTopicsResponse) ProtoMessage()    {}
+func (*TopTopicsResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_73a7fc70dcc2027c, []int{35}
+}
+
+func (m *TopTopicsResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_TopTopicsResponse.Unmarshal(m, b)
+}
+func (m *TopTopicsResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_TopTopicsResponse.Marshal(b, m, deterministic)
+}
+func (m *TopTopicsResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_TopTopicsResponse.Merge(m, src)
+}
+func (m *TopTopicsResponse) XXX_Size() int {
+	return xxx_messageInfo_TopTopicsResponse.Size(m)
+}
+func (m *TopTopicsResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_TopTopicsResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_TopTopicsResponse proto.InternalMessageInfo
+
+func (m *TopTopicsResponse) GetTopics() []*TopicStats {
+	if m != nil {
+		return m.Topics
+	}
+	return nil
+}
+
+type ListPluginsRequest struct {
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ListPluginsRequest) Reset()         { *m = ListPluginsRequest{} }
+func (m *ListPluginsRequest) String() string { return proto.CompactTextString(m) }
+func (*ListPluginsRequest) ProtoMessage()    {}
+func (*ListPluginsRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_73a7fc70dcc2027c, []int{36}
+}
+
+func (m *ListPluginsRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ListPluginsRequest.Unmarshal(m, b)
+}
+func (m *ListPluginsRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ListPluginsRequest.Marshal(b, m, deterministic)
+}
+func (m *ListPluginsRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ListPluginsRequest.Merge(m, src)
+}
+func (m *ListPluginsRequest) XXX_Size() int {
+	return xxx_messageInfo_ListPluginsRequest.Size(m)
+}
+func (m *ListPluginsRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_ListPluginsRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ListPluginsRequest proto.InternalMessageInfo
+
+type Plugin struct {
+	Name string `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	// requires is the names of the plugins required by the plugin.
+	Requires []string `protobuf:"bytes,2,rep,name=requires,proto3" json:"requires,omitempty"`
+	Loaded   bool     `protobuf:"varint,3,opt,name=loaded,proto3" json:"loaded,omitempty"`
+	// panics is the number of the recovered panics of the hooks of the plugin.
+	Panics               uint64   `protobuf:"varint,4,opt,name=panics,proto3" json:"panics,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Plugin) Reset()         { *m = Plugin{} }
+func (m *Plugin) String() string { return proto.CompactTextString(m) }
+func (*Plugin) ProtoMessage()    {}
+func (*Plugin) Descriptor() ([]byte, []int) {
+	return fileDescriptor_73a7fc70dcc2027c, []int{37}
+}
+
+func (m *Plugin) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Plugin.Unmarshal(m, b)
+}
+func (m *Plugin) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Plugin.Marshal(b, m, deterministic)
+}
+func (m *Plugin) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Plugin.Merge(m, src)
+}
+func (m *Plugin) XXX_Size() int {
+	return xxx_messageInfo_Plugin.Size(m)
+}
+func (m *Plugin) XXX_DiscardUnknown() {
+	xxx_messageInfo_Plugin.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Plugin proto.InternalMessageInfo
+
+func (m *Plugin) GetName() string {
+	if m != nil {
+		return m.Name
+	}
+	return ""
+}
+
+func (m *Plugin) GetRequires() []string {
+	if m != nil {
+		return m.Requires
+	}
+	return nil
+}
+
+func (m *Plugin) GetLoaded() bool {
+	if m != nil {
+		return m.Loaded
+	}
+	return false
+}
+
+func (m *Plugin) GetPanics() uint64 {
+	if m != nil {
+		return m.Panics
+	}
+	return 0
+}
+
+type ListPluginsResponse struct {
+	Plugins              []*Plugin `protobuf:"bytes,1,rep,name=plugins,proto3" json:"plugins,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}  `json:"-"`
+	XXX_unrecognized     []byte    `json:"-"`
+	XXX_sizecache        int32     `json:"-"`
+}
+
+func (m *ListPluginsResponse) Reset()         { *m = ListPluginsResponse{} }
+func (m *ListPluginsResponse) String() string { return proto.CompactTextString(m) }
+func (*ListPluginsResponse) ProtoMessage()    {}
+func (*ListPluginsResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_73a7fc70dcc2027c, []int{38}
+}
+
+func (m *ListPluginsResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ListPluginsResponse.Unmarshal(m, b)
+}
+func (m *ListPluginsResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ListPluginsResponse.Marshal(b, m, deterministic)
+}
+func (m *ListPluginsResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ListPluginsResponse.Merge(m, src)
+}
+func (m *ListPluginsResponse) XXX_Size() int {
+	return xxx_messageInfo_ListPluginsResponse.Size(m)
+}
+func (m *ListPluginsResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_ListPluginsResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ListPluginsResponse proto.InternalMessageInfo
+
+func (m *ListPluginsResponse) GetPlugins() []*Plugin {
+	if m != nil {
+		return m.Plugins
+	}
+	return nil
+}
+
+type LoadPluginRequest struct {
+	Name                 string   `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *LoadPluginRequest) Reset()         { *m = LoadPluginRequest{} }
+func (m *LoadPluginRequest) String() string { return proto.CompactTextString(m) }
+func (*LoadPluginRequest) ProtoMessage()    {}
+func (*LoadPluginRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_73a7fc70dcc2027c, []int{39}
+}
+
+func (m *LoadPluginRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_LoadPluginRequest.Unmarshal(m, b)
+}
+func (m *LoadPluginRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_LoadPluginRequest.Marshal(b, m, deterministic)
+}
+func (m *LoadPluginRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_LoadPluginRequest.Merge(m, src)
+}
+func (m *LoadPluginRequest) XXX_Size() int {
+	return xxx_messageInfo_LoadPluginRequest.Size(m)
+}
+func (m *LoadPluginRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_LoadPluginRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_LoadPluginRequest proto.InternalMessageInfo
+
+func (m *LoadPluginRequest) GetName() string {
+	if m != nil {
+		return m.Name
+	}
+	return ""
+}
+
+type UnloadPluginRequest struct {
+	Name                 string   `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *UnloadPluginRequest) Reset()         { *m = UnloadPluginRequest{} }
+func (m *UnloadPluginRequest) String() string { return proto.CompactTextString(m) }
+func (*UnloadPluginRequest) ProtoMessage()    {}
+func (*UnloadPluginRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_73a7fc70dcc2027c, []int{40}
+}
+
+func (m *UnloadPluginRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_UnloadPluginRequest.Unmarshal(m, b)
+}
+func (m *UnloadPluginRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_UnloadPluginRequest.Marshal(b, m, deterministic)
+}
+func (m *UnloadPluginRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_UnloadPluginRequest.Merge(m, src)
+}
+func (m *UnloadPluginRequest) XXX_Size() int {
+	return xxx_messageInfo_UnloadPluginRequest.Size(m)
+}
+func (m *UnloadPluginRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_UnloadPluginRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_UnloadPluginRequest proto.InternalMessageInfo
+
+func (m *UnloadPluginRequest) GetName() string {
+	if m != nil {
+		return m.Name
+	}
+	return ""
+}
+
+func init() {
+	proto.RegisterEnum("gmqtt.admin.ClientEvent_Type", ClientEvent_Type_name, ClientEvent_Type_value)
+	proto.RegisterEnum("gmqtt.admin.SubscriptionEvent_Type", SubscriptionEvent_Type_name, SubscriptionEvent_Type_value)
+	proto.RegisterEnum("gmqtt.admin.Ban_Kind", Ban_Kind_name, Ban_Kind_value)
+	proto.RegisterEnum("gmqtt.admin.TraceRequest_Kind", TraceRequest_Kind_name, TraceRequest_Kind_value)
+	proto.RegisterEnum("gmqtt.admin.TraceEvent_Hop", TraceEvent_Hop_name, TraceEvent_Hop_value)
+	proto.RegisterType((*Empty)(nil), "gmqtt.admin.Empty")
+	proto.RegisterType((*Pager)(nil), "gmqtt.admin.Pager")
+	proto.RegisterType((*Client)(nil), "gmqtt.admin.Client")
+	proto.RegisterMapType((map[string]uint64)(nil), "gmqtt.admin.Client.PacketsReceivedEntry")
+	proto.RegisterMapType((map[string]uint64)(nil), "gmqtt.admin.Client.PacketsSentEntry")
+	proto.RegisterType((*ListClientsRequest)(nil), "gmqtt.admin.ListClientsRequest")
+	proto.RegisterType((*ListClientsResponse)(nil), "gmqtt.admin.ListClientsResponse")
+	proto.RegisterType((*GetClientRequest)(nil), "gmqtt.admin.GetClientRequest")
+	proto.RegisterType((*CloseClientRequest)(nil), "gmqtt.admin.CloseClientRequest")
+	proto.RegisterType((*Subscription)(nil), "gmqtt.admin.Subscription")
+	proto.RegisterType((*ListSubscriptionsRequest)(nil), "gmqtt.admin.ListSubscriptionsRequest")
+	proto.RegisterType((*ListSubscriptionsResponse)(nil), "gmqtt.admin.ListSubscriptionsResponse")
+	proto.RegisterType((*SubscribeRequest)(nil), "gmqtt.admin.SubscribeRequest")
+	proto.RegisterType((*UnsubscribeRequest)(nil), "gmqtt.admin.UnsubscribeRequest")
+	proto.RegisterType((*GetSubscriptionStatsRequest)(nil), "gmqtt.admin.GetSubscriptionStatsRequest")
+	proto.RegisterType((*SubscriptionStats)(nil), "gmqtt.admin.SubscriptionStats")
+	proto.RegisterType((*PublishRequest)(nil), "gmqtt.admin.PublishRequest")
+	proto.RegisterType((*RetainedMessage)(nil), "gmqtt.admin.RetainedMessage")
+	proto.RegisterType((*ListRetainedRequest)(nil), "gmqtt.admin.ListRetainedRequest")
+	proto.RegisterType((*ListRetainedResponse)(nil), "gmqtt.admin.ListRetainedResponse")
+	proto.RegisterType((*WatchClientsRequest)(nil), "gmqtt.admin.WatchClientsRequest")
+	proto.RegisterType((*ClientEvent)(nil), "gmqtt.admin.ClientEvent")
+	proto.RegisterType((*WatchSubscriptionsRequest)(nil), "gmqtt.admin.WatchSubscriptionsRequest")
+	proto.RegisterType((*SubscriptionEvent)(nil), "gmqtt.admin.SubscriptionEvent")
+	proto.RegisterType((*Ban)(nil), "gmqtt.admin.Ban")
+	proto.RegisterType((*ListBansRequest)(nil), "gmqtt.admin.ListBansRequest")
+	proto.RegisterType((*ListBansResponse)(nil), "gmqtt.admin.ListBansResponse")
+	proto.RegisterType((*BanRequest)(nil), "gmqtt.admin.BanRequest")
+	proto.RegisterType((*UnbanRequest)(nil), "gmqtt.admin.UnbanRequest")
+	proto.RegisterType((*SetLogLevelRequest)(nil), "gmqtt.admin.SetLogLevelRequest")
+	proto.RegisterType((*ListLogLevelsRequest)(nil), "gmqtt.admin.ListLogLevelsRequest")
+	proto.RegisterType((*LogLevel)(nil), "gmqtt.admin.LogLevel")
+	proto.RegisterType((*ListLogLevelsResponse)(nil), "gmqtt.admin.ListLogLevelsResponse")
+	proto.RegisterType((*TraceRequest)(nil), "gmqtt.admin.TraceRequest")
+	proto.RegisterType((*TraceEvent)(nil), "gmqtt.admin.TraceEvent")
+	proto.RegisterType((*TopTopicsRequest)(nil), "gmqtt.admin.TopTopicsRequest")
+	proto.RegisterType((*TopicStats)(nil), "gmqtt.admin.TopicStats")
+	proto.RegisterType((*TopTopicsResponse)(nil), "gmqtt.admin.TopTopicsResponse")
+	proto.RegisterType((*ListPluginsRequest)(nil), "gmqtt.admin.ListPluginsRequest")
+	proto.RegisterType((*Plugin)(nil), "gmqtt.admin.Plugin")
+	proto.RegisterType((*ListPluginsResponse)(nil), "gmqtt.admin.ListPluginsResponse")
+	proto.RegisterType((*LoadPluginRequest)(nil), "gmqtt.admin.LoadPluginRequest")
+	proto.RegisterType((*UnloadPluginRequest)(nil), "gmqtt.admin.UnloadPluginRequest")
+}
+
+func init() { proto.RegisterFile("admin.proto", fileDescriptor_73a7fc70dcc2027c) }
+
+var fileDescriptor_73a7fc70dcc2027c = []byte{
+	// 2042 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xac, 0x59, 0xeb, 0x72, 0xdb, 0xc6,
+	0x15, 0x2e, 0x78, 0x13, 0x71, 0x48, 0xca, 0xd4, 0x5a, 0x72, 0x28, 0xfa, 0xc6, 0xac, 0x9d, 0x44,
+	0x99, 0x36, 0x94, 0xa3, 0xcc, 0xb4, 0x1e, 0x67, 0xe2, 0x54, 0xbc, 0xd8, 0x61, 0xa3, 0x48, 0xcc,
+	0x92, 0x72, 0x3b, 0x99, 0x4e, 0x59, 0x90, 0x58, 0x53, 0x18, 0x83, 0x00, 0x04, 0x2c, 0xd5, 0x91,
+	0x9f, 0xa3, 0x7f, 0xfb, 0x0a, 0x7d, 0x8e, 0xb6, 0xbf, 0x3a, 0x7d, 0xa2, 0xce, 0x5e, 0x00, 0x01,
+	0x20, 0x28, 0x4b, 0x6d, 0xfe, 0x48, 0xd8, 0xb3, 0xdf, 0x9e, 0x3d, 0xe7, 0xec, 0xb9, 0x4a, 0x50,
+	0x31, 0xcc, 0x85, 0xe5, 0xb4, 0x3d, 0xdf, 0x65, 0x2e, 0xaa, 0xcc, 0x17, 0xe7, 0x8c, 0xb5, 0x05,
+	0x09, 0x6f, 0x40, 0xb1, 0xbf, 0xf0, 0xd8, 0x25, 0x7e, 0x0e, 0xc5, 0xa1, 0x31, 0xa7, 0x3e, 0x42,
+	0x50, 0xf0, 0x8c, 0x39, 0x6d, 0x68, 0x2d, 0x6d, 0xaf, 0x46, 0xc4, 0x37, 0xba, 0x0f, 0x3a, 0xff,
+	0x3d, 0x09, 0xac, 0xf7, 0xb4, 0x91, 0x13, 0x1b, 0x65, 0x4e, 0x18, 0x59, 0xef, 0x29, 0xfe, 0x57,
+	0x09, 0x4a, 0x5d, 0xdb, 0xa2, 0x0e, 0xe3, 0xb8, 0x99, 0xf8, 0x9a, 0x58, 0xa6, 0x60, 0xa0, 0x93,
+	0xb2, 0x24, 0x0c, 0x4c, 0xd4, 0x84, 0xf2, 0x32, 0xa0, 0xbe, 0x63, 0x2c, 0x24, 0x0f, 0x9d, 0x44,
+	0x6b, 0xf4, 0x10, 0xe0, 0x1d, 0xa5, 0xde, 0xc4, 0xb0, 0xad, 0x0b, 0xda, 0xc8, 0x8b, 0x1b, 0x74,
+	0x4e, 0x39, 0xe4, 0x04, 0xf4, 0x04, 0x6a, 0x33, 0x9b, 0x1a, 0xce, 0x24, 0xa0, 0x41, 0x60, 0xb9,
+	0x4e, 0xa3, 0xd0, 0xd2, 0xf6, 0xca, 0xa4, 0x2a, 0x88, 0x23, 0x49, 0x43, 0x0f, 0x40, 0x9f, 0xb9,
+	0x8e, 0x43, 0x67, 0x8c, 0x9a, 0x8d, 0xa2, 0x00, 0x5c, 0x11, 0xd0, 0x63, 0xa8, 0xf8, 0x74, 0xe1,
+	0x32, 0x3a, 0x31, 0x4c, 0xd3, 0x6f, 0x94, 0x84, 0x00, 0x20, 0x49, 0x87, 0xa6, 0xe9, 0x73, 0x11,
+	0x6c, 0x77, 0x66, 0xd8, 0x72, 0x7f, 0x43, 0xec, 0xeb, 0x82, 0x22, 0xb6, 0x3f, 0x86, 0x6a, 0xc4,
+	0x6c, 0x62, 0xb0, 0x46, 0xb9, 0xa5, 0xed, 0xe5, 0x49, 0x25, 0xa2, 0x1d, 0x32, 0xf4, 0x19, 0xdc,
+	0x31, 0xad, 0x20, 0x81, 0xd2, 0x05, 0x6a, 0x33, 0x4e, 0x3e, 0x64, 0x9c, 0x97, 0xe5, 0xbc, 0xb5,
+	0xad, 0xf9, 0x19, 0x9b, 0xd8, 0xd4, 0x69, 0x40, 0x4b, 0xdb, 0x2b, 0x90, 0x4a, 0x48, 0x3b, 0xa2,
+	0x0e, 0xc2, 0x50, 0x33, 0xfe, 0x62, 0x58, 0x6c, 0xe2, 0x53, 0x5b, 0x60, 0x2a, 0x12, 0x23, 0x88,
+	0x84, 0xda, 0x0a, 0xb3, 0x08, 0xe6, 0x93, 0xf3, 0x25, 0x5d, 0x52, 0x81, 0xa9, 0x4a, 0xcc, 0x22,
+	0x98, 0xff, 0xc8, 0x69, 0x1c, 0xf3, 0x14, 0x6a, 0xc1, 0x72, 0x1a, 0xcc, 0x7c, 0xcb, 0x63, 0x96,
+	0xeb, 0x04, 0x8d, 0x9a, 0xc0, 0x24, 0x89, 0xe8, 0x13, 0xd8, 0x9c, 0x5e, 0x32, 0x1a, 0x4c, 0x7c,
+	0x3a, 0xa3, 0xd6, 0x05, 0x35, 0x1b, 0x9b, 0x12, 0x26, 0xa8, 0x44, 0x11, 0xb9, 0x89, 0x24, 0x2c,
+	0xa0, 0x0e, 0x6b, 0xdc, 0x11, 0x10, 0x5d, 0x50, 0x46, 0xfc, 0xf5, 0x47, 0x50, 0xf7, 0x8c, 0xd9,
+	0x3b, 0xca, 0x62, 0x7c, 0xea, 0xad, 0xfc, 0x5e, 0xe5, 0x60, 0xaf, 0x1d, 0xf3, 0xb9, 0xb6, 0x74,
+	0x96, 0xf6, 0x50, 0x62, 0x43, 0xee, 0x7d, 0x87, 0xf9, 0x97, 0xe4, 0x8e, 0x97, 0xa4, 0xa2, 0xd7,
+	0x50, 0x0d, 0x99, 0x8a, 0x5b, 0xb7, 0x04, 0xc3, 0xa7, 0xd7, 0x30, 0xe4, 0xb2, 0x48, 0x66, 0x15,
+	0xef, 0x8a, 0x82, 0x5a, 0x50, 0xb5, 0x8d, 0x80, 0x4d, 0x02, 0x4a, 0x1d, 0xfe, 0x34, 0x48, 0x3c,
+	0x0d, 0x70, 0xda, 0x88, 0x52, 0xe7, 0x90, 0x35, 0x3b, 0xb0, 0x9d, 0x25, 0x13, 0xaa, 0x43, 0xfe,
+	0x1d, 0xbd, 0x54, 0xfe, 0xcc, 0x3f, 0xd1, 0x36, 0x14, 0x2f, 0x0c, 0x7b, 0x29, 0xfd, 0xb8, 0x40,
+	0xe4, 0xe2, 0x45, 0xee, 0xb9, 0xd6, 0x7c, 0x09, 0xf5, 0xb4, 0x18, 0xb7, 0x39, 0x8f, 0x5f, 0x02,
+	0x3a, 0xb2, 0x02, 0x26, 0x35, 0x0a, 0x08, 0x3d, 0x5f, 0xd2, 0x80, 0xa1, 0x3d, 0x28, 0xf2, 0x70,
+	0xf3, 0x05, 0x8f, 0xca, 0x01, 0x4a, 0x68, 0x2f, 0xc2, 0x96, 0x48, 0x00, 0xfe, 0x09, 0xee, 0x26,
+	0xce, 0x07, 0x9e, 0xeb, 0x04, 0x14, 0x7d, 0x01, 0x1b, 0x32, 0x0e, 0x83, 0x86, 0x26, 0x0c, 0x78,
+	0x37, 0xc3, 0x80, 0x24, 0xc4, 0x70, 0xf9, 0x98, 0xcb, 0x0c, 0x5b, 0xc5, 0xba, 0x5c, 0xe0, 0x7d,
+	0xa8, 0xbf, 0xa6, 0x8a, 0x75, 0x28, 0xd9, 0x75, 0x11, 0x8f, 0xbf, 0x04, 0xd4, 0xb5, 0xdd, 0x80,
+	0xde, 0xe2, 0x48, 0x17, 0xaa, 0xa3, 0x98, 0x6b, 0xf2, 0x50, 0x61, 0xae, 0x67, 0xcd, 0x26, 0x6f,
+	0x2d, 0x9b, 0x29, 0x03, 0xe8, 0xa4, 0x22, 0x68, 0xaf, 0x04, 0x89, 0x9b, 0xf7, 0xdc, 0x0d, 0x94,
+	0xa8, 0xfc, 0x13, 0x1b, 0xd0, 0xe0, 0x46, 0x88, 0x33, 0x0a, 0x6e, 0x72, 0xfb, 0x95, 0x9d, 0x73,
+	0x1f, 0xb2, 0xb3, 0x0f, 0xbb, 0x19, 0x57, 0x28, 0x6b, 0x7f, 0x9b, 0x0e, 0x3a, 0x69, 0xf3, 0xdd,
+	0x04, 0xbb, 0xf8, 0xd1, 0x74, 0x3c, 0x66, 0xdb, 0xdf, 0x83, 0xba, 0x3a, 0x34, 0xa5, 0x37, 0x52,
+	0x67, 0x45, 0x8e, 0xdc, 0xed, 0xe4, 0xc0, 0x6f, 0x00, 0x9d, 0x3a, 0xc1, 0xad, 0xee, 0x7c, 0x02,
+	0xb5, 0xf8, 0x83, 0xc9, 0x3b, 0x75, 0x52, 0x8d, 0xbd, 0x58, 0x80, 0x5f, 0xc0, 0xfd, 0xd7, 0x34,
+	0x61, 0xbc, 0x11, 0x33, 0xd8, 0x8d, 0xde, 0x08, 0x5f, 0xc2, 0xd6, 0xca, 0x41, 0xb4, 0x0f, 0x77,
+	0x13, 0x92, 0x4f, 0xa4, 0xf9, 0x34, 0x11, 0x5e, 0x28, 0xb1, 0x35, 0xe6, 0x3b, 0xe8, 0x2b, 0xd8,
+	0x49, 0x1e, 0x98, 0x2d, 0x7d, 0x9f, 0xe7, 0x17, 0x19, 0x91, 0xdb, 0x89, 0xcd, 0xae, 0xdc, 0xc3,
+	0x7f, 0xd5, 0x60, 0x73, 0xb8, 0x9c, 0xda, 0x56, 0x70, 0x16, 0x8a, 0xfa, 0x10, 0x40, 0xaa, 0x2b,
+	0xca, 0x9a, 0x94, 0x55, 0x17, 0x94, 0x63, 0x5e, 0xd7, 0x1a, 0xb0, 0xe1, 0x19, 0x97, 0xb6, 0x6b,
+	0x98, 0x82, 0x71, 0x95, 0x84, 0xcb, 0xd0, 0x6b, 0xf3, 0x91, 0xd7, 0xf2, 0xfa, 0xe8, 0x53, 0x66,
+	0x58, 0x0e, 0x35, 0x55, 0x7d, 0x8b, 0xd6, 0x49, 0x8b, 0x14, 0x53, 0x16, 0xf9, 0x23, 0xdc, 0x21,
+	0x0a, 0xf8, 0x03, 0x0d, 0x02, 0x5e, 0xb0, 0x7f, 0x3e, 0xb1, 0xf0, 0x54, 0x66, 0x94, 0xf0, 0x86,
+	0x50, 0xf1, 0x1b, 0x04, 0xe6, 0xcd, 0xa3, 0xe9, 0x2d, 0x6c, 0x27, 0xef, 0x50, 0x81, 0xf4, 0x1c,
+	0xca, 0x0b, 0xa9, 0x51, 0x18, 0x43, 0x0f, 0x12, 0x4c, 0x52, 0x6a, 0x93, 0x08, 0xbd, 0x26, 0x82,
+	0x76, 0xe0, 0xee, 0xef, 0x0d, 0x36, 0x3b, 0x4b, 0xa6, 0x57, 0xfc, 0x77, 0x0d, 0x2a, 0x92, 0xd4,
+	0xbf, 0xe0, 0xa5, 0xe2, 0x4b, 0x28, 0xb0, 0x4b, 0x4f, 0xda, 0x6d, 0xf3, 0xe0, 0x61, 0x46, 0xaa,
+	0x14, 0xb8, 0xf6, 0xf8, 0xd2, 0xa3, 0x44, 0x40, 0xd1, 0x2f, 0xa1, 0x24, 0xdf, 0x43, 0x29, 0x9b,
+	0x99, 0x5f, 0x15, 0x04, 0x7f, 0x0b, 0x05, 0x7e, 0x14, 0xd5, 0x40, 0xef, 0x9e, 0x1c, 0x1f, 0xf7,
+	0xbb, 0xe3, 0x7e, 0xaf, 0xfe, 0x0b, 0x54, 0x87, 0x6a, 0x6f, 0x30, 0xba, 0xa2, 0x68, 0xe8, 0x1e,
+	0xa0, 0x51, 0x7f, 0x34, 0x1a, 0x9c, 0x1c, 0x4f, 0xc6, 0x7d, 0xf2, 0xc3, 0xe0, 0xf8, 0x90, 0xd3,
+	0x73, 0xf8, 0x3e, 0xec, 0x0a, 0x3d, 0xb2, 0x32, 0x1c, 0xfe, 0x8f, 0x96, 0x8c, 0x10, 0xa9, 0xd3,
+	0x6f, 0x12, 0x3a, 0x3d, 0x59, 0x9b, 0x02, 0x56, 0x34, 0x4b, 0xb8, 0x5e, 0x2e, 0x15, 0xed, 0xdf,
+	0x40, 0x35, 0x1e, 0x29, 0xc2, 0x6f, 0xae, 0x4d, 0x30, 0x09, 0x38, 0xde, 0x53, 0x86, 0xd8, 0x04,
+	0x18, 0x9d, 0x76, 0x46, 0x5d, 0x32, 0xe8, 0x84, 0x96, 0x38, 0x3d, 0x8e, 0x51, 0x34, 0xfc, 0x0f,
+	0x0d, 0xf2, 0x1d, 0xc3, 0x41, 0x9f, 0x43, 0xe1, 0x9d, 0xe5, 0x98, 0x4a, 0x8d, 0x9d, 0xc4, 0x45,
+	0x1d, 0xc3, 0x69, 0x7f, 0x6f, 0x39, 0x26, 0x11, 0x90, 0x64, 0x91, 0xd5, 0x55, 0x91, 0x45, 0x9b,
+	0x90, 0x33, 0x98, 0x90, 0x33, 0x4f, 0x72, 0x06, 0xe3, 0xa8, 0xa5, 0xc3, 0x2c, 0x5b, 0x84, 0x5c,
+	0x9e, 0xc8, 0x05, 0x8f, 0xc5, 0xb7, 0xb6, 0xe1, 0x79, 0x96, 0x33, 0x57, 0xad, 0x64, 0xb4, 0xc6,
+	0x2f, 0xa1, 0xc0, 0x6f, 0x11, 0xaf, 0x77, 0x34, 0xe8, 0x1f, 0x8f, 0x27, 0x03, 0x2e, 0x73, 0x09,
+	0x72, 0x83, 0x61, 0x5d, 0x43, 0x65, 0x28, 0x74, 0x07, 0x3d, 0x52, 0xcf, 0xa1, 0x1d, 0xd8, 0x8a,
+	0x00, 0x93, 0xe1, 0xe1, 0x78, 0xdc, 0x27, 0xc7, 0xf5, 0x3c, 0xfe, 0x1a, 0xee, 0x70, 0x67, 0xef,
+	0x18, 0xce, 0xff, 0x50, 0xdf, 0x8f, 0xa1, 0x7e, 0x75, 0x58, 0x45, 0xc9, 0x53, 0x28, 0x4c, 0x8d,
+	0xa8, 0xca, 0xd4, 0xd3, 0x36, 0x21, 0x62, 0x77, 0x4d, 0x44, 0x58, 0x00, 0x1c, 0xa2, 0xe4, 0xf8,
+	0xbf, 0xad, 0xdb, 0x84, 0xb2, 0xb9, 0xf4, 0x8d, 0xc8, 0x17, 0x6a, 0x24, 0x5a, 0xe3, 0x13, 0xa8,
+	0x9e, 0x3a, 0xd3, 0x9f, 0xef, 0x32, 0xfc, 0x07, 0x40, 0x23, 0xca, 0x8e, 0xdc, 0xf9, 0x11, 0xbd,
+	0xa0, 0x76, 0xc8, 0xf6, 0x1e, 0x94, 0x16, 0xae, 0xb9, 0xb4, 0xc3, 0xb4, 0xa7, 0x56, 0x9c, 0x87,
+	0xcd, 0x71, 0x21, 0x0f, 0xb1, 0xe0, 0x54, 0x3e, 0x44, 0xf8, 0x42, 0xda, 0x32, 0x91, 0x0b, 0x7c,
+	0x4f, 0xe6, 0xa3, 0x90, 0x75, 0x14, 0x5a, 0xcf, 0xa1, 0x1c, 0xd2, 0x6e, 0x77, 0x0f, 0x7e, 0x05,
+	0x3b, 0x29, 0x8e, 0x51, 0x67, 0x56, 0x12, 0x88, 0xf0, 0xf9, 0x92, 0x76, 0x88, 0x94, 0x53, 0x20,
+	0xfc, 0x1e, 0xaa, 0x63, 0xdf, 0x98, 0x45, 0xb5, 0xf8, 0x20, 0x61, 0xc4, 0x47, 0x89, 0xc3, 0x71,
+	0xe0, 0x87, 0xad, 0xd9, 0xca, 0x76, 0x6b, 0x1d, 0x8a, 0xe3, 0x93, 0xe1, 0xa0, 0x5b, 0xd7, 0xf0,
+	0xbf, 0x73, 0x00, 0x82, 0xa7, 0xcc, 0x28, 0x08, 0x0a, 0xcc, 0x52, 0xd5, 0x25, 0x4f, 0xc4, 0x37,
+	0xfa, 0x02, 0xf2, 0x67, 0xae, 0x27, 0x18, 0x6f, 0x1e, 0xdc, 0x5f, 0x95, 0x46, 0x9c, 0x6c, 0x7f,
+	0xe7, 0x7a, 0x84, 0xe3, 0x92, 0xb9, 0x25, 0x9f, 0xca, 0x2d, 0xc9, 0x1a, 0x56, 0x48, 0xd7, 0x30,
+	0x55, 0xa9, 0x8a, 0xd9, 0x05, 0xb4, 0xb4, 0x5a, 0x40, 0xe5, 0x30, 0xc0, 0x6f, 0xda, 0x08, 0x27,
+	0x58, 0x4e, 0x18, 0x98, 0xf1, 0x72, 0x58, 0x4e, 0x96, 0xc3, 0x7b, 0x50, 0xf2, 0xa9, 0x11, 0xb8,
+	0x8e, 0x98, 0xe4, 0x74, 0xa2, 0x56, 0xf8, 0x15, 0xe4, 0xbf, 0x73, 0x3d, 0x54, 0x85, 0x32, 0xe9,
+	0x77, 0xfb, 0x83, 0x37, 0x22, 0x6b, 0x01, 0x94, 0x7e, 0x3c, 0xed, 0x9f, 0x8a, 0xcc, 0x5d, 0x03,
+	0xbd, 0xd7, 0x3f, 0x1a, 0xbc, 0xe9, 0x13, 0x9e, 0xb0, 0xb9, 0x15, 0x0f, 0xbb, 0xdf, 0xf7, 0x7b,
+	0xf5, 0x3c, 0xaa, 0xc0, 0x46, 0x8f, 0x9c, 0x0c, 0x87, 0xfd, 0x5e, 0xbd, 0x80, 0x5b, 0x50, 0x1f,
+	0xbb, 0xde, 0x98, 0x2b, 0x15, 0x25, 0x83, 0x2a, 0x68, 0x8e, 0x9a, 0xbe, 0x35, 0x07, 0xff, 0x53,
+	0x03, 0x10, 0xfb, 0xb2, 0xd1, 0xf9, 0x40, 0x61, 0x7f, 0x0c, 0x95, 0xb0, 0x04, 0x4e, 0x2c, 0x47,
+	0x35, 0x33, 0x10, 0x92, 0x06, 0xa2, 0x9f, 0x8e, 0x00, 0xee, 0x52, 0x26, 0x42, 0x3e, 0x32, 0x2a,
+	0xda, 0xc9, 0x92, 0xa1, 0x5d, 0x28, 0xcb, 0x29, 0xcf, 0x92, 0x73, 0x76, 0x81, 0x6c, 0x88, 0xf5,
+	0xc0, 0xe1, 0x56, 0x94, 0x5b, 0xfc, 0x68, 0x51, 0xec, 0x49, 0x2c, 0x3f, 0xd7, 0x82, 0x4a, 0xd4,
+	0x2a, 0xfa, 0x81, 0x78, 0x81, 0x02, 0x89, 0x93, 0x70, 0x0f, 0xb6, 0x62, 0xda, 0xaa, 0x00, 0xd8,
+	0x87, 0x92, 0x90, 0x3f, 0x0c, 0x80, 0x8f, 0x92, 0x5e, 0x13, 0xa9, 0x4e, 0x14, 0x0c, 0x6f, 0xcb,
+	0x11, 0x69, 0x68, 0x2f, 0xe7, 0xd6, 0x55, 0xd5, 0x3b, 0x83, 0x92, 0xa4, 0x70, 0xbf, 0x8c, 0x19,
+	0x47, 0x7c, 0x4b, 0xd7, 0x38, 0x5f, 0x5a, 0x3e, 0x0d, 0x1b, 0xd2, 0x68, 0xcd, 0xdf, 0x98, 0xbf,
+	0x35, 0x35, 0x55, 0x0e, 0x50, 0x2b, 0x4e, 0xf7, 0x0c, 0x87, 0x0b, 0x26, 0xad, 0xa0, 0x56, 0xb8,
+	0x27, 0x1b, 0xa2, 0xe8, 0xfe, 0xab, 0x11, 0xcb, 0x93, 0xa4, 0xcc, 0x11, 0x4b, 0xc2, 0x49, 0x88,
+	0xc1, 0x9f, 0xc1, 0xd6, 0x91, 0x6b, 0x98, 0x8a, 0xac, 0x9e, 0x3e, 0x43, 0x74, 0xfc, 0x39, 0xdc,
+	0x3d, 0x75, 0xec, 0x9b, 0x40, 0x0f, 0xfe, 0x56, 0x85, 0xe2, 0x21, 0xbf, 0x0d, 0x0d, 0xa1, 0x12,
+	0x1b, 0x03, 0xd1, 0xe3, 0x64, 0x52, 0x59, 0x19, 0x30, 0x9b, 0xad, 0xf5, 0x80, 0x68, 0xa6, 0xd1,
+	0xa3, 0xe1, 0x0f, 0x25, 0x5b, 0xa2, 0xf4, 0x50, 0xd8, 0xcc, 0x6a, 0x7e, 0x50, 0x07, 0x2a, 0xb1,
+	0x61, 0x30, 0x25, 0xd2, 0xea, 0x98, 0xd8, 0x4c, 0x16, 0x41, 0xf1, 0x47, 0x2a, 0x34, 0x85, 0xad,
+	0x95, 0xa9, 0x0b, 0x7d, 0xb2, 0x22, 0x7b, 0x56, 0x5b, 0xd4, 0xfc, 0xf4, 0x43, 0x30, 0xa5, 0xe8,
+	0x4b, 0xd0, 0xa3, 0x29, 0x2b, 0xa5, 0x68, 0x7a, 0xfa, 0xca, 0x94, 0xb1, 0x03, 0x95, 0xd8, 0xcc,
+	0x94, 0xd2, 0x73, 0x75, 0x9a, 0xca, 0xe4, 0xf1, 0x02, 0x36, 0xd4, 0x9c, 0x81, 0x92, 0x49, 0x34,
+	0x39, 0x7d, 0x64, 0x9e, 0xfd, 0x33, 0x6c, 0x67, 0xcd, 0x56, 0x68, 0x2f, 0xfd, 0x66, 0xeb, 0xc6,
+	0xaf, 0xe6, 0xa3, 0xb5, 0xed, 0x9b, 0xe4, 0x34, 0x82, 0x6a, 0xbc, 0x5b, 0x47, 0xab, 0xce, 0x93,
+	0x1a, 0x16, 0x9a, 0x1f, 0x5f, 0x83, 0x50, 0x66, 0x3f, 0x82, 0x6a, 0xbc, 0x35, 0x4f, 0x31, 0xcd,
+	0xe8, 0xda, 0x9b, 0x8d, 0x75, 0x7d, 0xf9, 0x33, 0x0d, 0xfd, 0x09, 0xd0, 0x6a, 0x83, 0x8c, 0x3e,
+	0x5d, 0xe5, 0x99, 0xe9, 0x2a, 0x8f, 0xae, 0xef, 0x8e, 0x9f, 0x69, 0xe8, 0x35, 0x94, 0xc3, 0x36,
+	0x0c, 0x3d, 0x58, 0x51, 0x2e, 0xd6, 0xda, 0x35, 0x1f, 0xae, 0xd9, 0x55, 0x6a, 0x1f, 0xc8, 0xb6,
+	0xf6, 0xa3, 0x95, 0xa6, 0xed, 0x9a, 0x17, 0xfe, 0x35, 0x14, 0x45, 0x23, 0x85, 0x76, 0x53, 0xbe,
+	0x35, 0xbd, 0xfe, 0x5c, 0x07, 0x2a, 0xb1, 0x7e, 0x29, 0xe5, 0x99, 0xab, 0x9d, 0x54, 0x26, 0x8f,
+	0x37, 0x50, 0x4b, 0xf4, 0x31, 0x68, 0xf5, 0x69, 0xd3, 0x5d, 0x53, 0x13, 0x5f, 0x07, 0x51, 0x76,
+	0xf8, 0x06, 0x8a, 0xa2, 0x41, 0x48, 0xe9, 0x14, 0x6f, 0x61, 0x9a, 0x1f, 0xad, 0xe9, 0x27, 0x9e,
+	0x69, 0xe8, 0x77, 0xa0, 0x47, 0x95, 0x25, 0x15, 0xb4, 0xe9, 0xfa, 0xda, 0x7c, 0xb4, 0x6e, 0x5b,
+	0x89, 0xa2, 0x72, 0xa7, 0xca, 0xef, 0x19, 0xb9, 0x33, 0x59, 0x79, 0x9a, 0xad, 0xf5, 0x00, 0xc5,
+	0xf1, 0xb7, 0x00, 0x57, 0xb9, 0x1e, 0x25, 0xef, 0x5f, 0x29, 0x02, 0x99, 0x66, 0xef, 0x41, 0x35,
+	0x5e, 0x04, 0x52, 0xd1, 0x91, 0x51, 0x1f, 0xb2, 0xb8, 0x74, 0xda, 0x3f, 0xfd, 0x6a, 0x6e, 0xb1,
+	0xb3, 0xe5, 0xb4, 0x3d, 0x73, 0x17, 0xfb, 0x3d, 0x7f, 0x61, 0xcc, 0xad, 0x59, 0x7f, 0x5f, 0x00,
+	0xf7, 0x65, 0x61, 0xda, 0x17, 0xf8, 0xaf, 0xc5, 0xcf, 0x69, 0x49, 0xfc, 0xc3, 0xe0, 0xab, 0xff,
+	0x0e, 0x00, 0xe2, 0x9f, 0xd9, 0x8f, 0x3f, 0x18, 0x00, 0x00,
+}
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ context.Context
+var _ grpc.ClientConn
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+const _ = grpc.SupportPackageIsVersion4
+
+// AdminClient is the client API for Admin service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://godoc.org/google.golang.org/grpc#ClientConn.NewStream.
+type AdminClient interface {
+	// ListClients returns the clients, including the offline clients which hold a session.
+	ListClients(ctx context.Context, in *ListClientsRequest, opts ...grpc.CallOption) (*ListClientsResponse, error)
+	// GetClient returns the client specified by the client id.
+	GetClient(ctx context.Context, in *GetClientRequest, opts ...grpc.CallOption) (*Client, error)
+	// CloseClient closes the connection of the client specified by the client id.
+	CloseClient(ctx context.Context, in *CloseClientRequest, opts ...grpc.CallOption) (*Empty, error)
+	// ListSubscriptions returns the subscriptions of the client.
+	ListSubscriptions(ctx context.Context, in *ListSubscriptionsRequest, opts ...grpc.CallOption) (*ListSubscriptionsResponse, error)
+	// Subscribe makes subscriptions for the client.
+	Subscribe(ctx context.Context, in *SubscribeRequest, opts ...grpc.CallOption) (*Empty, error)
+	// Unsubscribe removes the subscriptions of the client.
+	Unsubscribe(ctx context.Context, in *UnsubscribeRequest, opts ...grpc.CallOption) (*Empty, error)
+	// Publish publishes a message to the broker.
+	Publish(ctx context.Context, in *PublishRequest, opts ...grpc.CallOption) (*Empty, error)
+	// GetSubscriptionStats returns the statistics of the subscription store,
+	// or the statistics of the client if the client id is specified.
+	GetSubscriptionStats(ctx context.Context, in *GetSubscriptionStatsRequest, opts ...grpc.CallOption) (*SubscriptionStats, error)
+	// ListRetained returns the retained messages that match the topic filter.
+	ListRetained(ctx context.Context, in *ListRetainedRequest, opts ...grpc.CallOption) (*ListRetainedResponse, error)
+	// WatchClients streams the client events which happen after the call.
+	WatchClients(ctx context.Context, in *WatchClientsRequest, opts ...grpc.CallOption) (Admin_WatchClientsClient, error)
+	// WatchSubscriptions streams the subscription events which happen after the call.
+	WatchSubscriptions(ctx context.Context, in *WatchSubscriptionsRequest, opts ...grpc.CallOption) (Admin_WatchSubscriptionsClient, error)
+	// ListBans returns the active bans.
+	ListBans(ctx context.Context, in *ListBansRequest, opts ...grpc.CallOption) (*ListBansResponse, error)
+	// Ban bans the client id, IP address, network or client id pattern, and closes the matched online clients.
+	Ban(ctx context.Context, in *BanRequest, opts ...grpc.CallOption) (*Empty, error)
+	// Unban removes the ban.
+	Unban(ctx context.Context, in *UnbanRequest, opts ...grpc.CallOption) (*Empty, error)
+	// SetLogLevel changes the log level of the server, or overrides the log level of the module if the module is specified.
+	SetLogLevel(ctx context.Context, in *SetLogLevelRequest, opts ...grpc.CallOption) (*Empty, error)
+	// ListLogLevels returns the overridden log levels of the modules.
+	ListLogLevels(ctx context.Context, in *ListLogLevelsRequest, opts ...grpc.CallOption) (*ListLogLevelsResponse, error)
+	// Trace starts a message trace and streams every hop of the matched messages until the call is canceled.
+	Trace(ctx context.Context, in *TraceRequest, opts ...grpc.CallOption) (Admin_TraceClient, error)
+	// TopTopics returns the topics with the most messages in and out,
+	// the per-topic statistics must be enabled by gmqtt.Config.MaxTopicStats.
+	TopTopics(ctx context.Context, in *TopTopicsRequest, opts ...grpc.CallOption) (*TopTopicsResponse, error)
+	// ListPlugins returns the plugins in the load order.
+	ListPlugins(ctx context.Context, in *ListPluginsRequest, opts ...grpc.CallOption) (*ListPluginsResponse, error)
+	// LoadPlugin loads the unloaded plugin, the plugins it requires must have been loaded.
+	LoadPlugin(ctx context.Context, in *LoadPluginRequest, opts ...grpc.CallOption) (*Empty, error)
+	// UnloadPlugin unloads the plugin, the plugins requiring it must be unloaded first.
+	UnloadPlugin(ctx context.Context, in *UnloadPluginRequest, opts ...grpc.CallOption) (*Empty, error)
+}
+
+type adminClient struct {
+	cc *grpc.ClientConn
+}
+
+func NewAdminClient(cc *grpc.ClientConn) AdminClient {
+	return &adminClient{cc}
+}
+
+func (c *adminClient) ListClients(ctx context.Context, in *ListClientsRequest, opts ...grpc.CallOption) (*ListClientsResponse, error) {
+	out := new(ListClientsResponse)
+	err := c.cc.Invoke(ctx, "/gmqtt.admin.Admin/ListClients", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) GetClient(ctx context.Context, in *GetClientRequest, opts ...grpc.CallOption) (*Client, error) {
+	out := new(Client)
+	err := c.cc.Invoke(ctx, "/gmqtt.admin.Admin/GetClient", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) CloseClient(ctx context.Context, in *CloseClientRequest, opts ...grpc.CallOption) (*Empty, error) {
+	out := new(Empty)
+	err := c.cc.Invoke(ctx, "/gmqtt.admin.Admin/CloseClient", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) ListSubscriptions(ctx context.Context, in *ListSubscriptionsRequest, opts ...grpc.CallOption) (*ListSubscriptionsResponse, error) {
+	out := new(ListSubscriptionsResponse)
+	err := c.cc.Invoke(ctx, "/gmqtt.admin.Admin/ListSubscriptions", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) Subscribe(ctx context.Context, in *SubscribeRequest, opts ...grpc.CallOption) (*Empty, error) {
+	out := new(Empty)
+	err := c.cc.Invoke(ctx, "/gmqtt.admin.Admin/Subscribe", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) Unsubscribe(ctx context.Context, in *UnsubscribeRequest, opts ...grpc.CallOption) (*Empty, error) {
+	out := new(Empty)
+	err := c.cc.Invoke(ctx, "/gmqtt.admin.Admin/Unsubscribe", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) Publish(ctx context.Context, in *PublishRequest, opts ...grpc.CallOption) (*Empty, error) {
+	out := new(Empty)
+	err := c.cc.Invoke(ctx, "/gmqtt.admin.Admin/Publish", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) GetSubscriptionStats(ctx context.Context, in *GetSubscriptionStatsRequest, opts ...grpc.CallOption) (*SubscriptionStats, error) {
+	out := new(SubscriptionStats)
+	err := c.cc.Invoke(ctx, "/gmqtt.admin.Admin/GetSubscriptionStats", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) ListRetained(ctx context.Context, in *ListRetainedRequest, opts ...grpc.CallOption) (*ListRetainedResponse, error) {
+	out := new(ListRetainedResponse)
+	err := c.cc.Invoke(ctx, "/gmqtt.admin.Admin/ListRetained", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) WatchClients(ctx context.Context, in *WatchClientsRequest, opts ...grpc.CallOption) (Admin_WatchClientsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_Admin_serviceDesc.Streams[0], "/gmqtt.admin.Admin/WatchClients", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &adminWatchClientsClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Admin_WatchClientsClient interface {
+	Recv() (*ClientEvent, error)
+	grpc.ClientStream
+}
+
+type adminWatchClientsClient struct {
+	grpc.ClientStream
+}
+
+func (x *adminWatchClientsClient) Recv() (*ClientEvent, error) {
+	m := new(ClientEvent)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *adminClient) WatchSubscriptions(ctx context.Context, in *WatchSubscriptionsRequest, opts ...grpc.CallOption) (Admin_WatchSubscriptionsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_Admin_serviceDesc.Streams[1], "/gmqtt.admin.Admin/WatchSubscriptions", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &adminWatchSubscriptionsClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Admin_WatchSubscriptionsClient interface {
+	Recv() (*SubscriptionEvent, error)
+	grpc.ClientStream
+}
+
+type adminWatchSubscriptionsClient struct {
+	grpc.ClientStream
+}
+
+func (x *adminWatchSubscriptionsClient) Recv() (*SubscriptionEvent, error) {
+	m := new(SubscriptionEvent)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *adminClient) ListBans(ctx context.Context, in *ListBansRequest, opts ...grpc.CallOption) (*ListBansResponse, error) {
+	out := new(ListBansResponse)
+	err := c.cc.Invoke(ctx, "/gmqtt.admin.Admin/ListBans", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) Ban(ctx context.Context, in *BanRequest, opts ...grpc.CallOption) (*Empty, error) {
+	out := new(Empty)
+	err := c.cc.Invoke(ctx, "/gmqtt.admin.Admin/Ban", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) Unban(ctx context.Context, in *UnbanRequest, opts ...grpc.CallOption) (*Empty, error) {
+	out := new(Empty)
+	err := c.cc.Invoke(ctx, "/gmqtt.admin.Admin/Unban", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) SetLogLevel(ctx context.Context, in *SetLogLevelRequest, opts ...grpc.CallOption) (*Empty, error) {
+	out := new(Empty)
+	err := c.cc.Invoke(ctx, "/gmqtt.admin.Admin/SetLogLevel", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) ListLogLevels(ctx context.Context, in *ListLogLevelsRequest, opts ...grpc.CallOption) (*ListLogLevelsResponse, error) {
+	out := new(ListLogLevelsResponse)
+	err := c.cc.Invoke(ctx, "/gmqtt.admin.Admin/ListLogLevels", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) Trace(ctx context.Context, in *TraceRequest, opts ...grpc.CallOption) (Admin_TraceClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_Admin_serviceDesc.Streams[2], "/gmqtt.admin.Admin/Trace", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &adminTraceClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Admin_TraceClient interface {
+	Recv() (*TraceEvent, error)
+	grpc.ClientStream
+}
+
+type adminTraceClient struct {
+	grpc.ClientStream
+}
+
+func (x *adminTraceClient) Recv() (*TraceEvent, error) {
+	m := new(TraceEvent)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *adminClient) TopTopics(ctx context.Context, in *TopTopicsRequest, opts ...grpc.CallOption) (*TopTopicsResponse, error) {
+	out := new(TopTopicsResponse)
+	err := c.cc.Invoke(ctx, "/gmqtt.admin.Admin/TopTopics", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) ListPlugins(ctx context.Context, in *ListPluginsRequest, opts ...grpc.CallOption) (*ListPluginsResponse, error) {
+	out := new(ListPluginsResponse)
+	err := c.cc.Invoke(ctx, "/gmqtt.admin.Admin/ListPlugins", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) LoadPlugin(ctx context.Context, in *LoadPluginRequest, opts ...grpc.CallOption) (*Empty, error) {
+	out := new(Empty)
+	err := c.cc.Invoke(ctx, "/gmqtt.admin.Admin/LoadPlugin", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) UnloadPlugin(ctx context.Context, in *UnloadPluginRequest, opts ...grpc.CallOption) (*Empty, error) {
+	out := new(Empty)
+	err := c.cc.Invoke(ctx, "/gmqtt.admin.Admin/UnloadPlugin", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// AdminServer is the server API for Admin service.
+type AdminServer interface {
+	// ListClients returns the clients, including the offline clients which hold a session.
+	ListClients(context.Context, *ListClientsRequest) (*ListClientsResponse, error)
+	// GetClient returns the client specified by the client id.
+	GetClient(context.Context, *GetClientRequest) (*Client, error)
+	// CloseClient closes the connection of the client specified by the client id.
+	CloseClient(context.Context, *CloseClientRequest) (*Empty, error)
+	// ListSubscriptions returns the subscriptions of the client.
+	ListSubscriptions(context.Context, *ListSubscriptionsRequest) (*ListSubscriptionsResponse, error)
+	// Subscribe makes subscriptions for the client.
+	Subscribe(context.Context, *SubscribeRequest) (*Empty, error)
+	// Unsubscribe removes the subscriptions of the client.
+	Unsubscribe(context.Context, *UnsubscribeRequest) (*Empty, error)
+	// Publish publishes a message to the broker.
+	Publish(context.Context, *PublishRequest) (*Empty, error)
+	// GetSubscriptionStats returns the statistics of the subscription store,
+	// or the statistics of the client if the client id is specified.
+	GetSubscriptionStats(context.Context, *GetSubscriptionStatsRequest) (*SubscriptionStats, error)
+	// ListRetained returns the retained messages that match the topic filter.
+	ListRetained(context.Context, *ListRetainedRequest) (*ListRetainedResponse, error)
+	// WatchClients streams the client events which happen after the call.
+	WatchClients(*WatchClientsRequest, Admin_WatchClientsServer) error
+	// WatchSubscriptions streams the subscription events which happen after the call.
+	WatchSubscriptions(*WatchSubscriptionsRequest, Admin_WatchSubscriptionsServer) error
+	// ListBans returns the active bans.
+	ListBans(context.Context, *ListBansRequest) (*ListBansResponse, error)
+	// Ban bans the client id, IP address, network or client id pattern, and closes the matched online clients.
+	Ban(context.Context, *BanRequest) (*Empty, error)
+	// Unban removes the ban.
+	Unban(context.Context, *UnbanRequest) (*Empty, error)
+	// SetLogLevel changes the log level of the server, or overrides the log level of the module if the module is specified.
+	SetLogLevel(context.Context, *SetLogLevelRequest) (*Empty, error)
+	// ListLogLevels returns the overridden log levels of the modules.
+	ListLogLevels(context.Context, *ListLogLevelsRequest) (*ListLogLevelsResponse, error)
+	// Trace starts a message trace and streams every hop of the matched messages until the call is canceled.
+	Trace(*TraceRequest, Admin_TraceServer) error
+	// TopTopics returns the topics with the most messages in and out,
+	// the per-topic statistics must be enabled by gmqtt.Config.MaxTopicStats.
+	TopTopics(context.Context, *TopTopicsRequest) (*TopTopicsResponse, error)
+	// ListPlugins returns the plugins in the load order.
+	ListPlugins(context.Context, *ListPluginsRequest) (*ListPluginsResponse, error)
+	// LoadPlugin loads the unloaded plugin, the plugins it requires must have been loaded.
+	LoadPlugin(context.Context, *LoadPluginRequest) (*Empty, error)
+	// UnloadPlugin unloads the plugin, the plugins requiring it must be unloaded first.
+	UnloadPlugin(context.Context, *UnloadPluginRequest) (*Empty, error)
+}
+
+// UnimplementedAdminServer can be embedded to have forward compatible implementations.
+type UnimplementedAdminServer struct {
+}
+
+func (*UnimplementedAdminServer) ListClients(ctx context.Context, req *ListClientsRequest) (*ListClientsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListClients not implemented")
+}
+func (*UnimplementedAdminServer) GetClient(ctx context.Context, req *GetClientRequest) (*Client, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetClient not implemented")
+}
+func (*UnimplementedAdminServer) CloseClient(ctx context.Context, req *CloseClientRequest) (*Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CloseClient not implemented")
+}
+func (*UnimplementedAdminServer) ListSubscriptions(ctx context.Context, req *ListSubscriptionsRequest) (*ListSubscriptionsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListSubscriptions not implemented")
+}
+func (*UnimplementedAdminServer) Subscribe(ctx context.Context, req *SubscribeRequest) (*Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Subscribe not implemented")
+}
+func (*UnimplementedAdminServer) Unsubscribe(ctx context.Context, req *UnsubscribeRequest) (*Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Unsubscribe not implemented")
+}
+func (*UnimplementedAdminServer) Publish(ctx context.Context, req *PublishRequest) (*Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Publish not implemented")
+}
+func (*UnimplementedAdminServer) GetSubscriptionStats(ctx context.Context, req *GetSubscriptionStatsRequest) (*SubscriptionStats, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetSubscriptionStats not implemented")
+}
+func (*UnimplementedAdminServer) ListRetained(ctx context.Context, req *ListRetainedRequest) (*ListRetainedResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListRetained not implemented")
+}
+func (*UnimplementedAdminServer) WatchClients(req *WatchClientsRequest, srv Admin_WatchClientsServer) error {
+	return status.Errorf(codes.Unimplemented, "method WatchClients not implemented")
+}
+func (*UnimplementedAdminServer) WatchSubscriptions(req *WatchSubscriptionsRequest, srv Admin_WatchSubscriptionsServer) error {
+	return status.Errorf(codes.Unimplemented, "method WatchSubscriptions not implemented")
+}
+func (*UnimplementedAdminServer) ListBans(ctx context.Context, req *ListBansRequest) (*ListBansResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListBans not implemented")
+}
+func (*UnimplementedAdminServer) Ban(ctx context.Context, req *BanRequest) (*Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Ban not implemented")
+}
+func (*UnimplementedAdminServer) Unban(ctx context.Context, req *UnbanRequest) (*Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Unban not implemented")
+}
+func (*UnimplementedAdminServer) SetLogLevel(ctx context.Context, req *SetLogLevelRequest) (*Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetLogLevel not implemented")
+}
+func (*UnimplementedAdminServer) ListLogLevels(ctx context.Context, req *ListLogLevelsRequest) (*ListLogLevelsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListLogLevels not implemented")
+}
+func (*UnimplementedAdminServer) Trace(req *TraceRequest, srv Admin_TraceServer) error {
+	return status.Errorf(codes.Unimplemented, "method Trace not implemented")
+}
+func (*UnimplementedAdminServer) TopTopics(ctx context.Context, req *TopTopicsRequest) (*TopTopicsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method TopTopics not implemented")
+}
+func (*UnimplementedAdminServer) ListPlugins(ctx context.Context, req *ListPluginsRequest) (*ListPluginsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListPlugins not implemented")
+}
+func (*UnimplementedAdminServer) LoadPlugin(ctx context.Context, req *LoadPluginRequest) (*Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method LoadPlugin not implemented")
+}
+func (*UnimplementedAdminServer) UnloadPlugin(ctx context.Context, req *UnloadPluginRequest) (*Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UnloadPlugin not implemented")
+}
+
+func RegisterAdminServer(s *grpc.Server, srv AdminServer) {
+	s.RegisterService(&_Admin_serviceDesc, srv)
+}
+
+func _Admin_ListClients_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListClientsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).ListClients(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/gmqtt.admin.Admin/ListClients",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).ListClients(ctx, req.(*ListClientsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_GetClient_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetClientRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).GetClient(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/gmqtt.admin.Admin/GetClient",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).GetClient(ctx, req.(*GetClientRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_CloseClient_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CloseClientRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).CloseClient(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/gmqtt.admin.Admin/CloseClient",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).CloseClient(ctx, req.(*CloseClientRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_ListSubscriptions_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListSubscriptionsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).ListSubscriptions(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/gmqtt.admin.Admin/ListSubscriptions",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).ListSubscriptions(ctx, req.(*ListSubscriptionsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_Subscribe_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SubscribeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).Subscribe(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/gmqtt.admin.Admin/Subscribe",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).Subscribe(ctx, req.(*SubscribeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_Unsubscribe_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UnsubscribeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).Unsubscribe(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/gmqtt.admin.Admin/Unsubscribe",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).Unsubscribe(ctx, req.(*UnsubscribeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_Publish_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PublishRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).Publish(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/gmqtt.admin.Admin/Publish",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).Publish(ctx, req.(*PublishRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_GetSubscriptionStats_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetSubscriptionStatsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).GetSubscriptionStats(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/gmqtt.admin.Admin/GetSubscriptionStats",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).GetSubscriptionStats(ctx, req.(*GetSubscriptionStatsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_ListRetained_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListRetainedRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).ListRetained(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/gmqtt.admin.Admin/ListRetained",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).ListRetained(ctx, req.(*ListRetainedRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_WatchClients_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchClientsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(AdminServer).WatchClients(m, &adminWatchClientsServer{stream})
+}
+
+type Admin_WatchClientsServer interface {
+	Send(*ClientEvent) error
+	grpc.ServerStream
+}
+
+type adminWatchClientsServer struct {
+	grpc.ServerStream
+}
+
+func (x *adminWatchClientsServer) Send(m *ClientEvent) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Admin_WatchSubscriptions_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchSubscriptionsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(AdminServer).WatchSubscriptions(m, &adminWatchSubscriptionsServer{stream})
+}
+
+type Admin_WatchSubscriptionsServer interface {
+	Send(*SubscriptionEvent) error
+	grpc.ServerStream
+}
+
+type adminWatchSubscriptionsServer struct {
+	grpc.ServerStream
+}
+
+func (x *adminWatchSubscriptionsServer) Send(m *SubscriptionEvent) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Admin_ListBans_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListBansRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).ListBans(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/gmqtt.admin.Admin/ListBans",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).ListBans(ctx, req.(*ListBansRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_Ban_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BanRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).Ban(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/gmqtt.admin.Admin/Ban",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).Ban(ctx, req.(*BanRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_Unban_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UnbanRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).Unban(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/gmqtt.admin.Admin/Unban",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).Unban(ctx, req.(*UnbanRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_SetLogLevel_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetLogLevelRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).SetLogLevel(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/gmqtt.admin.Admin/SetLogLevel",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).SetLogLevel(ctx, req.(*SetLogLevelRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_ListLogLevels_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListLogLevelsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).ListLogLevels(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/gmqtt.admin.Admin/ListLogLevels",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).ListLogLevels(ctx, req.(*ListLogLevelsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_Trace_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(TraceRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(AdminServer).Trace(m, &adminTraceServer{stream})
+}
+
+type Admin_TraceServer interface {
+	Send(*TraceEvent) error
+	grpc.ServerStream
+}
+
+type adminTraceServer struct {
+	grpc.ServerStream
+}
+
+func (x *adminTraceServer) Send(m *TraceEvent) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Admin_TopTopics_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TopTopicsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).TopTopics(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/gmqtt.admin.Admin/TopTopics",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).TopTopics(ctx, req.(*TopTopicsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_ListPlugins_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListPluginsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).ListPlugins(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/gmqtt.admin.Admin/ListPlugins",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).ListPlugins(ctx, req.(*ListPluginsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_LoadPlugin_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(LoadPluginRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).LoadPlugin(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/gmqtt.admin.Admin/LoadPlugin",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).LoadPlugin(ctx, req.(*LoadPluginRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_UnloadPlugin_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UnloadPluginRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).UnloadPlugin(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/gmqtt.admin.Admin/UnloadPlugin",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).UnloadPlugin(ctx, req.(*UnloadPluginRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+var _Admin_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "gmqtt.admin.Admin",
+	HandlerType: (*AdminServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ListClients",
+			Handler:    _Admin_ListClients_Handler,
+		},
+		{
+			MethodName: "GetClient",
+			Handler:    _Admin_GetClient_Handler,
+		},
+		{
+			MethodName: "CloseClient",
+			Handler:    _Admin_CloseClient_Handler,
+		},
+		{
+			MethodName: "ListSubscriptions",
+			Handler:    _Admin_ListSubscriptions_Handler,
+		},
+		{
+			MethodName: "Subscribe",
+			Handler:    _Admin_Subscribe_Handler,
+		},
+		{
+			MethodName: "Unsubscribe",
+			Handler:    _Admin_Unsubscribe_Handler,
+		},
+		{
+			MethodName: "Publish",
+			Handler:    _Admin_Publish_Handler,
+		},
+		{
+			MethodName: "GetSubscriptionStats",
+			Handler:    _Admin_GetSubscriptionStats_Handler,
+		},
+		{
+			MethodName: "ListRetained",
+			Handler:    _Admin_ListRetained_Handler,
+		},
+		{
+			MethodName: "ListBans",
+			Handler:    _Admin_ListBans_Handler,
+		},
+		{
+			MethodName: "Ban",
+			Handler:    _Admin_Ban_Handler,
+		},
+		{
+			MethodName: "Unban",
+			Handler:    _Admin_Unban_Handler,
+		},
+		{
+			MethodName: "SetLogLevel",
+			Handler:    _Admin_SetLogLevel_Handler,
+		},
+		{
+			MethodName: "ListLogLevels",
+			Handler:    _Admin_ListLogLevels_Handler,
+		},
+		{
+			MethodName: "TopTopics",
+			Handler:    _Admin_TopTopics_Handler,
+		},
+		{
+			MethodName: "ListPlugins",
+			Handler:    _Admin_ListPlugins_Handler,
+		},
+		{
+			MethodName: "LoadPlugin",
+			Handler:    _Admin_LoadPlugin_Handler,
+		},
+		{
+			MethodName: "UnloadPlugin",
+			Handler:    _Admin_UnloadPlugin_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchClients",
+			Handler:       _Admin_WatchClients_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "WatchSubscriptions",
+			Handler:       _Admin_WatchSubscriptions_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "Trace",
+			Handler:       _Admin_Trace_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "admin.proto",
+}
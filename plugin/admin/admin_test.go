@@ -0,0 +1,364 @@
+package admin
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/DrmagicE/gmqtt"
+	"github.com/DrmagicE/gmqtt/internal/testutil"
+	"github.com/DrmagicE/gmqtt/pkg/packets"
+	"github.com/DrmagicE/gmqtt/retained"
+	retained_trie "github.com/DrmagicE/gmqtt/retained/trie"
+	"github.com/DrmagicE/gmqtt/subscription"
+	"github.com/DrmagicE/gmqtt/subscription/notify"
+	"github.com/DrmagicE/gmqtt/subscription/trie"
+)
+
+func init() {
+	log = zap.NewNop()
+}
+
+type testClient struct {
+	*testutil.Client
+}
+
+func newTestClient(id string) *testClient {
+	return &testClient{Client: &testutil.Client{Opts: &testutil.ClientOptions{
+		ID:     id,
+		User:   "user",
+		Keep:   30,
+		Clean:  true,
+		Remote: &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 50000},
+	}}}
+}
+
+func (c *testClient) IsConnected() bool         { return true }
+func (c *testClient) ConnectedAt() time.Time    { return time.Unix(100, 0) }
+func (c *testClient) DisconnectedAt() time.Time { return time.Time{} }
+func (c *testClient) GetClientStats() *gmqtt.ConnectionStats {
+	return &gmqtt.ConnectionStats{
+		PacketStats: &gmqtt.PacketStats{
+			ReceivedTotal: &gmqtt.PacketCount{Connect: 1, Publish: 2},
+			SentTotal:     &gmqtt.PacketCount{Connack: 1},
+		},
+		BytesReceived: 10,
+		BytesSent:     4,
+		SessionStats:  &gmqtt.SessionStats{InflightCurrent: 1},
+	}
+}
+
+type published struct {
+	clientID string
+	msg      packets.Message
+}
+
+// fakeServer is the gmqtt.Server which records the published messages.
+type fakeServer struct {
+	gmqtt.Server
+	subs     subscription.Store
+	retained retained.Store
+
+	mu   sync.Mutex
+	msgs []published
+}
+
+func newFakeServer(subs subscription.Store) *fakeServer {
+	return &fakeServer{subs: subs, retained: retained_trie.NewStore()}
+}
+
+func (s *fakeServer) SubscriptionStore() subscription.Store {
+	return s.subs
+}
+
+func (s *fakeServer) RetainedStore() retained.Store {
+	return s.retained
+}
+
+func (s *fakeServer) PublishService() gmqtt.PublishService {
+	return s
+}
+
+func (s *fakeServer) Publish(message packets.Message) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.msgs = append(s.msgs, published{msg: message})
+}
+
+func (s *fakeServer) PublishToClient(clientID string, message packets.Message, match bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.msgs = append(s.msgs, published{clientID: clientID, msg: message})
+}
+
+func newTestAdmin(srv gmqtt.Server) *Admin {
+	a := New("")
+	a.server = srv
+	return a
+}
+
+func code(err error) codes.Code {
+	return status.Code(err)
+}
+
+func TestPageRange(t *testing.T) {
+	var tt = []struct {
+		name       string
+		pager      *Pager
+		length     int
+		start, end int
+	}{
+		{name: "default", length: 50, start: 0, end: 20},
+		{name: "default_short", length: 5, start: 0, end: 5},
+		{name: "page", pager: &Pager{Page: 2, PageSize: 10}, length: 25, start: 10, end: 20},
+		{name: "last_page", pager: &Pager{Page: 3, PageSize: 10}, length: 25, start: 20, end: 25},
+		{name: "out_of_range", pager: &Pager{Page: 10, PageSize: 10}, length: 25, start: 25, end: 25},
+		{name: "zero_page", pager: &Pager{PageSize: 2}, length: 5, start: 0, end: 2},
+	}
+	for _, v := range tt {
+		t.Run(v.name, func(t *testing.T) {
+			start, end := pageRange(v.pager, v.length)
+			assert.Equal(t, v.start, start)
+			assert.Equal(t, v.end, end)
+		})
+	}
+}
+
+func TestAdmin_Clients(t *testing.T) {
+	a := assert.New(t)
+	srv := newFakeServer(trie.NewStore())
+	ad := newTestAdmin(srv)
+	ctx := context.Background()
+	created := ad.OnSessionCreatedWrapper(func(ctx context.Context, client gmqtt.Client) {})
+	terminated := ad.OnSessionTerminatedWrapper(func(ctx context.Context, client gmqtt.Client, reason gmqtt.SessionTerminatedReason) {})
+	for _, id := range []string{"c", "a", "b"} {
+		created(ctx, newTestClient(id))
+	}
+	srv.subs.Subscribe("a", packets.Topic{Name: "a/b"})
+
+	rs, err := ad.ListClients(ctx, &ListClientsRequest{Pager: &Pager{Page: 1, PageSize: 2}})
+	a.NoError(err)
+	a.EqualValues(3, rs.Total)
+	if a.Len(rs.Clients, 2) {
+		a.Equal("a", rs.Clients[0].ClientId)
+		a.Equal("b", rs.Clients[1].ClientId)
+	}
+
+	c, err := ad.GetClient(ctx, &GetClientRequest{ClientId: "a"})
+	a.NoError(err)
+	a.Equal(&Client{
+		ClientId:        "a",
+		Username:        "user",
+		KeepAlive:       30,
+		CleanSession:    true,
+		Connected:       true,
+		ConnectedAt:     100,
+		DisconnectedAt:  time.Time{}.Unix(),
+		InflightLen:     1,
+		Subscriptions:   1,
+		BytesReceived:   10,
+		BytesSent:       4,
+		PacketsReceived: map[string]uint64{"CONNECT": 1, "PUBLISH": 2},
+		PacketsSent:     map[string]uint64{"CONNACK": 1},
+		RemoteAddr:      "127.0.0.1:50000",
+	}, c)
+
+	// the client is removed once the session is terminated.
+	terminated(ctx, newTestClient("a"), gmqtt.NormalTermination)
+	_, err = ad.GetClient(ctx, &GetClientRequest{ClientId: "a"})
+	a.NoError(err, "the client of the other session is not removed")
+	ad.clientMu.Lock()
+	client := ad.clients["a"]
+	ad.clientMu.Unlock()
+	terminated(ctx, client, gmqtt.NormalTermination)
+	_, err = ad.GetClient(ctx, &GetClientRequest{ClientId: "a"})
+	a.Equal(codes.NotFound, code(err))
+}
+
+func TestAdmin_Subscriptions(t *testing.T) {
+	a := assert.New(t)
+	srv := newFakeServer(trie.NewStore())
+	ad := newTestAdmin(srv)
+	ctx := context.Background()
+
+	var tt = []struct {
+		name string
+		req  *SubscribeRequest
+		code codes.Code
+	}{
+		{name: "empty_client_id", req: &SubscribeRequest{Subscriptions: []*Subscription{{TopicFilter: "a"}}}, code: codes.InvalidArgument},
+		{name: "invalid_qos", req: &SubscribeRequest{ClientId: "id", Subscriptions: []*Subscription{{TopicFilter: "a", Qos: 3}}}, code: codes.InvalidArgument},
+		{name: "invalid_filter", req: &SubscribeRequest{ClientId: "id", Subscriptions: []*Subscription{{TopicFilter: "a/#/b"}}}, code: codes.InvalidArgument},
+		{name: "ok", req: &SubscribeRequest{ClientId: "id", Subscriptions: []*Subscription{
+			{TopicFilter: "c", Qos: 1},
+			{TopicFilter: "a/#", Qos: 2},
+			{TopicFilter: "b"},
+		}}, code: codes.OK},
+	}
+	for _, v := range tt {
+		t.Run(v.name, func(t *testing.T) {
+			_, err := ad.Subscribe(ctx, v.req)
+			assert.Equal(t, v.code, code(err))
+		})
+	}
+
+	_, err := ad.ListSubscriptions(ctx, &ListSubscriptionsRequest{})
+	a.Equal(codes.InvalidArgument, code(err))
+	rs, err := ad.ListSubscriptions(ctx, &ListSubscriptionsRequest{ClientId: "id", Pager: &Pager{Page: 1, PageSize: 2}})
+	a.NoError(err)
+	a.EqualValues(3, rs.Total)
+	a.Equal([]*Subscription{{TopicFilter: "a/#", Qos: 2}, {TopicFilter: "b"}}, rs.Subscriptions)
+
+	stats, err := ad.GetSubscriptionStats(ctx, &GetSubscriptionStatsRequest{ClientId: "id"})
+	a.NoError(err)
+	a.EqualValues(3, stats.SubscriptionsCurrent)
+
+	_, err = ad.Unsubscribe(ctx, &UnsubscribeRequest{ClientId: "id", TopicFilters: []string{"a/#/b"}})
+	a.Equal(codes.InvalidArgument, code(err))
+	_, err = ad.Unsubscribe(ctx, &UnsubscribeRequest{ClientId: "id", TopicFilters: []string{"a/#", "b"}})
+	a.NoError(err)
+	rs, err = ad.ListSubscriptions(ctx, &ListSubscriptionsRequest{ClientId: "id"})
+	a.NoError(err)
+	a.Equal([]*Subscription{{TopicFilter: "c", Qos: 1}}, rs.Subscriptions)
+}
+
+func TestAdmin_Publish(t *testing.T) {
+	a := assert.New(t)
+	srv := newFakeServer(trie.NewStore())
+	ad := newTestAdmin(srv)
+	ctx := context.Background()
+
+	_, err := ad.Publish(ctx, &PublishRequest{TopicName: "a", Qos: 3})
+	a.Equal(codes.InvalidArgument, code(err))
+	_, err = ad.Publish(ctx, &PublishRequest{TopicName: "a/+"})
+	a.Equal(codes.InvalidArgument, code(err))
+	_, err = ad.Publish(ctx, &PublishRequest{TopicName: "a/b", Payload: []byte("1"), Qos: 1, Retained: true})
+	a.NoError(err)
+	// the message is published to the client if the client id is set.
+	_, err = ad.Publish(ctx, &PublishRequest{TopicName: "a/b", Payload: []byte("2"), ClientId: "id"})
+	a.NoError(err)
+
+	if !a.Len(srv.msgs, 2) {
+		return
+	}
+	a.Equal("", srv.msgs[0].clientID)
+	a.Equal("a/b", srv.msgs[0].msg.Topic())
+	a.Equal([]byte("1"), srv.msgs[0].msg.Payload())
+	a.Equal(packets.QOS_1, srv.msgs[0].msg.Qos())
+	a.True(srv.msgs[0].msg.Retained())
+	a.Equal("id", srv.msgs[1].clientID)
+	a.Equal([]byte("2"), srv.msgs[1].msg.Payload())
+}
+
+func TestAdmin_ListRetained(t *testing.T) {
+	a := assert.New(t)
+	srv := newFakeServer(trie.NewStore())
+	ad := newTestAdmin(srv)
+	ctx := context.Background()
+	for _, topic := range []string{"b/a", "a/b", "a/a"} {
+		srv.retained.AddOrReplace(gmqtt.NewMessage(topic, []byte(topic), packets.QOS_1, gmqtt.Retained(true)))
+	}
+
+	rs, err := ad.ListRetained(ctx, &ListRetainedRequest{})
+	a.NoError(err)
+	a.EqualValues(3, rs.Total)
+	a.Equal([]*RetainedMessage{
+		{TopicName: "a/a", Payload: []byte("a/a"), Qos: 1},
+		{TopicName: "a/b", Payload: []byte("a/b"), Qos: 1},
+		{TopicName: "b/a", Payload: []byte("b/a"), Qos: 1},
+	}, rs.Messages)
+
+	rs, err = ad.ListRetained(ctx, &ListRetainedRequest{TopicFilter: "a/#", Pager: &Pager{Page: 2, PageSize: 1}})
+	a.NoError(err)
+	a.EqualValues(2, rs.Total)
+	a.Equal([]*RetainedMessage{{TopicName: "a/b", Payload: []byte("a/b"), Qos: 1}}, rs.Messages)
+
+	_, err = ad.ListRetained(ctx, &ListRetainedRequest{TopicFilter: "a/#/b"})
+	a.Equal(codes.InvalidArgument, code(err))
+}
+
+func TestBanKind(t *testing.T) {
+	kind, err := banKind(Ban_Kind(gmqtt.BanClientID))
+	assert.NoError(t, err)
+	assert.Equal(t, gmqtt.BanClientID, kind)
+	_, err = banKind(Ban_Kind(100))
+	assert.Equal(t, codes.InvalidArgument, code(err))
+}
+
+// subscriptionStream is the Admin_WatchSubscriptionsServer which sends the events to a channel.
+type subscriptionStream struct {
+	grpc.ServerStream
+	ctx    context.Context
+	events chan *SubscriptionEvent
+}
+
+func (s *subscriptionStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *subscriptionStream) Send(event *SubscriptionEvent) error {
+	s.events <- event
+	return nil
+}
+
+func TestAdmin_WatchSubscriptions(t *testing.T) {
+	a := assert.New(t)
+	store := notify.NewStore(trie.NewStore())
+	srv := newFakeServer(store)
+	ad := newTestAdmin(srv)
+	// as the Load does.
+	ad.notified = true
+	store.AddListener(ad.onSubscriptionChanged)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stream := &subscriptionStream{ctx: ctx, events: make(chan *SubscriptionEvent, 10)}
+	done := make(chan error)
+	go func() {
+		done <- ad.WatchSubscriptions(&WatchSubscriptionsRequest{}, stream)
+	}()
+	a.Eventually(func() bool {
+		ad.watchMu.Lock()
+		defer ad.watchMu.Unlock()
+		return len(ad.subWatches) == 1
+	}, time.Second, 10*time.Millisecond)
+
+	// the changes made by the admin api are watched.
+	_, err := ad.Subscribe(context.Background(), &SubscribeRequest{ClientId: "id", Subscriptions: []*Subscription{{TopicFilter: "a", Qos: 1}}})
+	a.NoError(err)
+	_, err = ad.Unsubscribe(context.Background(), &UnsubscribeRequest{ClientId: "id", TopicFilters: []string{"a"}})
+	a.NoError(err)
+	// the hooks do not emit the events again if the events are received from the store.
+	ad.OnSubscribedWrapper(func(ctx context.Context, client gmqtt.Client, topic packets.Topic) {})(
+		context.Background(), newTestClient("id"), packets.Topic{Name: "a"})
+
+	for _, v := range []*SubscriptionEvent{
+		{Type: SubscriptionEvent_SUBSCRIBED, ClientId: "id", Subscription: &Subscription{TopicFilter: "a", Qos: 1}},
+		{Type: SubscriptionEvent_UNSUBSCRIBED, ClientId: "id", Subscription: &Subscription{TopicFilter: "a"}},
+	} {
+		select {
+		case event := <-stream.events:
+			a.Equal(v, event)
+		case <-time.After(time.Second):
+			t.Fatal("event timeout")
+		}
+	}
+	select {
+	case event := <-stream.events:
+		t.Fatalf("unexpected event: %v", event)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	cancel()
+	a.NoError(<-done)
+	ad.watchMu.Lock()
+	a.Empty(ad.subWatches)
+	ad.watchMu.Unlock()
+}
@@ -0,0 +1,270 @@
+// Package bridge forwards the messages between gmqtt and the remote MQTT brokers.
+// Each remote is connected by an MQTT v3.1.1 client, the messages matching the out rules are forwarded to the remote
+// and the messages matching the in rules are subscribed from the remote and published locally.
+package bridge
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/DrmagicE/gmqtt"
+	"github.com/DrmagicE/gmqtt/persistence/queue"
+	"github.com/DrmagicE/gmqtt/pkg/packets"
+	"github.com/DrmagicE/gmqtt/pkg/spool"
+)
+
+const name = "bridge"
+
+var log *zap.Logger
+
+const (
+	defaultKeepAlive         = 60 * time.Second
+	defaultAckTimeout        = 10 * time.Second
+	defaultMinReconnectDelay = time.Second
+	defaultMaxReconnectDelay = time.Minute
+	defaultMaxQueue          = 10000
+	dialTimeout              = 10 * time.Second
+)
+
+// Rule is the forwarding rule of the remote.
+type Rule struct {
+	// Topic is the topic filter of the forwarded messages. It matches the local messages for the out rules,
+	// and it is subscribed from the remote for the in rules.
+	Topic string
+	// Qos is the maximum qos of the forwarded messages, the qos of the message is downgraded to it.
+	Qos uint8
+	// Prefix is prepended to the topic of the forwarded messages.
+	Prefix string
+}
+
+// Remote is the config of the remote broker.
+type Remote struct {
+	// Name is the unique name of the remote.
+	Name string
+	// Address is the "host:port" of the remote broker.
+	Address string
+	// TLSConfig is the tls config used to connect to the remote, nil means plain TCP.
+	TLSConfig *tls.Config
+	// ClientID is the client id used to connect to the remote, default to "gmqtt-bridge-<name>".
+	ClientID     string
+	Username     string
+	Password     string
+	CleanSession bool
+	// KeepAlive is the keep alive of the connection, default to 60 seconds.
+	KeepAlive time.Duration
+	// Out is the rules of the messages forwarded from gmqtt to the remote.
+	Out []Rule
+	// In is the rules of the messages forwarded from the remote to gmqtt.
+	In []Rule
+	// AckTimeout is the time to wait for the acknowledgement of the qos 1 and qos 2 messages sent to the remote,
+	// the connection is closed if the timeout is exceeded. Default to 10 seconds.
+	AckTimeout time.Duration
+	// MinReconnectDelay and MaxReconnectDelay are the bounds of the exponential backoff of the reconnections,
+	// default to 1 second and 1 minute.
+	MinReconnectDelay time.Duration
+	MaxReconnectDelay time.Duration
+	// MaxQueue is the maximum number of the messages queued in memory for the remote, the oldest message is dropped
+	// once the queue is full, or the messages are spilled to disk if WithSpill is set. Default to 10000.
+	MaxQueue int
+}
+
+func (r *Remote) validate() error {
+	if r.Name == "" {
+		return errors.New("empty name")
+	}
+	if r.Address == "" {
+		return errors.New("empty address")
+	}
+	for _, rules := range [][]Rule{r.Out, r.In} {
+		for _, v := range rules {
+			if !packets.ValidTopicFilter([]byte(v.Topic)) {
+				return fmt.Errorf("invalid topic filter: %q", v.Topic)
+			}
+			if v.Qos > packets.QOS_2 {
+				return fmt.Errorf("invalid qos: %d", v.Qos)
+			}
+		}
+	}
+	return nil
+}
+
+func (r *Remote) setDefaults() {
+	if r.ClientID == "" {
+		r.ClientID = "gmqtt-bridge-" + r.Name
+	}
+	if r.KeepAlive == 0 {
+		r.KeepAlive = defaultKeepAlive
+	}
+	if r.AckTimeout == 0 {
+		r.AckTimeout = defaultAckTimeout
+	}
+	if r.MinReconnectDelay == 0 {
+		r.MinReconnectDelay = defaultMinReconnectDelay
+	}
+	if r.MaxReconnectDelay == 0 {
+		r.MaxReconnectDelay = defaultMaxReconnectDelay
+	}
+	if r.MaxQueue == 0 {
+		r.MaxQueue = defaultMaxQueue
+	}
+}
+
+// Status is the status of the remote.
+type Status struct {
+	Name      string
+	Connected bool
+	// Queued is the number of the messages waiting in memory to be forwarded to the remote.
+	Queued int
+	// Spilled and SpilledBytes are the number and the size of the messages spilled to disk.
+	Spilled      int
+	SpilledBytes int64
+	// SpillErrors is the number of the messages which failed to spill and were queued in memory instead.
+	SpillErrors uint64
+	// Lag is the time the oldest waiting message has been queued, 0 if nothing is waiting.
+	Lag time.Duration
+}
+
+// Option is the option of the Bridge.
+type Option func(b *Bridge)
+
+// WithRemote adds the remote broker.
+func WithRemote(remote Remote) Option {
+	return func(b *Bridge) {
+		b.configs = append(b.configs, remote)
+	}
+}
+
+// WithQueueStore sets the store which persists the messages queued while the remotes are down,
+// the queue of each remote is keyed by "$bridge/<name>". Default to no persistence.
+func WithQueueStore(store queue.Store) Option {
+	return func(b *Bridge) {
+		b.store = store
+	}
+}
+
+// WithSpill spills the messages to the segment files in dir while the remote is down or the memory queue is full,
+// instead of dropping them. The messages of each remote are stored in the sub directory named by the escaped name,
+// and they are sent in order once the remote is reconnected, including the ones spilled before restarting.
+// The opts limit the size and the age of the spilled messages.
+func WithSpill(dir string, opts spool.Options) Option {
+	return func(b *Bridge) {
+		b.spillDir = dir
+		b.spillOpts = opts
+	}
+}
+
+// Bridge is the plugin which forwards the messages between gmqtt and the remote brokers.
+type Bridge struct {
+	configs   []Remote
+	store     queue.Store
+	spillDir  string
+	spillOpts spool.Options
+	remotes   []*remote
+}
+
+// New returns the Bridge plugin.
+func New(opts ...Option) *Bridge {
+	b := &Bridge{}
+	for _, fn := range opts {
+		fn(b)
+	}
+	return b
+}
+
+func (b *Bridge) Load(service gmqtt.Server) error {
+	log = gmqtt.Logger("plugin/" + name)
+	names := make(map[string]bool)
+	for i := range b.configs {
+		c := b.configs[i]
+		if err := c.validate(); err != nil {
+			return fmt.Errorf("remote %q: %s", c.Name, err)
+		}
+		if names[c.Name] {
+			return fmt.Errorf("duplicate remote: %q", c.Name)
+		}
+		names[c.Name] = true
+		c.setDefaults()
+		var spill *spool.Spool
+		if b.spillDir != "" {
+			var err error
+			spill, err = spool.Open(filepath.Join(b.spillDir, url.PathEscape(c.Name)), b.spillOpts)
+			if err != nil {
+				return fmt.Errorf("remote %q: %s", c.Name, err)
+			}
+		}
+		r, err := newRemote(c, service, b.store, spill)
+		if err != nil {
+			return err
+		}
+		b.remotes = append(b.remotes, r)
+	}
+	for _, r := range b.remotes {
+		r.start()
+	}
+	return nil
+}
+
+func (b *Bridge) Unload() error {
+	for _, r := range b.remotes {
+		r.stop()
+	}
+	return nil
+}
+
+func (b *Bridge) HookWrapper() gmqtt.HookWrapper {
+	return gmqtt.HookWrapper{
+		OnMsgArrivedWrapper: b.OnMsgArrivedWrapper,
+	}
+}
+
+func (b *Bridge) Name() string {
+	return name
+}
+
+// Status returns the status of the remotes.
+func (b *Bridge) Status() []Status {
+	s := make([]Status, 0, len(b.remotes))
+	for _, r := range b.remotes {
+		s = append(s, r.status())
+	}
+	return s
+}
+
+// OnMsgArrivedWrapper queues the messages matching the out rules for the remotes.
+// The messages published by the in rules do not arrive here, so they are never forwarded back.
+func (b *Bridge) OnMsgArrivedWrapper(arrived gmqtt.OnMsgArrived) gmqtt.OnMsgArrived {
+	return func(ctx context.Context, client gmqtt.Client, msg packets.Message) (valid bool) {
+		valid = arrived(ctx, client, msg)
+		if !valid {
+			return false
+		}
+		for _, r := range b.remotes {
+			r.forward(msg)
+		}
+		return true
+	}
+}
+
+// match returns the first rule which matches the topic.
+func match(rules []Rule, topic string) (Rule, bool) {
+	for _, v := range rules {
+		if packets.TopicMatch([]byte(topic), []byte(v.Topic)) {
+			return v, true
+		}
+	}
+	return Rule{}, false
+}
+
+func minQos(a, b uint8) uint8 {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,300 @@
+package bridge
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/DrmagicE/gmqtt"
+	"github.com/DrmagicE/gmqtt/persistence/queue"
+	"github.com/DrmagicE/gmqtt/pkg/packets"
+	"github.com/DrmagicE/gmqtt/retained"
+	"github.com/DrmagicE/gmqtt/retained/trie"
+)
+
+// memStore is the in-memory queue.Store.
+type memStore struct {
+	mu     sync.Mutex
+	queues map[string][]*queue.Message
+}
+
+func newMemStore() *memStore {
+	return &memStore{queues: make(map[string][]*queue.Message)}
+}
+
+func (m *memStore) Append(clientID string, msg *queue.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.queues[clientID] = append(m.queues[clientID], msg)
+	return nil
+}
+
+func (m *memStore) Replace(clientID string, msgs []*queue.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.queues[clientID] = msgs
+	return nil
+}
+
+func (m *memStore) Get(clientID string) ([]*queue.Message, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.queues[clientID], nil
+}
+
+func (m *memStore) Remove(clientID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.queues, clientID)
+	return nil
+}
+
+// payloads returns the payloads of the queue.
+func (m *memStore) payloads(clientID string) []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var rs []string
+	for _, v := range m.queues[clientID] {
+		rs = append(rs, string(v.Payload))
+	}
+	return rs
+}
+
+// fakeServer is the gmqtt.Server which records the published messages.
+type fakeServer struct {
+	gmqtt.Server
+	retained retained.Store
+
+	mu   sync.Mutex
+	msgs []packets.Message
+}
+
+func newFakeServer() *fakeServer {
+	return &fakeServer{retained: trie.NewStore()}
+}
+
+func (s *fakeServer) PublishService() gmqtt.PublishService {
+	return s
+}
+
+func (s *fakeServer) RetainedStore() retained.Store {
+	return s.retained
+}
+
+func (s *fakeServer) Publish(message packets.Message) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.msgs = append(s.msgs, message)
+}
+
+func (s *fakeServer) PublishToClient(clientID string, message packets.Message, match bool) {
+}
+
+func (s *fakeServer) published() []packets.Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]packets.Message(nil), s.msgs...)
+}
+
+func TestRemote_validate(t *testing.T) {
+	var tt = []struct {
+		name   string
+		remote Remote
+		ok     bool
+	}{
+		{name: "ok", remote: Remote{Name: "a", Address: "127.0.0.1:1883", Out: []Rule{{Topic: "a/#"}}, In: []Rule{{Topic: "+/b", Qos: 2}}}, ok: true},
+		{name: "empty_name", remote: Remote{Address: "127.0.0.1:1883"}},
+		{name: "empty_address", remote: Remote{Name: "a"}},
+		{name: "invalid_out_topic", remote: Remote{Name: "a", Address: "127.0.0.1:1883", Out: []Rule{{Topic: "a/#/b"}}}},
+		{name: "invalid_in_qos", remote: Remote{Name: "a", Address: "127.0.0.1:1883", In: []Rule{{Topic: "a", Qos: 3}}}},
+	}
+	for _, v := range tt {
+		t.Run(v.name, func(t *testing.T) {
+			err := v.remote.validate()
+			if v.ok {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestMatch(t *testing.T) {
+	a := assert.New(t)
+	rules := []Rule{
+		{Topic: "a/b", Qos: packets.QOS_0, Prefix: "exact/"},
+		{Topic: "a/#", Qos: packets.QOS_1, Prefix: "wildcard/"},
+		{Topic: "+/c", Qos: packets.QOS_2},
+	}
+	var tt = []struct {
+		topic  string
+		ok     bool
+		prefix string
+	}{
+		// the first matching rule is used.
+		{topic: "a/b", ok: true, prefix: "exact/"},
+		{topic: "a/b/c", ok: true, prefix: "wildcard/"},
+		{topic: "a", ok: true, prefix: "wildcard/"},
+		{topic: "b/c", ok: true},
+		{topic: "b/d"},
+	}
+	for _, v := range tt {
+		rule, ok := match(rules, v.topic)
+		a.Equal(v.ok, ok, v.topic)
+		a.Equal(v.prefix, rule.Prefix, v.topic)
+	}
+}
+
+func TestRemote_Forward(t *testing.T) {
+	a := assert.New(t)
+	config := testRemote(freeAddr(t))
+	config.Out = []Rule{
+		{Topic: "a/#", Qos: packets.QOS_1, Prefix: "edge/"},
+		{Topic: "b/#", Qos: packets.QOS_2},
+	}
+	r, err := newRemote(config, nil, nil, nil)
+	if !a.NoError(err) {
+		return
+	}
+	var tt = []struct {
+		msg    packets.Message
+		topic  string
+		qos    uint8
+		retain bool
+	}{
+		// the qos is downgraded to the rule and the prefix is prepended.
+		{msg: gmqtt.NewMessage("a/b", []byte("1"), packets.QOS_2), topic: "edge/a/b", qos: packets.QOS_1},
+		{msg: gmqtt.NewMessage("a/b", []byte("2"), packets.QOS_0), topic: "edge/a/b", qos: packets.QOS_0},
+		{msg: gmqtt.NewMessage("b", []byte("3"), packets.QOS_2, gmqtt.Retained(true)), topic: "b", qos: packets.QOS_2, retain: true},
+	}
+	for _, v := range tt {
+		r.forward(v.msg)
+	}
+	// the messages matching no out rule are not forwarded.
+	r.forward(gmqtt.NewMessage("c", []byte("4"), packets.QOS_1))
+	a.Equal(len(tt), r.status().Queued)
+	for _, v := range tt {
+		pub := r.front()
+		if !a.NotNil(pub) {
+			return
+		}
+		a.Equal(v.topic, string(pub.TopicName))
+		a.Equal(v.qos, pub.Qos)
+		a.Equal(v.retain, pub.Retain)
+		a.Equal(v.msg.Payload(), pub.Payload)
+		r.pop(pub)
+	}
+	a.Nil(r.front())
+}
+
+func TestRemote_Publish(t *testing.T) {
+	a := assert.New(t)
+	srv := newFakeServer()
+	config := testRemote(freeAddr(t))
+	config.In = []Rule{
+		{Topic: "x/#", Qos: packets.QOS_1, Prefix: "remote/"},
+	}
+	r, err := newRemote(config, srv, nil, nil)
+	if !a.NoError(err) {
+		return
+	}
+	r.publish(&packets.Publish{Qos: packets.QOS_2, TopicName: []byte("x/y"), Payload: []byte("1")})
+	r.publish(&packets.Publish{Qos: packets.QOS_0, Retain: true, TopicName: []byte("x/z"), Payload: []byte("2")})
+	// the messages matching no in rule are dropped.
+	r.publish(&packets.Publish{Qos: packets.QOS_1, TopicName: []byte("y"), Payload: []byte("3")})
+
+	msgs := srv.published()
+	if !a.Len(msgs, 2) {
+		return
+	}
+	a.Equal("remote/x/y", msgs[0].Topic())
+	a.Equal(packets.QOS_1, msgs[0].Qos())
+	a.Equal("remote/x/z", msgs[1].Topic())
+	a.Equal(packets.QOS_0, msgs[1].Qos())
+	m := srv.retained.GetRetainedMessage("remote/x/z")
+	if a.NotNil(m) {
+		a.Equal([]byte("2"), m.Payload())
+	}
+	// the retained message with empty payload removes the retained message.
+	r.publish(&packets.Publish{Qos: packets.QOS_0, Retain: true, TopicName: []byte("x/z")})
+	a.Nil(srv.retained.GetRetainedMessage("remote/x/z"))
+}
+
+func TestRemote_In(t *testing.T) {
+	a := assert.New(t)
+	b := listen(t, "127.0.0.1:0", true)
+	defer b.close()
+	b.out = []*packets.Publish{
+		{Qos: packets.QOS_1, PacketID: 1, TopicName: []byte("x/a"), Payload: []byte("1")},
+		{Qos: packets.QOS_2, PacketID: 2, TopicName: []byte("x/b"), Payload: []byte("2")},
+	}
+	srv := newFakeServer()
+	config := testRemote(b.addr())
+	config.In = []Rule{{Topic: "x/#", Qos: packets.QOS_2}}
+	r, err := newRemote(config, srv, nil, nil)
+	if !a.NoError(err) {
+		return
+	}
+	r.start()
+	defer r.stop()
+	a.Eventually(func() bool { return len(srv.published()) == 2 }, 2*time.Second, 10*time.Millisecond)
+	msgs := srv.published()
+	if a.Len(msgs, 2) {
+		a.Equal("x/a", msgs[0].Topic())
+		a.Equal("x/b", msgs[1].Topic())
+	}
+}
+
+func TestRemote_QueueStore(t *testing.T) {
+	a := assert.New(t)
+	addr := freeAddr(t)
+	store := newMemStore()
+	key := "$bridge/remote"
+	r, err := newRemote(testRemote(addr), nil, store, nil)
+	if !a.NoError(err) {
+		return
+	}
+	// the messages queued while the remote is down are persisted.
+	for i := 0; i < 3; i++ {
+		r.forward(gmqtt.NewMessage("a/b", []byte(strconv.Itoa(i)), packets.QOS_1))
+	}
+	a.Equal(sequence(0, 3), store.payloads(key))
+
+	// the persisted messages are restored and sent in order, then the queue is removed from the store.
+	b := listen(t, addr, true)
+	defer b.close()
+	r, err = newRemote(testRemote(addr), nil, store, nil)
+	if !a.NoError(err) {
+		return
+	}
+	a.Equal(3, r.status().Queued)
+	r.start()
+	defer r.stop()
+	a.Eventually(func() bool { return len(b.received()) == 3 }, 2*time.Second, 10*time.Millisecond)
+	a.Equal(sequence(0, 3), b.received())
+	a.Eventually(func() bool { return r.status().Queued == 0 }, 2*time.Second, 10*time.Millisecond)
+	a.Empty(store.payloads(key))
+}
+
+func TestBridge_OnMsgArrivedWrapper(t *testing.T) {
+	a := assert.New(t)
+	r, err := newRemote(testRemote(freeAddr(t)), nil, nil, nil)
+	if !a.NoError(err) {
+		return
+	}
+	bridge := &Bridge{remotes: []*remote{r}}
+	valid := true
+	arrived := bridge.OnMsgArrivedWrapper(func(ctx context.Context, client gmqtt.Client, msg packets.Message) bool {
+		return valid
+	})
+	a.True(arrived(context.Background(), nil, gmqtt.NewMessage("a/b", []byte("1"), packets.QOS_1)))
+	// the rejected messages are not forwarded.
+	valid = false
+	a.False(arrived(context.Background(), nil, gmqtt.NewMessage("a/b", []byte("2"), packets.QOS_1)))
+	a.Equal(1, r.status().Queued)
+}
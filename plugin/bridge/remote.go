@@ -0,0 +1,593 @@
+package bridge
+
+import (
+	"container/list"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/DrmagicE/gmqtt"
+	"github.com/DrmagicE/gmqtt/persistence/queue"
+	"github.com/DrmagicE/gmqtt/pkg/packets"
+	"github.com/DrmagicE/gmqtt/pkg/spool"
+)
+
+var (
+	errStopped    = errors.New("bridge stopped")
+	errAckTimeout = errors.New("acknowledgement timeout")
+)
+
+// conn is the connection to the remote broker.
+type conn struct {
+	net.Conn
+	r  *packets.Reader
+	mu sync.Mutex
+	w  *packets.Writer
+}
+
+func (c *conn) write(p packets.Packet) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.w.WriteAndFlush(p)
+}
+
+// entry is the queued message.
+type entry struct {
+	pub *packets.Publish
+	// at is the time the message was queued.
+	at time.Time
+	// spilled is the spilled record of the message, which is removed from the spill once the message is sent.
+	// nil if the message is not spilled.
+	spilled *spool.Record
+}
+
+// remote maintains the connection to the remote broker and the queue of the messages forwarded to it.
+type remote struct {
+	config  Remote
+	service gmqtt.Server
+	store   queue.Store
+	// key is the key of the queue in the store.
+	key string
+
+	mu sync.Mutex
+	// queue is the messages waiting to be forwarded, the front message is being sent.
+	queue     *list.List
+	connected bool
+	// persisted is whether the store holds the queue.
+	persisted bool
+	// spill holds the messages following the queue, nil if WithSpill is not set.
+	spill *spool.Spool
+	// spillErrors is the number of the messages which failed to spill and were queued in memory instead.
+	spillErrors uint64
+
+	notify chan struct{}
+	exit   chan struct{}
+	done   chan struct{}
+	// pid is only accessed by the run goroutine.
+	pid packets.PacketID
+}
+
+func newRemote(config Remote, service gmqtt.Server, store queue.Store, spill *spool.Spool) (*remote, error) {
+	r := &remote{
+		config:  config,
+		service: service,
+		store:   store,
+		key:     "$bridge/" + config.Name,
+		queue:   list.New(),
+		spill:   spill,
+		notify:  make(chan struct{}, 1),
+		exit:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	if store != nil {
+		msgs, err := store.Get(r.key)
+		if err != nil {
+			return nil, err
+		}
+		now := time.Now()
+		for _, m := range msgs {
+			r.queue.PushBack(&entry{pub: &packets.Publish{
+				Dup:       m.Dup,
+				Qos:       m.Qos,
+				Retain:    m.Retained,
+				TopicName: []byte(m.Topic),
+				Payload:   m.Payload,
+			}, at: now})
+		}
+		r.persisted = len(msgs) != 0
+	}
+	return r, nil
+}
+
+func (r *remote) start() {
+	go r.run()
+}
+
+func (r *remote) stop() {
+	close(r.exit)
+	<-r.done
+	if r.spill != nil {
+		r.spill.Close()
+	}
+}
+
+func (r *remote) status() Status {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s := Status{
+		Name:      r.config.Name,
+		Connected: r.connected,
+		Queued:    r.queue.Len(),
+	}
+	if r.spill != nil {
+		s.Spilled = r.spill.Len()
+		s.SpilledBytes = r.spill.Bytes()
+		s.SpillErrors = r.spillErrors
+	}
+	if e := r.queue.Front(); e != nil {
+		s.Lag = time.Since(e.Value.(*entry).at)
+	} else if s.Spilled != 0 {
+		if _, at, err := r.spill.Peek(); err == nil {
+			s.Lag = time.Since(at)
+		}
+	}
+	return s
+}
+
+func toQueueMessage(pub *packets.Publish) *queue.Message {
+	return &queue.Message{
+		Dup:      pub.Dup,
+		Qos:      pub.Qos,
+		Retained: pub.Retain,
+		Topic:    string(pub.TopicName),
+		Payload:  pub.Payload,
+	}
+}
+
+// snapshot returns the queued messages which are not spilled, it must be called with the lock held.
+func (r *remote) snapshot() []*queue.Message {
+	msgs := make([]*queue.Message, 0, r.queue.Len())
+	for e := r.queue.Front(); e != nil; e = e.Next() {
+		if v := e.Value.(*entry); v.spilled == nil {
+			msgs = append(msgs, toQueueMessage(v.pub))
+		}
+	}
+	return msgs
+}
+
+// encodeSpill encodes the message as: flags(1) | topic length(2) | topic | payload,
+// the flags hold the qos in the lower 2 bits and the retain flag in the 3rd bit.
+func encodeSpill(pub *packets.Publish) []byte {
+	b := make([]byte, 3+len(pub.TopicName)+len(pub.Payload))
+	b[0] = pub.Qos
+	if pub.Retain {
+		b[0] |= 1 << 2
+	}
+	binary.BigEndian.PutUint16(b[1:], uint16(len(pub.TopicName)))
+	n := copy(b[3:], pub.TopicName)
+	copy(b[3+n:], pub.Payload)
+	return b
+}
+
+func decodeSpill(b []byte) (*packets.Publish, error) {
+	if len(b) < 3 || int(binary.BigEndian.Uint16(b[1:]))+3 > len(b) {
+		return nil, errors.New("malformed spilled message")
+	}
+	l := 3 + int(binary.BigEndian.Uint16(b[1:]))
+	return &packets.Publish{
+		Qos:       b[0] & 0x03,
+		Retain:    b[0]&(1<<2) != 0,
+		TopicName: b[3:l],
+		Payload:   b[l:],
+	}, nil
+}
+
+// forward queues the message if it matches the out rules.
+// The messages are spilled to disk while the remote is down or the queue is full if the spill is set,
+// otherwise the messages queued while the remote is down are persisted if the store is set.
+// If spilling fails, the message is queued in memory instead, which may be sent before the spilled ones.
+func (r *remote) forward(msg packets.Message) {
+	rule, ok := match(r.config.Out, msg.Topic())
+	if !ok {
+		return
+	}
+	pub := &packets.Publish{
+		Qos:       minQos(msg.Qos(), rule.Qos),
+		Retain:    msg.Retained(),
+		TopicName: []byte(rule.Prefix + msg.Topic()),
+		Payload:   msg.Payload(),
+	}
+	r.mu.Lock()
+	// the messages following the spilled ones are spilled too, so that they are sent in order.
+	if r.spill != nil && (!r.connected || r.spill.Len() != 0 || r.queue.Len() >= r.config.MaxQueue) {
+		err := r.spill.Push(encodeSpill(pub))
+		if err == nil {
+			r.mu.Unlock()
+			r.wakeup()
+			return
+		}
+		r.spillErrors++
+		log.Error("spilling bridge message error, queuing it in memory", zap.String("remote", r.config.Name), zap.Error(err))
+	}
+	dropped := false
+	if r.queue.Len() >= r.config.MaxQueue {
+		r.queue.Remove(r.queue.Front())
+		dropped = true
+		log.Warn("bridge queue is full, dropping the oldest message", zap.String("remote", r.config.Name))
+	}
+	r.queue.PushBack(&entry{pub: pub, at: time.Now()})
+	if !r.connected && r.store != nil {
+		var err error
+		if dropped {
+			err = r.store.Replace(r.key, r.snapshot())
+		} else {
+			err = r.store.Append(r.key, toQueueMessage(pub))
+		}
+		if err != nil {
+			log.Error("persisting bridge queue error", zap.String("remote", r.config.Name), zap.Error(err))
+		}
+		r.persisted = true
+	}
+	r.mu.Unlock()
+	r.wakeup()
+}
+
+func (r *remote) wakeup() {
+	select {
+	case r.notify <- struct{}{}:
+	default:
+	}
+}
+
+// front returns the message being sent, nil if the queue is empty.
+// The oldest spilled message is queued once the queue is empty, and it stays in the spill until it is sent,
+// so it is kept across restarts.
+func (r *remote) front() *packets.Publish {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for r.queue.Len() == 0 && r.spill != nil {
+		rec, err := r.spill.PeekRecord()
+		if err == spool.ErrEmpty {
+			break
+		}
+		if err != nil {
+			log.Error("reading spilled bridge message error", zap.String("remote", r.config.Name), zap.Error(err))
+			if err := r.spill.Pop(); err != nil {
+				log.Error("removing spilled bridge message error", zap.String("remote", r.config.Name), zap.Error(err))
+				return nil
+			}
+			continue
+		}
+		pub, err := decodeSpill(rec.Data)
+		if err != nil {
+			log.Error("decoding spilled bridge message error", zap.String("remote", r.config.Name), zap.Error(err))
+			if err := r.spill.Remove(rec); err != nil {
+				log.Error("removing spilled bridge message error", zap.String("remote", r.config.Name), zap.Error(err))
+				return nil
+			}
+			continue
+		}
+		r.queue.PushBack(&entry{pub: pub, at: rec.At, spilled: rec})
+	}
+	if e := r.queue.Front(); e != nil {
+		return e.Value.(*entry).pub
+	}
+	return nil
+}
+
+// pop removes the sent message.
+func (r *remote) pop(pub *packets.Publish) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	// the message may have been dropped since the queue is full.
+	if e := r.queue.Front(); e != nil && e.Value.(*entry).pub == pub {
+		r.queue.Remove(e)
+		if rec := e.Value.(*entry).spilled; rec != nil {
+			if err := r.spill.Remove(rec); err != nil {
+				log.Error("removing spilled bridge message error", zap.String("remote", r.config.Name), zap.Error(err))
+			}
+		}
+	}
+	if r.queue.Len() == 0 && r.persisted {
+		if err := r.store.Remove(r.key); err != nil {
+			log.Error("removing bridge queue error", zap.String("remote", r.config.Name), zap.Error(err))
+		}
+		r.persisted = false
+	}
+}
+
+func (r *remote) setConnected(connected bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.connected = connected
+	if connected || r.store == nil || r.queue.Len() == 0 {
+		return
+	}
+	if err := r.store.Replace(r.key, r.snapshot()); err != nil {
+		log.Error("persisting bridge queue error", zap.String("remote", r.config.Name), zap.Error(err))
+	}
+	r.persisted = true
+}
+
+func (r *remote) nextPacketID() packets.PacketID {
+	r.pid++
+	if r.pid == 0 {
+		r.pid = 1
+	}
+	return r.pid
+}
+
+// run connects to the remote and reconnects with the exponential backoff until the bridge is stopped.
+func (r *remote) run() {
+	defer close(r.done)
+	delay := r.config.MinReconnectDelay
+	for {
+		c, err := r.connect()
+		if err == nil {
+			delay = r.config.MinReconnectDelay
+			err = r.serve(c)
+			c.Close()
+			r.setConnected(false)
+		}
+		select {
+		case <-r.exit:
+			return
+		default:
+		}
+		log.Warn("bridge connection lost",
+			zap.String("remote", r.config.Name),
+			zap.Error(err),
+			zap.Duration("reconnect_delay", delay),
+		)
+		select {
+		case <-r.exit:
+			return
+		case <-time.After(delay):
+		}
+		delay *= 2
+		if delay > r.config.MaxReconnectDelay {
+			delay = r.config.MaxReconnectDelay
+		}
+	}
+}
+
+func (r *remote) connect() (*conn, error) {
+	dialer := &net.Dialer{Timeout: dialTimeout}
+	var nc net.Conn
+	var err error
+	if r.config.TLSConfig != nil {
+		nc, err = tls.DialWithDialer(dialer, "tcp", r.config.Address, r.config.TLSConfig)
+	} else {
+		nc, err = dialer.Dial("tcp", r.config.Address)
+	}
+	if err != nil {
+		return nil, err
+	}
+	c := &conn{
+		Conn: nc,
+		r:    packets.NewReader(nc),
+		w:    packets.NewWriter(nc),
+	}
+	connect := &packets.Connect{
+		ProtocolLevel: 0x04,
+		ProtocolName:  []byte("MQTT"),
+		CleanSession:  r.config.CleanSession,
+		KeepAlive:     uint16(r.config.KeepAlive / time.Second),
+		ClientID:      []byte(r.config.ClientID),
+	}
+	if r.config.Username != "" {
+		connect.UsernameFlag = true
+		connect.Username = []byte(r.config.Username)
+	}
+	if r.config.Password != "" {
+		connect.PasswordFlag = true
+		connect.Password = []byte(r.config.Password)
+	}
+	nc.SetDeadline(time.Now().Add(dialTimeout))
+	if err := c.write(connect); err != nil {
+		nc.Close()
+		return nil, err
+	}
+	p, err := c.r.ReadPacket()
+	if err != nil {
+		nc.Close()
+		return nil, err
+	}
+	ack, ok := p.(*packets.Connack)
+	if !ok {
+		nc.Close()
+		return nil, fmt.Errorf("unexpected packet: %s", p)
+	}
+	if ack.Code != packets.CodeAccepted {
+		nc.Close()
+		return nil, fmt.Errorf("connection refused, code: %d", ack.Code)
+	}
+	nc.SetDeadline(time.Time{})
+	return c, nil
+}
+
+// serve subscribes the in rules and sends the queued messages until the connection is broken or the bridge is stopped.
+func (r *remote) serve(c *conn) error {
+	errc := make(chan error, 1)
+	acks := make(chan packets.Packet, 16)
+	go func() {
+		errc <- r.readLoop(c, acks)
+	}()
+	stopPing := make(chan struct{})
+	defer close(stopPing)
+	go r.pingLoop(c, stopPing)
+
+	if len(r.config.In) != 0 {
+		sub := &packets.Subscribe{PacketID: r.nextPacketID()}
+		for _, v := range r.config.In {
+			sub.Topics = append(sub.Topics, packets.Topic{Name: v.Topic, Qos: v.Qos})
+		}
+		if err := c.write(sub); err != nil {
+			return err
+		}
+	}
+	r.setConnected(true)
+	log.Info("bridge connected", zap.String("remote", r.config.Name), zap.String("address", r.config.Address))
+	for {
+		pub := r.front()
+		if pub == nil {
+			select {
+			case <-r.exit:
+				c.write(&packets.Disconnect{})
+				return errStopped
+			case err := <-errc:
+				return err
+			case <-r.notify:
+			}
+			continue
+		}
+		if err := r.send(c, pub, acks, errc); err != nil {
+			if err == errStopped {
+				c.write(&packets.Disconnect{})
+			}
+			return err
+		}
+		r.pop(pub)
+	}
+}
+
+// pingLoop sends the PINGREQ every half of the keep alive, so the connection is kept alive even if the remote
+// rounds down the keep alive timeout, and the PINGRESP is expected within the read deadline.
+func (r *remote) pingLoop(c *conn, stop chan struct{}) {
+	ticker := time.NewTicker(r.config.KeepAlive / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if err := c.write(&packets.Pingreq{}); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// send sends the message and waits for the acknowledgement for the qos 1 and qos 2 messages.
+func (r *remote) send(c *conn, pub *packets.Publish, acks chan packets.Packet, errc chan error) error {
+	if pub.Qos == packets.QOS_0 {
+		return c.write(pub)
+	}
+	if pub.PacketID == 0 {
+		pub.PacketID = r.nextPacketID()
+	}
+	if err := c.write(pub); err != nil {
+		return err
+	}
+	// the message is resent with the dup flag after reconnecting.
+	r.mu.Lock()
+	pub.Dup = true
+	r.mu.Unlock()
+	timer := time.NewTimer(r.config.AckTimeout)
+	defer timer.Stop()
+	for {
+		select {
+		case <-r.exit:
+			return errStopped
+		case err := <-errc:
+			return err
+		case <-timer.C:
+			return errAckTimeout
+		case p := <-acks:
+			switch p := p.(type) {
+			case *packets.Puback:
+				if pub.Qos == packets.QOS_1 && p.PacketID == pub.PacketID {
+					return nil
+				}
+			case *packets.Pubrec:
+				if pub.Qos == packets.QOS_2 && p.PacketID == pub.PacketID {
+					if err := c.write(p.NewPubrel()); err != nil {
+						return err
+					}
+				}
+			case *packets.Pubcomp:
+				if pub.Qos == packets.QOS_2 && p.PacketID == pub.PacketID {
+					return nil
+				}
+			}
+		}
+	}
+}
+
+// readLoop reads the packets from the remote, the messages are published locally
+// and the acknowledgements are passed to the sender.
+func (r *remote) readLoop(c *conn, acks chan packets.Packet) error {
+	// awaitRel is the packet ids of the received qos 2 messages which have not been released.
+	awaitRel := make(map[packets.PacketID]bool)
+	for {
+		c.SetReadDeadline(time.Now().Add(r.config.KeepAlive * 3 / 2))
+		p, err := c.r.ReadPacket()
+		if err != nil {
+			return err
+		}
+		switch p := p.(type) {
+		case *packets.Publish:
+			switch p.Qos {
+			case packets.QOS_0:
+				r.publish(p)
+			case packets.QOS_1:
+				r.publish(p)
+				err = c.write(p.NewPuback())
+			case packets.QOS_2:
+				if !awaitRel[p.PacketID] {
+					awaitRel[p.PacketID] = true
+					r.publish(p)
+				}
+				err = c.write(p.NewPubrec())
+			}
+		case *packets.Pubrel:
+			delete(awaitRel, p.PacketID)
+			err = c.write(p.NewPubcomp())
+		case *packets.Puback, *packets.Pubrec, *packets.Pubcomp:
+			select {
+			case acks <- p:
+			default:
+			}
+		case *packets.Suback:
+			for i, code := range p.Payload {
+				if code == packets.SUBSCRIBE_FAILURE && i < len(r.config.In) {
+					log.Warn("bridge subscription rejected by the remote",
+						zap.String("remote", r.config.Name),
+						zap.String("topic", r.config.In[i].Topic),
+					)
+				}
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// publish publishes the message received from the remote locally.
+func (r *remote) publish(p *packets.Publish) {
+	rule, ok := match(r.config.In, string(p.TopicName))
+	if !ok {
+		log.Debug("dropping the message which matches no in rule",
+			zap.String("remote", r.config.Name),
+			zap.String("topic", string(p.TopicName)),
+		)
+		return
+	}
+	topic := rule.Prefix + string(p.TopicName)
+	qos := minQos(p.Qos, rule.Qos)
+	if p.Retain {
+		if len(p.Payload) == 0 {
+			r.service.RetainedStore().Remove(topic)
+		} else {
+			r.service.RetainedStore().AddOrReplace(gmqtt.NewMessage(topic, p.Payload, qos, gmqtt.Retained(true)))
+		}
+	}
+	r.service.PublishService().Publish(gmqtt.NewMessage(topic, p.Payload, qos))
+}
@@ -0,0 +1,243 @@
+package bridge
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+
+	"github.com/DrmagicE/gmqtt"
+	"github.com/DrmagicE/gmqtt/pkg/packets"
+	"github.com/DrmagicE/gmqtt/pkg/spool"
+)
+
+func init() {
+	log = zap.NewNop()
+}
+
+// fakeBroker is the remote broker which accepts the bridge connections and records the received messages.
+type fakeBroker struct {
+	ln net.Listener
+
+	mu sync.Mutex
+	// ack is whether to acknowledge the received messages.
+	ack   bool
+	pubs  []*packets.Publish
+	conns []net.Conn
+	// out is the messages sent to the bridge once it connects.
+	out []*packets.Publish
+}
+
+// listen starts the broker on the address, "127.0.0.1:0" picks a free port.
+func listen(t *testing.T, addr string, ack bool) *fakeBroker {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &fakeBroker{ln: ln, ack: ack}
+	go b.serve()
+	return b
+}
+
+func (b *fakeBroker) addr() string {
+	return b.ln.Addr().String()
+}
+
+func (b *fakeBroker) close() {
+	b.ln.Close()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, c := range b.conns {
+		c.Close()
+	}
+}
+
+func (b *fakeBroker) serve() {
+	for {
+		c, err := b.ln.Accept()
+		if err != nil {
+			return
+		}
+		b.mu.Lock()
+		b.conns = append(b.conns, c)
+		b.mu.Unlock()
+		go b.handle(c)
+	}
+}
+
+func (b *fakeBroker) handle(c net.Conn) {
+	defer c.Close()
+	r, w := packets.NewReader(c), packets.NewWriter(c)
+	if _, err := r.ReadPacket(); err != nil {
+		return
+	}
+	if err := w.WriteAndFlush(&packets.Connack{Code: packets.CodeAccepted}); err != nil {
+		return
+	}
+	b.mu.Lock()
+	out := b.out
+	b.mu.Unlock()
+	for _, p := range out {
+		if err := w.WriteAndFlush(p); err != nil {
+			return
+		}
+	}
+	for {
+		p, err := r.ReadPacket()
+		if err != nil {
+			return
+		}
+		switch p := p.(type) {
+		case *packets.Publish:
+			b.mu.Lock()
+			b.pubs = append(b.pubs, p)
+			ack := b.ack
+			b.mu.Unlock()
+			if ack && p.Qos == packets.QOS_1 {
+				err = w.WriteAndFlush(p.NewPuback())
+			}
+		case *packets.Subscribe:
+			err = w.WriteAndFlush(p.NewSubBack())
+		case *packets.Pingreq:
+			err = w.WriteAndFlush(p.NewPingresp())
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// received returns the payloads of the received messages.
+func (b *fakeBroker) received() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var rs []string
+	for _, p := range b.pubs {
+		rs = append(rs, string(p.Payload))
+	}
+	return rs
+}
+
+func sequence(from, to int) []string {
+	var s []string
+	for i := from; i < to; i++ {
+		s = append(s, strconv.Itoa(i))
+	}
+	return s
+}
+
+func testRemote(address string) Remote {
+	r := Remote{
+		Name:              "remote",
+		Address:           address,
+		Out:               []Rule{{Topic: "a/#", Qos: packets.QOS_1}},
+		MinReconnectDelay: 10 * time.Millisecond,
+		MaxReconnectDelay: 20 * time.Millisecond,
+		AckTimeout:        100 * time.Millisecond,
+	}
+	r.setDefaults()
+	return r
+}
+
+// freeAddr returns an address which nothing listens on.
+func freeAddr(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	return ln.Addr().String()
+}
+
+func TestRemote_Spill(t *testing.T) {
+	a := assert.New(t)
+	dir, err := ioutil.TempDir("", "bridge")
+	if !a.NoError(err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	addr := freeAddr(t)
+	spill, err := spool.Open(dir, spool.Options{})
+	if !a.NoError(err) {
+		return
+	}
+	r, err := newRemote(testRemote(addr), nil, nil, spill)
+	if !a.NoError(err) {
+		return
+	}
+	r.start()
+
+	// the remote is down, the messages are spilled.
+	for i := 0; i < 20; i++ {
+		r.forward(gmqtt.NewMessage("a/b", []byte(strconv.Itoa(i)), packets.QOS_1))
+	}
+	s := r.status()
+	a.False(s.Connected)
+	a.Equal(0, s.Queued)
+	a.Equal(20, s.Spilled)
+
+	// the remote is up but never acknowledges, the message being sent stays in the spill.
+	b := listen(t, addr, false)
+	a.Eventually(func() bool { return len(b.received()) > 0 }, 2*time.Second, 10*time.Millisecond)
+	r.stop()
+	b.close()
+	spill, err = spool.Open(dir, spool.Options{})
+	if !a.NoError(err) {
+		return
+	}
+	a.Equal(20, spill.Len())
+
+	// the spilled messages are sent in order after restarting and reconnecting,
+	// and the new messages are sent after them.
+	b = listen(t, addr, true)
+	defer b.close()
+	r, err = newRemote(testRemote(addr), nil, nil, spill)
+	if !a.NoError(err) {
+		return
+	}
+	r.start()
+	defer r.stop()
+	a.Eventually(func() bool { return r.status().Connected }, 2*time.Second, 10*time.Millisecond)
+	for i := 20; i < 25; i++ {
+		r.forward(gmqtt.NewMessage("a/b", []byte(strconv.Itoa(i)), packets.QOS_1))
+	}
+	a.Eventually(func() bool { return len(b.received()) == 25 }, 2*time.Second, 10*time.Millisecond)
+	a.Equal(sequence(0, 25), b.received())
+	s = r.status()
+	a.Equal(0, s.Spilled)
+	a.Equal(0, s.Queued)
+}
+
+func TestRemote_SpillError(t *testing.T) {
+	a := assert.New(t)
+	dir, err := ioutil.TempDir("", "bridge")
+	if !a.NoError(err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	spill, err := spool.Open(dir, spool.Options{})
+	if !a.NoError(err) {
+		return
+	}
+	config := testRemote(freeAddr(t))
+	config.MaxQueue = 3
+	r, err := newRemote(config, nil, nil, spill)
+	if !a.NoError(err) {
+		return
+	}
+	// the spill fails once it is closed, the messages are queued in memory and the oldest is dropped.
+	spill.Close()
+	for i := 0; i < 5; i++ {
+		r.forward(gmqtt.NewMessage("a/b", []byte(strconv.Itoa(i)), packets.QOS_1))
+	}
+	s := r.status()
+	a.EqualValues(5, s.SpillErrors)
+	a.Equal(3, s.Queued)
+	a.Equal("2", string(r.front().Payload))
+}
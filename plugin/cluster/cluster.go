@@ -0,0 +1,783 @@
+// Package cluster runs multiple gmqtt nodes as a cluster.
+// The nodes gossip the membership by memberlist and replicate the routing table derived from the subscription store,
+// the messages are forwarded to the nodes which have matching subscribers, and the session of a client is taken over
+// by the node which the client reconnects to.
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/memberlist"
+	"go.uber.org/zap"
+
+	"github.com/DrmagicE/gmqtt"
+	"github.com/DrmagicE/gmqtt/pkg/packets"
+	"github.com/DrmagicE/gmqtt/pkg/spool"
+	"github.com/DrmagicE/gmqtt/subscription/notify"
+)
+
+const name = "cluster"
+
+var log *zap.Logger
+
+const (
+	defaultBindAddr = "0.0.0.0:7946"
+	// queueSize is the number of the messages buffered for each node, the messages are dropped when the buffer is full
+	// unless they are spilled to disk.
+	queueSize = 10000
+	// minRetryDelay and maxRetryDelay are the bounds of the exponential backoff of resending the spilled messages.
+	minRetryDelay = time.Second
+	maxRetryDelay = time.Minute
+	// leaveTimeout is the time to wait for the leave message to be gossiped when the plugin is unloaded.
+	leaveTimeout = 5 * time.Second
+)
+
+var errNotNotifyingStore = errors.New("cluster requires the subscription store to be *notify.NotifyingStore, " +
+	"use gmqtt.WithSubscriptionStore(notify.NewStore(...))")
+
+// Option is the option of the Cluster.
+type Option func(c *Cluster)
+
+// WithNodeName sets the unique name of the node, default to the hostname.
+func WithNodeName(name string) Option {
+	return func(c *Cluster) {
+		c.nodeName = name
+	}
+}
+
+// WithBindAddr sets the "host:port" which the gossip listens on, default to "0.0.0.0:7946".
+func WithBindAddr(addr string) Option {
+	return func(c *Cluster) {
+		c.bindAddr = addr
+	}
+}
+
+// WithAdvertiseAddr sets the "host:port" advertised to the other nodes, default to the bind address.
+func WithAdvertiseAddr(addr string) Option {
+	return func(c *Cluster) {
+		c.advertiseAddr = addr
+	}
+}
+
+// WithJoin sets the "host:port" of the existing nodes to join, the cluster is joined once any of them is reachable.
+func WithJoin(addrs ...string) Option {
+	return func(c *Cluster) {
+		c.join = append(c.join, addrs...)
+	}
+}
+
+// WithSecretKey sets the key which encrypts the traffic between the nodes, the key must be 16, 24 or 32 bytes.
+func WithSecretKey(key []byte) Option {
+	return func(c *Cluster) {
+		c.secretKey = key
+	}
+}
+
+// WithSpill spills the messages to the segment files in dir once the buffer of a node is full or the node is
+// unreachable, instead of dropping them. The messages of each node are stored in the sub directory named by
+// the escaped node name, and they are sent in order once the node is reachable again, including the ones spilled
+// before the node left the cluster. The opts limit the size and the age of the spilled messages.
+func WithSpill(dir string, opts spool.Options) Option {
+	return func(c *Cluster) {
+		c.spillDir = dir
+		c.spillOpts = opts
+	}
+}
+
+// Member is the node of the cluster.
+type Member struct {
+	Name string
+	Addr string
+	// Routes is the number of the topic filters subscribed on the node.
+	Routes int
+	// Queued is the number of the messages buffered in memory for the node.
+	Queued int
+	// Spilled and SpilledBytes are the number and the size of the messages spilled to disk for the node.
+	Spilled      int
+	SpilledBytes int64
+	// SpillErrors is the number of the messages which failed to spill for the node.
+	SpillErrors uint64
+	// Lag is the time the oldest unsent message has been waiting, 0 if nothing is waiting.
+	Lag time.Duration
+}
+
+// outMsg is the message queued for a node.
+type outMsg struct {
+	b []byte
+	// at is the time the message was queued.
+	at time.Time
+}
+
+// peer sends the messages to a remote node in order.
+type peer struct {
+	node  *memberlist.Node
+	queue chan *outMsg
+	done  chan struct{}
+	// exited is closed once the sendLoop exits.
+	exited chan struct{}
+	// spill is shared by the peers of the same node, nil if WithSpill is not set.
+	spill *spool.Spool
+	// epoch is the creation time of the peer, the messages sent by each peer are sequenced from 1, see inOrder.
+	// seq is the sequence of the last message sent, and failed is whether sending it failed, in which case
+	// the next message reuses the sequence. They are only accessed by the sendLoop.
+	epoch  uint64
+	seq    uint64
+	failed bool
+
+	mu sync.Mutex
+	// spilling is whether the messages are pushed to the spill. Once it is set, the buffered messages are sent
+	// first and then the spilled ones, and it is cleared when the spill is drained, so the order is kept.
+	spilling bool
+	// spillErrors is the number of the messages which failed to spill.
+	spillErrors uint64
+	// sendingAt is the queued time of the message being sent.
+	sendingAt time.Time
+}
+
+// enqueue queues the message, it is spilled if the peer is spilling or the buffer is full.
+// If spilling fails, the message is buffered instead, which may be sent before the spilled ones,
+// or dropped if the buffer is full.
+func (p *peer) enqueue(b []byte) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.spilling {
+		select {
+		case p.queue <- &outMsg{b: b, at: time.Now()}:
+			return
+		default:
+		}
+		if p.spill == nil {
+			log.Warn("cluster queue is full, dropping message", zap.String("node", p.node.Name))
+			return
+		}
+		p.spilling = true
+	}
+	if err := p.spill.Push(b); err != nil {
+		p.spillErrors++
+		select {
+		case p.queue <- &outMsg{b: b, at: time.Now()}:
+			log.Error("spilling cluster message error, buffering it", zap.String("node", p.node.Name), zap.Error(err))
+		default:
+			log.Error("spilling cluster message error, dropping it", zap.String("node", p.node.Name), zap.Error(err))
+		}
+	}
+}
+
+// spillQueued spills the failed message and the buffered ones, it does nothing if the spill is not set.
+func (p *peer) spillQueued(failed *outMsg) {
+	if p.spill == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.spilling = true
+	for m := failed; ; {
+		if m != nil {
+			if err := p.spill.Push(m.b); err != nil {
+				p.spillErrors++
+				log.Error("spilling cluster message error, dropping it", zap.String("node", p.node.Name), zap.Error(err))
+			}
+		}
+		select {
+		case m = <-p.queue:
+		default:
+			return
+		}
+	}
+}
+
+func (p *peer) isSpilling() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.spilling
+}
+
+// stopSpilling clears the spilling flag if the spill is drained.
+func (p *peer) stopSpilling() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.spill.Len() == 0 {
+		p.spilling = false
+	}
+}
+
+func (p *peer) setSending(at time.Time) {
+	p.mu.Lock()
+	p.sendingAt = at
+	p.mu.Unlock()
+}
+
+// member fills the queue stats of the member.
+func (p *peer) member(m *Member) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	m.Queued = len(p.queue)
+	if p.spill != nil {
+		m.Spilled = p.spill.Len()
+		m.SpilledBytes = p.spill.Bytes()
+		m.SpillErrors = p.spillErrors
+	}
+	if !p.sendingAt.IsZero() {
+		m.Lag = time.Since(p.sendingAt)
+	}
+}
+
+// Cluster is the plugin which runs gmqtt in cluster mode.
+type Cluster struct {
+	nodeName      string
+	bindAddr      string
+	advertiseAddr string
+	join          []string
+	secretKey     []byte
+	spillDir      string
+	spillOpts     spool.Options
+
+	service    gmqtt.Server
+	store      *notify.NotifyingStore
+	list       *memberlist.Memberlist
+	broadcasts *memberlist.TransmitLimitedQueue
+	routes     *routes
+	order      *inOrder
+
+	peersMu sync.Mutex
+	peers   map[string]*peer
+	// spills is the spill of each node, it is kept after the node leaves.
+	spills map[string]*spool.Spool
+	wg     sync.WaitGroup
+}
+
+// New returns the Cluster plugin.
+func New(opts ...Option) *Cluster {
+	c := &Cluster{
+		bindAddr: defaultBindAddr,
+		peers:    make(map[string]*peer),
+		spills:   make(map[string]*spool.Spool),
+	}
+	for _, fn := range opts {
+		fn(c)
+	}
+	return c
+}
+
+func splitHostPort(addr string) (string, int, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", 0, err
+	}
+	p, err := strconv.Atoi(port)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid port: %q", port)
+	}
+	return host, p, nil
+}
+
+func (c *Cluster) Load(service gmqtt.Server) error {
+	log = gmqtt.Logger("plugin/" + name)
+	store, ok := service.SubscriptionStore().(*notify.NotifyingStore)
+	if !ok {
+		return errNotNotifyingStore
+	}
+	c.service = service
+	c.store = store
+	if c.nodeName == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return err
+		}
+		c.nodeName = hostname
+	}
+	conf := memberlist.DefaultLANConfig()
+	conf.Name = c.nodeName
+	host, port, err := splitHostPort(c.bindAddr)
+	if err != nil {
+		return err
+	}
+	conf.BindAddr, conf.BindPort = host, port
+	conf.AdvertisePort = port
+	if c.advertiseAddr != "" {
+		host, port, err := splitHostPort(c.advertiseAddr)
+		if err != nil {
+			return err
+		}
+		conf.AdvertiseAddr, conf.AdvertisePort = host, port
+	}
+	conf.SecretKey = c.secretKey
+	conf.Logger = zap.NewStdLog(log)
+	conf.Delegate = &delegate{c}
+	conf.Events = &eventDelegate{c}
+
+	c.routes = newRoutes(c.nodeName)
+	c.order = newInOrder(c.handle, gapTimeout)
+	// the broadcasts are pulled by the gossip once the memberlist is created.
+	c.broadcasts = &memberlist.TransmitLimitedQueue{
+		NumNodes:       c.numNodes,
+		RetransmitMult: conf.RetransmitMult,
+	}
+	store.AddListener(c.onSubscriptionChanged)
+	store.Iterate(func(clientID string, topic packets.Topic) bool {
+		c.routes.addLocal(topic.Name)
+		return true
+	})
+
+	list, err := memberlist.Create(conf)
+	if err != nil {
+		return err
+	}
+	c.list = list
+	if len(c.join) != 0 {
+		if _, err := list.Join(c.join); err != nil {
+			log.Warn("joining cluster error, running as a standalone node", zap.Strings("join", c.join), zap.Error(err))
+		}
+	}
+	return nil
+}
+
+func (c *Cluster) Unload() error {
+	if c.list != nil {
+		if err := c.list.Leave(leaveTimeout); err != nil {
+			log.Warn("leaving cluster error", zap.Error(err))
+		}
+		c.list.Shutdown()
+	}
+	c.peersMu.Lock()
+	for k, p := range c.peers {
+		close(p.done)
+		delete(c.peers, k)
+	}
+	c.peersMu.Unlock()
+	c.wg.Wait()
+	if c.order != nil {
+		c.order.close()
+	}
+	for k, s := range c.spills {
+		s.Close()
+		delete(c.spills, k)
+	}
+	return nil
+}
+
+func (c *Cluster) HookWrapper() gmqtt.HookWrapper {
+	return gmqtt.HookWrapper{
+		OnConnectedWrapper:  c.OnConnectedWrapper,
+		OnMsgArrivedWrapper: c.OnMsgArrivedWrapper,
+	}
+}
+
+func (c *Cluster) Name() string {
+	return name
+}
+
+// Members returns the alive nodes of the cluster, including the local node.
+func (c *Cluster) Members() []Member {
+	nodes := c.list.Members()
+	m := make([]Member, 0, len(nodes))
+	c.peersMu.Lock()
+	defer c.peersMu.Unlock()
+	for _, v := range nodes {
+		member := Member{
+			Name:   v.Name,
+			Addr:   v.Address(),
+			Routes: c.routes.count(v.Name),
+		}
+		if p, ok := c.peers[v.Name]; ok {
+			p.member(&member)
+		}
+		m = append(m, member)
+	}
+	return m
+}
+
+// OnConnectedWrapper requests the other nodes to close the client and hand over its session.
+func (c *Cluster) OnConnectedWrapper(connected gmqtt.OnConnected) gmqtt.OnConnected {
+	return func(ctx context.Context, client gmqtt.Client) {
+		connected(ctx, client)
+		b, err := encode(msgTakeover, &takeover{
+			Node:         c.nodeName,
+			ClientID:     client.OptionsReader().ClientID(),
+			CleanSession: client.OptionsReader().CleanSession(),
+		})
+		if err != nil {
+			log.Error("encoding takeover error", zap.Error(err))
+			return
+		}
+		c.sendToAll(b)
+	}
+}
+
+// OnMsgArrivedWrapper forwards the accepted messages to the nodes which have matching subscribers.
+// The retained messages are forwarded to all nodes so that every node serves them.
+// The messages forwarded from the other nodes are published by the PublishService and do not arrive here,
+// so they are never forwarded again.
+func (c *Cluster) OnMsgArrivedWrapper(arrived gmqtt.OnMsgArrived) gmqtt.OnMsgArrived {
+	return func(ctx context.Context, client gmqtt.Client, msg packets.Message) (valid bool) {
+		valid = arrived(ctx, client, msg)
+		if !valid {
+			return false
+		}
+		var nodes []string
+		if !msg.Retained() {
+			nodes = c.routes.matched(msg.Topic())
+			if len(nodes) == 0 {
+				return true
+			}
+		}
+		b, err := encode(msgPublish, &publishMessage{
+			Topic:    msg.Topic(),
+			Payload:  msg.Payload(),
+			Qos:      msg.Qos(),
+			Retained: msg.Retained(),
+		})
+		if err != nil {
+			log.Error("encoding publish error", zap.Error(err))
+			return true
+		}
+		if msg.Retained() {
+			c.sendToAll(b)
+		} else {
+			for _, v := range nodes {
+				c.send(v, b)
+			}
+		}
+		return true
+	}
+}
+
+// onSubscriptionChanged is the notify.Listener which maintains the local routing table
+// and gossips the filters which are added or removed on the node.
+func (c *Cluster) onSubscriptionChanged(event notify.Event) {
+	var u *routeUpdate
+	var changed bool
+	switch e := event.(type) {
+	case *notify.SubscribeEvent:
+		if e.AlreadyExisted {
+			return
+		}
+		u, changed = c.routes.addLocal(e.Topic.Name)
+	case *notify.UnsubscribeEvent:
+		u, changed = c.routes.removeLocal(e.TopicFilter)
+	}
+	if !changed {
+		return
+	}
+	b, err := encode(msgRoute, u)
+	if err != nil {
+		log.Error("encoding route error", zap.Error(err))
+		return
+	}
+	c.broadcasts.QueueBroadcast(&broadcast{filter: u.Filter, msg: b})
+}
+
+// numNodes returns the number of the nodes, including the local node.
+func (c *Cluster) numNodes() int {
+	c.peersMu.Lock()
+	defer c.peersMu.Unlock()
+	return len(c.peers) + 1
+}
+
+// send queues the message to the node.
+func (c *Cluster) send(node string, b []byte) {
+	c.peersMu.Lock()
+	p, ok := c.peers[node]
+	c.peersMu.Unlock()
+	if !ok {
+		return
+	}
+	p.enqueue(b)
+}
+
+// sendToAll queues the message to all the other nodes.
+func (c *Cluster) sendToAll(b []byte) {
+	c.peersMu.Lock()
+	defer c.peersMu.Unlock()
+	for _, p := range c.peers {
+		p.enqueue(b)
+	}
+}
+
+func (c *Cluster) addPeer(node *memberlist.Node) {
+	c.peersMu.Lock()
+	defer c.peersMu.Unlock()
+	old, ok := c.peers[node.Name]
+	if ok {
+		close(old.done)
+	}
+	p := &peer{
+		node:   node,
+		queue:  make(chan *outMsg, queueSize),
+		done:   make(chan struct{}),
+		exited: make(chan struct{}),
+		spill:  c.openSpill(node.Name),
+		epoch:  uint64(time.Now().UnixNano()),
+	}
+	// the previously spilled messages are sent before the new ones.
+	p.spilling = p.spill != nil
+	c.peers[node.Name] = p
+	c.wg.Add(1)
+	go func() {
+		// the spill is drained by one peer at a time.
+		if old != nil {
+			<-old.exited
+		}
+		c.sendLoop(p)
+	}()
+}
+
+// openSpill returns the spill of the node, nil if WithSpill is not set or the spill can not be opened.
+// It must be called with peersMu held.
+func (c *Cluster) openSpill(node string) *spool.Spool {
+	if c.spillDir == "" {
+		return nil
+	}
+	if s, ok := c.spills[node]; ok {
+		return s
+	}
+	s, err := spool.Open(filepath.Join(c.spillDir, url.PathEscape(node)), c.spillOpts)
+	if err != nil {
+		log.Error("opening cluster spill error", zap.String("node", node), zap.Error(err))
+		return nil
+	}
+	c.spills[node] = s
+	return s
+}
+
+func (c *Cluster) removePeer(node string) {
+	c.peersMu.Lock()
+	defer c.peersMu.Unlock()
+	if p, ok := c.peers[node]; ok {
+		close(p.done)
+		delete(c.peers, node)
+	}
+}
+
+// sendReliable sends the message to the node with the next sequence of the peer.
+func (c *Cluster) sendReliable(p *peer, b []byte) error {
+	if !p.failed {
+		p.seq++
+	}
+	err := c.list.SendReliable(p.node, sequenced(c.nodeName, p.epoch, p.seq, b))
+	p.failed = err != nil
+	return err
+}
+
+// sendLoop sends the buffered messages and then the spilled ones, until the peer is removed.
+// If sending a buffered message fails, it is spilled with the following messages if the spill is set,
+// and the spilled messages are resent with the exponential backoff.
+func (c *Cluster) sendLoop(p *peer) {
+	defer c.wg.Done()
+	defer close(p.exited)
+	// the buffered messages are kept for the node rejoining.
+	defer p.spillQueued(nil)
+	delay := minRetryDelay
+	for {
+		var m *outMsg
+		select {
+		case <-p.done:
+			return
+		case m = <-p.queue:
+		default:
+		}
+		if m == nil && p.isSpilling() {
+			rec, err := p.spill.PeekRecord()
+			if err == spool.ErrEmpty {
+				p.stopSpilling()
+				continue
+			}
+			if err != nil {
+				log.Error("reading spilled cluster message error", zap.String("node", p.node.Name), zap.Error(err))
+				if err := p.spill.Pop(); err != nil {
+					return
+				}
+				continue
+			}
+			p.setSending(rec.At)
+			if err := c.sendReliable(p, rec.Data); err != nil {
+				log.Warn("sending to node error", zap.String("node", p.node.Name), zap.Error(err), zap.Duration("retry_delay", delay))
+				select {
+				case <-p.done:
+					return
+				case <-time.After(delay):
+				}
+				delay *= 2
+				if delay > maxRetryDelay {
+					delay = maxRetryDelay
+				}
+				continue
+			}
+			delay = minRetryDelay
+			// the message is not removed if it has been dropped by the limits while being sent.
+			if err := p.spill.Remove(rec); err != nil {
+				return
+			}
+			continue
+		}
+		if m == nil {
+			p.setSending(time.Time{})
+			select {
+			case <-p.done:
+				return
+			case m = <-p.queue:
+			}
+		}
+		p.setSending(m.at)
+		if err := c.sendReliable(p, m.b); err != nil {
+			log.Warn("sending to node error", zap.String("node", p.node.Name), zap.Error(err))
+			p.spillQueued(m)
+		}
+	}
+}
+
+// handle handles the message received from the other nodes.
+func (c *Cluster) handle(b []byte) {
+	if len(b) != 0 && msgType(b[0]) == msgSequenced {
+		node, epoch, seq, msg, err := decodeSequenced(b)
+		if err != nil {
+			log.Warn("decoding cluster message error", zap.Error(err))
+			return
+		}
+		c.order.receive(node, epoch, seq, msg)
+		return
+	}
+	t, v, err := decode(b)
+	if err != nil {
+		log.Warn("decoding cluster message error", zap.Error(err))
+		return
+	}
+	switch t {
+	case msgRoute:
+		c.routes.update(v.(*routeUpdate))
+	case msgPublish:
+		m := v.(*publishMessage)
+		if m.Retained {
+			if len(m.Payload) == 0 {
+				c.service.RetainedStore().Remove(m.Topic)
+			} else {
+				c.service.RetainedStore().AddOrReplace(gmqtt.NewMessage(m.Topic, m.Payload, m.Qos, gmqtt.Retained(true)))
+			}
+		}
+		c.service.PublishService().Publish(gmqtt.NewMessage(m.Topic, m.Payload, m.Qos))
+	case msgTakeover:
+		// closing the client waits for the unregister process, which must not block the gossip.
+		go c.handleTakeover(v.(*takeover))
+	case msgTakeoverAck:
+		ack := v.(*takeoverAck)
+		if c.service.Client(ack.ClientID) == nil {
+			return
+		}
+		c.store.Subscribe(ack.ClientID, ack.Topics...)
+		log.Info("session taken over", zap.String("client_id", ack.ClientID), zap.Int("subscriptions", len(ack.Topics)))
+	}
+}
+
+// handleTakeover closes the local client which has connected to another node,
+// and hands over the subscriptions of its session.
+func (c *Cluster) handleTakeover(t *takeover) {
+	if client := c.service.Client(t.ClientID); client != nil {
+		<-client.Close()
+		log.Info("client connected to another node, closed", zap.String("client_id", t.ClientID), zap.String("node", t.Node))
+	}
+	topics := c.store.GetClientSubscriptions(t.ClientID)
+	if len(topics) == 0 {
+		return
+	}
+	c.store.UnsubscribeAll(t.ClientID)
+	if t.CleanSession {
+		return
+	}
+	b, err := encode(msgTakeoverAck, &takeoverAck{ClientID: t.ClientID, Topics: topics})
+	if err != nil {
+		log.Error("encoding takeover ack error", zap.Error(err))
+		return
+	}
+	c.send(t.Node, b)
+}
+
+// broadcast is the gossiped route update, the newer update of the filter invalidates the queued one.
+type broadcast struct {
+	filter string
+	msg    []byte
+}
+
+func (b *broadcast) Invalidates(other memberlist.Broadcast) bool {
+	o, ok := other.(*broadcast)
+	return ok && o.filter == b.filter
+}
+
+func (b *broadcast) Message() []byte {
+	return b.msg
+}
+
+func (b *broadcast) Finished() {}
+
+// delegate implements memberlist.Delegate.
+type delegate struct {
+	c *Cluster
+}
+
+func (d *delegate) NodeMeta(limit int) []byte {
+	return nil
+}
+
+func (d *delegate) NotifyMsg(b []byte) {
+	// the buffer is reused by memberlist, but the message is decoded before returning.
+	d.c.handle(b)
+}
+
+func (d *delegate) GetBroadcasts(overhead, limit int) [][]byte {
+	return d.c.broadcasts.GetBroadcasts(overhead, limit)
+}
+
+func (d *delegate) LocalState(join bool) []byte {
+	b, err := encode(msgRoute, d.c.routes.localState())
+	if err != nil {
+		log.Error("encoding route state error", zap.Error(err))
+		return nil
+	}
+	return b
+}
+
+func (d *delegate) MergeRemoteState(buf []byte, join bool) {
+	if len(buf) == 0 || msgType(buf[0]) != msgRoute {
+		return
+	}
+	s := &routeState{}
+	if err := json.Unmarshal(buf[1:], s); err != nil {
+		log.Warn("decoding route state error", zap.Error(err))
+		return
+	}
+	d.c.routes.merge(s)
+}
+
+// eventDelegate implements memberlist.EventDelegate.
+type eventDelegate struct {
+	c *Cluster
+}
+
+func (e *eventDelegate) NotifyJoin(node *memberlist.Node) {
+	if node.Name == e.c.nodeName {
+		return
+	}
+	log.Info("node joined", zap.String("node", node.Name), zap.String("addr", node.Address()))
+	e.c.addPeer(node)
+}
+
+func (e *eventDelegate) NotifyLeave(node *memberlist.Node) {
+	if node.Name == e.c.nodeName {
+		return
+	}
+	log.Info("node left", zap.String("node", node.Name), zap.String("addr", node.Address()))
+	e.c.removePeer(node.Name)
+	e.c.routes.removeNode(node.Name)
+	e.c.order.remove(node.Name)
+}
+
+func (e *eventDelegate) NotifyUpdate(node *memberlist.Node) {}
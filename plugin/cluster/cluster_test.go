@@ -0,0 +1,138 @@
+package cluster
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/memberlist"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+
+	"github.com/DrmagicE/gmqtt/pkg/spool"
+)
+
+func init() {
+	log = zap.NewNop()
+}
+
+// recorder is the memberlist.Delegate which records the received sequenced messages in order.
+type recorder struct {
+	order *inOrder
+	mu    sync.Mutex
+	msgs  []string
+}
+
+func newRecorder() *recorder {
+	r := &recorder{}
+	r.order = newInOrder(func(b []byte) {
+		r.mu.Lock()
+		r.msgs = append(r.msgs, string(b))
+		r.mu.Unlock()
+	}, gapTimeout)
+	return r
+}
+
+func (r *recorder) NodeMeta(limit int) []byte { return nil }
+
+func (r *recorder) NotifyMsg(b []byte) {
+	node, epoch, seq, msg, err := decodeSequenced(b)
+	if err == nil {
+		r.order.receive(node, epoch, seq, msg)
+	}
+}
+
+func (r *recorder) GetBroadcasts(overhead, limit int) [][]byte { return nil }
+
+func (r *recorder) LocalState(join bool) []byte { return nil }
+
+func (r *recorder) MergeRemoteState(buf []byte, join bool) {}
+
+func (r *recorder) received() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.msgs...)
+}
+
+func newTestMemberlist(t *testing.T, name string, port int, d memberlist.Delegate) *memberlist.Memberlist {
+	conf := memberlist.DefaultLocalConfig()
+	conf.Name = name
+	conf.BindAddr = "127.0.0.1"
+	conf.BindPort = port
+	conf.AdvertisePort = port
+	conf.LogOutput = ioutil.Discard
+	conf.Delegate = d
+	list, err := memberlist.Create(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return list
+}
+
+// freePort returns a port which nothing listens on.
+func freePort(t *testing.T) int {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	return ln.Addr().(*net.TCPAddr).Port
+}
+
+func sequence(from, to int) []string {
+	var s []string
+	for i := from; i < to; i++ {
+		s = append(s, strconv.Itoa(i))
+	}
+	return s
+}
+
+func TestCluster_Spill(t *testing.T) {
+	a := assert.New(t)
+	dir, err := ioutil.TempDir("", "cluster")
+	if !a.NoError(err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	c := New(WithNodeName("a"), WithSpill(dir, spool.Options{}))
+	c.list = newTestMemberlist(t, "a", freePort(t), newRecorder())
+	defer c.list.Shutdown()
+
+	port := freePort(t)
+	node := &memberlist.Node{Name: "b", Addr: net.ParseIP("127.0.0.1"), Port: uint16(port)}
+	c.addPeer(node)
+	defer c.Unload()
+
+	// the node is unreachable, the messages are spilled.
+	for i := 0; i < 10; i++ {
+		c.send("b", []byte(strconv.Itoa(i)))
+	}
+	member := func() Member {
+		c.peersMu.Lock()
+		defer c.peersMu.Unlock()
+		var m Member
+		c.peers["b"].member(&m)
+		return m
+	}
+	a.Eventually(func() bool { return member().Spilled == 10 }, 2*time.Second, 10*time.Millisecond)
+
+	// the spilled messages are resent in order once the node is reachable,
+	// and the new messages are sent after them.
+	r := newRecorder()
+	defer r.order.close()
+	list := newTestMemberlist(t, "b", port, r)
+	defer list.Shutdown()
+	a.Eventually(func() bool { return len(r.received()) == 10 }, 5*time.Second, 10*time.Millisecond)
+	for i := 10; i < 15; i++ {
+		c.send("b", []byte(strconv.Itoa(i)))
+	}
+	a.Eventually(func() bool { return len(r.received()) == 15 }, 2*time.Second, 10*time.Millisecond)
+	a.Equal(sequence(0, 15), r.received())
+	m := member()
+	a.Equal(0, m.Spilled)
+	a.Equal(0, m.Queued)
+}
@@ -0,0 +1,105 @@
+package cluster
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+
+	"github.com/DrmagicE/gmqtt/pkg/packets"
+)
+
+// msgType is the first byte of the messages exchanged between the nodes.
+type msgType byte
+
+const (
+	// msgRoute is the gossiped routeUpdate.
+	msgRoute msgType = iota + 1
+	// msgPublish is the publishMessage forwarded to the nodes which have matching subscribers.
+	msgPublish
+	// msgTakeover is the takeover request sent to the other nodes when a client connects.
+	msgTakeover
+	// msgTakeoverAck is the takeoverAck which hands over the subscriptions of the session to the requesting node.
+	msgTakeoverAck
+	// msgSequenced is the message sent to a node with the sequence of the sender, see sequenced.
+	msgSequenced
+)
+
+var errInvalidMessage = errors.New("invalid cluster message")
+
+// publishMessage is the message forwarded from the node which the message arrived.
+type publishMessage struct {
+	Topic    string `json:"topic"`
+	Payload  []byte `json:"payload"`
+	Qos      uint8  `json:"qos"`
+	Retained bool   `json:"retained"`
+}
+
+// takeover requests the other nodes to close the client and hand over its session.
+type takeover struct {
+	Node         string `json:"node"`
+	ClientID     string `json:"client_id"`
+	CleanSession bool   `json:"clean_session"`
+}
+
+// takeoverAck is the subscriptions of the session taken over.
+type takeoverAck struct {
+	ClientID string          `json:"client_id"`
+	Topics   []packets.Topic `json:"topics"`
+}
+
+func encode(t msgType, v interface{}) ([]byte, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte{byte(t)}, b...), nil
+}
+
+func decode(b []byte) (msgType, interface{}, error) {
+	if len(b) == 0 {
+		return 0, nil, errInvalidMessage
+	}
+	var v interface{}
+	t := msgType(b[0])
+	switch t {
+	case msgRoute:
+		v = &routeUpdate{}
+	case msgPublish:
+		v = &publishMessage{}
+	case msgTakeover:
+		v = &takeover{}
+	case msgTakeoverAck:
+		v = &takeoverAck{}
+	default:
+		return 0, nil, errInvalidMessage
+	}
+	if err := json.Unmarshal(b[1:], v); err != nil {
+		return 0, nil, err
+	}
+	return t, v, nil
+}
+
+// sequenced wraps the message sent by the node with the epoch and the sequence of the sender:
+// msgSequenced(1) | epoch(8) | seq(8) | node length(2) | node | message.
+func sequenced(node string, epoch, seq uint64, msg []byte) []byte {
+	b := make([]byte, 19+len(node)+len(msg))
+	b[0] = byte(msgSequenced)
+	binary.BigEndian.PutUint64(b[1:], epoch)
+	binary.BigEndian.PutUint64(b[9:], seq)
+	binary.BigEndian.PutUint16(b[17:], uint16(len(node)))
+	n := copy(b[19:], node)
+	copy(b[19+n:], msg)
+	return b
+}
+
+func decodeSequenced(b []byte) (node string, epoch, seq uint64, msg []byte, err error) {
+	if len(b) < 19 || msgType(b[0]) != msgSequenced {
+		return "", 0, 0, nil, errInvalidMessage
+	}
+	l := 19 + int(binary.BigEndian.Uint16(b[17:]))
+	// the sequenced messages are never nested.
+	if l >= len(b) || msgType(b[l]) == msgSequenced {
+		return "", 0, 0, nil, errInvalidMessage
+	}
+	return string(b[19:l]), binary.BigEndian.Uint64(b[1:]), binary.BigEndian.Uint64(b[9:]), b[l:], nil
+}
@@ -0,0 +1,153 @@
+package cluster
+
+import (
+	"sync"
+	"time"
+)
+
+// gapTimeout is the time to wait for a missing message before the following messages are handled without it.
+const gapTimeout = time.Second
+
+// sender is the receiving state of the messages from a node.
+type sender struct {
+	epoch uint64
+	// next is the sequence of the next message to handle.
+	next uint64
+	// pending is the messages received before next.
+	pending map[uint64][]byte
+	timer   *time.Timer
+}
+
+// inOrder handles the sequenced messages of each node in the order they were sent.
+// memberlist sends each message over a new connection and handles the connections concurrently,
+// so the messages sent in order may arrive out of order. The messages following a missing one are held for up to
+// gapTimeout, and the missing message is skipped afterwards, e.g: it was never sent since the sender was shut down.
+type inOrder struct {
+	handle     func(b []byte)
+	gapTimeout time.Duration
+
+	mu      sync.Mutex
+	senders map[string]*sender
+}
+
+func newInOrder(handle func(b []byte), gapTimeout time.Duration) *inOrder {
+	return &inOrder{
+		handle:     handle,
+		gapTimeout: gapTimeout,
+		senders:    make(map[string]*sender),
+	}
+}
+
+// receive handles the message of the node if it is the next one, otherwise the message is held until the missing
+// ones arrive. The sequences of each epoch start from 1, a new epoch starts when the sender recreates the peer.
+// The message of a previous epoch is handled immediately, and the duplicated message is discarded.
+func (o *inOrder) receive(node string, epoch, seq uint64, msg []byte) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	s := o.senders[node]
+	if s != nil && epoch < s.epoch {
+		o.handle(msg)
+		return
+	}
+	if s == nil || epoch > s.epoch {
+		if s != nil && s.timer != nil {
+			s.timer.Stop()
+		}
+		s = &sender{epoch: epoch, next: 1, pending: make(map[uint64][]byte)}
+		o.senders[node] = s
+	}
+	if seq < s.next {
+		return
+	}
+	if seq > s.next {
+		if _, ok := s.pending[seq]; !ok {
+			// the buffer of msg is reused by memberlist.
+			s.pending[seq] = append([]byte(nil), msg...)
+		}
+		if len(s.pending) > queueSize {
+			o.skip(s)
+			o.drain(node, s)
+			return
+		}
+		o.wait(node, s)
+		return
+	}
+	o.handle(msg)
+	s.next++
+	o.drain(node, s)
+}
+
+// drain handles the pending messages following next, it must be called with the lock held.
+func (o *inOrder) drain(node string, s *sender) {
+	for {
+		msg, ok := s.pending[s.next]
+		if !ok {
+			break
+		}
+		delete(s.pending, s.next)
+		o.handle(msg)
+		s.next++
+	}
+	if len(s.pending) == 0 {
+		if s.timer != nil {
+			s.timer.Stop()
+			s.timer = nil
+		}
+		return
+	}
+	o.wait(node, s)
+}
+
+// wait starts the timer to skip the missing messages, it must be called with the lock held.
+func (o *inOrder) wait(node string, s *sender) {
+	if s.timer != nil {
+		return
+	}
+	var timer *time.Timer
+	timer = time.AfterFunc(o.gapTimeout, func() {
+		o.mu.Lock()
+		defer o.mu.Unlock()
+		if o.senders[node] != s || s.timer != timer {
+			return
+		}
+		s.timer = nil
+		o.skip(s)
+		o.drain(node, s)
+	})
+	s.timer = timer
+}
+
+// skip skips the missing messages before the oldest pending one, it must be called with the lock held.
+func (o *inOrder) skip(s *sender) {
+	first := true
+	for seq := range s.pending {
+		if first || seq < s.next {
+			s.next = seq
+			first = false
+		}
+	}
+}
+
+// remove removes the state of the node which left the cluster.
+func (o *inOrder) remove(node string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if s, ok := o.senders[node]; ok {
+		if s.timer != nil {
+			s.timer.Stop()
+		}
+		delete(o.senders, node)
+	}
+}
+
+// close stops the timers, the pending messages are discarded.
+func (o *inOrder) close() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for node, s := range o.senders {
+		if s.timer != nil {
+			s.timer.Stop()
+		}
+		delete(o.senders, node)
+	}
+}
@@ -0,0 +1,109 @@
+package cluster
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type handled struct {
+	mu   sync.Mutex
+	msgs []string
+}
+
+func (h *handled) handle(b []byte) {
+	h.mu.Lock()
+	h.msgs = append(h.msgs, string(b))
+	h.mu.Unlock()
+}
+
+func (h *handled) get() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]string(nil), h.msgs...)
+}
+
+func TestInOrder(t *testing.T) {
+	a := assert.New(t)
+	h := &handled{}
+	o := newInOrder(h.handle, time.Hour)
+	defer o.close()
+
+	buf := []byte("3")
+	o.receive("a", 1, 3, buf)
+	// the buffer of the pending message is reused by memberlist.
+	buf[0] = 'x'
+	o.receive("a", 1, 2, []byte("2"))
+	a.Len(h.get(), 0)
+	o.receive("a", 1, 1, []byte("1"))
+	a.Equal([]string{"1", "2", "3"}, h.get())
+	// the duplicated messages are discarded.
+	o.receive("a", 1, 2, []byte("2"))
+	a.Equal([]string{"1", "2", "3"}, h.get())
+
+	// the messages of each node are ordered separately.
+	o.receive("b", 1, 1, []byte("b1"))
+	a.Equal([]string{"1", "2", "3", "b1"}, h.get())
+
+	// a new epoch starts from 1, the late messages of the previous epoch are handled immediately.
+	o.receive("a", 2, 2, []byte("e2"))
+	o.receive("a", 1, 4, []byte("4"))
+	o.receive("a", 2, 1, []byte("e1"))
+	a.Equal([]string{"1", "2", "3", "b1", "4", "e1", "e2"}, h.get())
+}
+
+func TestInOrder_Gap(t *testing.T) {
+	a := assert.New(t)
+	h := &handled{}
+	o := newInOrder(h.handle, 50*time.Millisecond)
+	defer o.close()
+
+	o.receive("a", 1, 1, []byte("1"))
+	o.receive("a", 1, 3, []byte("3"))
+	o.receive("a", 1, 4, []byte("4"))
+	o.receive("a", 1, 6, []byte("6"))
+	a.Equal([]string{"1"}, h.get())
+	// the missing messages are skipped after the timeout.
+	a.Eventually(func() bool { return len(h.get()) == 3 }, time.Second, 10*time.Millisecond)
+	a.Equal([]string{"1", "3", "4"}, h.get())
+	a.Eventually(func() bool { return len(h.get()) == 4 }, time.Second, 10*time.Millisecond)
+	a.Equal([]string{"1", "3", "4", "6"}, h.get())
+	// the skipped message is discarded if it arrives late.
+	o.receive("a", 1, 2, []byte("2"))
+	o.receive("a", 1, 7, []byte("7"))
+	a.Equal([]string{"1", "3", "4", "6", "7"}, h.get())
+
+	// the messages received before the node left are discarded.
+	o.receive("b", 1, 2, []byte("b2"))
+	o.remove("b")
+	time.Sleep(100 * time.Millisecond)
+	a.Equal([]string{"1", "3", "4", "6", "7"}, h.get())
+}
+
+func TestSequenced(t *testing.T) {
+	a := assert.New(t)
+	msg, err := encode(msgPublish, &publishMessage{Topic: "a", Payload: []byte("b")})
+	if !a.NoError(err) {
+		return
+	}
+	b := sequenced("node", 1, 2, msg)
+	node, epoch, seq, m, err := decodeSequenced(b)
+	a.NoError(err)
+	a.Equal("node", node)
+	a.EqualValues(1, epoch)
+	a.EqualValues(2, seq)
+	a.Equal(msg, m)
+
+	for _, v := range [][]byte{
+		nil,
+		msg,
+		b[:19],
+		sequenced("node", 1, 2, nil),
+		sequenced("node", 1, 2, b),
+	} {
+		_, _, _, _, err := decodeSequenced(v)
+		a.Equal(errInvalidMessage, err)
+	}
+}
@@ -0,0 +1,190 @@
+package cluster
+
+import (
+	"sync"
+
+	"github.com/DrmagicE/gmqtt/pkg/packets"
+)
+
+// routeUpdate is the broadcast of a local topic filter which is added or removed on the node.
+type routeUpdate struct {
+	Node   string `json:"node"`
+	Seq    uint64 `json:"seq"`
+	Filter string `json:"filter"`
+	Add    bool   `json:"add"`
+}
+
+// routeState is the full routing table of the node, which is exchanged by the periodic push/pull sync.
+type routeState struct {
+	Node string `json:"node"`
+	// Seq is the sequence of the last change of the node.
+	Seq uint64 `json:"seq"`
+	// Filters is the topic filters subscribed on the node, key by filter, value is the sequence of the change
+	// which added the filter.
+	Filters map[string]uint64 `json:"filters"`
+}
+
+// localRoute is the topic filter subscribed by the local clients.
+type localRoute struct {
+	// count is the number of the local clients which subscribe the filter.
+	count int
+	seq   uint64
+}
+
+// remoteRoute is the latest change of a topic filter on a remote node.
+// The removed filters are kept as tombstones until a newer full state of the node is merged,
+// so that the delayed broadcasts can not bring them back.
+type remoteRoute struct {
+	seq     uint64
+	present bool
+}
+
+// routes is the routing table of the cluster, it records the topic filters subscribed on each node.
+// Each change of the local filters is assigned an increasing sequence, the changes of a filter on a remote node
+// are applied only if they are newer than the known one, so the broadcasts and the push/pull syncs can arrive in
+// any order.
+type routes struct {
+	mu     sync.RWMutex
+	node   string
+	seq    uint64
+	local  map[string]*localRoute
+	remote map[string]map[string]*remoteRoute
+}
+
+func newRoutes(node string) *routes {
+	return &routes{
+		node:   node,
+		local:  make(map[string]*localRoute),
+		remote: make(map[string]map[string]*remoteRoute),
+	}
+}
+
+// addLocal adds a local subscriber of the filter,
+// it returns the update to broadcast if the filter is subscribed on the node for the first time.
+func (r *routes) addLocal(filter string) (*routeUpdate, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if l, ok := r.local[filter]; ok {
+		l.count++
+		return nil, false
+	}
+	r.seq++
+	r.local[filter] = &localRoute{count: 1, seq: r.seq}
+	return &routeUpdate{Node: r.node, Seq: r.seq, Filter: filter, Add: true}, true
+}
+
+// removeLocal removes a local subscriber of the filter,
+// it returns the update to broadcast if the filter is no longer subscribed on the node.
+func (r *routes) removeLocal(filter string) (*routeUpdate, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	l, ok := r.local[filter]
+	if !ok {
+		return nil, false
+	}
+	l.count--
+	if l.count > 0 {
+		return nil, false
+	}
+	delete(r.local, filter)
+	r.seq++
+	return &routeUpdate{Node: r.node, Seq: r.seq, Filter: filter, Add: false}, true
+}
+
+// localState returns the full state of the local routing table.
+func (r *routes) localState() *routeState {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	s := &routeState{
+		Node:    r.node,
+		Seq:     r.seq,
+		Filters: make(map[string]uint64, len(r.local)),
+	}
+	for k, v := range r.local {
+		s.Filters[k] = v.seq
+	}
+	return s
+}
+
+// update applies the update of a remote node.
+func (r *routes) update(u *routeUpdate) {
+	if u.Node == r.node {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	filters, ok := r.remote[u.Node]
+	if !ok {
+		filters = make(map[string]*remoteRoute)
+		r.remote[u.Node] = filters
+	}
+	if f, ok := filters[u.Filter]; ok && f.seq >= u.Seq {
+		return
+	}
+	filters[u.Filter] = &remoteRoute{seq: u.Seq, present: u.Add}
+}
+
+// merge merges the full state of a remote node.
+func (r *routes) merge(s *routeState) {
+	if s.Node == r.node {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	filters, ok := r.remote[s.Node]
+	if !ok {
+		filters = make(map[string]*remoteRoute)
+		r.remote[s.Node] = filters
+	}
+	for k, v := range filters {
+		// the changes covered by the state are replaced by the state.
+		if _, ok := s.Filters[k]; !ok && v.seq <= s.Seq {
+			delete(filters, k)
+		}
+	}
+	for k, seq := range s.Filters {
+		if f, ok := filters[k]; ok && f.seq > seq {
+			continue
+		}
+		filters[k] = &remoteRoute{seq: seq, present: true}
+	}
+}
+
+// removeNode removes the routing table of the node which has left the cluster.
+func (r *routes) removeNode(node string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.remote, node)
+}
+
+// matched returns the remote nodes which have subscriptions matching the topic name.
+func (r *routes) matched(topicName string) []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var nodes []string
+	for node, filters := range r.remote {
+		for k, v := range filters {
+			if v.present && packets.TopicMatch([]byte(topicName), []byte(k)) {
+				nodes = append(nodes, node)
+				break
+			}
+		}
+	}
+	return nodes
+}
+
+// count returns the number of the topic filters subscribed on the node.
+func (r *routes) count(node string) int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if node == r.node {
+		return len(r.local)
+	}
+	var n int
+	for _, v := range r.remote[node] {
+		if v.present {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,123 @@
+package cluster
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func sortedMatched(r *routes, topicName string) []string {
+	nodes := r.matched(topicName)
+	sort.Strings(nodes)
+	return nodes
+}
+
+func TestRoutes_Local(t *testing.T) {
+	a := assert.New(t)
+	r := newRoutes("a")
+	u, ok := r.addLocal("a/#")
+	a.True(ok)
+	a.Equal(&routeUpdate{Node: "a", Seq: 1, Filter: "a/#", Add: true}, u)
+	// the filter is broadcast only once for the subscribers on the node.
+	_, ok = r.addLocal("a/#")
+	a.False(ok)
+	a.Equal(1, r.count("a"))
+
+	_, ok = r.removeLocal("a/#")
+	a.False(ok)
+	u, ok = r.removeLocal("a/#")
+	a.True(ok)
+	a.Equal(&routeUpdate{Node: "a", Seq: 2, Filter: "a/#", Add: false}, u)
+	_, ok = r.removeLocal("a/#")
+	a.False(ok)
+	a.Equal(0, r.count("a"))
+
+	r.addLocal("b")
+	a.Equal(&routeState{Node: "a", Seq: 3, Filters: map[string]uint64{"b": 3}}, r.localState())
+}
+
+func TestRoutes_Update(t *testing.T) {
+	a := assert.New(t)
+	r := newRoutes("a")
+	r.update(&routeUpdate{Node: "b", Seq: 1, Filter: "x/+", Add: true})
+	r.update(&routeUpdate{Node: "c", Seq: 1, Filter: "#", Add: true})
+	a.Equal([]string{"b", "c"}, sortedMatched(r, "x/y"))
+	a.Equal([]string{"c"}, sortedMatched(r, "z"))
+
+	// the delayed updates are ignored.
+	r.update(&routeUpdate{Node: "b", Seq: 3, Filter: "x/+", Add: false})
+	r.update(&routeUpdate{Node: "b", Seq: 2, Filter: "x/+", Add: true})
+	a.Equal([]string{"c"}, sortedMatched(r, "x/y"))
+	a.Equal(0, r.count("b"))
+
+	// the updates of the node itself are ignored.
+	r.update(&routeUpdate{Node: "a", Seq: 1, Filter: "x/+", Add: true})
+	a.Equal(0, r.count("a"))
+
+	r.removeNode("c")
+	a.Empty(r.matched("z"))
+}
+
+func TestRoutes_Merge(t *testing.T) {
+	a := assert.New(t)
+	r := newRoutes("a")
+	r.update(&routeUpdate{Node: "b", Seq: 1, Filter: "old", Add: true})
+	r.update(&routeUpdate{Node: "b", Seq: 5, Filter: "removed", Add: false})
+	r.update(&routeUpdate{Node: "b", Seq: 6, Filter: "new", Add: true})
+
+	// the state of seq 4 replaces the changes up to seq 4, the newer changes are kept.
+	r.merge(&routeState{Node: "b", Seq: 4, Filters: map[string]uint64{"removed": 2, "synced": 3}})
+	a.Equal([]string{"b"}, r.matched("synced"))
+	a.Equal([]string{"b"}, r.matched("new"))
+	a.Empty(r.matched("old"))
+	a.Empty(r.matched("removed"))
+	a.Equal(2, r.count("b"))
+
+	// the newer state replaces the tombstones.
+	r.merge(&routeState{Node: "b", Seq: 7, Filters: map[string]uint64{"removed": 7}})
+	a.Equal([]string{"b"}, r.matched("removed"))
+	a.Empty(r.matched("new"))
+	a.Equal(1, r.count("b"))
+
+	// the state of the node itself is ignored.
+	r.merge(&routeState{Node: "a", Seq: 1, Filters: map[string]uint64{"x": 1}})
+	a.Equal(0, r.count("a"))
+}
+
+func TestRoutes_Sync(t *testing.T) {
+	a := assert.New(t)
+	ca := &Cluster{routes: newRoutes("a")}
+	cb := &Cluster{routes: newRoutes("b")}
+	da, db := &delegate{c: ca}, &delegate{c: cb}
+
+	ca.routes.addLocal("x/#")
+	ca.routes.addLocal("y")
+	u, _ := ca.routes.removeLocal("y")
+
+	// the full state is pulled by the push/pull sync.
+	db.MergeRemoteState(da.LocalState(false), false)
+	a.Equal([]string{"a"}, cb.routes.matched("x/z"))
+	a.Empty(cb.routes.matched("y"))
+	a.Equal(1, cb.routes.count("a"))
+
+	// the broadcast update is applied by the message handler, the delayed one is ignored.
+	u2, _ := ca.routes.addLocal("y")
+	b, err := encode(msgRoute, u2)
+	if !a.NoError(err) {
+		return
+	}
+	db.NotifyMsg(b)
+	b, err = encode(msgRoute, u)
+	if !a.NoError(err) {
+		return
+	}
+	db.NotifyMsg(b)
+	a.Equal([]string{"a"}, cb.routes.matched("y"))
+	a.Equal(2, cb.routes.count("a"))
+
+	// the invalid states are ignored.
+	db.MergeRemoteState(nil, false)
+	db.MergeRemoteState([]byte{byte(msgRoute), '{'}, false)
+	a.Equal(2, cb.routes.count("a"))
+}
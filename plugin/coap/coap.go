@@ -0,0 +1,465 @@
+// Package coap maps the CoAP requests onto the MQTT publishes, retained messages and subscriptions,
+// so the constrained devices speaking CoAP (RFC 7252) and Observe (RFC 7641) can use the broker:
+//
+//	PUT/POST /<path>   publishes the payload to the mapped topic.
+//	GET /<path>        reads the retained message of the mapped topic.
+//	GET /<path> with Observe: 0 observes the mapped topic filter, each message matching the filter is notified.
+//	DELETE /<path>     removes the retained message of the mapped topic.
+package coap
+
+import (
+	"context"
+	"math/rand"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/DrmagicE/gmqtt"
+	"github.com/DrmagicE/gmqtt/pkg/packets"
+)
+
+const name = "coap"
+
+var log *zap.Logger
+
+const (
+	defaultMaxObservers = 10000
+	// ackTimeout and maxRetransmit are the retransmission parameters of the confirmable notifications.
+	ackTimeout    = 2 * time.Second
+	maxRetransmit = 4
+	// exchangeLifetime is the time the responses are cached to answer the duplicate requests.
+	exchangeLifetime = 247 * time.Second
+	maxDatagram      = 65535
+)
+
+// Rule maps the Uri-Path of the requests to the topics.
+type Rule struct {
+	// Path is the prefix of the Uri-Path, such as "ps" or "devices/sensors".
+	Path string
+	// Topic replaces the Path prefix, such as "" or "sensors". The rest of the path is appended with "/".
+	Topic string
+}
+
+// Option is the option of the CoAP plugin.
+type Option func(c *CoAP)
+
+// WithRules sets the path to topic mapping rules, the first rule whose Path is the prefix of the request path
+// is used and the requests matching no rule are responded with 4.04. By default, the path is used as the topic.
+func WithRules(rules ...Rule) Option {
+	return func(c *CoAP) {
+		c.rules = append(c.rules, rules...)
+	}
+}
+
+// WithAuthorizer sets the function which authorizes the requests, method is one of "GET", "OBSERVE", "PUT", "POST"
+// and "DELETE". The unauthorized requests are responded with 4.03. By default, all requests are allowed.
+func WithAuthorizer(fn func(addr net.Addr, method string, topic string) bool) Option {
+	return func(c *CoAP) {
+		c.authorize = fn
+	}
+}
+
+// WithMaxObservers sets the maximum number of the observers, the observe requests exceeding the limit are
+// responded with 5.03. Default to 10000.
+func WithMaxObservers(n int) Option {
+	return func(c *CoAP) {
+		c.maxObservers = n
+	}
+}
+
+type observer struct {
+	addr   *net.UDPAddr
+	token  []byte
+	filter string
+	seq    uint32
+}
+
+func observerKey(addr *net.UDPAddr, token []byte) string {
+	return addr.String() + "/" + string(token)
+}
+
+// pending is the confirmable notification waiting for the acknowledgement.
+type pending struct {
+	key      string
+	addr     *net.UDPAddr
+	b        []byte
+	retries  int
+	deadline time.Time
+}
+
+type cachedResponse struct {
+	b      []byte
+	expire time.Time
+}
+
+// CoAP is the plugin which serves the CoAP requests on an udp address.
+type CoAP struct {
+	addr         string
+	rules        []Rule
+	authorize    func(addr net.Addr, method string, topic string) bool
+	maxObservers int
+
+	service gmqtt.Server
+	conn    *net.UDPConn
+
+	mu        sync.Mutex
+	observers map[string]*observer
+	pending   map[uint16]*pending
+	responses map[string]*cachedResponse
+	nextID    uint16
+	closed    chan struct{}
+}
+
+// New returns the CoAP plugin listening on the udp address, such as ":5683".
+func New(addr string, opts ...Option) *CoAP {
+	c := &CoAP{
+		addr:         addr,
+		maxObservers: defaultMaxObservers,
+		observers:    make(map[string]*observer),
+		pending:      make(map[uint16]*pending),
+		responses:    make(map[string]*cachedResponse),
+		nextID:       uint16(rand.Intn(0xffff)),
+		closed:       make(chan struct{}),
+	}
+	for _, fn := range opts {
+		fn(c)
+	}
+	return c
+}
+
+func (c *CoAP) Load(service gmqtt.Server) error {
+	log = gmqtt.Logger("plugin/" + name)
+	c.service = service
+	addr, err := net.ResolveUDPAddr("udp", c.addr)
+	if err != nil {
+		return err
+	}
+	c.conn, err = net.ListenUDP("udp", addr)
+	if err != nil {
+		return err
+	}
+	go c.readLoop()
+	go c.retransmitLoop()
+	return nil
+}
+
+func (c *CoAP) Unload() error {
+	close(c.closed)
+	return c.conn.Close()
+}
+
+func (c *CoAP) HookWrapper() gmqtt.HookWrapper {
+	return gmqtt.HookWrapper{
+		OnMsgArrivedWrapper: c.OnMsgArrivedWrapper,
+	}
+}
+
+func (c *CoAP) Name() string {
+	return name
+}
+
+// OnMsgArrivedWrapper notifies the observers of the messages published by the MQTT clients.
+func (c *CoAP) OnMsgArrivedWrapper(arrived gmqtt.OnMsgArrived) gmqtt.OnMsgArrived {
+	return func(ctx context.Context, client gmqtt.Client, msg packets.Message) (valid bool) {
+		valid = arrived(ctx, client, msg)
+		if valid {
+			c.notify(msg.Topic(), msg.Payload())
+		}
+		return valid
+	}
+}
+
+// topic maps the path to the topic by the rules.
+func (c *CoAP) topic(path string) (string, bool) {
+	if len(c.rules) == 0 {
+		return path, true
+	}
+	for _, r := range c.rules {
+		if path == r.Path {
+			return r.Topic, true
+		}
+		if r.Path == "" || strings.HasPrefix(path, r.Path+"/") {
+			rest := strings.TrimPrefix(strings.TrimPrefix(path, r.Path), "/")
+			if r.Topic == "" {
+				return rest, true
+			}
+			return r.Topic + "/" + rest, true
+		}
+	}
+	return "", false
+}
+
+func (c *CoAP) readLoop() {
+	buf := make([]byte, maxDatagram)
+	for {
+		n, addr, err := c.conn.ReadFromUDP(buf)
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				continue
+			}
+			select {
+			case <-c.closed:
+			default:
+				log.Error("read error", zap.Error(err))
+			}
+			return
+		}
+		m, err := decode(append([]byte(nil), buf[:n]...))
+		if err != nil {
+			continue
+		}
+		c.handle(addr, m)
+	}
+}
+
+func (c *CoAP) write(addr *net.UDPAddr, b []byte) {
+	if _, err := c.conn.WriteToUDP(b, addr); err != nil {
+		log.Warn("write error", zap.String("remote", addr.String()), zap.Error(err))
+	}
+}
+
+func (c *CoAP) handle(addr *net.UDPAddr, m *message) {
+	switch m.typ {
+	case typeACK, typeRST:
+		c.mu.Lock()
+		if p, ok := c.pending[m.id]; ok && p.addr.String() == addr.String() {
+			delete(c.pending, m.id)
+			if m.typ == typeRST {
+				// the client is no longer interested in the notifications.
+				delete(c.observers, p.key)
+			}
+		}
+		c.mu.Unlock()
+		return
+	}
+	if m.code == codeEmpty {
+		// the CoAP ping
+		if m.typ == typeCON {
+			c.write(addr, encode(&message{typ: typeRST, id: m.id}))
+		}
+		return
+	}
+	cacheKey := addr.String() + "/" + strconv.Itoa(int(m.id))
+	if m.typ == typeCON {
+		c.mu.Lock()
+		r, ok := c.responses[cacheKey]
+		c.mu.Unlock()
+		if ok {
+			// the duplicate request
+			c.write(addr, r.b)
+			return
+		}
+	}
+	resp := c.serve(addr, m)
+	resp.token = m.token
+	if m.typ == typeCON {
+		resp.typ, resp.id = typeACK, m.id
+	} else {
+		resp.typ, resp.id = typeNON, c.messageID()
+	}
+	b := encode(resp)
+	if m.typ == typeCON {
+		c.mu.Lock()
+		c.responses[cacheKey] = &cachedResponse{b: b, expire: time.Now().Add(exchangeLifetime)}
+		c.mu.Unlock()
+	}
+	c.write(addr, b)
+}
+
+func (c *CoAP) messageID() uint16 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.nextID++
+	return c.nextID
+}
+
+func (c *CoAP) allowed(addr net.Addr, method, topic string) bool {
+	return c.authorize == nil || c.authorize(addr, method, topic)
+}
+
+// serve serves the request and returns the response.
+func (c *CoAP) serve(addr *net.UDPAddr, m *message) *message {
+	topic, ok := c.topic(m.path())
+	if !ok {
+		return &message{code: codeNotFound}
+	}
+	switch m.code {
+	case codePUT, codePOST:
+		method := "PUT"
+		if m.code == codePOST {
+			method = "POST"
+		}
+		return c.publish(addr, method, topic, m)
+	case codeGET:
+		if v, ok := m.observe(); ok && v == 0 {
+			return c.observe(addr, topic, m)
+		}
+		c.mu.Lock()
+		delete(c.observers, observerKey(addr, m.token))
+		c.mu.Unlock()
+		if !packets.ValidTopicName([]byte(topic)) {
+			return &message{code: codeBadRequest}
+		}
+		if !c.allowed(addr, "GET", topic) {
+			return &message{code: codeForbidden}
+		}
+		retained := c.service.RetainedStore().GetRetainedMessage(topic)
+		if retained == nil {
+			return &message{code: codeNotFound}
+		}
+		return &message{code: codeContent, payload: retained.Payload()}
+	case codeDELETE:
+		if !packets.ValidTopicName([]byte(topic)) {
+			return &message{code: codeBadRequest}
+		}
+		if !c.allowed(addr, "DELETE", topic) {
+			return &message{code: codeForbidden}
+		}
+		c.service.RetainedStore().Remove(topic)
+		return &message{code: codeDeleted}
+	}
+	return &message{code: codeMethodNotAllowed}
+}
+
+// publish publishes the payload, the qos and the retain flag are set by the "qos" and "retain" queries,
+// such as "?qos=1&retain".
+func (c *CoAP) publish(addr *net.UDPAddr, method, topic string, m *message) *message {
+	if !packets.ValidTopicName([]byte(topic)) {
+		return &message{code: codeBadRequest}
+	}
+	var qos uint8
+	if v, ok := m.query("qos"); ok {
+		q, err := strconv.Atoi(v)
+		if err != nil || q < 0 || q > int(packets.QOS_2) {
+			return &message{code: codeBadRequest}
+		}
+		qos = uint8(q)
+	}
+	var retain bool
+	if v, ok := m.query("retain"); ok {
+		retain = v == "" || v == "true" || v == "1"
+	}
+	if !c.allowed(addr, method, topic) {
+		return &message{code: codeForbidden}
+	}
+	msg := gmqtt.NewMessage(topic, m.payload, qos, gmqtt.Retained(retain))
+	if retain {
+		// the retained messages are not stored by the PublishService.
+		if len(m.payload) == 0 {
+			c.service.RetainedStore().Remove(topic)
+		} else {
+			c.service.RetainedStore().AddOrReplace(msg)
+		}
+	}
+	c.service.PublishService().Publish(msg)
+	// the messages published by the PublishService do not arrive at OnMsgArrived.
+	c.notify(topic, m.payload)
+	return &message{code: codeChanged}
+}
+
+// observe registers the observer, the response carries the retained message if the topic is not a wildcard filter.
+func (c *CoAP) observe(addr *net.UDPAddr, filter string, m *message) *message {
+	if !packets.ValidTopicFilter([]byte(filter)) {
+		return &message{code: codeBadRequest}
+	}
+	if !c.allowed(addr, "OBSERVE", filter) {
+		return &message{code: codeForbidden}
+	}
+	key := observerKey(addr, m.token)
+	c.mu.Lock()
+	o, ok := c.observers[key]
+	if !ok {
+		if len(c.observers) >= c.maxObservers {
+			c.mu.Unlock()
+			return &message{code: codeServiceUnavailable}
+		}
+		o = &observer{addr: addr, token: append([]byte(nil), m.token...)}
+		c.observers[key] = o
+	}
+	o.filter = filter
+	o.seq++
+	seq := o.seq
+	c.mu.Unlock()
+	resp := &message{code: codeContent, options: []option{{num: optionObserve, value: encodeUint(seq)}}}
+	if packets.ValidTopicName([]byte(filter)) {
+		if retained := c.service.RetainedStore().GetRetainedMessage(filter); retained != nil {
+			resp.payload = retained.Payload()
+		}
+	}
+	return resp
+}
+
+// notify sends the confirmable notifications to the observers matching the topic.
+func (c *CoAP) notify(topic string, payload []byte) {
+	now := time.Now()
+	type notification struct {
+		addr *net.UDPAddr
+		b    []byte
+	}
+	var ns []notification
+	c.mu.Lock()
+	for key, o := range c.observers {
+		if !packets.TopicMatch([]byte(topic), []byte(o.filter)) {
+			continue
+		}
+		// the observe sequence number is 24 bits.
+		o.seq = (o.seq + 1) & 0xffffff
+		c.nextID++
+		b := encode(&message{
+			typ:     typeCON,
+			code:    codeContent,
+			id:      c.nextID,
+			token:   o.token,
+			options: []option{{num: optionObserve, value: encodeUint(o.seq)}},
+			payload: payload,
+		})
+		c.pending[c.nextID] = &pending{key: key, addr: o.addr, b: b, deadline: now.Add(ackTimeout)}
+		ns = append(ns, notification{addr: o.addr, b: b})
+	}
+	c.mu.Unlock()
+	for _, n := range ns {
+		c.write(n.addr, n.b)
+	}
+}
+
+// retransmitLoop retransmits the unacknowledged notifications, the observer is removed if the retransmissions
+// are exhausted. It also expires the cached responses.
+func (c *CoAP) retransmitLoop() {
+	t := time.NewTicker(500 * time.Millisecond)
+	defer t.Stop()
+	for {
+		select {
+		case <-c.closed:
+			return
+		case now := <-t.C:
+			var retransmit []*pending
+			c.mu.Lock()
+			for id, p := range c.pending {
+				if now.Before(p.deadline) {
+					continue
+				}
+				if p.retries >= maxRetransmit {
+					delete(c.pending, id)
+					delete(c.observers, p.key)
+					continue
+				}
+				p.retries++
+				p.deadline = now.Add(ackTimeout << uint(p.retries))
+				retransmit = append(retransmit, p)
+			}
+			for k, r := range c.responses {
+				if now.After(r.expire) {
+					delete(c.responses, k)
+				}
+			}
+			c.mu.Unlock()
+			for _, p := range retransmit {
+				c.write(p.addr, p.b)
+			}
+		}
+	}
+}
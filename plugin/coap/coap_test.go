@@ -0,0 +1,311 @@
+package coap
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/DrmagicE/gmqtt"
+	"github.com/DrmagicE/gmqtt/pkg/packets"
+	"github.com/DrmagicE/gmqtt/retained"
+	"github.com/DrmagicE/gmqtt/retained/trie"
+)
+
+// fakeServer is the gmqtt.Server which records the published messages.
+type fakeServer struct {
+	gmqtt.Server
+	retained retained.Store
+
+	mu   sync.Mutex
+	msgs []packets.Message
+}
+
+func newFakeServer() *fakeServer {
+	return &fakeServer{retained: trie.NewStore()}
+}
+
+func (s *fakeServer) PublishService() gmqtt.PublishService {
+	return s
+}
+
+func (s *fakeServer) RetainedStore() retained.Store {
+	return s.retained
+}
+
+func (s *fakeServer) Publish(message packets.Message) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.msgs = append(s.msgs, message)
+}
+
+func (s *fakeServer) PublishToClient(clientID string, message packets.Message, match bool) {
+}
+
+func (s *fakeServer) published() []packets.Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]packets.Message(nil), s.msgs...)
+}
+
+// testClient is the CoAP client.
+type testClient struct {
+	t    *testing.T
+	conn *net.UDPConn
+	id   uint16
+}
+
+func dial(t *testing.T, c *CoAP) *testClient {
+	conn, err := net.DialUDP("udp", nil, c.conn.LocalAddr().(*net.UDPAddr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testClient{t: t, conn: conn}
+}
+
+func (c *testClient) send(m *message) {
+	if _, err := c.conn.Write(encode(m)); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+func (c *testClient) recv() *message {
+	c.conn.SetReadDeadline(time.Now().Add(time.Second))
+	b := make([]byte, maxDatagram)
+	n, err := c.conn.Read(b)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	m, err := decode(b[:n])
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	return m
+}
+
+// request sends the confirmable request and returns the response, the uri is "path?query&query".
+func (c *testClient) request(code byte, uri string, payload []byte, extra ...option) *message {
+	c.id++
+	m := &message{typ: typeCON, code: code, id: c.id, token: []byte{byte(c.id)}, payload: payload}
+	parts := strings.SplitN(uri, "?", 2)
+	for _, p := range strings.Split(parts[0], "/") {
+		m.options = append(m.options, option{num: optionURIPath, value: []byte(p)})
+	}
+	if len(parts) == 2 {
+		for _, q := range strings.Split(parts[1], "&") {
+			m.options = append(m.options, option{num: optionURIQuery, value: []byte(q)})
+		}
+	}
+	m.options = append(m.options, extra...)
+	c.send(m)
+	resp := c.recv()
+	if resp.typ != typeACK || resp.id != m.id || string(resp.token) != string(m.token) {
+		c.t.Fatalf("unexpected response: %+v", resp)
+	}
+	return resp
+}
+
+func load(t *testing.T, srv *fakeServer, opts ...Option) *CoAP {
+	c := New("127.0.0.1:0", opts...)
+	if err := c.Load(srv); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestCoAP_topic(t *testing.T) {
+	c := New("", WithRules(
+		Rule{Path: "ps", Topic: ""},
+		Rule{Path: "devices/sensors", Topic: "sensors"},
+		Rule{Path: "fixed", Topic: "a/b"},
+	))
+	var tt = []struct {
+		path  string
+		topic string
+		ok    bool
+	}{
+		{path: "ps/a/b", topic: "a/b", ok: true},
+		{path: "devices/sensors/1/temp", topic: "sensors/1/temp", ok: true},
+		{path: "fixed", topic: "a/b", ok: true},
+		// the prefix must match the whole path segments.
+		{path: "psx/a"},
+		{path: "devices"},
+	}
+	for _, v := range tt {
+		topic, ok := c.topic(v.path)
+		assert.Equal(t, v.ok, ok, v.path)
+		assert.Equal(t, v.topic, topic, v.path)
+	}
+	// the path is used as the topic without the rules.
+	topic, ok := New("").topic("a/b")
+	assert.True(t, ok)
+	assert.Equal(t, "a/b", topic)
+}
+
+func TestCoAP_Publish(t *testing.T) {
+	srv := newFakeServer()
+	c := load(t, srv, WithRules(Rule{Path: "ps"}))
+	defer c.Unload()
+	cli := dial(t, c)
+
+	var tt = []struct {
+		name   string
+		code   byte
+		uri    string
+		resp   byte
+		qos    uint8
+		retain bool
+	}{
+		{name: "put", code: codePUT, uri: "ps/a/b", resp: codeChanged},
+		{name: "post_qos", code: codePOST, uri: "ps/a/b?qos=2", resp: codeChanged, qos: 2},
+		{name: "retain", code: codePUT, uri: "ps/a/b?qos=1&retain", resp: codeChanged, qos: 1, retain: true},
+		{name: "invalid_qos", code: codePUT, uri: "ps/a/b?qos=3", resp: codeBadRequest},
+		{name: "wildcard_topic", code: codePUT, uri: "ps/a/+", resp: codeBadRequest},
+		{name: "no_rule", code: codePUT, uri: "other/a", resp: codeNotFound},
+	}
+	for _, v := range tt {
+		t.Run(v.name, func(t *testing.T) {
+			a := assert.New(t)
+			n := len(srv.published())
+			resp := cli.request(v.code, v.uri, []byte(v.name))
+			a.Equal(v.resp, resp.code)
+			msgs := srv.published()
+			if v.resp != codeChanged {
+				a.Len(msgs, n)
+				return
+			}
+			if !a.Len(msgs, n+1) {
+				return
+			}
+			m := msgs[n]
+			a.Equal("a/b", m.Topic())
+			a.Equal(v.name, string(m.Payload()))
+			a.Equal(v.qos, m.Qos())
+			a.Equal(v.retain, m.Retained())
+		})
+	}
+	m := srv.retained.GetRetainedMessage("a/b")
+	if assert.NotNil(t, m) {
+		assert.Equal(t, "retain", string(m.Payload()))
+	}
+}
+
+func TestCoAP_Retained(t *testing.T) {
+	a := assert.New(t)
+	srv := newFakeServer()
+	c := load(t, srv)
+	defer c.Unload()
+	cli := dial(t, c)
+
+	a.Equal(codeNotFound, cli.request(codeGET, "a/b", nil).code)
+	a.Equal(codeChanged, cli.request(codePUT, "a/b?retain=true", []byte("1")).code)
+	resp := cli.request(codeGET, "a/b", nil)
+	a.Equal(codeContent, resp.code)
+	a.Equal("1", string(resp.payload))
+
+	a.Equal(codeDeleted, cli.request(codeDELETE, "a/b", nil).code)
+	a.Equal(codeNotFound, cli.request(codeGET, "a/b", nil).code)
+	a.Equal(codeBadRequest, cli.request(codeGET, "a/#", nil).code)
+}
+
+func TestCoAP_Authorize(t *testing.T) {
+	a := assert.New(t)
+	srv := newFakeServer()
+	var methods []string
+	var mu sync.Mutex
+	c := load(t, srv, WithAuthorizer(func(addr net.Addr, method string, topic string) bool {
+		mu.Lock()
+		methods = append(methods, method+" "+topic)
+		mu.Unlock()
+		return topic != "denied"
+	}))
+	defer c.Unload()
+	cli := dial(t, c)
+
+	a.Equal(codeForbidden, cli.request(codePUT, "denied", nil).code)
+	a.Equal(codeForbidden, cli.request(codePOST, "denied", nil).code)
+	a.Equal(codeForbidden, cli.request(codeGET, "denied", nil).code)
+	a.Equal(codeForbidden, cli.request(codeDELETE, "denied", nil).code)
+	a.Equal(codeForbidden, cli.request(codeGET, "denied", nil, option{num: optionObserve}).code)
+	a.Empty(srv.published())
+	mu.Lock()
+	a.Equal([]string{"PUT denied", "POST denied", "GET denied", "DELETE denied", "OBSERVE denied"}, methods)
+	mu.Unlock()
+}
+
+func TestCoAP_Duplicate(t *testing.T) {
+	a := assert.New(t)
+	srv := newFakeServer()
+	c := load(t, srv)
+	defer c.Unload()
+	cli := dial(t, c)
+
+	m := &message{typ: typeCON, code: codePUT, id: 10, token: []byte{1}, options: []option{{num: optionURIPath, value: []byte("a")}}}
+	cli.send(m)
+	resp := cli.recv()
+	// the retransmitted request is answered by the cached response, it is not published again.
+	cli.send(m)
+	a.Equal(resp, cli.recv())
+	a.Len(srv.published(), 1)
+
+	// the ping is answered by a reset.
+	cli.send(&message{typ: typeCON, id: 11})
+	resp = cli.recv()
+	a.Equal(typeRST, resp.typ)
+	a.EqualValues(11, resp.id)
+}
+
+func TestCoAP_Observe(t *testing.T) {
+	a := assert.New(t)
+	srv := newFakeServer()
+	srv.retained.AddOrReplace(gmqtt.NewMessage("a/b", []byte("retained"), packets.QOS_0, gmqtt.Retained(true)))
+	c := load(t, srv, WithMaxObservers(2))
+	defer c.Unload()
+	cli := dial(t, c)
+
+	resp := cli.request(codeGET, "a/b", nil, option{num: optionObserve})
+	a.Equal(codeContent, resp.code)
+	a.Equal("retained", string(resp.payload))
+	_, ok := resp.observe()
+	a.True(ok)
+	token := resp.token
+	a.Equal(codeContent, cli.request(codeGET, "a/+", nil, option{num: optionObserve}).code)
+	// the observers exceeding the limit are rejected.
+	a.Equal(codeServiceUnavailable, cli.request(codeGET, "c", nil, option{num: optionObserve}).code)
+
+	// the messages published by the MQTT clients are notified to the matching observers.
+	arrived := c.OnMsgArrivedWrapper(func(ctx context.Context, client gmqtt.Client, msg packets.Message) bool {
+		return true
+	})
+	arrived(context.Background(), nil, gmqtt.NewMessage("a/c", []byte("1"), packets.QOS_1))
+	n := cli.recv()
+	a.Equal(typeCON, n.typ)
+	a.Equal(codeContent, n.code)
+	a.Equal("1", string(n.payload))
+	a.NotEqual(string(token), string(n.token))
+	cli.send(&message{typ: typeACK, id: n.id})
+
+	// the reset removes the observer.
+	arrived(context.Background(), nil, gmqtt.NewMessage("a/b", []byte("2"), packets.QOS_1))
+	var tokens []string
+	for i := 0; i < 2; i++ {
+		n = cli.recv()
+		a.Equal("2", string(n.payload))
+		tokens = append(tokens, string(n.token))
+		if string(n.token) == string(token) {
+			cli.send(&message{typ: typeRST, id: n.id})
+		} else {
+			cli.send(&message{typ: typeACK, id: n.id})
+		}
+	}
+	a.Contains(tokens, string(token))
+	a.Eventually(func() bool {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return len(c.observers) == 1 && len(c.pending) == 0
+	}, time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,217 @@
+package coap
+
+import (
+	"encoding/binary"
+	"errors"
+	"sort"
+	"strings"
+)
+
+// The message types.
+const (
+	typeCON byte = 0
+	typeNON byte = 1
+	typeACK byte = 2
+	typeRST byte = 3
+)
+
+// The method and response codes, class<<5 | detail.
+const (
+	codeEmpty              byte = 0
+	codeGET                byte = 1
+	codePOST               byte = 2
+	codePUT                byte = 3
+	codeDELETE             byte = 4
+	codeDeleted            byte = 2<<5 | 2
+	codeChanged            byte = 2<<5 | 4
+	codeContent            byte = 2<<5 | 5
+	codeBadRequest         byte = 4<<5 | 0
+	codeForbidden          byte = 4<<5 | 3
+	codeNotFound           byte = 4<<5 | 4
+	codeMethodNotAllowed   byte = 4<<5 | 5
+	codeServiceUnavailable byte = 5<<5 | 3
+)
+
+// The option numbers.
+const (
+	optionObserve  uint16 = 6
+	optionURIPath  uint16 = 11
+	optionURIQuery uint16 = 15
+)
+
+const payloadMarker = 0xff
+
+var errInvalidMessage = errors.New("invalid coap message")
+
+type option struct {
+	num   uint16
+	value []byte
+}
+
+// message is the CoAP message defined by RFC 7252.
+type message struct {
+	typ     byte
+	code    byte
+	id      uint16
+	token   []byte
+	options []option
+	payload []byte
+}
+
+// path returns the Uri-Path options joined by "/".
+func (m *message) path() string {
+	var s []string
+	for _, o := range m.options {
+		if o.num == optionURIPath {
+			s = append(s, string(o.value))
+		}
+	}
+	return strings.Join(s, "/")
+}
+
+// query returns the value of the Uri-Query option "key=value", ok is false if the key is absent.
+func (m *message) query(key string) (value string, ok bool) {
+	for _, o := range m.options {
+		if o.num != optionURIQuery {
+			continue
+		}
+		kv := strings.SplitN(string(o.value), "=", 2)
+		if kv[0] != key {
+			continue
+		}
+		if len(kv) == 2 {
+			return kv[1], true
+		}
+		return "", true
+	}
+	return "", false
+}
+
+// observe returns the value of the Observe option, ok is false if the option is absent.
+func (m *message) observe() (value uint32, ok bool) {
+	for _, o := range m.options {
+		if o.num == optionObserve {
+			return decodeUint(o.value), true
+		}
+	}
+	return 0, false
+}
+
+func decodeUint(b []byte) uint32 {
+	var v uint32
+	for _, c := range b {
+		v = v<<8 | uint32(c)
+	}
+	return v
+}
+
+// encodeUint encodes v into the minimal bytes, zero is encoded into the empty value.
+func encodeUint(v uint32) []byte {
+	var b []byte
+	for v > 0 {
+		b = append([]byte{byte(v)}, b...)
+		v >>= 8
+	}
+	return b
+}
+
+// readOptionField reads the extended delta or length of the option nibble.
+func readOptionField(nibble byte, b []byte) (int, []byte, error) {
+	switch nibble {
+	case 13:
+		if len(b) < 1 {
+			return 0, nil, errInvalidMessage
+		}
+		return int(b[0]) + 13, b[1:], nil
+	case 14:
+		if len(b) < 2 {
+			return 0, nil, errInvalidMessage
+		}
+		return int(binary.BigEndian.Uint16(b)) + 269, b[2:], nil
+	case 15:
+		return 0, nil, errInvalidMessage
+	}
+	return int(nibble), b, nil
+}
+
+func decode(b []byte) (*message, error) {
+	if len(b) < 4 || b[0]>>6 != 1 {
+		return nil, errInvalidMessage
+	}
+	tkl := int(b[0] & 0x0f)
+	if tkl > 8 || len(b) < 4+tkl {
+		return nil, errInvalidMessage
+	}
+	m := &message{
+		typ:   (b[0] >> 4) & 0x03,
+		code:  b[1],
+		id:    binary.BigEndian.Uint16(b[2:4]),
+		token: b[4 : 4+tkl],
+	}
+	b = b[4+tkl:]
+	var num int
+	for len(b) > 0 {
+		if b[0] == payloadMarker {
+			if len(b) == 1 {
+				return nil, errInvalidMessage
+			}
+			m.payload = b[1:]
+			break
+		}
+		delta, length := b[0]>>4, b[0]&0x0f
+		var d, l int
+		var err error
+		if d, b, err = readOptionField(delta, b[1:]); err != nil {
+			return nil, err
+		}
+		if l, b, err = readOptionField(length, b); err != nil {
+			return nil, err
+		}
+		if len(b) < l {
+			return nil, errInvalidMessage
+		}
+		num += d
+		m.options = append(m.options, option{num: uint16(num), value: b[:l]})
+		b = b[l:]
+	}
+	return m, nil
+}
+
+// optionField returns the nibble and the extended bytes of the option delta or length.
+func optionField(v int) (byte, []byte) {
+	switch {
+	case v < 13:
+		return byte(v), nil
+	case v < 269:
+		return 13, []byte{byte(v - 13)}
+	}
+	ext := make([]byte, 2)
+	binary.BigEndian.PutUint16(ext, uint16(v-269))
+	return 14, ext
+}
+
+func encode(m *message) []byte {
+	b := make([]byte, 4, 64)
+	b[0] = 1<<6 | m.typ<<4 | byte(len(m.token))
+	b[1] = m.code
+	binary.BigEndian.PutUint16(b[2:4], m.id)
+	b = append(b, m.token...)
+	sort.SliceStable(m.options, func(i, j int) bool {
+		return m.options[i].num < m.options[j].num
+	})
+	var last uint16
+	for _, o := range m.options {
+		delta, dext := optionField(int(o.num - last))
+		length, lext := optionField(len(o.value))
+		b = append(b, delta<<4|length)
+		b = append(b, dext...)
+		b = append(b, lext...)
+		b = append(b, o.value...)
+		last = o.num
+	}
+	if len(m.payload) > 0 {
+		b = append(b, payloadMarker)
+		b = append(b, m.payload...)
+	}
+	return b
+}
@@ -0,0 +1,106 @@
+package coap
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncodeDecode(t *testing.T) {
+	var tt = []struct {
+		name string
+		m    *message
+	}{
+		{name: "empty", m: &message{typ: typeCON, id: 1}},
+		{name: "token_payload", m: &message{typ: typeNON, code: codePUT, id: 0xffff, token: []byte{1, 2, 3, 4, 5, 6, 7, 8}, payload: []byte("payload")}},
+		{
+			name: "options",
+			m: &message{typ: typeACK, code: codeContent, id: 2, token: []byte{1}, options: []option{
+				{num: optionObserve, value: encodeUint(1)},
+				{num: optionURIPath, value: []byte("a")},
+				{num: optionURIPath, value: []byte("b")},
+				{num: optionURIQuery, value: []byte("qos=1")},
+			}},
+		},
+		{
+			// the deltas and lengths which need the extended bytes.
+			name: "extended",
+			m: &message{typ: typeCON, code: codePOST, id: 3, options: []option{
+				{num: optionURIPath, value: bytes.Repeat([]byte("a"), 13)},
+				{num: 100, value: bytes.Repeat([]byte("b"), 300)},
+				{num: 1000},
+			}, payload: []byte{0}},
+		},
+	}
+	for _, v := range tt {
+		t.Run(v.name, func(t *testing.T) {
+			a := assert.New(t)
+			m, err := decode(encode(v.m))
+			if !a.NoError(err) {
+				return
+			}
+			a.Equal(v.m.typ, m.typ)
+			a.Equal(v.m.code, m.code)
+			a.Equal(v.m.id, m.id)
+			a.Equal(len(v.m.token), len(m.token))
+			a.Equal(string(v.m.token), string(m.token))
+			a.Equal(string(v.m.payload), string(m.payload))
+			if a.Len(m.options, len(v.m.options)) {
+				for i, o := range v.m.options {
+					a.Equal(o.num, m.options[i].num)
+					a.Equal(string(o.value), string(m.options[i].value))
+				}
+			}
+		})
+	}
+}
+
+func TestDecode_Invalid(t *testing.T) {
+	var tt = []struct {
+		name string
+		b    []byte
+	}{
+		{name: "short", b: []byte{0x40, 0, 0}},
+		{name: "version", b: []byte{0x80, 0, 0, 0}},
+		{name: "token_length", b: []byte{0x49, 0, 0, 0, 1, 2, 3, 4, 5, 6, 7, 8, 9}},
+		{name: "truncated_token", b: []byte{0x42, 0, 0, 0, 1}},
+		{name: "empty_payload", b: []byte{0x40, 0, 0, 0, payloadMarker}},
+		{name: "reserved_delta", b: []byte{0x40, 0, 0, 0, 0xf1, 0}},
+		{name: "truncated_extended", b: []byte{0x40, 0, 0, 0, 0xd0}},
+		{name: "truncated_value", b: []byte{0x40, 0, 0, 0, 0xb3, 'a'}},
+	}
+	for _, v := range tt {
+		t.Run(v.name, func(t *testing.T) {
+			_, err := decode(v.b)
+			assert.Equal(t, errInvalidMessage, err)
+		})
+	}
+}
+
+func TestMessage_Options(t *testing.T) {
+	a := assert.New(t)
+	m := &message{options: []option{
+		{num: optionURIPath, value: []byte("a")},
+		{num: optionURIPath, value: []byte("b")},
+		{num: optionURIQuery, value: []byte("qos=1")},
+		{num: optionURIQuery, value: []byte("retain")},
+		{num: optionObserve, value: encodeUint(0x010203)},
+	}}
+	a.Equal("a/b", m.path())
+	v, ok := m.query("qos")
+	a.True(ok)
+	a.Equal("1", v)
+	v, ok = m.query("retain")
+	a.True(ok)
+	a.Equal("", v)
+	_, ok = m.query("other")
+	a.False(ok)
+	seq, ok := m.observe()
+	a.True(ok)
+	a.EqualValues(0x010203, seq)
+
+	a.Empty(encodeUint(0))
+	_, ok = (&message{}).observe()
+	a.False(ok)
+}
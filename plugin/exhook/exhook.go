@@ -0,0 +1,433 @@
+// Package exhook delegates the hooks to an external gRPC service which implements the HookProvider service,
+// see exhook.proto. It allows the authentication and authorization logic to live outside the Go process.
+package exhook
+
+//go:generate protoc --go_out=plugins=grpc,paths=source_relative:. exhook.proto
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+
+	"github.com/DrmagicE/gmqtt"
+	"github.com/DrmagicE/gmqtt/pkg/packets"
+)
+
+const name = "exhook"
+
+var log *zap.Logger
+
+// Hook is the hook which can be delegated to the external service.
+type Hook int
+
+const (
+	OnConnect Hook = iota
+	OnSubscribe
+	OnMsgArrived
+	OnDeliver
+	OnClose
+)
+
+// FailPolicy is the behaviour of the decision hooks (OnConnect, OnSubscribe and OnMsgArrived)
+// when the external service fails or times out.
+type FailPolicy int
+
+const (
+	// FailClosed rejects the connection, subscription or message.
+	FailClosed FailPolicy = iota
+	// FailOpen falls through to the next hook as if the external service allowed it.
+	FailOpen
+)
+
+const (
+	defaultTimeout       = time.Second
+	defaultBatchSize     = 100
+	defaultFlushInterval = 100 * time.Millisecond
+	// eventBufferSize is the number of the buffered events of the notification hooks,
+	// the events are dropped when the buffer is full.
+	eventBufferSize = 10000
+)
+
+type hookOptions struct {
+	timeout    time.Duration
+	failPolicy FailPolicy
+}
+
+// Option is the option of the ExHook.
+type Option func(e *ExHook)
+
+// WithDialOptions sets the options which are passed to grpc.Dial, default to grpc.WithInsecure().
+func WithDialOptions(opts ...grpc.DialOption) Option {
+	return func(e *ExHook) {
+		e.dialOpts = opts
+	}
+}
+
+// WithName sets the name of the plugin, default to "exhook".
+// The different names are required to register more than one ExHook plugins.
+func WithName(name string) Option {
+	return func(e *ExHook) {
+		e.name = name
+	}
+}
+
+// WithHooks sets the hooks to be delegated, default to all hooks.
+func WithHooks(hooks ...Hook) Option {
+	return func(e *ExHook) {
+		e.enabled = make(map[Hook]bool)
+		for _, h := range hooks {
+			e.enabled[h] = true
+		}
+	}
+}
+
+// WithTimeout sets the timeout of the calls of the decision hook, default to 1 second.
+func WithTimeout(hook Hook, timeout time.Duration) Option {
+	return func(e *ExHook) {
+		e.hooks[hook].timeout = timeout
+	}
+}
+
+// WithFailPolicy sets the FailPolicy of the decision hook, default to FailClosed.
+func WithFailPolicy(hook Hook, policy FailPolicy) Option {
+	return func(e *ExHook) {
+		e.hooks[hook].failPolicy = policy
+	}
+}
+
+// WithBatch sets the maximum size and the flush interval of the event batches of the notification hooks,
+// default to 100 events and 100 milliseconds.
+func WithBatch(size int, flushInterval time.Duration) Option {
+	return func(e *ExHook) {
+		e.batchSize = size
+		e.flushInterval = flushInterval
+	}
+}
+
+// ExHook is the plugin which delegates the hooks to the external HookProvider service.
+type ExHook struct {
+	name          string
+	addr          string
+	dialOpts      []grpc.DialOption
+	enabled       map[Hook]bool
+	hooks         map[Hook]*hookOptions
+	batchSize     int
+	flushInterval time.Duration
+	// the options of the external plugin process, see WithCommand.
+	command          string
+	args             []string
+	minBackoff       time.Duration
+	maxBackoff       time.Duration
+	handshakeTimeout time.Duration
+
+	conn     *grpc.ClientConn
+	mu       sync.RWMutex
+	provider HookProviderClient
+	events   chan *Event
+	done     chan struct{}
+	wg       sync.WaitGroup
+	// stopProcess stops the supervisor, it is closed after the buffered events are flushed.
+	stopProcess chan struct{}
+	supervisor  sync.WaitGroup
+}
+
+// New returns the ExHook plugin which connects to the HookProvider service at addr.
+// The addr is ignored if the service is run as an external plugin process, see WithCommand.
+func New(addr string, opts ...Option) *ExHook {
+	e := &ExHook{
+		name:          name,
+		addr:          addr,
+		dialOpts:      []grpc.DialOption{grpc.WithInsecure()},
+		enabled:       map[Hook]bool{OnConnect: true, OnSubscribe: true, OnMsgArrived: true, OnDeliver: true, OnClose: true},
+		hooks:         make(map[Hook]*hookOptions),
+		batchSize:     defaultBatchSize,
+		flushInterval: defaultFlushInterval,
+
+		minBackoff:       defaultMinBackoff,
+		maxBackoff:       defaultMaxBackoff,
+		handshakeTimeout: defaultHandshakeTimeout,
+	}
+	for _, h := range []Hook{OnConnect, OnSubscribe, OnMsgArrived, OnDeliver, OnClose} {
+		e.hooks[h] = &hookOptions{timeout: defaultTimeout, failPolicy: FailClosed}
+	}
+	for _, fn := range opts {
+		fn(e)
+	}
+	return e
+}
+
+func (e *ExHook) Load(service gmqtt.Server) error {
+	log = gmqtt.Logger("plugin/" + name)
+	e.events = make(chan *Event, eventBufferSize)
+	e.done = make(chan struct{})
+	if e.command != "" {
+		p, err := e.start()
+		if err != nil {
+			return err
+		}
+		e.setProvider(NewHookProviderClient(p.conn))
+		e.stopProcess = make(chan struct{})
+		e.supervisor.Add(1)
+		go e.supervise(p)
+	} else {
+		conn, err := grpc.Dial(e.addr, e.dialOpts...)
+		if err != nil {
+			return err
+		}
+		e.conn = conn
+		e.setProvider(NewHookProviderClient(conn))
+	}
+	if e.enabled[OnDeliver] || e.enabled[OnClose] {
+		e.wg.Add(1)
+		go e.eventLoop()
+	}
+	return nil
+}
+
+func (e *ExHook) Unload() error {
+	close(e.done)
+	e.wg.Wait()
+	if e.command != "" {
+		close(e.stopProcess)
+		e.supervisor.Wait()
+		return nil
+	}
+	return e.conn.Close()
+}
+
+func (e *ExHook) HookWrapper() gmqtt.HookWrapper {
+	w := gmqtt.HookWrapper{}
+	if e.enabled[OnConnect] {
+		w.OnConnectWrapper = e.OnConnectWrapper
+	}
+	if e.enabled[OnSubscribe] {
+		w.OnSubscribeWrapper = e.OnSubscribeWrapper
+	}
+	if e.enabled[OnMsgArrived] {
+		w.OnMsgArrivedWrapper = e.OnMsgArrivedWrapper
+	}
+	if e.enabled[OnDeliver] {
+		w.OnDeliverWrapper = e.OnDeliverWrapper
+	}
+	if e.enabled[OnClose] {
+		w.OnCloseWrapper = e.OnCloseWrapper
+	}
+	return w
+}
+
+func (e *ExHook) Name() string {
+	return e.name
+}
+
+// client returns the client of the HookProvider service.
+func (e *ExHook) client() HookProviderClient {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.provider
+}
+
+func (e *ExHook) setProvider(provider HookProviderClient) {
+	e.mu.Lock()
+	e.provider = provider
+	e.mu.Unlock()
+}
+
+func newClientInfo(client gmqtt.Client) *ClientInfo {
+	opts := client.OptionsReader()
+	rs := &ClientInfo{
+		ClientId:     opts.ClientID(),
+		Username:     opts.Username(),
+		Password:     opts.Password(),
+		KeepAlive:    uint32(opts.KeepAlive()),
+		CleanSession: opts.CleanSession(),
+	}
+	if addr := opts.RemoteAddr(); addr != nil {
+		rs.RemoteAddr = addr.String()
+	}
+	if addr := opts.LocalAddr(); addr != nil {
+		rs.LocalAddr = addr.String()
+	}
+	return rs
+}
+
+func newMessage(msg packets.Message) *Message {
+	return &Message{
+		TopicName: msg.Topic(),
+		Payload:   msg.Payload(),
+		Qos:       uint32(msg.Qos()),
+		Retained:  msg.Retained(),
+	}
+}
+
+// callContext returns the context of the call of the hook which is cancelled after the timeout of the hook.
+func (e *ExHook) callContext(ctx context.Context, hook Hook) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, e.hooks[hook].timeout)
+}
+
+// OnConnectWrapper delegates OnConnect to the external service.
+func (e *ExHook) OnConnectWrapper(connect gmqtt.OnConnect) gmqtt.OnConnect {
+	opts := e.hooks[OnConnect]
+	return func(ctx context.Context, client gmqtt.Client) (code uint8) {
+		cctx, cancel := e.callContext(ctx, OnConnect)
+		defer cancel()
+		rs, err := e.client().OnConnect(cctx, &ConnectRequest{Client: newClientInfo(client)})
+		if err != nil {
+			logCallError("OnConnect", client, err)
+			if opts.failPolicy == FailClosed {
+				return packets.CodeServerUnavaliable
+			}
+			return connect(ctx, client)
+		}
+		if rs.Code != packets.CodeAccepted {
+			return uint8(rs.Code)
+		}
+		return connect(ctx, client)
+	}
+}
+
+// OnSubscribeWrapper delegates OnSubscribe to the external service,
+// the next hook is called with the qos granted by the external service.
+func (e *ExHook) OnSubscribeWrapper(subscribe gmqtt.OnSubscribe) gmqtt.OnSubscribe {
+	opts := e.hooks[OnSubscribe]
+	return func(ctx context.Context, client gmqtt.Client, topic packets.Topic) (qos uint8) {
+		cctx, cancel := e.callContext(ctx, OnSubscribe)
+		defer cancel()
+		rs, err := e.client().OnSubscribe(cctx, &SubscribeRequest{
+			Client:      newClientInfo(client),
+			TopicFilter: topic.Name,
+			Qos:         uint32(topic.Qos),
+		})
+		if err != nil {
+			logCallError("OnSubscribe", client, err)
+			if opts.failPolicy == FailClosed {
+				return packets.SUBSCRIBE_FAILURE
+			}
+			return subscribe(ctx, client, topic)
+		}
+		if rs.Qos > uint32(packets.QOS_2) {
+			return packets.SUBSCRIBE_FAILURE
+		}
+		if uint8(rs.Qos) < topic.Qos {
+			topic.Qos = uint8(rs.Qos)
+		}
+		return subscribe(ctx, client, topic)
+	}
+}
+
+// OnMsgArrivedWrapper delegates OnMsgArrived to the external service.
+func (e *ExHook) OnMsgArrivedWrapper(arrived gmqtt.OnMsgArrived) gmqtt.OnMsgArrived {
+	opts := e.hooks[OnMsgArrived]
+	return func(ctx context.Context, client gmqtt.Client, msg packets.Message) (valid bool) {
+		cctx, cancel := e.callContext(ctx, OnMsgArrived)
+		defer cancel()
+		rs, err := e.client().OnMsgArrived(cctx, &MsgArrivedRequest{
+			Client:  newClientInfo(client),
+			Message: newMessage(msg),
+		})
+		if err != nil {
+			logCallError("OnMsgArrived", client, err)
+			if opts.failPolicy == FailClosed {
+				return false
+			}
+			return arrived(ctx, client, msg)
+		}
+		if !rs.Valid {
+			return false
+		}
+		return arrived(ctx, client, msg)
+	}
+}
+
+// OnDeliverWrapper sends the DeliverEvent to the external service asynchronously.
+func (e *ExHook) OnDeliverWrapper(deliver gmqtt.OnDeliver) gmqtt.OnDeliver {
+	return func(ctx context.Context, client gmqtt.Client, msg packets.Message) {
+		e.emit(&Event{Event: &Event_Deliver{Deliver: &DeliverEvent{
+			ClientId: client.OptionsReader().ClientID(),
+			Message:  newMessage(msg),
+		}}})
+		deliver(ctx, client, msg)
+	}
+}
+
+// OnCloseWrapper sends the CloseEvent to the external service asynchronously.
+func (e *ExHook) OnCloseWrapper(close gmqtt.OnClose) gmqtt.OnClose {
+	return func(ctx context.Context, client gmqtt.Client, err error) {
+		ev := &CloseEvent{ClientId: client.OptionsReader().ClientID()}
+		if err != nil {
+			ev.Error = err.Error()
+		}
+		e.emit(&Event{Event: &Event_Close{Close: ev}})
+		close(ctx, client, err)
+	}
+}
+
+func logCallError(hook string, client gmqtt.Client, err error) {
+	log.Warn("calling external hook error",
+		zap.String("hook", hook),
+		zap.String("client_id", client.OptionsReader().ClientID()),
+		zap.Error(err))
+}
+
+// emit buffers the event, it never blocks the hook.
+func (e *ExHook) emit(event *Event) {
+	event.Timestamp = time.Now().UnixNano()
+	select {
+	case e.events <- event:
+	default:
+		log.Warn("event buffer is full, dropping event")
+	}
+}
+
+// eventLoop sends the buffered events in batches until the plugin is unloaded.
+func (e *ExHook) eventLoop() {
+	defer e.wg.Done()
+	ticker := time.NewTicker(e.flushInterval)
+	defer ticker.Stop()
+	var stream HookProvider_OnEventsClient
+	batch := &EventBatch{}
+	flush := func() {
+		if len(batch.Events) == 0 {
+			return
+		}
+		var err error
+		if stream == nil {
+			stream, err = e.client().OnEvents(context.Background())
+		}
+		if err == nil {
+			err = stream.Send(batch)
+		}
+		if err != nil {
+			log.Warn("sending event batch error", zap.Int("dropped", len(batch.Events)), zap.Error(err))
+			// reopen the stream on the next flush.
+			stream = nil
+		}
+		batch = &EventBatch{}
+	}
+	for {
+		select {
+		case <-e.done:
+			// flush the buffered events before exit, this goroutine is the only receiver of the events.
+			for len(e.events) > 0 {
+				batch.Events = append(batch.Events, <-e.events)
+				if len(batch.Events) >= e.batchSize {
+					flush()
+				}
+			}
+			flush()
+			if stream != nil {
+				stream.CloseAndRecv()
+			}
+			return
+		case event := <-e.events:
+			batch.Events = append(batch.Events, event)
+			if len(batch.Events) >= e.batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
@@ -0,0 +1,988 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// source: exhook.proto
+
+package exhook
+
+import (
+	context "context"
+	fmt "fmt"
+	proto "github.com/golang/protobuf/proto"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+	math "math"
+)
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the proto package it is being compiled against.
+// A compilation error at this line likely means your copy of the
+// proto package needs to be updated.
+const _ = proto.ProtoPackageIsVersion3 // please upgrade the proto package
+
+type Empty struct {
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Empty) Reset()         { *m = Empty{} }
+func (m *Empty) String() string { return proto.CompactTextString(m) }
+func (*Empty) ProtoMessage()    {}
+func (*Empty) Descriptor() ([]byte, []int) {
+	return fileDescriptor_725ec35fc08a5ca2, []int{0}
+}
+
+func (m *Empty) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Empty.Unmarshal(m, b)
+}
+func (m *Empty) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Empty.Marshal(b, m, deterministic)
+}
+func (m *Empty) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Empty.Merge(m, src)
+}
+func (m *Empty) XXX_Size() int {
+	return xxx_messageInfo_Empty.Size(m)
+}
+func (m *Empty) XXX_DiscardUnknown() {
+	xxx_messageInfo_Empty.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Empty proto.InternalMessageInfo
+
+type ClientInfo struct {
+	ClientId             string   `protobuf:"bytes,1,opt,name=client_id,json=clientId,proto3" json:"client_id,omitempty"`
+	Username             string   `protobuf:"bytes,2,opt,name=username,proto3" json:"username,omitempty"`
+	Password             string   `protobuf:"bytes,3,opt,name=password,proto3" json:"password,omitempty"`
+	KeepAlive            uint32   `protobuf:"varint,4,opt,name=keep_alive,json=keepAlive,proto3" json:"keep_alive,omitempty"`
+	CleanSession         bool     `protobuf:"varint,5,opt,name=clean_session,json=cleanSession,proto3" json:"clean_session,omitempty"`
+	RemoteAddr           string   `protobuf:"bytes,6,opt,name=remote_addr,json=remoteAddr,proto3" json:"remote_addr,omitempty"`
+	LocalAddr            string   `protobuf:"bytes,7,opt,name=local_addr,json=localAddr,proto3" json:"local_addr,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ClientInfo) Reset()         { *m = ClientInfo{} }
+func (m *ClientInfo) String() string { return proto.CompactTextString(m) }
+func (*ClientInfo) ProtoMessage()    {}
+func (*ClientInfo) Descriptor() ([]byte, []int) {
+	return fileDescriptor_725ec35fc08a5ca2, []int{1}
+}
+
+func (m *ClientInfo) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ClientInfo.Unmarshal(m, b)
+}
+func (m *ClientInfo) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ClientInfo.Marshal(b, m, deterministic)
+}
+func (m *ClientInfo) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ClientInfo.Merge(m, src)
+}
+func (m *ClientInfo) XXX_Size() int {
+	return xxx_messageInfo_ClientInfo.Size(m)
+}
+func (m *ClientInfo) XXX_DiscardUnknown() {
+	xxx_messageInfo_ClientInfo.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ClientInfo proto.InternalMessageInfo
+
+func (m *ClientInfo) GetClientId() string {
+	if m != nil {
+		return m.ClientId
+	}
+	return ""
+}
+
+func (m *ClientInfo) GetUsername() string {
+	if m != nil {
+		return m.Username
+	}
+	return ""
+}
+
+func (m *ClientInfo) GetPassword() string {
+	if m != nil {
+		return m.Password
+	}
+	return ""
+}
+
+func (m *ClientInfo) GetKeepAlive() uint32 {
+	if m != nil {
+		return m.KeepAlive
+	}
+	return 0
+}
+
+func (m *ClientInfo) GetCleanSession() bool {
+	if m != nil {
+		return m.CleanSession
+	}
+	return false
+}
+
+func (m *ClientInfo) GetRemoteAddr() string {
+	if m != nil {
+		return m.RemoteAddr
+	}
+	return ""
+}
+
+func (m *ClientInfo) GetLocalAddr() string {
+	if m != nil {
+		return m.LocalAddr
+	}
+	return ""
+}
+
+type Message struct {
+	TopicName            string   `protobuf:"bytes,1,opt,name=topic_name,json=topicName,proto3" json:"topic_name,omitempty"`
+	Payload              []byte   `protobuf:"bytes,2,opt,name=payload,proto3" json:"payload,omitempty"`
+	Qos                  uint32   `protobuf:"varint,3,opt,name=qos,proto3" json:"qos,omitempty"`
+	Retained             bool     `protobuf:"varint,4,opt,name=retained,proto3" json:"retained,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Message) Reset()         { *m = Message{} }
+func (m *Message) String() string { return proto.CompactTextString(m) }
+func (*Message) ProtoMessage()    {}
+func (*Message) Descriptor() ([]byte, []int) {
+	return fileDescriptor_725ec35fc08a5ca2, []int{2}
+}
+
+func (m *Message) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Message.Unmarshal(m, b)
+}
+func (m *Message) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Message.Marshal(b, m, deterministic)
+}
+func (m *Message) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Message.Merge(m, src)
+}
+func (m *Message) XXX_Size() int {
+	return xxx_messageInfo_Message.Size(m)
+}
+func (m *Message) XXX_DiscardUnknown() {
+	xxx_messageInfo_Message.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Message proto.InternalMessageInfo
+
+func (m *Message) GetTopicName() string {
+	if m != nil {
+		return m.TopicName
+	}
+	return ""
+}
+
+func (m *Message) GetPayload() []byte {
+	if m != nil {
+		return m.Payload
+	}
+	return nil
+}
+
+func (m *Message) GetQos() uint32 {
+	if m != nil {
+		return m.Qos
+	}
+	return 0
+}
+
+func (m *Message) GetRetained() bool {
+	if m != nil {
+		return m.Retained
+	}
+	return false
+}
+
+type ConnectRequest struct {
+	Client               *ClientInfo `protobuf:"bytes,1,opt,name=client,proto3" json:"client,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}    `json:"-"`
+	XXX_unrecognized     []byte      `json:"-"`
+	XXX_sizecache        int32       `json:"-"`
+}
+
+func (m *ConnectRequest) Reset()         { *m = ConnectRequest{} }
+func (m *ConnectRequest) String() string { return proto.CompactTextString(m) }
+func (*ConnectRequest) ProtoMessage()    {}
+func (*ConnectRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_725ec35fc08a5ca2, []int{3}
+}
+
+func (m *ConnectRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ConnectRequest.Unmarshal(m, b)
+}
+func (m *ConnectRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ConnectRequest.Marshal(b, m, deterministic)
+}
+func (m *ConnectRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ConnectRequest.Merge(m, src)
+}
+func (m *ConnectRequest) XXX_Size() int {
+	return xxx_messageInfo_ConnectRequest.Size(m)
+}
+func (m *ConnectRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_ConnectRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ConnectRequest proto.InternalMessageInfo
+
+func (m *ConnectRequest) GetClient() *ClientInfo {
+	if m != nil {
+		return m.Client
+	}
+	return nil
+}
+
+type ConnectResponse struct {
+	// code is the return code of the CONNACK packet, 0 means the connection is accepted.
+	Code                 uint32   `protobuf:"varint,1,opt,name=code,proto3" json:"code,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ConnectResponse) Reset()         { *m = ConnectResponse{} }
+func (m *ConnectResponse) String() string { return proto.CompactTextString(m) }
+func (*ConnectResponse) ProtoMessage()    {}
+func (*ConnectResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_725ec35fc08a5ca2, []int{4}
+}
+
+func (m *ConnectResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ConnectResponse.Unmarshal(m, b)
+}
+func (m *ConnectResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ConnectResponse.Marshal(b, m, deterministic)
+}
+func (m *ConnectResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ConnectResponse.Merge(m, src)
+}
+func (m *ConnectResponse) XXX_Size() int {
+	return xxx_messageInfo_ConnectResponse.Size(m)
+}
+func (m *ConnectResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_ConnectResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ConnectResponse proto.InternalMessageInfo
+
+func (m *ConnectResponse) GetCode() uint32 {
+	if m != nil {
+		return m.Code
+	}
+	return 0
+}
+
+type SubscribeRequest struct {
+	Client               *ClientInfo `protobuf:"bytes,1,opt,name=client,proto3" json:"client,omitempty"`
+	TopicFilter          string      `protobuf:"bytes,2,opt,name=topic_filter,json=topicFilter,proto3" json:"topic_filter,omitempty"`
+	Qos                  uint32      `protobuf:"varint,3,opt,name=qos,proto3" json:"qos,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}    `json:"-"`
+	XXX_unrecognized     []byte      `json:"-"`
+	XXX_sizecache        int32       `json:"-"`
+}
+
+func (m *SubscribeRequest) Reset()         { *m = SubscribeRequest{} }
+func (m *SubscribeRequest) String() string { return proto.CompactTextString(m) }
+func (*SubscribeRequest) ProtoMessage()    {}
+func (*SubscribeRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_725ec35fc08a5ca2, []int{5}
+}
+
+func (m *SubscribeRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_SubscribeRequest.Unmarshal(m, b)
+}
+func (m *SubscribeRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_SubscribeRequest.Marshal(b, m, deterministic)
+}
+func (m *SubscribeRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_SubscribeRequest.Merge(m, src)
+}
+func (m *SubscribeRequest) XXX_Size() int {
+	return xxx_messageInfo_SubscribeRequest.Size(m)
+}
+func (m *SubscribeRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_SubscribeRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_SubscribeRequest proto.InternalMessageInfo
+
+func (m *SubscribeRequest) GetClient() *ClientInfo {
+	if m != nil {
+		return m.Client
+	}
+	return nil
+}
+
+func (m *SubscribeRequest) GetTopicFilter() string {
+	if m != nil {
+		return m.TopicFilter
+	}
+	return ""
+}
+
+func (m *SubscribeRequest) GetQos() uint32 {
+	if m != nil {
+		return m.Qos
+	}
+	return 0
+}
+
+type SubscribeResponse struct {
+	// qos is the granted qos, 128 (0x80) means the subscription is rejected.
+	Qos                  uint32   `protobuf:"varint,1,opt,name=qos,proto3" json:"qos,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *SubscribeResponse) Reset()         { *m = SubscribeResponse{} }
+func (m *SubscribeResponse) String() string { return proto.CompactTextString(m) }
+func (*SubscribeResponse) ProtoMessage()    {}
+func (*SubscribeResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_725ec35fc08a5ca2, []int{6}
+}
+
+func (m *SubscribeResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_SubscribeResponse.Unmarshal(m, b)
+}
+func (m *SubscribeResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_SubscribeResponse.Marshal(b, m, deterministic)
+}
+func (m *SubscribeResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_SubscribeResponse.Merge(m, src)
+}
+func (m *SubscribeResponse) XXX_Size() int {
+	return xxx_messageInfo_SubscribeResponse.Size(m)
+}
+func (m *SubscribeResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_SubscribeResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_SubscribeResponse proto.InternalMessageInfo
+
+func (m *SubscribeResponse) GetQos() uint32 {
+	if m != nil {
+		return m.Qos
+	}
+	return 0
+}
+
+type MsgArrivedRequest struct {
+	Client               *ClientInfo `protobuf:"bytes,1,opt,name=client,proto3" json:"client,omitempty"`
+	Message              *Message    `protobuf:"bytes,2,opt,name=message,proto3" json:"message,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}    `json:"-"`
+	XXX_unrecognized     []byte      `json:"-"`
+	XXX_sizecache        int32       `json:"-"`
+}
+
+func (m *MsgArrivedRequest) Reset()         { *m = MsgArrivedRequest{} }
+func (m *MsgArrivedRequest) String() string { return proto.CompactTextString(m) }
+func (*MsgArrivedRequest) ProtoMessage()    {}
+func (*MsgArrivedRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_725ec35fc08a5ca2, []int{7}
+}
+
+func (m *MsgArrivedRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_MsgArrivedRequest.Unmarshal(m, b)
+}
+func (m *MsgArrivedRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_MsgArrivedRequest.Marshal(b, m, deterministic)
+}
+func (m *MsgArrivedRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_MsgArrivedRequest.Merge(m, src)
+}
+func (m *MsgArrivedRequest) XXX_Size() int {
+	return xxx_messageInfo_MsgArrivedRequest.Size(m)
+}
+func (m *MsgArrivedRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_MsgArrivedRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_MsgArrivedRequest proto.InternalMessageInfo
+
+func (m *MsgArrivedRequest) GetClient() *ClientInfo {
+	if m != nil {
+		return m.Client
+	}
+	return nil
+}
+
+func (m *MsgArrivedRequest) GetMessage() *Message {
+	if m != nil {
+		return m.Message
+	}
+	return nil
+}
+
+type MsgArrivedResponse struct {
+	// valid is false if the message should be dropped.
+	Valid                bool     `protobuf:"varint,1,opt,name=valid,proto3" json:"valid,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *MsgArrivedResponse) Reset()         { *m = MsgArrivedResponse{} }
+func (m *MsgArrivedResponse) String() string { return proto.CompactTextString(m) }
+func (*MsgArrivedResponse) ProtoMessage()    {}
+func (*MsgArrivedResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_725ec35fc08a5ca2, []int{8}
+}
+
+func (m *MsgArrivedResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_MsgArrivedResponse.Unmarshal(m, b)
+}
+func (m *MsgArrivedResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_MsgArrivedResponse.Marshal(b, m, deterministic)
+}
+func (m *MsgArrivedResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_MsgArrivedResponse.Merge(m, src)
+}
+func (m *MsgArrivedResponse) XXX_Size() int {
+	return xxx_messageInfo_MsgArrivedResponse.Size(m)
+}
+func (m *MsgArrivedResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_MsgArrivedResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_MsgArrivedResponse proto.InternalMessageInfo
+
+func (m *MsgArrivedResponse) GetValid() bool {
+	if m != nil {
+		return m.Valid
+	}
+	return false
+}
+
+type DeliverEvent struct {
+	ClientId             string   `protobuf:"bytes,1,opt,name=client_id,json=clientId,proto3" json:"client_id,omitempty"`
+	Message              *Message `protobuf:"bytes,2,opt,name=message,proto3" json:"message,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *DeliverEvent) Reset()         { *m = DeliverEvent{} }
+func (m *DeliverEvent) String() string { return proto.CompactTextString(m) }
+func (*DeliverEvent) ProtoMessage()    {}
+func (*DeliverEvent) Descriptor() ([]byte, []int) {
+	return fileDescriptor_725ec35fc08a5ca2, []int{9}
+}
+
+func (m *DeliverEvent) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_DeliverEvent.Unmarshal(m, b)
+}
+func (m *DeliverEvent) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_DeliverEvent.Marshal(b, m, deterministic)
+}
+func (m *DeliverEvent) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_DeliverEvent.Merge(m, src)
+}
+func (m *DeliverEvent) XXX_Size() int {
+	return xxx_messageInfo_DeliverEvent.Size(m)
+}
+func (m *DeliverEvent) XXX_DiscardUnknown() {
+	xxx_messageInfo_DeliverEvent.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_DeliverEvent proto.InternalMessageInfo
+
+func (m *DeliverEvent) GetClientId() string {
+	if m != nil {
+		return m.ClientId
+	}
+	return ""
+}
+
+func (m *DeliverEvent) GetMessage() *Message {
+	if m != nil {
+		return m.Message
+	}
+	return nil
+}
+
+type CloseEvent struct {
+	ClientId string `protobuf:"bytes,1,opt,name=client_id,json=clientId,proto3" json:"client_id,omitempty"`
+	// error is the reason of the close, empty means the client disconnected normally.
+	Error                string   `protobuf:"bytes,2,opt,name=error,proto3" json:"error,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *CloseEvent) Reset()         { *m = CloseEvent{} }
+func (m *CloseEvent) String() string { return proto.CompactTextString(m) }
+func (*CloseEvent) ProtoMessage()    {}
+func (*CloseEvent) Descriptor() ([]byte, []int) {
+	return fileDescriptor_725ec35fc08a5ca2, []int{10}
+}
+
+func (m *CloseEvent) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_CloseEvent.Unmarshal(m, b)
+}
+func (m *CloseEvent) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_CloseEvent.Marshal(b, m, deterministic)
+}
+func (m *CloseEvent) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_CloseEvent.Merge(m, src)
+}
+func (m *CloseEvent) XXX_Size() int {
+	return xxx_messageInfo_CloseEvent.Size(m)
+}
+func (m *CloseEvent) XXX_DiscardUnknown() {
+	xxx_messageInfo_CloseEvent.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_CloseEvent proto.InternalMessageInfo
+
+func (m *CloseEvent) GetClientId() string {
+	if m != nil {
+		return m.ClientId
+	}
+	return ""
+}
+
+func (m *CloseEvent) GetError() string {
+	if m != nil {
+		return m.Error
+	}
+	return ""
+}
+
+type Event struct {
+	// timestamp is the time of the event in unix nanoseconds.
+	Timestamp int64 `protobuf:"varint,1,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+	// Types that are valid to be assigned to Event:
+	//	*Event_Deliver
+	//	*Event_Close
+	Event                isEvent_Event `protobuf_oneof:"event"`
+	XXX_NoUnkeyedLiteral struct{}      `json:"-"`
+	XXX_unrecognized     []byte        `json:"-"`
+	XXX_sizecache        int32         `json:"-"`
+}
+
+func (m *Event) Reset()         { *m = Event{} }
+func (m *Event) String() string { return proto.CompactTextString(m) }
+func (*Event) ProtoMessage()    {}
+func (*Event) Descriptor() ([]byte, []int) {
+	return fileDescriptor_725ec35fc08a5ca2, []int{11}
+}
+
+func (m *Event) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Event.Unmarshal(m, b)
+}
+func (m *Event) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Event.Marshal(b, m, deterministic)
+}
+func (m *Event) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Event.Merge(m, src)
+}
+func (m *Event) XXX_Size() int {
+	return xxx_messageInfo_Event.Size(m)
+}
+func (m *Event) XXX_DiscardUnknown() {
+	xxx_messageInfo_Event.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Event proto.InternalMessageInfo
+
+func (m *Event) GetTimestamp() int64 {
+	if m != nil {
+		return m.Timestamp
+	}
+	return 0
+}
+
+type isEvent_Event interface {
+	isEvent_Event()
+}
+
+type Event_Deliver struct {
+	Deliver *DeliverEvent `protobuf:"bytes,2,opt,name=deliver,proto3,oneof"`
+}
+
+type Event_Close struct {
+	Close *CloseEvent `protobuf:"bytes,3,opt,name=close,proto3,oneof"`
+}
+
+func (*Event_Deliver) isEvent_Event() {}
+
+func (*Event_Close) isEvent_Event() {}
+
+func (m *Event) GetEvent() isEvent_Event {
+	if m != nil {
+		return m.Event
+	}
+	return nil
+}
+
+func (m *Event) GetDeliver() *DeliverEvent {
+	if x, ok := m.GetEvent().(*Event_Deliver); ok {
+		return x.Deliver
+	}
+	return nil
+}
+
+func (m *Event) GetClose() *CloseEvent {
+	if x, ok := m.GetEvent().(*Event_Close); ok {
+		return x.Close
+	}
+	return nil
+}
+
+// XXX_OneofWrappers is for the internal use of the proto package.
+func (*Event) XXX_OneofWrappers() []interface{} {
+	return []interface{}{
+		(*Event_Deliver)(nil),
+		(*Event_Close)(nil),
+	}
+}
+
+type EventBatch struct {
+	Events               []*Event `protobuf:"bytes,1,rep,name=events,proto3" json:"events,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *EventBatch) Reset()         { *m = EventBatch{} }
+func (m *EventBatch) String() string { return proto.CompactTextString(m) }
+func (*EventBatch) ProtoMessage()    {}
+func (*EventBatch) Descriptor() ([]byte, []int) {
+	return fileDescriptor_725ec35fc08a5ca2, []int{12}
+}
+
+func (m *EventBatch) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_EventBatch.Unmarshal(m, b)
+}
+func (m *EventBatch) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_EventBatch.Marshal(b, m, deterministic)
+}
+func (m *EventBatch) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_EventBatch.Merge(m, src)
+}
+func (m *EventBatch) XXX_Size() int {
+	return xxx_messageInfo_EventBatch.Size(m)
+}
+func (m *EventBatch) XXX_DiscardUnknown() {
+	xxx_messageInfo_EventBatch.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_EventBatch proto.InternalMessageInfo
+
+func (m *EventBatch) GetEvents() []*Event {
+	if m != nil {
+		return m.Events
+	}
+	return nil
+}
+
+func init() {
+	proto.RegisterType((*Empty)(nil), "gmqtt.exhook.Empty")
+	proto.RegisterType((*ClientInfo)(nil), "gmqtt.exhook.ClientInfo")
+	proto.RegisterType((*Message)(nil), "gmqtt.exhook.Message")
+	proto.RegisterType((*ConnectRequest)(nil), "gmqtt.exhook.ConnectRequest")
+	proto.RegisterType((*ConnectResponse)(nil), "gmqtt.exhook.ConnectResponse")
+	proto.RegisterType((*SubscribeRequest)(nil), "gmqtt.exhook.SubscribeRequest")
+	proto.RegisterType((*SubscribeResponse)(nil), "gmqtt.exhook.SubscribeResponse")
+	proto.RegisterType((*MsgArrivedRequest)(nil), "gmqtt.exhook.MsgArrivedRequest")
+	proto.RegisterType((*MsgArrivedResponse)(nil), "gmqtt.exhook.MsgArrivedResponse")
+	proto.RegisterType((*DeliverEvent)(nil), "gmqtt.exhook.DeliverEvent")
+	proto.RegisterType((*CloseEvent)(nil), "gmqtt.exhook.CloseEvent")
+	proto.RegisterType((*Event)(nil), "gmqtt.exhook.Event")
+	proto.RegisterType((*EventBatch)(nil), "gmqtt.exhook.EventBatch")
+}
+
+func init() { proto.RegisterFile("exhook.proto", fileDescriptor_725ec35fc08a5ca2) }
+
+var fileDescriptor_725ec35fc08a5ca2 = []byte{
+	// 681 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x9c, 0x55, 0xdb, 0x4e, 0xdb, 0x40,
+	0x10, 0xc5, 0x84, 0xdc, 0x26, 0x4e, 0x0b, 0x5b, 0x2a, 0x59, 0x29, 0x94, 0xd4, 0x15, 0x52, 0xd4,
+	0x4a, 0x09, 0x4a, 0xa5, 0x4a, 0x15, 0x0f, 0x15, 0x01, 0xaa, 0xf0, 0x00, 0x69, 0x97, 0xb7, 0xaa,
+	0x52, 0xe4, 0xd8, 0x43, 0xb0, 0xb0, 0xbd, 0x66, 0x77, 0x93, 0x96, 0x3f, 0xe9, 0xa7, 0xf4, 0x87,
+	0xfa, 0x1f, 0xd5, 0xee, 0xda, 0xe4, 0x02, 0x54, 0x2d, 0x4f, 0x78, 0xce, 0x9c, 0x99, 0x39, 0x73,
+	0x59, 0x02, 0x36, 0xfe, 0xb8, 0x64, 0xec, 0xaa, 0x9d, 0x72, 0x26, 0x19, 0xb1, 0xc7, 0xf1, 0xb5,
+	0x94, 0x6d, 0x83, 0xb9, 0x65, 0x28, 0x1e, 0xc7, 0xa9, 0xbc, 0x71, 0x7f, 0x5b, 0x00, 0x87, 0x51,
+	0x88, 0x89, 0x3c, 0x49, 0x2e, 0x18, 0x79, 0x01, 0x55, 0x5f, 0x5b, 0xc3, 0x30, 0x70, 0xac, 0xa6,
+	0xd5, 0xaa, 0xd2, 0x8a, 0x01, 0x4e, 0x02, 0xd2, 0x80, 0xca, 0x44, 0x20, 0x4f, 0xbc, 0x18, 0x9d,
+	0x55, 0xe3, 0xcb, 0x6d, 0xe5, 0x4b, 0x3d, 0x21, 0xbe, 0x33, 0x1e, 0x38, 0x05, 0xe3, 0xcb, 0x6d,
+	0xb2, 0x0d, 0x70, 0x85, 0x98, 0x0e, 0xbd, 0x28, 0x9c, 0xa2, 0xb3, 0xd6, 0xb4, 0x5a, 0x75, 0x5a,
+	0x55, 0xc8, 0x81, 0x02, 0xc8, 0x6b, 0xa8, 0xfb, 0x11, 0x7a, 0xc9, 0x50, 0xa0, 0x10, 0x21, 0x4b,
+	0x9c, 0x62, 0xd3, 0x6a, 0x55, 0xa8, 0xad, 0xc1, 0x73, 0x83, 0x91, 0x1d, 0xa8, 0x71, 0x8c, 0x99,
+	0xc4, 0xa1, 0x17, 0x04, 0xdc, 0x29, 0xe9, 0x12, 0x60, 0xa0, 0x83, 0x20, 0xe0, 0xaa, 0x48, 0xc4,
+	0x7c, 0x2f, 0x32, 0xfe, 0xb2, 0xf6, 0x57, 0x35, 0xa2, 0xdc, 0x6e, 0x0a, 0xe5, 0x53, 0x14, 0xc2,
+	0x1b, 0xa3, 0x62, 0x4a, 0x96, 0x86, 0xfe, 0x50, 0x37, 0x62, 0x9a, 0xac, 0x6a, 0xe4, 0x4c, 0x75,
+	0xe2, 0x40, 0x39, 0xf5, 0x6e, 0x22, 0xe6, 0x05, 0xba, 0x49, 0x9b, 0xe6, 0x26, 0x59, 0x87, 0xc2,
+	0x35, 0x13, 0xba, 0xbd, 0x3a, 0x55, 0x9f, 0xaa, 0x6b, 0x8e, 0xd2, 0x0b, 0x13, 0x0c, 0x74, 0x5f,
+	0x15, 0x7a, 0x6b, 0xbb, 0x3d, 0x78, 0x72, 0xc8, 0x92, 0x04, 0x7d, 0x49, 0xf1, 0x7a, 0x82, 0x42,
+	0x92, 0x3d, 0x28, 0x99, 0x59, 0xea, 0xa2, 0xb5, 0xae, 0xd3, 0x9e, 0xdf, 0x49, 0x7b, 0xb6, 0x06,
+	0x9a, 0xf1, 0xdc, 0x5d, 0x78, 0x7a, 0x9b, 0x43, 0xa4, 0x2c, 0x11, 0x48, 0x08, 0xac, 0xf9, 0x2c,
+	0x30, 0xba, 0xeb, 0x54, 0x7f, 0xbb, 0x37, 0xb0, 0x7e, 0x3e, 0x19, 0x09, 0x9f, 0x87, 0x23, 0x7c,
+	0x74, 0x31, 0xf2, 0x0a, 0x6c, 0x33, 0x97, 0x8b, 0x30, 0x92, 0xc8, 0xb3, 0x15, 0xd7, 0x34, 0xf6,
+	0x49, 0x43, 0x77, 0x27, 0xe0, 0xee, 0xc2, 0xc6, 0x5c, 0xe9, 0x4c, 0x63, 0x46, 0xb3, 0x66, 0xb4,
+	0x29, 0x6c, 0x9c, 0x8a, 0xf1, 0x01, 0xe7, 0xe1, 0x14, 0x83, 0xc7, 0x4b, 0xec, 0x40, 0x39, 0x36,
+	0x5b, 0xd4, 0xea, 0x6a, 0xdd, 0xe7, 0x8b, 0x21, 0xd9, 0x8a, 0x69, 0xce, 0x72, 0xdf, 0x00, 0x99,
+	0xaf, 0x9b, 0xe9, 0xdb, 0x84, 0xe2, 0xd4, 0x8b, 0xb2, 0x0b, 0xaf, 0x50, 0x63, 0xb8, 0xdf, 0xc0,
+	0x3e, 0x42, 0x75, 0x91, 0xfc, 0x78, 0xaa, 0x8a, 0xfd, 0xf5, 0x2d, 0xfc, 0xb7, 0x92, 0x8f, 0xea,
+	0x9d, 0x31, 0x81, 0xff, 0x90, 0x7b, 0x13, 0x8a, 0xc8, 0x39, 0xcb, 0x37, 0x60, 0x0c, 0xf7, 0xa7,
+	0x05, 0x45, 0x13, 0xbc, 0x05, 0x55, 0x19, 0xc6, 0x28, 0xa4, 0x17, 0xa7, 0x3a, 0xb8, 0x40, 0x67,
+	0x00, 0x79, 0x0f, 0xe5, 0xc0, 0xb4, 0x91, 0x29, 0x6b, 0x2c, 0x2a, 0x9b, 0xef, 0xb1, 0xbf, 0x42,
+	0x73, 0x32, 0xd9, 0x83, 0xa2, 0xaf, 0x04, 0x3a, 0x85, 0xfb, 0x97, 0x91, 0x6b, 0xef, 0xaf, 0x50,
+	0x43, 0xec, 0x95, 0xa1, 0x88, 0x0a, 0x71, 0x3f, 0x00, 0x68, 0x57, 0xcf, 0x93, 0xfe, 0x25, 0x79,
+	0x0b, 0x25, 0x0d, 0xab, 0x03, 0x28, 0xb4, 0x6a, 0xdd, 0x67, 0x8b, 0x99, 0x34, 0x93, 0x66, 0x94,
+	0xee, 0xaf, 0x55, 0xb0, 0xfb, 0x8c, 0x5d, 0x7d, 0xe6, 0x6c, 0x1a, 0x06, 0xc8, 0x49, 0x1f, 0xaa,
+	0x83, 0x24, 0x3b, 0x7a, 0xb2, 0xb5, 0x24, 0x62, 0xe1, 0x3d, 0x35, 0xb6, 0x1f, 0xf0, 0x66, 0x5b,
+	0x3e, 0x83, 0xda, 0x20, 0xb9, 0x3d, 0x4e, 0xf2, 0x72, 0x91, 0xbd, 0xfc, 0x60, 0x1a, 0x3b, 0x0f,
+	0xfa, 0xb3, 0x7c, 0x5f, 0xc0, 0x1e, 0x24, 0xb3, 0x6b, 0x22, 0x4b, 0x01, 0x77, 0xee, 0xbb, 0xd1,
+	0x7c, 0x98, 0x90, 0xa5, 0xdc, 0x87, 0xca, 0x20, 0xd1, 0x03, 0x11, 0xc4, 0xb9, 0x67, 0x4c, 0x7a,
+	0xa0, 0x8d, 0xe5, 0x01, 0xaa, 0x7f, 0xdc, 0x2d, 0xab, 0xb7, 0xf7, 0xb5, 0x3d, 0x0e, 0xe5, 0xe5,
+	0x64, 0xd4, 0xf6, 0x59, 0xdc, 0x39, 0xe2, 0xb1, 0x37, 0x0e, 0xfd, 0xe3, 0x8e, 0xe6, 0x76, 0xd2,
+	0x68, 0x32, 0x0e, 0x93, 0x8e, 0x09, 0xd9, 0x37, 0x7f, 0x46, 0x25, 0xfd, 0x53, 0xf0, 0xee, 0xcf,
+	0x00, 0x94, 0xc9, 0x97, 0x48, 0x1a, 0x06, 0x00, 0x00,
+}
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ context.Context
+var _ grpc.ClientConn
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+const _ = grpc.SupportPackageIsVersion4
+
+// HookProviderClient is the client API for HookProvider service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://godoc.org/google.golang.org/grpc#ClientConn.NewStream.
+type HookProviderClient interface {
+	// OnConnect authenticates the client, see gmqtt.OnConnect.
+	OnConnect(ctx context.Context, in *ConnectRequest, opts ...grpc.CallOption) (*ConnectResponse, error)
+	// OnSubscribe authorizes the subscription, see gmqtt.OnSubscribe.
+	OnSubscribe(ctx context.Context, in *SubscribeRequest, opts ...grpc.CallOption) (*SubscribeResponse, error)
+	// OnMsgArrived authorizes the published message, see gmqtt.OnMsgArrived.
+	OnMsgArrived(ctx context.Context, in *MsgArrivedRequest, opts ...grpc.CallOption) (*MsgArrivedResponse, error)
+	// OnEvents receives the batches of the events of the notification hooks: OnDeliver and OnClose.
+	// The broker keeps the stream open and sends a batch when it is full or the flush interval elapses.
+	OnEvents(ctx context.Context, opts ...grpc.CallOption) (HookProvider_OnEventsClient, error)
+}
+
+type hookProviderClient struct {
+	cc *grpc.ClientConn
+}
+
+func NewHookProviderClient(cc *grpc.ClientConn) HookProviderClient {
+	return &hookProviderClient{cc}
+}
+
+func (c *hookProviderClient) OnConnect(ctx context.Context, in *ConnectRequest, opts ...grpc.CallOption) (*ConnectResponse, error) {
+	out := new(ConnectResponse)
+	err := c.cc.Invoke(ctx, "/gmqtt.exhook.HookProvider/OnConnect", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *hookProviderClient) OnSubscribe(ctx context.Context, in *SubscribeRequest, opts ...grpc.CallOption) (*SubscribeResponse, error) {
+	out := new(SubscribeResponse)
+	err := c.cc.Invoke(ctx, "/gmqtt.exhook.HookProvider/OnSubscribe", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *hookProviderClient) OnMsgArrived(ctx context.Context, in *MsgArrivedRequest, opts ...grpc.CallOption) (*MsgArrivedResponse, error) {
+	out := new(MsgArrivedResponse)
+	err := c.cc.Invoke(ctx, "/gmqtt.exhook.HookProvider/OnMsgArrived", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *hookProviderClient) OnEvents(ctx context.Context, opts ...grpc.CallOption) (HookProvider_OnEventsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_HookProvider_serviceDesc.Streams[0], "/gmqtt.exhook.HookProvider/OnEvents", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &hookProviderOnEventsClient{stream}
+	return x, nil
+}
+
+type HookProvider_OnEventsClient interface {
+	Send(*EventBatch) error
+	CloseAndRecv() (*Empty, error)
+	grpc.ClientStream
+}
+
+type hookProviderOnEventsClient struct {
+	grpc.ClientStream
+}
+
+func (x *hookProviderOnEventsClient) Send(m *EventBatch) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *hookProviderOnEventsClient) CloseAndRecv() (*Empty, error) {
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	m := new(Empty)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// HookProviderServer is the server API for HookProvider service.
+type HookProviderServer interface {
+	// OnConnect authenticates the client, see gmqtt.OnConnect.
+	OnConnect(context.Context, *ConnectRequest) (*ConnectResponse, error)
+	// OnSubscribe authorizes the subscription, see gmqtt.OnSubscribe.
+	OnSubscribe(context.Context, *SubscribeRequest) (*SubscribeResponse, error)
+	// OnMsgArrived authorizes the published message, see gmqtt.OnMsgArrived.
+	OnMsgArrived(context.Context, *MsgArrivedRequest) (*MsgArrivedResponse, error)
+	// OnEvents receives the batches of the events of the notification hooks: OnDeliver and OnClose.
+	// The broker keeps the stream open and sends a batch when it is full or the flush interval elapses.
+	OnEvents(HookProvider_OnEventsServer) error
+}
+
+// UnimplementedHookProviderServer can be embedded to have forward compatible implementations.
+type UnimplementedHookProviderServer struct {
+}
+
+func (*UnimplementedHookProviderServer) OnConnect(ctx context.Context, req *ConnectRequest) (*ConnectResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method OnConnect not implemented")
+}
+func (*UnimplementedHookProviderServer) OnSubscribe(ctx context.Context, req *SubscribeRequest) (*SubscribeResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method OnSubscribe not implemented")
+}
+func (*UnimplementedHookProviderServer) OnMsgArrived(ctx context.Context, req *MsgArrivedRequest) (*MsgArrivedResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method OnMsgArrived not implemented")
+}
+func (*UnimplementedHookProviderServer) OnEvents(srv HookProvider_OnEventsServer) error {
+	return status.Errorf(codes.Unimplemented, "method OnEvents not implemented")
+}
+
+func RegisterHookProviderServer(s *grpc.Server, srv HookProviderServer) {
+	s.RegisterService(&_HookProvider_serviceDesc, srv)
+}
+
+func _HookProvider_OnConnect_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ConnectRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(HookProviderServer).OnConnect(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/gmqtt.exhook.HookProvider/OnConnect",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(HookProviderServer).OnConnect(ctx, req.(*ConnectRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _HookProvider_OnSubscribe_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SubscribeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(HookProviderServer).OnSubscribe(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/gmqtt.exhook.HookProvider/OnSubscribe",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(HookProviderServer).OnSubscribe(ctx, req.(*SubscribeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _HookProvider_OnMsgArrived_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(MsgArrivedRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(HookProviderServer).OnMsgArrived(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/gmqtt.exhook.HookProvider/OnMsgArrived",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(HookProviderServer).OnMsgArrived(ctx, req.(*MsgArrivedRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _HookProvider_OnEvents_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(HookProviderServer).OnEvents(&hookProviderOnEventsServer{stream})
+}
+
+type HookProvider_OnEventsServer interface {
+	SendAndClose(*Empty) error
+	Recv() (*EventBatch, error)
+	grpc.ServerStream
+}
+
+type hookProviderOnEventsServer struct {
+	grpc.ServerStream
+}
+
+func (x *hookProviderOnEventsServer) SendAndClose(m *Empty) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *hookProviderOnEventsServer) Recv() (*EventBatch, error) {
+	m := new(EventBatch)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+var _HookProvider_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "gmqtt.exhook.HookProvider",
+	HandlerType: (*HookProviderServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "OnConnect",
+			Handler:    _HookProvider_OnConnect_Handler,
+		},
+		{
+			MethodName: "OnSubscribe",
+			Handler:    _HookProvider_OnSubscribe_Handler,
+		},
+		{
+			MethodName: "OnMsgArrived",
+			Handler:    _HookProvider_OnMsgArrived_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "OnEvents",
+			Handler:       _HookProvider_OnEvents_Handler,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "exhook.proto",
+}
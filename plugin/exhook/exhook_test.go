@@ -0,0 +1,329 @@
+package exhook
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+
+	"github.com/DrmagicE/gmqtt"
+	"github.com/DrmagicE/gmqtt/internal/testutil"
+	"github.com/DrmagicE/gmqtt/pkg/packets"
+)
+
+func newTestClient(clientID string) *testutil.Client {
+	return &testutil.Client{Opts: &testutil.ClientOptions{
+		ID:     clientID,
+		User:   "user",
+		Pass:   "pass",
+		Keep:   30,
+		Clean:  true,
+		Remote: &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 50000},
+		Local:  &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 1883},
+	}}
+}
+
+// provider is the fake HookProvider service, it records the requests and responds by the fields.
+type provider struct {
+	UnimplementedHookProviderServer
+
+	mu         sync.Mutex
+	connects   []*ConnectRequest
+	subscribes []*SubscribeRequest
+	arrives    []*MsgArrivedRequest
+	events     []*Event
+	code       uint32
+	qos        uint32
+	valid      bool
+	// delay delays the responses of the decision hooks.
+	delay time.Duration
+}
+
+func (p *provider) wait(ctx context.Context) error {
+	p.mu.Lock()
+	delay := p.delay
+	p.mu.Unlock()
+	if delay == 0 {
+		return nil
+	}
+	select {
+	case <-time.After(delay):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (p *provider) OnConnect(ctx context.Context, req *ConnectRequest) (*ConnectResponse, error) {
+	if err := p.wait(ctx); err != nil {
+		return nil, err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.connects = append(p.connects, req)
+	return &ConnectResponse{Code: p.code}, nil
+}
+
+func (p *provider) OnSubscribe(ctx context.Context, req *SubscribeRequest) (*SubscribeResponse, error) {
+	if err := p.wait(ctx); err != nil {
+		return nil, err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.subscribes = append(p.subscribes, req)
+	return &SubscribeResponse{Qos: p.qos}, nil
+}
+
+func (p *provider) OnMsgArrived(ctx context.Context, req *MsgArrivedRequest) (*MsgArrivedResponse, error) {
+	if err := p.wait(ctx); err != nil {
+		return nil, err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.arrives = append(p.arrives, req)
+	return &MsgArrivedResponse{Valid: p.valid}, nil
+}
+
+func (p *provider) OnEvents(srv HookProvider_OnEventsServer) error {
+	for {
+		batch, err := srv.Recv()
+		if err == io.EOF {
+			return srv.SendAndClose(&Empty{})
+		}
+		if err != nil {
+			return err
+		}
+		p.mu.Lock()
+		p.events = append(p.events, batch.Events...)
+		p.mu.Unlock()
+	}
+}
+
+// startProvider serves the provider on a local port.
+func startProvider(t *testing.T, p *provider) (addr string, stop func()) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := grpc.NewServer()
+	RegisterHookProviderServer(s, p)
+	go s.Serve(ln)
+	return ln.Addr().String(), s.Stop
+}
+
+func loadExHook(t *testing.T, addr string, opts ...Option) *ExHook {
+	e := New(addr, opts...)
+	if err := e.Load(nil); err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+func TestNewClientInfo(t *testing.T) {
+	a := assert.New(t)
+	a.Equal(&ClientInfo{
+		ClientId:     "id",
+		Username:     "user",
+		Password:     "pass",
+		KeepAlive:    30,
+		CleanSession: true,
+		RemoteAddr:   "127.0.0.1:50000",
+		LocalAddr:    "127.0.0.1:1883",
+	}, newClientInfo(newTestClient("id")))
+
+	// the missing addresses are left empty.
+	c := newTestClient("id")
+	c.Opts.Remote, c.Opts.Local = nil, nil
+	info := newClientInfo(c)
+	a.Empty(info.RemoteAddr)
+	a.Empty(info.LocalAddr)
+}
+
+func TestNewMessage(t *testing.T) {
+	a := assert.New(t)
+	a.Equal(&Message{
+		TopicName: "a/b",
+		Payload:   []byte("payload"),
+		Qos:       2,
+		Retained:  true,
+	}, newMessage(gmqtt.NewMessage("a/b", []byte("payload"), packets.QOS_2, gmqtt.Retained(true))))
+}
+
+func TestExHook_OnConnect(t *testing.T) {
+	a := assert.New(t)
+	p := &provider{code: packets.CodeAccepted}
+	addr, stop := startProvider(t, p)
+	defer stop()
+	e := loadExHook(t, addr)
+	defer e.Unload()
+
+	var called bool
+	connect := e.OnConnectWrapper(func(ctx context.Context, client gmqtt.Client) uint8 {
+		called = true
+		return packets.CodeAccepted
+	})
+	a.EqualValues(packets.CodeAccepted, connect(context.Background(), newTestClient("id")))
+	a.True(called)
+	if a.Len(p.connects, 1) {
+		a.Equal("id", p.connects[0].Client.ClientId)
+		a.Equal("pass", p.connects[0].Client.Password)
+	}
+
+	// the code of the external service is returned without calling the next hook.
+	called = false
+	p.mu.Lock()
+	p.code = packets.CodeBadUsernameorPsw
+	p.mu.Unlock()
+	a.EqualValues(packets.CodeBadUsernameorPsw, connect(context.Background(), newTestClient("id")))
+	a.False(called)
+}
+
+func TestExHook_OnSubscribe(t *testing.T) {
+	p := &provider{}
+	addr, stop := startProvider(t, p)
+	defer stop()
+	e := loadExHook(t, addr)
+	defer e.Unload()
+
+	var tt = []struct {
+		name      string
+		granted   uint32
+		requested uint8
+		// next is the qos passed to the next hook, -1 if it is not called.
+		next int
+		qos  uint8
+	}{
+		{name: "downgrade", granted: 1, requested: 2, next: 1, qos: 1},
+		{name: "no_upgrade", granted: 2, requested: 0, next: 0, qos: 0},
+		{name: "failure", granted: uint32(packets.SUBSCRIBE_FAILURE), requested: 1, next: -1, qos: packets.SUBSCRIBE_FAILURE},
+	}
+	for _, v := range tt {
+		t.Run(v.name, func(t *testing.T) {
+			a := assert.New(t)
+			p.mu.Lock()
+			p.qos = v.granted
+			p.subscribes = nil
+			p.mu.Unlock()
+			next := -1
+			subscribe := e.OnSubscribeWrapper(func(ctx context.Context, client gmqtt.Client, topic packets.Topic) uint8 {
+				next = int(topic.Qos)
+				return topic.Qos
+			})
+			a.Equal(v.qos, subscribe(context.Background(), newTestClient("id"), packets.Topic{Name: "a/#", Qos: v.requested}))
+			a.Equal(v.next, next)
+			if a.Len(p.subscribes, 1) {
+				a.Equal("a/#", p.subscribes[0].TopicFilter)
+				a.EqualValues(v.requested, p.subscribes[0].Qos)
+				a.Equal("id", p.subscribes[0].Client.ClientId)
+			}
+		})
+	}
+}
+
+func TestExHook_OnMsgArrived(t *testing.T) {
+	a := assert.New(t)
+	p := &provider{valid: true}
+	addr, stop := startProvider(t, p)
+	defer stop()
+	e := loadExHook(t, addr)
+	defer e.Unload()
+
+	var called int
+	arrived := e.OnMsgArrivedWrapper(func(ctx context.Context, client gmqtt.Client, msg packets.Message) bool {
+		called++
+		return true
+	})
+	msg := gmqtt.NewMessage("a/b", []byte("1"), packets.QOS_1)
+	a.True(arrived(context.Background(), newTestClient("id"), msg))
+	if a.Len(p.arrives, 1) {
+		a.Equal(newMessage(msg), p.arrives[0].Message)
+	}
+	p.mu.Lock()
+	p.valid = false
+	p.mu.Unlock()
+	a.False(arrived(context.Background(), newTestClient("id"), msg))
+	a.Equal(1, called)
+}
+
+func TestExHook_FailPolicy(t *testing.T) {
+	p := &provider{code: packets.CodeAccepted, qos: 2, valid: true, delay: time.Second}
+	addr, stop := startProvider(t, p)
+	defer stop()
+
+	for _, policy := range []FailPolicy{FailClosed, FailOpen} {
+		opts := []Option{}
+		for _, h := range []Hook{OnConnect, OnSubscribe, OnMsgArrived} {
+			opts = append(opts, WithTimeout(h, 10*time.Millisecond), WithFailPolicy(h, policy))
+		}
+		e := loadExHook(t, addr, opts...)
+		a := assert.New(t)
+		var called int
+		connect := e.OnConnectWrapper(func(ctx context.Context, client gmqtt.Client) uint8 {
+			called++
+			return packets.CodeAccepted
+		})
+		subscribe := e.OnSubscribeWrapper(func(ctx context.Context, client gmqtt.Client, topic packets.Topic) uint8 {
+			called++
+			return topic.Qos
+		})
+		arrived := e.OnMsgArrivedWrapper(func(ctx context.Context, client gmqtt.Client, msg packets.Message) bool {
+			called++
+			return true
+		})
+		c := newTestClient("id")
+		code := connect(context.Background(), c)
+		qos := subscribe(context.Background(), c, packets.Topic{Name: "a", Qos: 1})
+		valid := arrived(context.Background(), c, gmqtt.NewMessage("a", nil, packets.QOS_0))
+		if policy == FailClosed {
+			a.EqualValues(packets.CodeServerUnavaliable, code)
+			a.EqualValues(packets.SUBSCRIBE_FAILURE, qos)
+			a.False(valid)
+			a.Equal(0, called)
+		} else {
+			a.EqualValues(packets.CodeAccepted, code)
+			a.EqualValues(1, qos)
+			a.True(valid)
+			a.Equal(3, called)
+		}
+		e.Unload()
+	}
+}
+
+func TestExHook_Events(t *testing.T) {
+	a := assert.New(t)
+	p := &provider{}
+	addr, stop := startProvider(t, p)
+	defer stop()
+	e := loadExHook(t, addr, WithHooks(OnDeliver, OnClose), WithBatch(2, time.Hour))
+	w := e.HookWrapper()
+	a.Nil(w.OnConnectWrapper)
+	a.Nil(w.OnSubscribeWrapper)
+	a.Nil(w.OnMsgArrivedWrapper)
+
+	deliver := e.OnDeliverWrapper(func(ctx context.Context, client gmqtt.Client, msg packets.Message) {})
+	closed := e.OnCloseWrapper(func(ctx context.Context, client gmqtt.Client, err error) {})
+	msg := gmqtt.NewMessage("a/b", []byte("1"), packets.QOS_1)
+	deliver(context.Background(), newTestClient("id"), msg)
+	closed(context.Background(), newTestClient("id"), errors.New("error"))
+	closed(context.Background(), newTestClient("id2"), nil)
+	// the buffered events are flushed on unload.
+	a.NoError(e.Unload())
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !a.Len(p.events, 3) {
+		return
+	}
+	a.Equal(&DeliverEvent{ClientId: "id", Message: newMessage(msg)}, p.events[0].GetDeliver())
+	a.Equal(&CloseEvent{ClientId: "id", Error: "error"}, p.events[1].GetClose())
+	a.Equal(&CloseEvent{ClientId: "id2"}, p.events[2].GetClose())
+	for _, v := range p.events {
+		a.NotZero(v.Timestamp)
+	}
+}
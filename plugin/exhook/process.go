@@ -0,0 +1,254 @@
+package exhook
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+)
+
+// The handshake of the external plugin process, which is compatible with the handshake of HashiCorp go-plugin,
+// so the HookProvider services served by go-plugin with the same magic cookie can be used as well.
+// The process is started with the magic cookie in its environment and must write the handshake line
+// to its stdout after it starts serving:
+//
+//	CORE-PROTOCOL-VERSION|APP-PROTOCOL-VERSION|NETWORK-TYPE|NETWORK-ADDR|PROTOCOL
+//
+// e.g: "1|1|tcp|127.0.0.1:1234|grpc". See Serve.
+const (
+	// MagicCookieKey and MagicCookieValue are set in the environment of the external plugin process.
+	MagicCookieKey   = "GMQTT_EXHOOK_PLUGIN"
+	MagicCookieValue = "HookProvider"
+	// CoreProtocolVersion is the core protocol version of go-plugin.
+	CoreProtocolVersion = 1
+	// ProtocolVersion is the version of the HookProvider service.
+	ProtocolVersion = 1
+)
+
+const (
+	defaultHandshakeTimeout = 10 * time.Second
+	defaultMinBackoff       = 100 * time.Millisecond
+	defaultMaxBackoff       = 30 * time.Second
+)
+
+// errUnavailable is returned by the calls of the external service when the external plugin process is not running.
+var errUnavailable = errors.New("external plugin process is not running")
+
+// WithCommand runs the HookProvider service as an external plugin process instead of connecting to
+// the address passed to New. The broker supervises the process: it is restarted with the exponential backoff
+// if it exits, and the calls of the decision hooks are handled by their FailPolicy while the process is down.
+func WithCommand(path string, args ...string) Option {
+	return func(e *ExHook) {
+		e.command = path
+		e.args = args
+	}
+}
+
+// WithRestartBackoff sets the minimum and maximum delay before restarting the exited external plugin process,
+// default to 100 milliseconds and 30 seconds. The delay doubles on each failed restart, and is reset
+// once the process keeps running for the maximum delay.
+func WithRestartBackoff(min, max time.Duration) Option {
+	return func(e *ExHook) {
+		e.minBackoff = min
+		e.maxBackoff = max
+	}
+}
+
+// WithHandshakeTimeout sets the time to wait for the handshake line of the external plugin process, default to 10 seconds.
+func WithHandshakeTimeout(timeout time.Duration) Option {
+	return func(e *ExHook) {
+		e.handshakeTimeout = timeout
+	}
+}
+
+// process is a running external plugin process.
+type process struct {
+	cmd     *exec.Cmd
+	conn    *grpc.ClientConn
+	started time.Time
+	// exited is closed after the process exits, err is the exit error.
+	exited chan struct{}
+	err    error
+}
+
+// parseHandshake parses the handshake line and returns the network and address of the service.
+func parseHandshake(line string) (network string, addr string, err error) {
+	parts := strings.Split(strings.TrimSpace(line), "|")
+	if len(parts) < 4 {
+		return "", "", fmt.Errorf("invalid handshake %q", line)
+	}
+	if parts[0] != fmt.Sprint(CoreProtocolVersion) {
+		return "", "", fmt.Errorf("unsupported core protocol version %s", parts[0])
+	}
+	if parts[1] != fmt.Sprint(ProtocolVersion) {
+		return "", "", fmt.Errorf("unsupported protocol version %s", parts[1])
+	}
+	if parts[2] != "tcp" && parts[2] != "unix" {
+		return "", "", fmt.Errorf("unsupported network %s", parts[2])
+	}
+	if len(parts) > 4 && parts[4] != "grpc" {
+		return "", "", fmt.Errorf("unsupported protocol %s", parts[4])
+	}
+	return parts[2], parts[3], nil
+}
+
+// start starts the external plugin process and connects to it after the handshake.
+func (e *ExHook) start() (*process, error) {
+	cmd := exec.Command(e.command, e.args...)
+	cmd.Env = append(os.Environ(),
+		MagicCookieKey+"="+MagicCookieValue,
+		fmt.Sprintf("PLUGIN_PROTOCOL_VERSIONS=%d", ProtocolVersion),
+	)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	p := &process{cmd: cmd, started: time.Now(), exited: make(chan struct{})}
+	handshake := make(chan string, 1)
+	go e.logOutput(stdout, handshake)
+	go e.logOutput(stderr, nil)
+	go func() {
+		p.err = cmd.Wait()
+		close(p.exited)
+	}()
+
+	var line string
+	select {
+	case line = <-handshake:
+	case <-p.exited:
+		return nil, fmt.Errorf("external plugin process exited before the handshake: %v", p.err)
+	case <-time.After(e.handshakeTimeout):
+		p.kill()
+		return nil, errors.New("timeout waiting for the handshake of the external plugin process")
+	}
+	network, addr, err := parseHandshake(line)
+	if err != nil {
+		p.kill()
+		return nil, err
+	}
+	opts := append([]grpc.DialOption{
+		grpc.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, addr)
+		}),
+	}, e.dialOpts...)
+	p.conn, err = grpc.Dial(addr, opts...)
+	if err != nil {
+		p.kill()
+		return nil, err
+	}
+	log.Info("external plugin process started",
+		zap.String("command", e.command), zap.Int("pid", cmd.Process.Pid), zap.String("addr", addr))
+	return p, nil
+}
+
+// logOutput logs the output lines of the process, the first line is sent to handshake if it is not nil.
+func (e *ExHook) logOutput(r io.Reader, handshake chan<- string) {
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		if handshake != nil {
+			handshake <- s.Text()
+			handshake = nil
+			continue
+		}
+		log.Info(s.Text(), zap.String("command", e.command))
+	}
+}
+
+// kill kills the process and waits for it to exit.
+func (p *process) kill() {
+	p.cmd.Process.Kill()
+	<-p.exited
+}
+
+// supervise restarts the external plugin process after it exits until the plugin is unloaded.
+func (e *ExHook) supervise(p *process) {
+	defer e.supervisor.Done()
+	backoff := e.minBackoff
+	for {
+		select {
+		case <-e.stopProcess:
+			e.setProvider(unavailable{})
+			p.conn.Close()
+			p.kill()
+			return
+		case <-p.exited:
+		}
+		e.setProvider(unavailable{})
+		p.conn.Close()
+		log.Error("external plugin process exited", zap.String("command", e.command), zap.Error(p.err))
+		if time.Since(p.started) >= e.maxBackoff {
+			backoff = e.minBackoff
+		}
+		for {
+			select {
+			case <-e.stopProcess:
+				return
+			case <-time.After(backoff):
+			}
+			if backoff *= 2; backoff > e.maxBackoff {
+				backoff = e.maxBackoff
+			}
+			np, err := e.start()
+			if err != nil {
+				log.Error("restarting external plugin process error", zap.String("command", e.command), zap.Error(err))
+				continue
+			}
+			p = np
+			break
+		}
+		e.setProvider(NewHookProviderClient(p.conn))
+	}
+}
+
+// unavailable is the HookProviderClient which is used while the external plugin process is not running.
+type unavailable struct{}
+
+func (unavailable) OnConnect(ctx context.Context, in *ConnectRequest, opts ...grpc.CallOption) (*ConnectResponse, error) {
+	return nil, errUnavailable
+}
+
+func (unavailable) OnSubscribe(ctx context.Context, in *SubscribeRequest, opts ...grpc.CallOption) (*SubscribeResponse, error) {
+	return nil, errUnavailable
+}
+
+func (unavailable) OnMsgArrived(ctx context.Context, in *MsgArrivedRequest, opts ...grpc.CallOption) (*MsgArrivedResponse, error) {
+	return nil, errUnavailable
+}
+
+func (unavailable) OnEvents(ctx context.Context, opts ...grpc.CallOption) (HookProvider_OnEventsClient, error) {
+	return nil, errUnavailable
+}
+
+// Serve serves the HookProvider service as the external plugin process started by WithCommand.
+// It listens on a random local port, writes the handshake line to stdout and blocks until the server stops.
+// It returns an error if the process is not started by the broker.
+func Serve(provider HookProviderServer, opts ...grpc.ServerOption) error {
+	if os.Getenv(MagicCookieKey) != MagicCookieValue {
+		return errors.New("exhook: the process must be started by the broker as an external plugin")
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return err
+	}
+	s := grpc.NewServer(opts...)
+	RegisterHookProviderServer(s, provider)
+	fmt.Printf("%d|%d|tcp|%s|grpc\n", CoreProtocolVersion, ProtocolVersion, ln.Addr())
+	return s.Serve(ln)
+}
@@ -0,0 +1,347 @@
+// Package httpauth authenticates and authorizes the clients by calling the HTTP endpoints,
+// so that the credentials can live in an existing web service.
+package httpauth
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/DrmagicE/gmqtt"
+	"github.com/DrmagicE/gmqtt/pkg/packets"
+)
+
+const name = "httpauth"
+
+var log *zap.Logger
+
+// Action is the action of the request.
+type Action string
+
+const (
+	Connect   Action = "connect"
+	Publish   Action = "publish"
+	Subscribe Action = "subscribe"
+)
+
+// Result is the result of the response.
+type Result string
+
+const (
+	Allow Result = "allow"
+	Deny  Result = "deny"
+)
+
+const (
+	defaultTimeout  = 3 * time.Second
+	defaultCacheTTL = time.Minute
+)
+
+// Request is the JSON body posted to the endpoints.
+type Request struct {
+	Action     Action `json:"action"`
+	ClientID   string `json:"client_id"`
+	Username   string `json:"username"`
+	Password   string `json:"password,omitempty"` // connect only
+	RemoteAddr string `json:"remote_addr,omitempty"`
+	// Topic is the topic name of the publish, or the topic filter of the subscription.
+	Topic string `json:"topic,omitempty"`
+	Qos   uint8  `json:"qos"`
+}
+
+// Response is the JSON body of the 2xx responses, the other responses are considered as errors.
+type Response struct {
+	Result Result `json:"result"`
+	// MaxQos caps the qos of the allowed publish and subscription, optional.
+	MaxQos *uint8 `json:"max_qos,omitempty"`
+}
+
+// Option is the option of the HTTPAuth.
+type Option func(h *HTTPAuth)
+
+// WithConnectURL sets the endpoint to authenticate the CONNECT packets.
+func WithConnectURL(url string) Option {
+	return func(h *HTTPAuth) {
+		h.urls[Connect] = url
+	}
+}
+
+// WithPublishURL sets the endpoint to authorize the publish.
+func WithPublishURL(url string) Option {
+	return func(h *HTTPAuth) {
+		h.urls[Publish] = url
+	}
+}
+
+// WithSubscribeURL sets the endpoint to authorize the subscriptions.
+func WithSubscribeURL(url string) Option {
+	return func(h *HTTPAuth) {
+		h.urls[Subscribe] = url
+	}
+}
+
+// WithTimeout sets the timeout of the requests, default to 3 seconds.
+func WithTimeout(timeout time.Duration) Option {
+	return func(h *HTTPAuth) {
+		h.client.Timeout = timeout
+	}
+}
+
+// WithCacheTTL sets the duration which the responses are cached for, default to 1 minute. 0 disables the cache.
+func WithCacheTTL(ttl time.Duration) Option {
+	return func(h *HTTPAuth) {
+		h.cacheTTL = ttl
+	}
+}
+
+// WithDenyOnError sets whether to deny the request if the endpoint fails or times out, default to true.
+// If it is false, the next hook is called as if the endpoint allowed the request.
+func WithDenyOnError(deny bool) Option {
+	return func(h *HTTPAuth) {
+		h.denyOnError = deny
+	}
+}
+
+type cacheEntry struct {
+	rs       *Response
+	expireAt time.Time
+}
+
+// HTTPAuth is the plugin which authenticates and authorizes the clients by the HTTP endpoints.
+type HTTPAuth struct {
+	urls        map[Action]string
+	client      *http.Client
+	cacheTTL    time.Duration
+	denyOnError bool
+
+	cacheMu sync.Mutex
+	cache   map[string]*cacheEntry
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// New returns the HTTPAuth plugin, the hooks are enabled only if their endpoints are set.
+func New(opts ...Option) *HTTPAuth {
+	h := &HTTPAuth{
+		urls:        make(map[Action]string),
+		client:      &http.Client{Timeout: defaultTimeout},
+		cacheTTL:    defaultCacheTTL,
+		denyOnError: true,
+		cache:       make(map[string]*cacheEntry),
+	}
+	for _, fn := range opts {
+		fn(h)
+	}
+	return h
+}
+
+func (h *HTTPAuth) Load(service gmqtt.Server) error {
+	log = gmqtt.Logger("plugin/" + name)
+	h.done = make(chan struct{})
+	if h.cacheTTL > 0 {
+		h.wg.Add(1)
+		go h.evictLoop()
+	}
+	return nil
+}
+
+func (h *HTTPAuth) Unload() error {
+	close(h.done)
+	h.wg.Wait()
+	return nil
+}
+
+func (h *HTTPAuth) HookWrapper() gmqtt.HookWrapper {
+	w := gmqtt.HookWrapper{}
+	if h.urls[Connect] != "" {
+		w.OnConnectWrapper = h.OnConnectWrapper
+	}
+	if h.urls[Publish] != "" {
+		w.OnMsgArrivedWrapper = h.OnMsgArrivedWrapper
+	}
+	if h.urls[Subscribe] != "" {
+		w.OnSubscribeWrapper = h.OnSubscribeWrapper
+	}
+	return w
+}
+
+func (h *HTTPAuth) Name() string {
+	return name
+}
+
+// evictLoop removes the expired cache entries periodically.
+func (h *HTTPAuth) evictLoop() {
+	defer h.wg.Done()
+	ticker := time.NewTicker(h.cacheTTL)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-h.done:
+			return
+		case now := <-ticker.C:
+			h.cacheMu.Lock()
+			for k, v := range h.cache {
+				if !now.Before(v.expireAt) {
+					delete(h.cache, k)
+				}
+			}
+			h.cacheMu.Unlock()
+		}
+	}
+}
+
+// cacheKey returns the key of the request, the password is hashed so that it is not kept in memory.
+func cacheKey(req *Request) string {
+	sum := sha256.Sum256([]byte(req.Password))
+	return string(req.Action) + "\x00" + req.ClientID + "\x00" + req.Username + "\x00" +
+		hex.EncodeToString(sum[:]) + "\x00" + req.Topic + "\x00" + strconv.Itoa(int(req.Qos))
+}
+
+func (h *HTTPAuth) cached(key string) *Response {
+	h.cacheMu.Lock()
+	defer h.cacheMu.Unlock()
+	e, ok := h.cache[key]
+	if !ok {
+		return nil
+	}
+	if !time.Now().Before(e.expireAt) {
+		delete(h.cache, key)
+		return nil
+	}
+	return e.rs
+}
+
+// call posts the request to the endpoint of the action, the successful responses are cached.
+func (h *HTTPAuth) call(ctx context.Context, req *Request) (*Response, error) {
+	var key string
+	if h.cacheTTL > 0 {
+		key = cacheKey(req)
+		if rs := h.cached(key); rs != nil {
+			return rs, nil
+		}
+	}
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	hreq, err := http.NewRequest(http.MethodPost, h.urls[req.Action], bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	hreq = hreq.WithContext(ctx)
+	hreq.Header.Set("Content-Type", "application/json")
+	resp, err := h.client.Do(hreq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	rs := &Response{}
+	if err := json.NewDecoder(resp.Body).Decode(rs); err != nil {
+		return nil, err
+	}
+	if rs.Result != Allow && rs.Result != Deny {
+		return nil, fmt.Errorf("invalid result: %q", rs.Result)
+	}
+	if h.cacheTTL > 0 {
+		h.cacheMu.Lock()
+		h.cache[key] = &cacheEntry{rs: rs, expireAt: time.Now().Add(h.cacheTTL)}
+		h.cacheMu.Unlock()
+	}
+	return rs, nil
+}
+
+func newRequest(action Action, client gmqtt.Client) *Request {
+	opts := client.OptionsReader()
+	req := &Request{
+		Action:   action,
+		ClientID: opts.ClientID(),
+		Username: opts.Username(),
+	}
+	if addr := opts.RemoteAddr(); addr != nil {
+		req.RemoteAddr = addr.String()
+	}
+	return req
+}
+
+func logCallError(req *Request, err error) {
+	log.Error("calling endpoint error", zap.String("action", string(req.Action)), zap.String("client_id", req.ClientID), zap.Error(err))
+}
+
+// OnConnectWrapper authenticates the CONNECT packet by the connect endpoint.
+func (h *HTTPAuth) OnConnectWrapper(connect gmqtt.OnConnect) gmqtt.OnConnect {
+	return func(ctx context.Context, client gmqtt.Client) (code uint8) {
+		req := newRequest(Connect, client)
+		req.Password = client.OptionsReader().Password()
+		rs, err := h.call(ctx, req)
+		if err != nil {
+			logCallError(req, err)
+			if h.denyOnError {
+				return packets.CodeServerUnavaliable
+			}
+			return connect(ctx, client)
+		}
+		if rs.Result == Deny {
+			return packets.CodeBadUsernameorPsw
+		}
+		return connect(ctx, client)
+	}
+}
+
+// OnSubscribeWrapper authorizes the subscription by the subscribe endpoint, the qos is capped by the response.
+func (h *HTTPAuth) OnSubscribeWrapper(subscribe gmqtt.OnSubscribe) gmqtt.OnSubscribe {
+	return func(ctx context.Context, client gmqtt.Client, topic packets.Topic) (qos uint8) {
+		req := newRequest(Subscribe, client)
+		req.Topic = topic.Name
+		req.Qos = topic.Qos
+		rs, err := h.call(ctx, req)
+		if err != nil {
+			logCallError(req, err)
+			if h.denyOnError {
+				return packets.SUBSCRIBE_FAILURE
+			}
+			return subscribe(ctx, client, topic)
+		}
+		if rs.Result == Deny {
+			return packets.SUBSCRIBE_FAILURE
+		}
+		if rs.MaxQos != nil && *rs.MaxQos < topic.Qos {
+			topic.Qos = *rs.MaxQos
+		}
+		return subscribe(ctx, client, topic)
+	}
+}
+
+// OnMsgArrivedWrapper authorizes the publish by the publish endpoint,
+// the message whose qos exceeds the cap of the response is dropped.
+func (h *HTTPAuth) OnMsgArrivedWrapper(arrived gmqtt.OnMsgArrived) gmqtt.OnMsgArrived {
+	return func(ctx context.Context, client gmqtt.Client, msg packets.Message) (valid bool) {
+		req := newRequest(Publish, client)
+		req.Topic = msg.Topic()
+		req.Qos = msg.Qos()
+		rs, err := h.call(ctx, req)
+		if err != nil {
+			logCallError(req, err)
+			if h.denyOnError {
+				return false
+			}
+			return arrived(ctx, client, msg)
+		}
+		if rs.Result == Deny || (rs.MaxQos != nil && msg.Qos() > *rs.MaxQos) {
+			return false
+		}
+		return arrived(ctx, client, msg)
+	}
+}
@@ -0,0 +1,215 @@
+package httpauth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/DrmagicE/gmqtt"
+	"github.com/DrmagicE/gmqtt/internal/testutil"
+	"github.com/DrmagicE/gmqtt/pkg/packets"
+)
+
+// endpoint is the fake endpoint, it responds the requests by fn.
+type endpoint struct {
+	mu       sync.Mutex
+	requests []Request
+	fn       func(req Request) (status int, rs *Response)
+}
+
+func (e *endpoint) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req Request
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	e.mu.Lock()
+	e.requests = append(e.requests, req)
+	fn := e.fn
+	e.mu.Unlock()
+	status, rs := fn(req)
+	w.WriteHeader(status)
+	if rs != nil {
+		json.NewEncoder(w).Encode(rs)
+	}
+}
+
+func (e *endpoint) all() []Request {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]Request(nil), e.requests...)
+}
+
+func (e *endpoint) count() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return len(e.requests)
+}
+
+func (e *endpoint) setFn(fn func(req Request) (status int, rs *Response)) {
+	e.mu.Lock()
+	e.fn = fn
+	e.mu.Unlock()
+}
+
+func newTestHTTPAuth(t *testing.T, e *endpoint, opts ...Option) (*HTTPAuth, func()) {
+	hs := httptest.NewServer(e)
+	h := New(append([]Option{
+		WithConnectURL(hs.URL),
+		WithPublishURL(hs.URL),
+		WithSubscribeURL(hs.URL),
+	}, opts...)...)
+	if err := h.Load(nil); err != nil {
+		t.Fatal(err)
+	}
+	return h, func() {
+		h.Unload()
+		hs.Close()
+	}
+}
+
+func TestHTTPAuth_OnConnect(t *testing.T) {
+	a := assert.New(t)
+	e := &endpoint{fn: func(req Request) (int, *Response) {
+		if req.Password == "pass" {
+			return http.StatusOK, &Response{Result: Allow}
+		}
+		return http.StatusOK, &Response{Result: Deny}
+	}}
+	h, stop := newTestHTTPAuth(t, e)
+	defer stop()
+	connect := h.OnConnectWrapper(func(ctx context.Context, client gmqtt.Client) uint8 {
+		return packets.CodeAccepted
+	})
+	c := &testutil.Client{Opts: &testutil.ClientOptions{ID: "id0", User: "user", Pass: "pass"}}
+	a.EqualValues(packets.CodeAccepted, connect(context.Background(), c))
+	a.Equal([]Request{{Action: Connect, ClientID: "id0", Username: "user", Password: "pass"}}, e.all())
+
+	c.Opts.Pass = "wrong"
+	a.EqualValues(packets.CodeBadUsernameorPsw, connect(context.Background(), c))
+}
+
+func TestHTTPAuth_Cache(t *testing.T) {
+	a := assert.New(t)
+	e := &endpoint{fn: func(req Request) (int, *Response) {
+		if req.Topic == "a" {
+			return http.StatusOK, &Response{Result: Allow}
+		}
+		return http.StatusOK, &Response{Result: Deny}
+	}}
+	h, stop := newTestHTTPAuth(t, e, WithCacheTTL(100*time.Millisecond))
+	defer stop()
+	arrived := h.OnMsgArrivedWrapper(func(ctx context.Context, client gmqtt.Client, msg packets.Message) bool {
+		return true
+	})
+	c := testutil.NewClient("id0", "")
+
+	a.True(arrived(context.Background(), c, gmqtt.NewMessage("a", nil, packets.QOS_1)))
+	a.True(arrived(context.Background(), c, gmqtt.NewMessage("a", nil, packets.QOS_1)))
+	a.Equal(1, e.count())
+	// the deny responses are cached as well.
+	a.False(arrived(context.Background(), c, gmqtt.NewMessage("b", nil, packets.QOS_1)))
+	a.False(arrived(context.Background(), c, gmqtt.NewMessage("b", nil, packets.QOS_1)))
+	a.Equal(2, e.count())
+	// the requests of the other qos are not cached.
+	a.True(arrived(context.Background(), c, gmqtt.NewMessage("a", nil, packets.QOS_0)))
+	a.Equal(3, e.count())
+
+	// the cached responses expire after the ttl.
+	e.setFn(func(req Request) (int, *Response) {
+		return http.StatusOK, &Response{Result: Allow}
+	})
+	a.False(arrived(context.Background(), c, gmqtt.NewMessage("b", nil, packets.QOS_1)))
+	time.Sleep(150 * time.Millisecond)
+	a.True(arrived(context.Background(), c, gmqtt.NewMessage("b", nil, packets.QOS_1)))
+	a.Equal(4, e.count())
+
+	// the errors are never cached.
+	e.setFn(func(req Request) (int, *Response) {
+		return http.StatusInternalServerError, nil
+	})
+	a.False(arrived(context.Background(), c, gmqtt.NewMessage("c", nil, packets.QOS_1)))
+	a.False(arrived(context.Background(), c, gmqtt.NewMessage("c", nil, packets.QOS_1)))
+	a.Equal(6, e.count())
+
+	// the expired entries are evicted.
+	time.Sleep(250 * time.Millisecond)
+	h.cacheMu.Lock()
+	a.Len(h.cache, 0)
+	h.cacheMu.Unlock()
+}
+
+func TestHTTPAuth_NoCache(t *testing.T) {
+	a := assert.New(t)
+	e := &endpoint{fn: func(req Request) (int, *Response) {
+		return http.StatusOK, &Response{Result: Allow}
+	}}
+	h, stop := newTestHTTPAuth(t, e, WithCacheTTL(0))
+	defer stop()
+	arrived := h.OnMsgArrivedWrapper(func(ctx context.Context, client gmqtt.Client, msg packets.Message) bool {
+		return true
+	})
+	c := testutil.NewClient("id0", "")
+	a.True(arrived(context.Background(), c, gmqtt.NewMessage("a", nil, packets.QOS_1)))
+	a.True(arrived(context.Background(), c, gmqtt.NewMessage("a", nil, packets.QOS_1)))
+	a.Equal(2, e.count())
+}
+
+func TestHTTPAuth_OnSubscribe(t *testing.T) {
+	a := assert.New(t)
+	qos := packets.QOS_1
+	e := &endpoint{fn: func(req Request) (int, *Response) {
+		switch req.Topic {
+		case "capped":
+			return http.StatusOK, &Response{Result: Allow, MaxQos: &qos}
+		case "denied":
+			return http.StatusOK, &Response{Result: Deny}
+		case "invalid":
+			return http.StatusOK, &Response{Result: "maybe"}
+		}
+		return http.StatusOK, &Response{Result: Allow}
+	}}
+	h, stop := newTestHTTPAuth(t, e)
+	defer stop()
+	subscribe := h.OnSubscribeWrapper(func(ctx context.Context, client gmqtt.Client, topic packets.Topic) uint8 {
+		return topic.Qos
+	})
+	c := testutil.NewClient("id0", "")
+	a.Equal(packets.QOS_2, subscribe(context.Background(), c, packets.Topic{Name: "a", Qos: packets.QOS_2}))
+	a.Equal(packets.QOS_1, subscribe(context.Background(), c, packets.Topic{Name: "capped", Qos: packets.QOS_2}))
+	a.Equal(packets.QOS_0, subscribe(context.Background(), c, packets.Topic{Name: "capped", Qos: packets.QOS_0}))
+	a.EqualValues(packets.SUBSCRIBE_FAILURE, subscribe(context.Background(), c, packets.Topic{Name: "denied", Qos: packets.QOS_0}))
+	// the invalid result is an error, which is denied by default.
+	a.EqualValues(packets.SUBSCRIBE_FAILURE, subscribe(context.Background(), c, packets.Topic{Name: "invalid", Qos: packets.QOS_0}))
+
+	arrived := h.OnMsgArrivedWrapper(func(ctx context.Context, client gmqtt.Client, msg packets.Message) bool {
+		return true
+	})
+	a.True(arrived(context.Background(), c, gmqtt.NewMessage("capped", nil, packets.QOS_1)))
+	a.False(arrived(context.Background(), c, gmqtt.NewMessage("capped", nil, packets.QOS_2)))
+}
+
+func TestHTTPAuth_DenyOnError(t *testing.T) {
+	a := assert.New(t)
+	e := &endpoint{fn: func(req Request) (int, *Response) {
+		return http.StatusBadGateway, nil
+	}}
+	connected := func(ctx context.Context, client gmqtt.Client) uint8 {
+		return packets.CodeAccepted
+	}
+	c := testutil.NewClient("id0", "")
+
+	h, stop := newTestHTTPAuth(t, e)
+	a.EqualValues(packets.CodeServerUnavaliable, h.OnConnectWrapper(connected)(context.Background(), c))
+	stop()
+
+	h, stop = newTestHTTPAuth(t, e, WithDenyOnError(false))
+	defer stop()
+	a.EqualValues(packets.CodeAccepted, h.OnConnectWrapper(connected)(context.Background(), c))
+}
@@ -0,0 +1,181 @@
+package jwtauth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rsa"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"strings"
+	"time"
+)
+
+var (
+	ErrMalformedToken   = errors.New("malformed token")
+	ErrUnsupportedAlg   = errors.New("unsupported signing algorithm")
+	ErrKeyNotFound      = errors.New("signing key not found")
+	ErrInvalidSignature = errors.New("invalid signature")
+	ErrTokenExpired     = errors.New("token expired")
+	ErrTokenNotValidYet = errors.New("token not valid yet")
+)
+
+// header is the JOSE header of the token.
+type header struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// Claims is the claims set of the token.
+type Claims map[string]interface{}
+
+// numericDate returns the NumericDate claim, ok is false if the claim is not present or not a number.
+func (c Claims) numericDate(name string) (t time.Time, ok bool) {
+	v, ok := c[name].(float64)
+	if !ok {
+		return time.Time{}, false
+	}
+	sec, frac := int64(v), v-float64(int64(v))
+	return time.Unix(sec, int64(frac*float64(time.Second))), true
+}
+
+// ExpiresAt returns the exp claim, ok is false if the token never expires.
+func (c Claims) ExpiresAt() (t time.Time, ok bool) {
+	return c.numericDate("exp")
+}
+
+// String returns the string claim.
+func (c Claims) String(name string) string {
+	s, _ := c[name].(string)
+	return s
+}
+
+// token is the parsed but unverified token.
+type token struct {
+	header       header
+	claims       Claims
+	signingInput string
+	signature    []byte
+}
+
+func decodeSegment(seg string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return ErrMalformedToken
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		return ErrMalformedToken
+	}
+	return nil
+}
+
+// parse parses the compact serialized token without verifying it.
+func parse(s string) (*token, error) {
+	parts := strings.Split(s, ".")
+	if len(parts) != 3 {
+		return nil, ErrMalformedToken
+	}
+	t := &token{signingInput: parts[0] + "." + parts[1]}
+	if err := decodeSegment(parts[0], &t.header); err != nil {
+		return nil, err
+	}
+	if err := decodeSegment(parts[1], &t.claims); err != nil {
+		return nil, err
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrMalformedToken
+	}
+	t.signature = sig
+	return t, nil
+}
+
+// algHash returns the hash function of the algorithm, the "none" algorithm is never supported.
+func algHash(alg string) (crypto.Hash, error) {
+	if len(alg) != 5 {
+		return 0, ErrUnsupportedAlg
+	}
+	switch alg[:2] {
+	case "HS", "RS", "ES":
+	default:
+		return 0, ErrUnsupportedAlg
+	}
+	switch alg[2:] {
+	case "256":
+		return crypto.SHA256, nil
+	case "384":
+		return crypto.SHA384, nil
+	case "512":
+		return crypto.SHA512, nil
+	}
+	return 0, ErrUnsupportedAlg
+}
+
+// esCurveBits is the curve size required by the ES algorithms, see RFC 7518 section 3.4.
+var esCurveBits = map[string]int{
+	"ES256": 256,
+	"ES384": 384,
+	"ES512": 521,
+}
+
+// verify verifies the signature of the token by the key, the key must be []byte for the HS algorithms,
+// *rsa.PublicKey for the RS algorithms and *ecdsa.PublicKey on the curve of the algorithm for the ES algorithms.
+// ErrKeyNotFound is returned if the key does not match the algorithm.
+func (t *token) verify(key interface{}) error {
+	hash, err := algHash(t.header.Alg)
+	if err != nil {
+		return err
+	}
+	h := hash.New()
+	h.Write([]byte(t.signingInput))
+	switch t.header.Alg[:2] {
+	case "HS":
+		k, ok := key.([]byte)
+		if !ok {
+			return ErrKeyNotFound
+		}
+		mac := hmac.New(hash.New, k)
+		mac.Write([]byte(t.signingInput))
+		if !hmac.Equal(mac.Sum(nil), t.signature) {
+			return ErrInvalidSignature
+		}
+	case "RS":
+		k, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return ErrKeyNotFound
+		}
+		if rsa.VerifyPKCS1v15(k, hash, h.Sum(nil), t.signature) != nil {
+			return ErrInvalidSignature
+		}
+	case "ES":
+		k, ok := key.(*ecdsa.PublicKey)
+		if !ok || k.Curve.Params().BitSize != esCurveBits[t.header.Alg] {
+			return ErrKeyNotFound
+		}
+		size := (k.Curve.Params().BitSize + 7) / 8
+		if len(t.signature) != 2*size {
+			return ErrInvalidSignature
+		}
+		r := new(big.Int).SetBytes(t.signature[:size])
+		s := new(big.Int).SetBytes(t.signature[size:])
+		if !ecdsa.Verify(k, h.Sum(nil), r, s) {
+			return ErrInvalidSignature
+		}
+	}
+	return nil
+}
+
+// validateTime checks the exp and nbf claims with the leeway.
+func (c Claims) validateTime(now time.Time, leeway time.Duration) error {
+	if exp, ok := c.ExpiresAt(); ok && !now.Before(exp.Add(leeway)) {
+		return ErrTokenExpired
+	}
+	if nbf, ok := c.numericDate("nbf"); ok && now.Add(leeway).Before(nbf) {
+		return ErrTokenNotValidYet
+	}
+	return nil
+}
@@ -0,0 +1,296 @@
+package jwtauth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+var (
+	testHMACKey = []byte("secret")
+	testRSAKey  *rsa.PrivateKey
+	testECKeys  = make(map[string]*ecdsa.PrivateKey)
+)
+
+func init() {
+	log = zap.NewNop()
+	var err error
+	if testRSAKey, err = rsa.GenerateKey(rand.Reader, 2048); err != nil {
+		panic(err)
+	}
+	for alg, curve := range map[string]elliptic.Curve{
+		"ES256": elliptic.P256(),
+		"ES384": elliptic.P384(),
+		"ES512": elliptic.P521(),
+	} {
+		if testECKeys[alg], err = ecdsa.GenerateKey(curve, rand.Reader); err != nil {
+			panic(err)
+		}
+	}
+}
+
+func encodeSegment(v interface{}) string {
+	b, _ := json.Marshal(v)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// sign returns the token signed by the key, key is a []byte, *rsa.PrivateKey or *ecdsa.PrivateKey.
+// The signature is empty if the algorithm is not supported.
+func sign(t *testing.T, h header, claims Claims, key interface{}) string {
+	input := encodeSegment(h) + "." + encodeSegment(claims)
+	var sig []byte
+	if hash, err := algHash(h.Alg); err == nil {
+		d := hash.New()
+		d.Write([]byte(input))
+		switch k := key.(type) {
+		case []byte:
+			mac := hmac.New(hash.New, k)
+			mac.Write([]byte(input))
+			sig = mac.Sum(nil)
+		case *rsa.PrivateKey:
+			if sig, err = rsa.SignPKCS1v15(rand.Reader, k, hash, d.Sum(nil)); err != nil {
+				t.Fatal(err)
+			}
+		case *ecdsa.PrivateKey:
+			r, s, err := ecdsa.Sign(rand.Reader, k, d.Sum(nil))
+			if err != nil {
+				t.Fatal(err)
+			}
+			size := (k.Curve.Params().BitSize + 7) / 8
+			sig = make([]byte, 2*size)
+			rb, sb := r.Bytes(), s.Bytes()
+			copy(sig[size-len(rb):size], rb)
+			copy(sig[2*size-len(sb):], sb)
+		}
+	}
+	return input + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func publicKey(key interface{}) interface{} {
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		return &k.PublicKey
+	case *ecdsa.PrivateKey:
+		return &k.PublicKey
+	}
+	return key
+}
+
+func TestToken_Verify(t *testing.T) {
+	claims := Claims{"sub": "id0"}
+	var tt = []struct {
+		name string
+		alg  string
+		// signKey signs the token, verifyKey verifies it, verifyKey defaults to the public key of signKey.
+		signKey   interface{}
+		verifyKey interface{}
+		tamper    bool
+		err       error
+	}{
+		{name: "HS256", alg: "HS256", signKey: testHMACKey},
+		{name: "HS384", alg: "HS384", signKey: testHMACKey},
+		{name: "HS512", alg: "HS512", signKey: testHMACKey},
+		{name: "RS256", alg: "RS256", signKey: testRSAKey},
+		{name: "RS384", alg: "RS384", signKey: testRSAKey},
+		{name: "RS512", alg: "RS512", signKey: testRSAKey},
+		{name: "ES256", alg: "ES256", signKey: testECKeys["ES256"]},
+		{name: "ES384", alg: "ES384", signKey: testECKeys["ES384"]},
+		{name: "ES512", alg: "ES512", signKey: testECKeys["ES512"]},
+		{name: "none", alg: "none", verifyKey: testHMACKey, err: ErrUnsupportedAlg},
+		{name: "unknown alg", alg: "PS256", signKey: testHMACKey, verifyKey: testHMACKey, err: ErrUnsupportedAlg},
+		{name: "tampered HS", alg: "HS256", signKey: testHMACKey, tamper: true, err: ErrInvalidSignature},
+		{name: "tampered RS", alg: "RS256", signKey: testRSAKey, tamper: true, err: ErrInvalidSignature},
+		{name: "tampered ES", alg: "ES256", signKey: testECKeys["ES256"], tamper: true, err: ErrInvalidSignature},
+		{name: "wrong HMAC key", alg: "HS256", signKey: testHMACKey, verifyKey: []byte("other"), err: ErrInvalidSignature},
+		{name: "HS against RSA key", alg: "HS256", signKey: testHMACKey, verifyKey: &testRSAKey.PublicKey, err: ErrKeyNotFound},
+		{name: "HS against EC key", alg: "HS256", signKey: testHMACKey, verifyKey: &testECKeys["ES256"].PublicKey, err: ErrKeyNotFound},
+		{name: "RS against HMAC key", alg: "RS256", signKey: testRSAKey, verifyKey: testHMACKey, err: ErrKeyNotFound},
+		{name: "RS against EC key", alg: "RS256", signKey: testRSAKey, verifyKey: &testECKeys["ES256"].PublicKey, err: ErrKeyNotFound},
+		{name: "ES against RSA key", alg: "ES256", signKey: testECKeys["ES256"], verifyKey: &testRSAKey.PublicKey, err: ErrKeyNotFound},
+		{name: "ES256 against P-384 key", alg: "ES256", signKey: testECKeys["ES384"], err: ErrKeyNotFound},
+		{name: "ES512 against P-384 key", alg: "ES512", signKey: testECKeys["ES384"], err: ErrKeyNotFound},
+	}
+	for _, v := range tt {
+		t.Run(v.name, func(t *testing.T) {
+			a := assert.New(t)
+			s := sign(t, header{Alg: v.alg}, claims, v.signKey)
+			if v.tamper {
+				s = s[:len(s)-4] + "AAAA"
+			}
+			tok, err := parse(s)
+			if !a.NoError(err) {
+				return
+			}
+			key := v.verifyKey
+			if key == nil {
+				key = publicKey(v.signKey)
+			}
+			a.Equal(v.err, tok.verify(key))
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	a := assert.New(t)
+	for _, s := range []string{"", "a.b", "a.b.c.d", "!.e30.", encodeSegment(header{Alg: "HS256"}) + ".e30.!"} {
+		_, err := parse(s)
+		a.Equal(ErrMalformedToken, err, s)
+	}
+}
+
+func TestClaims_validateTime(t *testing.T) {
+	now := time.Unix(1000, 0)
+	var tt = []struct {
+		name   string
+		claims Claims
+		leeway time.Duration
+		err    error
+	}{
+		{name: "no claims", claims: Claims{}},
+		{name: "not expired", claims: Claims{"exp": float64(1001)}},
+		{name: "expired", claims: Claims{"exp": float64(1000)}, err: ErrTokenExpired},
+		{name: "expired within leeway", claims: Claims{"exp": float64(995)}, leeway: 10 * time.Second},
+		{name: "expired beyond leeway", claims: Claims{"exp": float64(990)}, leeway: 10 * time.Second, err: ErrTokenExpired},
+		{name: "valid", claims: Claims{"nbf": float64(1000)}},
+		{name: "not valid yet", claims: Claims{"nbf": float64(1001)}, err: ErrTokenNotValidYet},
+		{name: "not valid yet within leeway", claims: Claims{"nbf": float64(1005)}, leeway: 10 * time.Second},
+		{name: "not valid yet beyond leeway", claims: Claims{"nbf": float64(1011)}, leeway: 10 * time.Second, err: ErrTokenNotValidYet},
+		{name: "not a number", claims: Claims{"exp": "990", "nbf": "1011"}},
+	}
+	for _, v := range tt {
+		t.Run(v.name, func(t *testing.T) {
+			assert.Equal(t, v.err, v.claims.validateTime(now, v.leeway))
+		})
+	}
+}
+
+func TestJWTAuth_Verify(t *testing.T) {
+	a := assert.New(t)
+	now := time.Unix(1000, 0)
+	j := New(
+		WithHMACKey(testHMACKey),
+		WithPublicKey("rsa", &testRSAKey.PublicKey),
+		WithPublicKey("", &testECKeys["ES256"].PublicKey),
+		WithLeeway(5*time.Second),
+	)
+	claims, err := j.Verify(sign(t, header{Alg: "HS256"}, Claims{"sub": "id0", "exp": float64(998)}, testHMACKey), now)
+	a.NoError(err)
+	a.Equal("id0", claims.String("sub"))
+
+	_, err = j.Verify(sign(t, header{Alg: "RS256", Kid: "rsa"}, Claims{}, testRSAKey), now)
+	a.NoError(err)
+	// the keys without kid verify the tokens of any kid.
+	_, err = j.Verify(sign(t, header{Alg: "ES256", Kid: "other"}, Claims{}, testECKeys["ES256"]), now)
+	a.NoError(err)
+	_, err = j.Verify(sign(t, header{Alg: "RS256", Kid: "other"}, Claims{}, testRSAKey), now)
+	a.Equal(ErrKeyNotFound, err)
+	_, err = j.Verify(sign(t, header{Alg: "none"}, Claims{}, nil), now)
+	a.Equal(ErrUnsupportedAlg, err)
+	_, err = j.Verify(sign(t, header{Alg: "HS256"}, Claims{"exp": float64(990)}, testHMACKey), now)
+	a.Equal(ErrTokenExpired, err)
+
+	// the HS tokens are rejected if no HMAC key is configured, whatever the public keys are.
+	j = New(WithPublicKey("", &testRSAKey.PublicKey))
+	_, err = j.Verify(sign(t, header{Alg: "HS256"}, Claims{}, testHMACKey), now)
+	a.Equal(ErrKeyNotFound, err)
+}
+
+// jwksServer serves the public keys of the kid in a JSON Web Key Set.
+type jwksServer struct {
+	mu   sync.Mutex
+	keys map[string]interface{}
+}
+
+func (s *jwksServer) set(keys map[string]interface{}) {
+	s.mu.Lock()
+	s.keys = keys
+	s.mu.Unlock()
+}
+
+func (s *jwksServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var set jwkSet
+	// the encryption keys are skipped.
+	set.Keys = append(set.Keys, jwk{Kty: "RSA", Kid: "enc", Use: "enc", N: "AQAB", E: "AQAB"})
+	for kid, key := range s.keys {
+		switch k := key.(type) {
+		case *rsa.PublicKey:
+			set.Keys = append(set.Keys, jwk{
+				Kty: "RSA",
+				Kid: kid,
+				Use: "sig",
+				N:   base64.RawURLEncoding.EncodeToString(k.N.Bytes()),
+				E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(k.E)).Bytes()),
+			})
+		case *ecdsa.PublicKey:
+			set.Keys = append(set.Keys, jwk{
+				Kty: "EC",
+				Kid: kid,
+				Crv: k.Curve.Params().Name,
+				X:   base64.RawURLEncoding.EncodeToString(k.X.Bytes()),
+				Y:   base64.RawURLEncoding.EncodeToString(k.Y.Bytes()),
+			})
+		}
+	}
+	json.NewEncoder(w).Encode(set)
+}
+
+func TestJWTAuth_JWKS(t *testing.T) {
+	a := assert.New(t)
+	now := time.Now()
+	js := &jwksServer{}
+	js.set(map[string]interface{}{
+		"k1": &testRSAKey.PublicKey,
+		"k2": &testECKeys["ES384"].PublicKey,
+	})
+	hs := httptest.NewServer(js)
+	defer hs.Close()
+
+	j := New(WithJWKS(hs.URL, 10*time.Millisecond))
+	j.httpClient = hs.Client()
+	if !a.NoError(j.Load(nil)) {
+		return
+	}
+	defer j.Unload()
+
+	_, err := j.Verify(sign(t, header{Alg: "RS256", Kid: "k1"}, Claims{}, testRSAKey), now)
+	a.NoError(err)
+	_, err = j.Verify(sign(t, header{Alg: "ES384", Kid: "k2"}, Claims{}, testECKeys["ES384"]), now)
+	a.NoError(err)
+	// the key of the kid is selected, the key of the other kid does not verify the token.
+	_, err = j.Verify(sign(t, header{Alg: "ES384", Kid: "k1"}, Claims{}, testECKeys["ES384"]), now)
+	a.Equal(ErrKeyNotFound, err)
+	// the HS tokens are never verified by the JWKS keys.
+	_, err = j.Verify(sign(t, header{Alg: "HS256", Kid: "k1"}, Claims{}, testHMACKey), now)
+	a.Equal(ErrKeyNotFound, err)
+
+	// the keys are rotated.
+	js.set(map[string]interface{}{"k3": &testECKeys["ES256"].PublicKey})
+	rotated := sign(t, header{Alg: "ES256", Kid: "k3"}, Claims{}, testECKeys["ES256"])
+	a.Eventually(func() bool {
+		_, err := j.Verify(rotated, now)
+		return err == nil
+	}, 2*time.Second, 10*time.Millisecond)
+	_, err = j.Verify(sign(t, header{Alg: "RS256", Kid: "k1"}, Claims{}, testRSAKey), now)
+	a.Equal(ErrKeyNotFound, err)
+
+	// the previous keys are kept if the refreshing fails.
+	js.set(nil)
+	time.Sleep(50 * time.Millisecond)
+	_, err = j.Verify(rotated, now)
+	a.NoError(err)
+}
@@ -0,0 +1,269 @@
+// Package jwtauth authenticates the clients by the JSON Web Tokens (RFC 7519) carried in the CONNECT packets.
+// The clients are disconnected once their tokens expire.
+package jwtauth
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/DrmagicE/gmqtt"
+	"github.com/DrmagicE/gmqtt/pkg/packets"
+)
+
+const name = "jwtauth"
+
+var log *zap.Logger
+
+// TokenSource is the field of the CONNECT packet which carries the token.
+type TokenSource int
+
+const (
+	// FromPassword reads the token from the password.
+	FromPassword TokenSource = iota
+	// FromUsername reads the token from the username.
+	FromUsername
+)
+
+const (
+	defaultJWKSRefreshInterval = 10 * time.Minute
+	defaultJWKSTimeout         = 5 * time.Second
+)
+
+// Option is the option of the JWTAuth.
+type Option func(j *JWTAuth)
+
+// WithHMACKey sets the secret to verify the tokens signed by the HS256, HS384 and HS512 algorithms.
+func WithHMACKey(secret []byte) Option {
+	return func(j *JWTAuth) {
+		j.hmacKey = secret
+	}
+}
+
+// WithPublicKey adds the public key to verify the tokens signed by the RS and ES algorithms,
+// the key must be *rsa.PublicKey or *ecdsa.PublicKey. If kid is not empty, the key is only used
+// to verify the tokens with the same kid header.
+func WithPublicKey(kid string, key interface{}) Option {
+	return func(j *JWTAuth) {
+		j.staticKeys[kid] = key
+	}
+}
+
+// WithJWKS sets the url of the JSON Web Key Set which is fetched on loading and refreshed periodically,
+// default to refresh every 10 minutes.
+func WithJWKS(url string, refreshInterval time.Duration) Option {
+	return func(j *JWTAuth) {
+		j.jwksURL = url
+		j.jwksRefreshInterval = refreshInterval
+	}
+}
+
+// WithTokenSource sets the field of the CONNECT packet which carries the token, default to FromPassword.
+func WithTokenSource(source TokenSource) Option {
+	return func(j *JWTAuth) {
+		j.source = source
+	}
+}
+
+// WithClientIDClaim binds the client id to the claim, the client is rejected if its client id
+// is not equal to the string value of the claim, such as "sub".
+func WithClientIDClaim(claim string) Option {
+	return func(j *JWTAuth) {
+		j.clientIDClaim = claim
+	}
+}
+
+// WithLeeway sets the leeway of validating the exp and nbf claims to tolerate the clock skew, default to 0.
+func WithLeeway(leeway time.Duration) Option {
+	return func(j *JWTAuth) {
+		j.leeway = leeway
+	}
+}
+
+// JWTAuth is the plugin which authenticates the clients by the JSON Web Tokens.
+type JWTAuth struct {
+	hmacKey             []byte
+	staticKeys          map[string]interface{}
+	jwksURL             string
+	jwksRefreshInterval time.Duration
+	source              TokenSource
+	clientIDClaim       string
+	leeway              time.Duration
+	httpClient          *http.Client
+
+	keysMu sync.RWMutex
+	// jwksKeys is the keys fetched from the JWKS url.
+	jwksKeys map[string]interface{}
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// New returns the JWTAuth plugin.
+func New(opts ...Option) *JWTAuth {
+	j := &JWTAuth{
+		staticKeys:          make(map[string]interface{}),
+		jwksRefreshInterval: defaultJWKSRefreshInterval,
+		httpClient:          &http.Client{Timeout: defaultJWKSTimeout},
+	}
+	for _, fn := range opts {
+		fn(j)
+	}
+	return j
+}
+
+func (j *JWTAuth) Load(service gmqtt.Server) error {
+	log = gmqtt.Logger("plugin/" + name)
+	j.done = make(chan struct{})
+	if j.jwksURL != "" {
+		keys, err := fetchJWKS(j.httpClient, j.jwksURL)
+		if err != nil {
+			return err
+		}
+		j.jwksKeys = keys
+		j.wg.Add(1)
+		go j.refreshLoop()
+	}
+	return nil
+}
+
+func (j *JWTAuth) Unload() error {
+	close(j.done)
+	j.wg.Wait()
+	return nil
+}
+
+func (j *JWTAuth) HookWrapper() gmqtt.HookWrapper {
+	return gmqtt.HookWrapper{
+		OnConnectWrapper:   j.OnConnectWrapper,
+		OnConnectedWrapper: j.OnConnectedWrapper,
+	}
+}
+
+func (j *JWTAuth) Name() string {
+	return name
+}
+
+// refreshLoop refreshes the JWKS keys periodically, the previous keys are kept if the refreshing fails.
+func (j *JWTAuth) refreshLoop() {
+	defer j.wg.Done()
+	ticker := time.NewTicker(j.jwksRefreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-j.done:
+			return
+		case <-ticker.C:
+			keys, err := fetchJWKS(j.httpClient, j.jwksURL)
+			if err != nil {
+				log.Error("refreshing jwks error", zap.String("url", j.jwksURL), zap.Error(err))
+				continue
+			}
+			j.keysMu.Lock()
+			j.jwksKeys = keys
+			j.keysMu.Unlock()
+		}
+	}
+}
+
+// candidateKeys returns the keys which may verify the token.
+func (j *JWTAuth) candidateKeys(kid string) []interface{} {
+	var keys []interface{}
+	if j.hmacKey != nil {
+		keys = append(keys, j.hmacKey)
+	}
+	add := func(m map[string]interface{}) {
+		if kid != "" {
+			if k, ok := m[kid]; ok {
+				keys = append(keys, k)
+			}
+			// the keys without kid are used to verify all tokens.
+			if k, ok := m[""]; ok {
+				keys = append(keys, k)
+			}
+			return
+		}
+		for _, k := range m {
+			keys = append(keys, k)
+		}
+	}
+	add(j.staticKeys)
+	j.keysMu.RLock()
+	add(j.jwksKeys)
+	j.keysMu.RUnlock()
+	return keys
+}
+
+// Verify verifies the token and returns its claims.
+func (j *JWTAuth) Verify(s string, now time.Time) (Claims, error) {
+	t, err := parse(s)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := algHash(t.header.Alg); err != nil {
+		return nil, err
+	}
+	err = ErrKeyNotFound
+	for _, key := range j.candidateKeys(t.header.Kid) {
+		e := t.verify(key)
+		if e == nil {
+			err = nil
+			break
+		}
+		// the key of the other type returns ErrKeyNotFound.
+		if e != ErrKeyNotFound {
+			err = e
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := t.claims.validateTime(now, j.leeway); err != nil {
+		return nil, err
+	}
+	return t.claims, nil
+}
+
+func (j *JWTAuth) token(client gmqtt.Client) string {
+	if j.source == FromUsername {
+		return client.OptionsReader().Username()
+	}
+	return client.OptionsReader().Password()
+}
+
+// OnConnectWrapper rejects the clients with the invalid tokens, or whose client ids are not bound to the tokens.
+func (j *JWTAuth) OnConnectWrapper(connect gmqtt.OnConnect) gmqtt.OnConnect {
+	return func(ctx context.Context, client gmqtt.Client) (code uint8) {
+		clientID := client.OptionsReader().ClientID()
+		claims, err := j.Verify(j.token(client), time.Now())
+		if err != nil {
+			log.Info("authentication failed", zap.String("client_id", clientID), zap.Error(err))
+			return packets.CodeBadUsernameorPsw
+		}
+		if j.clientIDClaim != "" && claims.String(j.clientIDClaim) != clientID {
+			log.Info("client id is not bound to the token", zap.String("client_id", clientID), zap.String("claim", j.clientIDClaim))
+			return packets.CodeNotAuthorized
+		}
+		return connect(ctx, client)
+	}
+}
+
+// OnConnectedWrapper sets the credential expiry of the client to the expiry of its token,
+// unless the credential, such as the client certificate, expires earlier.
+func (j *JWTAuth) OnConnectedWrapper(connected gmqtt.OnConnected) gmqtt.OnConnected {
+	return func(ctx context.Context, client gmqtt.Client) {
+		// the token has been verified in OnConnect.
+		if t, err := parse(j.token(client)); err == nil {
+			if exp, ok := t.claims.ExpiresAt(); ok {
+				exp = exp.Add(j.leeway)
+				if current := client.CredentialExpiry(); current.IsZero() || exp.Before(current) {
+					client.SetCredentialExpiry(exp)
+				}
+			}
+		}
+		connected(ctx, client)
+	}
+}
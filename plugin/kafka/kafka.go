@@ -0,0 +1,367 @@
+// Package kafka forwards the MQTT messages to the Kafka topics,
+// and optionally consumes the Kafka topics and republishes the records into MQTT.
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	kafkago "github.com/segmentio/kafka-go"
+	"go.uber.org/zap"
+
+	"github.com/DrmagicE/gmqtt"
+	"github.com/DrmagicE/gmqtt/pkg/packets"
+)
+
+const name = "kafka"
+
+var log *zap.Logger
+
+const (
+	defaultBatchSize    = 100
+	defaultBatchTimeout = time.Second
+	// queueSize is the number of the buffered messages of each Kafka topic,
+	// the messages are dropped when the buffer is full.
+	queueSize = 10000
+)
+
+// Key is the key of the produced Kafka records.
+type Key string
+
+const (
+	// KeyNone produces the records without key, the records are distributed to the partitions in round-robin.
+	KeyNone Key = "none"
+	// KeyClientID uses the client id as the key, so the records of a client are kept in order.
+	KeyClientID Key = "client_id"
+	// KeyTopic uses the MQTT topic as the key, so the records of a topic are kept in order.
+	KeyTopic Key = "topic"
+)
+
+// Acks is the number of the acknowledgements required from the Kafka replicas.
+type Acks int
+
+const (
+	AcksNone   Acks = 0
+	AcksLeader Acks = 1
+	AcksAll    Acks = -1
+)
+
+// ProduceRule forwards the messages published by the clients to the Kafka topic.
+type ProduceRule struct {
+	// Topic is the MQTT topic filter of the forwarded messages.
+	Topic string
+	// KafkaTopic is the Kafka topic which the records are produced to.
+	KafkaTopic string
+	// Key is the key of the records, default to KeyNone.
+	Key Key
+}
+
+// ConsumeRule consumes the Kafka topic and republishes the records into MQTT.
+type ConsumeRule struct {
+	// KafkaTopic is the consumed Kafka topic.
+	KafkaTopic string
+	// GroupID is the consumer group id, default to "gmqtt".
+	GroupID string
+	// Topic is the MQTT topic name which the records are published to,
+	// empty means using the key of the record as the topic name.
+	Topic string
+	Qos   uint8
+}
+
+// Option is the option of the Kafka plugin.
+type Option func(k *Kafka)
+
+// WithProduce adds the rules of the messages forwarded to Kafka. The messages matching multiple rules are
+// forwarded once for each matched Kafka topic.
+func WithProduce(rules ...ProduceRule) Option {
+	return func(k *Kafka) {
+		k.produce = append(k.produce, rules...)
+	}
+}
+
+// WithConsume adds the rules of the Kafka topics consumed and republished into MQTT.
+func WithConsume(rules ...ConsumeRule) Option {
+	return func(k *Kafka) {
+		k.consume = append(k.consume, rules...)
+	}
+}
+
+// WithBatch sets the maximum number of the records in a batch and the maximum time to wait for a batch,
+// default to 100 records and 1 second.
+func WithBatch(size int, timeout time.Duration) Option {
+	return func(k *Kafka) {
+		k.batchSize = size
+		k.batchTimeout = timeout
+	}
+}
+
+// WithRequiredAcks sets the acknowledgements required for the produced records, default to AcksAll.
+func WithRequiredAcks(acks Acks) Option {
+	return func(k *Kafka) {
+		k.acks = acks
+	}
+}
+
+// WithDialer sets the dialer used to connect to the brokers, which configures the TLS and SASL.
+func WithDialer(dialer *kafkago.Dialer) Option {
+	return func(k *Kafka) {
+		k.dialer = dialer
+	}
+}
+
+// record is the record waiting to be produced.
+type record struct {
+	key   []byte
+	value []byte
+}
+
+// producer produces the records to one Kafka topic.
+type producer struct {
+	topic  string
+	writer *kafkago.Writer
+	queue  chan record
+}
+
+// Kafka is the plugin which forwards the messages between MQTT and Kafka.
+type Kafka struct {
+	brokers      []string
+	produce      []ProduceRule
+	consume      []ConsumeRule
+	batchSize    int
+	batchTimeout time.Duration
+	acks         Acks
+	dialer       *kafkago.Dialer
+
+	service   gmqtt.Server
+	producers map[string]*producer
+	readers   []*kafkago.Reader
+	cancel    context.CancelFunc
+	wg        sync.WaitGroup
+}
+
+// New returns the Kafka plugin which connects to the brokers.
+func New(brokers []string, opts ...Option) *Kafka {
+	k := &Kafka{
+		brokers:      brokers,
+		batchSize:    defaultBatchSize,
+		batchTimeout: defaultBatchTimeout,
+		acks:         AcksAll,
+		producers:    make(map[string]*producer),
+	}
+	for _, fn := range opts {
+		fn(k)
+	}
+	return k
+}
+
+func (k *Kafka) validate() error {
+	if len(k.brokers) == 0 {
+		return errors.New("empty brokers")
+	}
+	for _, v := range k.produce {
+		if !packets.ValidTopicFilter([]byte(v.Topic)) {
+			return fmt.Errorf("invalid topic filter: %q", v.Topic)
+		}
+		if v.KafkaTopic == "" {
+			return errors.New("empty kafka topic")
+		}
+		if v.Key != "" && v.Key != KeyNone && v.Key != KeyClientID && v.Key != KeyTopic {
+			return fmt.Errorf("invalid key: %q", v.Key)
+		}
+	}
+	for _, v := range k.consume {
+		if v.KafkaTopic == "" {
+			return errors.New("empty kafka topic")
+		}
+		if v.Topic != "" && !packets.ValidTopicName([]byte(v.Topic)) {
+			return fmt.Errorf("invalid topic name: %q", v.Topic)
+		}
+		if v.Qos > packets.QOS_2 {
+			return fmt.Errorf("invalid qos: %d", v.Qos)
+		}
+	}
+	return nil
+}
+
+func (k *Kafka) Load(service gmqtt.Server) error {
+	log = gmqtt.Logger("plugin/" + name)
+	if err := k.validate(); err != nil {
+		return err
+	}
+	k.service = service
+	ctx, cancel := context.WithCancel(context.Background())
+	k.cancel = cancel
+	for _, v := range k.produce {
+		if _, ok := k.producers[v.KafkaTopic]; ok {
+			continue
+		}
+		p := &producer{
+			topic: v.KafkaTopic,
+			writer: kafkago.NewWriter(kafkago.WriterConfig{
+				Brokers: k.brokers,
+				Topic:   v.KafkaTopic,
+				Dialer:  k.dialer,
+				// the records with the same key are produced to the same partition.
+				Balancer:  &kafkago.Hash{},
+				BatchSize: k.batchSize,
+				// the records are batched by produceLoop, the writer flushes them immediately.
+				BatchTimeout: time.Millisecond,
+				RequiredAcks: int(k.acks),
+			}),
+			queue: make(chan record, queueSize),
+		}
+		k.producers[v.KafkaTopic] = p
+		k.wg.Add(1)
+		go k.produceLoop(ctx, p)
+	}
+	for _, v := range k.consume {
+		groupID := v.GroupID
+		if groupID == "" {
+			groupID = "gmqtt"
+		}
+		r := kafkago.NewReader(kafkago.ReaderConfig{
+			Brokers: k.brokers,
+			GroupID: groupID,
+			Topic:   v.KafkaTopic,
+			Dialer:  k.dialer,
+		})
+		k.readers = append(k.readers, r)
+		k.wg.Add(1)
+		go k.consumeLoop(ctx, r, v)
+	}
+	return nil
+}
+
+func (k *Kafka) Unload() error {
+	if k.cancel != nil {
+		k.cancel()
+	}
+	k.wg.Wait()
+	for _, p := range k.producers {
+		p.writer.Close()
+	}
+	for _, r := range k.readers {
+		r.Close()
+	}
+	return nil
+}
+
+func (k *Kafka) HookWrapper() gmqtt.HookWrapper {
+	return gmqtt.HookWrapper{
+		OnMsgArrivedWrapper: k.OnMsgArrivedWrapper,
+	}
+}
+
+func (k *Kafka) Name() string {
+	return name
+}
+
+// OnMsgArrivedWrapper queues the accepted messages which match the produce rules.
+// The records consumed from Kafka are published by the PublishService and do not arrive here,
+// so they are never produced back.
+func (k *Kafka) OnMsgArrivedWrapper(arrived gmqtt.OnMsgArrived) gmqtt.OnMsgArrived {
+	return func(ctx context.Context, client gmqtt.Client, msg packets.Message) (valid bool) {
+		valid = arrived(ctx, client, msg)
+		if !valid {
+			return false
+		}
+		forwarded := make(map[string]bool)
+		for _, v := range k.produce {
+			if forwarded[v.KafkaTopic] || !packets.TopicMatch([]byte(msg.Topic()), []byte(v.Topic)) {
+				continue
+			}
+			forwarded[v.KafkaTopic] = true
+			rec := record{value: msg.Payload()}
+			switch v.Key {
+			case KeyClientID:
+				rec.key = []byte(client.OptionsReader().ClientID())
+			case KeyTopic:
+				rec.key = []byte(msg.Topic())
+			}
+			select {
+			case k.producers[v.KafkaTopic].queue <- rec:
+			default:
+				log.Warn("kafka queue is full, dropping message",
+					zap.String("kafka_topic", v.KafkaTopic),
+					zap.String("topic", msg.Topic()),
+				)
+			}
+		}
+		return true
+	}
+}
+
+// produceLoop produces the queued records in batches.
+func (k *Kafka) produceLoop(ctx context.Context, p *producer) {
+	defer k.wg.Done()
+	batch := make([]kafkago.Message, 0, k.batchSize)
+	timer := time.NewTimer(k.batchTimeout)
+	defer timer.Stop()
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := p.writer.WriteMessages(ctx, batch...); err != nil {
+			log.Error("producing kafka records error",
+				zap.String("kafka_topic", p.topic),
+				zap.Int("records", len(batch)),
+				zap.Error(err),
+			)
+		}
+		batch = batch[:0]
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case rec := <-p.queue:
+			batch = append(batch, kafkago.Message{Key: rec.key, Value: rec.value})
+			if len(batch) >= k.batchSize {
+				flush()
+			}
+		case <-timer.C:
+			flush()
+			timer.Reset(k.batchTimeout)
+		}
+	}
+}
+
+// consumeLoop republishes the records of the Kafka topic into MQTT.
+func (k *Kafka) consumeLoop(ctx context.Context, r *kafkago.Reader, rule ConsumeRule) {
+	defer k.wg.Done()
+	for {
+		m, err := r.ReadMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log.Error("consuming kafka records error", zap.String("kafka_topic", rule.KafkaTopic), zap.Error(err))
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(time.Second):
+			}
+			continue
+		}
+		k.publish(rule, m)
+	}
+}
+
+// publish republishes the consumed record into MQTT.
+func (k *Kafka) publish(rule ConsumeRule, m kafkago.Message) {
+	topic := rule.Topic
+	if topic == "" {
+		topic = string(m.Key)
+		if !packets.ValidTopicName(m.Key) {
+			log.Warn("invalid topic name in the kafka record key, dropping record",
+				zap.String("kafka_topic", rule.KafkaTopic),
+				zap.ByteString("key", m.Key),
+			)
+			return
+		}
+	}
+	k.service.PublishService().Publish(gmqtt.NewMessage(topic, m.Value, rule.Qos))
+}
@@ -0,0 +1,143 @@
+package kafka
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	kafkago "github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+
+	"github.com/DrmagicE/gmqtt"
+	"github.com/DrmagicE/gmqtt/internal/testutil"
+	"github.com/DrmagicE/gmqtt/pkg/packets"
+)
+
+func init() {
+	log = zap.NewNop()
+}
+
+// fakeServer is the gmqtt.Server which records the published messages.
+type fakeServer struct {
+	gmqtt.Server
+
+	mu   sync.Mutex
+	msgs []packets.Message
+}
+
+func (s *fakeServer) PublishService() gmqtt.PublishService {
+	return s
+}
+
+func (s *fakeServer) Publish(message packets.Message) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.msgs = append(s.msgs, message)
+}
+
+func (s *fakeServer) PublishToClient(clientID string, message packets.Message, match bool) {
+}
+
+// newTestKafka returns the plugin whose producers only queue the records.
+func newTestKafka(opts ...Option) *Kafka {
+	k := New([]string{"127.0.0.1:9092"}, opts...)
+	for _, v := range k.produce {
+		k.producers[v.KafkaTopic] = &producer{topic: v.KafkaTopic, queue: make(chan record, 2)}
+	}
+	return k
+}
+
+// queued returns the queued records of the Kafka topic.
+func (k *Kafka) queued(topic string) []record {
+	var rs []record
+	q := k.producers[topic].queue
+	for len(q) > 0 {
+		rs = append(rs, <-q)
+	}
+	return rs
+}
+
+func TestKafka_validate(t *testing.T) {
+	var tt = []struct {
+		name    string
+		brokers []string
+		opts    []Option
+		ok      bool
+	}{
+		{name: "ok", brokers: []string{"b"}, opts: []Option{
+			WithProduce(ProduceRule{Topic: "a/#", KafkaTopic: "a", Key: KeyTopic}),
+			WithConsume(ConsumeRule{KafkaTopic: "b", Topic: "b", Qos: 1}),
+		}, ok: true},
+		{name: "empty_brokers"},
+		{name: "invalid_filter", brokers: []string{"b"}, opts: []Option{WithProduce(ProduceRule{Topic: "a/#/b", KafkaTopic: "a"})}},
+		{name: "empty_produce_topic", brokers: []string{"b"}, opts: []Option{WithProduce(ProduceRule{Topic: "a"})}},
+		{name: "invalid_key", brokers: []string{"b"}, opts: []Option{WithProduce(ProduceRule{Topic: "a", KafkaTopic: "a", Key: "other"})}},
+		{name: "empty_consume_topic", brokers: []string{"b"}, opts: []Option{WithConsume(ConsumeRule{Topic: "a"})}},
+		{name: "wildcard_topic", brokers: []string{"b"}, opts: []Option{WithConsume(ConsumeRule{KafkaTopic: "a", Topic: "a/+"})}},
+		{name: "invalid_qos", brokers: []string{"b"}, opts: []Option{WithConsume(ConsumeRule{KafkaTopic: "a", Qos: 3})}},
+	}
+	for _, v := range tt {
+		t.Run(v.name, func(t *testing.T) {
+			err := New(v.brokers, v.opts...).validate()
+			if v.ok {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestKafka_OnMsgArrivedWrapper(t *testing.T) {
+	a := assert.New(t)
+	k := newTestKafka(WithProduce(
+		ProduceRule{Topic: "a/#", KafkaTopic: "by_client", Key: KeyClientID},
+		ProduceRule{Topic: "a/b", KafkaTopic: "by_topic", Key: KeyTopic},
+		// the message is produced once for each Kafka topic.
+		ProduceRule{Topic: "+/b", KafkaTopic: "by_topic"},
+		ProduceRule{Topic: "#", KafkaTopic: "none"},
+	))
+	valid := true
+	arrived := k.OnMsgArrivedWrapper(func(ctx context.Context, client gmqtt.Client, msg packets.Message) bool {
+		return valid
+	})
+	c := testutil.NewClient("id", "")
+	a.True(arrived(context.Background(), c, gmqtt.NewMessage("a/b", []byte("1"), packets.QOS_1)))
+	a.True(arrived(context.Background(), c, gmqtt.NewMessage("c", []byte("2"), packets.QOS_1)))
+	// the rejected messages are not produced.
+	valid = false
+	a.False(arrived(context.Background(), c, gmqtt.NewMessage("a/b", []byte("3"), packets.QOS_1)))
+
+	a.Equal([]record{{key: []byte("id"), value: []byte("1")}}, k.queued("by_client"))
+	a.Equal([]record{{key: []byte("a/b"), value: []byte("1")}}, k.queued("by_topic"))
+	a.Equal([]record{{value: []byte("1")}, {value: []byte("2")}}, k.queued("none"))
+
+	// the messages are dropped once the queue is full, the hook is not blocked.
+	valid = true
+	for i := 0; i < 3; i++ {
+		a.True(arrived(context.Background(), c, gmqtt.NewMessage("c", []byte("4"), packets.QOS_1)))
+	}
+	a.Len(k.queued("none"), 2)
+}
+
+func TestKafka_publish(t *testing.T) {
+	a := assert.New(t)
+	srv := &fakeServer{}
+	k := New([]string{"127.0.0.1:9092"})
+	k.service = srv
+	k.publish(ConsumeRule{KafkaTopic: "a", Topic: "fixed", Qos: 1}, kafkago.Message{Key: []byte("key"), Value: []byte("1")})
+	// the key is used as the topic name if the topic is not set.
+	k.publish(ConsumeRule{KafkaTopic: "a", Qos: 2}, kafkago.Message{Key: []byte("x/y"), Value: []byte("2")})
+	// the record whose key is not a valid topic name is dropped.
+	k.publish(ConsumeRule{KafkaTopic: "a"}, kafkago.Message{Key: []byte("x/#"), Value: []byte("3")})
+
+	if !a.Len(srv.msgs, 2) {
+		return
+	}
+	a.Equal("fixed", srv.msgs[0].Topic())
+	a.Equal(packets.QOS_1, srv.msgs[0].Qos())
+	a.Equal([]byte("1"), srv.msgs[0].Payload())
+	a.Equal("x/y", srv.msgs[1].Topic())
+	a.Equal(packets.QOS_2, srv.msgs[1].Qos())
+}
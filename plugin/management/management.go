@@ -2,13 +2,21 @@ package management
 
 import (
 	"context"
+	"crypto/subtle"
 	"errors"
 	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/DrmagicE/gmqtt"
 	"github.com/DrmagicE/gmqtt/pkg/packets"
 	"github.com/gin-gonic/gin"
+	"go.uber.org/zap/zapcore"
 )
 
 const CodeOK = 0
@@ -47,6 +55,30 @@ type Management struct {
 	server  gmqtt.Server
 	addr    string
 	user    gin.Accounts //BasicAuth user info,username => password
+	token   string       //Bearer token
+
+	traceDir   string
+	traceMu    sync.Mutex
+	traceFiles map[string]*os.File // trace id => trace log file
+}
+
+// Option is the option of the Management.
+type Option func(m *Management)
+
+// WithToken protects the api by the bearer token,
+// the requests must carry the "Authorization: Bearer <token>" header.
+// If the BasicAuth user is set as well, the requests which pass either of them are authorized.
+func WithToken(token string) Option {
+	return func(m *Management) {
+		m.token = token
+	}
+}
+
+// WithTraceDir sets the directory of the trace log files, the default is os.TempDir().
+func WithTraceDir(dir string) Option {
+	return func(m *Management) {
+		m.traceDir = dir
+	}
 }
 
 // OnSessionCreatedWrapper store the client when session created
@@ -98,8 +130,8 @@ func (m *Management) Load(server gmqtt.Server) error {
 	gin.SetMode(gin.ReleaseMode)
 	e := gin.Default()
 
-	if m.user != nil {
-		router = e.Group("/", gin.BasicAuth(m.user))
+	if m.user != nil || m.token != "" {
+		router = e.Group("/", m.authorize())
 	} else {
 		router = e
 	}
@@ -112,8 +144,21 @@ func (m *Management) Load(server gmqtt.Server) error {
 	router.POST("/unsubscribe", m.Unsubscribe)
 	router.POST("/publish", m.Publish)
 	router.DELETE("/client/:id", m.CloseClient)
+	router.GET("/retained", m.GetRetainedMessages)
+	router.GET("/bans", m.GetBans)
+	router.POST("/ban", m.Ban)
+	router.DELETE("/ban", m.Unban)
+	router.POST("/reload", m.Reload)
+	router.POST("/log_level", m.SetLogLevel)
+	router.GET("/traces", m.GetTraces)
+	router.POST("/trace", m.StartTrace)
+	router.DELETE("/trace/:id", m.StopTrace)
+	ln, err := gmqtt.Listen(m.addr)
+	if err != nil {
+		return err
+	}
 	go func() {
-		err := e.Run(m.addr)
+		err := http.Serve(ln, e)
 		if err != http.ErrServerClosed {
 			panic(err)
 		}
@@ -121,6 +166,13 @@ func (m *Management) Load(server gmqtt.Server) error {
 	return nil
 }
 func (m *Management) Unload() error {
+	m.traceMu.Lock()
+	defer m.traceMu.Unlock()
+	for id, f := range m.traceFiles {
+		m.server.TraceService().Stop(id)
+		f.Close()
+		delete(m.traceFiles, id)
+	}
 	return nil
 }
 func (m *Management) HookWrapper() gmqtt.HookWrapper {
@@ -163,10 +215,38 @@ func newPager(c *gin.Context) *Pager {
 	return pager
 }
 
-func New(addr string, user gin.Accounts) *Management {
+// authorize returns the middleware which authorizes the requests by the bearer token or BasicAuth.
+func (m *Management) authorize() gin.HandlerFunc {
+	var basicAuth gin.HandlerFunc
+	if m.user != nil {
+		basicAuth = gin.BasicAuth(m.user)
+	}
+	return func(c *gin.Context) {
+		if m.token != "" {
+			auth := c.GetHeader("Authorization")
+			if strings.HasPrefix(auth, "Bearer ") &&
+				subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(auth, "Bearer ")), []byte(m.token)) == 1 {
+				c.Next()
+				return
+			}
+		}
+		if basicAuth != nil {
+			basicAuth(c)
+			return
+		}
+		c.AbortWithStatus(http.StatusUnauthorized)
+	}
+}
+
+func New(addr string, user gin.Accounts, opts ...Option) *Management {
 	m := &Management{
-		user: user,
-		addr: addr,
+		user:       user,
+		addr:       addr,
+		traceDir:   os.TempDir(),
+		traceFiles: make(map[string]*os.File),
+	}
+	for _, fn := range opts {
+		fn(m)
 	}
 	return m
 }
@@ -289,9 +369,258 @@ func (m *Management) Publish(c *gin.Context) {
 // CloseClient is the handle function for "Delete /client/:id" which close the client specified by the id
 func (m *Management) CloseClient(c *gin.Context) {
 	id := c.Param("id")
-	client := m.server.Client(id)
-	if client != nil {
-		client.Close()
+	m.server.ClientService().Kick(id, "closed by the management api")
+	c.JSON(http.StatusOK, newResponse(struct{}{}, nil, nil))
+}
+
+// RetainedInfo represents the retained message information
+type RetainedInfo struct {
+	Topic   string `json:"topic"`
+	Qos     uint8  `json:"qos"`
+	Payload string `json:"payload"`
+}
+
+// GetRetainedMessages is the handle function for "/retained" which returns the retained messages
+// that match the topic filter, default to all retained messages.
+func (m *Management) GetRetainedMessages(c *gin.Context) {
+	topic := c.Query("topic")
+	if topic != "" && !packets.ValidTopicFilter([]byte(topic)) {
+		c.JSON(http.StatusOK, newResponse(nil, nil, packets.ErrInvalTopicFilter))
+		return
+	}
+	var msgs []packets.Message
+	if topic != "" {
+		msgs = m.server.RetainedStore().GetMatchedMessages(topic)
+	} else {
+		m.server.RetainedStore().Iterate(func(message packets.Message) bool {
+			msgs = append(msgs, message)
+			return true
+		})
+	}
+	// sort the messages to keep the pagination stable.
+	sort.Slice(msgs, func(i, j int) bool {
+		return msgs[i].Topic() < msgs[j].Topic()
+	})
+	pager := newPager(c)
+	rs := make([]*RetainedInfo, 0)
+	for i := (pager.Page - 1) * pager.PageSize; i < len(msgs) && len(rs) < pager.PageSize; i++ {
+		rs = append(rs, &RetainedInfo{
+			Topic:   msgs[i].Topic(),
+			Qos:     msgs[i].Qos(),
+			Payload: string(msgs[i].Payload()),
+		})
+	}
+	pager.Count = len(rs)
+	c.JSON(http.StatusOK, newResponse(rs, pager, nil))
+}
+
+// BanInfo represents the ban information
+type BanInfo struct {
+	Kind     string `json:"kind"`
+	Value    string `json:"value"`
+	At       string `json:"at"`
+	Until    string `json:"until"`
+	Flapping bool   `json:"flapping"`
+}
+
+func parseBanKind(kind string) (gmqtt.BanKind, error) {
+	switch kind {
+	case gmqtt.BanClientID.String():
+		return gmqtt.BanClientID, nil
+	case gmqtt.BanIP.String():
+		return gmqtt.BanIP, nil
+	case gmqtt.BanCIDR.String():
+		return gmqtt.BanCIDR, nil
+	case gmqtt.BanClientIDPattern.String():
+		return gmqtt.BanClientIDPattern, nil
+	}
+	return 0, errors.New("invalid kind")
+}
+
+// GetBans is the handle function for "/bans" which returns the active bans
+func (m *Management) GetBans(c *gin.Context) {
+	bans := m.server.BanService().Bans()
+	pager := newPager(c)
+	rs := make([]*BanInfo, 0)
+	for i := (pager.Page - 1) * pager.PageSize; i < len(bans) && len(rs) < pager.PageSize; i++ {
+		info := &BanInfo{
+			Kind:     bans[i].Kind.String(),
+			Value:    bans[i].Value,
+			At:       bans[i].At.Format(time.RFC3339),
+			Flapping: bans[i].Flapping,
+		}
+		if !bans[i].Until.IsZero() {
+			info.Until = bans[i].Until.Format(time.RFC3339)
+		}
+		rs = append(rs, info)
+	}
+	pager.Count = len(rs)
+	c.JSON(http.StatusOK, newResponse(rs, pager, nil))
+}
+
+// Ban is the handle function for "/ban" which bans the client id, IP address, network or client id pattern
+func (m *Management) Ban(c *gin.Context) {
+	kind, err := parseBanKind(c.PostForm("kind"))
+	if err != nil {
+		c.JSON(http.StatusOK, newResponse(nil, nil, err))
+		return
+	}
+	value := c.PostForm("value")
+	if value == "" {
+		c.JSON(http.StatusOK, newResponse(nil, nil, errors.New("invalid value")))
+		return
+	}
+	var duration time.Duration
+	if d := c.PostForm("duration"); d != "" {
+		duration, err = time.ParseDuration(d)
+		if err != nil || duration < 0 {
+			c.JSON(http.StatusOK, newResponse(nil, nil, errors.New("invalid duration")))
+			return
+		}
+	}
+	err = m.server.BanService().Ban(kind, value, duration)
+	if err != nil {
+		c.JSON(http.StatusOK, newResponse(nil, nil, err))
+		return
+	}
+	c.JSON(http.StatusOK, newResponse(struct{}{}, nil, nil))
+}
+
+// Unban is the handle function for "Delete /ban" which removes the ban
+func (m *Management) Unban(c *gin.Context) {
+	kind, err := parseBanKind(c.Query("kind"))
+	if err != nil {
+		c.JSON(http.StatusOK, newResponse(nil, nil, err))
+		return
+	}
+	m.server.BanService().Unban(kind, c.Query("value"))
+	c.JSON(http.StatusOK, newResponse(struct{}{}, nil, nil))
+}
+
+// Reload is the handle function for "/reload" which reloads the configuration of the server and the plugins
+func (m *Management) Reload(c *gin.Context) {
+	err := m.server.ReloadConfig(m.server.GetConfig())
+	if err != nil {
+		c.JSON(http.StatusOK, newResponse(nil, nil, err))
+		return
+	}
+	c.JSON(http.StatusOK, newResponse(struct{}{}, nil, nil))
+}
+
+// SetLogLevel is the handle function for "/log_level" which changes the log level of the server or the module
+func (m *Management) SetLogLevel(c *gin.Context) {
+	var level zapcore.Level
+	if err := level.UnmarshalText([]byte(c.PostForm("level"))); err != nil {
+		c.JSON(http.StatusOK, newResponse(nil, nil, errors.New("invalid level")))
+		return
+	}
+	if module := c.PostForm("module"); module != "" {
+		m.server.SetModuleLogLevel(module, level)
+		c.JSON(http.StatusOK, newResponse(struct{}{}, nil, nil))
+		return
+	}
+	err := m.server.SetLogLevel(level)
+	if err != nil {
+		c.JSON(http.StatusOK, newResponse(nil, nil, err))
+		return
+	}
+	c.JSON(http.StatusOK, newResponse(struct{}{}, nil, nil))
+}
+
+// TraceInfo is the trace info for the api server
+type TraceInfo struct {
+	ID        string `json:"id"`
+	Kind      string `json:"kind"`
+	Value     string `json:"value"`
+	StartedAt string `json:"started_at"`
+	// File is the trace log file in which the events are written as JSON lines.
+	File string `json:"file"`
+}
+
+func parseTraceKind(kind string) (gmqtt.TraceKind, error) {
+	switch kind {
+	case gmqtt.TraceClientID.String():
+		return gmqtt.TraceClientID, nil
+	case gmqtt.TraceTopic.String():
+		return gmqtt.TraceTopic, nil
+	}
+	return 0, errors.New("invalid kind")
+}
+
+func (m *Management) traceFile(id string) string {
+	return filepath.Join(m.traceDir, "trace-"+id+".log")
+}
+
+func (m *Management) newTraceInfo(t gmqtt.Trace) *TraceInfo {
+	return &TraceInfo{
+		ID:        t.ID,
+		Kind:      t.Kind.String(),
+		Value:     t.Value,
+		StartedAt: t.StartedAt.Format(time.RFC3339),
+		File:      m.traceFile(t.ID),
+	}
+}
+
+// GetTraces is the handle function for "/traces" which returns the traces started by the api server
+func (m *Management) GetTraces(c *gin.Context) {
+	m.traceMu.Lock()
+	defer m.traceMu.Unlock()
+	rs := make([]*TraceInfo, 0)
+	for _, t := range m.server.TraceService().Traces() {
+		if _, ok := m.traceFiles[t.ID]; ok {
+			rs = append(rs, m.newTraceInfo(t))
+		}
+	}
+	c.JSON(http.StatusOK, newResponse(rs, nil, nil))
+}
+
+// StartTrace is the handle function for "/trace" which starts the trace of the client id or topic filter,
+// the events are written to the trace log file
+func (m *Management) StartTrace(c *gin.Context) {
+	kind, err := parseTraceKind(c.PostForm("kind"))
+	if err != nil {
+		c.JSON(http.StatusOK, newResponse(nil, nil, err))
+		return
+	}
+	m.traceMu.Lock()
+	defer m.traceMu.Unlock()
+	// the file is created before the trace to receive all events, and renamed after the trace id is known.
+	f, err := os.OpenFile(filepath.Join(m.traceDir, "trace-"+strconv.FormatInt(time.Now().UnixNano(), 10)+".tmp"),
+		os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		c.JSON(http.StatusOK, newResponse(nil, nil, err))
+		return
+	}
+	t, err := m.server.TraceService().Start(kind, c.PostForm("value"), gmqtt.NewTraceWriter(f))
+	if err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		c.JSON(http.StatusOK, newResponse(nil, nil, err))
+		return
+	}
+	if err := os.Rename(f.Name(), m.traceFile(t.ID)); err != nil {
+		m.server.TraceService().Stop(t.ID)
+		f.Close()
+		os.Remove(f.Name())
+		c.JSON(http.StatusOK, newResponse(nil, nil, err))
+		return
+	}
+	m.traceFiles[t.ID] = f
+	c.JSON(http.StatusOK, newResponse(m.newTraceInfo(t), nil, nil))
+}
+
+// StopTrace is the handle function for "Delete /trace/:id" which stops the trace and closes the trace log file
+func (m *Management) StopTrace(c *gin.Context) {
+	id := c.Param("id")
+	m.traceMu.Lock()
+	defer m.traceMu.Unlock()
+	f, ok := m.traceFiles[id]
+	if !ok {
+		c.JSON(http.StatusOK, newResponse(nil, nil, errors.New("trace not found")))
+		return
 	}
+	m.server.TraceService().Stop(id)
+	f.Close()
+	delete(m.traceFiles, id)
 	c.JSON(http.StatusOK, newResponse(struct{}{}, nil, nil))
 }
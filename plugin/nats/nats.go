@@ -0,0 +1,353 @@
+// Package nats bridges the messages between the MQTT topics and the NATS subjects in both directions.
+// The forwarding can be backed by the JetStream streams and consumers for the at-least-once delivery.
+package nats
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	natsgo "github.com/nats-io/nats.go"
+	"go.uber.org/zap"
+
+	"github.com/DrmagicE/gmqtt"
+	"github.com/DrmagicE/gmqtt/pkg/packets"
+)
+
+const name = "nats"
+
+var log *zap.Logger
+
+const (
+	defaultJetStreamTimeout = 5 * time.Second
+	// jetStreamRetryDelay is the delay between the retries of the unacknowledged JetStream publishes.
+	jetStreamRetryDelay = time.Second
+	// queueSize is the number of the buffered JetStream publishes, the messages are dropped when the buffer is full.
+	queueSize = 10000
+	// jetStreamAck acknowledges the message delivered by the JetStream consumer.
+	jetStreamAck = "+ACK"
+)
+
+var errInvalidTopic = errors.New("topic cannot be mapped to the NATS subject")
+
+// ToSubject maps the MQTT topic name or topic filter to the NATS subject:
+// the separator "/" is mapped to ".", the wildcard "+" to "*" and "#" to ">".
+// It returns errInvalidTopic if a topic level is empty or contains ".", "*", ">" or whitespaces.
+func ToSubject(topic string) (string, error) {
+	levels := strings.Split(topic, "/")
+	for i, v := range levels {
+		switch {
+		case v == "+":
+			levels[i] = "*"
+		case v == "#":
+			levels[i] = ">"
+		case v == "" || strings.ContainsAny(v, ".*> \t\r\n"):
+			return "", errInvalidTopic
+		}
+	}
+	return strings.Join(levels, "."), nil
+}
+
+// ToTopic maps the NATS subject to the MQTT topic, it is the reverse of ToSubject.
+func ToTopic(subject string) string {
+	tokens := strings.Split(subject, ".")
+	for i, v := range tokens {
+		switch v {
+		case "*":
+			tokens[i] = "+"
+		case ">":
+			tokens[i] = "#"
+		}
+	}
+	return strings.Join(tokens, "/")
+}
+
+// OutRule forwards the messages published by the clients to NATS.
+type OutRule struct {
+	// Topic is the MQTT topic filter of the forwarded messages.
+	Topic string
+	// Prefix is prepended to the subject of the forwarded messages, such as "mqtt.".
+	Prefix string
+	// JetStream is whether the subject is captured by a JetStream stream. If it is true, the message is published
+	// by the request and is retried until the stream acknowledges it, otherwise it is published at most once.
+	JetStream bool
+}
+
+// InRule forwards the messages from NATS to the MQTT subscribers.
+type InRule struct {
+	// Topic is the MQTT topic filter which is mapped to the subscribed subject.
+	Topic string
+	// Prefix is prepended to the topic of the forwarded messages, such as "nats/".
+	Prefix string
+	Qos    uint8
+	// Queue is the queue group of the subscription, empty means no queue group.
+	Queue string
+	// DeliverSubject is the deliver subject of the JetStream push consumer. If it is set, the deliver subject is
+	// subscribed instead of the mapped subject, and the messages are acknowledged once they are published to MQTT.
+	DeliverSubject string
+}
+
+// Option is the option of the NATS plugin.
+type Option func(n *NATS)
+
+// WithOut adds the rules of the messages forwarded to NATS.
+func WithOut(rules ...OutRule) Option {
+	return func(n *NATS) {
+		n.out = append(n.out, rules...)
+	}
+}
+
+// WithIn adds the rules of the messages forwarded from NATS.
+func WithIn(rules ...InRule) Option {
+	return func(n *NATS) {
+		n.in = append(n.in, rules...)
+	}
+}
+
+// WithNATSOptions sets the options of the NATS connection, such as the credentials and TLS.
+func WithNATSOptions(opts ...natsgo.Option) Option {
+	return func(n *NATS) {
+		n.natsOpts = append(n.natsOpts, opts...)
+	}
+}
+
+// WithJetStreamTimeout sets the time to wait for the acknowledgement of the JetStream publish, default to 5 seconds.
+func WithJetStreamTimeout(timeout time.Duration) Option {
+	return func(n *NATS) {
+		n.jsTimeout = timeout
+	}
+}
+
+// pubAck is the acknowledgement of the JetStream publish.
+type pubAck struct {
+	Stream string `json:"stream"`
+	Seq    uint64 `json:"seq"`
+	Error  *struct {
+		Code        int    `json:"code"`
+		Description string `json:"description"`
+	} `json:"error,omitempty"`
+}
+
+// publish is the JetStream publish waiting to be acknowledged.
+type publish struct {
+	subject string
+	data    []byte
+}
+
+// NATS is the plugin which bridges the messages between MQTT and NATS.
+type NATS struct {
+	url       string
+	out       []OutRule
+	in        []InRule
+	natsOpts  []natsgo.Option
+	jsTimeout time.Duration
+
+	service gmqtt.Server
+	conn    *natsgo.Conn
+	jsQueue chan *publish
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+// New returns the NATS plugin which connects to the NATS server url.
+func New(url string, opts ...Option) *NATS {
+	n := &NATS{
+		url:       url,
+		jsTimeout: defaultJetStreamTimeout,
+		jsQueue:   make(chan *publish, queueSize),
+	}
+	for _, fn := range opts {
+		fn(n)
+	}
+	return n
+}
+
+func (n *NATS) validate() error {
+	for _, v := range n.out {
+		if !packets.ValidTopicFilter([]byte(v.Topic)) {
+			return fmt.Errorf("invalid topic filter: %q", v.Topic)
+		}
+	}
+	for _, v := range n.in {
+		if !packets.ValidTopicFilter([]byte(v.Topic)) {
+			return fmt.Errorf("invalid topic filter: %q", v.Topic)
+		}
+		if _, err := ToSubject(v.Topic); err != nil && v.DeliverSubject == "" {
+			return fmt.Errorf("%s: %q", err, v.Topic)
+		}
+		if v.Qos > packets.QOS_2 {
+			return fmt.Errorf("invalid qos: %d", v.Qos)
+		}
+	}
+	return nil
+}
+
+func (n *NATS) Load(service gmqtt.Server) error {
+	log = gmqtt.Logger("plugin/" + name)
+	if err := n.validate(); err != nil {
+		return err
+	}
+	n.service = service
+	// the handlers are called asynchronously, even after the connection is closed by Unload,
+	// so they use the logger of this load instead of log, which is replaced if the plugin is loaded again.
+	logger := log
+	opts := append([]natsgo.Option{
+		natsgo.Name("gmqtt"),
+		natsgo.MaxReconnects(-1),
+		natsgo.DisconnectErrHandler(func(conn *natsgo.Conn, err error) {
+			logger.Warn("nats disconnected", zap.Error(err))
+		}),
+		natsgo.ReconnectHandler(func(conn *natsgo.Conn) {
+			logger.Info("nats reconnected", zap.String("url", conn.ConnectedUrl()))
+		}),
+	}, n.natsOpts...)
+	conn, err := natsgo.Connect(n.url, opts...)
+	if err != nil {
+		return err
+	}
+	n.conn = conn
+	for _, v := range n.in {
+		if err := n.subscribe(v); err != nil {
+			conn.Close()
+			return err
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	n.cancel = cancel
+	n.wg.Add(1)
+	go n.jetStreamLoop(ctx)
+	return nil
+}
+
+func (n *NATS) Unload() error {
+	if n.cancel != nil {
+		n.cancel()
+	}
+	n.wg.Wait()
+	if n.conn != nil {
+		n.conn.Close()
+	}
+	return nil
+}
+
+func (n *NATS) HookWrapper() gmqtt.HookWrapper {
+	return gmqtt.HookWrapper{
+		OnMsgArrivedWrapper: n.OnMsgArrivedWrapper,
+	}
+}
+
+func (n *NATS) Name() string {
+	return name
+}
+
+func (n *NATS) subscribe(rule InRule) error {
+	subject := rule.DeliverSubject
+	if subject == "" {
+		subject, _ = ToSubject(rule.Topic)
+	}
+	handler := func(msg *natsgo.Msg) {
+		n.forward(rule, msg)
+	}
+	var err error
+	if rule.Queue != "" {
+		_, err = n.conn.QueueSubscribe(subject, rule.Queue, handler)
+	} else {
+		_, err = n.conn.Subscribe(subject, handler)
+	}
+	return err
+}
+
+// forward publishes the NATS message to MQTT.
+func (n *NATS) forward(rule InRule, msg *natsgo.Msg) {
+	topic := rule.Prefix + ToTopic(msg.Subject)
+	if !packets.ValidTopicName([]byte(topic)) {
+		log.Warn("invalid topic name mapped from the subject, dropping message", zap.String("subject", msg.Subject))
+		return
+	}
+	n.service.PublishService().Publish(gmqtt.NewMessage(topic, msg.Data, rule.Qos))
+	if rule.DeliverSubject != "" && msg.Reply != "" {
+		if err := msg.Respond([]byte(jetStreamAck)); err != nil {
+			log.Warn("acknowledging jetstream message error", zap.String("subject", msg.Subject), zap.Error(err))
+		}
+	}
+}
+
+// OnMsgArrivedWrapper forwards the accepted messages which match the out rules.
+// The messages forwarded from NATS are published by the PublishService and do not arrive here,
+// so they are never forwarded back.
+func (n *NATS) OnMsgArrivedWrapper(arrived gmqtt.OnMsgArrived) gmqtt.OnMsgArrived {
+	return func(ctx context.Context, client gmqtt.Client, msg packets.Message) (valid bool) {
+		valid = arrived(ctx, client, msg)
+		if !valid {
+			return false
+		}
+		for _, v := range n.out {
+			if !packets.TopicMatch([]byte(msg.Topic()), []byte(v.Topic)) {
+				continue
+			}
+			subject, err := ToSubject(msg.Topic())
+			if err != nil {
+				log.Warn("topic cannot be mapped to the subject, dropping message", zap.String("topic", msg.Topic()))
+				break
+			}
+			subject = v.Prefix + subject
+			if !v.JetStream {
+				if err := n.conn.Publish(subject, msg.Payload()); err != nil {
+					log.Warn("publishing to nats error", zap.String("subject", subject), zap.Error(err))
+				}
+				break
+			}
+			select {
+			case n.jsQueue <- &publish{subject: subject, data: msg.Payload()}:
+			default:
+				log.Warn("jetstream queue is full, dropping message", zap.String("subject", subject))
+			}
+			break
+		}
+		return true
+	}
+}
+
+// jetStreamLoop publishes the queued messages to JetStream in order, each message is retried until it is acknowledged.
+func (n *NATS) jetStreamLoop(ctx context.Context) {
+	defer n.wg.Done()
+	for {
+		var p *publish
+		select {
+		case <-ctx.Done():
+			return
+		case p = <-n.jsQueue:
+		}
+		for {
+			err := n.publishJetStream(p)
+			if err == nil {
+				break
+			}
+			log.Warn("publishing to jetstream error, retrying", zap.String("subject", p.subject), zap.Error(err))
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(jetStreamRetryDelay):
+			}
+		}
+	}
+}
+
+func (n *NATS) publishJetStream(p *publish) error {
+	resp, err := n.conn.Request(p.subject, p.data, n.jsTimeout)
+	if err != nil {
+		return err
+	}
+	var ack pubAck
+	if err := json.Unmarshal(resp.Data, &ack); err != nil {
+		return fmt.Errorf("invalid jetstream ack: %s", err)
+	}
+	if ack.Error != nil {
+		return fmt.Errorf("jetstream error %d: %s", ack.Error.Code, ack.Error.Description)
+	}
+	return nil
+}
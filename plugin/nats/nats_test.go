@@ -0,0 +1,429 @@
+package nats
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	natsgo "github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/DrmagicE/gmqtt"
+	"github.com/DrmagicE/gmqtt/pkg/packets"
+)
+
+// fakeNATS is the NATS server which implements the core protocol used by the plugin:
+// the subscriptions with the wildcards and the queue groups, and the publishes with the reply subjects.
+type fakeNATS struct {
+	ln net.Listener
+
+	mu    sync.Mutex
+	conns []net.Conn
+	subs  []*fakeSub
+}
+
+type fakeSub struct {
+	w       *fakeConn
+	subject string
+	queue   string
+	sid     string
+}
+
+type fakeConn struct {
+	mu sync.Mutex
+	c  net.Conn
+}
+
+func (c *fakeConn) write(format string, args ...interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	fmt.Fprintf(c.c, format, args...)
+}
+
+func startNATS(t *testing.T) *fakeNATS {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeNATS{ln: ln}
+	go s.serve()
+	return s
+}
+
+func (s *fakeNATS) url() string {
+	return "nats://" + s.ln.Addr().String()
+}
+
+func (s *fakeNATS) close() {
+	s.ln.Close()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, c := range s.conns {
+		c.Close()
+	}
+}
+
+func (s *fakeNATS) serve() {
+	for {
+		c, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.conns = append(s.conns, c)
+		s.mu.Unlock()
+		go s.handle(c)
+	}
+}
+
+// subjectMatch reports whether the subject matches the subscribed subject, which may contain "*" and ">".
+func subjectMatch(subject, sub string) bool {
+	st, ft := strings.Split(subject, "."), strings.Split(sub, ".")
+	for i, v := range ft {
+		if v == ">" {
+			return len(st) > i
+		}
+		if i >= len(st) || (v != "*" && v != st[i]) {
+			return false
+		}
+	}
+	return len(st) == len(ft)
+}
+
+func (s *fakeNATS) handle(c net.Conn) {
+	defer c.Close()
+	w := &fakeConn{c: c}
+	w.write("INFO {\"server_id\":\"fake\",\"version\":\"1.4.1\",\"max_payload\":1048576}\r\n")
+	r := bufio.NewReader(c)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			s.unsubscribe(w, "")
+			return
+		}
+		args := strings.Fields(line)
+		if len(args) == 0 {
+			continue
+		}
+		switch strings.ToUpper(args[0]) {
+		case "PING":
+			w.write("PONG\r\n")
+		case "SUB":
+			sub := &fakeSub{w: w, subject: args[1], sid: args[len(args)-1]}
+			if len(args) == 4 {
+				sub.queue = args[2]
+			}
+			s.mu.Lock()
+			s.subs = append(s.subs, sub)
+			s.mu.Unlock()
+		case "UNSUB":
+			s.unsubscribe(w, args[1])
+		case "PUB":
+			n, _ := strconv.Atoi(args[len(args)-1])
+			data := make([]byte, n+2)
+			if _, err := io.ReadFull(r, data); err != nil {
+				return
+			}
+			var reply string
+			if len(args) == 4 {
+				reply = args[2]
+			}
+			s.publish(args[1], reply, data[:n])
+		}
+	}
+}
+
+// unsubscribe removes the subscription of the connection, or all the subscriptions if sid is empty.
+func (s *fakeNATS) unsubscribe(w *fakeConn, sid string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	subs := s.subs[:0]
+	for _, v := range s.subs {
+		if v.w != w || (sid != "" && v.sid != sid) {
+			subs = append(subs, v)
+		}
+	}
+	s.subs = subs
+}
+
+func (s *fakeNATS) publish(subject, reply string, data []byte) {
+	s.mu.Lock()
+	var matched []*fakeSub
+	queues := make(map[string]bool)
+	for _, v := range s.subs {
+		if !subjectMatch(subject, v.subject) {
+			continue
+		}
+		// the message is delivered to one member of each queue group.
+		if v.queue != "" {
+			if queues[v.queue] {
+				continue
+			}
+			queues[v.queue] = true
+		}
+		matched = append(matched, v)
+	}
+	s.mu.Unlock()
+	for _, v := range matched {
+		if reply != "" {
+			v.w.write("MSG %s %s %s %d\r\n%s\r\n", subject, v.sid, reply, len(data), data)
+		} else {
+			v.w.write("MSG %s %s %d\r\n%s\r\n", subject, v.sid, len(data), data)
+		}
+	}
+}
+
+// fakeServer is the gmqtt.Server which records the published messages.
+type fakeServer struct {
+	gmqtt.Server
+
+	mu   sync.Mutex
+	msgs []packets.Message
+}
+
+func (s *fakeServer) PublishService() gmqtt.PublishService {
+	return s
+}
+
+func (s *fakeServer) Publish(message packets.Message) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.msgs = append(s.msgs, message)
+}
+
+func (s *fakeServer) PublishToClient(clientID string, message packets.Message, match bool) {
+}
+
+func (s *fakeServer) published() []packets.Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]packets.Message(nil), s.msgs...)
+}
+
+func connect(t *testing.T, s *fakeNATS) *natsgo.Conn {
+	conn, err := natsgo.Connect(s.url())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn
+}
+
+// subscribe returns the channel of the messages received by the subject.
+func subscribe(t *testing.T, conn *natsgo.Conn, subject string) chan *natsgo.Msg {
+	ch := make(chan *natsgo.Msg, 64)
+	if _, err := conn.ChanSubscribe(subject, ch); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	return ch
+}
+
+func recv(t *testing.T, ch chan *natsgo.Msg) *natsgo.Msg {
+	select {
+	case m := <-ch:
+		return m
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout")
+	}
+	return nil
+}
+
+func load(t *testing.T, s *fakeNATS, srv gmqtt.Server, opts ...Option) *NATS {
+	n := New(s.url(), opts...)
+	if err := n.Load(srv); err != nil {
+		t.Fatal(err)
+	}
+	// the subscriptions of the in rules are registered once the server responds.
+	if err := n.conn.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestToSubject(t *testing.T) {
+	var tt = []struct {
+		topic   string
+		subject string
+		err     error
+	}{
+		{topic: "a/b/c", subject: "a.b.c"},
+		{topic: "a/+/#", subject: "a.*.>"},
+		{topic: "#", subject: ">"},
+		{topic: "a//b", err: errInvalidTopic},
+		{topic: "/a", err: errInvalidTopic},
+		{topic: "a.b", err: errInvalidTopic},
+		{topic: "a/b*", err: errInvalidTopic},
+		{topic: "a b", err: errInvalidTopic},
+	}
+	for _, v := range tt {
+		subject, err := ToSubject(v.topic)
+		assert.Equal(t, v.err, err, v.topic)
+		assert.Equal(t, v.subject, subject, v.topic)
+		if err == nil {
+			assert.Equal(t, v.topic, ToTopic(subject))
+		}
+	}
+}
+
+func TestNATS_validate(t *testing.T) {
+	var tt = []struct {
+		name string
+		opts []Option
+		ok   bool
+	}{
+		{name: "ok", opts: []Option{WithOut(OutRule{Topic: "a/#"}), WithIn(InRule{Topic: "b/+", Qos: 1})}, ok: true},
+		{name: "invalid_out_filter", opts: []Option{WithOut(OutRule{Topic: "a/#/b"})}},
+		{name: "invalid_in_filter", opts: []Option{WithIn(InRule{Topic: "a/#/b"})}},
+		{name: "unmappable_in_filter", opts: []Option{WithIn(InRule{Topic: "a.b"})}},
+		// the topic filter of the JetStream consumer is not subscribed.
+		{name: "deliver_subject", opts: []Option{WithIn(InRule{Topic: "a.b", DeliverSubject: "deliver"})}, ok: true},
+		{name: "invalid_qos", opts: []Option{WithIn(InRule{Topic: "a", Qos: 3})}},
+	}
+	for _, v := range tt {
+		t.Run(v.name, func(t *testing.T) {
+			err := New("", v.opts...).validate()
+			if v.ok {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestNATS_Out(t *testing.T) {
+	a := assert.New(t)
+	s := startNATS(t)
+	defer s.close()
+	conn := connect(t, s)
+	defer conn.Close()
+	ch := subscribe(t, conn, ">")
+
+	n := load(t, s, nil, WithOut(
+		OutRule{Topic: "a/#", Prefix: "mqtt."},
+		OutRule{Topic: "#"},
+	))
+	defer n.Unload()
+	valid := true
+	arrived := n.OnMsgArrivedWrapper(func(ctx context.Context, client gmqtt.Client, msg packets.Message) bool {
+		return valid
+	})
+	ctx := context.Background()
+	// the first matching rule is used.
+	a.True(arrived(ctx, nil, gmqtt.NewMessage("a/b", []byte("1"), packets.QOS_1)))
+	a.True(arrived(ctx, nil, gmqtt.NewMessage("b/c", []byte("2"), packets.QOS_1)))
+	// the topics which can not be mapped are dropped.
+	a.True(arrived(ctx, nil, gmqtt.NewMessage("b/c.d", []byte("3"), packets.QOS_1)))
+	// the rejected messages are not forwarded.
+	valid = false
+	a.False(arrived(ctx, nil, gmqtt.NewMessage("b/c", []byte("4"), packets.QOS_1)))
+	valid = true
+	a.True(arrived(ctx, nil, gmqtt.NewMessage("c", []byte("5"), packets.QOS_1)))
+
+	for _, v := range []struct{ subject, data string }{
+		{subject: "mqtt.a.b", data: "1"},
+		{subject: "b.c", data: "2"},
+		{subject: "c", data: "5"},
+	} {
+		m := recv(t, ch)
+		a.Equal(v.subject, m.Subject)
+		a.Equal(v.data, string(m.Data))
+	}
+}
+
+func TestNATS_JetStream(t *testing.T) {
+	a := assert.New(t)
+	s := startNATS(t)
+	defer s.close()
+	conn := connect(t, s)
+	defer conn.Close()
+	// the stream rejects the first publish, which is retried before the next message is published.
+	var mu sync.Mutex
+	var received []string
+	_, err := conn.Subscribe("js.>", func(m *natsgo.Msg) {
+		mu.Lock()
+		defer mu.Unlock()
+		received = append(received, string(m.Data))
+		if len(received) == 1 {
+			m.Respond([]byte(`{"error":{"code":503,"description":"unavailable"}}`))
+			return
+		}
+		m.Respond([]byte(`{"stream":"s","seq":` + strconv.Itoa(len(received)) + `}`))
+	})
+	if !a.NoError(err) {
+		return
+	}
+	a.NoError(conn.Flush())
+
+	n := load(t, s, nil, WithOut(OutRule{Topic: "#", Prefix: "js.", JetStream: true}))
+	defer n.Unload()
+	arrived := n.OnMsgArrivedWrapper(func(ctx context.Context, client gmqtt.Client, msg packets.Message) bool {
+		return true
+	})
+	a.True(arrived(context.Background(), nil, gmqtt.NewMessage("a", []byte("1"), packets.QOS_1)))
+	a.True(arrived(context.Background(), nil, gmqtt.NewMessage("a", []byte("2"), packets.QOS_1)))
+	a.Eventually(func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(received) == 3
+	}, 3*time.Second, 10*time.Millisecond)
+	mu.Lock()
+	a.Equal([]string{"1", "1", "2"}, received)
+	mu.Unlock()
+}
+
+func TestNATS_In(t *testing.T) {
+	a := assert.New(t)
+	s := startNATS(t)
+	defer s.close()
+	conn := connect(t, s)
+	defer conn.Close()
+
+	srv := &fakeServer{}
+	n := load(t, s, srv, WithIn(
+		InRule{Topic: "x/+", Prefix: "nats/", Qos: 1},
+		InRule{Topic: "y/#", Queue: "q"},
+		InRule{Topic: "z", DeliverSubject: "deliver.z", Qos: 2},
+	))
+	defer n.Unload()
+
+	a.NoError(conn.Publish("x.a", []byte("1")))
+	a.NoError(conn.Publish("y.a.b", []byte("2")))
+	// the in rules do not match.
+	a.NoError(conn.Publish("x.a.b", []byte("3")))
+	// the messages of the JetStream consumer are acknowledged once they are published.
+	m, err := conn.Request("deliver.z", []byte("4"), 2*time.Second)
+	if a.NoError(err) {
+		a.Equal(jetStreamAck, string(m.Data))
+	}
+	a.Eventually(func() bool { return len(srv.published()) == 3 }, 2*time.Second, 10*time.Millisecond)
+	// the subscriptions are handled concurrently, so the messages of the different rules are not ordered.
+	msgs := make(map[string]packets.Message)
+	for _, v := range srv.published() {
+		msgs[v.Topic()] = v
+	}
+	for _, v := range []struct {
+		topic   string
+		qos     uint8
+		payload string
+	}{
+		{topic: "nats/x/a", qos: packets.QOS_1, payload: "1"},
+		{topic: "y/a/b", qos: packets.QOS_0, payload: "2"},
+		{topic: "deliver/z", qos: packets.QOS_2, payload: "4"},
+	} {
+		m, ok := msgs[v.topic]
+		if a.True(ok, v.topic) {
+			a.Equal(v.qos, m.Qos())
+			a.Equal(v.payload, string(m.Payload()))
+		}
+	}
+}
@@ -0,0 +1,289 @@
+// Package passwdfile authenticates the clients by the bcrypt hashes in the password file,
+// and optionally authorizes them by the per-user ACL section. The file is reloaded automatically once it changes.
+package passwdfile
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/DrmagicE/gmqtt"
+	"github.com/DrmagicE/gmqtt/pkg/packets"
+	"github.com/DrmagicE/gmqtt/plugin/acl"
+)
+
+const name = "passwdfile"
+
+var log *zap.Logger
+
+const (
+	aclSection = "[acl]"
+	// reloadDelay debounces the file events, the editors usually write the file several times on saving.
+	reloadDelay = 100 * time.Millisecond
+)
+
+// config is the parsed password file.
+type config struct {
+	passwords map[string][]byte
+	// restricted is the users which have the ACL entries, the other users are not restricted.
+	restricted map[string]bool
+	acl        *acl.ACL
+}
+
+// parse parses the password file:
+//
+//	# comment
+//	alice:$2a$10$...
+//	bob:$2a$10$...
+//
+//	[acl]
+//	alice pubsub devices/%u/#
+//	bob sub devices/+/status 1
+func parse(r io.Reader) (*config, error) {
+	cfg := &config{
+		passwords:  make(map[string][]byte),
+		restricted: make(map[string]bool),
+		acl:        acl.New(acl.WithNoMatch(acl.Deny)),
+	}
+	var rules []acl.Rule
+	inACL := false
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if line == aclSection {
+			inACL = true
+			continue
+		}
+		if !inACL {
+			i := strings.IndexByte(line, ':')
+			if i <= 0 || i == len(line)-1 {
+				return nil, fmt.Errorf("line %d: invalid password entry", n)
+			}
+			cfg.passwords[line[:i]] = []byte(line[i+1:])
+			continue
+		}
+		rule, err := parseACL(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", n, err)
+		}
+		cfg.restricted[rule.Username] = true
+		rules = append(rules, rule)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if err := cfg.acl.SetRules(rules); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// parseACL parses the ACL entry: <username> <pub|sub|pubsub> <topic filter> [max qos].
+func parseACL(line string) (acl.Rule, error) {
+	fields := strings.Fields(line)
+	if len(fields) != 3 && len(fields) != 4 {
+		return acl.Rule{}, fmt.Errorf("invalid acl entry")
+	}
+	rule := acl.Rule{
+		Permission: acl.Allow,
+		Username:   fields[0],
+		Topics:     []string{fields[2]},
+	}
+	switch fields[1] {
+	case "pub":
+		rule.Action = acl.Publish
+	case "sub":
+		rule.Action = acl.Subscribe
+	case "pubsub":
+		rule.Action = acl.All
+	default:
+		return acl.Rule{}, fmt.Errorf("invalid acl action: %q", fields[1])
+	}
+	if len(fields) == 4 {
+		qos, err := strconv.ParseUint(fields[3], 10, 8)
+		if err != nil {
+			return acl.Rule{}, fmt.Errorf("invalid acl qos: %q", fields[3])
+		}
+		q := uint8(qos)
+		rule.MaxQos = &q
+	}
+	return rule, rule.Validate()
+}
+
+// PasswdFile is the plugin which authenticates and authorizes the clients by the password file.
+type PasswdFile struct {
+	path string
+
+	mu  sync.RWMutex
+	cfg *config
+
+	watcher *fsnotify.Watcher
+	done    chan struct{}
+	wg      sync.WaitGroup
+}
+
+// New returns the PasswdFile plugin which loads the password file at path.
+func New(path string) *PasswdFile {
+	return &PasswdFile{
+		path: path,
+	}
+}
+
+func (p *PasswdFile) Load(service gmqtt.Server) error {
+	log = gmqtt.Logger("plugin/" + name)
+	if err := p.Reload(); err != nil {
+		return err
+	}
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	// watch the directory rather than the file, since the editors may replace the file on saving.
+	if err := watcher.Add(filepath.Dir(p.path)); err != nil {
+		watcher.Close()
+		return err
+	}
+	p.watcher = watcher
+	p.done = make(chan struct{})
+	p.wg.Add(1)
+	go p.watch()
+	return nil
+}
+
+func (p *PasswdFile) Unload() error {
+	close(p.done)
+	err := p.watcher.Close()
+	p.wg.Wait()
+	return err
+}
+
+func (p *PasswdFile) HookWrapper() gmqtt.HookWrapper {
+	return gmqtt.HookWrapper{
+		OnConnectWrapper:    p.OnConnectWrapper,
+		OnSubscribeWrapper:  p.OnSubscribeWrapper,
+		OnMsgArrivedWrapper: p.OnMsgArrivedWrapper,
+	}
+}
+
+func (p *PasswdFile) Name() string {
+	return name
+}
+
+// Reload reloads the password file, the current config is kept if the file is invalid.
+// The connected clients are not affected, the new config applies to the subsequent requests.
+func (p *PasswdFile) Reload() error {
+	f, err := os.Open(p.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	cfg, err := parse(f)
+	if err != nil {
+		return err
+	}
+	p.mu.Lock()
+	p.cfg = cfg
+	p.mu.Unlock()
+	return nil
+}
+
+func (p *PasswdFile) config() *config {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.cfg
+}
+
+// watch reloads the password file once it changes.
+func (p *PasswdFile) watch() {
+	defer p.wg.Done()
+	var timer <-chan time.Time
+	for {
+		select {
+		case <-p.done:
+			return
+		case ev, ok := <-p.watcher.Events:
+			if !ok {
+				return
+			}
+			if filepath.Clean(ev.Name) != filepath.Clean(p.path) || ev.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename) == 0 {
+				continue
+			}
+			timer = time.After(reloadDelay)
+		case err, ok := <-p.watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Error("watching password file error", zap.Error(err))
+		case <-timer:
+			timer = nil
+			if err := p.Reload(); err != nil {
+				log.Error("reloading password file error", zap.String("path", p.path), zap.Error(err))
+				continue
+			}
+			log.Info("password file reloaded", zap.String("path", p.path))
+		}
+	}
+}
+
+// authorize returns whether the client is allowed to publish or subscribe to the topic,
+// and the maximum qos granted by the ACL.
+func (p *PasswdFile) authorize(client gmqtt.Client, action acl.Action, topic string) (allowed bool, maxQos uint8) {
+	cfg := p.config()
+	opts := client.OptionsReader()
+	if !cfg.restricted[opts.Username()] {
+		return true, packets.QOS_2
+	}
+	return cfg.acl.Authorize(opts.ClientID(), opts.Username(), action, topic)
+}
+
+// OnConnectWrapper authenticates the username and password by the password file.
+func (p *PasswdFile) OnConnectWrapper(connect gmqtt.OnConnect) gmqtt.OnConnect {
+	return func(ctx context.Context, client gmqtt.Client) (code uint8) {
+		opts := client.OptionsReader()
+		hash, ok := p.config().passwords[opts.Username()]
+		if !ok || bcrypt.CompareHashAndPassword(hash, []byte(opts.Password())) != nil {
+			log.Info("authentication failed", zap.String("client_id", opts.ClientID()), zap.String("username", opts.Username()))
+			return packets.CodeBadUsernameorPsw
+		}
+		return connect(ctx, client)
+	}
+}
+
+// OnSubscribeWrapper authorizes the subscription by the ACL section.
+func (p *PasswdFile) OnSubscribeWrapper(subscribe gmqtt.OnSubscribe) gmqtt.OnSubscribe {
+	return func(ctx context.Context, client gmqtt.Client, topic packets.Topic) (qos uint8) {
+		allowed, maxQos := p.authorize(client, acl.Subscribe, topic.Name)
+		if !allowed {
+			return packets.SUBSCRIBE_FAILURE
+		}
+		if topic.Qos > maxQos {
+			topic.Qos = maxQos
+		}
+		return subscribe(ctx, client, topic)
+	}
+}
+
+// OnMsgArrivedWrapper authorizes the publish by the ACL section.
+func (p *PasswdFile) OnMsgArrivedWrapper(arrived gmqtt.OnMsgArrived) gmqtt.OnMsgArrived {
+	return func(ctx context.Context, client gmqtt.Client, msg packets.Message) (valid bool) {
+		allowed, maxQos := p.authorize(client, acl.Publish, msg.Topic())
+		if !allowed || msg.Qos() > maxQos {
+			return false
+		}
+		return arrived(ctx, client, msg)
+	}
+}
@@ -0,0 +1,141 @@
+package passwdfile
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/DrmagicE/gmqtt"
+	"github.com/DrmagicE/gmqtt/internal/testutil"
+	"github.com/DrmagicE/gmqtt/pkg/packets"
+)
+
+func newTestClient(username, password string) *testutil.Client {
+	c := testutil.NewClient("id0", username)
+	c.Opts.Pass = password
+	return c
+}
+
+func hash(t *testing.T, password string) string {
+	b, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestParse(t *testing.T) {
+	a := assert.New(t)
+	cfg, err := parse(strings.NewReader(`
+# comment
+alice:hash0
+bob:hash1
+
+[acl]
+alice pubsub devices/%u/#
+alice sub status/+ 1
+`))
+	if !a.NoError(err) {
+		return
+	}
+	a.Equal(map[string][]byte{"alice": []byte("hash0"), "bob": []byte("hash1")}, cfg.passwords)
+	a.Equal(map[string]bool{"alice": true}, cfg.restricted)
+	a.Len(cfg.acl.Rules(), 2)
+
+	for _, v := range []string{
+		"alice",
+		":hash",
+		"alice:",
+		"[acl]\nalice pub",
+		"[acl]\nalice read a",
+		"[acl]\nalice pub a 3",
+		"[acl]\nalice pub a/#/b",
+	} {
+		_, err := parse(strings.NewReader(v))
+		a.Error(err, v)
+	}
+}
+
+func TestPasswdFile(t *testing.T) {
+	a := assert.New(t)
+	dir, err := ioutil.TempDir("", "passwdfile")
+	if !a.NoError(err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "passwd")
+	write := func(content string) {
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("alice:" + hash(t, "alice-pass") + "\n" +
+		"bob:" + hash(t, "bob-pass") + "\n" +
+		"[acl]\n" +
+		"alice pubsub devices/%u/#\n" +
+		"alice sub status/+ 1\n")
+	p := New(path)
+	if !a.NoError(p.Load(nil)) {
+		return
+	}
+	defer p.Unload()
+
+	connect := p.OnConnectWrapper(func(ctx context.Context, client gmqtt.Client) uint8 {
+		return packets.CodeAccepted
+	})
+	a.EqualValues(packets.CodeAccepted, connect(context.Background(), newTestClient("alice", "alice-pass")))
+	a.EqualValues(packets.CodeBadUsernameorPsw, connect(context.Background(), newTestClient("alice", "bob-pass")))
+	a.EqualValues(packets.CodeBadUsernameorPsw, connect(context.Background(), newTestClient("carol", "")))
+
+	subscribe := p.OnSubscribeWrapper(func(ctx context.Context, client gmqtt.Client, topic packets.Topic) uint8 {
+		return topic.Qos
+	})
+	arrived := p.OnMsgArrivedWrapper(func(ctx context.Context, client gmqtt.Client, msg packets.Message) bool {
+		return true
+	})
+	alice, bob := newTestClient("alice", ""), newTestClient("bob", "")
+	a.Equal(packets.QOS_2, subscribe(context.Background(), alice, packets.Topic{Name: "devices/alice/+", Qos: packets.QOS_2}))
+	a.Equal(packets.QOS_1, subscribe(context.Background(), alice, packets.Topic{Name: "status/a", Qos: packets.QOS_2}))
+	a.EqualValues(packets.SUBSCRIBE_FAILURE, subscribe(context.Background(), alice, packets.Topic{Name: "devices/bob/+", Qos: packets.QOS_0}))
+	a.True(arrived(context.Background(), alice, gmqtt.NewMessage("devices/alice/a", nil, packets.QOS_1)))
+	a.False(arrived(context.Background(), alice, gmqtt.NewMessage("status/a", nil, packets.QOS_0)))
+	// the users without the ACL entries are not restricted.
+	a.Equal(packets.QOS_2, subscribe(context.Background(), bob, packets.Topic{Name: "devices/alice/+", Qos: packets.QOS_2}))
+	a.True(arrived(context.Background(), bob, gmqtt.NewMessage("status/a", nil, packets.QOS_2)))
+
+	// the file is reloaded once it changes.
+	write("alice:" + hash(t, "new-pass") + "\n" +
+		"[acl]\n" +
+		"alice pub status/+\n")
+	a.Eventually(func() bool {
+		return connect(context.Background(), newTestClient("alice", "new-pass")) == packets.CodeAccepted
+	}, 2*time.Second, 20*time.Millisecond)
+	a.EqualValues(packets.CodeBadUsernameorPsw, connect(context.Background(), newTestClient("alice", "alice-pass")))
+	a.EqualValues(packets.CodeBadUsernameorPsw, connect(context.Background(), newTestClient("bob", "bob-pass")))
+	a.True(arrived(context.Background(), alice, gmqtt.NewMessage("status/a", nil, packets.QOS_0)))
+	a.False(arrived(context.Background(), alice, gmqtt.NewMessage("devices/alice/a", nil, packets.QOS_0)))
+
+	// the config is kept if the new file is invalid.
+	write("alice\n")
+	time.Sleep(3 * reloadDelay)
+	a.EqualValues(packets.CodeAccepted, connect(context.Background(), newTestClient("alice", "new-pass")))
+
+	// the file replaced by renaming is reloaded as well.
+	tmp := filepath.Join(dir, "passwd.tmp")
+	if err := ioutil.WriteFile(tmp, []byte("bob:"+hash(t, "bob-pass")+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		t.Fatal(err)
+	}
+	a.Eventually(func() bool {
+		return connect(context.Background(), newTestClient("bob", "bob-pass")) == packets.CodeAccepted
+	}, 2*time.Second, 20*time.Millisecond)
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"net/http"
 	"sync/atomic"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
@@ -35,15 +36,23 @@ func New(httpSever *http.Server, path string) *Prometheus {
 }
 
 func (p *Prometheus) Load(service gmqtt.Server) error {
-	log = gmqtt.LoggerWithField(zap.String("plugin", name))
+	log = gmqtt.Logger("plugin/" + name)
 	p.statsManager = service.GetStatsManager()
 	r := prometheus.NewPedanticRegistry()
 	r.MustRegister(p)
 	mu := http.NewServeMux()
 	mu.Handle(p.path, promhttp.HandlerFor(r, promhttp.HandlerOpts{}))
 	p.httpServer.Handler = mu
+	addr := p.httpServer.Addr
+	if addr == "" {
+		addr = ":http"
+	}
+	ln, err := gmqtt.Listen(addr)
+	if err != nil {
+		return err
+	}
 	go func() {
-		err := p.httpServer.ListenAndServe()
+		err := p.httpServer.Serve(ln)
 		if err != http.ErrServerClosed {
 			panic(err.Error())
 		}
@@ -71,6 +80,9 @@ func (p *Prometheus) Collect(m chan<- prometheus.Metric) {
 	collectClientStats(st.ClientStats, m)
 	collectSubscriptionStats(st.SubscriptionStats, m)
 	collectMessageStats(st.MessageStats, m)
+	collectRetainedStats(st.RetainedStats, m)
+	collectListenerStats(st.ListenerStats, m)
+	collectDispatchStats(st.DispatchStats, m)
 }
 
 func collectPacketsStats(ps *gmqtt.PacketStats, m chan<- prometheus.Metric) {
@@ -367,3 +379,81 @@ func collectSubscriptionStats(s *subscription.Stats, m chan<- prometheus.Metric)
 		float64(atomic.LoadUint64(&s.SubscriptionsCurrent)),
 	)
 }
+
+func collectRetainedStats(r *gmqtt.RetainedStats, m chan<- prometheus.Metric) {
+	m <- prometheus.MustNewConstMetric(
+		prometheus.NewDesc(metricPrefix+"retained_messages_dropped_total", "", nil, nil),
+		prometheus.CounterValue,
+		float64(atomic.LoadUint64(&r.DroppedTotal)),
+	)
+}
+
+func collectDispatchStats(d *gmqtt.DispatchStats, m chan<- prometheus.Metric) {
+	m <- prometheus.MustNewConstMetric(
+		prometheus.NewDesc(metricPrefix+"dispatch_queued_current", "", nil, nil),
+		prometheus.GaugeValue,
+		float64(d.QueuedCurrent),
+	)
+	m <- prometheus.MustNewConstMetric(
+		prometheus.NewDesc(metricPrefix+"dispatch_total", "", nil, nil),
+		prometheus.CounterValue,
+		float64(d.DispatchedTotal),
+	)
+	m <- prometheus.MustNewConstMetric(
+		prometheus.NewDesc(metricPrefix+"dispatch_latency_seconds_total", "", nil, nil),
+		prometheus.CounterValue,
+		float64(d.LatencyNanoTotal)/float64(time.Second),
+	)
+	m <- prometheus.MustNewConstMetric(
+		prometheus.NewDesc(metricPrefix+"dispatch_overflowed_total", "", nil, nil),
+		prometheus.CounterValue,
+		float64(d.OverflowedTotal),
+	)
+}
+
+func collectListenerStats(ls map[string]*gmqtt.ListenerStats, m chan<- prometheus.Metric) {
+	for name, l := range ls {
+		m <- prometheus.MustNewConstMetric(
+			prometheus.NewDesc(metricPrefix+"listener_connections_current", "", []string{"listener"}, nil),
+			prometheus.GaugeValue,
+			float64(l.ConnectionsCurrent),
+			name,
+		)
+		m <- prometheus.MustNewConstMetric(
+			prometheus.NewDesc(metricPrefix+"listener_connections_total", "", []string{"listener"}, nil),
+			prometheus.CounterValue,
+			float64(l.ConnectionsTotal),
+			name,
+		)
+		m <- prometheus.MustNewConstMetric(
+			prometheus.NewDesc(metricPrefix+"listener_received_bytes_total", "", []string{"listener"}, nil),
+			prometheus.CounterValue,
+			float64(l.BytesReceived),
+			name,
+		)
+		m <- prometheus.MustNewConstMetric(
+			prometheus.NewDesc(metricPrefix+"listener_sent_bytes_total", "", []string{"listener"}, nil),
+			prometheus.CounterValue,
+			float64(l.BytesSent),
+			name,
+		)
+		m <- prometheus.MustNewConstMetric(
+			prometheus.NewDesc(metricPrefix+"listener_rejected_total", "", []string{"listener", "reason"}, nil),
+			prometheus.CounterValue,
+			float64(l.RejectedListenerQuota),
+			name, "listener_quota",
+		)
+		m <- prometheus.MustNewConstMetric(
+			prometheus.NewDesc(metricPrefix+"listener_rejected_total", "", []string{"listener", "reason"}, nil),
+			prometheus.CounterValue,
+			float64(l.RejectedIPQuota),
+			name, "ip_quota",
+		)
+		m <- prometheus.MustNewConstMetric(
+			prometheus.NewDesc(metricPrefix+"listener_rejected_total", "", []string{"listener", "reason"}, nil),
+			prometheus.CounterValue,
+			float64(l.RejectedOverload),
+			name, "overload",
+		)
+	}
+}
@@ -0,0 +1,317 @@
+// Package tenancy isolates the topic namespaces of the tenants sharing the broker.
+// The tenant of each client is resolved on connecting, and is transparently prefixed onto the topics
+// of the publishes, subscriptions, unsubscriptions and will messages of the client, so the tenants can not see
+// the topics of each other. The prefix is stripped from the topics of the messages delivered to the client.
+package tenancy
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"go.uber.org/zap"
+
+	"github.com/DrmagicE/gmqtt"
+	"github.com/DrmagicE/gmqtt/pkg/packets"
+)
+
+const name = "tenancy"
+
+// AttributeTenant is the key of the tenant in the attributes of the client session, see gmqtt.ClientSession.
+const AttributeTenant = "tenant"
+
+// delayedTopicPrefix is the topic prefix of the delayed publishes: $delayed/<seconds>/<topic>,
+// the tenant prefix is inserted after it.
+const delayedTopicPrefix = "$delayed/"
+
+var log *zap.Logger
+
+// Resolver returns the tenant of the client, the empty tenant means the client does not belong to any tenant.
+type Resolver func(client gmqtt.Client) string
+
+// ByUsername resolves the tenant by the part of the username before the separator,
+// e.g: "acme" of "acme:alice" with the separator ":". The whole username is the tenant if sep is empty.
+// The client whose username does not contain the separator does not belong to any tenant.
+func ByUsername(sep string) Resolver {
+	return func(client gmqtt.Client) string {
+		username := client.OptionsReader().Username()
+		if sep == "" {
+			return username
+		}
+		if i := strings.Index(username, sep); i > 0 {
+			return username[:i]
+		}
+		return ""
+	}
+}
+
+// ByCertOrganization resolves the tenant by the first organization of the TLS client certificate.
+func ByCertOrganization() Resolver {
+	return func(client gmqtt.Client) string {
+		certs := client.OptionsReader().PeerCertificates()
+		if len(certs) == 0 || len(certs[0].Subject.Organization) == 0 {
+			return ""
+		}
+		return certs[0].Subject.Organization[0]
+	}
+}
+
+// ByListener resolves the tenant by the local address of the connection, which is the address of the listener.
+// The keys of the tenants are the addresses, e.g: "10.0.0.1:1883", or the ports such as ":1883" which match any host.
+func ByListener(tenants map[string]string) Resolver {
+	return func(client gmqtt.Client) string {
+		addr := client.OptionsReader().LocalAddr()
+		if addr == nil {
+			return ""
+		}
+		if t, ok := tenants[addr.String()]; ok {
+			return t
+		}
+		if _, port, err := net.SplitHostPort(addr.String()); err == nil {
+			return tenants[":"+port]
+		}
+		return ""
+	}
+}
+
+// ByListenerProfile resolves the tenant by gmqtt.ListenerProfile.Tenant of the listener which accepted the connection.
+func ByListenerProfile() Resolver {
+	return func(client gmqtt.Client) string {
+		if profile := client.OptionsReader().ListenerProfile(); profile != nil {
+			return profile.Tenant
+		}
+		return ""
+	}
+}
+
+// validTenant returns whether the tenant can be used as the first level of the topics.
+func validTenant(tenant string) bool {
+	return tenant != "" && !strings.HasPrefix(tenant, "$") && !strings.ContainsAny(tenant, "/+#")
+}
+
+// Stats is the statistics of a tenant.
+type Stats struct {
+	// Connections is the number of the online clients of the tenant.
+	Connections int64 `json:"connections"`
+	// MessagesReceived is the number of the messages published by the clients of the tenant.
+	MessagesReceived uint64 `json:"messages_received"`
+	// MessagesDelivered is the number of the messages delivered to the clients of the tenant.
+	MessagesDelivered uint64 `json:"messages_delivered"`
+}
+
+type tenantStats struct {
+	connections int64
+	received    uint64
+	delivered   uint64
+}
+
+// Option is the option of the Tenancy.
+type Option func(t *Tenancy)
+
+// WithRequired rejects the clients which do not belong to any tenant with CodeNotAuthorized.
+// By default, these clients, such as the backend services, access the topics without the prefix,
+// so they can access the namespaces of all tenants.
+func WithRequired() Option {
+	return func(t *Tenancy) {
+		t.required = true
+	}
+}
+
+// Tenancy is the plugin which isolates the topic namespaces of the tenants.
+// The tenant is the first level of the topics in the broker, e.g: the client of the "acme" tenant publishing
+// to "sensor/1" is stored and routed as "acme/sensor/1", and subscribing to "sensor/#" subscribes "acme/sensor/#".
+// The retained messages are isolated as well, since they are stored by the prefixed topics.
+type Tenancy struct {
+	resolver Resolver
+	required bool
+
+	mu    sync.Mutex
+	stats map[string]*tenantStats
+	// online is the tenants of the online clients.
+	online map[gmqtt.Client]string
+}
+
+// New returns the Tenancy plugin which resolves the tenants of the clients by the resolver.
+func New(resolver Resolver, opts ...Option) *Tenancy {
+	t := &Tenancy{
+		resolver: resolver,
+		stats:    make(map[string]*tenantStats),
+		online:   make(map[gmqtt.Client]string),
+	}
+	for _, fn := range opts {
+		fn(t)
+	}
+	return t
+}
+
+func (t *Tenancy) Load(service gmqtt.Server) error {
+	log = gmqtt.Logger("plugin/" + name)
+	return nil
+}
+
+func (t *Tenancy) Unload() error {
+	return nil
+}
+
+func (t *Tenancy) HookWrapper() gmqtt.HookWrapper {
+	return gmqtt.HookWrapper{
+		OnConnectWrapper:        t.OnConnectWrapper,
+		OnConnectedWrapper:      t.OnConnectedWrapper,
+		OnCloseWrapper:          t.OnCloseWrapper,
+		OnMsgArrivedWrapper:     t.OnMsgArrivedWrapper,
+		OnDeliverWrapper:        t.OnDeliverWrapper,
+		OnTopicRewriteWrapper:   t.OnTopicRewriteWrapper,
+		OnDeliverRewriteWrapper: t.OnDeliverRewriteWrapper,
+		OnWillPublishWrapper:    t.OnWillPublishWrapper,
+	}
+}
+
+func (t *Tenancy) Name() string {
+	return name
+}
+
+// Tenant returns the tenant of the client, the empty tenant means the client does not belong to any tenant.
+func Tenant(client gmqtt.Client) string {
+	tenant, _ := client.Session().Get(AttributeTenant)
+	return tenant
+}
+
+// Stats returns the statistics of the tenants, key by tenant.
+func (t *Tenancy) Stats() map[string]Stats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	rs := make(map[string]Stats, len(t.stats))
+	for k, v := range t.stats {
+		rs[k] = Stats{
+			Connections:       atomic.LoadInt64(&v.connections),
+			MessagesReceived:  atomic.LoadUint64(&v.received),
+			MessagesDelivered: atomic.LoadUint64(&v.delivered),
+		}
+	}
+	return rs
+}
+
+// tenantStats returns the statistics of the tenant, it creates the statistics if not exist.
+func (t *Tenancy) tenantStats(tenant string) *tenantStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s, ok := t.stats[tenant]
+	if !ok {
+		s = &tenantStats{}
+		t.stats[tenant] = s
+	}
+	return s
+}
+
+// prefix returns the topic in the namespace of the tenant.
+func prefix(tenant string, topic string) string {
+	if strings.HasPrefix(topic, delayedTopicPrefix) {
+		rest := strings.TrimPrefix(topic, delayedTopicPrefix)
+		if i := strings.IndexByte(rest, '/'); i >= 0 {
+			return delayedTopicPrefix + rest[:i+1] + tenant + "/" + rest[i+1:]
+		}
+	}
+	return tenant + "/" + topic
+}
+
+// OnConnectWrapper resolves the tenant of the client after the client is authenticated by the next wrapper.
+func (t *Tenancy) OnConnectWrapper(connect gmqtt.OnConnect) gmqtt.OnConnect {
+	return func(ctx context.Context, client gmqtt.Client) (code uint8) {
+		code = connect(ctx, client)
+		if code != packets.CodeAccepted {
+			return code
+		}
+		tenant := t.resolver(client)
+		if tenant == "" {
+			if t.required {
+				log.Warn("client without tenant rejected", zap.String("client_id", client.OptionsReader().ClientID()))
+				return packets.CodeNotAuthorized
+			}
+			return code
+		}
+		if !validTenant(tenant) {
+			log.Warn("invalid tenant rejected",
+				zap.String("client_id", client.OptionsReader().ClientID()), zap.String("tenant", tenant))
+			return packets.CodeNotAuthorized
+		}
+		client.Session().Set(AttributeTenant, tenant)
+		return code
+	}
+}
+
+func (t *Tenancy) OnConnectedWrapper(connected gmqtt.OnConnected) gmqtt.OnConnected {
+	return func(ctx context.Context, client gmqtt.Client) {
+		if tenant := Tenant(client); tenant != "" {
+			atomic.AddInt64(&t.tenantStats(tenant).connections, 1)
+			t.mu.Lock()
+			t.online[client] = tenant
+			t.mu.Unlock()
+		}
+		connected(ctx, client)
+	}
+}
+
+func (t *Tenancy) OnCloseWrapper(close gmqtt.OnClose) gmqtt.OnClose {
+	return func(ctx context.Context, client gmqtt.Client, err error) {
+		t.mu.Lock()
+		tenant, ok := t.online[client]
+		delete(t.online, client)
+		t.mu.Unlock()
+		if ok {
+			atomic.AddInt64(&t.tenantStats(tenant).connections, -1)
+		}
+		close(ctx, client, err)
+	}
+}
+
+func (t *Tenancy) OnMsgArrivedWrapper(arrived gmqtt.OnMsgArrived) gmqtt.OnMsgArrived {
+	return func(ctx context.Context, client gmqtt.Client, msg packets.Message) (valid bool) {
+		if tenant := Tenant(client); tenant != "" {
+			atomic.AddUint64(&t.tenantStats(tenant).received, 1)
+		}
+		return arrived(ctx, client, msg)
+	}
+}
+
+func (t *Tenancy) OnDeliverWrapper(deliver gmqtt.OnDeliver) gmqtt.OnDeliver {
+	return func(ctx context.Context, client gmqtt.Client, msg packets.Message) {
+		if tenant := Tenant(client); tenant != "" {
+			atomic.AddUint64(&t.tenantStats(tenant).delivered, 1)
+		}
+		deliver(ctx, client, msg)
+	}
+}
+
+// OnTopicRewriteWrapper prefixes the tenant onto the topic rewritten by the next wrapper,
+// so the ACL checks are applied to the prefixed topics.
+func (t *Tenancy) OnTopicRewriteWrapper(rewrite gmqtt.OnTopicRewrite) gmqtt.OnTopicRewrite {
+	return func(ctx context.Context, client gmqtt.Client, action gmqtt.TopicRewriteAction, topic string) string {
+		topic = rewrite(ctx, client, action, topic)
+		if tenant := Tenant(client); tenant != "" {
+			return prefix(tenant, topic)
+		}
+		return topic
+	}
+}
+
+// OnDeliverRewriteWrapper strips the tenant prefix from the topic of the message delivered to the client.
+func (t *Tenancy) OnDeliverRewriteWrapper(rewrite gmqtt.OnDeliverRewrite) gmqtt.OnDeliverRewrite {
+	return func(ctx context.Context, client gmqtt.Client, topicName string) string {
+		if tenant := Tenant(client); tenant != "" && strings.HasPrefix(topicName, tenant+"/") {
+			topicName = topicName[len(tenant)+1:]
+		}
+		return rewrite(ctx, client, topicName)
+	}
+}
+
+// OnWillPublishWrapper prefixes the tenant onto the topic of the will message.
+func (t *Tenancy) OnWillPublishWrapper(publish gmqtt.OnWillPublish) gmqtt.OnWillPublish {
+	return func(ctx context.Context, client gmqtt.Client, msg packets.Message) packets.Message {
+		if tenant := Tenant(client); tenant != "" {
+			msg = gmqtt.NewMessage(prefix(tenant, msg.Topic()), msg.Payload(), msg.Qos(), gmqtt.Retained(msg.Retained()))
+		}
+		return publish(ctx, client, msg)
+	}
+}
@@ -0,0 +1,220 @@
+package tenancy
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+
+	"github.com/DrmagicE/gmqtt"
+	"github.com/DrmagicE/gmqtt/internal/testutil"
+	"github.com/DrmagicE/gmqtt/pkg/packets"
+)
+
+func init() {
+	log = zap.NewNop()
+}
+
+// testSession is the fake gmqtt.ClientSession backed by a map.
+type testSession map[string]string
+
+func (s testSession) Get(key string) (string, bool) {
+	v, ok := s[key]
+	return v, ok
+}
+func (s testSession) Set(key string, value string) { s[key] = value }
+func (s testSession) Delete(key string)            { delete(s, key) }
+func (s testSession) All() map[string]string {
+	rs := make(map[string]string, len(s))
+	for k, v := range s {
+		rs[k] = v
+	}
+	return rs
+}
+
+type testClient struct {
+	*testutil.Client
+	session testSession
+}
+
+func (c *testClient) Session() gmqtt.ClientSession { return c.session }
+
+func newTestClient(clientID, username string) *testClient {
+	return &testClient{Client: testutil.NewClient(clientID, username), session: make(testSession)}
+}
+
+// newTenantClient returns the client which belongs to the tenant.
+func newTenantClient(clientID, tenant string) *testClient {
+	c := newTestClient(clientID, "")
+	c.session.Set(AttributeTenant, tenant)
+	return c
+}
+
+func accept(ctx context.Context, client gmqtt.Client) uint8 {
+	return packets.CodeAccepted
+}
+
+func TestPrefix(t *testing.T) {
+	a := assert.New(t)
+	a.Equal("acme/a/b", prefix("acme", "a/b"))
+	a.Equal("acme/$SYS/a", prefix("acme", "$SYS/a"))
+	// the tenant is inserted after the delay of the delayed publishes.
+	a.Equal("$delayed/10/acme/a/b", prefix("acme", "$delayed/10/a/b"))
+	a.Equal("acme/$delayed/10", prefix("acme", "$delayed/10"))
+}
+
+func TestTenancy_OnTopicRewriteWrapper(t *testing.T) {
+	a := assert.New(t)
+	tn := New(ByUsername(":"))
+	fn := tn.OnTopicRewriteWrapper(func(ctx context.Context, client gmqtt.Client, action gmqtt.TopicRewriteAction, topic string) string {
+		return topic
+	})
+	a.Equal("acme/a/#", fn(context.Background(), newTenantClient("id0", "acme"), gmqtt.RewriteSubscribe, "a/#"))
+	a.Equal("$delayed/5/acme/a", fn(context.Background(), newTenantClient("id0", "acme"), gmqtt.RewritePublish, "$delayed/5/a"))
+	a.Equal("a/#", fn(context.Background(), newTestClient("id1", ""), gmqtt.RewriteSubscribe, "a/#"))
+}
+
+func TestTenancy_OnDeliverRewriteWrapper(t *testing.T) {
+	a := assert.New(t)
+	tn := New(ByUsername(":"))
+	fn := tn.OnDeliverRewriteWrapper(func(ctx context.Context, client gmqtt.Client, topicName string) string {
+		return topicName
+	})
+	c := newTenantClient("id0", "acme")
+	a.Equal("a/b", fn(context.Background(), c, "acme/a/b"))
+	// only the prefix of the tenant is stripped.
+	a.Equal("acmex/a", fn(context.Background(), c, "acmex/a"))
+	a.Equal("other/a", fn(context.Background(), c, "other/a"))
+	a.Equal("acme/a/b", fn(context.Background(), newTestClient("id1", ""), "acme/a/b"))
+}
+
+func TestTenancy_OnConnectWrapper(t *testing.T) {
+	a := assert.New(t)
+	var tenant string
+	tn := New(func(client gmqtt.Client) string {
+		return tenant
+	})
+	fn := tn.OnConnectWrapper(accept)
+
+	tenant = "acme"
+	c := newTestClient("id0", "")
+	a.EqualValues(packets.CodeAccepted, fn(context.Background(), c))
+	a.Equal("acme", Tenant(c))
+
+	for _, v := range []string{"$acme", "a/b", "a+", "a#"} {
+		tenant = v
+		c := newTestClient("id0", "")
+		a.EqualValues(packets.CodeNotAuthorized, fn(context.Background(), c), v)
+		a.Equal("", Tenant(c), v)
+	}
+
+	// the client without tenant is allowed by default.
+	tenant = ""
+	c = newTestClient("id0", "")
+	a.EqualValues(packets.CodeAccepted, fn(context.Background(), c))
+	a.Equal("", Tenant(c))
+
+	// the client rejected by the next wrapper is not resolved.
+	tenant = "acme"
+	c = newTestClient("id0", "")
+	a.EqualValues(packets.CodeBadUsernameorPsw, tn.OnConnectWrapper(func(ctx context.Context, client gmqtt.Client) uint8 {
+		return packets.CodeBadUsernameorPsw
+	})(context.Background(), c))
+	a.Equal("", Tenant(c))
+}
+
+func TestTenancy_WithRequired(t *testing.T) {
+	a := assert.New(t)
+	fn := New(ByUsername(":"), WithRequired()).OnConnectWrapper(accept)
+	c := newTestClient("id0", "alice")
+	a.EqualValues(packets.CodeNotAuthorized, fn(context.Background(), c))
+	a.Equal("", Tenant(c))
+
+	c = newTestClient("id0", "acme:alice")
+	a.EqualValues(packets.CodeAccepted, fn(context.Background(), c))
+	a.Equal("acme", Tenant(c))
+}
+
+func TestByUsername(t *testing.T) {
+	a := assert.New(t)
+	r := ByUsername(":")
+	a.Equal("acme", r(newTestClient("id0", "acme:alice")))
+	a.Equal("acme", r(newTestClient("id0", "acme:alice:bob")))
+	a.Equal("", r(newTestClient("id0", "alice")))
+	a.Equal("", r(newTestClient("id0", ":alice")))
+
+	r = ByUsername("")
+	a.Equal("acme:alice", r(newTestClient("id0", "acme:alice")))
+	a.Equal("", r(newTestClient("id0", "")))
+}
+
+func TestByListener(t *testing.T) {
+	a := assert.New(t)
+	r := ByListener(map[string]string{
+		"10.0.0.1:1883": "a",
+		":1883":         "b",
+		":8883":         "c",
+	})
+	client := func(addr net.Addr) gmqtt.Client {
+		c := newTestClient("id0", "")
+		c.Opts.Local = addr
+		return c
+	}
+	a.Equal("a", r(client(&net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 1883})))
+	a.Equal("b", r(client(&net.TCPAddr{IP: net.IPv4(10, 0, 0, 2), Port: 1883})))
+	a.Equal("c", r(client(&net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 8883})))
+	a.Equal("", r(client(&net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 1884})))
+	a.Equal("", r(client(nil)))
+}
+
+func TestByListenerProfile(t *testing.T) {
+	a := assert.New(t)
+	r := ByListenerProfile()
+	c := newTestClient("id0", "")
+	a.Equal("", r(c))
+	c.Opts.Profile = &gmqtt.ListenerProfile{Tenant: "acme"}
+	a.Equal("acme", r(c))
+}
+
+func TestTenancy_OnWillPublishWrapper(t *testing.T) {
+	a := assert.New(t)
+	fn := New(ByUsername(":")).OnWillPublishWrapper(func(ctx context.Context, client gmqtt.Client, msg packets.Message) packets.Message {
+		return msg
+	})
+	msg := gmqtt.NewMessage("will/id0", []byte("offline"), packets.QOS_1, gmqtt.Retained(true))
+
+	rs := fn(context.Background(), newTenantClient("id0", "acme"), msg)
+	a.Equal("acme/will/id0", rs.Topic())
+	a.Equal([]byte("offline"), rs.Payload())
+	a.EqualValues(packets.QOS_1, rs.Qos())
+	a.True(rs.Retained())
+
+	rs = fn(context.Background(), newTestClient("id1", ""), msg)
+	a.Equal("will/id0", rs.Topic())
+}
+
+func TestTenancy_Connections(t *testing.T) {
+	a := assert.New(t)
+	tn := New(ByUsername(":"))
+	connected := tn.OnConnectedWrapper(func(ctx context.Context, client gmqtt.Client) {})
+	closed := tn.OnCloseWrapper(func(ctx context.Context, client gmqtt.Client, err error) {})
+
+	c0, c1, c2 := newTenantClient("id0", "acme"), newTenantClient("id1", "acme"), newTestClient("id2", "")
+	for _, c := range []gmqtt.Client{c0, c1, c2} {
+		connected(context.Background(), c)
+	}
+	a.Equal(map[string]Stats{"acme": {Connections: 2}}, tn.Stats())
+
+	closed(context.Background(), c0, nil)
+	a.Equal(map[string]Stats{"acme": {Connections: 1}}, tn.Stats())
+	// closing the client twice or closing the client without tenant does not change the count.
+	closed(context.Background(), c0, nil)
+	closed(context.Background(), c2, nil)
+	a.Equal(map[string]Stats{"acme": {Connections: 1}}, tn.Stats())
+
+	closed(context.Background(), c1, nil)
+	a.Equal(map[string]Stats{"acme": {Connections: 0}}, tn.Stats())
+	a.Empty(tn.online)
+}
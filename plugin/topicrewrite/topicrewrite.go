@@ -0,0 +1,253 @@
+// Package topicrewrite rewrites the topics of the publishes and subscriptions by the ordered regex rules,
+// the rules can be loaded from a JSON file or set by the API.
+package topicrewrite
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strings"
+	"sync"
+
+	"go.uber.org/zap"
+
+	"github.com/DrmagicE/gmqtt"
+	"github.com/DrmagicE/gmqtt/pkg/packets"
+)
+
+const name = "topicrewrite"
+
+var log *zap.Logger
+
+// Action is the action which the rule applies to.
+type Action string
+
+const (
+	Publish   Action = "publish"
+	Subscribe Action = "subscribe"
+	// All applies to both publish and subscribe.
+	All Action = "all"
+)
+
+const (
+	placeholderClientID = "%c"
+	placeholderUsername = "%u"
+)
+
+// destPattern matches the capture groups and the placeholders in the dest topic,
+// which are replaced in one pass so the replaced values are not expanded again.
+var destPattern = regexp.MustCompile(`\$[1-9]|%[cu]`)
+
+// Rule is the topic rewrite rule.
+type Rule struct {
+	Action Action `json:"action"`
+	// SourceTopic is the topic filter which the topic must match.
+	SourceTopic string `json:"source_topic"`
+	// Regex is matched against the topic, the rule is not applied if the topic does not match.
+	Regex string `json:"regex"`
+	// DestTopic is the rewritten topic, which can contain the capture groups $1 to $9 of Regex
+	// and the placeholders %c (client id) and %u (username).
+	DestTopic string `json:"dest_topic"`
+
+	re *regexp.Regexp
+}
+
+// Validate returns the error if the rule is invalid, it compiles the regex of the rule.
+func (r *Rule) Validate() error {
+	if r.Action != Publish && r.Action != Subscribe && r.Action != All {
+		return fmt.Errorf("invalid action: %q", r.Action)
+	}
+	if !packets.ValidTopicFilter([]byte(r.SourceTopic)) {
+		return fmt.Errorf("invalid source topic: %q", r.SourceTopic)
+	}
+	if r.DestTopic == "" {
+		return errors.New("empty dest topic")
+	}
+	re, err := regexp.Compile(r.Regex)
+	if err != nil {
+		return fmt.Errorf("invalid regex: %s", err)
+	}
+	r.re = re
+	return nil
+}
+
+func (r *Rule) matchAction(action gmqtt.TopicRewriteAction) bool {
+	switch r.Action {
+	case Publish:
+		return action == gmqtt.RewritePublish
+	case Subscribe:
+		return action == gmqtt.RewriteSubscribe
+	}
+	return true
+}
+
+// rewrite returns the rewritten topic and whether the rule is applied.
+// The rule is not applied if the value of a placeholder in the dest topic is empty or contains
+// the separator or wildcards, otherwise a client id such as "+" would widen the rewritten topic filter.
+func (r *Rule) rewrite(clientID, username, topic string) (string, bool) {
+	if !packets.TopicMatch([]byte(topic), []byte(r.SourceTopic)) && topic != r.SourceTopic {
+		return "", false
+	}
+	groups := r.re.FindStringSubmatch(topic)
+	if groups == nil {
+		return "", false
+	}
+	ok := true
+	dest := destPattern.ReplaceAllStringFunc(r.DestTopic, func(s string) string {
+		var value string
+		switch s {
+		case placeholderClientID:
+			value = clientID
+		case placeholderUsername:
+			value = username
+		default:
+			if i := int(s[1] - '0'); i < len(groups) {
+				return groups[i]
+			}
+			return s
+		}
+		if value == "" || strings.ContainsAny(value, "/+#") {
+			ok = false
+		}
+		return value
+	})
+	if !ok {
+		return "", false
+	}
+	return dest, true
+}
+
+// Option is the option of the TopicRewrite.
+type Option func(t *TopicRewrite)
+
+// WithFile sets the JSON file which the rules are loaded from on loading, see Reload.
+func WithFile(path string) Option {
+	return func(t *TopicRewrite) {
+		t.file = path
+	}
+}
+
+// WithRules sets the initial rules.
+func WithRules(rules ...Rule) Option {
+	return func(t *TopicRewrite) {
+		t.rules = rules
+	}
+}
+
+// file is the format of the rule file.
+type file struct {
+	Rules []Rule `json:"rules"`
+}
+
+// TopicRewrite is the plugin which rewrites the topics of the publishes and subscriptions.
+// The rules are evaluated in order, the first applied rule decides the rewritten topic.
+type TopicRewrite struct {
+	file string
+
+	mu    sync.RWMutex
+	rules []Rule
+}
+
+// New returns the TopicRewrite plugin.
+func New(opts ...Option) *TopicRewrite {
+	t := &TopicRewrite{}
+	for _, fn := range opts {
+		fn(t)
+	}
+	return t
+}
+
+func (t *TopicRewrite) Load(service gmqtt.Server) error {
+	log = gmqtt.Logger("plugin/" + name)
+	if t.file != "" {
+		return t.Reload()
+	}
+	return t.SetRules(t.rules)
+}
+
+func (t *TopicRewrite) Unload() error {
+	return nil
+}
+
+func (t *TopicRewrite) HookWrapper() gmqtt.HookWrapper {
+	return gmqtt.HookWrapper{
+		OnTopicRewriteWrapper: t.OnTopicRewriteWrapper,
+	}
+}
+
+func (t *TopicRewrite) Name() string {
+	return name
+}
+
+// Reload reloads the rules from the file.
+func (t *TopicRewrite) Reload() error {
+	b, err := ioutil.ReadFile(t.file)
+	if err != nil {
+		return err
+	}
+	var f file
+	if err := json.Unmarshal(b, &f); err != nil {
+		return err
+	}
+	return t.SetRules(f.Rules)
+}
+
+// SetRules validates and replaces the rules, the rules are not changed if any rule is invalid.
+func (t *TopicRewrite) SetRules(rules []Rule) error {
+	rs := make([]Rule, len(rules))
+	copy(rs, rules)
+	for i := range rs {
+		if err := rs[i].Validate(); err != nil {
+			return fmt.Errorf("rule %d: %s", i, err)
+		}
+	}
+	t.mu.Lock()
+	t.rules = rs
+	t.mu.Unlock()
+	return nil
+}
+
+// Rules returns the current rules.
+func (t *TopicRewrite) Rules() []Rule {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	rs := make([]Rule, len(t.rules))
+	copy(rs, t.rules)
+	return rs
+}
+
+// Rewrite returns the topic rewritten by the first applied rule, the topic is returned unchanged if no rule is applied.
+func (t *TopicRewrite) Rewrite(clientID, username string, action gmqtt.TopicRewriteAction, topic string) string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	for i := range t.rules {
+		r := &t.rules[i]
+		if !r.matchAction(action) {
+			continue
+		}
+		if dest, ok := r.rewrite(clientID, username, topic); ok {
+			return dest
+		}
+	}
+	return topic
+}
+
+// OnTopicRewriteWrapper rewrites the topic by the rules before passing it to the next wrapper.
+func (t *TopicRewrite) OnTopicRewriteWrapper(rewrite gmqtt.OnTopicRewrite) gmqtt.OnTopicRewrite {
+	return func(ctx context.Context, client gmqtt.Client, action gmqtt.TopicRewriteAction, topic string) string {
+		opts := client.OptionsReader()
+		dest := t.Rewrite(opts.ClientID(), opts.Username(), action, topic)
+		if dest != topic {
+			log.Debug("topic rewritten",
+				zap.String("client_id", opts.ClientID()),
+				zap.String("action", action.String()),
+				zap.String("topic", topic),
+				zap.String("dest", dest),
+			)
+		}
+		return rewrite(ctx, client, action, dest)
+	}
+}
@@ -0,0 +1,136 @@
+package topicrewrite
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+
+	"github.com/DrmagicE/gmqtt"
+	"github.com/DrmagicE/gmqtt/internal/testutil"
+)
+
+func init() {
+	log = zap.NewNop()
+}
+
+func newTopicRewrite(t *testing.T, rules ...Rule) *TopicRewrite {
+	tr := New()
+	if err := tr.SetRules(rules); err != nil {
+		t.Fatal(err)
+	}
+	return tr
+}
+
+func TestTopicRewrite_Action(t *testing.T) {
+	a := assert.New(t)
+	tr := newTopicRewrite(t,
+		Rule{Action: Publish, SourceTopic: "pub/#", Regex: "^pub/(.+)$", DestTopic: "p/$1"},
+		Rule{Action: Subscribe, SourceTopic: "sub/#", Regex: "^sub/(.+)$", DestTopic: "s/$1"},
+		Rule{Action: All, SourceTopic: "all/#", Regex: "^all/(.+)$", DestTopic: "a/$1"},
+	)
+	a.Equal("p/a", tr.Rewrite("id", "user", gmqtt.RewritePublish, "pub/a"))
+	a.Equal("pub/a", tr.Rewrite("id", "user", gmqtt.RewriteSubscribe, "pub/a"))
+	a.Equal("s/a", tr.Rewrite("id", "user", gmqtt.RewriteSubscribe, "sub/a"))
+	a.Equal("sub/a", tr.Rewrite("id", "user", gmqtt.RewritePublish, "sub/a"))
+	a.Equal("a/a", tr.Rewrite("id", "user", gmqtt.RewritePublish, "all/a"))
+	a.Equal("a/a", tr.Rewrite("id", "user", gmqtt.RewriteSubscribe, "all/a"))
+	a.Equal("other/a", tr.Rewrite("id", "user", gmqtt.RewritePublish, "other/a"))
+}
+
+func TestTopicRewrite_Groups(t *testing.T) {
+	a := assert.New(t)
+	tr := newTopicRewrite(t,
+		Rule{
+			Action:      All,
+			SourceTopic: "x/#",
+			Regex:       "^x/(a)/(b)/(c)/(d)/(e)/(f)/(g)/(h)/(i)$",
+			DestTopic:   "$9/$8/$7/$6/$5/$4/$3/$2/$1",
+		},
+		// $2 is out of the groups and kept literally.
+		Rule{Action: All, SourceTopic: "y/+", Regex: "^y/(.+)$", DestTopic: "z/$1/$2"},
+		// the replaced group is not expanded again.
+		Rule{Action: All, SourceTopic: "v/+", Regex: "^v/(.+)$", DestTopic: "w/$1/%c"},
+		// the topic does not match the regex.
+		Rule{Action: All, SourceTopic: "n/+", Regex: "^n/[0-9]+$", DestTopic: "number"},
+	)
+	a.Equal("i/h/g/f/e/d/c/b/a", tr.Rewrite("id", "user", gmqtt.RewritePublish, "x/a/b/c/d/e/f/g/h/i"))
+	a.Equal("z/a/$2", tr.Rewrite("id", "user", gmqtt.RewritePublish, "y/a"))
+	a.Equal("w/%u/id", tr.Rewrite("id", "user", gmqtt.RewritePublish, "v/%u"))
+	a.Equal("number", tr.Rewrite("id", "user", gmqtt.RewritePublish, "n/1"))
+	a.Equal("n/a", tr.Rewrite("id", "user", gmqtt.RewritePublish, "n/a"))
+}
+
+func TestTopicRewrite_Placeholder(t *testing.T) {
+	a := assert.New(t)
+	tr := newTopicRewrite(t,
+		Rule{Action: Subscribe, SourceTopic: "own/#", Regex: "^own/(.+)$", DestTopic: "client/%c/user/%u/$1"},
+	)
+	a.Equal("client/id/user/user/a", tr.Rewrite("id", "user", gmqtt.RewriteSubscribe, "own/a"))
+
+	for _, v := range []struct {
+		clientID, username string
+	}{
+		{clientID: "+", username: "user"},
+		{clientID: "#", username: "user"},
+		{clientID: "a/b", username: "user"},
+		{clientID: "", username: "user"},
+		{clientID: "id", username: "+"},
+		{clientID: "id", username: ""},
+	} {
+		a.Equal("own/a", tr.Rewrite(v.clientID, v.username, gmqtt.RewriteSubscribe, "own/a"), v)
+	}
+
+	// the rule is skipped, the next rule is applied.
+	tr = newTopicRewrite(t,
+		Rule{Action: All, SourceTopic: "own/#", Regex: "^own/(.+)$", DestTopic: "client/%c/$1"},
+		Rule{Action: All, SourceTopic: "own/#", Regex: "^own/(.+)$", DestTopic: "anonymous/$1"},
+	)
+	a.Equal("client/id/a", tr.Rewrite("id", "", gmqtt.RewritePublish, "own/a"))
+	a.Equal("anonymous/a", tr.Rewrite("#", "", gmqtt.RewritePublish, "own/a"))
+}
+
+func TestTopicRewrite_FirstMatch(t *testing.T) {
+	a := assert.New(t)
+	tr := newTopicRewrite(t,
+		Rule{Action: All, SourceTopic: "a/b", Regex: "^a/b$", DestTopic: "first"},
+		Rule{Action: All, SourceTopic: "a/+", Regex: "^a/(.+)$", DestTopic: "second/$1"},
+		Rule{Action: All, SourceTopic: "#", Regex: ".*", DestTopic: "third"},
+	)
+	a.Equal("first", tr.Rewrite("id", "user", gmqtt.RewritePublish, "a/b"))
+	a.Equal("second/c", tr.Rewrite("id", "user", gmqtt.RewritePublish, "a/c"))
+	a.Equal("third", tr.Rewrite("id", "user", gmqtt.RewritePublish, "b"))
+}
+
+func TestTopicRewrite_SetRules(t *testing.T) {
+	a := assert.New(t)
+	valid := Rule{Action: All, SourceTopic: "a/+", Regex: "^a/(.+)$", DestTopic: "b/$1"}
+	tr := newTopicRewrite(t, valid)
+
+	for _, v := range []Rule{
+		{Action: "unknown", SourceTopic: "a/+", Regex: ".*", DestTopic: "b"},
+		{Action: All, SourceTopic: "a/#/b", Regex: ".*", DestTopic: "b"},
+		{Action: All, SourceTopic: "a/+", Regex: ".*", DestTopic: ""},
+		{Action: All, SourceTopic: "a/+", Regex: "(", DestTopic: "b"},
+	} {
+		a.Error(tr.SetRules([]Rule{valid, v}), v)
+		// the invalid rules do not replace the current rules.
+		a.Len(tr.Rules(), 1)
+		a.Equal("b/c", tr.Rewrite("id", "user", gmqtt.RewritePublish, "a/c"))
+	}
+}
+
+func TestTopicRewrite_OnTopicRewriteWrapper(t *testing.T) {
+	a := assert.New(t)
+	tr := newTopicRewrite(t,
+		Rule{Action: Publish, SourceTopic: "own/#", Regex: "^own/(.+)$", DestTopic: "user/%u/$1"},
+	)
+	var got string
+	fn := tr.OnTopicRewriteWrapper(func(ctx context.Context, client gmqtt.Client, action gmqtt.TopicRewriteAction, topic string) string {
+		got = topic
+		return topic
+	})
+	a.Equal("user/user/a", fn(context.Background(), testutil.NewClient("id", "user"), gmqtt.RewritePublish, "own/a"))
+	a.Equal("user/user/a", got)
+}
@@ -0,0 +1,387 @@
+// Package webhook posts the client lifecycle and message events to the HTTP endpoints in JSON,
+// which integrates gmqtt with external systems without writing a Go plugin.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/DrmagicE/gmqtt"
+	"github.com/DrmagicE/gmqtt/pkg/packets"
+)
+
+const name = "webhook"
+
+var log *zap.Logger
+
+// EventType is the type of the event.
+type EventType string
+
+const (
+	ClientConnected     EventType = "client.connected"
+	ClientDisconnected  EventType = "client.disconnected"
+	SessionSubscribed   EventType = "session.subscribed"
+	SessionUnsubscribed EventType = "session.unsubscribed"
+	MessagePublished    EventType = "message.published"
+	MessageDelivered    EventType = "message.delivered"
+	MessageDropped      EventType = "message.dropped"
+)
+
+// SignatureHeader is the header which carries the HMAC-SHA256 signature of the request body,
+// in the form of "sha256=<hex encoded signature>". It is set only if the secret is set, see WithSecret.
+const SignatureHeader = "X-Gmqtt-Signature"
+
+const (
+	defaultBatchSize     = 100
+	defaultFlushInterval = time.Second
+	defaultMaxRetries    = 3
+	defaultRetryBackoff  = time.Second
+	defaultTimeout       = 5 * time.Second
+	// queueSize is the number of the buffered events of each endpoint,
+	// the events are dropped when the buffer is full.
+	queueSize = 10000
+)
+
+// Event is the JSON object posted to the endpoints, the request body is a JSON array of the events.
+type Event struct {
+	Type      EventType `json:"type"`
+	Timestamp int64     `json:"timestamp"` // unix milliseconds
+	ClientID  string    `json:"client_id"`
+	Username  string    `json:"username,omitempty"`
+	// RemoteAddr is set for the client.connected event.
+	RemoteAddr string `json:"remote_addr,omitempty"`
+	// Topic is the topic filter of the session events, or the topic name of the message events.
+	Topic    string `json:"topic,omitempty"`
+	Qos      uint8  `json:"qos"`
+	Payload  []byte `json:"payload,omitempty"` // base64 encoded
+	Retained bool   `json:"retained,omitempty"`
+	// Reason is the reason of the client.disconnected and message.dropped events.
+	Reason string `json:"reason,omitempty"`
+}
+
+// Option is the option of the WebHook.
+type Option func(w *WebHook)
+
+// WithEvents sets the types of the events to be posted, default to all types.
+func WithEvents(types ...EventType) Option {
+	return func(w *WebHook) {
+		w.events = make(map[EventType]bool)
+		for _, t := range types {
+			w.events[t] = true
+		}
+	}
+}
+
+// WithSecret sets the secret to sign the request body, see SignatureHeader.
+func WithSecret(secret string) Option {
+	return func(w *WebHook) {
+		w.secret = []byte(secret)
+	}
+}
+
+// WithBatch sets the maximum size and the flush interval of the batches, default to 100 events and 1 second.
+func WithBatch(size int, flushInterval time.Duration) Option {
+	return func(w *WebHook) {
+		w.batchSize = size
+		w.flushInterval = flushInterval
+	}
+}
+
+// WithRetry sets the maximum number of the retries of the failed requests and the backoff between the retries,
+// the backoff is doubled on each retry. Default to 3 retries with the backoff of 1 second.
+func WithRetry(maxRetries int, backoff time.Duration) Option {
+	return func(w *WebHook) {
+		w.maxRetries = maxRetries
+		w.retryBackoff = backoff
+	}
+}
+
+// WithHTTPClient sets the http client to post the events, default to a client with 5 seconds timeout.
+func WithHTTPClient(client *http.Client) Option {
+	return func(w *WebHook) {
+		w.client = client
+	}
+}
+
+// WebHook is the plugin which posts the events to the HTTP endpoints.
+type WebHook struct {
+	endpoints     []string
+	events        map[EventType]bool
+	secret        []byte
+	batchSize     int
+	flushInterval time.Duration
+	maxRetries    int
+	retryBackoff  time.Duration
+	client        *http.Client
+
+	queues []chan *Event
+	done   chan struct{}
+	wg     sync.WaitGroup
+}
+
+// New returns the WebHook plugin which posts the events to each of the endpoints.
+func New(endpoints []string, opts ...Option) *WebHook {
+	w := &WebHook{
+		endpoints:     endpoints,
+		batchSize:     defaultBatchSize,
+		flushInterval: defaultFlushInterval,
+		maxRetries:    defaultMaxRetries,
+		retryBackoff:  defaultRetryBackoff,
+		client:        &http.Client{Timeout: defaultTimeout},
+	}
+	for _, fn := range opts {
+		fn(w)
+	}
+	return w
+}
+
+func (w *WebHook) Load(service gmqtt.Server) error {
+	log = gmqtt.Logger("plugin/" + name)
+	w.done = make(chan struct{})
+	for _, endpoint := range w.endpoints {
+		q := make(chan *Event, queueSize)
+		w.queues = append(w.queues, q)
+		w.wg.Add(1)
+		go w.sendLoop(endpoint, q)
+	}
+	return nil
+}
+
+func (w *WebHook) Unload() error {
+	close(w.done)
+	w.wg.Wait()
+	return nil
+}
+
+func (w *WebHook) HookWrapper() gmqtt.HookWrapper {
+	return gmqtt.HookWrapper{
+		OnConnectedWrapper:    w.OnConnectedWrapper,
+		OnCloseWrapper:        w.OnCloseWrapper,
+		OnSubscribedWrapper:   w.OnSubscribedWrapper,
+		OnUnsubscribedWrapper: w.OnUnsubscribedWrapper,
+		OnMsgArrivedWrapper:   w.OnMsgArrivedWrapper,
+		OnDeliverWrapper:      w.OnDeliverWrapper,
+		OnMsgDroppedWrapper:   w.OnMsgDroppedWrapper,
+	}
+}
+
+func (w *WebHook) Name() string {
+	return name
+}
+
+// OnConnectedWrapper emits the client.connected event.
+func (w *WebHook) OnConnectedWrapper(connected gmqtt.OnConnected) gmqtt.OnConnected {
+	return func(ctx context.Context, client gmqtt.Client) {
+		if w.enabled(ClientConnected) {
+			ev := newEvent(ClientConnected, client)
+			if addr := client.OptionsReader().RemoteAddr(); addr != nil {
+				ev.RemoteAddr = addr.String()
+			}
+			w.emit(ev)
+		}
+		connected(ctx, client)
+	}
+}
+
+// OnCloseWrapper emits the client.disconnected event.
+func (w *WebHook) OnCloseWrapper(close gmqtt.OnClose) gmqtt.OnClose {
+	return func(ctx context.Context, client gmqtt.Client, err error) {
+		if w.enabled(ClientDisconnected) {
+			ev := newEvent(ClientDisconnected, client)
+			if err != nil {
+				ev.Reason = err.Error()
+			}
+			w.emit(ev)
+		}
+		close(ctx, client, err)
+	}
+}
+
+// OnSubscribedWrapper emits the session.subscribed event.
+func (w *WebHook) OnSubscribedWrapper(subscribed gmqtt.OnSubscribed) gmqtt.OnSubscribed {
+	return func(ctx context.Context, client gmqtt.Client, topic packets.Topic) {
+		if w.enabled(SessionSubscribed) {
+			ev := newEvent(SessionSubscribed, client)
+			ev.Topic = topic.Name
+			ev.Qos = topic.Qos
+			w.emit(ev)
+		}
+		subscribed(ctx, client, topic)
+	}
+}
+
+// OnUnsubscribedWrapper emits the session.unsubscribed event.
+func (w *WebHook) OnUnsubscribedWrapper(unsubscribed gmqtt.OnUnsubscribed) gmqtt.OnUnsubscribed {
+	return func(ctx context.Context, client gmqtt.Client, topicName string) {
+		if w.enabled(SessionUnsubscribed) {
+			ev := newEvent(SessionUnsubscribed, client)
+			ev.Topic = topicName
+			w.emit(ev)
+		}
+		unsubscribed(ctx, client, topicName)
+	}
+}
+
+// OnMsgArrivedWrapper emits the message.published event if the message is accepted by the next hooks.
+func (w *WebHook) OnMsgArrivedWrapper(arrived gmqtt.OnMsgArrived) gmqtt.OnMsgArrived {
+	return func(ctx context.Context, client gmqtt.Client, msg packets.Message) (valid bool) {
+		valid = arrived(ctx, client, msg)
+		if valid && w.enabled(MessagePublished) {
+			w.emit(newMessageEvent(MessagePublished, client, msg))
+		}
+		return valid
+	}
+}
+
+// OnDeliverWrapper emits the message.delivered event.
+func (w *WebHook) OnDeliverWrapper(deliver gmqtt.OnDeliver) gmqtt.OnDeliver {
+	return func(ctx context.Context, client gmqtt.Client, msg packets.Message) {
+		if w.enabled(MessageDelivered) {
+			w.emit(newMessageEvent(MessageDelivered, client, msg))
+		}
+		deliver(ctx, client, msg)
+	}
+}
+
+// OnMsgDroppedWrapper emits the message.dropped event.
+func (w *WebHook) OnMsgDroppedWrapper(dropped gmqtt.OnMsgDropped) gmqtt.OnMsgDropped {
+	return func(ctx context.Context, client gmqtt.Client, msg packets.Message, reason gmqtt.MsgDroppedReason) {
+		if w.enabled(MessageDropped) {
+			ev := newMessageEvent(MessageDropped, client, msg)
+			ev.Reason = reason.String()
+			w.emit(ev)
+		}
+		dropped(ctx, client, msg, reason)
+	}
+}
+
+func (w *WebHook) enabled(t EventType) bool {
+	return w.events == nil || w.events[t]
+}
+
+func newEvent(t EventType, client gmqtt.Client) *Event {
+	return &Event{
+		Type:      t,
+		Timestamp: time.Now().UnixNano() / int64(time.Millisecond),
+		ClientID:  client.OptionsReader().ClientID(),
+		Username:  client.OptionsReader().Username(),
+	}
+}
+
+func newMessageEvent(t EventType, client gmqtt.Client, msg packets.Message) *Event {
+	ev := newEvent(t, client)
+	ev.Topic = msg.Topic()
+	ev.Qos = msg.Qos()
+	ev.Payload = msg.Payload()
+	ev.Retained = msg.Retained()
+	return ev
+}
+
+// emit queues the event for each endpoint, it never blocks the hook.
+func (w *WebHook) emit(ev *Event) {
+	for i, q := range w.queues {
+		select {
+		case q <- ev:
+		default:
+			log.Warn("event queue is full, dropping event", zap.String("endpoint", w.endpoints[i]), zap.String("type", string(ev.Type)))
+		}
+	}
+}
+
+// sendLoop posts the queued events to the endpoint in batches until the plugin is unloaded.
+func (w *WebHook) sendLoop(endpoint string, q chan *Event) {
+	defer w.wg.Done()
+	ticker := time.NewTicker(w.flushInterval)
+	defer ticker.Stop()
+	var batch []*Event
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := w.post(endpoint, batch); err != nil {
+			log.Error("posting events error", zap.String("endpoint", endpoint), zap.Int("dropped", len(batch)), zap.Error(err))
+		}
+		batch = nil
+	}
+	for {
+		select {
+		case <-w.done:
+			// flush the queued events before exit, this goroutine is the only receiver of the queue.
+			for len(q) > 0 {
+				batch = append(batch, <-q)
+				if len(batch) >= w.batchSize {
+					flush()
+				}
+			}
+			flush()
+			return
+		case ev := <-q:
+			batch = append(batch, ev)
+			if len(batch) >= w.batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// sign returns the value of the SignatureHeader.
+func sign(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// post posts the events to the endpoint, the request is retried on the network errors and the non-2xx responses.
+func (w *WebHook) post(endpoint string, events []*Event) error {
+	body, err := json.Marshal(events)
+	if err != nil {
+		return err
+	}
+	backoff := w.retryBackoff
+	for i := 0; ; i++ {
+		err = w.doPost(endpoint, body)
+		if err == nil || i >= w.maxRetries {
+			return err
+		}
+		log.Warn("posting events error, retrying", zap.String("endpoint", endpoint), zap.Int("retry", i+1), zap.Error(err))
+		select {
+		case <-w.done:
+			// do not delay unloading, try it for the last time.
+			return w.doPost(endpoint, body)
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+func (w *WebHook) doPost(endpoint string, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if w.secret != nil {
+		req.Header.Set(SignatureHeader, sign(w.secret, body))
+	}
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,184 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/DrmagicE/gmqtt"
+	"github.com/DrmagicE/gmqtt/internal/testutil"
+	"github.com/DrmagicE/gmqtt/pkg/packets"
+)
+
+func newTestClient() *testutil.Client {
+	c := testutil.NewClient("id", "user")
+	c.Opts.Remote = &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 50000}
+	return c
+}
+
+// endpoint is the fake endpoint which records the posted batches, it responds the status returned by fn.
+type endpoint struct {
+	mu         sync.Mutex
+	batches    [][]*Event
+	signatures []string
+	fn         func(n int) int
+}
+
+func (e *endpoint) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+	var events []*Event
+	if err := json.Unmarshal(body, &events); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	e.mu.Lock()
+	n := len(e.batches)
+	e.batches = append(e.batches, events)
+	e.signatures = append(e.signatures, r.Header.Get(SignatureHeader))
+	fn := e.fn
+	e.mu.Unlock()
+	if fn != nil {
+		w.WriteHeader(fn(n))
+	}
+}
+
+func (e *endpoint) all() [][]*Event {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([][]*Event(nil), e.batches...)
+}
+
+func (e *endpoint) events() []*Event {
+	var rs []*Event
+	for _, v := range e.all() {
+		rs = append(rs, v...)
+	}
+	return rs
+}
+
+func load(t *testing.T, endpoints []string, opts ...Option) *WebHook {
+	w := New(endpoints, opts...)
+	if err := w.Load(nil); err != nil {
+		t.Fatal(err)
+	}
+	return w
+}
+
+func TestWebHook_Events(t *testing.T) {
+	a := assert.New(t)
+	e := &endpoint{}
+	srv := httptest.NewServer(e)
+	defer srv.Close()
+	w := load(t, []string{srv.URL}, WithBatch(100, time.Hour))
+
+	ctx := context.Background()
+	c := newTestClient()
+	msg := gmqtt.NewMessage("a/b", []byte("payload"), packets.QOS_1, gmqtt.Retained(true))
+	w.OnConnectedWrapper(func(ctx context.Context, client gmqtt.Client) {})(ctx, c)
+	w.OnSubscribedWrapper(func(ctx context.Context, client gmqtt.Client, topic packets.Topic) {})(ctx, c, packets.Topic{Name: "a/#", Qos: 2})
+	w.OnUnsubscribedWrapper(func(ctx context.Context, client gmqtt.Client, topicName string) {})(ctx, c, "a/#")
+	w.OnMsgArrivedWrapper(func(ctx context.Context, client gmqtt.Client, msg packets.Message) bool { return true })(ctx, c, msg)
+	// the messages rejected by the next hooks are not published.
+	w.OnMsgArrivedWrapper(func(ctx context.Context, client gmqtt.Client, msg packets.Message) bool { return false })(ctx, c, msg)
+	w.OnDeliverWrapper(func(ctx context.Context, client gmqtt.Client, msg packets.Message) {})(ctx, c, msg)
+	w.OnMsgDroppedWrapper(func(ctx context.Context, client gmqtt.Client, msg packets.Message, reason gmqtt.MsgDroppedReason) {
+	})(ctx, c, msg, gmqtt.DroppedExpired)
+	w.OnCloseWrapper(func(ctx context.Context, client gmqtt.Client, err error) {})(ctx, c, errors.New("error"))
+	// the queued events are flushed on unload.
+	a.NoError(w.Unload())
+
+	events := e.events()
+	for _, v := range events {
+		a.NotZero(v.Timestamp)
+		v.Timestamp = 0
+	}
+	a.Len(e.all(), 1)
+	message := func(t EventType) *Event {
+		return &Event{Type: t, ClientID: "id", Username: "user", Topic: "a/b", Qos: 1, Payload: []byte("payload"), Retained: true}
+	}
+	dropped := message(MessageDropped)
+	dropped.Reason = "expired"
+	a.Equal([]*Event{
+		{Type: ClientConnected, ClientID: "id", Username: "user", RemoteAddr: "127.0.0.1:50000"},
+		{Type: SessionSubscribed, ClientID: "id", Username: "user", Topic: "a/#", Qos: 2},
+		{Type: SessionUnsubscribed, ClientID: "id", Username: "user", Topic: "a/#"},
+		message(MessagePublished),
+		message(MessageDelivered),
+		dropped,
+		{Type: ClientDisconnected, ClientID: "id", Username: "user", Reason: "error"},
+	}, events)
+}
+
+func TestWebHook_Batch(t *testing.T) {
+	a := assert.New(t)
+	e1, e2 := &endpoint{}, &endpoint{}
+	srv1, srv2 := httptest.NewServer(e1), httptest.NewServer(e2)
+	defer srv1.Close()
+	defer srv2.Close()
+	w := load(t, []string{srv1.URL, srv2.URL}, WithEvents(SessionUnsubscribed), WithBatch(2, 50*time.Millisecond))
+	defer w.Unload()
+
+	unsubscribed := w.OnUnsubscribedWrapper(func(ctx context.Context, client gmqtt.Client, topicName string) {})
+	subscribed := w.OnSubscribedWrapper(func(ctx context.Context, client gmqtt.Client, topic packets.Topic) {})
+	for _, topic := range []string{"a", "b", "c"} {
+		unsubscribed(context.Background(), newTestClient(), topic)
+		// the disabled events are not posted.
+		subscribed(context.Background(), newTestClient(), packets.Topic{Name: topic})
+	}
+	// the full batch is posted at once, the rest is posted on the flush interval.
+	for _, e := range []*endpoint{e1, e2} {
+		a.Eventually(func() bool { return len(e.all()) == 2 }, time.Second, 10*time.Millisecond)
+		batches := e.all()
+		if a.Len(batches, 2) {
+			a.Len(batches[0], 2)
+			a.Len(batches[1], 1)
+			a.Equal("c", batches[1][0].Topic)
+		}
+	}
+}
+
+func TestWebHook_Retry(t *testing.T) {
+	a := assert.New(t)
+	// fails twice then succeeds.
+	e := &endpoint{fn: func(n int) int {
+		if n < 2 {
+			return http.StatusInternalServerError
+		}
+		return http.StatusOK
+	}}
+	srv := httptest.NewServer(e)
+	defer srv.Close()
+	w := load(t, []string{srv.URL}, WithSecret("secret"), WithRetry(3, time.Millisecond))
+	defer w.Unload()
+
+	a.NoError(w.post(srv.URL, []*Event{{Type: ClientConnected, ClientID: "id"}}))
+	a.Len(e.all(), 3)
+	body, _ := json.Marshal([]*Event{{Type: ClientConnected, ClientID: "id"}})
+	e.mu.Lock()
+	for _, v := range e.signatures {
+		a.Equal(sign([]byte("secret"), body), v)
+	}
+	e.mu.Unlock()
+
+	// the error is returned once the retries are exhausted.
+	e.mu.Lock()
+	e.batches = nil
+	e.fn = func(n int) int { return http.StatusBadGateway }
+	e.mu.Unlock()
+	a.Error(w.post(srv.URL, []*Event{{Type: ClientConnected, ClientID: "id"}}))
+	a.Len(e.all(), 4)
+}
+
+func TestSign(t *testing.T) {
+	// echo -n 'body' | openssl dgst -sha256 -hmac secret
+	assert.Equal(t, "sha256=dc46983557fea127b43af721467eb9b3fde2338fe3e14f51952aa8478c13d355", sign([]byte("secret"), []byte("body")))
+}
@@ -0,0 +1,422 @@
+package gmqtt
+
+import (
+	"context"
+	"crypto/x509"
+	"net"
+	"time"
+
+	"github.com/DrmagicE/gmqtt/pkg/packets"
+)
+
+// guardHookWrapper returns the hook wrappers of the plugin which skip the hooks of the plugin if it is unloaded,
+// and recover the panics of the hooks, so that a faulty plugin does not take down the broker.
+// The OnConnect hook is also skipped for the clients which the plugin does not authenticate, see ListenerProfile.AuthPlugins.
+// The hooks after the panicking one in the chain are not called, the hooks returning values fall back to:
+//
+//	OnConnect: the client is rejected with CodeServerUnavaliable.
+//	OnSubscribe: the subscription is rejected.
+//	OnMsgArrived: the message is dropped.
+//	OnAccept: the connection is rejected.
+//	OnCertIdentity: no identity is returned.
+//	OnRateLimit: the rate limits in the config or the listener profile are used.
+//	OnTopicRewrite: the publish is dropped and the subscription is rejected.
+//	OnSessionTakeover: the takeover is vetoed.
+//	OnWillPublish: the will message is suppressed.
+//	OnDeliverRewrite: the original topic name is sent.
+//	OnCredentialExpiry: the expiry is not extended.
+func (srv *server) guardHookWrapper(p *pluginState, hw HookWrapper) HookWrapper {
+	if w := hw.OnConnectWrapper; w != nil {
+		hw.OnConnectWrapper = func(next OnConnect) OnConnect {
+			hook := w(next)
+			return func(ctx context.Context, client Client) (code uint8) {
+				if !p.isLoaded() || !authenticatedBy(client, p.plugin.Name()) {
+					return next(ctx, client)
+				}
+				defer p.recoverHook("OnConnect", func() { code = packets.CodeServerUnavaliable })
+				return hook(ctx, client)
+			}
+		}
+	}
+	if w := hw.OnConnectedWrapper; w != nil {
+		hw.OnConnectedWrapper = func(next OnConnected) OnConnected {
+			hook := w(next)
+			return func(ctx context.Context, client Client) {
+				if !p.isLoaded() {
+					next(ctx, client)
+					return
+				}
+				defer p.recoverHook("OnConnected", nil)
+				hook(ctx, client)
+			}
+		}
+	}
+	if w := hw.OnSessionCreatedWrapper; w != nil {
+		hw.OnSessionCreatedWrapper = func(next OnSessionCreated) OnSessionCreated {
+			hook := w(next)
+			return func(ctx context.Context, client Client) {
+				if !p.isLoaded() {
+					next(ctx, client)
+					return
+				}
+				defer p.recoverHook("OnSessionCreated", nil)
+				hook(ctx, client)
+			}
+		}
+	}
+	if w := hw.OnSessionResumedWrapper; w != nil {
+		hw.OnSessionResumedWrapper = func(next OnSessionResumed) OnSessionResumed {
+			hook := w(next)
+			return func(ctx context.Context, client Client) {
+				if !p.isLoaded() {
+					next(ctx, client)
+					return
+				}
+				defer p.recoverHook("OnSessionResumed", nil)
+				hook(ctx, client)
+			}
+		}
+	}
+	if w := hw.OnSessionTerminatedWrapper; w != nil {
+		hw.OnSessionTerminatedWrapper = func(next OnSessionTerminated) OnSessionTerminated {
+			hook := w(next)
+			return func(ctx context.Context, client Client, reason SessionTerminatedReason) {
+				if !p.isLoaded() {
+					next(ctx, client, reason)
+					return
+				}
+				defer p.recoverHook("OnSessionTerminated", nil)
+				hook(ctx, client, reason)
+			}
+		}
+	}
+	if w := hw.OnSessionExpiredWrapper; w != nil {
+		hw.OnSessionExpiredWrapper = func(next OnSessionExpired) OnSessionExpired {
+			hook := w(next)
+			return func(ctx context.Context, client Client) {
+				if !p.isLoaded() {
+					next(ctx, client)
+					return
+				}
+				defer p.recoverHook("OnSessionExpired", nil)
+				hook(ctx, client)
+			}
+		}
+	}
+	if w := hw.OnSubscribeWrapper; w != nil {
+		hw.OnSubscribeWrapper = func(next OnSubscribe) OnSubscribe {
+			hook := w(next)
+			return func(ctx context.Context, client Client, topic packets.Topic) (qos uint8) {
+				if !p.isLoaded() {
+					return next(ctx, client, topic)
+				}
+				defer p.recoverHook("OnSubscribe", func() { qos = packets.SUBSCRIBE_FAILURE })
+				return hook(ctx, client, topic)
+			}
+		}
+	}
+	if w := hw.OnSubscribedWrapper; w != nil {
+		hw.OnSubscribedWrapper = func(next OnSubscribed) OnSubscribed {
+			hook := w(next)
+			return func(ctx context.Context, client Client, topic packets.Topic) {
+				if !p.isLoaded() {
+					next(ctx, client, topic)
+					return
+				}
+				defer p.recoverHook("OnSubscribed", nil)
+				hook(ctx, client, topic)
+			}
+		}
+	}
+	if w := hw.OnUnsubscribeWrapper; w != nil {
+		hw.OnUnsubscribeWrapper = func(next OnUnsubscribe) OnUnsubscribe {
+			hook := w(next)
+			return func(ctx context.Context, client Client, topicName string) {
+				if !p.isLoaded() {
+					next(ctx, client, topicName)
+					return
+				}
+				defer p.recoverHook("OnUnsubscribe", nil)
+				hook(ctx, client, topicName)
+			}
+		}
+	}
+	if w := hw.OnUnsubscribedWrapper; w != nil {
+		hw.OnUnsubscribedWrapper = func(next OnUnsubscribed) OnUnsubscribed {
+			hook := w(next)
+			return func(ctx context.Context, client Client, topicName string) {
+				if !p.isLoaded() {
+					next(ctx, client, topicName)
+					return
+				}
+				defer p.recoverHook("OnUnsubscribed", nil)
+				hook(ctx, client, topicName)
+			}
+		}
+	}
+	if w := hw.OnMsgArrivedWrapper; w != nil {
+		hw.OnMsgArrivedWrapper = func(next OnMsgArrived) OnMsgArrived {
+			hook := w(next)
+			return func(ctx context.Context, client Client, msg packets.Message) (valid bool) {
+				if !p.isLoaded() {
+					return next(ctx, client, msg)
+				}
+				defer p.recoverHook("OnMsgArrived", func() { valid = false })
+				return hook(ctx, client, msg)
+			}
+		}
+	}
+	if w := hw.OnAckedWrapper; w != nil {
+		hw.OnAckedWrapper = func(next OnAcked) OnAcked {
+			hook := w(next)
+			return func(ctx context.Context, client Client, delivery *Delivery) {
+				if !p.isLoaded() {
+					next(ctx, client, delivery)
+					return
+				}
+				defer p.recoverHook("OnAcked", nil)
+				hook(ctx, client, delivery)
+			}
+		}
+	}
+	if w := hw.OnMsgDroppedWrapper; w != nil {
+		hw.OnMsgDroppedWrapper = func(next OnMsgDropped) OnMsgDropped {
+			hook := w(next)
+			return func(ctx context.Context, client Client, msg packets.Message, reason MsgDroppedReason) {
+				if !p.isLoaded() {
+					next(ctx, client, msg, reason)
+					return
+				}
+				defer p.recoverHook("OnMsgDropped", nil)
+				hook(ctx, client, msg, reason)
+			}
+		}
+	}
+	if w := hw.OnDeliverWrapper; w != nil {
+		hw.OnDeliverWrapper = func(next OnDeliver) OnDeliver {
+			hook := w(next)
+			return func(ctx context.Context, client Client, msg packets.Message) {
+				if !p.isLoaded() {
+					next(ctx, client, msg)
+					return
+				}
+				defer p.recoverHook("OnDeliver", nil)
+				hook(ctx, client, msg)
+			}
+		}
+	}
+	if w := hw.OnCloseWrapper; w != nil {
+		hw.OnCloseWrapper = func(next OnClose) OnClose {
+			hook := w(next)
+			return func(ctx context.Context, client Client, err error) {
+				if !p.isLoaded() {
+					next(ctx, client, err)
+					return
+				}
+				defer p.recoverHook("OnClose", nil)
+				hook(ctx, client, err)
+			}
+		}
+	}
+	if w := hw.OnAcceptWrapper; w != nil {
+		hw.OnAcceptWrapper = func(next OnAccept) OnAccept {
+			hook := w(next)
+			return func(ctx context.Context, conn net.Conn) (ok bool) {
+				if !p.isLoaded() {
+					return next(ctx, conn)
+				}
+				defer p.recoverHook("OnAccept", func() { ok = false })
+				return hook(ctx, conn)
+			}
+		}
+	}
+	if w := hw.OnStopWrapper; w != nil {
+		hw.OnStopWrapper = func(next OnStop) OnStop {
+			hook := w(next)
+			return func(ctx context.Context) {
+				if !p.isLoaded() {
+					next(ctx)
+					return
+				}
+				defer p.recoverHook("OnStop", nil)
+				hook(ctx)
+			}
+		}
+	}
+	if w := hw.OnCertIdentityWrapper; w != nil {
+		hw.OnCertIdentityWrapper = func(next OnCertIdentity) OnCertIdentity {
+			hook := w(next)
+			return func(ctx context.Context, client Client, chain []*x509.Certificate) (identities []string) {
+				if !p.isLoaded() {
+					return next(ctx, client, chain)
+				}
+				defer p.recoverHook("OnCertIdentity", func() { identities = nil })
+				return hook(ctx, client, chain)
+			}
+		}
+	}
+	if w := hw.OnRateLimitWrapper; w != nil {
+		hw.OnRateLimitWrapper = func(next OnRateLimit) OnRateLimit {
+			hook := w(next)
+			return func(ctx context.Context, client Client) (limit RateLimit) {
+				if !p.isLoaded() {
+					return next(ctx, client)
+				}
+				defer p.recoverHook("OnRateLimit", func() { limit = srv.clientRateLimit(client) })
+				return hook(ctx, client)
+			}
+		}
+	}
+	if w := hw.OnOverloadWrapper; w != nil {
+		hw.OnOverloadWrapper = func(next OnOverload) OnOverload {
+			hook := w(next)
+			return func(ctx context.Context, status OverloadStatus) {
+				if !p.isLoaded() {
+					next(ctx, status)
+					return
+				}
+				defer p.recoverHook("OnOverload", nil)
+				hook(ctx, status)
+			}
+		}
+	}
+	if w := hw.OnBannedWrapper; w != nil {
+		hw.OnBannedWrapper = func(next OnBanned) OnBanned {
+			hook := w(next)
+			return func(ctx context.Context, ban Ban) {
+				if !p.isLoaded() {
+					next(ctx, ban)
+					return
+				}
+				defer p.recoverHook("OnBanned", nil)
+				hook(ctx, ban)
+			}
+		}
+	}
+	if w := hw.OnUnbannedWrapper; w != nil {
+		hw.OnUnbannedWrapper = func(next OnUnbanned) OnUnbanned {
+			hook := w(next)
+			return func(ctx context.Context, ban Ban) {
+				if !p.isLoaded() {
+					next(ctx, ban)
+					return
+				}
+				defer p.recoverHook("OnUnbanned", nil)
+				hook(ctx, ban)
+			}
+		}
+	}
+	if w := hw.OnTopicRewriteWrapper; w != nil {
+		hw.OnTopicRewriteWrapper = func(next OnTopicRewrite) OnTopicRewrite {
+			hook := w(next)
+			return func(ctx context.Context, client Client, action TopicRewriteAction, topic string) (rewritten string) {
+				if !p.isLoaded() {
+					return next(ctx, client, action, topic)
+				}
+				defer p.recoverHook("OnTopicRewrite", func() { rewritten = "" })
+				return hook(ctx, client, action, topic)
+			}
+		}
+	}
+	if w := hw.OnSessionTakeoverWrapper; w != nil {
+		hw.OnSessionTakeoverWrapper = func(next OnSessionTakeover) OnSessionTakeover {
+			hook := w(next)
+			return func(ctx context.Context, oldClient Client, newClient Client) (ok bool) {
+				if !p.isLoaded() {
+					return next(ctx, oldClient, newClient)
+				}
+				defer p.recoverHook("OnSessionTakeover", func() { ok = false })
+				return hook(ctx, oldClient, newClient)
+			}
+		}
+	}
+	if w := hw.OnSessionTakenOverWrapper; w != nil {
+		hw.OnSessionTakenOverWrapper = func(next OnSessionTakenOver) OnSessionTakenOver {
+			hook := w(next)
+			return func(ctx context.Context, oldClient Client, newClient Client) {
+				if !p.isLoaded() {
+					next(ctx, oldClient, newClient)
+					return
+				}
+				defer p.recoverHook("OnSessionTakenOver", nil)
+				hook(ctx, oldClient, newClient)
+			}
+		}
+	}
+	if w := hw.OnDeliveredWrapper; w != nil {
+		hw.OnDeliveredWrapper = func(next OnDelivered) OnDelivered {
+			hook := w(next)
+			return func(ctx context.Context, client Client, delivery *Delivery) {
+				if !p.isLoaded() {
+					next(ctx, client, delivery)
+					return
+				}
+				defer p.recoverHook("OnDelivered", nil)
+				hook(ctx, client, delivery)
+			}
+		}
+	}
+	if w := hw.OnSubscribeRewriteWrapper; w != nil {
+		hw.OnSubscribeRewriteWrapper = func(next OnSubscribeRewrite) OnSubscribeRewrite {
+			hook := w(next)
+			return func(ctx context.Context, client Client, req *SubscribeRequest) {
+				if !p.isLoaded() {
+					next(ctx, client, req)
+					return
+				}
+				defer p.recoverHook("OnSubscribeRewrite", nil)
+				hook(ctx, client, req)
+			}
+		}
+	}
+	if w := hw.OnWillPublishWrapper; w != nil {
+		hw.OnWillPublishWrapper = func(next OnWillPublish) OnWillPublish {
+			hook := w(next)
+			return func(ctx context.Context, client Client, msg packets.Message) (rs packets.Message) {
+				if !p.isLoaded() {
+					return next(ctx, client, msg)
+				}
+				defer p.recoverHook("OnWillPublish", func() { rs = nil })
+				return hook(ctx, client, msg)
+			}
+		}
+	}
+	if w := hw.OnWillPublishedWrapper; w != nil {
+		hw.OnWillPublishedWrapper = func(next OnWillPublished) OnWillPublished {
+			hook := w(next)
+			return func(ctx context.Context, client Client, msg packets.Message) {
+				if !p.isLoaded() {
+					next(ctx, client, msg)
+					return
+				}
+				defer p.recoverHook("OnWillPublished", nil)
+				hook(ctx, client, msg)
+			}
+		}
+	}
+	if w := hw.OnDeliverRewriteWrapper; w != nil {
+		hw.OnDeliverRewriteWrapper = func(next OnDeliverRewrite) OnDeliverRewrite {
+			hook := w(next)
+			return func(ctx context.Context, client Client, topicName string) (rewritten string) {
+				if !p.isLoaded() {
+					return next(ctx, client, topicName)
+				}
+				defer p.recoverHook("OnDeliverRewrite", func() { rewritten = topicName })
+				return hook(ctx, client, topicName)
+			}
+		}
+	}
+	if w := hw.OnCredentialExpiryWrapper; w != nil {
+		hw.OnCredentialExpiryWrapper = func(next OnCredentialExpiry) OnCredentialExpiry {
+			hook := w(next)
+			return func(ctx context.Context, client Client, expiry time.Time) (rs time.Time) {
+				if !p.isLoaded() {
+					return next(ctx, client, expiry)
+				}
+				defer p.recoverHook("OnCredentialExpiry", func() { rs = expiry })
+				return hook(ctx, client, expiry)
+			}
+		}
+	}
+	return hw
+}
@@ -0,0 +1,272 @@
+package gmqtt
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"go.uber.org/zap"
+)
+
+var (
+	// ErrPluginNotFound is returned by PluginService if the plugin does not exist.
+	ErrPluginNotFound = errors.New("plugin not found")
+	// ErrPluginLoaded is returned by PluginService.Load if the plugin has been loaded.
+	ErrPluginLoaded = errors.New("plugin has been loaded")
+	// ErrPluginNotLoaded is returned by PluginService.Unload if the plugin is not loaded.
+	ErrPluginNotLoaded = errors.New("plugin is not loaded")
+)
+
+// Requirer is the optional interface of the plugins which depend on the other plugins.
+// The plugins are loaded after the plugins they require, and their hook wrappers are placed after the hook
+// wrappers of the required plugins. Run panics if a required plugin is not registered or the requirements
+// are circular.
+type Requirer interface {
+	// Requires returns the names of the required plugins.
+	Requires() []string
+}
+
+// PluginInfo is the information of a plugin returned by PluginService.
+type PluginInfo struct {
+	Name string
+	// Requires is the names of the plugins required by the plugin, see Requirer.
+	Requires []string
+	Loaded   bool
+	// Panics is the number of the recovered panics of the hooks of the plugin.
+	Panics uint64
+}
+
+// PluginService provides the ability to inspect the plugins and to unload and reload them at runtime.
+// The plugins can only be registered by WithPlugin, the service only changes whether they are loaded.
+// The hooks of an unloaded plugin are skipped, the calls are passed to the next hook wrappers directly.
+type PluginService interface {
+	// List returns the information of all plugins in the load order.
+	List() []PluginInfo
+	// Load loads the unloaded plugin by calling its Load method, all plugins it requires must have been loaded.
+	Load(name string) error
+	// Unload unloads the plugin by calling its Unload method, the plugins requiring it must be unloaded first.
+	// The hooks of the plugin are skipped even if Unload returns an error.
+	Unload(name string) error
+}
+
+type pluginState struct {
+	plugin   Plugable
+	requires []string
+	// loaded is 1 if the plugin is loaded.
+	loaded int32
+	panics uint64
+}
+
+func (p *pluginState) isLoaded() bool {
+	return atomic.LoadInt32(&p.loaded) == 1
+}
+
+type pluginService struct {
+	server *server
+	mu     sync.Mutex
+	// states is in the load order.
+	states []*pluginState
+	byName map[string]*pluginState
+}
+
+func newPluginService(srv *server) *pluginService {
+	return &pluginService{
+		server: srv,
+		byName: make(map[string]*pluginState),
+	}
+}
+
+// PluginService returns the PluginService
+func (srv *server) PluginService() PluginService {
+	return srv.pluginService
+}
+
+// requires returns the requirements of the plugin, nil if the plugin does not implement Requirer.
+func requires(p Plugable) []string {
+	if r, ok := p.(Requirer); ok {
+		return r.Requires()
+	}
+	return nil
+}
+
+// sortPlugins sorts the plugins by their requirements, the plugins without requirements between them
+// keep their registration order.
+func sortPlugins(plugins []Plugable) ([]Plugable, error) {
+	index := make(map[string]int, len(plugins))
+	for i, p := range plugins {
+		if _, ok := index[p.Name()]; ok {
+			return nil, fmt.Errorf("duplicate plugin %s", p.Name())
+		}
+		index[p.Name()] = i
+	}
+	for _, p := range plugins {
+		for _, r := range requires(p) {
+			if _, ok := index[r]; !ok {
+				return nil, fmt.Errorf("plugin %s requires %s which is not registered", p.Name(), r)
+			}
+		}
+	}
+	rs := make([]Plugable, 0, len(plugins))
+	done := make([]bool, len(plugins))
+	for len(rs) < len(plugins) {
+		progress := false
+		for i, p := range plugins {
+			if done[i] {
+				continue
+			}
+			ready := true
+			for _, r := range requires(p) {
+				if !done[index[r]] {
+					ready = false
+					break
+				}
+			}
+			if ready {
+				done[i] = true
+				rs = append(rs, p)
+				progress = true
+				// restart from the first plugin to keep the registration order.
+				break
+			}
+		}
+		if !progress {
+			var names []string
+			for i, p := range plugins {
+				if !done[i] {
+					names = append(names, p.Name())
+				}
+			}
+			return nil, fmt.Errorf("circular plugin requirements: %s", strings.Join(names, ", "))
+		}
+	}
+	return rs, nil
+}
+
+// init sorts the registered plugins and adds them to the service, the plugins are not loaded yet.
+func (s *pluginService) init() error {
+	plugins, err := sortPlugins(s.server.plugins)
+	if err != nil {
+		return err
+	}
+	s.server.plugins = plugins
+	for _, p := range plugins {
+		st := &pluginState{plugin: p, requires: requires(p)}
+		s.states = append(s.states, st)
+		s.byName[p.Name()] = st
+	}
+	return nil
+}
+
+func (s *pluginService) List() []PluginInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rs := make([]PluginInfo, 0, len(s.states))
+	for _, st := range s.states {
+		rs = append(rs, PluginInfo{
+			Name:     st.plugin.Name(),
+			Requires: st.requires,
+			Loaded:   st.isLoaded(),
+			Panics:   atomic.LoadUint64(&st.panics),
+		})
+	}
+	return rs
+}
+
+func (s *pluginService) Load(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st, ok := s.byName[name]
+	if !ok {
+		return ErrPluginNotFound
+	}
+	if st.isLoaded() {
+		return ErrPluginLoaded
+	}
+	for _, r := range st.requires {
+		if !s.byName[r].isLoaded() {
+			return fmt.Errorf("plugin %s requires %s which is not loaded", name, r)
+		}
+	}
+	return s.load(st)
+}
+
+func (s *pluginService) load(st *pluginState) error {
+	serverLog().Info("loading plugin", zap.String("name", st.plugin.Name()))
+	if err := st.plugin.Load(s.server); err != nil {
+		return err
+	}
+	atomic.StoreInt32(&st.loaded, 1)
+	return nil
+}
+
+func (s *pluginService) Unload(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st, ok := s.byName[name]
+	if !ok {
+		return ErrPluginNotFound
+	}
+	if !st.isLoaded() {
+		return ErrPluginNotLoaded
+	}
+	for _, v := range s.states {
+		if !v.isLoaded() {
+			continue
+		}
+		for _, r := range v.requires {
+			if r == name {
+				return fmt.Errorf("plugin %s is required by %s", name, v.plugin.Name())
+			}
+		}
+	}
+	return s.unload(st)
+}
+
+func (s *pluginService) unload(st *pluginState) error {
+	atomic.StoreInt32(&st.loaded, 0)
+	serverLog().Info("unloading plugin", zap.String("name", st.plugin.Name()))
+	return st.plugin.Unload()
+}
+
+// unloadAll unloads the loaded plugins in the reverse load order, it is called when the server stops.
+func (s *pluginService) unloadAll() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := len(s.states) - 1; i >= 0; i-- {
+		st := s.states[i]
+		if !st.isLoaded() {
+			continue
+		}
+		if err := s.unload(st); err != nil {
+			serverLog().Warn("plugin unload error", zap.String("name", st.plugin.Name()), zap.Error(err))
+		}
+	}
+}
+
+// loaded returns the loaded plugins in the load order.
+func (s *pluginService) loaded() []Plugable {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var rs []Plugable
+	for _, st := range s.states {
+		if st.isLoaded() {
+			rs = append(rs, st.plugin)
+		}
+	}
+	return rs
+}
+
+// recoverHook recovers the panic of the hook of the plugin, and calls fallback to set the return values of the hook.
+// It must be called by defer.
+func (p *pluginState) recoverHook(hook string, fallback func()) {
+	if re := recover(); re != nil {
+		atomic.AddUint64(&p.panics, 1)
+		serverLog().Error("plugin hook panic",
+			zap.String("name", p.plugin.Name()), zap.String("hook", hook), zap.Any("panic", re), zap.Stack("stack"))
+		if fallback != nil {
+			fallback()
+		}
+	}
+}
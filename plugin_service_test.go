@@ -0,0 +1,182 @@
+package gmqtt
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/DrmagicE/gmqtt/pkg/packets"
+)
+
+type testPlugin struct {
+	name     string
+	requires []string
+	// events records the Load and Unload calls of all plugins.
+	events *[]string
+	hooks  HookWrapper
+}
+
+func (p *testPlugin) Load(service Server) error {
+	*p.events = append(*p.events, "load "+p.name)
+	return nil
+}
+
+func (p *testPlugin) Unload() error {
+	*p.events = append(*p.events, "unload "+p.name)
+	return nil
+}
+
+func (p *testPlugin) HookWrapper() HookWrapper {
+	return p.hooks
+}
+
+func (p *testPlugin) Name() string {
+	return p.name
+}
+
+func (p *testPlugin) Requires() []string {
+	return p.requires
+}
+
+func TestSortPlugins(t *testing.T) {
+	a := assert.New(t)
+	var events []string
+	newPlugin := func(name string, requires ...string) Plugable {
+		return &testPlugin{name: name, requires: requires, events: &events}
+	}
+	names := func(plugins []Plugable) (rs []string) {
+		for _, p := range plugins {
+			rs = append(rs, p.Name())
+		}
+		return rs
+	}
+	plugins, err := sortPlugins([]Plugable{
+		newPlugin("a", "c"),
+		newPlugin("b"),
+		newPlugin("c", "d"),
+		newPlugin("d"),
+		&testReloader{name: "e"},
+	})
+	a.NoError(err)
+	a.Equal([]string{"b", "d", "c", "a", "e"}, names(plugins))
+
+	_, err = sortPlugins([]Plugable{newPlugin("a", "b")})
+	a.EqualError(err, "plugin a requires b which is not registered")
+	_, err = sortPlugins([]Plugable{newPlugin("a", "b"), newPlugin("b", "a"), newPlugin("c")})
+	a.EqualError(err, "circular plugin requirements: a, b")
+	_, err = sortPlugins([]Plugable{newPlugin("a"), newPlugin("a")})
+	a.EqualError(err, "duplicate plugin a")
+}
+
+func TestPluginService(t *testing.T) {
+	a := assert.New(t)
+	var events []string
+	var mu sync.Mutex
+	var arrived []string
+	record := func(name string) OnMsgArrivedWrapper {
+		return func(next OnMsgArrived) OnMsgArrived {
+			return func(ctx context.Context, client Client, msg packets.Message) (valid bool) {
+				mu.Lock()
+				arrived = append(arrived, name)
+				mu.Unlock()
+				return next(ctx, client, msg)
+			}
+		}
+	}
+	auth := &testPlugin{name: "auth", events: &events, hooks: HookWrapper{OnMsgArrivedWrapper: record("auth")}}
+	acl := &testPlugin{name: "acl", requires: []string{"auth"}, events: &events,
+		hooks: HookWrapper{OnMsgArrivedWrapper: record("acl")}}
+	srv := NewServer(WithPlugin(acl, auth))
+	srv.tcpListener = append(srv.tcpListener, &testListener{acceptReady: make(chan struct{})})
+	srv.Run()
+	a.Equal([]string{"load auth", "load acl"}, events)
+
+	ps := srv.PluginService()
+	a.Equal([]PluginInfo{
+		{Name: "auth", Loaded: true},
+		{Name: "acl", Requires: []string{"auth"}, Loaded: true},
+	}, ps.List())
+	a.Equal(ErrPluginNotFound, ps.Unload("unknown"))
+	a.Equal(ErrPluginLoaded, ps.Load("auth"))
+	a.EqualError(ps.Unload("auth"), "plugin auth is required by acl")
+
+	msg := NewMessage("a", []byte("a"), packets.QOS_0)
+	srv.hooks.OnMsgArrived(context.Background(), nil, msg)
+	a.Equal([]string{"auth", "acl"}, arrived)
+
+	// the hooks of the unloaded plugin are skipped.
+	a.NoError(ps.Unload("acl"))
+	a.Equal(ErrPluginNotLoaded, ps.Unload("acl"))
+	arrived = nil
+	srv.hooks.OnMsgArrived(context.Background(), nil, msg)
+	a.Equal([]string{"auth"}, arrived)
+
+	a.NoError(ps.Unload("auth"))
+	a.EqualError(ps.Load("acl"), "plugin acl requires auth which is not loaded")
+	a.NoError(ps.Load("auth"))
+	a.NoError(ps.Load("acl"))
+	arrived = nil
+	srv.hooks.OnMsgArrived(context.Background(), nil, msg)
+	a.Equal([]string{"auth", "acl"}, arrived)
+
+	events = nil
+	srv.Stop(context.Background())
+	// the plugins are unloaded in the reverse load order.
+	a.Equal([]string{"unload acl", "unload auth"}, events)
+}
+
+func TestPluginService_Panic(t *testing.T) {
+	a := assert.New(t)
+	var events []string
+	faulty := &testPlugin{name: "faulty", events: &events, hooks: HookWrapper{
+		OnMsgArrivedWrapper: func(next OnMsgArrived) OnMsgArrived {
+			return func(ctx context.Context, client Client, msg packets.Message) (valid bool) {
+				if msg.Topic() == "panic" {
+					panic("faulty plugin")
+				}
+				return next(ctx, client, msg)
+			}
+		},
+		OnConnectWrapper: func(next OnConnect) OnConnect {
+			return func(ctx context.Context, client Client) (code uint8) {
+				if client.OptionsReader().ClientID() == "panic" {
+					panic("faulty plugin")
+				}
+				return next(ctx, client)
+			}
+		},
+	}}
+	srv := NewServer(WithPlugin(faulty))
+	srv.tcpListener = append(srv.tcpListener, &testListener{acceptReady: make(chan struct{})})
+	defer srv.Stop(context.Background())
+	srv.Run()
+
+	// the client is rejected.
+	ln := srv.tcpListener[0].(*testListener)
+	conn := &rwTestConn{
+		closec:    make(chan struct{}),
+		readChan:  make(chan []byte, 1024),
+		writeChan: make(chan []byte, 1024),
+	}
+	ln.conn.PushBack(conn)
+	ln.acceptReady <- struct{}{}
+	connect := defaultConnectPacket()
+	connect.ClientID = []byte("panic")
+	writePacket(conn, connect)
+	p, err := readPacket(conn)
+	a.NoError(err)
+	a.EqualValues(packets.CodeServerUnavaliable, p.(*packets.Connack).Code)
+
+	// the message is dropped, and the broker keeps serving.
+	c := connectTestClient(srv, defaultConnectPacket())
+	srv.subscriptionsDB.Subscribe("MQTT", packets.Topic{Name: "#", Qos: packets.QOS_0})
+	writePacket(c, &packets.Publish{Qos: packets.QOS_0, TopicName: []byte("panic")})
+	writePacket(c, &packets.Publish{Qos: packets.QOS_0, TopicName: []byte("ok")})
+	p, err = readPacketWithTimeOut(c, time.Second)
+	a.NoError(err)
+	a.Equal("ok", string(p.(*packets.Publish).TopicName))
+	a.EqualValues(2, srv.PluginService().List()[0].Panics)
+}
@@ -0,0 +1,73 @@
+package gmqtt
+
+import (
+	"container/list"
+	"fmt"
+
+	"github.com/DrmagicE/gmqtt/pkg/packets"
+)
+
+// QueuePriority assigns the priority to the queued messages of the topics matching the topic filter.
+type QueuePriority struct {
+	// TopicFilter is matched against the topic name delivered to the client, e.g: "alarms/#".
+	TopicFilter string
+	// Priority is the priority of the messages, the higher is the more important.
+	// The messages which do not match any topic filter have priority 0.
+	Priority int
+}
+
+// validateQueuePriorities returns an error if any topic filter of the queue priorities is invalid.
+func validateQueuePriorities(priorities []QueuePriority) error {
+	for _, v := range priorities {
+		if !packets.ValidTopicFilter([]byte(v.TopicFilter)) {
+			return fmt.Errorf("invalid queue priority topic filter %q", v.TopicFilter)
+		}
+	}
+	return nil
+}
+
+// queuePriority returns the priority of the first QueuePriority matching the topic name, 0 if none matches.
+func (srv *server) queuePriority(topicName []byte) int {
+	for _, v := range srv.config.QueuePriorities {
+		if packets.TopicMatch(topicName, []byte(v.TopicFilter)) {
+			return v.Priority
+		}
+	}
+	return 0
+}
+
+// queuedPriority returns the priority of the element in the msgQueue, it must be called with msgQueueMu held.
+func (s *session) queuedPriority(e *list.Element) int {
+	return s.msgQueuePriority[e.Value.(*packets.Publish)]
+}
+
+// insertQueued inserts the publish after the queued messages whose priorities are not lower than it,
+// so the msgQueue is ordered by the priorities and the messages of the same priority are in the enqueue order.
+// It must be called with msgQueueMu held.
+func (s *session) insertQueued(publish *packets.Publish, priority int) {
+	if priority != 0 {
+		s.msgQueuePriority[publish] = priority
+	}
+	for e := s.msgQueue.Back(); e != nil; e = e.Prev() {
+		if s.queuedPriority(e) >= priority {
+			s.msgQueue.InsertAfter(publish, e)
+			return
+		}
+	}
+	s.msgQueue.PushFront(publish)
+}
+
+// lowestQueued returns the first element of the queued messages with the lowest priority and the priority.
+// It must be called with msgQueueMu held.
+func (s *session) lowestQueued() (*list.Element, int) {
+	back := s.msgQueue.Back()
+	if back == nil {
+		return nil, 0
+	}
+	lowest := s.queuedPriority(back)
+	e := back
+	for prev := e.Prev(); prev != nil && s.queuedPriority(prev) == lowest; prev = prev.Prev() {
+		e = prev
+	}
+	return e, lowest
+}
@@ -0,0 +1,56 @@
+package gmqtt
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/DrmagicE/gmqtt/pkg/packets"
+)
+
+func TestValidateQueuePriorities(t *testing.T) {
+	a := assert.New(t)
+	a.NoError(validateQueuePriorities([]QueuePriority{{TopicFilter: "alarms/#", Priority: 1}}))
+	a.Error(validateQueuePriorities([]QueuePriority{{TopicFilter: "alarms/#/a", Priority: 1}}))
+}
+
+func TestMsgQueue_Priority(t *testing.T) {
+	a := assert.New(t)
+	c := fullInflightSessionQos1()
+	c.server.config.MaxMsgQueue = 4
+	c.server.config.QueuePriorities = []QueuePriority{
+		{TopicFilter: "alarms/critical", Priority: 2},
+		{TopicFilter: "alarms/#", Priority: 1},
+		{TopicFilter: "debug/#", Priority: -1},
+	}
+	enqueue := func(pid packets.PacketID, topic string, qos uint8) {
+		c.msgEnQueue(&packets.Publish{PacketID: pid, Qos: qos, TopicName: []byte(topic)})
+	}
+	queued := func() (rs []packets.PacketID) {
+		for e := c.session.msgQueue.Front(); e != nil; e = e.Next() {
+			rs = append(rs, e.Value.(*packets.Publish).PacketID)
+		}
+		return rs
+	}
+	enqueue(1, "telemetry/1", packets.QOS_1)
+	enqueue(2, "alarms/1", packets.QOS_1)
+	enqueue(3, "telemetry/2", packets.QOS_0)
+	enqueue(4, "alarms/critical", packets.QOS_1)
+	a.Equal([]packets.PacketID{4, 2, 1, 3}, queued())
+
+	// the queue is full, the qos 0 message of the lowest priority is dropped.
+	enqueue(5, "alarms/2", packets.QOS_1)
+	a.Equal([]packets.PacketID{4, 2, 5, 1}, queued())
+	// the message of the lower priority than the queued ones is dropped.
+	enqueue(6, "debug/1", packets.QOS_1)
+	a.Equal([]packets.PacketID{4, 2, 5, 1}, queued())
+	// the front message of the lowest priority is dropped.
+	enqueue(7, "alarms/3", packets.QOS_1)
+	a.Equal([]packets.PacketID{4, 2, 5, 7}, queued())
+	enqueue(8, "telemetry/3", packets.QOS_1)
+	a.Equal([]packets.PacketID{4, 2, 5, 7}, queued())
+
+	a.EqualValues(4, c.msgDequeue().PacketID)
+	a.EqualValues(2, c.msgDequeue().PacketID)
+	a.Len(c.session.msgQueuePriority, 2)
+}
@@ -0,0 +1,181 @@
+package gmqtt
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/DrmagicE/gmqtt/pkg/packets"
+)
+
+// ErrRateLimitExceeded is the error of closing the client which exceeds its publish rate limit
+// with the RateLimitDisconnect policy.
+var ErrRateLimitExceeded = errors.New("publish rate limit exceeded")
+
+// RateLimitPolicy is the behaviour when a client exceeds its publish rate limit.
+type RateLimitPolicy int
+
+const (
+	// RateLimitDelay delays processing the PUBLISH packets of the client until the rate is within the limit.
+	// The delay also stops reading from the connection once the read buffer is full, which applies the
+	// backpressure to the client.
+	RateLimitDelay RateLimitPolicy = 0
+	// RateLimitDisconnect closes the client.
+	RateLimitDisconnect RateLimitPolicy = 1
+)
+
+// RateLimit is the rate limit of the inbound PUBLISH packets of a client.
+type RateLimit struct {
+	// MsgRate is the maximum number of the PUBLISH packets per second, 0 means no limit.
+	MsgRate float64
+	// BytesRate is the maximum total size in bytes of the topic names and payloads per second, 0 means no limit.
+	BytesRate float64
+	// Policy is the behaviour when the client exceeds the limit.
+	Policy RateLimitPolicy
+}
+
+// tokenBucket is the token bucket which is filled at the rate up to the capacity of one second.
+// It is not safe for concurrent use.
+type tokenBucket struct {
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, now time.Time) *tokenBucket {
+	return &tokenBucket{rate: rate, tokens: rate, last: now}
+}
+
+func (b *tokenBucket) fill(now time.Time) {
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.rate {
+		b.tokens = b.rate
+	}
+	b.last = now
+}
+
+// take takes n tokens and returns the time to wait before the tokens are available.
+// The request larger than the capacity is allowed once the bucket is full, so it would never wait forever.
+func (b *tokenBucket) take(n float64, now time.Time) (wait time.Duration) {
+	b.fill(now)
+	b.tokens -= n
+	if b.tokens >= 0 || b.tokens+n >= b.rate {
+		if b.tokens < 0 {
+			b.tokens = 0
+		}
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// available returns whether n tokens are available.
+func (b *tokenBucket) available(n float64, now time.Time) bool {
+	b.fill(now)
+	return b.tokens >= n || b.tokens >= b.rate
+}
+
+// tryTake takes n tokens if they are available.
+func (b *tokenBucket) tryTake(n float64, now time.Time) bool {
+	if !b.available(n, now) {
+		return false
+	}
+	b.tokens -= n
+	if b.tokens < 0 {
+		b.tokens = 0
+	}
+	return true
+}
+
+// rateLimiter limits the inbound PUBLISH packets of a client, it is used by the readHandle goroutine only.
+type rateLimiter struct {
+	policy RateLimitPolicy
+	msgs   *tokenBucket
+	bytes  *tokenBucket
+}
+
+// configRateLimit returns the publish rate limit in the config.
+func (srv *server) configRateLimit() RateLimit {
+	srv.configMu.RLock()
+	defer srv.configMu.RUnlock()
+	return RateLimit{
+		MsgRate:   srv.config.MaxPublishRate,
+		BytesRate: srv.config.MaxPublishBytesRate,
+		Policy:    srv.config.PublishRateLimitPolicy,
+	}
+}
+
+// newRateLimiter returns the rate limiter of the client, nil means no limit.
+func (client *client) newRateLimiter() *rateLimiter {
+	srv := client.server
+	limit := srv.clientRateLimit(client)
+	if srv.hooks.OnRateLimit != nil {
+		limit = srv.hooks.OnRateLimit(context.Background(), client)
+	}
+	if limit.MsgRate <= 0 && limit.BytesRate <= 0 {
+		return nil
+	}
+	now := time.Now()
+	l := &rateLimiter{policy: limit.Policy}
+	if limit.MsgRate > 0 {
+		l.msgs = newTokenBucket(limit.MsgRate, now)
+	}
+	if limit.BytesRate > 0 {
+		l.bytes = newTokenBucket(limit.BytesRate, now)
+	}
+	return l
+}
+
+// wait returns the time to wait before processing the publish, ok is false if the client should be disconnected.
+func (l *rateLimiter) wait(publish *packets.Publish, now time.Time) (wait time.Duration, ok bool) {
+	size := float64(publishSize(publish))
+	if l.policy == RateLimitDisconnect {
+		// check both buckets before taking the tokens.
+		if l.msgs != nil && !l.msgs.available(1, now) {
+			return 0, false
+		}
+		if l.bytes != nil && !l.bytes.available(size, now) {
+			return 0, false
+		}
+		if l.msgs != nil {
+			l.msgs.tryTake(1, now)
+		}
+		if l.bytes != nil {
+			l.bytes.tryTake(size, now)
+		}
+		return 0, true
+	}
+	if l.msgs != nil {
+		wait = l.msgs.take(1, now)
+	}
+	if l.bytes != nil {
+		if w := l.bytes.take(size, now); w > wait {
+			wait = w
+		}
+	}
+	return wait, true
+}
+
+// throttle applies the rate limit to the publish. ok is false if the publish should not be processed,
+// in which case err is ErrRateLimitExceeded if the client should be closed, or nil if the client has been closed
+// while waiting.
+func (client *client) throttle(l *rateLimiter, publish *packets.Publish) (ok bool, err error) {
+	if l == nil {
+		return true, nil
+	}
+	wait, ok := l.wait(publish, time.Now())
+	if !ok {
+		clientLog().Warn("publish rate limit exceeded, closing client", client.logFields()...)
+		return false, ErrRateLimitExceeded
+	}
+	if wait <= 0 {
+		return true, nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-client.close:
+		return false, nil
+	case <-timer.C:
+		return true, nil
+	}
+}
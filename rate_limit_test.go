@@ -0,0 +1,134 @@
+package gmqtt
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/DrmagicE/gmqtt/pkg/packets"
+)
+
+func TestTokenBucket(t *testing.T) {
+	a := assert.New(t)
+	now := time.Now()
+	b := newTokenBucket(10, now)
+	for i := 0; i < 10; i++ {
+		a.Zero(b.take(1, now))
+	}
+	a.Equal(100*time.Millisecond, b.take(1, now))
+	// the debt is paid off after 100ms, the next token is available after another 100ms.
+	a.Equal(100*time.Millisecond, b.take(1, now.Add(100*time.Millisecond)))
+	// the capacity is one second.
+	now = now.Add(10 * time.Second)
+	a.Zero(b.take(10, now))
+	a.NotZero(b.take(1, now))
+
+	b = newTokenBucket(10, now)
+	a.True(b.tryTake(6, now))
+	a.False(b.tryTake(6, now))
+	a.True(b.tryTake(4, now))
+	a.False(b.tryTake(1, now))
+	// the request larger than the capacity is allowed once the bucket is full.
+	a.True(b.tryTake(20, now.Add(time.Second)))
+	a.False(b.tryTake(20, now.Add(time.Second)))
+}
+
+func TestRateLimiter_Wait(t *testing.T) {
+	a := assert.New(t)
+	now := time.Now()
+	pub := &packets.Publish{TopicName: []byte("a/b"), Payload: []byte("1234567")}
+	l := &rateLimiter{policy: RateLimitDelay, msgs: newTokenBucket(100, now), bytes: newTokenBucket(20, now)}
+	w, ok := l.wait(pub, now)
+	a.True(ok)
+	a.Zero(w)
+	w, ok = l.wait(pub, now)
+	a.True(ok)
+	a.Zero(w)
+	// the bytes rate is exceeded.
+	w, ok = l.wait(pub, now)
+	a.True(ok)
+	a.Equal(500*time.Millisecond, w)
+
+	l = &rateLimiter{policy: RateLimitDisconnect, msgs: newTokenBucket(1, now)}
+	_, ok = l.wait(pub, now)
+	a.True(ok)
+	_, ok = l.wait(pub, now)
+	a.False(ok)
+
+	// the message token is not taken if the bytes rate is exceeded.
+	l = &rateLimiter{policy: RateLimitDisconnect, msgs: newTokenBucket(2, now), bytes: newTokenBucket(10, now)}
+	_, ok = l.wait(pub, now)
+	a.True(ok)
+	_, ok = l.wait(pub, now)
+	a.False(ok)
+	a.Equal(float64(1), l.msgs.tokens)
+}
+
+func TestRateLimit_Delay(t *testing.T) {
+	a := assert.New(t)
+	arrived := make(chan time.Time, 10)
+	srv := NewServer(WithHook(Hooks{
+		OnMsgArrived: func(ctx context.Context, client Client, msg packets.Message) (valid bool) {
+			arrived <- time.Now()
+			return true
+		},
+	}))
+	srv.config.MaxPublishRate = 10
+	srv.tcpListener = append(srv.tcpListener, &testListener{acceptReady: make(chan struct{})})
+	defer srv.Stop(context.Background())
+	srv.Run()
+	c := connectTestClient(srv, defaultConnectPacket())
+	start := time.Now()
+	for i := 0; i < 12; i++ {
+		writePacket(c, &packets.Publish{TopicName: []byte("a/b"), Payload: []byte("a"), Qos: packets.QOS_0})
+	}
+	var last time.Time
+	for i := 0; i < 12; i++ {
+		select {
+		case last = <-arrived:
+		case <-time.After(2 * time.Second):
+			t.Fatal("OnMsgArrived timeout")
+		}
+	}
+	// the first 10 messages are processed immediately, the other 2 are delayed by 200ms in total.
+	a.True(last.Sub(start) >= 150*time.Millisecond)
+	a.NotNil(srv.Client("MQTT"))
+}
+
+func TestRateLimit_Disconnect(t *testing.T) {
+	a := assert.New(t)
+	closed := make(chan error, 1)
+	srv := NewServer(WithHook(Hooks{
+		OnRateLimit: func(ctx context.Context, client Client) (limit RateLimit) {
+			if client.OptionsReader().ClientID() == "limited" {
+				return RateLimit{MsgRate: 1, Policy: RateLimitDisconnect}
+			}
+			return RateLimit{}
+		},
+		OnClose: func(ctx context.Context, client Client, err error) {
+			if client.OptionsReader().ClientID() == "limited" {
+				closed <- err
+			}
+		},
+	}))
+	srv.tcpListener = append(srv.tcpListener, &testListener{acceptReady: make(chan struct{})})
+	defer srv.Stop(context.Background())
+	srv.Run()
+	unlimited := connectTestClient(srv, defaultConnectPacket())
+	connect := defaultConnectPacket()
+	connect.ClientID = []byte("limited")
+	limited := connectTestClient(srv, connect)
+	for i := 0; i < 3; i++ {
+		writePacket(unlimited, &packets.Publish{TopicName: []byte("a/b"), Payload: []byte("a"), Qos: packets.QOS_0})
+		writePacket(limited, &packets.Publish{TopicName: []byte("a/b"), Payload: []byte("a"), Qos: packets.QOS_0})
+	}
+	select {
+	case err := <-closed:
+		a.Equal(ErrRateLimitExceeded, err)
+	case <-time.After(time.Second):
+		t.Fatal("OnClose timeout")
+	}
+	a.NotNil(srv.Client("MQTT"))
+}
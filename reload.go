@@ -0,0 +1,152 @@
+package gmqtt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+var (
+	// ErrLogLevelNotSet is returned by SetLogLevel if the server is not created with WithLogLevel.
+	ErrLogLevelNotSet = errors.New("log level is not set, see WithLogLevel")
+	// ErrListenerNotFound is returned by RemoveListener if the listener is not served by the server.
+	ErrListenerNotFound = errors.New("listener not found")
+	// ErrServerStopped is returned by AddListener if the server has been stopped.
+	ErrServerStopped = errors.New("server stopped")
+)
+
+// drainCheckInterval is the interval to check whether the connections of the removed listener are closed.
+const drainCheckInterval = 100 * time.Millisecond
+
+// Reloader is the optional interface of the plugins which can reload their configuration at runtime,
+// such as the credentials of the auth plugins and the ACL rules. It is called by ReloadConfig.
+type Reloader interface {
+	Reload() error
+}
+
+// ReloadConfig applies the reloadable fields of the config without restart, which are MaxPublishRate,
+// MaxPublishBytesRate and PublishRateLimitPolicy. The rate limits are applied to the online clients as well,
+// the other fields are ignored. Then the loaded plugins which implement Reloader are reloaded,
+// the plugins are still reloaded if one of them fails, and the errors are returned together.
+// Calling ReloadConfig(srv.GetConfig()) only reloads the plugins, which is what the broker does on SIGHUP.
+func (srv *server) ReloadConfig(config Config) error {
+	if config.MaxPublishRate < 0 || config.MaxPublishBytesRate < 0 {
+		return errors.New("invalid publish rate limit")
+	}
+	srv.configMu.Lock()
+	changed := srv.config.MaxPublishRate != config.MaxPublishRate ||
+		srv.config.MaxPublishBytesRate != config.MaxPublishBytesRate ||
+		srv.config.PublishRateLimitPolicy != config.PublishRateLimitPolicy
+	srv.config.MaxPublishRate = config.MaxPublishRate
+	srv.config.MaxPublishBytesRate = config.MaxPublishBytesRate
+	srv.config.PublishRateLimitPolicy = config.PublishRateLimitPolicy
+	srv.configMu.Unlock()
+	if changed {
+		atomic.AddUint64(&srv.rateLimitGen, 1)
+	}
+	var errs []string
+	for _, p := range srv.pluginService.loaded() {
+		r, ok := p.(Reloader)
+		if !ok {
+			continue
+		}
+		if err := r.Reload(); err != nil {
+			serverLog().Error("plugin reload error", zap.String("name", p.Name()), zap.Error(err))
+			errs = append(errs, fmt.Sprintf("plugin %s: %s", p.Name(), err))
+		}
+	}
+	serverLog().Info("config reloaded")
+	if len(errs) != 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// SetLogLevel changes the level of the logger, it requires the level of the logger is set by WithLogLevel.
+func (srv *server) SetLogLevel(level zapcore.Level) error {
+	if srv.logLevel == nil {
+		return ErrLogLevelNotSet
+	}
+	srv.logLevel.SetLevel(level)
+	serverLog().Info("log level changed", zap.String("level", level.String()))
+	return nil
+}
+
+// AddListener serves the tcp listener. The listener is served once the server runs if it is not running yet,
+// the same as WithTCPListener.
+func (srv *server) AddListener(l net.Listener) error {
+	select {
+	case <-srv.exitChan:
+		return ErrServerStopped
+	default:
+	}
+	srv.listenerMu.Lock()
+	defer srv.listenerMu.Unlock()
+	srv.tcpListener = append(srv.tcpListener, l)
+	if srv.Status() == serverStatusStarted {
+		go srv.serveTCP(l)
+		serverLog().Info("listener added", zap.String("listener", tcpListenerName(l)))
+	}
+	return nil
+}
+
+// RemoveListener stops accepting the connections of the tcp listener and drains its connections:
+// it waits for the clients connected through the listener to disconnect, and closes the remaining clients
+// when the ctx is done. ctx.Err() is returned if the clients are closed by force.
+func (srv *server) RemoveListener(ctx context.Context, l net.Listener) error {
+	srv.listenerMu.Lock()
+	found := false
+	for i, v := range srv.tcpListener {
+		if v == l {
+			srv.tcpListener = append(srv.tcpListener[:i:i], srv.tcpListener[i+1:]...)
+			found = true
+			break
+		}
+	}
+	srv.listenerMu.Unlock()
+	if !found {
+		return ErrListenerNotFound
+	}
+	name := tcpListenerName(l)
+	l.Close()
+	serverLog().Info("listener removed, draining connections", zap.String("listener", name))
+	t := time.NewTicker(drainCheckInterval)
+	defer t.Stop()
+	for {
+		clients := srv.listenerClients(l)
+		if len(clients) == 0 {
+			serverLog().Info("listener drained", zap.String("listener", name))
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			serverLog().Warn("listener drain timeout, closing the remaining clients",
+				zap.String("listener", name), zap.Int("clients", len(clients)))
+			for _, c := range clients {
+				<-c.Close()
+			}
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+// listenerClients returns the online clients accepted by the listener.
+func (srv *server) listenerClients(l net.Listener) []*client {
+	srv.mu.RLock()
+	defer srv.mu.RUnlock()
+	var clients []*client
+	for _, c := range srv.clients {
+		if c.ln == l {
+			clients = append(clients, c)
+		}
+	}
+	return clients
+}
@@ -0,0 +1,135 @@
+package gmqtt
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
+	"github.com/DrmagicE/gmqtt/pkg/packets"
+)
+
+type testReloader struct {
+	name     string
+	err      error
+	reloaded int
+}
+
+func (r *testReloader) Load(service Server) error {
+	return nil
+}
+
+func (r *testReloader) Unload() error {
+	return nil
+}
+
+func (r *testReloader) HookWrapper() HookWrapper {
+	return HookWrapper{}
+}
+
+func (r *testReloader) Name() string {
+	return r.name
+}
+
+func (r *testReloader) Reload() error {
+	r.reloaded++
+	return r.err
+}
+
+func TestReloadConfig(t *testing.T) {
+	a := assert.New(t)
+	ok := &testReloader{name: "ok"}
+	failed := &testReloader{name: "failed", err: errors.New("reload error")}
+	closed := make(chan error, 1)
+	srv := NewServer(WithPlugin(failed, ok), WithHook(Hooks{
+		OnClose: func(ctx context.Context, client Client, err error) {
+			closed <- err
+		},
+	}))
+	srv.tcpListener = append(srv.tcpListener, &testListener{acceptReady: make(chan struct{})})
+	defer srv.Stop(context.Background())
+	srv.Run()
+	c := connectTestClient(srv, defaultConnectPacket())
+
+	config := srv.GetConfig()
+	config.MaxPublishRate = -1
+	a.Error(srv.ReloadConfig(config))
+
+	config.MaxPublishRate = 1
+	config.PublishRateLimitPolicy = RateLimitDisconnect
+	err := srv.ReloadConfig(config)
+	a.EqualError(err, "plugin failed: reload error")
+	a.Equal(1, ok.reloaded)
+	a.Equal(1, failed.reloaded)
+	a.EqualValues(1, srv.GetConfig().MaxPublishRate)
+	a.Equal(RateLimitDisconnect, srv.GetConfig().PublishRateLimitPolicy)
+
+	// the reloaded rate limit is applied to the online client.
+	for i := 0; i < 3; i++ {
+		writePacket(c, &packets.Publish{TopicName: []byte("a/b"), Payload: []byte("a"), Qos: packets.QOS_0})
+	}
+	select {
+	case err := <-closed:
+		a.Equal(ErrRateLimitExceeded, err)
+	case <-time.After(time.Second):
+		t.Fatal("OnClose timeout")
+	}
+}
+
+func TestSetLogLevel(t *testing.T) {
+	a := assert.New(t)
+	srv := NewServer()
+	a.Equal(ErrLogLevelNotSet, srv.SetLogLevel(zapcore.DebugLevel))
+
+	level := zap.NewAtomicLevelAt(zapcore.InfoLevel)
+	srv = NewServer(WithLogLevel(level))
+	a.NoError(srv.SetLogLevel(zapcore.DebugLevel))
+	a.Equal(zapcore.DebugLevel, level.Level())
+}
+
+func TestAddRemoveListener(t *testing.T) {
+	a := assert.New(t)
+	closed := make(chan struct{}, 1)
+	srv := NewServer(WithHook(Hooks{
+		OnClose: func(ctx context.Context, client Client, err error) {
+			closed <- struct{}{}
+		},
+	}))
+	defer srv.Stop(context.Background())
+	srv.Run()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	a.NoError(srv.AddListener(ln))
+	c, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer c.Close()
+	packets.NewWriter(c).WriteAndFlush(defaultConnectPacket())
+	c.SetReadDeadline(time.Now().Add(time.Second))
+	p, err := packets.NewReader(c).ReadPacket()
+	a.NoError(err)
+	a.EqualValues(packets.CodeAccepted, p.(*packets.Connack).Code)
+
+	// the connection is closed by force after the ctx is done.
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	a.Equal(context.DeadlineExceeded, srv.RemoveListener(ctx, ln))
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("OnClose timeout")
+	}
+	a.Nil(srv.Client("MQTT"))
+	_, err = net.Dial("tcp", ln.Addr().String())
+	a.Error(err)
+	a.Equal(ErrListenerNotFound, srv.RemoveListener(context.Background(), ln))
+}
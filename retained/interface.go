@@ -8,6 +8,12 @@ import (
 // Return false means to stop the iteration.
 type IterateFn func(message packets.Message) bool
 
+// Stats is the statistics information of the store
+type Stats struct {
+	// MessagesCurrent shows the current retained message number in the store.
+	MessagesCurrent uint64
+}
+
 // Store is the interface used by gmqtt.server and external logic to handler the operations of retained messages.
 // User can get the implementation from gmqtt.Server interface.
 // This interface provides the ability for extensions to interact with the retained message store.
@@ -31,4 +37,6 @@ type Store interface {
 	// This method will walk through all retained messages,
 	// so this will be a expensive operation if there are a large number of retained messages.
 	Iterate(fn IterateFn)
+	// GetStats returns the stats of the store.
+	GetStats() Stats
 }
@@ -0,0 +1,243 @@
+// Package redis provides a retained.Store implementation which persists the retained messages in redis,
+// so the retained messages survive the broker restarts and can be shared across multiple broker instances.
+package redis
+
+import (
+	"encoding/json"
+
+	redigo "github.com/gomodule/redigo/redis"
+	"go.uber.org/zap"
+
+	"github.com/DrmagicE/gmqtt/pkg/packets"
+	"github.com/DrmagicE/gmqtt/retained"
+)
+
+var _ retained.Store = (*Store)(nil)
+
+// DefaultKeyPrefix is the default prefix of the redis keys used by the Store.
+const DefaultKeyPrefix = "gmqtt:retained:"
+
+// keyMessages is the HASH of topic name -> encoded message.
+const keyMessages = "messages"
+
+// message is the packets.Message decoded from redis, it is also the JSON format of the stored message.
+type message struct {
+	D   bool             `json:"dup"`
+	Q   uint8            `json:"qos"`
+	R   bool             `json:"retained"`
+	T   string           `json:"topic"`
+	PID packets.PacketID `json:"packet_id"`
+	P   []byte           `json:"payload"`
+}
+
+func (m *message) Dup() bool {
+	return m.D
+}
+
+func (m *message) Qos() uint8 {
+	return m.Q
+}
+
+func (m *message) Retained() bool {
+	return m.R
+}
+
+func (m *message) Topic() string {
+	return m.T
+}
+
+func (m *message) PacketID() packets.PacketID {
+	return m.PID
+}
+
+func (m *message) Payload() []byte {
+	return m.P
+}
+
+func encode(msg packets.Message) ([]byte, error) {
+	return json.Marshal(&message{
+		D:   msg.Dup(),
+		Q:   msg.Qos(),
+		R:   msg.Retained(),
+		T:   msg.Topic(),
+		PID: msg.PacketID(),
+		P:   msg.Payload(),
+	})
+}
+
+func decode(b []byte) (*message, error) {
+	m := &message{}
+	if err := json.Unmarshal(b, m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Option is the option of the Store.
+type Option func(s *Store)
+
+// WithKeyPrefix sets the prefix of the redis keys, default to DefaultKeyPrefix.
+// The brokers which share the retained messages must use the same prefix.
+func WithKeyPrefix(prefix string) Option {
+	return func(s *Store) {
+		s.prefix = prefix
+	}
+}
+
+// WithLogger sets the logger which is used to log the redis errors, default to zap.L().
+func WithLogger(logger *zap.Logger) Option {
+	return func(s *Store) {
+		s.log = logger
+	}
+}
+
+// Store is the redis backed retained.Store.
+// Notice:
+// The methods of the retained.Store interface can not return an error,
+// the redis errors are logged and the methods return the empty results.
+type Store struct {
+	pool   *redigo.Pool
+	prefix string
+	log    *zap.Logger
+}
+
+// New returns a Store which uses the connections from the pool.
+func New(pool *redigo.Pool, opts ...Option) *Store {
+	s := &Store{
+		pool:   pool,
+		prefix: DefaultKeyPrefix,
+		log:    zap.L(),
+	}
+	for _, fn := range opts {
+		fn(s)
+	}
+	return s
+}
+
+func (s *Store) key() string {
+	return s.prefix + keyMessages
+}
+
+func (s *Store) logError(msg string, err error, fields ...zap.Field) {
+	s.log.Error(msg, append(fields, zap.Error(err))...)
+}
+
+// GetRetainedMessage return the retain message of the given topic name.
+// return nil if the topic name not exists
+func (s *Store) GetRetainedMessage(topicName string) packets.Message {
+	conn := s.pool.Get()
+	defer conn.Close()
+	b, err := redigo.Bytes(conn.Do("HGET", s.key(), topicName))
+	if err == redigo.ErrNil {
+		return nil
+	}
+	if err == nil {
+		var m *message
+		if m, err = decode(b); err == nil {
+			return m
+		}
+	}
+	s.logError("redis get retained message error", err, zap.String("topic", topicName))
+	return nil
+}
+
+// ClearAll clear all retain messages.
+func (s *Store) ClearAll() {
+	conn := s.pool.Get()
+	defer conn.Close()
+	if _, err := conn.Do("DEL", s.key()); err != nil {
+		s.logError("redis clear all error", err)
+	}
+}
+
+// AddOrReplace add or replace a retain message.
+func (s *Store) AddOrReplace(msg packets.Message) {
+	b, err := encode(msg)
+	if err != nil {
+		s.logError("encode retained message error", err, zap.String("topic", msg.Topic()))
+		return
+	}
+	conn := s.pool.Get()
+	defer conn.Close()
+	if _, err := conn.Do("HSET", s.key(), msg.Topic(), b); err != nil {
+		s.logError("redis add retained message error", err, zap.String("topic", msg.Topic()))
+	}
+}
+
+// Remove remove the retain message of the topic name.
+func (s *Store) Remove(topicName string) {
+	conn := s.pool.Get()
+	defer conn.Close()
+	if _, err := conn.Do("HDEL", s.key(), topicName); err != nil {
+		s.logError("redis remove retained message error", err, zap.String("topic", topicName))
+	}
+}
+
+// scan iterates the retained messages until fn returns false.
+func (s *Store) scan(fn func(m *message) bool) error {
+	conn := s.pool.Get()
+	defer conn.Close()
+	cursor := "0"
+	for {
+		values, err := redigo.Values(conn.Do("HSCAN", s.key(), cursor))
+		if err != nil {
+			return err
+		}
+		var fields [][]byte
+		if _, err := redigo.Scan(values, &cursor, &fields); err != nil {
+			return err
+		}
+		// fields is a flat list of topic name and message pairs.
+		for i := 1; i < len(fields); i += 2 {
+			m, err := decode(fields[i])
+			if err != nil {
+				return err
+			}
+			if !fn(m) {
+				return nil
+			}
+		}
+		if cursor == "0" {
+			return nil
+		}
+	}
+}
+
+// GetMatchedMessages returns all messages that match the topic filter.
+// Notice:
+// All retained messages are scanned to find the matched ones.
+func (s *Store) GetMatchedMessages(topicFilter string) []packets.Message {
+	var rs []packets.Message
+	err := s.scan(func(m *message) bool {
+		if packets.TopicMatch([]byte(m.T), []byte(topicFilter)) {
+			rs = append(rs, m)
+		}
+		return true
+	})
+	if err != nil {
+		s.logError("redis get matched messages error", err, zap.String("topic", topicFilter))
+		return nil
+	}
+	return rs
+}
+
+// Iterate iterate all retained messages.
+func (s *Store) Iterate(fn retained.IterateFn) {
+	err := s.scan(func(m *message) bool {
+		return fn(m)
+	})
+	if err != nil {
+		s.logError("redis iterate error", err)
+	}
+}
+
+// GetStats returns the stats of the store.
+func (s *Store) GetStats() retained.Stats {
+	conn := s.pool.Get()
+	defer conn.Close()
+	n, err := redigo.Uint64(conn.Do("HLEN", s.key()))
+	if err != nil {
+		s.logError("redis get stats error", err)
+	}
+	return retained.Stats{MessagesCurrent: n}
+}
@@ -0,0 +1,74 @@
+package redis
+
+import (
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	redigo "github.com/gomodule/redigo/redis"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/DrmagicE/gmqtt/pkg/packets"
+	"github.com/DrmagicE/gmqtt/retained"
+)
+
+func newTestStore(t *testing.T, opts ...Option) (*Store, *miniredis.Miniredis) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := mr.Addr()
+	pool := &redigo.Pool{
+		Dial: func() (redigo.Conn, error) {
+			return redigo.Dial("tcp", addr)
+		},
+	}
+	return New(pool, opts...), mr
+}
+
+func TestStore(t *testing.T) {
+	a := assert.New(t)
+	s, mr := newTestStore(t)
+	defer mr.Close()
+
+	msgs := []*message{
+		{T: "a/b", Q: packets.QOS_1, R: true, PID: 1, P: []byte{1, 2, 3}},
+		{T: "a/c", Q: packets.QOS_0, R: true},
+		{T: "$SYS/a", Q: packets.QOS_2, R: true, P: []byte("sys")},
+	}
+	for _, v := range msgs {
+		s.AddOrReplace(v)
+	}
+	a.Equal(msgs[0], s.GetRetainedMessage("a/b"))
+	a.Nil(s.GetRetainedMessage("a"))
+	a.ElementsMatch([]packets.Message{msgs[0], msgs[1]}, s.GetMatchedMessages("a/+"))
+	a.ElementsMatch([]packets.Message{msgs[2]}, s.GetMatchedMessages("$SYS/#"))
+	a.Equal(retained.Stats{MessagesCurrent: 3}, s.GetStats())
+
+	replaced := &message{T: "a/b", Q: packets.QOS_0, R: true, P: []byte{4}}
+	s.AddOrReplace(replaced)
+	a.Equal(replaced, s.GetRetainedMessage("a/b"))
+	a.Equal(retained.Stats{MessagesCurrent: 3}, s.GetStats())
+
+	var rs []packets.Message
+	s.Iterate(func(message packets.Message) bool {
+		rs = append(rs, message)
+		return true
+	})
+	a.ElementsMatch([]packets.Message{replaced, msgs[1], msgs[2]}, rs)
+
+	s.Remove("a/b")
+	a.Nil(s.GetRetainedMessage("a/b"))
+	a.Equal(retained.Stats{MessagesCurrent: 2}, s.GetStats())
+
+	s.ClearAll()
+	a.Len(s.GetMatchedMessages("#"), 0)
+	a.Equal(retained.Stats{}, s.GetStats())
+}
+
+func TestStore_KeyPrefix(t *testing.T) {
+	a := assert.New(t)
+	s, mr := newTestStore(t, WithKeyPrefix("broker0:"))
+	defer mr.Close()
+	s.AddOrReplace(&message{T: "a"})
+	a.True(mr.Exists("broker0:" + keyMessages))
+}
@@ -0,0 +1,86 @@
+package trie
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/DrmagicE/gmqtt/pkg/packets"
+)
+
+// linearStore matches the topic filter by iterating all retained messages,
+// it is the baseline to compare with the trie.
+type linearStore struct {
+	msgs map[string]packets.Message // [topicName]
+}
+
+func (l *linearStore) getMatchedMessages(topicFilter string) []packets.Message {
+	var rs []packets.Message
+	for topicName, msg := range l.msgs {
+		if packets.TopicMatch([]byte(topicName), []byte(topicFilter)) {
+			rs = append(rs, msg)
+		}
+	}
+	return rs
+}
+
+// benchmarkMessages returns n retained messages like "device/{i}/temperature" and "device/{i}/humidity" for n/2 devices.
+func benchmarkMessages(n int) []packets.Message {
+	msgs := make([]packets.Message, 0, n)
+	for i := 0; len(msgs) < n; i++ {
+		id := strconv.Itoa(i)
+		msgs = append(msgs,
+			&mockMsg{topic: "device/" + id + "/temperature", payload: []byte{1}},
+			&mockMsg{topic: "device/" + id + "/humidity", payload: []byte{2}},
+		)
+	}
+	return msgs[:n]
+}
+
+func benchmarkGetMatchedMessages(b *testing.B, n int, topicFilter string, expected int, linear bool) {
+	msgs := benchmarkMessages(n)
+	var match func(topicFilter string) []packets.Message
+	if linear {
+		l := &linearStore{msgs: make(map[string]packets.Message)}
+		for _, v := range msgs {
+			l.msgs[v.Topic()] = v
+		}
+		match = l.getMatchedMessages
+	} else {
+		db := NewStore()
+		for _, v := range msgs {
+			db.AddOrReplace(v)
+		}
+		match = db.GetMatchedMessages
+	}
+	if len(match(topicFilter)) != expected {
+		b.Fatalf("unexpected matched result")
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		match(topicFilter)
+	}
+}
+
+func BenchmarkGetMatchedMessages_Trie_Single_100000(b *testing.B) {
+	benchmarkGetMatchedMessages(b, 100000, "device/100/+", 2, false)
+}
+
+func BenchmarkGetMatchedMessages_Linear_Single_100000(b *testing.B) {
+	benchmarkGetMatchedMessages(b, 100000, "device/100/+", 2, true)
+}
+
+func BenchmarkGetMatchedMessages_Trie_Level_100000(b *testing.B) {
+	benchmarkGetMatchedMessages(b, 100000, "device/+/temperature", 50000, false)
+}
+
+func BenchmarkGetMatchedMessages_Linear_Level_100000(b *testing.B) {
+	benchmarkGetMatchedMessages(b, 100000, "device/+/temperature", 50000, true)
+}
+
+func BenchmarkGetMatchedMessages_Trie_All_100000(b *testing.B) {
+	benchmarkGetMatchedMessages(b, 100000, "#", 100000, false)
+}
+
+func BenchmarkGetMatchedMessages_Linear_All_100000(b *testing.B) {
+	benchmarkGetMatchedMessages(b, 100000, "#", 100000, true)
+}
@@ -64,11 +64,8 @@ func (t *topicTrie) matchTopic(topicSlice []string, fn retained.IterateFn) {
 	endFlag := len(topicSlice) == 1
 	switch topicSlice[0] {
 	case "#":
-		if t.parent != nil {
-			t.parent.preOrderTraverse(fn)
-		} else {
-			t.preOrderTraverse(fn)
-		}
+		// "#" matches the parent level and all child levels, t is the node of the parent level.
+		t.preOrderTraverse(fn)
 	case "+":
 		// 当前层的所有
 		for _, v := range t.children {
@@ -109,8 +106,8 @@ func isSystemTopic(topicName string) bool {
 	return len(topicName) >= 1 && topicName[0] == '$'
 }
 
-// addRetainMsg add a retain message
-func (t *topicTrie) addRetainMsg(topicName string, message packets.Message) {
+// addRetainMsg add a retain message, returns true if the topic name has no retained message before.
+func (t *topicTrie) addRetainMsg(topicName string, message packets.Message) bool {
 	topicSlice := strings.Split(topicName, "/")
 	var pNode = t
 	for _, lv := range topicSlice {
@@ -119,11 +116,14 @@ func (t *topicTrie) addRetainMsg(topicName string, message packets.Message) {
 		}
 		pNode = pNode.children[lv]
 	}
+	added := pNode.msg == nil
 	pNode.msg = message
 	pNode.topicName = topicName
+	return added
 }
 
-func (t *topicTrie) remove(topicName string) {
+// remove removes the retain message, returns true if the message exists.
+func (t *topicTrie) remove(topicName string) bool {
 	topicSlice := strings.Split(topicName, "/")
 	l := len(topicSlice)
 	var pNode = t
@@ -131,15 +131,18 @@ func (t *topicTrie) remove(topicName string) {
 		if _, ok := pNode.children[lv]; ok {
 			pNode = pNode.children[lv]
 		} else {
-			return
+			return false
 		}
 	}
+	removed := pNode.msg != nil
 	pNode.msg = nil
 	if len(pNode.children) == 0 {
 		delete(pNode.parent.children, topicSlice[l-1])
 	}
+	return removed
 }
 
+// preOrderTraverse calls fn for each message of the subtree, returns false if the traverse is stopped by fn.
 func (t *topicTrie) preOrderTraverse(fn retained.IterateFn) bool {
 	if t == nil {
 		return false
@@ -149,8 +152,14 @@ func (t *topicTrie) preOrderTraverse(fn retained.IterateFn) bool {
 			return false
 		}
 	}
+	// ranging over an empty map is not free, skip the leaves.
+	if len(t.children) == 0 {
+		return true
+	}
 	for _, c := range t.children {
-		c.preOrderTraverse(fn)
+		if !c.preOrderTraverse(fn) {
+			return false
+		}
 	}
-	return false
+	return true
 }
@@ -12,6 +12,7 @@ type trieDB struct {
 	sync.RWMutex
 	userTrie   *topicTrie
 	systemTrie *topicTrie
+	stats      retained.Stats
 }
 
 func (t *trieDB) Iterate(fn retained.IterateFn) {
@@ -48,20 +49,25 @@ func (t *trieDB) ClearAll() {
 	defer t.Unlock()
 	t.systemTrie = newTopicTrie()
 	t.userTrie = newTopicTrie()
+	t.stats = retained.Stats{}
 }
 
 // AddOrReplace add or replace a retain message.
 func (t *trieDB) AddOrReplace(message packets.Message) {
 	t.Lock()
 	defer t.Unlock()
-	t.getTrie(message.Topic()).addRetainMsg(message.Topic(), message)
+	if t.getTrie(message.Topic()).addRetainMsg(message.Topic(), message) {
+		t.stats.MessagesCurrent++
+	}
 }
 
 // Remove remove the retain message of the topic name.
 func (t *trieDB) Remove(topicName string) {
 	t.Lock()
 	defer t.Unlock()
-	t.getTrie(topicName).remove(topicName)
+	if t.getTrie(topicName).remove(topicName) {
+		t.stats.MessagesCurrent--
+	}
 }
 
 // GetMatchedMessages returns all messages that match the topic filter.
@@ -71,6 +77,13 @@ func (t *trieDB) GetMatchedMessages(topicFilter string) []packets.Message {
 	return t.getTrie(topicFilter).getMatchedMessages(topicFilter)
 }
 
+// GetStats returns the stats of the store.
+func (t *trieDB) GetStats() retained.Stats {
+	t.RLock()
+	defer t.RUnlock()
+	return t.stats
+}
+
 func NewStore() *trieDB {
 	return &trieDB{
 		userTrie:   newTopicTrie(),
@@ -243,3 +243,56 @@ func TestTrieDB_Iterate(t *testing.T) {
 	a.ElementsMatch(msgs, rs)
 
 }
+
+func TestTrieDB_GetStats(t *testing.T) {
+	a := assert.New(t)
+	s := NewStore()
+	s.AddOrReplace(&mockMsg{topic: "a/b"})
+	s.AddOrReplace(&mockMsg{topic: "a/b", payload: []byte{1}})
+	s.AddOrReplace(&mockMsg{topic: "$SYS/a"})
+	a.EqualValues(2, s.GetStats().MessagesCurrent)
+
+	s.Remove("a")
+	s.Remove("not/exists")
+	a.EqualValues(2, s.GetStats().MessagesCurrent)
+	s.Remove("a/b")
+	a.EqualValues(1, s.GetStats().MessagesCurrent)
+
+	s.ClearAll()
+	a.EqualValues(0, s.GetStats().MessagesCurrent)
+}
+
+func TestTrieDB_GetMatchedMessages_Siblings(t *testing.T) {
+	a := assert.New(t)
+	s := NewStore()
+	ab := &mockMsg{topic: "a/b"}
+	s.AddOrReplace(ab)
+	s.AddOrReplace(&mockMsg{topic: "b/c"})
+	s.AddOrReplace(&mockMsg{topic: "$SYS/a"})
+	// "a/#" must not match the sibling "b/c".
+	a.ElementsMatch([]packets.Message{ab}, s.GetMatchedMessages("a/#"))
+	a.ElementsMatch([]packets.Message{ab}, s.GetMatchedMessages("+/b/#"))
+	a.Len(s.GetMatchedMessages("#"), 2)
+}
+
+func TestTrieDB_Iterate_SystemTopicsAndStop(t *testing.T) {
+	a := assert.New(t)
+	s := NewStore()
+	s.AddOrReplace(&mockMsg{topic: "a/b"})
+	s.AddOrReplace(&mockMsg{topic: "a/c"})
+	s.AddOrReplace(&mockMsg{topic: "$SYS/a"})
+
+	var n int
+	s.Iterate(func(message packets.Message) bool {
+		n++
+		return true
+	})
+	a.Equal(3, n)
+
+	n = 0
+	s.Iterate(func(message packets.Message) bool {
+		n++
+		return false
+	})
+	a.Equal(1, n)
+}
@@ -6,17 +6,27 @@ import (
 	"net"
 	"net/http"
 	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 
 	retained_trie "github.com/DrmagicE/gmqtt/retained/trie"
 	subscription_trie "github.com/DrmagicE/gmqtt/subscription/trie"
 
+	persistence_ban "github.com/DrmagicE/gmqtt/persistence/ban"
+	persistence_delayed "github.com/DrmagicE/gmqtt/persistence/delayed"
+	"github.com/DrmagicE/gmqtt/persistence/inflight"
+	"github.com/DrmagicE/gmqtt/persistence/queue"
+	persistence_session "github.com/DrmagicE/gmqtt/persistence/session"
 	"github.com/DrmagicE/gmqtt/pkg/packets"
+	"github.com/DrmagicE/gmqtt/pkg/timerwheel"
 	"github.com/DrmagicE/gmqtt/retained"
 	"github.com/DrmagicE/gmqtt/subscription"
 )
@@ -34,22 +44,23 @@ const (
 	DefaultUnRegisterLen = 2048
 )
 
+// expiryWheelSlots is the number of slots of the session expiry timer wheel.
+const expiryWheelSlots = 3600
+
 // Server status
 const (
 	serverStatusInit = iota
 	serverStatusStarted
 )
 
-var zaplog *zap.Logger
-
 func init() {
-	zaplog = zap.NewNop()
+	setLogger(zap.NewNop())
 }
 
 // LoggerWithField add fields to a new logger.
-// Plugins can use this method to add plugin name field.
+// Plugins can use this method to add plugin name field, use Logger to support the per-module log level.
 func LoggerWithField(fields ...zap.Field) *zap.Logger {
-	return zaplog.With(fields...)
+	return currentLoggers().root.With(fields...)
 }
 
 // Server interface represents a mqtt server instance.
@@ -60,21 +71,66 @@ type Server interface {
 	RetainedStore() retained.Store
 	// PublishService returns the PublishService
 	PublishService() PublishService
+	// WillService returns the WillService
+	WillService() WillService
 	// Client return the client specified by clientID.
 	Client(clientID string) Client
 	// GetConfig returns the config of the server
 	GetConfig() Config
 	// GetStatsManager returns StatsManager
 	GetStatsManager() StatsManager
+	// SetQueueLimits overrides the message queue limits of the client specified by clientID,
+	// nil means using the limits in Config. The limits are kept across the sessions of the client.
+	SetQueueLimits(clientID string, limits *QueueLimits)
+	// ResolveDelivery returns the subscribers which match the topic name, key by client id.
+	// This is useful to preview where a message would be delivered to.
+	ResolveDelivery(topicName string) map[string]DeliveryTarget
+	// BanService returns the BanService
+	BanService() BanService
+	// TraceService returns the TraceService
+	TraceService() TraceService
+	// ClientService returns the ClientService
+	ClientService() ClientService
+	// PluginService returns the PluginService
+	PluginService() PluginService
+	// HistoryService returns the HistoryService
+	HistoryService() HistoryService
+	// ReloadConfig applies the reloadable fields of the config and reloads the plugins which implement Reloader.
+	ReloadConfig(config Config) error
+	// SetLogLevel changes the level of the logger at runtime, see WithLogLevel.
+	SetLogLevel(level zapcore.Level) error
+	// AddListener serves the tcp listener at runtime.
+	AddListener(l net.Listener) error
+	// RemoveListener stops the tcp listener and drains its connections until the ctx is done.
+	RemoveListener(ctx context.Context, l net.Listener) error
+	// SetModuleLogLevel overrides the log level of the module at runtime, see Logger.
+	SetModuleLogLevel(module string, level zapcore.Level)
+	// ResetModuleLogLevel removes the log level override of the module.
+	ResetModuleLogLevel(module string)
+	// ModuleLogLevels returns the overridden log levels of the modules.
+	ModuleLogLevels() map[string]zapcore.Level
+}
+
+// DeliveryTarget is a subscriber returned by Server.ResolveDelivery.
+type DeliveryTarget struct {
+	// Topics is the matched subscriptions of the subscriber.
+	Topics []packets.Topic
+	// Online shows whether the session of the subscriber is online.
+	// The messages to an offline subscriber are queued in its session.
+	// If the subscriber has no session, Online is false as well.
+	Online bool
 }
 
 // server represents a mqtt server instance.
 // Create a server by using NewServer()
 type server struct {
-	wg      sync.WaitGroup
-	mu      sync.RWMutex //gard clients & offlineClients map
-	status  int32        //server status
-	clients map[string]*client
+	// rateLimitGen is increased when the rate limits are reloaded, the clients rebuild their rate limiters then.
+	// It is the first field to be 64-bit aligned for the atomic operations.
+	rateLimitGen uint64
+	wg           sync.WaitGroup
+	mu           sync.RWMutex //gard clients & offlineClients map
+	status       int32        //server status
+	clients      map[string]*client
 	// offlineClients store the disconnected time of all disconnected clients
 	// with valid session(not expired). Key by clientID
 	offlineClients  map[string]time.Time
@@ -84,6 +140,20 @@ type server struct {
 
 	retainedDB      retained.Store
 	subscriptionsDB subscription.Store //store subscriptions
+	// sessionStore and queueStore persist the offline sessions, nil means the persistence is disabled.
+	sessionStore persistence_session.Store
+	queueStore   queue.Store
+	// inflightStore persists the inflight messages of the online sessions, nil means the inflight messages
+	// are only persisted when the clients disconnect.
+	inflightStore inflight.Store
+	// banStore persists the bans, nil means the bans are not persisted.
+	banStore persistence_ban.Store
+	// delayedStore persists the pending delayed messages, nil means the delayed messages are not persisted.
+	delayedStore persistence_delayed.Store
+	// expiryWheel schedules the expiry of the offline sessions, nil means the sessions never expire.
+	expiryWheel *timerwheel.TimerWheel
+	// deferredUnregisters are the unregisters received by waitTakenOver, they are only accessed by the event loop.
+	deferredUnregisters []*unregister
 
 	msgRouter  chan *msgRouter
 	register   chan *register   //register session
@@ -91,9 +161,47 @@ type server struct {
 	config     Config
 	hooks      Hooks
 	plugins    []Plugable
-
-	statsManager   StatsManager
+	// authSem limits the number of concurrent OnConnect calls, nil means no limit.
+	authSem chan struct{}
+	// connQuota counts the connections of the source addresses, nil means no limit.
+	connQuota *connQuota
+	// overload is the overload protector, nil means the overload protection is disabled.
+	overload *overloadProtector
+
+	statsManager StatsManager
+	// topicStats is the statistics of the topics, nil if Config.MaxTopicStats is 0.
+	topicStats     *topicStats
 	publishService PublishService
+	willService    *willService
+	banService     *banService
+	traceService   *traceService
+	clientService  *clientService
+	pluginService  *pluginService
+	delayedService *delayedService
+	historyService *historyService
+	// fanOut is the fan-out worker pool, nil if Config.FanOutWorkers is 0.
+	fanOut *fanOut
+
+	tracerProvider trace.TracerProvider
+	meterProvider  metric.MeterProvider
+	telemetry      *telemetry
+
+	subStatesMu sync.RWMutex
+	// subStates is the states of the subscriptions modified by OnSubscribeRewrite, clientID => topic filter => state.
+	subStates map[string]map[string]subscriptionState
+
+	queueLimitsMu sync.RWMutex
+	// queueLimits is the message queue limits of the clients which override the limits in config.
+	queueLimits map[string]QueueLimits
+
+	// configMu guards the reloadable fields of config, see ReloadConfig.
+	configMu sync.RWMutex
+	// logLevel is the level of the logger which can be changed by SetLogLevel, nil means it can not be changed.
+	logLevel *zap.AtomicLevel
+	// listenerMu guards tcpListener, which can be changed by AddListener and RemoveListener.
+	listenerMu sync.Mutex
+	// listenerProfiles is the profiles of the tcp listeners, see WithListenerProfile.
+	listenerProfiles map[net.Listener]*ListenerProfile
 }
 
 func (srv *server) SubscriptionStore() subscription.Store {
@@ -108,6 +216,24 @@ func (srv *server) PublishService() PublishService {
 	return srv.publishService
 }
 
+func (srv *server) WillService() WillService {
+	return srv.willService
+}
+
+func (srv *server) BanService() BanService {
+	return srv.banService
+}
+
+// TraceService returns the TraceService
+func (srv *server) TraceService() TraceService {
+	return srv.traceService
+}
+
+// ClientService returns the ClientService
+func (srv *server) ClientService() ClientService {
+	return srv.clientService
+}
+
 func (srv *server) checkStatus() {
 	if srv.Status() != serverStatusInit {
 		panic(statusPanic)
@@ -121,10 +247,58 @@ const (
 	OnlyOnce DeliveryMode = 1
 )
 
+// DeliveryOrder is the order between the queued messages and the live messages of a resumed session.
+type DeliveryOrder int
+
+const (
+	// CatchUpFirst delivers all queued messages of a resumed session before the live messages.
+	CatchUpFirst DeliveryOrder = 0
+	// Interleave delivers the queued messages of a resumed session in background,
+	// the live messages can be delivered before the queued messages.
+	// The queued messages are still delivered in order.
+	Interleave DeliveryOrder = 1
+)
+
+// QueueDropPolicy is the policy to choose the message to drop when the message queue of a session is full.
+type QueueDropPolicy int
+
+const (
+	// DropQos0First drops the QoS 0 message in the queue first, then the QoS 0 message that is going to enqueue,
+	// then the oldest message in the queue.
+	DropQos0First QueueDropPolicy = 0
+	// DropOldest drops the oldest message in the queue.
+	DropOldest QueueDropPolicy = 1
+	// DropNewest drops the message that is going to enqueue.
+	DropNewest QueueDropPolicy = 2
+)
+
+// QueueLimits is the limits of the message queue of a session.
+type QueueLimits struct {
+	// MaxMsgQueue is the maximum number of the queued messages, 0 means no limit.
+	MaxMsgQueue int
+	// MaxMsgQueueBytes is the maximum total size in bytes of the topic names and payloads of the queued messages,
+	// 0 means no limit.
+	MaxMsgQueueBytes int
+	// DropPolicy is the policy to choose the message to drop when the queue is full.
+	DropPolicy QueueDropPolicy
+}
+
+// RetainedOverQuotaPolicy is the policy for the retained PUBLISH which exceeds the retained message limits.
+type RetainedOverQuotaPolicy int
+
+const (
+	// RetainedDiscard delivers the message to the subscribers but does not retain it.
+	RetainedDiscard RetainedOverQuotaPolicy = 0
+	// RetainedDropMessage drops the message, it is neither retained nor delivered.
+	RetainedDropMessage RetainedOverQuotaPolicy = 1
+)
+
 type Config struct {
-	RetryInterval              time.Duration
-	RetryCheckInterval         time.Duration
-	SessionExpiryInterval      time.Duration
+	RetryInterval      time.Duration
+	RetryCheckInterval time.Duration
+	// SessionExpiryInterval is the duration after which an offline session expires, 0 means never expire.
+	SessionExpiryInterval time.Duration
+	// SessionExpiryCheckInterval is the precision of the session expiry, default to 1 second if it is 0.
 	SessionExpiryCheckInterval time.Duration
 	QueueQos0Messages          bool
 	MaxInflight                int
@@ -134,6 +308,182 @@ type Config struct {
 	MsgRouterLen               int
 	RegisterLen                int
 	UnregisterLen              int
+	// MaxConcurrentAuth is the maximum number of OnConnect hook calls that can be in progress at the same time.
+	// 0 means no limit.
+	MaxConcurrentAuth int
+	// AuthWaitTimeout is how long a connecting client waits for a free authentication slot
+	// when MaxConcurrentAuth is reached. The client is rejected with CodeServerUnavaliable
+	// if no slot is freed in time. 0 means rejecting immediately.
+	AuthWaitTimeout time.Duration
+	// MaxClientIDLength is the maximum length in bytes of the client identifier.
+	// The client with a longer client identifier is rejected with CodeIdentifierRejected.
+	// 0 means no limit.
+	MaxClientIDLength int
+	// DeliveryOrder is the order between the queued messages and the live messages
+	// when a persistent session is resumed. Default to CatchUpFirst.
+	DeliveryOrder DeliveryOrder
+	// MaxRetainedMessages is the maximum number of the retained messages.
+	// Replacing an existing retained message is always allowed.
+	// 0 means no limit.
+	MaxRetainedMessages int
+	// MaxRetainedPayloadSize is the maximum payload size in bytes of a retained message.
+	// 0 means no limit.
+	MaxRetainedPayloadSize int
+	// RetainedOverQuota is the policy for the retained PUBLISH which exceeds MaxRetainedMessages or MaxRetainedPayloadSize.
+	// The dropped messages are counted in RetainedStats. Default to RetainedDiscard.
+	RetainedOverQuota RetainedOverQuotaPolicy
+	// WillDelayInterval delays the will messages of the clients with clean session = false.
+	// The will message is not published if the client resumes the session within the delay.
+	// 0 means the will messages are published immediately.
+	// Notice: the pending will messages are lost when the server stops.
+	WillDelayInterval time.Duration
+	// MaxMsgQueueBytes is the maximum total size in bytes of the topic names and payloads of the queued messages
+	// of a session. 0 means no limit.
+	MaxMsgQueueBytes int
+	// MsgQueueDropPolicy is the policy to choose the message to drop when the message queue exceeds
+	// MaxMsgQueue or MaxMsgQueueBytes. Default to DropQos0First.
+	// The limits and the policy can be overridden for a client by Server.SetQueueLimits.
+	MsgQueueDropPolicy QueueDropPolicy
+	// MessageExpiry is the maximum time a message can stay in the message queue of a session,
+	// the expired messages are dropped with the DroppedExpired reason instead of being delivered.
+	// The inflight messages of an offline session expire as well. 0 means the messages never expire.
+	MessageExpiry time.Duration
+	// MessageExpiryCheckInterval is the interval to purge the expired messages, default to 1 second if it is 0.
+	MessageExpiryCheckInterval time.Duration
+	// SysInterval is the interval to publish the broker statistics to the $SYS topics, see sys.go.
+	// 0 means the $SYS topics are disabled.
+	SysInterval time.Duration
+	// CertIdentity is how the identities of the client certificate are used on the TLS connections,
+	// the identities are returned by the OnCertIdentity hook. Default to CertIdentityNone.
+	// Notice: to require the client certificates, set the ClientAuth of the tls.Config of the listener.
+	CertIdentity CertIdentityMode
+	// MaxPublishRate is the maximum number of the PUBLISH packets per second of a client, 0 means no limit.
+	// The limits can be overridden for a client by the OnRateLimit hook, and can be changed at runtime by ReloadConfig.
+	MaxPublishRate float64
+	// MaxPublishBytesRate is the maximum total size in bytes of the topic names and payloads of the PUBLISH packets
+	// per second of a client, 0 means no limit.
+	MaxPublishBytesRate float64
+	// PublishRateLimitPolicy is the behaviour when a client exceeds its publish rate limit. Default to RateLimitDelay.
+	PublishRateLimitPolicy RateLimitPolicy
+	// MaxConnectionsPerListener is the maximum number of the concurrent connections of each listener, 0 means no limit.
+	// The connections over the limit are rejected with CodeServerUnavaliable, see ListenerStats.RejectedListenerQuota.
+	MaxConnectionsPerListener int
+	// MaxConnectionsPerIP is the maximum number of the concurrent connections from a source address, 0 means no limit.
+	// The connections over the limit are rejected with CodeServerUnavaliable, see ListenerStats.RejectedIPQuota.
+	MaxConnectionsPerIP int
+	// IPConnectionQuotas limits the total concurrent connections from the networks, the connections over
+	// the quotas are rejected with CodeServerUnavaliable. The server panics on Run if any CIDR is invalid.
+	IPConnectionQuotas []IPConnectionQuota
+	// MaxHeapBytes is the threshold of the allocated heap bytes to consider the server overloaded, 0 means no limit.
+	MaxHeapBytes uint64
+	// MaxQueuedMessages is the threshold of the total queued messages of all sessions to consider the server overloaded,
+	// 0 means no limit.
+	MaxQueuedMessages uint64
+	// MaxPendingWrites is the threshold of the total packets waiting to be written to all clients
+	// to consider the server overloaded, 0 means no limit.
+	MaxPendingWrites uint64
+	// OverloadActions is the actions taken when the server is overloaded. The server leaves the overloaded state
+	// when all the metrics are below 90% of their thresholds. The state changes are notified by the OnOverload hook.
+	OverloadActions OverloadAction
+	// OverloadCheckInterval is the interval to check the overload thresholds, default to 1 second if it is 0.
+	OverloadCheckInterval time.Duration
+	// FlappingMaxDisconnects is the number of the disconnections within FlappingWindow to consider a client flapping,
+	// 0 means the flapping detection is disabled. The flapping clients are banned for FlappingBanDuration,
+	// see BanService.
+	FlappingMaxDisconnects int
+	// FlappingWindow is the time window to count the disconnections.
+	FlappingWindow time.Duration
+	// FlappingBanDuration is the duration of the bans of the flapping clients, 0 means the bans never expire.
+	FlappingBanDuration time.Duration
+	// FlappingBanBy is whether the client id or the source IP address of the flapping client is banned.
+	// Default to BanClientID.
+	FlappingBanBy BanKind
+	// DelayedPublish is whether to support the delayed publishes. The messages published to $delayed/<seconds>/<topic>
+	// are held by the server and published to <topic> after <seconds> seconds.
+	DelayedPublish bool
+	// MaxDelayedMessages is the maximum number of the pending delayed messages, 0 means no limit.
+	// The delayed publishes beyond the limit are dropped.
+	MaxDelayedMessages int
+	// AutoSubscriptions is the subscriptions added for the clients on connect. The topic filters can contain
+	// the placeholders %c (client id) and %u (username), the subscription is skipped if the value of the placeholder
+	// is empty or contains '/', '+' or '#'.
+	AutoSubscriptions []packets.Topic
+	// MaxTopicStats is the maximum number of the topic names whose statistics are collected, 0 means the per-topic
+	// statistics are disabled. The topics beyond the limit are not collected until StatsManager.ResetTopicStats,
+	// see StatsManager.TopTopics.
+	MaxTopicStats int
+	// WriteFlushInterval is the maximum time the outgoing PUBLISH packets are buffered before they are flushed
+	// to the connection, which coalesces the packets of the high fan-out topics into fewer syscalls at the cost
+	// of the latency. 0 means each packet is flushed at once, which suits the latency-sensitive deployments.
+	// The other packet types, e.g: CONNACK and PINGRESP, are always flushed at once.
+	WriteFlushInterval time.Duration
+	// WriteFlushThreshold is the number of the buffered bytes which triggers the flush without waiting for
+	// WriteFlushInterval, 0 means the packets are flushed when the write buffer is full.
+	WriteFlushThreshold int
+	// ServerKeepAlive overrides the keep alive in seconds of all clients if it is not 0, so that the broker enforces
+	// its own keep alive timeout regardless of the keep alive in the CONNECT packets.
+	// The MQTT 3.1.1 clients are not informed of it, so it should not be shorter than the keep alive of the clients.
+	ServerKeepAlive uint16
+	// MaxIdleTime is the maximum time a connection can stay without receiving any packet, the idle connections are
+	// closed regardless of the keep alive, which defends against the half-open connections of the clients with
+	// keep alive 0. 0 means no limit.
+	MaxIdleTime time.Duration
+	// IdleCheckInterval is the interval to close the idle connections, default to 1 second if it is 0.
+	IdleCheckInterval time.Duration
+	// AllowMQTT31 accepts the legacy MQTT 3.1 clients, whose protocol name is "MQIsdp" and protocol level is 3.
+	// The MQTT 3.1 clients are rejected with CodeUnacceptableProtocolVersion if it is false.
+	AllowMQTT31 bool
+	// Strictness is the level of the protocol conformance checks of the incoming packets, see packets.Strictness.
+	// The violations tolerated in the packets.Lenient level are logged.
+	Strictness packets.Strictness
+	// MaxRemainLength is the maximum remaining length of the incoming packets, the connection sending
+	// an oversized packet is closed. 0 means no limit other than the 256MB limit of the specification.
+	MaxRemainLength int
+	// StopInflightTimeout is the maximum time Stop waits for the inflight QoS 1 and QoS 2 flows of the online
+	// clients to complete before closing the connections, so that the sessions are persisted without
+	// the messages to be redelivered. 0 means the connections are closed without waiting.
+	StopInflightTimeout time.Duration
+	// MaxGrantedQos is the maximum qos granted to the subscriptions of the clients, the subscriptions requesting
+	// a higher qos are downgraded. Default to packets.QOS_2.
+	MaxGrantedQos uint8
+	// NoWildcardSubscriptions rejects the topic filters which contain the "+" or "#" wildcards.
+	NoWildcardSubscriptions bool
+	// NoSharedSubscriptions rejects the topic filters of the "$share/{ShareName}/{filter}" form.
+	// The shared subscriptions are not supported, these topic filters are subscribed as the ordinary ones if it is false.
+	NoSharedSubscriptions bool
+	// MaxSubscriptionsPerClient is the maximum number of the subscriptions of a client, the subscriptions
+	// beyond the limit are rejected. 0 means no limit.
+	MaxSubscriptionsPerClient int
+	// MaxTopicHistory is the number of the latest messages kept for each topic, which are replayed to the clients
+	// subscribing to $history/<n>/<topic filter>, see HistoryService. 0 means the history is disabled.
+	MaxTopicHistory int
+	// MaxTopicHistoryBytes is the maximum total payload size of the kept messages of each topic, 0 means no limit.
+	MaxTopicHistoryBytes int
+	// MaxHistoryTopics is the maximum number of the topics whose messages are kept, the messages of the topics
+	// beyond the limit are not kept. 0 means no limit.
+	MaxHistoryTopics int
+	// QueuePriorities assigns the priorities to the messages in the message queues of the sessions by their topics,
+	// the first matched QueuePriority applies. The messages of the higher priorities are delivered before,
+	// and are dropped after the lower ones when the queue is full, see QueueDropPolicy.
+	// The server panics on Run if any topic filter is invalid.
+	QueuePriorities []QueuePriority
+	// DisconnectOnCertExpiry disconnects the clients once their TLS client certificates expire,
+	// see Client.SetCredentialExpiry.
+	DisconnectOnCertExpiry bool
+	// CredentialExpiryNotice is how long before the credential expiry the OnCredentialExpiry hooks are called,
+	// so that the plugins can refresh or extend the credential before the client is disconnected.
+	CredentialExpiryNotice time.Duration
+	// FanOutWorkers is the number of the workers delivering the published messages to the subscribers.
+	// 0 means the messages are delivered by the event loop of the server, so a large fan-out delays
+	// the other publishes and the connecting clients. The deliveries to a subscriber are handled by the same worker,
+	// so the messages of each publisher and topic are delivered to the subscriber in order.
+	FanOutWorkers int
+	// FanOutQueueLen is the maximum number of the messages waiting in the fan-out queue for each subscriber,
+	// default to DefaultFanOutQueueLen. Routing the messages never blocks, the messages beyond it are queued
+	// in the session of the subscriber, subject to the queue limits, until the worker catches up.
+	// The queued messages of a resumed session are delivered by the worker before the newer messages,
+	// regardless of DeliveryOrder.
+	FanOutQueueLen int
 }
 
 // DefaultConfig default config used by NewServer()
@@ -150,10 +500,65 @@ var DefaultConfig = Config{
 	MsgRouterLen:               DefaultMsgRouterLen,
 	RegisterLen:                DefaultRegisterLen,
 	UnregisterLen:              DefaultUnRegisterLen,
+	MaxConcurrentAuth:          0,
+	AuthWaitTimeout:            0,
+	MaxClientIDLength:          0,
+	DeliveryOrder:              CatchUpFirst,
+	MaxRetainedMessages:        0,
+	MaxRetainedPayloadSize:     0,
+	RetainedOverQuota:          RetainedDiscard,
+	WillDelayInterval:          0 * time.Second,
+	MaxMsgQueueBytes:           0,
+	MsgQueueDropPolicy:         DropQos0First,
+	MessageExpiry:              0 * time.Second,
+	MessageExpiryCheckInterval: 0 * time.Second,
+	SysInterval:                10 * time.Second,
+	CertIdentity:               CertIdentityNone,
+	MaxPublishRate:             0,
+	MaxPublishBytesRate:        0,
+	PublishRateLimitPolicy:     RateLimitDelay,
+	MaxConnectionsPerListener:  0,
+	MaxConnectionsPerIP:        0,
+	MaxHeapBytes:               0,
+	MaxQueuedMessages:          0,
+	MaxPendingWrites:           0,
+	OverloadActions:            OverloadRejectConnections | OverloadShedQos0,
+	OverloadCheckInterval:      0 * time.Second,
+	FlappingMaxDisconnects:     0,
+	FlappingWindow:             time.Minute,
+	FlappingBanDuration:        5 * time.Minute,
+	FlappingBanBy:              BanClientID,
+	DelayedPublish:             false,
+	MaxDelayedMessages:         0,
+	AutoSubscriptions:          nil,
+	MaxTopicStats:              0,
+	WriteFlushInterval:         0,
+	WriteFlushThreshold:        0,
+	ServerKeepAlive:            0,
+	MaxIdleTime:                0,
+	IdleCheckInterval:          0,
+	AllowMQTT31:                false,
+	Strictness:                 packets.Strict,
+	MaxRemainLength:            0,
+	StopInflightTimeout:        0,
+	MaxGrantedQos:              packets.QOS_2,
+	NoWildcardSubscriptions:    false,
+	NoSharedSubscriptions:      false,
+	MaxSubscriptionsPerClient:  0,
+	MaxTopicHistory:            0,
+	MaxTopicHistoryBytes:       0,
+	MaxHistoryTopics:           0,
+	QueuePriorities:            nil,
+	DisconnectOnCertExpiry:     false,
+	CredentialExpiryNotice:     0,
+	FanOutWorkers:              0,
+	FanOutQueueLen:             DefaultFanOutQueueLen,
 }
 
 // GetConfig returns the config of the server
 func (srv *server) GetConfig() Config {
+	srv.configMu.RLock()
+	defer srv.configMu.RUnlock()
 	return srv.config
 }
 
@@ -176,8 +581,12 @@ type unregister struct {
 }
 
 type msgRouter struct {
-	msg      packets.Message
-	clientID string
+	// ctx carries the span of the PUBLISH packet, nil if the message is not received from a client.
+	ctx context.Context
+	// publisher is the client id of the publisher, empty if the message is not received from a client.
+	publisher string
+	msg       packets.Message
+	clientID  string
 	// if set to false, must set clientID to specify the client to send
 	match bool
 }
@@ -188,8 +597,6 @@ func (srv *server) Status() int32 {
 }
 
 func (srv *server) registerHandler(register *register) {
-	// ack code set in Connack Packet
-	var code uint8
 	client := register.client
 	defer close(client.ready)
 	connect := register.connect
@@ -201,18 +608,18 @@ func (srv *server) registerHandler(register *register) {
 		register.error = err
 		return
 	}
-	if srv.hooks.OnConnect != nil {
-		code = srv.hooks.OnConnect(context.Background(), client)
-	}
-	connect.AckCode = code
-	if code != packets.CodeAccepted {
-		err := errors.New("reject connection, ack code:" + strconv.Itoa(int(code)))
-		ack := connect.NewConnackPacket(false)
-		client.writePacket(ack)
-		client.setError(err)
-		register.error = err
-		return
+	if srv.hooks.OnSessionTakeover != nil {
+		srv.mu.RLock()
+		oldClient, ok := srv.clients[client.opts.clientID]
+		srv.mu.RUnlock()
+		if ok && oldClient.IsConnected() && !srv.hooks.OnSessionTakeover(context.Background(), oldClient, client) {
+			connect.AckCode = packets.CodeIdentifierRejected
+			client.writePacket(connect.NewConnackPacket(false))
+			register.error = errors.New("session takeover vetoed")
+			return
+		}
 	}
+	client.setCertExpiry()
 	if srv.hooks.OnConnected != nil {
 		srv.hooks.OnConnected(context.Background(), client)
 	}
@@ -223,18 +630,21 @@ func (srv *server) registerHandler(register *register) {
 	srv.mu.Lock()
 	defer srv.mu.Unlock()
 	var oldSession *session
+	var takenOver bool
 	oldClient, oldExist := srv.clients[client.opts.clientID]
 	srv.clients[client.opts.clientID] = client
 	if oldExist {
 		oldSession = oldClient.session
 		if oldClient.IsConnected() {
-			zaplog.Info("logging with duplicate ClientID",
-				zap.String("remote", client.rwc.RemoteAddr().String()),
-				zap.String("client_id", client.OptionsReader().ClientID()),
-			)
+			sessionLog().Info("logging with duplicate ClientID", client.logFields()...)
 			oldClient.setSwitching()
-			<-oldClient.Close()
-			if oldClient.opts.willFlag {
+			srv.waitTakenOver(oldClient)
+			takenOver = true
+			if !client.opts.cleanSession && !oldClient.opts.cleanSession { //reuse old session
+				sessionReuse = true
+			}
+			// the delayed will message is not sent if the session is resumed by the new connection.
+			if oldClient.opts.willFlag && (srv.config.WillDelayInterval == 0 || !sessionReuse) {
 				willMsg := &packets.Publish{
 					Dup:       false,
 					Qos:       oldClient.opts.willQos,
@@ -242,13 +652,7 @@ func (srv *server) registerHandler(register *register) {
 					TopicName: []byte(oldClient.opts.willTopic),
 					Payload:   oldClient.opts.willPayload,
 				}
-				go func() {
-					msgRouter := &msgRouter{msg: messageFromPublish(willMsg), match: true}
-					srv.msgRouter <- msgRouter
-				}()
-			}
-			if !client.opts.cleanSession && !oldClient.opts.cleanSession { //reuse old session
-				sessionReuse = true
+				srv.publishWill(oldClient, messageFromPublish(willMsg))
 			}
 		} else if oldClient.IsDisConnected() {
 			if !client.opts.cleanSession {
@@ -260,12 +664,22 @@ func (srv *server) registerHandler(register *register) {
 			srv.hooks.OnSessionTerminated(context.Background(), oldClient, ConflictTermination)
 		}
 	}
+	// the pending will message is cancelled if the session is resumed, otherwise the old session has ended
+	// and the will message is published immediately.
+	if sessionReuse {
+		srv.willService.Cancel(client.opts.clientID)
+	} else {
+		srv.willService.fire(client.opts.clientID)
+	}
 	ack := connect.NewConnackPacket(sessionReuse)
 	client.out <- ack
 	client.setConnected()
 	if sessionReuse { //发送还未确认的消息和离线消息队列 sending inflight messages & offline message
+		// the expired messages are not delivered.
+		oldClient.purgeExpiredMessages(time.Now())
 		client.session.unackpublish = oldSession.unackpublish
 		client.statsManager = oldClient.statsManager
+		client.attributes.inherit(oldClient.attributes)
 		//send unacknowledged publish
 		oldSession.inflightMu.Lock()
 		for e := oldSession.inflight.Front(); e != nil; e = e.Next() {
@@ -273,7 +687,7 @@ func (srv *server) registerHandler(register *register) {
 				pub := inflight.packet
 				pub.Dup = true
 				client.statsManager.decInflightCurrent(1)
-				client.onlinePublish(pub)
+				client.onlinePublish(context.Background(), pub, inflight.delivery)
 			}
 		}
 		oldSession.inflightMu.Unlock()
@@ -299,27 +713,46 @@ func (srv *server) registerHandler(register *register) {
 		oldSession.awaitRelMu.Unlock()
 
 		//send offline msg
-		oldSession.msgQueueMu.Lock()
-		for e := oldSession.msgQueue.Front(); e != nil; e = e.Next() {
-			if publish, ok := e.Value.(*packets.Publish); ok {
-				client.statsManager.messageDequeue(1)
-				client.onlinePublish(publish)
+		if srv.fanOut != nil {
+			srv.fanOut.run(client, func(stopped bool) {
+				srv.resumeQueued(client, oldSession, stopped)
+			})
+		} else {
+			oldSession.msgQueueMu.Lock()
+			if srv.config.DeliveryOrder == Interleave {
+				queued := make([]*packets.Publish, 0, oldSession.msgQueue.Len())
+				for e := oldSession.msgQueue.Front(); e != nil; e = e.Next() {
+					if publish, ok := e.Value.(*packets.Publish); ok {
+						queued = append(queued, publish)
+					}
+				}
+				go func() {
+					for _, publish := range queued {
+						client.statsManager.messageDequeue(1)
+						// the client may go offline during the delivery
+						client.publish(context.Background(), publish, nil)
+					}
+				}()
+			} else {
+				for e := oldSession.msgQueue.Front(); e != nil; e = e.Next() {
+					if publish, ok := e.Value.(*packets.Publish); ok {
+						client.statsManager.messageDequeue(1)
+						client.onlinePublish(context.Background(), publish, nil)
+					}
+				}
 			}
+			oldSession.msgQueueMu.Unlock()
 		}
-		oldSession.msgQueueMu.Unlock()
 
-		zaplog.Info("logged in with session reuse",
-			zap.String("remote_addr", client.rwc.RemoteAddr().String()),
-			zap.String("client_id", client.opts.clientID))
+		sessionLog().Info("logged in with session reuse", client.logFields()...)
 	} else {
 		if oldExist {
 			srv.subscriptionsDB.UnsubscribeAll(client.opts.clientID)
+			srv.removeSubscriptionStates(client.opts.clientID)
 		}
-		zaplog.Info("logged in with new session",
-			zap.String("remote_addr", client.rwc.RemoteAddr().String()),
-			zap.String("client_id", client.opts.clientID),
-		)
+		sessionLog().Info("logged in with new session", client.logFields()...)
 	}
+	srv.autoSubscribe(client)
 	if sessionReuse {
 		if srv.hooks.OnSessionResumed != nil {
 			srv.hooks.OnSessionResumed(context.Background(), client)
@@ -329,8 +762,35 @@ func (srv *server) registerHandler(register *register) {
 			srv.hooks.OnSessionCreated(context.Background(), client)
 		}
 	}
+	if takenOver && srv.hooks.OnSessionTakenOver != nil {
+		srv.hooks.OnSessionTakenOver(context.Background(), oldClient, client)
+	}
 	delete(srv.offlineClients, client.opts.clientID)
+	srv.cancelSessionExpiry(client.opts.clientID)
+	srv.persistConnectedSession(client, sessionReuse)
 }
+
+// waitTakenOver waits for the client which is taken over by the new connection to be closed.
+// The client may have started closing before it was switched, in which case it is blocked on sending the unregister
+// to the event loop which is running registerHandler. So the unregisters are received here: the one of the client
+// is done without unregistering since the session is handled by registerHandler, the others are deferred until
+// registerHandler returns as they need srv.mu.
+func (srv *server) waitTakenOver(client *client) {
+	closed := client.Close()
+	for {
+		select {
+		case <-closed:
+			return
+		case unregister := <-srv.unregister:
+			if unregister.client == client {
+				close(unregister.done)
+			} else {
+				srv.deferredUnregisters = append(srv.deferredUnregisters, unregister)
+			}
+		}
+	}
+}
+
 func (srv *server) unregisterHandler(unregister *unregister) {
 	defer close(unregister.done)
 	client := unregister.client
@@ -342,6 +802,14 @@ func (srv *server) unregisterHandler(unregister *unregister) {
 		// session is not created, so there is no need to unregister.
 		return
 	}
+	srv.mu.RLock()
+	registered := srv.clients[client.opts.clientID] == client
+	srv.mu.RUnlock()
+	if !registered {
+		// the connection is rejected by srv.registerHandler(),
+		// the session with the same client id, if any, belongs to another connection.
+		return
+	}
 clearIn:
 	for {
 		select {
@@ -363,16 +831,15 @@ clearIn:
 			Payload:   client.opts.willPayload,
 		}
 		msg := messageFromPublish(willMsg)
-		go func() {
-			msgRouter := &msgRouter{msg: msg, match: true}
-			client.server.msgRouter <- msgRouter
-		}()
+		// the session of the client with clean session = true ends now, so its will message is not delayed.
+		if srv.config.WillDelayInterval != 0 && !client.opts.cleanSession {
+			srv.willService.schedule(client, msg)
+		} else {
+			srv.publishWill(client, msg)
+		}
 	}
 	if client.opts.cleanSession {
-		zaplog.Info("logged out and cleaning session",
-			zap.String("remote_addr", client.rwc.RemoteAddr().String()),
-			zap.String("client_id", client.OptionsReader().ClientID()),
-		)
+		sessionLog().Info("logged out and cleaning session", client.logFields()...)
 		srv.mu.Lock()
 		srv.removeSession(client.opts.clientID)
 		srv.mu.Unlock()
@@ -381,25 +848,25 @@ clearIn:
 		}
 		srv.statsManager.messageDequeue(client.statsManager.GetStats().MessageStats.QueuedCurrent)
 	} else { //store session 保持session
+		now := time.Now()
 		srv.mu.Lock()
-		srv.offlineClients[client.opts.clientID] = time.Now()
+		srv.offlineClients[client.opts.clientID] = now
+		srv.scheduleSessionExpiry(client.opts.clientID, now)
 		srv.mu.Unlock()
-		zaplog.Info("logged out and storing session",
-			zap.String("remote_addr", client.rwc.RemoteAddr().String()),
-			zap.String("client_id", client.OptionsReader().ClientID()),
-		)
+		sessionLog().Info("logged out and storing session", client.logFields()...)
 		//clear  out
 	clearOut:
 		for {
 			select {
 			case p := <-client.out:
-				if p, ok := p.(*packets.Publish); ok {
+				if p, _ := unwrapDelivery(p); p != nil {
 					client.msgEnQueue(p)
 				}
 			default:
 				break clearOut
 			}
 		}
+		srv.persistSession(client)
 		srv.statsManager.addSessionInactive()
 	}
 }
@@ -407,6 +874,10 @@ clearIn:
 // 所有进来的 msg都会分配pid，指定pid重传的不在这里处理
 func (srv *server) msgRouterHandler(m *msgRouter) {
 	msg := m.msg
+	ctx := m.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
 	var matched subscription.ClientTopics
 	if m.match {
 		matched = srv.subscriptionsDB.GetTopicMatched(msg.Topic())
@@ -425,103 +896,144 @@ func (srv *server) msgRouterHandler(m *msgRouter) {
 			Name: msg.Topic(),
 		})
 	}
+	srv.topicStats.messageIn(msg.Topic(), len(msg.Payload()), len(matched))
+	if m.match && m.clientID == "" {
+		srv.historyService.record(msg)
+	}
+	ctx, span := srv.telemetry.startFanOut(ctx, msg, len(matched))
+	defer span.End()
+	// the publishes of the subscribers are copied from base, so the topic name is encoded once for all of them.
+	base := messageToPublish(msg)
+	base.Dup = false
+	base.ShareEncoding()
+	// jobs is the deliveries of the fan-out workers, which are dispatched after srv.mu is unlocked.
+	var jobs []*fanOutJob
+	deliver := func(c *client, publish *packets.Publish, delivery *Delivery) {
+		if srv.fanOut == nil {
+			c.publish(ctx, publish, delivery)
+			return
+		}
+		jobs = append(jobs, &fanOutJob{ctx: ctx, client: c, publish: publish, delivery: delivery})
+	}
 	srv.mu.RLock()
-	defer srv.mu.RUnlock()
 	for cid, topics := range matched {
+		if cid == m.publisher {
+			if topics = srv.filterNoLocal(cid, topics); len(topics) == 0 {
+				continue
+			}
+		}
 		if srv.config.DeliveryMode == Overlap {
 			for _, t := range topics {
 				if c, ok := srv.clients[cid]; ok {
-					publish := messageToPublish(msg)
+					publish := base.CopyPublish()
 					if publish.Qos > t.Qos {
 						publish.Qos = t.Qos
 					}
-					publish.Dup = false
-					c.publish(publish)
+					deliver(c, publish, srv.newDelivery(msg, t))
 				}
 			}
 		} else {
 			// deliver once
 			var maxQos uint8
+			var maxTopic packets.Topic
 			for _, t := range topics {
-				if t.Qos > maxQos {
+				if t.Qos >= maxQos {
 					maxQos = t.Qos
+					maxTopic = t
 				}
 				if maxQos == packets.QOS_2 {
 					break
 				}
 			}
 			if c, ok := srv.clients[cid]; ok {
-				publish := messageToPublish(msg)
+				publish := base.CopyPublish()
 				if publish.Qos > maxQos {
 					publish.Qos = maxQos
 				}
-				publish.Dup = false
-				c.publish(publish)
+				deliver(c, publish, srv.newDelivery(msg, maxTopic))
 			}
 		}
 	}
+	srv.mu.RUnlock()
+	if jobs != nil {
+		srv.fanOut.dispatch(jobs)
+	}
 }
 func (srv *server) removeSession(clientID string) {
 	delete(srv.clients, clientID)
 	delete(srv.offlineClients, clientID)
 	srv.subscriptionsDB.UnsubscribeAll(clientID)
+	srv.removeSubscriptionStates(clientID)
+	srv.cancelSessionExpiry(clientID)
+	srv.removePersistedSession(clientID)
 }
 
-// sessionExpireCheck 判断是否超时
-// sessionExpireCheck check and terminate expired sessions
-func (srv *server) sessionExpireCheck() {
-	expire := srv.config.SessionExpiryCheckInterval
-	if expire == 0 {
+// scheduleSessionExpiry schedules the expiry of the offline session which is disconnected at disconnectedAt.
+func (srv *server) scheduleSessionExpiry(clientID string, disconnectedAt time.Time) {
+	if srv.expiryWheel == nil {
 		return
 	}
-	now := time.Now()
-	srv.mu.Lock()
-	for id, disconnectedAt := range srv.offlineClients {
-		if now.Sub(disconnectedAt) >= expire {
-			if client, _ := srv.clients[id]; client != nil {
-				srv.removeSession(id)
-				if srv.hooks.OnSessionTerminated != nil {
-					srv.hooks.OnSessionTerminated(context.Background(), client, ExpiredTermination)
-				}
-				srv.statsManager.addSessionExpired()
-				srv.statsManager.decSessionInactive()
-			}
-		}
+	d := srv.config.SessionExpiryInterval - time.Since(disconnectedAt)
+	srv.expiryWheel.Add(clientID, d, func() {
+		srv.expireSession(clientID)
+	})
+}
+
+// cancelSessionExpiry cancels the scheduled expiry of the session, it is called when the session is resumed or removed.
+func (srv *server) cancelSessionExpiry(clientID string) {
+	if srv.expiryWheel == nil {
+		return
 	}
-	srv.mu.Unlock()
+	srv.expiryWheel.Remove(clientID)
+}
 
+// expireSession terminates the offline session if the session expiry interval has elapsed since its disconnection.
+func (srv *server) expireSession(clientID string) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	disconnectedAt, ok := srv.offlineClients[clientID]
+	// the session may have been resumed before the lock is held.
+	if !ok {
+		return
+	}
+	// the timer may fire up to one tick early.
+	if time.Since(disconnectedAt) < srv.config.SessionExpiryInterval {
+		srv.scheduleSessionExpiry(clientID, disconnectedAt)
+		return
+	}
+	client := srv.clients[clientID]
+	if client == nil {
+		return
+	}
+	srv.removeSession(clientID)
+	srv.willService.fire(clientID)
+	sessionLog().Info("session expired", zap.String("client_id", clientID))
+	if srv.hooks.OnSessionExpired != nil {
+		srv.hooks.OnSessionExpired(context.Background(), client)
+	}
+	if srv.hooks.OnSessionTerminated != nil {
+		srv.hooks.OnSessionTerminated(context.Background(), client, ExpiredTermination)
+	}
+	srv.statsManager.addSessionExpired()
+	srv.statsManager.decSessionInactive()
 }
 
 // server event loop
 func (srv *server) eventLoop() {
-	if srv.config.SessionExpiryInterval != 0 {
-		sessionExpireTimer := time.NewTicker(srv.config.SessionExpiryCheckInterval)
-		defer sessionExpireTimer.Stop()
-		for {
-			select {
-			case register := <-srv.register:
-				srv.registerHandler(register)
-			case unregister := <-srv.unregister:
-				srv.unregisterHandler(unregister)
-			case msg := <-srv.msgRouter:
-				srv.msgRouterHandler(msg)
-			case <-sessionExpireTimer.C:
-				srv.sessionExpireCheck()
-			}
-		}
-	} else {
-		for {
-			select {
-			case register := <-srv.register:
-				srv.registerHandler(register)
-			case unregister := <-srv.unregister:
+	for {
+		select {
+		case register := <-srv.register:
+			srv.registerHandler(register)
+			for _, unregister := range srv.deferredUnregisters {
 				srv.unregisterHandler(unregister)
-			case msg := <-srv.msgRouter:
-				srv.msgRouterHandler(msg)
 			}
+			srv.deferredUnregisters = nil
+		case unregister := <-srv.unregister:
+			srv.unregisterHandler(unregister)
+		case msg := <-srv.msgRouter:
+			srv.msgRouterHandler(msg)
 		}
 	}
-
 }
 
 // WsServer is used to build websocket server
@@ -530,6 +1042,41 @@ type WsServer struct {
 	Path     string // Url path
 	CertFile string //TLS configration
 	KeyFile  string //TLS configration
+	// StrictSubprotocol rejects the handshakes which do not request the "mqtt" subprotocol.
+	// By default, the handshakes without subprotocol are accepted as well.
+	StrictSubprotocol bool
+	// EnableCompression negotiates the permessage-deflate extension with the clients which request it.
+	EnableCompression bool
+	// AllowedOrigins is the origins allowed to connect, such as "https://example.com", compared case-insensitively.
+	// The handshakes without Origin header, which are not sent by the browsers, are always allowed.
+	// Empty means any origin is allowed.
+	AllowedOrigins []string
+	// Listener is the listener which the websocket server serves on, such as the proxyproto.Listener.
+	// If it is nil, the server listens on Server.Addr.
+	Listener net.Listener
+	// Profile is the profile of the clients connected to the websocket server, nil means no profile.
+	Profile *ListenerProfile
+}
+
+// upgrader returns the websocket.Upgrader of the websocket server.
+func (ws *WsServer) upgrader() *websocket.Upgrader {
+	u := *defaultUpgrader
+	u.EnableCompression = ws.EnableCompression
+	if len(ws.AllowedOrigins) != 0 {
+		u.CheckOrigin = func(r *http.Request) bool {
+			origin := r.Header.Get("Origin")
+			if origin == "" {
+				return true
+			}
+			for _, v := range ws.AllowedOrigins {
+				if strings.EqualFold(v, origin) {
+					return true
+				}
+			}
+			return false
+		}
+	}
+	return &u
 }
 
 // NewServer returns a gmqtt server instance with the given options
@@ -542,15 +1089,28 @@ func NewServer(opts ...Options) *server {
 		exitChan:        make(chan struct{}),
 		clients:         make(map[string]*client),
 		offlineClients:  make(map[string]time.Time),
+		queueLimits:     make(map[string]QueueLimits),
+		subStates:       make(map[string]map[string]subscriptionState),
 		retainedDB:      retained_trie.NewStore(),
 		subscriptionsDB: subStore,
 		config:          DefaultConfig,
 		statsManager:    statsMgr,
 	}
 	srv.publishService = &publishService{server: srv}
+	srv.willService = newWillService(srv)
+	srv.banService = newBanService(srv)
+	srv.traceService = newTraceService()
+	srv.clientService = &clientService{server: srv}
+	srv.pluginService = newPluginService(srv)
+	srv.delayedService = newDelayedService(srv)
+	srv.historyService = newHistoryService(srv)
+	srv.listenerProfiles = make(map[net.Listener]*ListenerProfile)
 	for _, fn := range opts {
 		fn(srv)
 	}
+	srv.telemetry = newTelemetry(srv.tracerProvider, srv.meterProvider)
+	srv.topicStats = newTopicStats(srv.config.MaxTopicStats)
+	statsMgr.topics = srv.topicStats
 	return srv
 }
 
@@ -565,13 +1125,87 @@ func (srv *server) Init(opts ...Options) {
 func (srv *server) Client(clientID string) Client {
 	srv.mu.Lock()
 	defer srv.mu.Unlock()
-	return srv.clients[clientID]
+	// return the nil interface rather than the nil *client if the client does not exist.
+	if c, ok := srv.clients[clientID]; ok {
+		return c
+	}
+	return nil
+}
+
+func (srv *server) SetQueueLimits(clientID string, limits *QueueLimits) {
+	srv.queueLimitsMu.Lock()
+	defer srv.queueLimitsMu.Unlock()
+	if limits == nil {
+		delete(srv.queueLimits, clientID)
+		return
+	}
+	srv.queueLimits[clientID] = *limits
+}
+
+// queueLimitsOf returns the message queue limits of the client.
+func (srv *server) queueLimitsOf(clientID string, config *Config) QueueLimits {
+	srv.queueLimitsMu.RLock()
+	limits, ok := srv.queueLimits[clientID]
+	srv.queueLimitsMu.RUnlock()
+	if ok {
+		return limits
+	}
+	return QueueLimits{
+		MaxMsgQueue:      config.MaxMsgQueue,
+		MaxMsgQueueBytes: config.MaxMsgQueueBytes,
+		DropPolicy:       config.MsgQueueDropPolicy,
+	}
+}
+
+// retainedOverQuota returns whether the retained message exceeds the retained message limits.
+func (srv *server) retainedOverQuota(msg *msg) bool {
+	if max := srv.config.MaxRetainedPayloadSize; max > 0 && len(msg.payload) > max {
+		return true
+	}
+	if max := srv.config.MaxRetainedMessages; max > 0 &&
+		srv.retainedDB.GetStats().MessagesCurrent >= uint64(max) &&
+		srv.retainedDB.GetRetainedMessage(msg.topic) == nil {
+		return true
+	}
+	return false
+}
+
+// ResolveDelivery returns the subscribers which match the topic name with their online status.
+func (srv *server) ResolveDelivery(topicName string) map[string]DeliveryTarget {
+	matched := srv.subscriptionsDB.GetTopicMatched(topicName)
+	rs := make(map[string]DeliveryTarget, len(matched))
+	srv.mu.RLock()
+	defer srv.mu.RUnlock()
+	for clientID, topics := range matched {
+		_, hasSession := srv.clients[clientID]
+		_, offline := srv.offlineClients[clientID]
+		rs[clientID] = DeliveryTarget{
+			Topics: topics,
+			Online: hasSession && !offline,
+		}
+	}
+	return rs
+}
+
+// tcpListenerName returns the name of the tcp listener, which is used as the key of ServerStats.ListenerStats.
+func tcpListenerName(l net.Listener) string {
+	return l.Addr().Network() + "://" + l.Addr().String()
+}
+
+// wsListenerName returns the name of the websocket server, which is used as the key of ServerStats.ListenerStats.
+func wsListenerName(ws *WsServer) string {
+	if ws.Listener != nil {
+		return "ws://" + ws.Listener.Addr().String() + ws.Path
+	}
+	return "ws://" + ws.Server.Addr + ws.Path
 }
 
 func (srv *server) serveTCP(l net.Listener) {
 	defer func() {
 		l.Close()
 	}()
+	listener := srv.statsManager.listenerStats(tcpListenerName(l))
+	profile := srv.listenerProfile(l)
 	var tempDelay time.Duration
 	for {
 		rw, e := l.Accept()
@@ -600,6 +1234,9 @@ func (srv *server) serveTCP(l net.Listener) {
 		}
 
 		client := srv.newClient(rw)
+		client.listener = listener
+		client.ln = l
+		client.setProfile(profile)
 		go client.serve()
 	}
 }
@@ -613,6 +1250,16 @@ var defaultUpgrader = &websocket.Upgrader{
 	Subprotocols: []string{"mqtt"},
 }
 
+// hasMQTTSubprotocol returns whether the websocket handshake requests the "mqtt" subprotocol.
+func hasMQTTSubprotocol(r *http.Request) bool {
+	for _, v := range websocket.Subprotocols(r) {
+		if v == "mqtt" {
+			return true
+		}
+	}
+	return false
+}
+
 //实现io.ReadWriter接口
 // wsConn implements the io.ReadWriter
 type wsConn struct {
@@ -645,7 +1292,13 @@ func (ws *wsConn) Write(p []byte) (n int, err error) {
 
 func (srv *server) serveWebSocket(ws *WsServer) {
 	var err error
-	if ws.CertFile != "" && ws.KeyFile != "" {
+	if ws.Listener != nil {
+		if ws.CertFile != "" && ws.KeyFile != "" {
+			err = ws.Server.ServeTLS(ws.Listener, ws.CertFile, ws.KeyFile)
+		} else {
+			err = ws.Server.Serve(ws.Listener)
+		}
+	} else if ws.CertFile != "" && ws.KeyFile != "" {
 		err = ws.Server.ListenAndServeTLS(ws.CertFile, ws.KeyFile)
 	} else {
 		err = ws.Server.ListenAndServe()
@@ -671,8 +1324,15 @@ func (srv *server) newClient(c net.Conn) *client {
 		cleanWillFlag: false,
 		ready:         make(chan struct{}),
 		statsManager:  newSessionStatsManager(),
+		attributes:    newClientSession(nil),
+		packetStats:   newPacketStats(),
 	}
 	client.packetReader = packets.NewReader(client.bufr)
+	client.packetReader.SetDecodeOptions(packets.DecodeOptions{
+		Strictness:      srv.config.Strictness,
+		MaxRemainLength: srv.config.MaxRemainLength,
+		OnViolation:     client.onProtocolViolation,
+	})
 	client.packetWriter = packets.NewWriter(client.bufw)
 	client.setConnecting()
 	client.newSession()
@@ -687,6 +1347,7 @@ func (srv *server) loadPlugins() error {
 		onSessionCreatedWrapper    []OnSessionCreatedWrapper
 		onSessionResumedWrapper    []OnSessionResumedWrapper
 		onSessionTerminatedWrapper []OnSessionTerminatedWrapper
+		onSessionExpiredWrappers   []OnSessionExpiredWrapper
 		onSubscribeWrappers        []OnSubscribeWrapper
 		onSubscribedWrappers       []OnSubscribedWrapper
 		onUnsubscribeWrappers      []OnUnsubscribeWrapper
@@ -697,14 +1358,30 @@ func (srv *server) loadPlugins() error {
 		onCloseWrappers            []OnCloseWrapper
 		onStopWrappers             []OnStopWrapper
 		onMsgDroppedWrappers       []OnMsgDroppedWrapper
+		onCertIdentityWrappers     []OnCertIdentityWrapper
+		onRateLimitWrappers        []OnRateLimitWrapper
+		onOverloadWrappers         []OnOverloadWrapper
+		onBannedWrappers           []OnBannedWrapper
+		onUnbannedWrappers         []OnUnbannedWrapper
+		onTopicRewriteWrappers     []OnTopicRewriteWrapper
+		onSessionTakeoverWrappers  []OnSessionTakeoverWrapper
+		onSessionTakenOverWrappers []OnSessionTakenOverWrapper
+		onDeliveredWrappers        []OnDeliveredWrapper
+		onSubscribeRewriteWrappers []OnSubscribeRewriteWrapper
+		onWillPublishWrappers      []OnWillPublishWrapper
+		onWillPublishedWrappers    []OnWillPublishedWrapper
+		onDeliverRewriteWrappers   []OnDeliverRewriteWrapper
+		onCredentialExpiryWrappers []OnCredentialExpiryWrapper
 	)
-	for _, p := range srv.plugins {
-		zaplog.Info("loading plugin", zap.String("name", p.Name()))
-		err := p.Load(srv)
+	if err := srv.pluginService.init(); err != nil {
+		return err
+	}
+	for _, st := range srv.pluginService.states {
+		err := srv.pluginService.load(st)
 		if err != nil {
 			return err
 		}
-		hooks := p.HookWrapper()
+		hooks := srv.guardHookWrapper(st, st.plugin.HookWrapper())
 		// init all hook wrappers
 		if hooks.OnAcceptWrapper != nil {
 			onAcceptWrappers = append(onAcceptWrappers, hooks.OnAcceptWrapper)
@@ -724,6 +1401,9 @@ func (srv *server) loadPlugins() error {
 		if hooks.OnSessionTerminatedWrapper != nil {
 			onSessionTerminatedWrapper = append(onSessionTerminatedWrapper, hooks.OnSessionTerminatedWrapper)
 		}
+		if hooks.OnSessionExpiredWrapper != nil {
+			onSessionExpiredWrappers = append(onSessionExpiredWrappers, hooks.OnSessionExpiredWrapper)
+		}
 		if hooks.OnSubscribeWrapper != nil {
 			onSubscribeWrappers = append(onSubscribeWrappers, hooks.OnSubscribeWrapper)
 		}
@@ -754,6 +1434,48 @@ func (srv *server) loadPlugins() error {
 		if hooks.OnStopWrapper != nil {
 			onStopWrappers = append(onStopWrappers, hooks.OnStopWrapper)
 		}
+		if hooks.OnCertIdentityWrapper != nil {
+			onCertIdentityWrappers = append(onCertIdentityWrappers, hooks.OnCertIdentityWrapper)
+		}
+		if hooks.OnRateLimitWrapper != nil {
+			onRateLimitWrappers = append(onRateLimitWrappers, hooks.OnRateLimitWrapper)
+		}
+		if hooks.OnOverloadWrapper != nil {
+			onOverloadWrappers = append(onOverloadWrappers, hooks.OnOverloadWrapper)
+		}
+		if hooks.OnBannedWrapper != nil {
+			onBannedWrappers = append(onBannedWrappers, hooks.OnBannedWrapper)
+		}
+		if hooks.OnUnbannedWrapper != nil {
+			onUnbannedWrappers = append(onUnbannedWrappers, hooks.OnUnbannedWrapper)
+		}
+		if hooks.OnTopicRewriteWrapper != nil {
+			onTopicRewriteWrappers = append(onTopicRewriteWrappers, hooks.OnTopicRewriteWrapper)
+		}
+		if hooks.OnSessionTakeoverWrapper != nil {
+			onSessionTakeoverWrappers = append(onSessionTakeoverWrappers, hooks.OnSessionTakeoverWrapper)
+		}
+		if hooks.OnSessionTakenOverWrapper != nil {
+			onSessionTakenOverWrappers = append(onSessionTakenOverWrappers, hooks.OnSessionTakenOverWrapper)
+		}
+		if hooks.OnDeliveredWrapper != nil {
+			onDeliveredWrappers = append(onDeliveredWrappers, hooks.OnDeliveredWrapper)
+		}
+		if hooks.OnSubscribeRewriteWrapper != nil {
+			onSubscribeRewriteWrappers = append(onSubscribeRewriteWrappers, hooks.OnSubscribeRewriteWrapper)
+		}
+		if hooks.OnWillPublishWrapper != nil {
+			onWillPublishWrappers = append(onWillPublishWrappers, hooks.OnWillPublishWrapper)
+		}
+		if hooks.OnWillPublishedWrapper != nil {
+			onWillPublishedWrappers = append(onWillPublishedWrappers, hooks.OnWillPublishedWrapper)
+		}
+		if hooks.OnDeliverRewriteWrapper != nil {
+			onDeliverRewriteWrappers = append(onDeliverRewriteWrappers, hooks.OnDeliverRewriteWrapper)
+		}
+		if hooks.OnCredentialExpiryWrapper != nil {
+			onCredentialExpiryWrappers = append(onCredentialExpiryWrappers, hooks.OnCredentialExpiryWrapper)
+		}
 	}
 
 	// onAccept
@@ -814,6 +1536,15 @@ func (srv *server) loadPlugins() error {
 		srv.hooks.OnSessionTerminated = onSessionTerminated
 	}
 
+	// onSessionExpired
+	if onSessionExpiredWrappers != nil {
+		onSessionExpired := func(ctx context.Context, client Client) {}
+		for i := len(onSessionExpiredWrappers); i > 0; i-- {
+			onSessionExpired = onSessionExpiredWrappers[i-1](onSessionExpired)
+		}
+		srv.hooks.OnSessionExpired = onSessionExpired
+	}
+
 	// onSubscribe
 	if onSubscribeWrappers != nil {
 		onSubscribe := func(ctx context.Context, client Client, topic packets.Topic) (qos uint8) {
@@ -874,7 +1605,7 @@ func (srv *server) loadPlugins() error {
 
 	// onAcked
 	if onAckedWrappers != nil {
-		onAcked := func(ctx context.Context, client Client, msg packets.Message) {}
+		onAcked := func(ctx context.Context, client Client, delivery *Delivery) {}
 		for i := len(onAckedWrappers); i > 0; i-- {
 			onAcked = onAckedWrappers[i-1](onAcked)
 		}
@@ -901,26 +1632,172 @@ func (srv *server) loadPlugins() error {
 
 	// onMsgDropped
 	if onMsgDroppedWrappers != nil {
-		onMsgDropped := func(ctx context.Context, client Client, msg packets.Message) {}
+		onMsgDropped := func(ctx context.Context, client Client, msg packets.Message, reason MsgDroppedReason) {}
 		for i := len(onMsgDroppedWrappers); i > 0; i-- {
 			onMsgDropped = onMsgDroppedWrappers[i-1](onMsgDropped)
 		}
 		srv.hooks.OnMsgDropped = onMsgDropped
 	}
 
+	// onCertIdentity
+	if onCertIdentityWrappers != nil {
+		onCertIdentity := OnCertIdentity(DefaultCertIdentity)
+		for i := len(onCertIdentityWrappers); i > 0; i-- {
+			onCertIdentity = onCertIdentityWrappers[i-1](onCertIdentity)
+		}
+		srv.hooks.OnCertIdentity = onCertIdentity
+	}
+
+	// onRateLimit
+	if onRateLimitWrappers != nil {
+		onRateLimit := func(ctx context.Context, client Client) (limit RateLimit) {
+			return srv.clientRateLimit(client)
+		}
+		for i := len(onRateLimitWrappers); i > 0; i-- {
+			onRateLimit = onRateLimitWrappers[i-1](onRateLimit)
+		}
+		srv.hooks.OnRateLimit = onRateLimit
+	}
+
+	// onOverload
+	if onOverloadWrappers != nil {
+		onOverload := func(ctx context.Context, status OverloadStatus) {}
+		for i := len(onOverloadWrappers); i > 0; i-- {
+			onOverload = onOverloadWrappers[i-1](onOverload)
+		}
+		srv.hooks.OnOverload = onOverload
+	}
+
+	// onBanned
+	if onBannedWrappers != nil {
+		onBanned := func(ctx context.Context, ban Ban) {}
+		for i := len(onBannedWrappers); i > 0; i-- {
+			onBanned = onBannedWrappers[i-1](onBanned)
+		}
+		srv.hooks.OnBanned = onBanned
+	}
+
+	// onUnbanned
+	if onUnbannedWrappers != nil {
+		onUnbanned := func(ctx context.Context, ban Ban) {}
+		for i := len(onUnbannedWrappers); i > 0; i-- {
+			onUnbanned = onUnbannedWrappers[i-1](onUnbanned)
+		}
+		srv.hooks.OnUnbanned = onUnbanned
+	}
+
+	// onTopicRewrite
+	if onTopicRewriteWrappers != nil {
+		onTopicRewrite := func(ctx context.Context, client Client, action TopicRewriteAction, topic string) string {
+			return topic
+		}
+		for i := len(onTopicRewriteWrappers); i > 0; i-- {
+			onTopicRewrite = onTopicRewriteWrappers[i-1](onTopicRewrite)
+		}
+		srv.hooks.OnTopicRewrite = onTopicRewrite
+	}
+
+	// onSessionTakeover
+	if onSessionTakeoverWrappers != nil {
+		onSessionTakeover := func(ctx context.Context, oldClient Client, newClient Client) bool {
+			return true
+		}
+		for i := len(onSessionTakeoverWrappers); i > 0; i-- {
+			onSessionTakeover = onSessionTakeoverWrappers[i-1](onSessionTakeover)
+		}
+		srv.hooks.OnSessionTakeover = onSessionTakeover
+	}
+
+	// onSessionTakenOver
+	if onSessionTakenOverWrappers != nil {
+		onSessionTakenOver := func(ctx context.Context, oldClient Client, newClient Client) {}
+		for i := len(onSessionTakenOverWrappers); i > 0; i-- {
+			onSessionTakenOver = onSessionTakenOverWrappers[i-1](onSessionTakenOver)
+		}
+		srv.hooks.OnSessionTakenOver = onSessionTakenOver
+	}
+
+	// onDelivered
+	if onDeliveredWrappers != nil {
+		onDelivered := func(ctx context.Context, client Client, delivery *Delivery) {}
+		for i := len(onDeliveredWrappers); i > 0; i-- {
+			onDelivered = onDeliveredWrappers[i-1](onDelivered)
+		}
+		srv.hooks.OnDelivered = onDelivered
+	}
+
+	// onSubscribeRewrite
+	if onSubscribeRewriteWrappers != nil {
+		onSubscribeRewrite := func(ctx context.Context, client Client, req *SubscribeRequest) {}
+		for i := len(onSubscribeRewriteWrappers); i > 0; i-- {
+			onSubscribeRewrite = onSubscribeRewriteWrappers[i-1](onSubscribeRewrite)
+		}
+		srv.hooks.OnSubscribeRewrite = onSubscribeRewrite
+	}
+
+	// onWillPublish
+	if onWillPublishWrappers != nil {
+		onWillPublish := func(ctx context.Context, client Client, msg packets.Message) packets.Message {
+			return msg
+		}
+		for i := len(onWillPublishWrappers); i > 0; i-- {
+			onWillPublish = onWillPublishWrappers[i-1](onWillPublish)
+		}
+		srv.hooks.OnWillPublish = onWillPublish
+	}
+
+	// onWillPublished
+	if onWillPublishedWrappers != nil {
+		onWillPublished := func(ctx context.Context, client Client, msg packets.Message) {}
+		for i := len(onWillPublishedWrappers); i > 0; i-- {
+			onWillPublished = onWillPublishedWrappers[i-1](onWillPublished)
+		}
+		srv.hooks.OnWillPublished = onWillPublished
+	}
+
+	// onDeliverRewrite
+	if onDeliverRewriteWrappers != nil {
+		onDeliverRewrite := func(ctx context.Context, client Client, topicName string) string {
+			return topicName
+		}
+		for i := len(onDeliverRewriteWrappers); i > 0; i-- {
+			onDeliverRewrite = onDeliverRewriteWrappers[i-1](onDeliverRewrite)
+		}
+		srv.hooks.OnDeliverRewrite = onDeliverRewrite
+	}
+
+	// onCredentialExpiry
+	if onCredentialExpiryWrappers != nil {
+		onCredentialExpiry := func(ctx context.Context, client Client, expiry time.Time) time.Time {
+			return expiry
+		}
+		for i := len(onCredentialExpiryWrappers); i > 0; i-- {
+			onCredentialExpiry = onCredentialExpiryWrappers[i-1](onCredentialExpiry)
+		}
+		srv.hooks.OnCredentialExpiry = onCredentialExpiry
+	}
+
 	return nil
 }
 
-func (srv *server) wsHandler() http.HandlerFunc {
+func (srv *server) wsHandler(ws *WsServer, listener *ListenerStats) http.HandlerFunc {
+	upgrader := ws.upgrader()
 	return func(w http.ResponseWriter, r *http.Request) {
-		c, err := defaultUpgrader.Upgrade(w, r, nil)
+		if ws.StrictSubprotocol && !hasMQTTSubprotocol(r) {
+			serverLog().Warn("websocket handshake without mqtt subprotocol", zap.String("remote_addr", r.RemoteAddr))
+			http.Error(w, "mqtt subprotocol required", http.StatusBadRequest)
+			return
+		}
+		c, err := upgrader.Upgrade(w, r, nil)
 		if err != nil {
-			zaplog.Warn("websocket upgrade error", zap.String("msg", err.Error()))
+			serverLog().Warn("websocket upgrade error", zap.Error(err))
 			return
 		}
 		defer c.Close()
 		conn := &wsConn{c.UnderlyingConn(), c}
 		client := srv.newClient(conn)
+		client.listener = listener
+		client.setProfile(ws.Profile)
 		client.serve()
 	}
 }
@@ -930,6 +1807,22 @@ func (srv *server) Run() {
 	srv.msgRouter = make(chan *msgRouter, srv.config.MsgRouterLen)
 	srv.register = make(chan *register, srv.config.RegisterLen)
 	srv.unregister = make(chan *unregister, srv.config.UnregisterLen)
+	if srv.config.MaxConcurrentAuth > 0 {
+		srv.authSem = make(chan struct{}, srv.config.MaxConcurrentAuth)
+	}
+	if srv.config.MaxConnectionsPerIP > 0 || len(srv.config.IPConnectionQuotas) != 0 {
+		q, err := newConnQuota(srv.config)
+		if err != nil {
+			panic(err)
+		}
+		srv.connQuota = q
+	}
+	if err := validateQueuePriorities(srv.config.QueuePriorities); err != nil {
+		panic(err)
+	}
+	if srv.config.MaxHeapBytes != 0 || srv.config.MaxQueuedMessages != 0 || srv.config.MaxPendingWrites != 0 {
+		srv.overload = newOverloadProtector(srv.config)
+	}
 
 	var tcps []string
 	var ws []string
@@ -937,37 +1830,133 @@ func (srv *server) Run() {
 		tcps = append(tcps, v.Addr().String())
 	}
 	for _, v := range srv.websocketServer {
-		ws = append(ws, v.Server.Addr)
+		if v.Listener != nil {
+			ws = append(ws, v.Listener.Addr().String())
+		} else {
+			ws = append(ws, v.Server.Addr)
+		}
 	}
-	zaplog.Info("starting gmqtt server", zap.Strings("tcp server listen on", tcps), zap.Strings("websocket server listen on", ws))
+	serverLog().Info("starting gmqtt server", zap.Strings("tcp server listen on", tcps), zap.Strings("websocket server listen on", ws))
 
 	err := srv.loadPlugins()
 	if err != nil {
 		panic(err)
 	}
+	if srv.config.SessionExpiryInterval != 0 {
+		tick := srv.config.SessionExpiryCheckInterval
+		if tick == 0 {
+			tick = time.Second
+		}
+		srv.expiryWheel = timerwheel.New(tick, expiryWheelSlots)
+	}
+	if err := srv.restoreSessions(); err != nil {
+		panic(err)
+	}
+	if err := srv.restoreBans(); err != nil {
+		panic(err)
+	}
+	if srv.config.DelayedPublish {
+		if err := srv.restoreDelayed(); err != nil {
+			panic(err)
+		}
+		srv.delayedService.wheel.Start()
+	}
+	if srv.expiryWheel != nil {
+		srv.expiryWheel.Start()
+	}
+	srv.willService.start()
+	go srv.banService.loop()
+	if srv.config.MessageExpiry != 0 {
+		go srv.messageExpiryLoop()
+	}
+	if srv.config.SysInterval != 0 {
+		go srv.sysLoop(time.Now())
+	}
+	if srv.config.MaxIdleTime != 0 {
+		go srv.idleLoop()
+	}
+	if srv.overload != nil {
+		go srv.overloadLoop()
+	}
+	if srv.fanOut = newFanOut(srv); srv.fanOut != nil {
+		srv.fanOut.start()
+	}
 	srv.status = serverStatusStarted
 	go srv.eventLoop()
+	srv.listenerMu.Lock()
 	for _, ln := range srv.tcpListener {
 		go srv.serveTCP(ln)
 	}
+	srv.listenerMu.Unlock()
 	for _, server := range srv.websocketServer {
 		mux := http.NewServeMux()
-		mux.Handle(server.Path, srv.wsHandler())
+		mux.Handle(server.Path, srv.wsHandler(server, srv.statsManager.listenerStats(wsListenerName(server))))
 		server.Server.Handler = mux
 		go srv.serveWebSocket(server)
 	}
 }
 
+// waitInflight waits until the online clients have no inflight messages and no QoS 2 messages awaiting PUBREL,
+// and the fan-out queues are drained, or Config.StopInflightTimeout elapses, or ctx is done.
+func (srv *server) waitInflight(ctx context.Context) {
+	if srv.config.StopInflightTimeout <= 0 {
+		return
+	}
+	timeout := time.NewTimer(srv.config.StopInflightTimeout)
+	defer timeout.Stop()
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		n := srv.inflightLen()
+		if n == 0 {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-timeout.C:
+			serverLog().Warn("waiting for inflight messages timeout", zap.Int("inflight", n))
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// inflightLen returns the total number of the inflight messages and the QoS 2 messages awaiting PUBREL
+// of the online clients, and the messages waiting in the fan-out queues.
+func (srv *server) inflightLen() int {
+	var n int
+	if srv.fanOut != nil {
+		n = srv.fanOut.len()
+	}
+	srv.mu.RLock()
+	defer srv.mu.RUnlock()
+	for _, c := range srv.clients {
+		if !c.IsConnected() {
+			continue
+		}
+		s := c.session
+		s.inflightMu.Lock()
+		n += s.inflight.Len()
+		s.inflightMu.Unlock()
+		s.awaitRelMu.Lock()
+		n += s.awaitRel.Len()
+		s.awaitRelMu.Unlock()
+	}
+	return n
+}
+
 // Stop gracefully stops the mqtt server by the following steps:
 //  1. Closing all open TCP listeners and shutting down all open websocket servers
-//  2. Closing all idle connections
-//  3. Waiting for all connections have been closed
-//  4. Triggering OnStop()
+//  2. Waiting for the fan-out queues to be drained and the inflight messages to be acknowledged,
+//     see Config.StopInflightTimeout. The messages left in the fan-out queues are queued in the sessions
+//  3. Closing all idle connections, the sessions are persisted once the connections are closed
+//  4. Waiting for all connections have been closed
+//  5. Triggering OnStop()
 func (srv *server) Stop(ctx context.Context) error {
-	zaplog.Info("stopping gmqtt server")
+	serverLog().Info("stopping gmqtt server")
 	defer func() {
-		zaplog.Info("server stopped")
-		//zaplog.Sync()
+		serverLog().Info("server stopped")
 	}()
 	select {
 	case <-srv.exitChan:
@@ -975,12 +1964,25 @@ func (srv *server) Stop(ctx context.Context) error {
 	default:
 		close(srv.exitChan)
 	}
+	srv.listenerMu.Lock()
 	for _, l := range srv.tcpListener {
 		l.Close()
 	}
+	srv.listenerMu.Unlock()
 	for _, ws := range srv.websocketServer {
 		ws.Server.Shutdown(ctx)
 	}
+	srv.waitInflight(ctx)
+	if srv.fanOut != nil {
+		srv.fanOut.stop()
+	}
+	if srv.expiryWheel != nil {
+		srv.expiryWheel.Stop()
+	}
+	srv.willService.stop()
+	if srv.config.DelayedPublish {
+		srv.delayedService.wheel.Stop()
+	}
 
 	//关闭所有的client
 	//closing all idle clients
@@ -1003,15 +2005,10 @@ func (srv *server) Stop(ctx context.Context) error {
 	}()
 	select {
 	case <-ctx.Done():
-		zaplog.Warn("server stop timeout, forced exit", zap.String("error", ctx.Err().Error()))
+		serverLog().Warn("server stop timeout, forced exit", zap.Error(ctx.Err()))
 		return ctx.Err()
 	case <-done:
-		for _, v := range srv.plugins {
-			err := v.Unload()
-			if err != nil {
-				zaplog.Warn("plugin unload error", zap.String("error", err.Error()))
-			}
-		}
+		srv.pluginService.unloadAll()
 		if srv.hooks.OnStop != nil {
 			srv.hooks.OnStop(context.Background())
 		}
@@ -1,6 +1,7 @@
 package gmqtt
 
 import (
+	"bytes"
 	"context"
 
 	"net"
@@ -8,9 +9,15 @@ import (
 	"testing"
 
 	"io"
+	"net/http"
 	"reflect"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
 
 	"github.com/DrmagicE/gmqtt/pkg/packets"
+	"github.com/DrmagicE/gmqtt/pkg/proxyproto"
 )
 
 func TestHooks(t *testing.T) {
@@ -131,6 +138,76 @@ func TestConnackInvalidCode(t *testing.T) {
 
 }
 
+func TestServer_AllowMQTT31(t *testing.T) {
+	a := assert.New(t)
+	for _, allow := range []bool{false, true} {
+		config := DefaultConfig
+		config.AllowMQTT31 = allow
+		srv := NewServer(WithConfig(config))
+		srv.tcpListener = append(srv.tcpListener, &testListener{acceptReady: make(chan struct{})})
+		srv.Run()
+
+		ln := srv.tcpListener[0].(*testListener)
+		conn := &rwTestConn{
+			closec:    make(chan struct{}),
+			readChan:  make(chan []byte, 1024),
+			writeChan: make(chan []byte, 1024),
+		}
+		ln.conn.PushBack(conn)
+		ln.acceptReady <- struct{}{}
+		connect := defaultConnectPacket()
+		connect.ProtocolName = []byte("MQIsdp")
+		connect.ProtocolLevel = packets.Version31
+		connect.CleanSession = false
+		writePacket(conn, connect)
+		p, err := readPacket(conn)
+		a.NoError(err)
+		ack := p.(*packets.Connack)
+		if allow {
+			a.EqualValues(packets.CodeAccepted, ack.Code)
+			a.Equal(packets.Version31, srv.Client("MQTT").OptionsReader().ProtocolLevel())
+		} else {
+			a.EqualValues(packets.CodeUnacceptableProtocolVersion, ack.Code)
+		}
+		a.EqualValues(0, ack.SessionPresent)
+		srv.Stop(context.Background())
+	}
+}
+
+func TestServer_Strictness(t *testing.T) {
+	a := assert.New(t)
+	for _, strictness := range []packets.Strictness{packets.Strict, packets.Lenient} {
+		arrived := make(chan string, 1)
+		config := DefaultConfig
+		config.Strictness = strictness
+		srv := NewServer(WithConfig(config), WithHook(Hooks{
+			OnMsgArrived: func(ctx context.Context, client Client, msg packets.Message) (valid bool) {
+				arrived <- msg.Topic()
+				return true
+			},
+		}))
+		srv.tcpListener = append(srv.tcpListener, &testListener{acceptReady: make(chan struct{})})
+		srv.Run()
+
+		c := connectTestClient(srv, defaultConnectPacket())
+		writePacket(c, &packets.Publish{Qos: packets.QOS_0, TopicName: []byte("a\x01b")})
+		if strictness == packets.Lenient {
+			select {
+			case topic := <-arrived:
+				a.Equal("a\x01b", topic)
+			case <-time.After(time.Second):
+				t.Fatal("OnMsgArrived timeout")
+			}
+		} else {
+			a.Eventually(func() bool {
+				return srv.Client("MQTT") == nil
+			}, time.Second, 10*time.Millisecond)
+			a.Len(arrived, 0)
+		}
+		srv.Stop(context.Background())
+	}
+}
+
 func TestConnackInvalidCodeInhooksStr(t *testing.T) {
 	ln, err := net.Listen("tcp", "127.0.0.1:1883")
 	if err != nil {
@@ -172,6 +249,107 @@ func TestConnackInvalidCodeInhooksStr(t *testing.T) {
 
 }
 
+func TestMaxClientIDLength(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:1883")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	config := DefaultConfig
+	config.MaxClientIDLength = 23
+	srv := NewServer(WithTCPListener(ln), WithConfig(config))
+	defer srv.Stop(context.Background())
+	srv.Run()
+
+	var tt = []struct {
+		clientID []byte
+		code     uint8
+	}{
+		{clientID: bytes.Repeat([]byte("a"), 23), code: packets.CodeAccepted},
+		{clientID: bytes.Repeat([]byte("b"), 24), code: packets.CodeIdentifierRejected},
+	}
+	for _, v := range tt {
+		c, err := net.Dial("tcp", "127.0.0.1:1883")
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		w := packets.NewWriter(c)
+		r := packets.NewReader(c)
+		connect := defaultConnectPacket()
+		connect.ClientID = v.clientID
+		w.WriteAndFlush(connect)
+		p, err := r.ReadPacket()
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if ack, ok := p.(*packets.Connack); ok {
+			if ack.Code != v.code {
+				t.Fatalf("connack.Code error, want %d, but got %d", v.code, ack.Code)
+			}
+		} else {
+			t.Fatalf("invalid type, want %v, got %v", reflect.TypeOf(&packets.Connack{}), reflect.TypeOf(p))
+		}
+		c.Close()
+	}
+}
+
+func TestMaxConcurrentAuth(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:1883")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	entered := make(chan struct{}, 1)
+	release := make(chan struct{})
+	config := DefaultConfig
+	config.MaxConcurrentAuth = 1
+	srv := NewServer(
+		WithTCPListener(ln),
+		WithConfig(config),
+		WithHook(Hooks{
+			OnConnect: func(ctx context.Context, client Client) (code uint8) {
+				if client.OptionsReader().ClientID() == "slow" {
+					entered <- struct{}{}
+					<-release
+				}
+				return packets.CodeAccepted
+			},
+		}),
+	)
+	defer srv.Stop(context.Background())
+	srv.Run()
+
+	connectWithClientID := func(clientID string) *packets.Reader {
+		c, err := net.Dial("tcp", "127.0.0.1:1883")
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		connect := defaultConnectPacket()
+		connect.ClientID = []byte(clientID)
+		packets.NewWriter(c).WriteAndFlush(connect)
+		return packets.NewReader(c)
+	}
+	assertConnackCode := func(r *packets.Reader, code byte) {
+		p, err := r.ReadPacket()
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if ack, ok := p.(*packets.Connack); ok {
+			if ack.Code != code {
+				t.Fatalf("connack.Code error, want %d, but got %d", code, ack.Code)
+			}
+		} else {
+			t.Fatalf("invalid type, want %v, got %v", reflect.TypeOf(&packets.Connack{}), reflect.TypeOf(p))
+		}
+	}
+
+	slow := connectWithClientID("slow")
+	<-entered
+	// the only authentication slot is taken by "slow".
+	assertConnackCode(connectWithClientID("fast"), packets.CodeServerUnavaliable)
+	close(release)
+	assertConnackCode(slow, packets.CodeAccepted)
+	assertConnackCode(connectWithClientID("fast"), packets.CodeAccepted)
+}
+
 func TestZeroBytesClientId(t *testing.T) {
 	ln, err := net.Listen("tcp", "127.0.0.1:1883")
 	if err != nil {
@@ -233,3 +411,427 @@ func TestRandUUID(t *testing.T) {
 		t.Fatalf("duplicated ID")
 	}
 }
+
+func TestServer_ResolveDelivery(t *testing.T) {
+	a := assert.New(t)
+	conn1 := defaultConnectPacket()
+	conn1.ClientID = []byte("id1")
+	conn1.CleanSession = false
+	srv, c1, _ := connectedServerWith2Client(conn1)
+	defer srv.Stop(context.Background())
+	srv.subscriptionsDB.Subscribe("id1", packets.Topic{Name: "a/+", Qos: packets.QOS_1})
+	srv.subscriptionsDB.Subscribe("id2", packets.Topic{Name: "a/#", Qos: packets.QOS_2})
+	// the client without session
+	srv.subscriptionsDB.Subscribe("id3", packets.Topic{Name: "a/b", Qos: packets.QOS_0})
+
+	writePacket(c1.(*rwTestConn), &packets.Disconnect{})
+	a.Eventually(func() bool {
+		srv.mu.RLock()
+		defer srv.mu.RUnlock()
+		_, ok := srv.offlineClients["id1"]
+		return ok
+	}, time.Second, 10*time.Millisecond)
+
+	a.Equal(map[string]DeliveryTarget{
+		"id1": {Topics: []packets.Topic{{Name: "a/+", Qos: packets.QOS_1}}, Online: false},
+		"id2": {Topics: []packets.Topic{{Name: "a/#", Qos: packets.QOS_2}}, Online: true},
+		"id3": {Topics: []packets.Topic{{Name: "a/b", Qos: packets.QOS_0}}, Online: false},
+	}, srv.ResolveDelivery("a/b"))
+}
+
+// connectTestClient connects a new client to the running srv which is created with a testListener.
+func connectTestClient(srv *server, connect *packets.Connect) *rwTestConn {
+	ln := srv.tcpListener[0].(*testListener)
+	conn := &rwTestConn{
+		closec:    make(chan struct{}),
+		readChan:  make(chan []byte, 1024),
+		writeChan: make(chan []byte, 1024),
+	}
+	ln.conn.PushBack(conn)
+	ln.acceptReady <- struct{}{}
+	writePacket(conn, connect)
+	readPacket(conn)
+	return conn
+}
+
+func TestServer_StopInflightTimeout(t *testing.T) {
+	a := assert.New(t)
+	stopped := make(chan struct{})
+	config := DefaultConfig
+	config.StopInflightTimeout = 5 * time.Second
+	srv := NewServer(WithConfig(config), WithHook(Hooks{
+		OnStop: func(ctx context.Context) {
+			close(stopped)
+		},
+	}))
+	srv.tcpListener = append(srv.tcpListener, &testListener{acceptReady: make(chan struct{})})
+	srv.Run()
+
+	c := connectTestClient(srv, defaultConnectPacket())
+	srv.subscriptionsDB.Subscribe("MQTT", packets.Topic{Name: "a", Qos: packets.QOS_1})
+	srv.PublishService().Publish(NewMessage("a", []byte("a"), packets.QOS_1))
+	p, err := readPacketWithTimeOut(c, time.Second)
+	a.NoError(err)
+	pub := p.(*packets.Publish)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- srv.Stop(context.Background())
+	}()
+	select {
+	case <-done:
+		t.Fatal("Stop returned before the inflight message is acknowledged")
+	case <-time.After(200 * time.Millisecond):
+	}
+	writePacket(c, pub.NewPuback())
+	select {
+	case err := <-done:
+		a.NoError(err)
+	case <-time.After(time.Second):
+		t.Fatal("Stop timeout")
+	}
+	select {
+	case <-stopped:
+	default:
+		t.Fatal("OnStop is not called")
+	}
+}
+
+func TestSessionExpiry(t *testing.T) {
+	a := assert.New(t)
+	expired := make(chan string, 2)
+	terminated := make(chan SessionTerminatedReason, 2)
+	srv := NewServer(WithHook(Hooks{
+		OnSessionExpired: func(ctx context.Context, client Client) {
+			expired <- client.OptionsReader().ClientID()
+		},
+		OnSessionTerminated: func(ctx context.Context, client Client, reason SessionTerminatedReason) {
+			terminated <- reason
+		},
+	}))
+	srv.config.SessionExpiryInterval = 200 * time.Millisecond
+	srv.config.SessionExpiryCheckInterval = 10 * time.Millisecond
+	srv.tcpListener = append(srv.tcpListener, &testListener{acceptReady: make(chan struct{})})
+	defer srv.Stop(context.Background())
+	conn1 := defaultConnectPacket()
+	conn1.ClientID = []byte("id1")
+	conn1.CleanSession = false
+	conn2 := defaultConnectPacket()
+	conn2.ClientID = []byte("id2")
+	conn2.CleanSession = false
+	srv.Run()
+	c1 := connectTestClient(srv, conn1)
+	c2 := connectTestClient(srv, conn2)
+
+	at := time.Now()
+	writePacket(c1, &packets.Disconnect{})
+	writePacket(c2, &packets.Disconnect{})
+	a.Eventually(func() bool {
+		srv.mu.RLock()
+		defer srv.mu.RUnlock()
+		return len(srv.offlineClients) == 2
+	}, time.Second, 10*time.Millisecond)
+
+	// id2 resumes its session before it expires.
+	connectTestClient(srv, conn2)
+
+	select {
+	case id := <-expired:
+		a.Equal("id1", id)
+		a.True(time.Since(at) >= srv.config.SessionExpiryInterval)
+	case <-time.After(2 * time.Second):
+		t.Fatal("session expiry timeout")
+	}
+	a.Equal(ExpiredTermination, <-terminated)
+	srv.mu.RLock()
+	_, ok := srv.clients["id1"]
+	srv.mu.RUnlock()
+	a.False(ok)
+
+	select {
+	case id := <-expired:
+		t.Fatalf("unexpected expired session: %s", id)
+	case <-time.After(300 * time.Millisecond):
+	}
+	a.Equal(0, srv.expiryWheel.Len())
+}
+
+func TestWillDelay(t *testing.T) {
+	a := assert.New(t)
+	srv := NewServer()
+	srv.config.WillDelayInterval = 300 * time.Millisecond
+	srv.tcpListener = append(srv.tcpListener, &testListener{acceptReady: make(chan struct{})})
+	srv.Run()
+	defer srv.Stop(context.Background())
+
+	will := defaultConnectPacket()
+	will.ClientID = []byte("will")
+	will.CleanSession = false
+	will.WillTopic = []byte("will/topic")
+	sub := defaultConnectPacket()
+	sub.ClientID = []byte("sub")
+	sub.WillFlag = false
+	sub.WillQos = packets.QOS_0
+	sub.WillTopic = nil
+	sub.WillMsg = nil
+	subConn := connectTestClient(srv, sub)
+	srv.subscriptionsDB.Subscribe("sub", packets.Topic{Name: "will/topic", Qos: packets.QOS_0})
+
+	// the will message is cancelled when the session is resumed within the delay.
+	willConn := connectTestClient(srv, will)
+	willConn.Close()
+	a.Eventually(func() bool {
+		return len(srv.WillService().PendingWills()) == 1
+	}, time.Second, 10*time.Millisecond)
+	pending := srv.WillService().PendingWills()[0]
+	a.Equal("will", pending.ClientID)
+	a.Equal("will/topic", pending.Message.Topic())
+	willConn = connectTestClient(srv, will)
+	a.Len(srv.WillService().PendingWills(), 0)
+	_, err := readPacketWithTimeOut(subConn, 500*time.Millisecond)
+	a.NotNil(err)
+
+	// the will message is published after the delay.
+	start := time.Now()
+	willConn.Close()
+	p, err := readPacketWithTimeOut(subConn, 2*time.Second)
+	a.Nil(err)
+	if a.IsType(&packets.Publish{}, p) {
+		a.Equal("will/topic", string(p.(*packets.Publish).TopicName))
+		a.True(time.Since(start) >= srv.config.WillDelayInterval-willWheelTick)
+	}
+
+	// the will message can be cancelled by the WillService.
+	willConn = connectTestClient(srv, will)
+	willConn.Close()
+	a.Eventually(func() bool {
+		return len(srv.WillService().PendingWills()) == 1
+	}, time.Second, 10*time.Millisecond)
+	a.True(srv.WillService().Cancel("will"))
+	a.False(srv.WillService().Cancel("will"))
+	_, err = readPacketWithTimeOut(subConn, 500*time.Millisecond)
+	a.NotNil(err)
+}
+
+func TestOnWillPublish(t *testing.T) {
+	a := assert.New(t)
+	published := make(chan packets.Message, 10)
+	srv := NewServer(WithHook(Hooks{
+		OnWillPublish: func(ctx context.Context, client Client, msg packets.Message) packets.Message {
+			switch client.OptionsReader().ClientID() {
+			case "suppressed":
+				return nil
+			case "invalid":
+				return NewMessage("invalid/#", msg.Payload(), msg.Qos())
+			}
+			return NewMessage("rewritten/"+msg.Topic(), []byte("rewritten"), packets.QOS_0)
+		},
+		OnWillPublished: func(ctx context.Context, client Client, msg packets.Message) {
+			published <- msg
+		},
+	}))
+	srv.tcpListener = append(srv.tcpListener, &testListener{acceptReady: make(chan struct{})})
+	srv.Run()
+	defer srv.Stop(context.Background())
+	sub := defaultConnectPacket()
+	sub.ClientID = []byte("sub")
+	sub.WillFlag = false
+	sub.WillQos = packets.QOS_0
+	sub.WillTopic = nil
+	sub.WillMsg = nil
+	subConn := connectTestClient(srv, sub)
+	srv.subscriptionsDB.Subscribe("sub", packets.Topic{Name: "#", Qos: packets.QOS_1})
+
+	for _, id := range []string{"suppressed", "invalid"} {
+		will := defaultConnectPacket()
+		will.ClientID = []byte(id)
+		connectTestClient(srv, will).Close()
+		_, err := readPacketWithTimeOut(subConn, 300*time.Millisecond)
+		a.Equal(errTestReadTimeout, err)
+	}
+	a.Len(published, 0)
+
+	will := defaultConnectPacket()
+	will.ClientID = []byte("will")
+	connectTestClient(srv, will).Close()
+	p, err := readPacketWithTimeOut(subConn, time.Second)
+	a.NoError(err)
+	if a.IsType(&packets.Publish{}, p) {
+		pub := p.(*packets.Publish)
+		a.Equal("rewritten/"+string(will.WillTopic), string(pub.TopicName))
+		a.Equal([]byte("rewritten"), pub.Payload)
+		a.Equal(packets.QOS_0, pub.Qos)
+	}
+	select {
+	case msg := <-published:
+		a.Equal("rewritten/"+string(will.WillTopic), msg.Topic())
+	case <-time.After(time.Second):
+		t.Fatal("OnWillPublished timeout")
+	}
+}
+
+func TestListenerStats(t *testing.T) {
+	a := assert.New(t)
+	srv := NewServer()
+	srv.tcpListener = append(srv.tcpListener, &testListener{acceptReady: make(chan struct{})})
+	srv.Run()
+	defer srv.Stop(context.Background())
+
+	conn := connectTestClient(srv, defaultConnectPacket())
+	name := tcpListenerName(srv.tcpListener[0])
+	ls := srv.statsManager.GetStats().ListenerStats[name]
+	if a.NotNil(ls) {
+		a.EqualValues(1, ls.ConnectionsCurrent)
+		a.EqualValues(1, ls.ConnectionsTotal)
+		a.NotZero(ls.BytesReceived)
+	}
+	// the stats is updated after the connack is written.
+	a.Eventually(func() bool {
+		return srv.statsManager.GetStats().ListenerStats[name].BytesSent != 0
+	}, time.Second, 10*time.Millisecond)
+	conn.Close()
+	a.Eventually(func() bool {
+		return srv.statsManager.GetStats().ListenerStats[name].ConnectionsCurrent == 0
+	}, time.Second, 10*time.Millisecond)
+	a.EqualValues(1, srv.statsManager.GetStats().ListenerStats[name].ConnectionsTotal)
+}
+
+func TestServer_ClientNotFound(t *testing.T) {
+	srv := NewServer()
+	// must be the nil interface so that the caller can compare it with nil.
+	assert.True(t, srv.Client("not-exist") == nil)
+}
+
+func TestSessionTakeover(t *testing.T) {
+	a := assert.New(t)
+	ln, err := net.Listen("tcp", "127.0.0.1:1883")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	var veto = true
+	takenOver := make(chan [2]Client, 1)
+	srv := NewServer(WithTCPListener(ln), WithHook(Hooks{
+		OnSessionTakeover: func(ctx context.Context, oldClient Client, newClient Client) bool {
+			return !veto
+		},
+		OnSessionTakenOver: func(ctx context.Context, oldClient Client, newClient Client) {
+			takenOver <- [2]Client{oldClient, newClient}
+		},
+	}))
+	defer srv.Stop(context.Background())
+	srv.Run()
+
+	c1, code := dialAndConnect(t, "id")
+	defer c1.Close()
+	a.EqualValues(packets.CodeAccepted, code)
+	old := srv.Client("id")
+
+	c2, code := dialAndConnect(t, "id")
+	defer c2.Close()
+	a.EqualValues(packets.CodeIdentifierRejected, code)
+	a.True(old.IsConnected())
+	a.True(srv.Client("id") == old)
+
+	veto = false
+	c3, code := dialAndConnect(t, "id")
+	defer c3.Close()
+	a.EqualValues(packets.CodeAccepted, code)
+	select {
+	case clients := <-takenOver:
+		a.True(clients[0] == old)
+		a.True(clients[1] == srv.Client("id"))
+		a.False(old.IsConnected())
+	case <-time.After(time.Second):
+		t.Fatal("OnSessionTakenOver timeout")
+	}
+	// the old connection is closed.
+	c1.SetReadDeadline(time.Now().Add(time.Second))
+	_, err = packets.NewReader(c1).ReadPacket()
+	a.Error(err)
+}
+
+func TestWebsocketServer(t *testing.T) {
+	a := assert.New(t)
+	ws := &WsServer{
+		Server:            &http.Server{Addr: "127.0.0.1:18080"},
+		Path:              "/mqtt",
+		StrictSubprotocol: true,
+		EnableCompression: true,
+		AllowedOrigins:    []string{"https://example.com"},
+	}
+	srv := NewServer(WithWebsocketServer(ws))
+	defer srv.Stop(context.Background())
+	srv.Run()
+
+	dial := func(subprotocols []string, origin string) (*websocket.Conn, *http.Response, error) {
+		dialer := &websocket.Dialer{Subprotocols: subprotocols, EnableCompression: true}
+		header := http.Header{}
+		if origin != "" {
+			header.Set("Origin", origin)
+		}
+		var c *websocket.Conn
+		var resp *http.Response
+		var err error
+		// wait for the websocket server to start.
+		for i := 0; i < 50; i++ {
+			c, resp, err = dialer.Dial("ws://127.0.0.1:18080/mqtt", header)
+			if resp != nil {
+				return c, resp, err
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		t.Fatalf("unexpected error: %s", err)
+		return nil, nil, nil
+	}
+
+	_, resp, err := dial(nil, "")
+	a.Error(err)
+	a.Equal(http.StatusBadRequest, resp.StatusCode)
+
+	_, resp, err = dial([]string{"mqtt"}, "https://evil.com")
+	a.Error(err)
+	a.Equal(http.StatusForbidden, resp.StatusCode)
+
+	c, resp, err := dial([]string{"mqtt"}, "https://EXAMPLE.com")
+	a.NoError(err)
+	a.Equal(http.StatusSwitchingProtocols, resp.StatusCode)
+	defer c.Close()
+	a.Equal("mqtt", c.Subprotocol())
+	a.Contains(resp.Header.Get("Sec-Websocket-Extensions"), "permessage-deflate")
+
+	conn := &wsConn{c.UnderlyingConn(), c}
+	a.NoError(packets.NewWriter(conn).WriteAndFlush(defaultConnectPacket()))
+	p, err := packets.NewReader(conn).ReadPacket()
+	a.NoError(err)
+	a.EqualValues(packets.CodeAccepted, p.(*packets.Connack).Code)
+}
+
+func TestProxyProtocolListener(t *testing.T) {
+	a := assert.New(t)
+	ln, err := net.Listen("tcp", "127.0.0.1:1883")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	remote := make(chan string, 1)
+	srv := NewServer(WithTCPListener(proxyproto.NewListener(ln, proxyproto.WithRequired())), WithHook(Hooks{
+		OnConnect: func(ctx context.Context, client Client) (code uint8) {
+			remote <- client.OptionsReader().RemoteAddr().String()
+			return packets.CodeAccepted
+		},
+	}))
+	defer srv.Stop(context.Background())
+	srv.Run()
+
+	c, err := net.Dial("tcp", "127.0.0.1:1883")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer c.Close()
+	c.Write([]byte("PROXY TCP4 192.168.0.1 127.0.0.1 12345 1883\r\n"))
+	packets.NewWriter(c).WriteAndFlush(defaultConnectPacket())
+	c.SetReadDeadline(time.Now().Add(time.Second))
+	p, err := packets.NewReader(c).ReadPacket()
+	a.NoError(err)
+	a.EqualValues(packets.CodeAccepted, p.(*packets.Connack).Code)
+	a.Equal("192.168.0.1:12345", <-remote)
+}
@@ -6,6 +6,7 @@ import (
 	"sync"
 	"time"
 
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 
 	"github.com/DrmagicE/gmqtt/pkg/packets"
@@ -20,6 +21,12 @@ type session struct {
 
 	msgQueueMu sync.Mutex //gard msgQueue
 	msgQueue   *list.List //缓存数据，缓存publish报文
+	// msgQueueBytes is the total size of the messages in msgQueue, see publishSize.
+	msgQueueBytes int
+	// msgQueueAt is the enqueue time of the messages in msgQueue.
+	msgQueueAt map[*packets.Publish]time.Time
+	// msgQueuePriority is the non-zero priorities of the messages in msgQueue, see Config.QueuePriorities.
+	msgQueuePriority map[*packets.Publish]int
 
 	//QOS=2 的情况下，判断报文是否是客户端重发报文，如果重发，则不分发.
 	// 确保[MQTT-4.3.3-2]中：在收发送PUBREC报文确认任何到对应的PUBREL报文之前，接收者必须后续的具有相同标识符的PUBLISH报文。
@@ -38,6 +45,10 @@ type inflightElem struct {
 	at time.Time
 	//packet represents Publish packet
 	packet *packets.Publish
+	// spanContext is the span context of the deliver span, invalid if the message is not traced.
+	spanContext trace.SpanContext
+	// delivery is the delivery for the OnAcked hook, nil if the hook is not set or the message is restored.
+	delivery *Delivery
 }
 
 //awaitRelElem is the element type in awaitRel queue
@@ -60,8 +71,9 @@ func (client *client) setAwaitRel(pid packets.PacketID) {
 	if s.awaitRel.Len() >= s.config.MaxAwaitRel && s.config.MaxAwaitRel != 0 { //加入缓存队列
 		removeMsg := s.awaitRel.Front()
 		s.awaitRel.Remove(removeMsg)
-		zaplog.Info("awaitRel window is full, removing the front elem",
-			zap.String("clientID", client.opts.clientID),
+		client.persistInflightRemove(removeMsg.Value.(*awaitRelElem).pid)
+		sessionLog().Info("awaitRel window is full, removing the front elem",
+			zap.String("client_id", client.opts.clientID),
 			zap.Int16("pid", int16(pid)))
 	} else {
 		client.statsManager.addAwaitCurrent(1)
@@ -79,6 +91,7 @@ func (client *client) unsetAwaitRel(pid packets.PacketID) {
 		if el, ok := e.Value.(*awaitRelElem); ok {
 			if el.pid == pid {
 				s.awaitRel.Remove(e)
+				client.persistInflightRemove(pid)
 				client.statsManager.decAwaitCurrent(1)
 				s.freePacketID(pid)
 				return
@@ -93,70 +106,125 @@ func (client *client) unsetAwaitRel(pid packets.PacketID) {
 //2.如果准备入队的报文qos=0,丢弃
 //3.丢弃最先进入缓存队列的报文
 
-//When the len of msgQueueu is reaching the maximum setting, message will be dropped according to the following priorities：
+//When the msgQueue is reaching the length or bytes limit, messages will be dropped according to the QueueDropPolicy.
+//With the default DropQos0First policy, messages are dropped according to the following priorities：
 //1. qos0 message in the msgQueue
 //2. qos0 message that is going to enqueue
 //3. the front message of msgQueue
+//If Config.QueuePriorities is set, the messages are dequeued in the priority order, and the QueueDropPolicy
+//only applies to the messages of the lowest priority, the message going to enqueue is dropped if its priority is lower.
 func (client *client) msgEnQueue(publish *packets.Publish) {
 	s := client.session
-	srv := client.server
 	s.msgQueueMu.Lock()
 	defer s.msgQueueMu.Unlock()
-	if s.msgQueue.Len() >= s.config.MaxMsgQueue && s.config.MaxMsgQueue != 0 {
-		var removeMsg *list.Element
-		// onMessageDropped hook
-		if srv.hooks.OnMsgDropped != nil {
-			defer func() {
-				cs := context.Background()
-				if removeMsg != nil {
-					srv.hooks.OnMsgDropped(cs, client, messageFromPublish(removeMsg.Value.(*packets.Publish)))
-				} else {
-					srv.hooks.OnMsgDropped(cs, client, messageFromPublish(publish))
-				}
-			}()
+	limits := client.server.queueLimitsOf(client.opts.clientID, s.config)
+	size := publishSize(publish)
+	priority := client.server.queuePriority(publish.TopicName)
+	var removed bool
+	for {
+		reason, full := s.msgQueueFull(limits, size)
+		if !full {
+			break
 		}
-		for e := s.msgQueue.Front(); e != nil; e = e.Next() {
-			if pub, ok := e.Value.(*packets.Publish); ok {
-				if pub.Qos == packets.QOS_0 {
-					removeMsg = e
-					break
-				}
+		removeMsg := s.msgToDrop(limits.DropPolicy, publish, priority)
+		if removeMsg == nil { // dropping the message that is going to enqueue
+			client.msgDropped(publish, reason, "enqueue")
+			if removed {
+				client.persistQueue(publish, true)
 			}
-		}
-		if removeMsg != nil { //case1: removing qos0 message in the msgQueue
-			zaplog.Info("message queue is full, removing msg",
-				zap.String("clientID", client.opts.clientID),
-				zap.String("type", "QOS_0 in queue"),
-				zap.String("packet", removeMsg.Value.(packets.Packet).String()),
-			)
-			s.msgQueue.Remove(removeMsg)
-			client.server.statsManager.messageDropped(0)
-			client.statsManager.messageDropped(0)
-		} else if publish.Qos == packets.QOS_0 { //case2: removing qos0 message that is going to enqueue
-			zaplog.Info("message queue is full, removing msg",
-				zap.String("clientID", client.opts.clientID),
-				zap.String("type", "QOS_0 enqueue"),
-				zap.String("packet", publish.String()),
-			)
-			client.server.statsManager.messageDropped(0)
-			client.statsManager.messageDropped(0)
 			return
-		} else { //case3: removing the front message of msgQueue
-			removeMsg = s.msgQueue.Front()
-			s.msgQueue.Remove(removeMsg)
-			zaplog.Info("message queue is full, removing msg",
-				zap.String("clientID", client.opts.clientID),
-				zap.String("type", "front"),
-				zap.String("packet", removeMsg.Value.(packets.Packet).String()),
-			)
-			client.server.statsManager.messageDropped(removeMsg.Value.(*packets.Publish).Qos)
-			client.statsManager.messageDropped(removeMsg.Value.(*packets.Publish).Qos)
 		}
-	} else {
-		client.server.statsManager.messageEnqueue(1)
-		client.statsManager.messageEnqueue(1)
+		pub := s.removeQueued(removeMsg)
+		client.server.statsManager.messageDequeue(1)
+		client.statsManager.messageDequeue(1)
+		client.msgDropped(pub, reason, "in queue")
+		removed = true
+	}
+	client.server.statsManager.messageEnqueue(1)
+	client.statsManager.messageEnqueue(1)
+	s.pushQueued(publish, time.Now(), priority)
+	client.persistQueue(publish, removed)
+	client.server.traceService.record(TraceQueued, client.opts.clientID, publish, "")
+}
+
+// pushQueued adds the publish of the priority to the msgQueue, it must be called with msgQueueMu held.
+func (s *session) pushQueued(publish *packets.Publish, at time.Time, priority int) {
+	s.insertQueued(publish, priority)
+	s.msgQueueBytes += publishSize(publish)
+	s.msgQueueAt[publish] = at
+}
+
+// removeQueued removes the element from the msgQueue, it must be called with msgQueueMu held.
+func (s *session) removeQueued(e *list.Element) *packets.Publish {
+	pub := s.msgQueue.Remove(e).(*packets.Publish)
+	s.msgQueueBytes -= publishSize(pub)
+	delete(s.msgQueueAt, pub)
+	delete(s.msgQueuePriority, pub)
+	return pub
+}
+
+// publishSize returns the size of the publish which is accounted in the msgQueue bytes limit.
+func publishSize(publish *packets.Publish) int {
+	return len(publish.TopicName) + len(publish.Payload)
+}
+
+// msgQueueFull returns whether the msgQueue has no space for a message of size, and the reason.
+// It must be called with msgQueueMu held.
+func (s *session) msgQueueFull(limits QueueLimits, size int) (MsgDroppedReason, bool) {
+	if limits.MaxMsgQueue != 0 && s.msgQueue.Len() >= limits.MaxMsgQueue {
+		return DroppedQueueFull, true
+	}
+	if limits.MaxMsgQueueBytes != 0 && s.msgQueueBytes+size > limits.MaxMsgQueueBytes {
+		return DroppedQueueBytesFull, true
+	}
+	return 0, false
+}
+
+// msgToDrop returns the message in the msgQueue to be dropped according to the policy,
+// nil means the publish of the priority that is going to enqueue should be dropped.
+// The policy applies to the queued messages of the lowest priority, and the publish if it has the same priority.
+// It must be called with msgQueueMu held.
+func (s *session) msgToDrop(policy QueueDropPolicy, publish *packets.Publish, priority int) *list.Element {
+	first, lowest := s.lowestQueued()
+	if first == nil || priority < lowest {
+		return nil
+	}
+	switch policy {
+	case DropNewest:
+		if priority == lowest {
+			return nil
+		}
+		return s.msgQueue.Back()
+	case DropOldest:
+		return first
+	default:
+		for e := first; e != nil; e = e.Next() {
+			if e.Value.(*packets.Publish).Qos == packets.QOS_0 {
+				return e
+			}
+		}
+		if priority == lowest && publish.Qos == packets.QOS_0 {
+			return nil
+		}
+		return first
+	}
+}
+
+// msgDropped records the message which is dropped from the msgQueue.
+func (client *client) msgDropped(publish *packets.Publish, reason MsgDroppedReason, typ string) {
+	srv := client.server
+	sessionLog().Info("dropping msg",
+		zap.String("client_id", client.opts.clientID),
+		zap.String("type", typ),
+		zap.String("reason", reason.String()),
+		zap.String("packet", publish.String()),
+	)
+	srv.statsManager.messageDropped(publish.Qos)
+	client.statsManager.messageDropped(publish.Qos)
+	srv.traceService.record(TraceDropped, client.opts.clientID, publish, reason.String())
+	if srv.hooks.OnMsgDropped != nil {
+		srv.hooks.OnMsgDropped(context.Background(), client, messageFromPublish(publish), reason)
 	}
-	s.msgQueue.PushBack(publish)
 }
 
 func (client *client) msgDequeue() *packets.Publish {
@@ -164,23 +232,27 @@ func (client *client) msgDequeue() *packets.Publish {
 	s.msgQueueMu.Lock()
 	defer s.msgQueueMu.Unlock()
 
-	if s.msgQueue.Len() > 0 {
+	for s.msgQueue.Len() > 0 {
 		queueElem := s.msgQueue.Front()
-		zaplog.Debug("msg dequeued",
-			zap.String("clientID", client.opts.clientID),
-			zap.String("packet", queueElem.Value.(*packets.Publish).String()))
-
-		s.msgQueue.Remove(queueElem)
+		expired := client.msgExpired(s.msgQueueAt[queueElem.Value.(*packets.Publish)], time.Now())
+		pub := s.removeQueued(queueElem)
 		client.statsManager.messageDequeue(1)
 		client.server.statsManager.messageDequeue(1)
-		return queueElem.Value.(*packets.Publish)
+		if expired {
+			client.msgDropped(pub, DroppedExpired, "in queue")
+			continue
+		}
+		sessionLog().Debug("msg dequeued",
+			zap.String("client_id", client.opts.clientID),
+			zap.String("packet", pub.String()))
+		return pub
 	}
 	return nil
 
 }
 
 //inflight 入队,inflight队列满，放入缓存队列，缓存队列满，删除最早进入缓存队列的内容
-func (client *client) setInflight(publish *packets.Publish) (enqueue bool) {
+func (client *client) setInflight(publish *packets.Publish, spanContext trace.SpanContext, delivery *Delivery) (enqueue bool) {
 	s := client.session
 	s.inflightMu.Lock()
 	defer func() {
@@ -190,20 +262,23 @@ func (client *client) setInflight(publish *packets.Publish) (enqueue bool) {
 		}
 	}()
 	elem := &inflightElem{
-		at:     time.Now(),
-		packet: publish,
+		at:          time.Now(),
+		packet:      publish,
+		spanContext: spanContext,
+		delivery:    delivery,
 	}
 	if s.inflight.Len() >= s.config.MaxInflight && s.config.MaxInflight != 0 { //加入缓存队列
-		zaplog.Info("inflight window full, saving msg into msgQueue",
-			zap.String("clientID", client.opts.clientID),
+		sessionLog().Info("inflight window full, saving msg into msgQueue",
+			zap.String("client_id", client.opts.clientID),
 			zap.String("packet", elem.packet.String()),
 		)
 		client.msgEnQueue(publish)
 		enqueue = false
 		return
 	}
-	zaplog.Debug("set inflight", zap.String("clientID", client.opts.clientID), zap.String("packet", elem.packet.String()))
+	sessionLog().Debug("set inflight", zap.String("client_id", client.opts.clientID), zap.String("packet", elem.packet.String()))
 	s.inflight.PushBack(elem)
+	client.persistInflightAdd(publish)
 	enqueue = true
 	return
 }
@@ -235,15 +310,24 @@ func (client *client) unsetInflight(packet packets.Packet) {
 			if el.packet.PacketID == pid {
 				s.inflight.Remove(e)
 				client.statsManager.decInflightCurrent(1)
-				zaplog.Debug("unset inflight", zap.String("clientID", client.opts.clientID),
+				sessionLog().Debug("unset inflight", zap.String("client_id", client.opts.clientID),
 					zap.String("packet", packet.String()),
 				)
 				if freeID {
 					s.freePacketID(pid)
+					client.persistInflightRemove(pid)
+				} else {
+					client.persistInflightRelease(pid)
 				}
+				srv.traceService.record(TraceAcked, client.opts.clientID, el.packet, "")
+				srv.telemetry.ack(client, el)
 				// onAcked hook
 				if srv.hooks.OnAcked != nil {
-					srv.hooks.OnAcked(context.Background(), client, messageFromPublish(e.Value.(*inflightElem).packet))
+					delivery := el.delivery
+					if delivery == nil {
+						delivery = client.newDelivery(el.packet)
+					}
+					srv.hooks.OnAcked(context.Background(), client, delivery)
 				}
 				publish := client.msgDequeue()
 				if publish != nil {
@@ -252,7 +336,8 @@ func (client *client) unsetInflight(packet packets.Packet) {
 						packet: publish,
 					}
 					s.inflight.PushBack(elem)
-					client.sendMsg(publish)
+					client.persistInflightAdd(publish)
+					client.sendMsg(publish, nil)
 				}
 				return
 			}
@@ -274,8 +359,8 @@ func (s *session) setPacketID(id packets.PacketID) {
 }
 
 func (s *session) getPacketID() packets.PacketID {
-	s.pidMu.RLock()
-	defer s.pidMu.RUnlock()
+	s.pidMu.Lock()
+	defer s.pidMu.Unlock()
 	for s.lockedPid[s.freePid] {
 		s.freePid++
 		if s.freePid > packets.MAX_PACKET_ID {
@@ -1,9 +1,12 @@
 package gmqtt
 
 import (
+	"context"
 	"fmt"
 	"testing"
 
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 
 	"github.com/DrmagicE/gmqtt/pkg/packets"
@@ -14,7 +17,8 @@ const testMaxAwaitRelLen = 20
 const testMaxMsgQueueLen = 20
 
 func init() {
-	zaplog, _ = zap.NewProduction()
+	logger, _ := zap.NewProduction()
+	setLogger(logger)
 }
 
 //mock client,only for session_test.go
@@ -33,7 +37,7 @@ func fullInflightSessionQos1() *client {
 	c := mockClient()
 	for i := 1; i <= testMaxInflightLen; i++ {
 		pub := &packets.Publish{PacketID: packets.PacketID(i), Qos: packets.QOS_1}
-		c.setInflight(pub)
+		c.setInflight(pub, trace.SpanContext{}, nil)
 	}
 	return c
 }
@@ -41,7 +45,7 @@ func TestQos1Inflight(t *testing.T) {
 	c := mockClient()
 	for i := 1; i <= testMaxInflightLen; i++ {
 		pub := &packets.Publish{PacketID: packets.PacketID(i), Qos: packets.QOS_1}
-		if !c.setInflight(pub) {
+		if !c.setInflight(pub, trace.SpanContext{}, nil) {
 			t.Fatalf("setInflight error, want true, but false")
 		}
 		if c.session.msgQueue.Len() != 0 {
@@ -86,7 +90,7 @@ func TestQos2Inflight(t *testing.T) {
 	c := mockClient()
 	for i := 1; i <= testMaxInflightLen; i++ {
 		pub := &packets.Publish{PacketID: packets.PacketID(i), Qos: packets.QOS_2}
-		if !c.setInflight(pub) {
+		if !c.setInflight(pub, trace.SpanContext{}, nil) {
 			t.Fatalf("setInflight error, want true, but false")
 		}
 		if c.session.msgQueue.Len() != 0 {
@@ -138,7 +142,7 @@ func TestMsgQueue(t *testing.T) {
 	for i := beginPid; i < testMaxMsgQueueLen+beginPid; i++ {
 		j++
 		pub := &packets.Publish{PacketID: packets.PacketID(i), Qos: packets.QOS_1}
-		if c.setInflight(pub) {
+		if c.setInflight(pub, trace.SpanContext{}, nil) {
 			t.Fatalf("setInflight error, want fase, but true")
 		}
 		if c.session.msgQueue.Len() != j {
@@ -270,3 +274,77 @@ func TestMonitor_MsgQueueDroppedPriority(t *testing.T) {
 	}
 
 }
+
+func queuedPacketIDs(c *client) []packets.PacketID {
+	var pids []packets.PacketID
+	for e := c.session.msgQueue.Front(); e != nil; e = e.Next() {
+		pids = append(pids, e.Value.(*packets.Publish).PacketID)
+	}
+	return pids
+}
+
+func TestMsgQueueDropPolicy(t *testing.T) {
+	a := assert.New(t)
+	for policy, want := range map[QueueDropPolicy][]packets.PacketID{
+		DropOldest: {2, 3, 4},
+		DropNewest: {1, 2, 3},
+	} {
+		c := fullInflightSessionQos1()
+		c.session.config.MaxMsgQueue = 3
+		c.session.config.MsgQueueDropPolicy = policy
+		c.msgEnQueue(&packets.Publish{PacketID: 1, Qos: packets.QOS_1})
+		c.msgEnQueue(&packets.Publish{PacketID: 2, Qos: packets.QOS_0})
+		c.msgEnQueue(&packets.Publish{PacketID: 3, Qos: packets.QOS_2})
+		c.msgEnQueue(&packets.Publish{PacketID: 4, Qos: packets.QOS_1})
+		a.Equal(want, queuedPacketIDs(c), "policy %d", policy)
+		a.EqualValues(3, c.statsManager.GetStats().MessageStats.QueuedCurrent)
+	}
+}
+
+func TestMsgQueueBytesLimit(t *testing.T) {
+	a := assert.New(t)
+	c := fullInflightSessionQos1()
+	var reasons []MsgDroppedReason
+	c.server.hooks.OnMsgDropped = func(ctx context.Context, client Client, msg packets.Message, reason MsgDroppedReason) {
+		reasons = append(reasons, reason)
+	}
+	c.session.config.MaxMsgQueueBytes = 10
+	c.session.config.MsgQueueDropPolicy = DropOldest
+	// each message is 4 bytes
+	for i := 1; i <= 3; i++ {
+		c.msgEnQueue(&packets.Publish{PacketID: packets.PacketID(i), Qos: packets.QOS_1, TopicName: []byte("t"), Payload: []byte("abc")})
+	}
+	a.Equal([]packets.PacketID{2, 3}, queuedPacketIDs(c))
+	a.Equal(8, c.session.msgQueueBytes)
+	// the message which exceeds the limit alone is dropped
+	c.msgEnQueue(&packets.Publish{PacketID: 4, Qos: packets.QOS_1, TopicName: []byte("t"), Payload: []byte("0123456789")})
+	a.Len(queuedPacketIDs(c), 0)
+	a.Equal(0, c.session.msgQueueBytes)
+	a.Equal([]MsgDroppedReason{DroppedQueueBytesFull, DroppedQueueBytesFull, DroppedQueueBytesFull, DroppedQueueBytesFull}, reasons)
+	a.EqualValues(4, c.statsManager.GetStats().MessageStats.Qos1.DroppedTotal)
+
+	c.msgEnQueue(&packets.Publish{PacketID: 5, Qos: packets.QOS_1, TopicName: []byte("t"), Payload: []byte("abc")})
+	a.Equal(4, c.session.msgQueueBytes)
+	a.NotNil(c.msgDequeue())
+	a.Equal(0, c.session.msgQueueBytes)
+}
+
+func TestServer_SetQueueLimits(t *testing.T) {
+	a := assert.New(t)
+	c := fullInflightSessionQos1()
+	c.opts.clientID = "id"
+	var reasons []MsgDroppedReason
+	c.server.hooks.OnMsgDropped = func(ctx context.Context, client Client, msg packets.Message, reason MsgDroppedReason) {
+		reasons = append(reasons, reason)
+	}
+	c.server.SetQueueLimits("id", &QueueLimits{MaxMsgQueue: 1, DropPolicy: DropNewest})
+	c.msgEnQueue(&packets.Publish{PacketID: 1, Qos: packets.QOS_1})
+	c.msgEnQueue(&packets.Publish{PacketID: 2, Qos: packets.QOS_1})
+	a.Equal([]packets.PacketID{1}, queuedPacketIDs(c))
+	a.Equal([]MsgDroppedReason{DroppedQueueFull}, reasons)
+
+	// reset to the limits in config
+	c.server.SetQueueLimits("id", nil)
+	c.msgEnQueue(&packets.Publish{PacketID: 3, Qos: packets.QOS_1})
+	a.Equal([]packets.PacketID{1, 3}, queuedPacketIDs(c))
+}
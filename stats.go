@@ -1,7 +1,9 @@
 package gmqtt
 
 import (
+	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/DrmagicE/gmqtt/pkg/packets"
 	"github.com/DrmagicE/gmqtt/subscription"
@@ -12,8 +14,19 @@ type StatsManager interface {
 	packetStatsManager
 	clientStatsManager
 	messageStatsManager
+	retainedStatsManager
+	listenerStatsManager
+	dispatchStatsManager
 	// GetStats return the server statistics
 	GetStats() *ServerStats
+	// GetTopicStats returns the statistics of the topic name, false if the topic is not collected,
+	// see Config.MaxTopicStats.
+	GetTopicStats(topic string) (TopicStats, bool)
+	// TopTopics returns at most n topics with the most messages in and out, in descending order.
+	// n <= 0 means all collected topics.
+	TopTopics(n int) []TopicStats
+	// ResetTopicStats removes the statistics of all topics, so the new topics can be collected.
+	ResetTopicStats()
 }
 
 // SessionStatsManager interface provides the ability to access the statistics of the session
@@ -59,6 +72,21 @@ type clientStatsManager interface {
 	decSessionInactive()
 	addSessionExpired()
 }
+type listenerStatsManager interface {
+	// listenerStats returns the statistics of the listener specified by name, it is created if not exists.
+	listenerStats(name string) *ListenerStats
+}
+type dispatchStatsManager interface {
+	dispatchEnqueue()
+	dispatchDequeue()
+	// dispatched records the delivery handled by the fan-out workers, latency is the time it waited in the queue.
+	dispatched(latency time.Duration)
+	// dispatchOverflowed records the delivery queued in the session since the fan-out queue of the subscriber is full.
+	dispatchOverflowed()
+}
+type retainedStatsManager interface {
+	retainedDropped()
+}
 type messageStatsManager interface {
 	messageDropped(qos uint8)
 	messageReceived(qos uint8)
@@ -131,6 +159,15 @@ func (p *PacketStats) add(pt packets.Packet, receive bool) {
 		atomic.AddUint64(&count.Unsubscribe, 1)
 	}
 }
+func newPacketStats() PacketStats {
+	return PacketStats{
+		BytesReceived: &PacketBytes{},
+		ReceivedTotal: &PacketCount{},
+		BytesSent:     &PacketBytes{},
+		SentTotal:     &PacketCount{},
+	}
+}
+
 func (p *PacketStats) copy() *PacketStats {
 	return &PacketStats{
 		BytesReceived: p.BytesReceived.copy(),
@@ -158,6 +195,12 @@ type PacketBytes struct {
 	Unsubscribe uint64
 }
 
+// total returns the sum of the bytes of all packet types.
+func (p *PacketBytes) total() uint64 {
+	return p.Connect + p.Connack + p.Disconnect + p.Pingreq + p.Pingresp + p.Puback + p.Pubcomp +
+		p.Publish + p.Pubrec + p.Pubrel + p.Suback + p.Subscribe + p.Unsuback + p.Unsubscribe
+}
+
 func (p *PacketBytes) copy() *PacketBytes {
 	return &PacketBytes{
 		Connect:     atomic.LoadUint64(&p.Connect),
@@ -289,12 +332,124 @@ func (m *MessageStats) copy() *MessageStats {
 	}
 }
 
+// RetainedStats represents the statistics of the retained messages.
+type RetainedStats struct {
+	// DroppedTotal is the number of the retained messages which are not retained
+	// because of Config.MaxRetainedMessages or Config.MaxRetainedPayloadSize.
+	DroppedTotal uint64
+}
+
+func (r *RetainedStats) copy() *RetainedStats {
+	return &RetainedStats{
+		DroppedTotal: atomic.LoadUint64(&r.DroppedTotal),
+	}
+}
+
+// DispatchStats represents the statistics of the deliveries handled by the fan-out workers.
+type DispatchStats struct {
+	// QueuedCurrent is the number of the deliveries waiting in the queues of the workers.
+	QueuedCurrent uint64
+	// DispatchedTotal is the number of the deliveries handled by the workers.
+	DispatchedTotal uint64
+	// LatencyNanoTotal is the total nanoseconds the deliveries waited in the queues,
+	// the average latency is LatencyNanoTotal / DispatchedTotal.
+	LatencyNanoTotal uint64
+	// OverflowedTotal is the number of the deliveries queued in the sessions of the subscribers,
+	// since the fan-out queues of the subscribers were full, see Config.FanOutQueueLen.
+	OverflowedTotal uint64
+}
+
+func (d *DispatchStats) copy() *DispatchStats {
+	return &DispatchStats{
+		QueuedCurrent:    atomic.LoadUint64(&d.QueuedCurrent),
+		DispatchedTotal:  atomic.LoadUint64(&d.DispatchedTotal),
+		LatencyNanoTotal: atomic.LoadUint64(&d.LatencyNanoTotal),
+		OverflowedTotal:  atomic.LoadUint64(&d.OverflowedTotal),
+	}
+}
+
+// ListenerStats represents the statistics of the connections accepted by a listener.
+type ListenerStats struct {
+	// ConnectionsCurrent is the number of the current connections of the listener.
+	ConnectionsCurrent uint64
+	// ConnectionsTotal is the number of the connections accepted by the listener.
+	ConnectionsTotal uint64
+	BytesReceived    uint64
+	BytesSent        uint64
+	// RejectedListenerQuota is the number of the connections rejected by Config.MaxConnectionsPerListener.
+	RejectedListenerQuota uint64
+	// RejectedIPQuota is the number of the connections rejected by Config.MaxConnectionsPerIP
+	// and Config.IPConnectionQuotas.
+	RejectedIPQuota uint64
+	// RejectedOverload is the number of the connections rejected because the server is overloaded.
+	RejectedOverload uint64
+}
+
+func (l *ListenerStats) copy() *ListenerStats {
+	return &ListenerStats{
+		ConnectionsCurrent:    atomic.LoadUint64(&l.ConnectionsCurrent),
+		ConnectionsTotal:      atomic.LoadUint64(&l.ConnectionsTotal),
+		BytesReceived:         atomic.LoadUint64(&l.BytesReceived),
+		BytesSent:             atomic.LoadUint64(&l.BytesSent),
+		RejectedListenerQuota: atomic.LoadUint64(&l.RejectedListenerQuota),
+		RejectedIPQuota:       atomic.LoadUint64(&l.RejectedIPQuota),
+		RejectedOverload:      atomic.LoadUint64(&l.RejectedOverload),
+	}
+}
+
+// The methods below accept the nil receiver, which is the stats of the connections not accepted by any listener.
+func (l *ListenerStats) connectionOpened() {
+	if l == nil {
+		return
+	}
+	atomic.AddUint64(&l.ConnectionsTotal, 1)
+	atomic.AddUint64(&l.ConnectionsCurrent, 1)
+}
+func (l *ListenerStats) connectionClosed() {
+	if l == nil {
+		return
+	}
+	atomic.AddUint64(&l.ConnectionsCurrent, ^uint64(0))
+}
+func (l *ListenerStats) packetReceived(p packets.Packet) {
+	if l == nil {
+		return
+	}
+	atomic.AddUint64(&l.BytesReceived, uint64(packets.TotalBytes(p)))
+}
+func (l *ListenerStats) packetSent(p packets.Packet) {
+	if l == nil {
+		return
+	}
+	atomic.AddUint64(&l.BytesSent, uint64(packets.TotalBytes(p)))
+}
+
+// ConnectionStats is the statistics of the current connection of the client, see Client.GetClientStats.
+type ConnectionStats struct {
+	// PacketStats is the bytes and the number of each packet type received from and sent to the client.
+	PacketStats *PacketStats
+	// BytesReceived is the total bytes of the packets received from the client.
+	BytesReceived uint64
+	// BytesSent is the total bytes of the packets sent to the client.
+	BytesSent uint64
+	// LastSeen is the time of the last packet received from the client, zero if no packet has been received.
+	LastSeen time.Time
+	// SessionStats is the statistics of the session, including the current length of the inflight and message queue.
+	SessionStats *SessionStats
+}
+
 // ServerStats is the collection of global  statistics.
 type ServerStats struct {
 	PacketStats       *PacketStats
 	ClientStats       *ClientStats
 	MessageStats      *MessageStats
 	SubscriptionStats *subscription.Stats
+	RetainedStats     *RetainedStats
+	// ListenerStats is the statistics of each listener, key by the listener name,
+	// e.g: "tcp://0.0.0.0:1883", "unix:///var/run/gmqtt.sock", "ws://:8080/ws".
+	ListenerStats map[string]*ListenerStats
+	// DispatchStats is the statistics of the fan-out workers, see Config.FanOutWorkers.
+	DispatchStats *DispatchStats
 }
 
 type statsManager struct {
@@ -303,6 +458,12 @@ type statsManager struct {
 	clientStats       ClientStats
 	messageStats      MessageStats
 	subscriptionStats subscription.Stats
+	retainedStats     RetainedStats
+	dispatchStats     DispatchStats
+	listenerMu        sync.Mutex
+	listeners         map[string]*ListenerStats
+	// topics is the statistics of the topics, nil if Config.MaxTopicStats is 0.
+	topics *topicStats
 }
 
 func (s *statsManager) GetStats() *ServerStats {
@@ -312,8 +473,44 @@ func (s *statsManager) GetStats() *ServerStats {
 		ClientStats:       s.clientStats.copy(),
 		MessageStats:      s.messageStats.copy(),
 		SubscriptionStats: &substats,
+		RetainedStats:     s.retainedStats.copy(),
+		ListenerStats:     s.copyListenerStats(),
+		DispatchStats:     s.dispatchStats.copy(),
 	}
 }
+
+func (s *statsManager) GetTopicStats(topic string) (TopicStats, bool) {
+	return s.topics.get(topic)
+}
+
+func (s *statsManager) TopTopics(n int) []TopicStats {
+	return s.topics.top(n)
+}
+
+func (s *statsManager) ResetTopicStats() {
+	s.topics.reset()
+}
+
+func (s *statsManager) copyListenerStats() map[string]*ListenerStats {
+	s.listenerMu.Lock()
+	defer s.listenerMu.Unlock()
+	rs := make(map[string]*ListenerStats, len(s.listeners))
+	for k, v := range s.listeners {
+		rs[k] = v.copy()
+	}
+	return rs
+}
+
+func (s *statsManager) listenerStats(name string) *ListenerStats {
+	s.listenerMu.Lock()
+	defer s.listenerMu.Unlock()
+	l, ok := s.listeners[name]
+	if !ok {
+		l = &ListenerStats{}
+		s.listeners[name] = l
+	}
+	return l
+}
 func (s *statsManager) packetReceived(p packets.Packet) {
 	s.packetStats.add(p, true)
 }
@@ -354,6 +551,24 @@ func (s *statsManager) addSessionExpired() {
 	atomic.AddUint64(&s.clientStats.ExpiredTotal, 1)
 }
 
+func (s *statsManager) retainedDropped() {
+	atomic.AddUint64(&s.retainedStats.DroppedTotal, 1)
+}
+
+func (s *statsManager) dispatchEnqueue() {
+	atomic.AddUint64(&s.dispatchStats.QueuedCurrent, 1)
+}
+func (s *statsManager) dispatchDequeue() {
+	atomic.AddUint64(&s.dispatchStats.QueuedCurrent, ^uint64(0))
+}
+func (s *statsManager) dispatched(latency time.Duration) {
+	atomic.AddUint64(&s.dispatchStats.DispatchedTotal, 1)
+	atomic.AddUint64(&s.dispatchStats.LatencyNanoTotal, uint64(latency))
+}
+func (s *statsManager) dispatchOverflowed() {
+	atomic.AddUint64(&s.dispatchStats.OverflowedTotal, 1)
+}
+
 func (s *statsManager) messageDropped(qos uint8) {
 	switch qos {
 	case packets.QOS_0:
@@ -393,16 +608,12 @@ func (s *statsManager) messageDequeue(delta uint64) {
 
 func newStatsManager(subStatsReader subscription.StatsReader) *statsManager {
 	return &statsManager{
-		subStatsReader: subStatsReader,
-		packetStats: PacketStats{
-			BytesReceived: &PacketBytes{},
-			ReceivedTotal: &PacketCount{},
-			BytesSent:     &PacketBytes{},
-			SentTotal:     &PacketCount{},
-		},
+		subStatsReader:    subStatsReader,
+		packetStats:       newPacketStats(),
 		clientStats:       ClientStats{},
 		messageStats:      MessageStats{},
 		subscriptionStats: subscription.Stats{},
+		listeners:         make(map[string]*ListenerStats),
 	}
 }
 
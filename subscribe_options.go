@@ -0,0 +1,114 @@
+package gmqtt
+
+import (
+	"github.com/DrmagicE/gmqtt/pkg/packets"
+)
+
+// RetainHandling specifies whether the retained messages are sent when the subscription is made.
+type RetainHandling byte
+
+const (
+	// RetainSendOnSubscribe sends the retained messages whenever the subscription is made.
+	RetainSendOnSubscribe RetainHandling = iota
+	// RetainSendIfNew sends the retained messages only if the subscription does not exist.
+	RetainSendIfNew
+	// RetainDoNotSend does not send the retained messages.
+	RetainDoNotSend
+)
+
+func (r RetainHandling) String() string {
+	switch r {
+	case RetainSendOnSubscribe:
+		return "send_on_subscribe"
+	case RetainSendIfNew:
+		return "send_if_new"
+	case RetainDoNotSend:
+		return "do_not_send"
+	default:
+		return "unknown"
+	}
+}
+
+// SubscribeRequest is a subscription of the SUBSCRIBE packet which can be modified by OnSubscribeRewrite.
+// MQTT 3.1.1 clients can not set the NoLocal and RetainHandling options, they can only be forced by the hook.
+type SubscribeRequest struct {
+	// Topic is the topic filter and the requested QoS of the subscription,
+	// set the Qos to packets.SUBSCRIBE_FAILURE to reject the subscription.
+	Topic packets.Topic
+	// NoLocal prevents the messages published by the client itself from being delivered to the subscription.
+	NoLocal bool
+	// RetainHandling specifies whether the retained messages are sent when the subscription is made.
+	RetainHandling RetainHandling
+}
+
+// subscriptionState is the state of a subscription of which the topic filter is rewritten
+// or the options are forced by OnSubscribeRewrite.
+type subscriptionState struct {
+	// requested is the topic filter in the SUBSCRIBE packet.
+	requested string
+	noLocal   bool
+}
+
+// setSubscriptionState sets the state of the subscription, the state is removed if it is the default state.
+func (srv *server) setSubscriptionState(clientID string, topicFilter string, state subscriptionState) {
+	srv.subStatesMu.Lock()
+	defer srv.subStatesMu.Unlock()
+	states := srv.subStates[clientID]
+	if state.requested == topicFilter && !state.noLocal {
+		if states != nil {
+			delete(states, topicFilter)
+			if len(states) == 0 {
+				delete(srv.subStates, clientID)
+			}
+		}
+		return
+	}
+	if states == nil {
+		states = make(map[string]subscriptionState)
+		srv.subStates[clientID] = states
+	}
+	states[topicFilter] = state
+}
+
+// unsubscribeFilter returns the stored topic filter of the topic filter in the UNSUBSCRIBE packet,
+// and removes the state of the subscription.
+func (srv *server) unsubscribeFilter(clientID string, topicFilter string) string {
+	srv.subStatesMu.Lock()
+	defer srv.subStatesMu.Unlock()
+	states := srv.subStates[clientID]
+	for stored, state := range states {
+		if state.requested == topicFilter {
+			topicFilter = stored
+			break
+		}
+	}
+	delete(states, topicFilter)
+	if states != nil && len(states) == 0 {
+		delete(srv.subStates, clientID)
+	}
+	return topicFilter
+}
+
+// removeSubscriptionStates removes the states of all subscriptions of the client.
+func (srv *server) removeSubscriptionStates(clientID string) {
+	srv.subStatesMu.Lock()
+	delete(srv.subStates, clientID)
+	srv.subStatesMu.Unlock()
+}
+
+// filterNoLocal removes the NoLocal subscriptions from the matched subscriptions of the publisher.
+func (srv *server) filterNoLocal(clientID string, topics []packets.Topic) []packets.Topic {
+	srv.subStatesMu.RLock()
+	defer srv.subStatesMu.RUnlock()
+	states := srv.subStates[clientID]
+	if len(states) == 0 {
+		return topics
+	}
+	rs := make([]packets.Topic, 0, len(topics))
+	for _, t := range topics {
+		if !states[t.Name].noLocal {
+			rs = append(rs, t)
+		}
+	}
+	return rs
+}
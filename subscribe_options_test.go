@@ -0,0 +1,134 @@
+package gmqtt
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/DrmagicE/gmqtt/pkg/packets"
+)
+
+func TestOnSubscribeRewrite(t *testing.T) {
+	a := assert.New(t)
+	srv := newTestServer()
+	srv.hooks.OnSubscribeRewrite = func(ctx context.Context, client Client, req *SubscribeRequest) {
+		switch req.Topic.Name {
+		case "a/b":
+			req.Topic.Name = "prefix/a/b"
+			req.Topic.Qos = packets.QOS_1
+		case "c":
+			// the QoS can not be upgraded.
+			req.Topic.Qos = packets.QOS_2
+		case "d":
+			req.Topic.Qos = packets.SUBSCRIBE_FAILURE
+		case "e":
+			req.Topic.Name = "e/#/x"
+		}
+	}
+	var subscribed []packets.Topic
+	srv.hooks.OnSubscribe = func(ctx context.Context, client Client, topic packets.Topic) (qos uint8) {
+		subscribed = append(subscribed, topic)
+		return topic.Qos
+	}
+	srv.Run()
+	defer srv.Stop(context.Background())
+	c := connectTestClient(srv, defaultConnectPacket())
+	writePacket(c, &packets.Subscribe{
+		PacketID: 1,
+		Topics: []packets.Topic{
+			{Name: "a/b", Qos: packets.QOS_2},
+			{Name: "c", Qos: packets.QOS_0},
+			{Name: "d", Qos: packets.QOS_1},
+			{Name: "e", Qos: packets.QOS_1},
+		},
+	})
+	p, err := readPacket(c)
+	a.NoError(err)
+	a.Equal([]byte{packets.QOS_1, packets.QOS_0, packets.SUBSCRIBE_FAILURE, packets.SUBSCRIBE_FAILURE},
+		p.(*packets.Suback).Payload)
+	// OnSubscribe authorizes the rewritten subscriptions.
+	a.Equal([]packets.Topic{{Name: "prefix/a/b", Qos: packets.QOS_1}, {Name: "c", Qos: packets.QOS_0}}, subscribed)
+	a.ElementsMatch([]packets.Topic{{Name: "prefix/a/b", Qos: packets.QOS_1}, {Name: "c", Qos: packets.QOS_0}},
+		srv.subscriptionsDB.GetClientSubscriptions("MQTT"))
+
+	// the rewritten subscription is unsubscribed by the requested topic filter.
+	writePacket(c, &packets.Unsubscribe{PacketID: 2, Topics: []string{"a/b"}})
+	_, err = readPacket(c)
+	a.NoError(err)
+	time.Sleep(100 * time.Millisecond)
+	a.Equal([]packets.Topic{{Name: "c", Qos: packets.QOS_0}}, srv.subscriptionsDB.GetClientSubscriptions("MQTT"))
+	a.Empty(srv.subStates)
+}
+
+func TestOnSubscribeRewrite_NoLocal(t *testing.T) {
+	a := assert.New(t)
+	srv := newTestServer()
+	srv.hooks.OnSubscribeRewrite = func(ctx context.Context, client Client, req *SubscribeRequest) {
+		req.NoLocal = true
+	}
+	srv.Run()
+	defer srv.Stop(context.Background())
+	conn1 := defaultConnectPacket()
+	conn1.ClientID = []byte("id1")
+	c1 := connectTestClient(srv, conn1)
+	conn2 := defaultConnectPacket()
+	conn2.ClientID = []byte("id2")
+	c2 := connectTestClient(srv, conn2)
+	writePacket(c1, &packets.Subscribe{
+		PacketID: 1,
+		Topics:   []packets.Topic{{Name: "a/#", Qos: packets.QOS_0}},
+	})
+	_, err := readPacket(c1)
+	a.NoError(err)
+
+	writePacket(c1, &packets.Publish{TopicName: []byte("a/b"), Payload: []byte("local")})
+	_, err = readPacketWithTimeOut(c1, 200*time.Millisecond)
+	a.Equal(errTestReadTimeout, err)
+
+	writePacket(c2, &packets.Publish{TopicName: []byte("a/b"), Payload: []byte("remote")})
+	p, err := readPacketWithTimeOut(c1, time.Second)
+	a.NoError(err)
+	a.Equal([]byte("remote"), p.(*packets.Publish).Payload)
+}
+
+func TestOnSubscribeRewrite_RetainHandling(t *testing.T) {
+	a := assert.New(t)
+	srv := newTestServer()
+	srv.hooks.OnSubscribeRewrite = func(ctx context.Context, client Client, req *SubscribeRequest) {
+		switch req.Topic.Name {
+		case "a/#":
+			req.RetainHandling = RetainDoNotSend
+		case "a/+":
+			req.RetainHandling = RetainSendIfNew
+		}
+	}
+	srv.Run()
+	defer srv.Stop(context.Background())
+	srv.retainedDB.AddOrReplace(NewMessage("a/b", []byte("retained"), packets.QOS_0))
+	c := connectTestClient(srv, defaultConnectPacket())
+	subscribe := func(topic string) {
+		writePacket(c, &packets.Subscribe{
+			PacketID: 1,
+			Topics:   []packets.Topic{{Name: topic, Qos: packets.QOS_0}},
+		})
+		p, err := readPacket(c)
+		a.NoError(err)
+		a.IsType(&packets.Suback{}, p)
+	}
+
+	subscribe("a/#")
+	_, err := readPacketWithTimeOut(c, 200*time.Millisecond)
+	a.Equal(errTestReadTimeout, err)
+
+	subscribe("a/+")
+	p, err := readPacketWithTimeOut(c, time.Second)
+	a.NoError(err)
+	a.Equal([]byte("retained"), p.(*packets.Publish).Payload)
+
+	// the subscription exists.
+	subscribe("a/+")
+	_, err = readPacketWithTimeOut(c, 200*time.Millisecond)
+	a.Equal(errTestReadTimeout, err)
+}
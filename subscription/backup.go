@@ -0,0 +1,92 @@
+package subscription
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/DrmagicE/gmqtt/pkg/packets"
+)
+
+// BackupVersion is the version of the format written by Export.
+const BackupVersion = 1
+
+// ErrUnsupportedBackupVersion is returned by Import if the version of the backup is not supported.
+var ErrUnsupportedBackupVersion = errors.New("unsupported backup version")
+
+// backup is the JSON format of the exported subscriptions.
+type backup struct {
+	Version int                      `json:"version"`
+	Clients map[string][]backupTopic `json:"clients"`
+}
+
+type backupTopic struct {
+	Name string `json:"name"`
+	Qos  uint8  `json:"qos"`
+}
+
+// Export writes all subscriptions of the store to w in the versioned JSON format,
+// which can be restored by Import.
+// The subscriptions of each client are sorted by topic filter, so the same store produces the same output.
+// Notice:
+// The export is built by Iterate, it is not a consistent snapshot if the store is modified during the export.
+func Export(store Store, w io.Writer) error {
+	b := backup{
+		Version: BackupVersion,
+		Clients: make(map[string][]backupTopic),
+	}
+	store.Iterate(func(clientID string, topic packets.Topic) bool {
+		b.Clients[clientID] = append(b.Clients[clientID], backupTopic{
+			Name: topic.Name,
+			Qos:  topic.Qos,
+		})
+		return true
+	})
+	for _, topics := range b.Clients {
+		sort.Slice(topics, func(i, j int) bool {
+			return topics[i].Name < topics[j].Name
+		})
+	}
+	return json.NewEncoder(w).Encode(b)
+}
+
+// Import reads the subscriptions written by Export from r and adds them to the store.
+// The existing subscriptions of the store are kept, the imported ones overwrite the qos of the same topic filters.
+// The whole backup is validated before any subscription is added,
+// so the store is not modified if the backup is malformed.
+// If the store rejects a subscription, Import returns the error and the subscriptions
+// which have been added before are kept.
+func Import(store Store, r io.Reader) error {
+	var b backup
+	if err := json.NewDecoder(r).Decode(&b); err != nil {
+		return err
+	}
+	if b.Version != BackupVersion {
+		return ErrUnsupportedBackupVersion
+	}
+	clients := make(ClientTopics, len(b.Clients))
+	for clientID, topics := range b.Clients {
+		for _, t := range topics {
+			if !packets.ValidTopicFilter([]byte(t.Name)) {
+				return fmt.Errorf("%s: client %s, topic %s", packets.ErrInvalTopicFilter, clientID, t.Name)
+			}
+			if t.Qos > packets.QOS_2 {
+				return fmt.Errorf("%s: client %s, topic %s, qos %d", packets.ErrInvalQos, clientID, t.Name, t.Qos)
+			}
+			clients[clientID] = append(clients[clientID], packets.Topic{
+				Qos:  t.Qos,
+				Name: t.Name,
+			})
+		}
+	}
+	for clientID, topics := range clients {
+		for _, v := range store.Subscribe(clientID, topics...) {
+			if v.Err != nil {
+				return fmt.Errorf("client %s, topic %s: %s", clientID, v.Topic.Name, v.Err)
+			}
+		}
+	}
+	return nil
+}
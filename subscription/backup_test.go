@@ -0,0 +1,80 @@
+package subscription_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/DrmagicE/gmqtt/pkg/packets"
+	"github.com/DrmagicE/gmqtt/subscription"
+	"github.com/DrmagicE/gmqtt/subscription/trie"
+)
+
+func TestExportImport(t *testing.T) {
+	a := assert.New(t)
+	src := trie.NewStore()
+	src.Subscribe("id0",
+		packets.Topic{Name: "a/+", Qos: packets.QOS_1},
+		packets.Topic{Name: "$SYS/a", Qos: packets.QOS_0},
+	)
+	src.Subscribe("id1", packets.Topic{Name: "#", Qos: packets.QOS_2})
+
+	var buf bytes.Buffer
+	a.Nil(subscription.Export(src, &buf))
+	exported := buf.String()
+
+	dst := trie.NewStore()
+	dst.Subscribe("id2", packets.Topic{Name: "b", Qos: packets.QOS_0})
+	a.Nil(subscription.Import(dst, &buf))
+
+	a.ElementsMatch(src.GetClientSubscriptions("id0"), dst.GetClientSubscriptions("id0"))
+	a.Equal(src.GetClientSubscriptions("id1"), dst.GetClientSubscriptions("id1"))
+	// the existing subscriptions are kept.
+	a.Equal([]packets.Topic{{Name: "b", Qos: packets.QOS_0}}, dst.GetClientSubscriptions("id2"))
+
+	// the output is stable.
+	buf.Reset()
+	a.Nil(subscription.Export(src, &buf))
+	a.Equal(exported, buf.String())
+}
+
+func TestImport_Malformed(t *testing.T) {
+	var tt = []struct {
+		name  string
+		input string
+		err   error
+	}{
+		{
+			name:  "unsupported version",
+			input: `{"version":2,"clients":{"id0":[{"name":"a","qos":1}]}}`,
+			err:   subscription.ErrUnsupportedBackupVersion,
+		},
+		{
+			name:  "invalid json",
+			input: `{"version":1,`,
+		},
+		{
+			name:  "invalid topic filter",
+			input: `{"version":1,"clients":{"id0":[{"name":"a","qos":1},{"name":"a/#/b","qos":1}]}}`,
+		},
+		{
+			name:  "invalid qos",
+			input: `{"version":1,"clients":{"id0":[{"name":"a","qos":1},{"name":"b","qos":3}]}}`,
+		},
+	}
+	for _, v := range tt {
+		t.Run(v.name, func(t *testing.T) {
+			a := assert.New(t)
+			db := trie.NewStore()
+			err := subscription.Import(db, strings.NewReader(v.input))
+			a.NotNil(err)
+			if v.err != nil {
+				a.Equal(v.err, err)
+			}
+			// the store is not modified.
+			a.Equal(subscription.Stats{}, db.GetStats())
+		})
+	}
+}
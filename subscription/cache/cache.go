@@ -0,0 +1,328 @@
+// Package cache provides a read-through cache layer over a subscription.Store.
+// It is useful when the underlying store is slow, for example a remote store.
+package cache
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/DrmagicE/gmqtt/pkg/packets"
+	"github.com/DrmagicE/gmqtt/subscription"
+)
+
+var _ subscription.Store = (*CachingStore)(nil)
+var _ subscription.PagedIterator = (*CachingStore)(nil)
+
+// CacheStats is the hit/miss statistics of the cache.
+type CacheStats struct {
+	// Hits is the number of queries served by the cache.
+	Hits uint64
+	// Misses is the number of queries served by the underlying store.
+	Misses uint64
+}
+
+type clientEntry struct {
+	topics   []packets.Topic
+	expireAt time.Time
+}
+
+type matchedEntry struct {
+	matched  subscription.ClientTopics
+	expireAt time.Time
+}
+
+// load is the in-flight read of the underlying store for a key. It is marked as stale
+// if a mutation which affects the key is written during the read, so that the result is not cached.
+type load struct {
+	stale bool
+	// n is the number of the readers sharing the load.
+	n int
+}
+
+// CachingStore is a subscription.Store decorator which caches the results of
+// GetClientSubscriptions and GetTopicMatched for a given TTL.
+// The mutations through the CachingStore are written through to the underlying store
+// and invalidate the relevant entries. The expired entries are swept at most once per TTL
+// when the results are cached, so that the entries which are never queried again are freed.
+// Notice:
+// The mutations which bypass the CachingStore can not be noticed,
+// the cached entries will be stale until they expire.
+type CachingStore struct {
+	// hits and misses must be the first fields to guarantee 64-bit alignment for atomic operations.
+	hits   uint64
+	misses uint64
+
+	inner subscription.Store
+	ttl   time.Duration
+	now   func() time.Time
+
+	// mu guards the cached entries only, the underlying store is never called with mu held.
+	mu      sync.Mutex
+	clients map[string]*clientEntry // [clientID]
+	// matched is indexed by the first level of the topic name,
+	// so that the invalidation only scans the topic names which can match the filter.
+	matched      map[string]map[string]*matchedEntry // [first level][topicName]
+	clientLoads  map[string]*load                    // [clientID]
+	matchedLoads map[string]*load                    // [topicName]
+	// nextSweep is the time when the expired entries are swept next.
+	nextSweep time.Time
+}
+
+// NewStore returns a CachingStore which wraps the inner store and caches the results for ttl.
+func NewStore(inner subscription.Store, ttl time.Duration) *CachingStore {
+	return &CachingStore{
+		inner:        inner,
+		ttl:          ttl,
+		now:          time.Now,
+		clients:      make(map[string]*clientEntry),
+		matched:      make(map[string]map[string]*matchedEntry),
+		clientLoads:  make(map[string]*load),
+		matchedLoads: make(map[string]*load),
+	}
+}
+
+// CacheStats returns the hit/miss statistics of the cache.
+func (c *CachingStore) CacheStats() CacheStats {
+	return CacheStats{
+		Hits:   atomic.LoadUint64(&c.hits),
+		Misses: atomic.LoadUint64(&c.misses),
+	}
+}
+
+// firstLevel returns the first level of the topic name or topic filter.
+func firstLevel(topic string) string {
+	if i := strings.IndexByte(topic, '/'); i != -1 {
+		return topic[:i]
+	}
+	return topic
+}
+
+// acquire returns the load of the key, which is shared by the concurrent readers of the key
+// until it is marked as stale.
+func acquire(loads map[string]*load, key string) *load {
+	l, ok := loads[key]
+	if !ok || l.stale {
+		l = &load{}
+		loads[key] = l
+	}
+	l.n++
+	return l
+}
+
+// release removes the load once all the readers of the key are done.
+func release(loads map[string]*load, key string, l *load) {
+	l.n--
+	if l.n == 0 && loads[key] == l {
+		delete(loads, key)
+	}
+}
+
+// invalidate removes the cached entries and marks the in-flight loads which can be affected by
+// the changes of the topic filters of the client. It must be called with c.mu held,
+// after the changes are written to the underlying store.
+func (c *CachingStore) invalidate(clientID string, topicFilters ...string) {
+	delete(c.clients, clientID)
+	if l, ok := c.clientLoads[clientID]; ok {
+		l.stale = true
+	}
+	for _, filter := range topicFilters {
+		c.invalidateMatched(filter)
+	}
+}
+
+func (c *CachingStore) invalidateMatched(filter string) {
+	for topicName, l := range c.matchedLoads {
+		if packets.TopicMatch([]byte(topicName), []byte(filter)) {
+			l.stale = true
+		}
+	}
+	level := firstLevel(filter)
+	if !strings.ContainsAny(filter, "+#") {
+		c.deleteMatched(level, filter)
+		return
+	}
+	if level == "+" || level == "#" {
+		for level, entries := range c.matched {
+			for topicName := range entries {
+				if packets.TopicMatch([]byte(topicName), []byte(filter)) {
+					c.deleteMatched(level, topicName)
+				}
+			}
+		}
+		return
+	}
+	for topicName := range c.matched[level] {
+		if packets.TopicMatch([]byte(topicName), []byte(filter)) {
+			c.deleteMatched(level, topicName)
+		}
+	}
+}
+
+func (c *CachingStore) deleteMatched(level, topicName string) {
+	entries, ok := c.matched[level]
+	if !ok {
+		return
+	}
+	delete(entries, topicName)
+	if len(entries) == 0 {
+		delete(c.matched, level)
+	}
+}
+
+// sweep removes the expired entries if the last sweep is more than a TTL ago.
+// It must be called with c.mu held.
+func (c *CachingStore) sweep(now time.Time) {
+	if now.Before(c.nextSweep) {
+		return
+	}
+	c.nextSweep = now.Add(c.ttl)
+	for clientID, e := range c.clients {
+		if !now.Before(e.expireAt) {
+			delete(c.clients, clientID)
+		}
+	}
+	for level, entries := range c.matched {
+		for topicName, e := range entries {
+			if !now.Before(e.expireAt) {
+				c.deleteMatched(level, topicName)
+			}
+		}
+	}
+}
+
+func (c *CachingStore) Subscribe(clientID string, topics ...packets.Topic) subscription.SubscribeResult {
+	rs := c.inner.Subscribe(clientID, topics...)
+	var filters []string
+	for _, v := range rs {
+		if !v.Unchanged && v.Err == nil {
+			filters = append(filters, v.Topic.Name)
+		}
+	}
+	if len(filters) != 0 {
+		c.mu.Lock()
+		c.invalidate(clientID, filters...)
+		c.mu.Unlock()
+	}
+	return rs
+}
+
+func (c *CachingStore) Unsubscribe(clientID string, topics ...string) {
+	c.inner.Unsubscribe(clientID, topics...)
+	c.mu.Lock()
+	c.invalidate(clientID, topics...)
+	c.mu.Unlock()
+}
+
+func (c *CachingStore) UnsubscribeAll(clientID string) {
+	// the filters subscribed concurrently after GetClientSubscriptions are invalidated by their own Subscribe.
+	topics := c.inner.GetClientSubscriptions(clientID)
+	c.inner.UnsubscribeAll(clientID)
+	filters := make([]string, len(topics))
+	for k, v := range topics {
+		filters[k] = v.Name
+	}
+	c.mu.Lock()
+	c.invalidate(clientID, filters...)
+	c.mu.Unlock()
+}
+
+func (c *CachingStore) Iterate(fn subscription.IterateFn) {
+	c.inner.Iterate(fn)
+}
+
+// IterateFrom implements subscription.PagedIterator, the iteration is not cached.
+func (c *CachingStore) IterateFrom(fn subscription.IterateFn, options subscription.IterationOptions, token subscription.Cursor) (subscription.Cursor, bool) {
+	return subscription.IteratePage(c.inner, fn, options, token)
+}
+
+func (c *CachingStore) Get(topicFilter string) subscription.ClientTopics {
+	return c.inner.Get(topicFilter)
+}
+
+func (c *CachingStore) GetTopicMatched(topicName string) subscription.ClientTopics {
+	level := firstLevel(topicName)
+	c.mu.Lock()
+	if e, ok := c.matched[level][topicName]; ok && c.now().Before(e.expireAt) {
+		c.mu.Unlock()
+		atomic.AddUint64(&c.hits, 1)
+		return copyClientTopics(e.matched)
+	}
+	l := acquire(c.matchedLoads, topicName)
+	c.mu.Unlock()
+	atomic.AddUint64(&c.misses, 1)
+
+	rs := c.inner.GetTopicMatched(topicName)
+	c.mu.Lock()
+	if !l.stale {
+		now := c.now()
+		c.sweep(now)
+		entries, ok := c.matched[level]
+		if !ok {
+			entries = make(map[string]*matchedEntry)
+			c.matched[level] = entries
+		}
+		entries[topicName] = &matchedEntry{
+			matched:  copyClientTopics(rs),
+			expireAt: now.Add(c.ttl),
+		}
+	}
+	release(c.matchedLoads, topicName, l)
+	c.mu.Unlock()
+	return rs
+}
+
+func (c *CachingStore) GetClientSubscriptions(clientID string) []packets.Topic {
+	c.mu.Lock()
+	if e, ok := c.clients[clientID]; ok && c.now().Before(e.expireAt) {
+		c.mu.Unlock()
+		atomic.AddUint64(&c.hits, 1)
+		return copyTopics(e.topics)
+	}
+	l := acquire(c.clientLoads, clientID)
+	c.mu.Unlock()
+	atomic.AddUint64(&c.misses, 1)
+
+	rs := c.inner.GetClientSubscriptions(clientID)
+	c.mu.Lock()
+	if !l.stale {
+		now := c.now()
+		c.sweep(now)
+		c.clients[clientID] = &clientEntry{
+			topics:   copyTopics(rs),
+			expireAt: now.Add(c.ttl),
+		}
+	}
+	release(c.clientLoads, clientID, l)
+	c.mu.Unlock()
+	return rs
+}
+
+func (c *CachingStore) GetStats() subscription.Stats {
+	return c.inner.GetStats()
+}
+
+func (c *CachingStore) GetClientStats(clientID string) (subscription.Stats, error) {
+	return c.inner.GetClientStats(clientID)
+}
+
+func copyTopics(topics []packets.Topic) []packets.Topic {
+	if topics == nil {
+		return nil
+	}
+	rs := make([]packets.Topic, len(topics))
+	copy(rs, topics)
+	return rs
+}
+
+func copyClientTopics(ct subscription.ClientTopics) subscription.ClientTopics {
+	if ct == nil {
+		return nil
+	}
+	rs := make(subscription.ClientTopics, len(ct))
+	for clientID, topics := range ct {
+		rs[clientID] = copyTopics(topics)
+	}
+	return rs
+}
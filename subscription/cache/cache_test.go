@@ -0,0 +1,229 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/DrmagicE/gmqtt/pkg/packets"
+	"github.com/DrmagicE/gmqtt/subscription"
+	"github.com/DrmagicE/gmqtt/subscription/trie"
+)
+
+func TestCachingStore_GetTopicMatched(t *testing.T) {
+	a := assert.New(t)
+	c := NewStore(trie.NewStore(), time.Minute)
+	c.Subscribe("id0", packets.Topic{Name: "a/+", Qos: packets.QOS_1})
+	c.Subscribe("id1", packets.Topic{Name: "b/#", Qos: packets.QOS_1})
+
+	want := subscription.ClientTopics{
+		"id0": {{Name: "a/+", Qos: packets.QOS_1}},
+	}
+	a.Equal(want, c.GetTopicMatched("a/b"))
+	a.Equal(want, c.GetTopicMatched("a/b"))
+	a.Equal(CacheStats{Hits: 1, Misses: 1}, c.CacheStats())
+	a.Len(c.GetTopicMatched("b/c"), 1)
+	a.Equal(CacheStats{Hits: 1, Misses: 2}, c.CacheStats())
+
+	// the subscription which does not match "a/b" does not invalidate the entry.
+	c.Subscribe("id1", packets.Topic{Name: "c", Qos: packets.QOS_1})
+	a.Equal(want, c.GetTopicMatched("a/b"))
+	a.Equal(CacheStats{Hits: 2, Misses: 2}, c.CacheStats())
+
+	c.Subscribe("id1", packets.Topic{Name: "a/#", Qos: packets.QOS_2})
+	rs := c.GetTopicMatched("a/b")
+	a.Len(rs, 2)
+	a.Equal(CacheStats{Hits: 2, Misses: 3}, c.CacheStats())
+
+	c.Unsubscribe("id1", "a/#")
+	a.Equal(want, c.GetTopicMatched("a/b"))
+	a.Equal(CacheStats{Hits: 2, Misses: 4}, c.CacheStats())
+
+	// "b/c" is invalidated by UnsubscribeAll.
+	c.UnsubscribeAll("id1")
+	a.Len(c.GetTopicMatched("b/c"), 0)
+	a.Equal(CacheStats{Hits: 2, Misses: 5}, c.CacheStats())
+}
+
+func TestCachingStore_GetClientSubscriptions(t *testing.T) {
+	a := assert.New(t)
+	c := NewStore(trie.NewStore(), time.Minute)
+	c.Subscribe("id0", packets.Topic{Name: "a", Qos: packets.QOS_1})
+
+	a.Equal([]packets.Topic{{Name: "a", Qos: packets.QOS_1}}, c.GetClientSubscriptions("id0"))
+	rs := c.GetClientSubscriptions("id0")
+	a.Equal([]packets.Topic{{Name: "a", Qos: packets.QOS_1}}, rs)
+	a.Equal(CacheStats{Hits: 1, Misses: 1}, c.CacheStats())
+
+	// modifying the result must not affect the cache.
+	rs[0].Qos = packets.QOS_2
+	a.Equal([]packets.Topic{{Name: "a", Qos: packets.QOS_1}}, c.GetClientSubscriptions("id0"))
+
+	c.Subscribe("id0", packets.Topic{Name: "a", Qos: packets.QOS_2})
+	a.Equal([]packets.Topic{{Name: "a", Qos: packets.QOS_2}}, c.GetClientSubscriptions("id0"))
+	a.Equal(CacheStats{Hits: 2, Misses: 2}, c.CacheStats())
+}
+
+func TestCachingStore_TTL(t *testing.T) {
+	a := assert.New(t)
+	now := time.Now()
+	c := NewStore(trie.NewStore(), time.Second)
+	c.now = func() time.Time {
+		return now
+	}
+	c.Subscribe("id0", packets.Topic{Name: "a", Qos: packets.QOS_1})
+	c.GetTopicMatched("a")
+	c.GetTopicMatched("a")
+	a.Equal(CacheStats{Hits: 1, Misses: 1}, c.CacheStats())
+
+	now = now.Add(time.Second)
+	c.GetTopicMatched("a")
+	a.Equal(CacheStats{Hits: 1, Misses: 2}, c.CacheStats())
+}
+
+func TestCachingStore_Sweep(t *testing.T) {
+	a := assert.New(t)
+	now := time.Now()
+	c := NewStore(trie.NewStore(), time.Second)
+	c.now = func() time.Time {
+		return now
+	}
+	c.Subscribe("id0", packets.Topic{Name: "#", Qos: packets.QOS_1})
+	c.GetTopicMatched("a/b")
+	c.GetTopicMatched("b")
+	c.GetClientSubscriptions("id0")
+	c.GetClientSubscriptions("id1")
+	a.Len(c.matched, 2)
+	a.Len(c.clients, 2)
+
+	// the entries are not swept before the next sweep.
+	now = now.Add(500 * time.Millisecond)
+	c.GetTopicMatched("c")
+	a.Len(c.matched, 3)
+	a.Len(c.clients, 2)
+
+	// the expired entries are swept even if they are never queried again.
+	now = now.Add(700 * time.Millisecond)
+	c.GetClientSubscriptions("id2")
+	a.Equal(map[string]map[string]*matchedEntry{
+		"c": {"c": c.matched["c"]["c"]},
+	}, c.matched)
+	a.Len(c.clients, 1)
+	a.Contains(c.clients, "id2")
+}
+
+func TestCachingStore_SubscribeUnchanged(t *testing.T) {
+	a := assert.New(t)
+	c := NewStore(trie.NewStore(), time.Minute)
+	c.Subscribe("id0", packets.Topic{Name: "a", Qos: packets.QOS_1})
+	c.GetTopicMatched("a")
+	// resubscribing with the same options does not invalidate the cache.
+	c.Subscribe("id0", packets.Topic{Name: "a", Qos: packets.QOS_1})
+	c.GetTopicMatched("a")
+	a.Equal(CacheStats{Hits: 1, Misses: 1}, c.CacheStats())
+}
+
+// blockingStore blocks the calls of the underlying store until the channels are closed.
+type blockingStore struct {
+	subscription.Store
+	subscribe chan struct{}
+	matched   chan struct{}
+}
+
+func (b *blockingStore) Subscribe(clientID string, topics ...packets.Topic) subscription.SubscribeResult {
+	if b.subscribe != nil {
+		<-b.subscribe
+	}
+	return b.Store.Subscribe(clientID, topics...)
+}
+
+func (b *blockingStore) GetTopicMatched(topicName string) subscription.ClientTopics {
+	if b.matched != nil {
+		<-b.matched
+	}
+	return b.Store.GetTopicMatched(topicName)
+}
+
+func TestCachingStore_SlowInner(t *testing.T) {
+	a := assert.New(t)
+	inner := &blockingStore{Store: trie.NewStore()}
+	c := NewStore(inner, time.Minute)
+	c.Subscribe("id0", packets.Topic{Name: "a", Qos: packets.QOS_1})
+	c.GetTopicMatched("a")
+
+	// the slow mutation does not block the cached reads.
+	inner.subscribe = make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		c.Subscribe("id1", packets.Topic{Name: "a", Qos: packets.QOS_1})
+		close(done)
+	}()
+	a.Len(c.GetTopicMatched("a"), 1)
+	a.Equal(CacheStats{Hits: 1, Misses: 1}, c.CacheStats())
+	close(inner.subscribe)
+	<-done
+	a.Len(c.GetTopicMatched("a"), 2)
+	a.Equal(CacheStats{Hits: 1, Misses: 2}, c.CacheStats())
+}
+
+func TestCachingStore_MutationDuringLoad(t *testing.T) {
+	a := assert.New(t)
+	inner := &blockingStore{Store: trie.NewStore(), matched: make(chan struct{})}
+	c := NewStore(inner, time.Minute)
+	c.Subscribe("id0", packets.Topic{Name: "a/b", Qos: packets.QOS_1})
+
+	rs := make(chan subscription.ClientTopics)
+	go func() {
+		rs <- c.GetTopicMatched("a/b")
+	}()
+	a.Eventually(func() bool {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return len(c.matchedLoads) == 1
+	}, time.Second, time.Millisecond)
+	// the result of the load which overlaps the mutation is not cached.
+	c.Subscribe("id1", packets.Topic{Name: "a/#", Qos: packets.QOS_1})
+	close(inner.matched)
+	<-rs
+	a.Len(c.GetTopicMatched("a/b"), 2)
+	a.Equal(CacheStats{Hits: 0, Misses: 2}, c.CacheStats())
+	a.Len(c.GetTopicMatched("a/b"), 2)
+	a.Equal(CacheStats{Hits: 1, Misses: 2}, c.CacheStats())
+	c.mu.Lock()
+	a.Empty(c.matchedLoads)
+	c.mu.Unlock()
+}
+
+func TestCachingStore_InvalidateIndex(t *testing.T) {
+	a := assert.New(t)
+	c := NewStore(trie.NewStore(), time.Minute)
+	for _, topic := range []string{"a", "a/b", "b/c", "$SYS/a"} {
+		c.GetTopicMatched(topic)
+	}
+	invalidated := func(filter string, want ...string) {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		before := make(map[string]bool)
+		for _, entries := range c.matched {
+			for topic := range entries {
+				before[topic] = true
+			}
+		}
+		c.invalidate("id", filter)
+		var got []string
+		for topic := range before {
+			if _, ok := c.matched[firstLevel(topic)][topic]; !ok {
+				got = append(got, topic)
+			}
+		}
+		a.ElementsMatch(want, got, filter)
+	}
+	invalidated("c")
+	invalidated("a/b", "a/b")
+	invalidated("a/#", "a")
+	invalidated("+/c", "b/c")
+	invalidated("#")
+	invalidated("$SYS/+", "$SYS/a")
+	a.Empty(c.matched)
+}
@@ -0,0 +1,119 @@
+// Package instrumented provides a subscription.Store decorator which exports the prometheus metrics of the store operations.
+// It is a separate package to avoid forcing the prometheus dependency on the users of the subscription package.
+package instrumented
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/DrmagicE/gmqtt/pkg/packets"
+	"github.com/DrmagicE/gmqtt/subscription"
+)
+
+const metricPrefix = "gmqtt_subscription_store_"
+
+// operation label values
+const (
+	opSubscribe              = "subscribe"
+	opUnsubscribe            = "unsubscribe"
+	opUnsubscribeAll         = "unsubscribe_all"
+	opIterate                = "iterate"
+	opIterateFrom            = "iterate_from"
+	opGet                    = "get"
+	opGetTopicMatched        = "get_topic_matched"
+	opGetClientSubscriptions = "get_client_subscriptions"
+)
+
+type store struct {
+	inner    subscription.Store
+	duration *prometheus.HistogramVec
+	visited  prometheus.Histogram
+}
+
+// NewInstrumentedStore returns a subscription.Store which wraps the inner store and
+// registers the latency and call count metrics of each operation into reg.
+// Iterate also exports the number of subscriptions visited per call.
+// It panics if the metrics can not be registered.
+func NewInstrumentedStore(inner subscription.Store, reg prometheus.Registerer) subscription.Store {
+	s := &store{
+		inner: inner,
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name: metricPrefix + "operation_duration_seconds",
+			Help: "The latency of the subscription store operations.",
+		}, []string{"operation"}),
+		visited: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    metricPrefix + "iterate_visited_subscriptions",
+			Help:    "The number of subscriptions visited per Iterate call.",
+			Buckets: prometheus.ExponentialBuckets(1, 4, 10),
+		}),
+	}
+	reg.MustRegister(s.duration, s.visited)
+	return s
+}
+
+func (s *store) observe(op string, start time.Time) {
+	s.duration.WithLabelValues(op).Observe(time.Since(start).Seconds())
+}
+
+func (s *store) Subscribe(clientID string, topics ...packets.Topic) subscription.SubscribeResult {
+	defer s.observe(opSubscribe, time.Now())
+	return s.inner.Subscribe(clientID, topics...)
+}
+
+func (s *store) Unsubscribe(clientID string, topics ...string) {
+	defer s.observe(opUnsubscribe, time.Now())
+	s.inner.Unsubscribe(clientID, topics...)
+}
+
+func (s *store) UnsubscribeAll(clientID string) {
+	defer s.observe(opUnsubscribeAll, time.Now())
+	s.inner.UnsubscribeAll(clientID)
+}
+
+func (s *store) Iterate(fn subscription.IterateFn) {
+	var n int
+	start := time.Now()
+	s.inner.Iterate(func(clientID string, topic packets.Topic) bool {
+		n++
+		return fn(clientID, topic)
+	})
+	s.observe(opIterate, start)
+	s.visited.Observe(float64(n))
+}
+
+// IterateFrom implements subscription.PagedIterator, the visited subscriptions are observed per page.
+func (s *store) IterateFrom(fn subscription.IterateFn, options subscription.IterationOptions, token subscription.Cursor) (subscription.Cursor, bool) {
+	var n int
+	start := time.Now()
+	next, done := subscription.IteratePage(s.inner, func(clientID string, topic packets.Topic) bool {
+		n++
+		return fn(clientID, topic)
+	}, options, token)
+	s.observe(opIterateFrom, start)
+	s.visited.Observe(float64(n))
+	return next, done
+}
+
+func (s *store) Get(topicFilter string) subscription.ClientTopics {
+	defer s.observe(opGet, time.Now())
+	return s.inner.Get(topicFilter)
+}
+
+func (s *store) GetTopicMatched(topicName string) subscription.ClientTopics {
+	defer s.observe(opGetTopicMatched, time.Now())
+	return s.inner.GetTopicMatched(topicName)
+}
+
+func (s *store) GetClientSubscriptions(clientID string) []packets.Topic {
+	defer s.observe(opGetClientSubscriptions, time.Now())
+	return s.inner.GetClientSubscriptions(clientID)
+}
+
+func (s *store) GetStats() subscription.Stats {
+	return s.inner.GetStats()
+}
+
+func (s *store) GetClientStats(clientID string) (subscription.Stats, error) {
+	return s.inner.GetClientStats(clientID)
+}
@@ -0,0 +1,58 @@
+package instrumented
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/DrmagicE/gmqtt/pkg/packets"
+	"github.com/DrmagicE/gmqtt/subscription"
+	"github.com/DrmagicE/gmqtt/subscription/trie"
+)
+
+func gather(a *assert.Assertions, reg *prometheus.Registry) map[string]*dto.MetricFamily {
+	mfs, err := reg.Gather()
+	a.Nil(err)
+	rs := make(map[string]*dto.MetricFamily)
+	for _, v := range mfs {
+		rs[v.GetName()] = v
+	}
+	return rs
+}
+
+func TestNewInstrumentedStore(t *testing.T) {
+	a := assert.New(t)
+	reg := prometheus.NewPedanticRegistry()
+	inner := trie.NewStore()
+	s := NewInstrumentedStore(inner, reg)
+
+	s.Subscribe("id0", packets.Topic{Name: "a", Qos: packets.QOS_1}, packets.Topic{Name: "b", Qos: packets.QOS_1})
+	s.Subscribe("id1", packets.Topic{Name: "a", Qos: packets.QOS_1})
+	s.Unsubscribe("id1", "a")
+	s.Iterate(func(clientID string, topic packets.Topic) bool {
+		return true
+	})
+	s.UnsubscribeAll("id0")
+	a.Equal(inner.GetStats(), s.GetStats())
+	a.Equal(subscription.Stats{SubscriptionsTotal: 3}, s.GetStats())
+	_, err := s.GetClientStats("id2")
+	a.NotNil(err)
+
+	mfs := gather(a, reg)
+	calls := make(map[string]uint64)
+	for _, m := range mfs[metricPrefix+"operation_duration_seconds"].GetMetric() {
+		calls[m.GetLabel()[0].GetValue()] = m.GetHistogram().GetSampleCount()
+	}
+	a.Equal(map[string]uint64{
+		opSubscribe:      2,
+		opUnsubscribe:    1,
+		opIterate:        1,
+		opUnsubscribeAll: 1,
+	}, calls)
+
+	visited := mfs[metricPrefix+"iterate_visited_subscriptions"].GetMetric()[0].GetHistogram()
+	a.EqualValues(1, visited.GetSampleCount())
+	a.EqualValues(2, visited.GetSampleSum())
+}
@@ -1,6 +1,9 @@
 package subscription
 
 import (
+	"sort"
+	"strings"
+
 	"github.com/DrmagicE/gmqtt/pkg/packets"
 )
 
@@ -14,6 +17,11 @@ type SubscribeResult = []struct {
 	Topic packets.Topic
 	// AlreadyExisted shows whether the topic is already existed.
 	AlreadyExisted bool
+	// Unchanged shows whether the topic is already existed with the same options,
+	// in which case the store is not modified.
+	Unchanged bool
+	// Err is not nil if the topic is rejected by the store, in which case the store is not modified.
+	Err error
 }
 
 // Stats is the statistics information of the store
@@ -25,9 +33,93 @@ type Stats struct {
 	SubscriptionsCurrent uint64
 }
 
+// Type is the type of the topic filters.
+type Type byte
+
+const (
+	// TypeSYS represents the system topic filters, which begin with "$".
+	TypeSYS Type = 1 << iota
+	// TypeNonSYS represents the non-system topic filters.
+	TypeNonSYS
+	// TypeAll represents all topic filters.
+	TypeAll = TypeSYS | TypeNonSYS
+)
+
+// Match returns whether the topic filter is of the type t.
+func (t Type) Match(topicFilter string) bool {
+	if len(topicFilter) != 0 && topicFilter[0] == '$' {
+		return t&TypeSYS != 0
+	}
+	return t&TypeNonSYS != 0
+}
+
+// IterationOptions is the options of the iteration.
+type IterationOptions struct {
+	// Type specifies the type of the topic filters to iterate, 0 means TypeAll.
+	Type Type
+	// ClientID specifies the client whose subscriptions to iterate, empty means all clients.
+	ClientID string
+	// Limit is the maximum number of subscriptions to visit in one call, 0 means no limit.
+	Limit int
+}
+
+// Cursor is an opaque position of the iteration which is used to resume the iteration.
+// The empty Cursor represents the beginning of the iteration.
+type Cursor string
+
 // ClientTopics groups the topics by client id.
 type ClientTopics map[string][]packets.Topic
 
+// MatchedSubscription is a subscription that matches a topic name, with the details of the matching.
+type MatchedSubscription struct {
+	// Topic is the matched subscription.
+	Topic packets.Topic
+	// TopicName is the topic name that the subscription matched.
+	TopicName string
+	// Exact shows whether the topic filter is equal to the topic name.
+	Exact bool
+	// Specificity is the number of the literal levels in the topic filter, see Specificity().
+	Specificity int
+}
+
+// MatchedClientTopics groups the MatchedSubscription by client id.
+// The subscriptions of each client are sorted by specificity in descending order,
+// so the most specific subscription comes first.
+type MatchedClientTopics map[string][]MatchedSubscription
+
+// Specificity returns the number of the literal (non-wildcard) levels in the topic filter.
+// The more literal levels, the more specific the topic filter is.
+func Specificity(topicFilter string) int {
+	var n int
+	for _, lv := range strings.Split(topicFilter, "/") {
+		if lv != "+" && lv != "#" {
+			n++
+		}
+	}
+	return n
+}
+
+// NewMatchedClientTopics creates the MatchedClientTopics from the ClientTopics which match the topicName.
+func NewMatchedClientTopics(topicName string, matched ClientTopics) MatchedClientTopics {
+	rs := make(MatchedClientTopics, len(matched))
+	for clientID, topics := range matched {
+		subs := make([]MatchedSubscription, 0, len(topics))
+		for _, t := range topics {
+			subs = append(subs, MatchedSubscription{
+				Topic:       t,
+				TopicName:   topicName,
+				Exact:       t.Name == topicName,
+				Specificity: Specificity(t.Name),
+			})
+		}
+		sort.SliceStable(subs, func(i, j int) bool {
+			return subs[i].Specificity > subs[j].Specificity
+		})
+		rs[clientID] = subs
+	}
+	return rs
+}
+
 // Store is the interface used by gmqtt.server and external logic to handler the operations of subscriptions.
 // User can get the implementation from gmqtt.Server interface.
 // This interface provides the ability for extensions to interact with the subscriptions.
@@ -59,6 +151,38 @@ type Store interface {
 	StatsReader
 }
 
+// StoreReader is the read-only view of the Store.
+type StoreReader interface {
+	// Iterate iterate all subscriptions, see Store.Iterate.
+	Iterate(fn IterateFn)
+	StatsReader
+}
+
+// readOnlyStore wraps the Store to hide the methods which modify the store.
+type readOnlyStore struct {
+	store Store
+}
+
+func (r readOnlyStore) Iterate(fn IterateFn) {
+	r.store.Iterate(fn)
+}
+
+func (r readOnlyStore) GetStats() Stats {
+	return r.store.GetStats()
+}
+
+func (r readOnlyStore) GetClientStats(clientID string) (Stats, error) {
+	return r.store.GetClientStats(clientID)
+}
+
+// ReadOnly returns the read-only view of the store, which can be handed to untrusted plugins.
+// The returned StoreReader can not be converted back to the Store.
+// Notice:
+// The view is not a snapshot, it reflects the live data of the underlying store.
+func ReadOnly(store Store) StoreReader {
+	return readOnlyStore{store: store}
+}
+
 // StatsReader provides the ability to get statistics information.
 type StatsReader interface {
 	// GetStats return the global stats.
@@ -0,0 +1,164 @@
+// Package notify provides a subscription.Store decorator which emits an event for every subscription change.
+// It allows external code, such as a cluster routing table, to mirror the subscriptions without polling Iterate.
+package notify
+
+import (
+	"sync"
+
+	"github.com/DrmagicE/gmqtt/pkg/packets"
+	"github.com/DrmagicE/gmqtt/subscription"
+)
+
+var _ subscription.Store = (*NotifyingStore)(nil)
+var _ subscription.PagedIterator = (*NotifyingStore)(nil)
+
+// Event is the subscription change event, it is either *SubscribeEvent or *UnsubscribeEvent.
+type Event interface {
+	event()
+}
+
+// SubscribeEvent is emitted when a subscription is added or its qos is changed.
+type SubscribeEvent struct {
+	ClientID string
+	Topic    packets.Topic
+	// AlreadyExisted shows whether the subscription existed with another qos.
+	AlreadyExisted bool
+}
+
+// UnsubscribeEvent is emitted when a subscription is removed.
+type UnsubscribeEvent struct {
+	ClientID    string
+	TopicFilter string
+}
+
+func (*SubscribeEvent) event()   {}
+func (*UnsubscribeEvent) event() {}
+
+// Listener is the callback which receives the events.
+// Listeners are called synchronously in the order of the changes, after the change has been applied to the
+// underlying store. The mutations of the NotifyingStore are blocked until the listeners return,
+// so listeners must be fast and must not modify the NotifyingStore, otherwise it deadlocks.
+type Listener func(event Event)
+
+// ChanListener returns a Listener which sends the events to ch.
+// Notice:
+// The send blocks when ch is full, which blocks the mutations of the store.
+// Use a buffered channel and consume it promptly.
+func ChanListener(ch chan<- Event) Listener {
+	return func(event Event) {
+		ch <- event
+	}
+}
+
+// NotifyingStore is a subscription.Store decorator which emits the events of the subscription changes
+// made through it to the registered listeners.
+// Subscriptions which are resubscribed with the same qos, rejected by the store,
+// or unsubscribed without existing do not emit events.
+// Notice:
+// The changes which bypass the NotifyingStore can not be noticed.
+type NotifyingStore struct {
+	inner subscription.Store
+
+	// mu serializes the mutations so that the events are emitted in the order of the changes.
+	mu        sync.Mutex
+	listeners []Listener
+}
+
+// NewStore returns a NotifyingStore which wraps the inner store.
+func NewStore(inner subscription.Store) *NotifyingStore {
+	return &NotifyingStore{
+		inner: inner,
+	}
+}
+
+// AddListener registers the listener, it receives the events of the changes made after the registration.
+func (n *NotifyingStore) AddListener(l Listener) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.listeners = append(n.listeners, l)
+}
+
+func (n *NotifyingStore) emit(event Event) {
+	for _, l := range n.listeners {
+		l(event)
+	}
+}
+
+func (n *NotifyingStore) Subscribe(clientID string, topics ...packets.Topic) subscription.SubscribeResult {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	rs := n.inner.Subscribe(clientID, topics...)
+	for _, v := range rs {
+		if v.Unchanged || v.Err != nil {
+			continue
+		}
+		n.emit(&SubscribeEvent{
+			ClientID:       clientID,
+			Topic:          v.Topic,
+			AlreadyExisted: v.AlreadyExisted,
+		})
+	}
+	return rs
+}
+
+func (n *NotifyingStore) Unsubscribe(clientID string, topics ...string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	existed := make(map[string]struct{})
+	for _, v := range n.inner.GetClientSubscriptions(clientID) {
+		existed[v.Name] = struct{}{}
+	}
+	n.inner.Unsubscribe(clientID, topics...)
+	for _, topic := range topics {
+		if _, ok := existed[topic]; !ok {
+			continue
+		}
+		delete(existed, topic)
+		n.emit(&UnsubscribeEvent{
+			ClientID:    clientID,
+			TopicFilter: topic,
+		})
+	}
+}
+
+func (n *NotifyingStore) UnsubscribeAll(clientID string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	topics := n.inner.GetClientSubscriptions(clientID)
+	n.inner.UnsubscribeAll(clientID)
+	for _, v := range topics {
+		n.emit(&UnsubscribeEvent{
+			ClientID:    clientID,
+			TopicFilter: v.Name,
+		})
+	}
+}
+
+func (n *NotifyingStore) Iterate(fn subscription.IterateFn) {
+	n.inner.Iterate(fn)
+}
+
+// IterateFrom implements subscription.PagedIterator.
+func (n *NotifyingStore) IterateFrom(fn subscription.IterateFn, options subscription.IterationOptions, token subscription.Cursor) (subscription.Cursor, bool) {
+	return subscription.IteratePage(n.inner, fn, options, token)
+}
+
+func (n *NotifyingStore) Get(topicFilter string) subscription.ClientTopics {
+	return n.inner.Get(topicFilter)
+}
+
+func (n *NotifyingStore) GetTopicMatched(topicName string) subscription.ClientTopics {
+	return n.inner.GetTopicMatched(topicName)
+}
+
+func (n *NotifyingStore) GetClientSubscriptions(clientID string) []packets.Topic {
+	return n.inner.GetClientSubscriptions(clientID)
+}
+
+func (n *NotifyingStore) GetStats() subscription.Stats {
+	return n.inner.GetStats()
+}
+
+func (n *NotifyingStore) GetClientStats(clientID string) (subscription.Stats, error) {
+	return n.inner.GetClientStats(clientID)
+}
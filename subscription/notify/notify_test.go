@@ -0,0 +1,48 @@
+package notify
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/DrmagicE/gmqtt/pkg/packets"
+	"github.com/DrmagicE/gmqtt/subscription/trie"
+)
+
+func TestNotifyingStore(t *testing.T) {
+	a := assert.New(t)
+	n := NewStore(trie.NewStore(trie.WithMaxTopicLevels(2)))
+	var events []Event
+	n.AddListener(func(event Event) {
+		events = append(events, event)
+	})
+
+	n.Subscribe("id0",
+		packets.Topic{Name: "a", Qos: packets.QOS_1},
+		packets.Topic{Name: "b", Qos: packets.QOS_1},
+		// rejected by the store.
+		packets.Topic{Name: "a/b/c", Qos: packets.QOS_1},
+	)
+	// unchanged
+	n.Subscribe("id0", packets.Topic{Name: "a", Qos: packets.QOS_1})
+	n.Subscribe("id0", packets.Topic{Name: "a", Qos: packets.QOS_2})
+	n.Unsubscribe("id0", "a", "not-exists")
+	n.UnsubscribeAll("id0")
+
+	a.Equal([]Event{
+		&SubscribeEvent{ClientID: "id0", Topic: packets.Topic{Name: "a", Qos: packets.QOS_1}},
+		&SubscribeEvent{ClientID: "id0", Topic: packets.Topic{Name: "b", Qos: packets.QOS_1}},
+		&SubscribeEvent{ClientID: "id0", Topic: packets.Topic{Name: "a", Qos: packets.QOS_2}, AlreadyExisted: true},
+		&UnsubscribeEvent{ClientID: "id0", TopicFilter: "a"},
+		&UnsubscribeEvent{ClientID: "id0", TopicFilter: "b"},
+	}, events)
+}
+
+func TestChanListener(t *testing.T) {
+	a := assert.New(t)
+	n := NewStore(trie.NewStore())
+	ch := make(chan Event, 1)
+	n.AddListener(ChanListener(ch))
+	n.Subscribe("id0", packets.Topic{Name: "a", Qos: packets.QOS_1})
+	a.Equal(&SubscribeEvent{ClientID: "id0", Topic: packets.Topic{Name: "a", Qos: packets.QOS_1}}, <-ch)
+}
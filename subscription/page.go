@@ -0,0 +1,83 @@
+package subscription
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"sort"
+
+	"github.com/DrmagicE/gmqtt/pkg/packets"
+)
+
+// PagedIterator is implemented by the stores which support resumable iteration.
+// Unlike Iterate, the store lock is only held during each call,
+// so the caller can page through a large store without blocking the writers for the whole walk.
+type PagedIterator interface {
+	// IterateFrom iterates the subscriptions from the position of the token and returns the position of the next call.
+	// The iteration stops when fn returns false or options.Limit subscriptions have been visited.
+	// done is true if all subscriptions have been visited.
+	// Pass an empty token to start from the beginning.
+	IterateFrom(fn IterateFn, options IterationOptions, token Cursor) (next Cursor, done bool)
+}
+
+// IteratePage iterates one page of the subscriptions of the store, see PagedIterator.
+// If the store does not implement PagedIterator, the subscriptions are collected by Iterate and sorted by the client id
+// and then the topic filter, and the cursor is the last visited subscription, so the pages do not depend on the
+// iteration order of the store. This walks through the whole store on each call.
+func IteratePage(store Store, fn IterateFn, options IterationOptions, token Cursor) (next Cursor, done bool) {
+	if p, ok := store.(PagedIterator); ok {
+		return p.IterateFrom(fn, options, token)
+	}
+	var pos *pageCursor
+	if token != "" {
+		b, err := base64.RawURLEncoding.DecodeString(string(token))
+		if err != nil {
+			return "", true
+		}
+		pos = &pageCursor{}
+		if err := json.Unmarshal(b, pos); err != nil {
+			return "", true
+		}
+	}
+	t := options.Type
+	if t == 0 {
+		t = TypeAll
+	}
+	var subs []pageCursor
+	qos := make(map[pageCursor]uint8)
+	store.Iterate(func(clientID string, topic packets.Topic) bool {
+		if !t.Match(topic.Name) || (options.ClientID != "" && options.ClientID != clientID) {
+			return true
+		}
+		c := pageCursor{ClientID: clientID, TopicName: topic.Name}
+		if pos != nil && !pos.less(c) {
+			return true
+		}
+		subs = append(subs, c)
+		qos[c] = topic.Qos
+		return true
+	})
+	sort.Slice(subs, func(i, j int) bool { return subs[i].less(subs[j]) })
+	for i, c := range subs {
+		if !fn(c.ClientID, packets.Topic{Name: c.TopicName, Qos: qos[c]}) || (options.Limit > 0 && i+1 >= options.Limit) {
+			if i+1 == len(subs) {
+				return "", true
+			}
+			b, _ := json.Marshal(c)
+			return Cursor(base64.RawURLEncoding.EncodeToString(b)), false
+		}
+	}
+	return "", true
+}
+
+// pageCursor is the last visited subscription of IteratePage.
+type pageCursor struct {
+	ClientID  string `json:"c"`
+	TopicName string `json:"t"`
+}
+
+func (c pageCursor) less(o pageCursor) bool {
+	if c.ClientID != o.ClientID {
+		return c.ClientID < o.ClientID
+	}
+	return c.TopicName < o.TopicName
+}
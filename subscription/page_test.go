@@ -0,0 +1,118 @@
+package subscription_test
+
+import (
+	"math/rand"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/DrmagicE/gmqtt/pkg/packets"
+	"github.com/DrmagicE/gmqtt/subscription"
+	"github.com/DrmagicE/gmqtt/subscription/trie"
+)
+
+type clientTopic struct {
+	clientID string
+	topic    packets.Topic
+}
+
+// sliceStore iterates the subscriptions in a stable order and does not implement subscription.PagedIterator.
+type sliceStore struct {
+	subscription.Store
+	subs []clientTopic
+}
+
+func (s *sliceStore) Iterate(fn subscription.IterateFn) {
+	for _, v := range s.subs {
+		if !fn(v.clientID, v.topic) {
+			return
+		}
+	}
+}
+
+func collectPages(store subscription.Store, options subscription.IterationOptions) (pages [][]clientTopic) {
+	var token subscription.Cursor
+	for {
+		var page []clientTopic
+		next, done := subscription.IteratePage(store, func(clientID string, topic packets.Topic) bool {
+			page = append(page, clientTopic{clientID: clientID, topic: topic})
+			return true
+		}, options, token)
+		if len(page) != 0 {
+			pages = append(pages, page)
+		}
+		if done {
+			return pages
+		}
+		token = next
+	}
+}
+
+// shuffleStore iterates the subscriptions in a different order on each call.
+type shuffleStore struct {
+	sliceStore
+	rand *rand.Rand
+}
+
+func (s *shuffleStore) Iterate(fn subscription.IterateFn) {
+	for _, i := range s.rand.Perm(len(s.subs)) {
+		if !fn(s.subs[i].clientID, s.subs[i].topic) {
+			return
+		}
+	}
+}
+
+func TestIteratePage_UnstableOrder(t *testing.T) {
+	a := assert.New(t)
+	store := &shuffleStore{rand: rand.New(rand.NewSource(1))}
+	for i := 0; i < 20; i++ {
+		store.subs = append(store.subs, clientTopic{
+			clientID: "id" + strconv.Itoa(i%7),
+			topic:    packets.Topic{Name: "t" + strconv.Itoa(i), Qos: packets.QOS_1},
+		})
+	}
+	pages := collectPages(store, subscription.IterationOptions{Limit: 3})
+	a.Len(pages, 7)
+	var all []clientTopic
+	for _, p := range pages {
+		all = append(all, p...)
+	}
+	a.Len(all, 20)
+	a.ElementsMatch(store.subs, all)
+}
+
+func TestIteratePage(t *testing.T) {
+	a := assert.New(t)
+	subs := []clientTopic{
+		{clientID: "id0", topic: packets.Topic{Name: "a", Qos: packets.QOS_0}},
+		{clientID: "id0", topic: packets.Topic{Name: "$SYS/a", Qos: packets.QOS_0}},
+		{clientID: "id0", topic: packets.Topic{Name: "b", Qos: packets.QOS_1}},
+		{clientID: "id1", topic: packets.Topic{Name: "a", Qos: packets.QOS_2}},
+		{clientID: "id1", topic: packets.Topic{Name: "c", Qos: packets.QOS_2}},
+	}
+	fallback := &sliceStore{subs: subs}
+	db := trie.NewStore()
+	for _, v := range subs {
+		db.Subscribe(v.clientID, v.topic)
+	}
+
+	for _, store := range []subscription.Store{fallback, db} {
+		pages := collectPages(store, subscription.IterationOptions{Type: subscription.TypeNonSYS, Limit: 2})
+		a.Len(pages, 2)
+		var all []clientTopic
+		for _, p := range pages {
+			a.True(len(p) <= 2)
+			all = append(all, p...)
+		}
+		a.ElementsMatch([]clientTopic{subs[0], subs[2], subs[3], subs[4]}, all)
+
+		pages = collectPages(store, subscription.IterationOptions{ClientID: "id1", Limit: 1})
+		a.Equal([][]clientTopic{{subs[3]}, {subs[4]}}, pages)
+	}
+	next, done := subscription.IteratePage(fallback, func(clientID string, topic packets.Topic) bool {
+		return true
+	}, subscription.IterationOptions{}, "invalid")
+	a.Equal(subscription.Cursor(""), next)
+	a.True(done)
+}
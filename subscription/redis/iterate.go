@@ -0,0 +1,159 @@
+package redis
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"sort"
+
+	redigo "github.com/gomodule/redigo/redis"
+	"go.uber.org/zap"
+
+	"github.com/DrmagicE/gmqtt/pkg/packets"
+	"github.com/DrmagicE/gmqtt/subscription"
+)
+
+var _ subscription.PagedIterator = (*Store)(nil)
+
+// indexBatch is the number of the client ids read from the client index at a time.
+const indexBatch = 100
+
+// cursor is the decoded subscription.Cursor, which is the last visited subscription.
+type cursor struct {
+	ClientID  string `json:"c"`
+	TopicName string `json:"t"`
+}
+
+func encodeCursor(c cursor) subscription.Cursor {
+	b, _ := json.Marshal(c)
+	return subscription.Cursor(base64.RawURLEncoding.EncodeToString(b))
+}
+
+func decodeCursor(token subscription.Cursor) (c *cursor, ok bool) {
+	if token == "" {
+		return nil, true
+	}
+	b, err := base64.RawURLEncoding.DecodeString(string(token))
+	if err != nil {
+		return nil, false
+	}
+	c = &cursor{}
+	if err := json.Unmarshal(b, c); err != nil {
+		return nil, false
+	}
+	return c, true
+}
+
+// syncIndex rebuilds the client index if its size differs from the clients set.
+func (s *Store) syncIndex(conn redigo.Conn) error {
+	if err := conn.Send("SCARD", s.key(keyClients)); err != nil {
+		return err
+	}
+	if err := conn.Send("ZCARD", s.key(keyClientIndex)); err != nil {
+		return err
+	}
+	if err := conn.Flush(); err != nil {
+		return err
+	}
+	clients, err := redigo.Int(conn.Receive())
+	if err != nil {
+		return err
+	}
+	indexed, err := redigo.Int(conn.Receive())
+	if err != nil {
+		return err
+	}
+	if clients == indexed {
+		return nil
+	}
+	_, err = indexScript.Do(conn, s.key(keyClients), s.key(keyClientIndex))
+	return err
+}
+
+// IterateFrom implements subscription.PagedIterator.
+// The subscriptions are visited in the order of the client id and then the topic filter, the client ids are read
+// from the client index in batches, so each call only reads the clients from the position of the cursor.
+// The iteration stops when fn returns false or options.Limit subscriptions have been visited,
+// in which case the returned next cursor can be passed to the next call to resume the iteration.
+// Pass an empty token to start from the beginning, an invalid token is treated as the end of the iteration.
+//
+// The iteration is weakly consistent if the store is modified between calls:
+// the subscriptions which exist during the whole iteration are visited exactly once.
+func (s *Store) IterateFrom(fn subscription.IterateFn, options subscription.IterationOptions, token subscription.Cursor) (next subscription.Cursor, done bool) {
+	pos, ok := decodeCursor(token)
+	if !ok {
+		return "", true
+	}
+	conn := s.pool.Get()
+	defer conn.Close()
+	t := options.Type
+	if t == 0 {
+		t = subscription.TypeAll
+	}
+	var n int
+	// visit visits the subscriptions of the client, it returns false if the page is full.
+	visit := func(clientID string) (bool, error) {
+		topics, err := s.clientSubscriptions(conn, clientID)
+		if err != nil {
+			return false, err
+		}
+		sort.Slice(topics, func(i, j int) bool { return topics[i].Name < topics[j].Name })
+		for _, topic := range topics {
+			if !t.Match(topic.Name) {
+				continue
+			}
+			if pos != nil && clientID == pos.ClientID && topic.Name <= pos.TopicName {
+				continue
+			}
+			n++
+			next = encodeCursor(cursor{ClientID: clientID, TopicName: topic.Name})
+			if !fn(clientID, packets.Topic{Qos: topic.Qos, Name: topic.Name}) || (options.Limit > 0 && n >= options.Limit) {
+				return false, nil
+			}
+		}
+		return true, nil
+	}
+	if options.ClientID != "" {
+		if pos != nil && pos.ClientID != options.ClientID {
+			return "", true
+		}
+		more, err := visit(options.ClientID)
+		if err != nil {
+			s.logError("redis iterate error", err, zap.String("client_id", options.ClientID))
+			return "", true
+		}
+		if more {
+			return "", true
+		}
+		return next, false
+	}
+	if err := s.syncIndex(conn); err != nil {
+		s.logError("redis iterate error", err)
+		return "", true
+	}
+	min := "-"
+	if pos != nil {
+		// the client of the cursor may have subscriptions left.
+		min = "[" + pos.ClientID
+	}
+	for {
+		clientIDs, err := redigo.Strings(conn.Do("ZRANGEBYLEX", s.key(keyClientIndex), min, "+", "LIMIT", 0, indexBatch))
+		if err != nil {
+			s.logError("redis iterate error", err)
+			return "", true
+		}
+		for _, clientID := range clientIDs {
+			more, err := visit(clientID)
+			if err != nil {
+				s.logError("redis iterate error", err, zap.String("client_id", clientID))
+				return "", true
+			}
+			if !more {
+				return next, false
+			}
+		}
+		if len(clientIDs) < indexBatch {
+			return "", true
+		}
+		min = "(" + clientIDs[len(clientIDs)-1]
+	}
+}
@@ -0,0 +1,408 @@
+// Package redis provides a subscription.Store implementation which persists the subscriptions in redis.
+// The subscriptions survive the broker restarts and can be shared across multiple broker instances
+// which use the same redis and key prefix.
+package redis
+
+import (
+	"errors"
+	"strconv"
+
+	redigo "github.com/gomodule/redigo/redis"
+	"go.uber.org/zap"
+
+	"github.com/DrmagicE/gmqtt/pkg/packets"
+	"github.com/DrmagicE/gmqtt/subscription"
+)
+
+var _ subscription.Store = (*Store)(nil)
+
+// DefaultKeyPrefix is the default prefix of the redis keys used by the Store.
+const DefaultKeyPrefix = "gmqtt:sub:"
+
+// ErrClientNotExists is returned by GetClientStats if the stats of the client not exists.
+var ErrClientNotExists = errors.New("client not exists")
+
+// The layout of the keys, all keys are prefixed with the key prefix:
+//
+//	clients           SET  of client ids which have subscriptions.
+//	clientindex       ZSET of the client ids of clients with score 0, which orders them for IterateFrom.
+//	filters           SET  of topic filters which have subscribers.
+//	client:<clientID> HASH of topic filter -> qos, the subscriptions of the client.
+//	filter:<filter>   HASH of client id -> qos, the subscribers of the topic filter.
+//	stats             HASH of "total" and "current", the global stats.
+//	stats:<clientID>  HASH of "total" and "current", the stats of the client.
+const (
+	keyClients     = "clients"
+	keyClientIndex = "clientindex"
+	keyFilters     = "filters"
+	keyClient      = "client:"
+	keyFilter      = "filter:"
+	keyStats       = "stats"
+	keyClientStats = "stats:"
+
+	fieldTotal   = "total"
+	fieldCurrent = "current"
+)
+
+// subscribeScript adds the subscription and returns the previous qos, or -1 if the subscription not exists.
+// KEYS: client, filter, filters, clients, stats, client stats, client index
+// ARGV: client id, topic filter, qos
+var subscribeScript = redigo.NewScript(7, `
+local old = redis.call('HGET', KEYS[1], ARGV[2])
+if old == ARGV[3] then
+	return tonumber(old)
+end
+redis.call('HSET', KEYS[1], ARGV[2], ARGV[3])
+redis.call('HSET', KEYS[2], ARGV[1], ARGV[3])
+redis.call('SADD', KEYS[3], ARGV[2])
+redis.call('SADD', KEYS[4], ARGV[1])
+redis.call('ZADD', KEYS[7], 0, ARGV[1])
+if old then
+	return tonumber(old)
+end
+redis.call('HINCRBY', KEYS[5], 'total', 1)
+redis.call('HINCRBY', KEYS[5], 'current', 1)
+redis.call('HINCRBY', KEYS[6], 'total', 1)
+redis.call('HINCRBY', KEYS[6], 'current', 1)
+return -1
+`)
+
+// unsubscribeScript removes the subscription and returns 1 if the subscription existed.
+// KEYS: client, filter, filters, clients, stats, client stats, client index
+// ARGV: client id, topic filter
+var unsubscribeScript = redigo.NewScript(7, `
+if redis.call('HDEL', KEYS[1], ARGV[2]) == 0 then
+	return 0
+end
+redis.call('HDEL', KEYS[2], ARGV[1])
+if redis.call('HLEN', KEYS[2]) == 0 then
+	redis.call('SREM', KEYS[3], ARGV[2])
+end
+if redis.call('HLEN', KEYS[1]) == 0 then
+	redis.call('SREM', KEYS[4], ARGV[1])
+	redis.call('ZREM', KEYS[7], ARGV[1])
+end
+redis.call('HINCRBY', KEYS[5], 'current', -1)
+redis.call('HINCRBY', KEYS[6], 'current', -1)
+return 1
+`)
+
+// indexScript rebuilds the client index from the clients set, it is used if the index is missing or out of sync,
+// e.g: the subscriptions were written by a version without the index.
+// KEYS: clients, client index
+var indexScript = redigo.NewScript(2, `
+redis.call('DEL', KEYS[2])
+for _, id in ipairs(redis.call('SMEMBERS', KEYS[1])) do
+	redis.call('ZADD', KEYS[2], 0, id)
+end
+return 1
+`)
+
+// Option is the option of the Store.
+type Option func(s *Store)
+
+// WithKeyPrefix sets the prefix of the redis keys, default to DefaultKeyPrefix.
+// The brokers which share the subscriptions must use the same prefix.
+func WithKeyPrefix(prefix string) Option {
+	return func(s *Store) {
+		s.prefix = prefix
+	}
+}
+
+// WithLogger sets the logger which is used to log the redis errors, default to zap.L().
+func WithLogger(logger *zap.Logger) Option {
+	return func(s *Store) {
+		s.log = logger
+	}
+}
+
+// Store is the redis backed subscription.Store.
+// Notice:
+// Most methods of the subscription.Store interface can not return an error,
+// the redis errors are logged and the methods return the empty results.
+// Subscribe reports the errors in the Err field of the SubscribeResult.
+type Store struct {
+	pool   *redigo.Pool
+	prefix string
+	log    *zap.Logger
+}
+
+// New returns a Store which uses the connections from the pool.
+func New(pool *redigo.Pool, opts ...Option) *Store {
+	s := &Store{
+		pool:   pool,
+		prefix: DefaultKeyPrefix,
+		log:    zap.L(),
+	}
+	for _, fn := range opts {
+		fn(s)
+	}
+	return s
+}
+
+func (s *Store) key(k string) string {
+	return s.prefix + k
+}
+
+func (s *Store) scriptKeys(clientID, topicFilter string) []interface{} {
+	return []interface{}{
+		s.key(keyClient + clientID),
+		s.key(keyFilter + topicFilter),
+		s.key(keyFilters),
+		s.key(keyClients),
+		s.key(keyStats),
+		s.key(keyClientStats + clientID),
+		s.key(keyClientIndex),
+	}
+}
+
+func (s *Store) logError(msg string, err error, fields ...zap.Field) {
+	s.log.Error(msg, append(fields, zap.Error(err))...)
+}
+
+// Subscribe add subscriptions to the client.
+func (s *Store) Subscribe(clientID string, topics ...packets.Topic) subscription.SubscribeResult {
+	conn := s.pool.Get()
+	defer conn.Close()
+	rs := make(subscription.SubscribeResult, len(topics))
+	for k, topic := range topics {
+		rs[k].Topic = topic
+		args := append(s.scriptKeys(clientID, topic.Name), clientID, topic.Name, topic.Qos)
+		old, err := redigo.Int(subscribeScript.Do(conn, args...))
+		if err != nil {
+			rs[k].Err = err
+			continue
+		}
+		if old != -1 {
+			rs[k].AlreadyExisted = true
+			rs[k].Unchanged = old == int(topic.Qos)
+		}
+	}
+	return rs
+}
+
+// Unsubscribe remove subscriptions of the client.
+func (s *Store) Unsubscribe(clientID string, topics ...string) {
+	conn := s.pool.Get()
+	defer conn.Close()
+	s.unsubscribe(conn, clientID, topics...)
+}
+
+func (s *Store) unsubscribe(conn redigo.Conn, clientID string, topics ...string) {
+	for _, topic := range topics {
+		args := append(s.scriptKeys(clientID, topic), clientID, topic)
+		if _, err := unsubscribeScript.Do(conn, args...); err != nil {
+			s.logError("redis unsubscribe error", err, zap.String("client_id", clientID), zap.String("topic", topic))
+		}
+	}
+}
+
+// UnsubscribeAll remove all subscriptions of the client.
+func (s *Store) UnsubscribeAll(clientID string) {
+	conn := s.pool.Get()
+	defer conn.Close()
+	filters, err := redigo.Strings(conn.Do("HKEYS", s.key(keyClient+clientID)))
+	if err != nil {
+		s.logError("redis unsubscribe all error", err, zap.String("client_id", clientID))
+		return
+	}
+	s.unsubscribe(conn, clientID, filters...)
+}
+
+// Iterate iterate all subscriptions.
+func (s *Store) Iterate(fn subscription.IterateFn) {
+	s.IterateWithOptions(fn, subscription.IterationOptions{})
+}
+
+// IterateWithOptions iterates the subscriptions which satisfy the options.
+// The iteration stops when fn returns false or options.Limit subscriptions have been visited.
+// The iteration is not a snapshot, the clients are scanned in batches with SSCAN.
+func (s *Store) IterateWithOptions(fn subscription.IterateFn, options subscription.IterationOptions) {
+	conn := s.pool.Get()
+	defer conn.Close()
+	t := options.Type
+	if t == 0 {
+		t = subscription.TypeAll
+	}
+	var n int
+	visit := func(clientID string) bool {
+		topics, err := s.clientSubscriptions(conn, clientID)
+		if err != nil {
+			s.logError("redis iterate error", err, zap.String("client_id", clientID))
+			return false
+		}
+		for _, topic := range topics {
+			if !t.Match(topic.Name) {
+				continue
+			}
+			if options.Limit > 0 && n >= options.Limit {
+				return false
+			}
+			n++
+			if !fn(clientID, topic) {
+				return false
+			}
+		}
+		return true
+	}
+	if options.ClientID != "" {
+		visit(options.ClientID)
+		return
+	}
+	err := s.scan(conn, s.key(keyClients), visit)
+	if err != nil {
+		s.logError("redis iterate error", err)
+	}
+}
+
+// scan iterates the members of the set until fn returns false.
+func (s *Store) scan(conn redigo.Conn, key string, fn func(member string) bool) error {
+	cursor := "0"
+	for {
+		values, err := redigo.Values(conn.Do("SSCAN", key, cursor))
+		if err != nil {
+			return err
+		}
+		var members []string
+		if _, err := redigo.Scan(values, &cursor, &members); err != nil {
+			return err
+		}
+		for _, m := range members {
+			if !fn(m) {
+				return nil
+			}
+		}
+		if cursor == "0" {
+			return nil
+		}
+	}
+}
+
+func (s *Store) clientSubscriptions(conn redigo.Conn, clientID string) ([]packets.Topic, error) {
+	m, err := redigo.IntMap(conn.Do("HGETALL", s.key(keyClient+clientID)))
+	if err != nil {
+		return nil, err
+	}
+	var rs []packets.Topic
+	for name, qos := range m {
+		rs = append(rs, packets.Topic{
+			Qos:  uint8(qos),
+			Name: name,
+		})
+	}
+	return rs, nil
+}
+
+// subscribers returns the subscribers of the topic filters.
+func (s *Store) subscribers(conn redigo.Conn, topicFilters ...string) (subscription.ClientTopics, error) {
+	for _, filter := range topicFilters {
+		if err := conn.Send("HGETALL", s.key(keyFilter+filter)); err != nil {
+			return nil, err
+		}
+	}
+	if err := conn.Flush(); err != nil {
+		return nil, err
+	}
+	rs := make(subscription.ClientTopics)
+	for _, filter := range topicFilters {
+		m, err := redigo.IntMap(conn.Receive())
+		if err != nil {
+			return nil, err
+		}
+		for clientID, qos := range m {
+			rs[clientID] = append(rs[clientID], packets.Topic{
+				Qos:  uint8(qos),
+				Name: filter,
+			})
+		}
+	}
+	return rs, nil
+}
+
+// Get returns the subscriptions that equals the passed topic filter.
+func (s *Store) Get(topicFilter string) subscription.ClientTopics {
+	conn := s.pool.Get()
+	defer conn.Close()
+	rs, err := s.subscribers(conn, topicFilter)
+	if err != nil {
+		s.logError("redis get error", err, zap.String("topic", topicFilter))
+		return nil
+	}
+	if len(rs) == 0 {
+		return nil
+	}
+	return rs
+}
+
+// GetTopicMatched returns the subscriptions that match the passed topic.
+// Notice:
+// All topic filters are scanned to find the matched ones, so it is much slower than the memory store.
+// Consider wrapping the Store with the subscription/cache package.
+func (s *Store) GetTopicMatched(topicName string) subscription.ClientTopics {
+	conn := s.pool.Get()
+	defer conn.Close()
+	var matched []string
+	err := s.scan(conn, s.key(keyFilters), func(filter string) bool {
+		if packets.TopicMatch([]byte(topicName), []byte(filter)) {
+			matched = append(matched, filter)
+		}
+		return true
+	})
+	if err == nil && len(matched) != 0 {
+		var rs subscription.ClientTopics
+		if rs, err = s.subscribers(conn, matched...); err == nil {
+			return rs
+		}
+	}
+	if err != nil {
+		s.logError("redis get topic matched error", err, zap.String("topic", topicName))
+	}
+	return make(subscription.ClientTopics)
+}
+
+// GetClientSubscriptions returns the subscriptions of the client.
+func (s *Store) GetClientSubscriptions(clientID string) []packets.Topic {
+	conn := s.pool.Get()
+	defer conn.Close()
+	rs, err := s.clientSubscriptions(conn, clientID)
+	if err != nil {
+		s.logError("redis get client subscriptions error", err, zap.String("client_id", clientID))
+	}
+	return rs
+}
+
+func (s *Store) stats(key string) (subscription.Stats, bool, error) {
+	conn := s.pool.Get()
+	defer conn.Close()
+	m, err := redigo.StringMap(conn.Do("HGETALL", key))
+	if err != nil || len(m) == 0 {
+		return subscription.Stats{}, false, err
+	}
+	total, _ := strconv.ParseUint(m[fieldTotal], 10, 64)
+	current, _ := strconv.ParseUint(m[fieldCurrent], 10, 64)
+	return subscription.Stats{
+		SubscriptionsTotal:   total,
+		SubscriptionsCurrent: current,
+	}, true, nil
+}
+
+// GetStats return the global stats. The stats are shared by all brokers which use the same key prefix.
+func (s *Store) GetStats() subscription.Stats {
+	stats, _, err := s.stats(s.key(keyStats))
+	if err != nil {
+		s.logError("redis get stats error", err)
+	}
+	return stats
+}
+
+// GetClientStats return the stats of the client.
+func (s *Store) GetClientStats(clientID string) (subscription.Stats, error) {
+	stats, ok, err := s.stats(s.key(keyClientStats + clientID))
+	if err != nil {
+		return subscription.Stats{}, err
+	}
+	if !ok {
+		return subscription.Stats{}, ErrClientNotExists
+	}
+	return stats, nil
+}
@@ -0,0 +1,288 @@
+package redis
+
+import (
+	"sort"
+	"strconv"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	redigo "github.com/gomodule/redigo/redis"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/DrmagicE/gmqtt/pkg/packets"
+	"github.com/DrmagicE/gmqtt/subscription"
+)
+
+func newTestStore(t *testing.T, opts ...Option) (*Store, *miniredis.Miniredis) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := mr.Addr()
+	pool := &redigo.Pool{
+		Dial: func() (redigo.Conn, error) {
+			return redigo.Dial("tcp", addr)
+		},
+	}
+	return New(pool, opts...), mr
+}
+
+func TestStore_Subscribe(t *testing.T) {
+	a := assert.New(t)
+	s, mr := newTestStore(t)
+	defer mr.Close()
+
+	rs := s.Subscribe("id0",
+		packets.Topic{Name: "a/b", Qos: packets.QOS_1},
+		packets.Topic{Name: "a/+", Qos: packets.QOS_2},
+	)
+	a.Len(rs, 2)
+	for _, v := range rs {
+		a.False(v.AlreadyExisted)
+		a.Nil(v.Err)
+	}
+
+	rs = s.Subscribe("id0",
+		packets.Topic{Name: "a/b", Qos: packets.QOS_1},
+		packets.Topic{Name: "a/+", Qos: packets.QOS_0},
+	)
+	a.True(rs[0].AlreadyExisted)
+	a.True(rs[0].Unchanged)
+	a.True(rs[1].AlreadyExisted)
+	a.False(rs[1].Unchanged)
+
+	s.Subscribe("id1", packets.Topic{Name: "a/b", Qos: packets.QOS_2})
+
+	a.ElementsMatch([]packets.Topic{
+		{Name: "a/b", Qos: packets.QOS_1},
+		{Name: "a/+", Qos: packets.QOS_0},
+	}, s.GetClientSubscriptions("id0"))
+	a.Equal(subscription.ClientTopics{
+		"id0": {{Name: "a/b", Qos: packets.QOS_1}},
+		"id1": {{Name: "a/b", Qos: packets.QOS_2}},
+	}, s.Get("a/b"))
+	a.Nil(s.Get("c"))
+
+	matched := s.GetTopicMatched("a/b")
+	a.Len(matched, 2)
+	a.ElementsMatch([]packets.Topic{
+		{Name: "a/b", Qos: packets.QOS_1},
+		{Name: "a/+", Qos: packets.QOS_0},
+	}, matched["id0"])
+	a.Equal([]packets.Topic{{Name: "a/b", Qos: packets.QOS_2}}, matched["id1"])
+	a.Len(s.GetTopicMatched("b"), 0)
+
+	a.Equal(subscription.Stats{SubscriptionsTotal: 3, SubscriptionsCurrent: 3}, s.GetStats())
+	stats, err := s.GetClientStats("id0")
+	a.Nil(err)
+	a.Equal(subscription.Stats{SubscriptionsTotal: 2, SubscriptionsCurrent: 2}, stats)
+	_, err = s.GetClientStats("id2")
+	a.Equal(ErrClientNotExists, err)
+}
+
+func TestStore_Unsubscribe(t *testing.T) {
+	a := assert.New(t)
+	s, mr := newTestStore(t)
+	defer mr.Close()
+
+	s.Subscribe("id0",
+		packets.Topic{Name: "a/b", Qos: packets.QOS_1},
+		packets.Topic{Name: "$SYS/a", Qos: packets.QOS_1},
+	)
+	s.Subscribe("id1", packets.Topic{Name: "a/b", Qos: packets.QOS_1})
+
+	s.Unsubscribe("id0", "a/b", "not-exists")
+	a.Equal([]packets.Topic{{Name: "$SYS/a", Qos: packets.QOS_1}}, s.GetClientSubscriptions("id0"))
+	a.Equal(subscription.ClientTopics{
+		"id1": {{Name: "a/b", Qos: packets.QOS_1}},
+	}, s.GetTopicMatched("a/b"))
+	a.Equal(subscription.Stats{SubscriptionsTotal: 3, SubscriptionsCurrent: 2}, s.GetStats())
+
+	s.UnsubscribeAll("id0")
+	a.Len(s.GetClientSubscriptions("id0"), 0)
+	a.Len(s.GetTopicMatched("$SYS/a"), 0)
+	stats, err := s.GetClientStats("id0")
+	a.Nil(err)
+	a.Equal(subscription.Stats{SubscriptionsTotal: 2, SubscriptionsCurrent: 0}, stats)
+	a.Equal(subscription.Stats{SubscriptionsTotal: 3, SubscriptionsCurrent: 1}, s.GetStats())
+
+	// the empty sets are removed.
+	members, err := mr.Members(DefaultKeyPrefix + keyClients)
+	a.Nil(err)
+	a.Equal([]string{"id1"}, members)
+	members, err = mr.Members(DefaultKeyPrefix + keyFilters)
+	a.Nil(err)
+	a.Equal([]string{"a/b"}, members)
+}
+
+func TestStore_IterateWithOptions(t *testing.T) {
+	a := assert.New(t)
+	s, mr := newTestStore(t)
+	defer mr.Close()
+
+	s.Subscribe("id0",
+		packets.Topic{Name: "a", Qos: packets.QOS_1},
+		packets.Topic{Name: "$SYS/a", Qos: packets.QOS_1},
+	)
+	s.Subscribe("id1",
+		packets.Topic{Name: "b", Qos: packets.QOS_1},
+		packets.Topic{Name: "$SYS/b", Qos: packets.QOS_2},
+	)
+
+	collect := func(options subscription.IterationOptions) subscription.ClientTopics {
+		rs := make(subscription.ClientTopics)
+		s.IterateWithOptions(func(clientID string, topic packets.Topic) bool {
+			rs[clientID] = append(rs[clientID], topic)
+			return true
+		}, options)
+		return rs
+	}
+	var n int
+	s.Iterate(func(clientID string, topic packets.Topic) bool {
+		n++
+		return true
+	})
+	a.Equal(4, n)
+
+	a.Equal(subscription.ClientTopics{
+		"id0": {{Name: "$SYS/a", Qos: packets.QOS_1}},
+		"id1": {{Name: "$SYS/b", Qos: packets.QOS_2}},
+	}, collect(subscription.IterationOptions{Type: subscription.TypeSYS}))
+
+	a.Equal(subscription.ClientTopics{
+		"id1": {{Name: "b", Qos: packets.QOS_1}},
+	}, collect(subscription.IterationOptions{Type: subscription.TypeNonSYS, ClientID: "id1"}))
+
+	rs := collect(subscription.IterationOptions{Limit: 3})
+	n = 0
+	for _, v := range rs {
+		n += len(v)
+	}
+	a.Equal(3, n)
+}
+
+func TestStore_IterateFrom(t *testing.T) {
+	a := assert.New(t)
+	s, mr := newTestStore(t)
+	defer mr.Close()
+
+	var want []string
+	for i := 0; i < 20; i++ {
+		clientID := "id" + strconv.Itoa(i%7)
+		topic := "t" + strconv.Itoa(i)
+		s.Subscribe(clientID, packets.Topic{Name: topic, Qos: packets.QOS_1})
+		want = append(want, clientID+" "+topic)
+	}
+	sort.Strings(want)
+	s.Subscribe("id0", packets.Topic{Name: "$SYS/a", Qos: packets.QOS_1})
+
+	collect := func(options subscription.IterationOptions) (pages [][]string) {
+		var token subscription.Cursor
+		for {
+			var page []string
+			next, done := s.IterateFrom(func(clientID string, topic packets.Topic) bool {
+				page = append(page, clientID+" "+topic.Name)
+				return true
+			}, options, token)
+			if len(page) != 0 {
+				pages = append(pages, page)
+			}
+			if done {
+				return pages
+			}
+			token = next
+		}
+	}
+	pages := collect(subscription.IterationOptions{Type: subscription.TypeNonSYS, Limit: 3})
+	a.Len(pages, 7)
+	var all []string
+	for _, p := range pages {
+		a.True(len(p) <= 3)
+		all = append(all, p...)
+	}
+	// the subscriptions are visited in the order of the client id and then the topic filter.
+	a.Equal(want, all)
+
+	a.Equal([][]string{{"id1 t1", "id1 t15"}, {"id1 t8"}},
+		collect(subscription.IterationOptions{ClientID: "id1", Limit: 2}))
+
+	// the subscriptions which are not modified during the iteration are visited exactly once.
+	var visited []string
+	next, done := s.IterateFrom(func(clientID string, topic packets.Topic) bool {
+		visited = append(visited, clientID+" "+topic.Name)
+		return true
+	}, subscription.IterationOptions{Type: subscription.TypeNonSYS, Limit: 4}, "")
+	a.False(done)
+	s.Subscribe("id9", packets.Topic{Name: "new", Qos: packets.QOS_1})
+	s.UnsubscribeAll("id2")
+	for !done {
+		next, done = s.IterateFrom(func(clientID string, topic packets.Topic) bool {
+			visited = append(visited, clientID+" "+topic.Name)
+			return true
+		}, subscription.IterationOptions{Type: subscription.TypeNonSYS, Limit: 4}, next)
+	}
+	a.Len(visited, 20-3+1)
+	a.Contains(visited, "id9 new")
+
+	next, done = s.IterateFrom(func(clientID string, topic packets.Topic) bool {
+		return true
+	}, subscription.IterationOptions{}, "invalid")
+	a.Equal(subscription.Cursor(""), next)
+	a.True(done)
+}
+
+func TestStore_IterateFrom_RebuildIndex(t *testing.T) {
+	a := assert.New(t)
+	s, mr := newTestStore(t)
+	defer mr.Close()
+
+	s.Subscribe("id1", packets.Topic{Name: "a", Qos: packets.QOS_1})
+	s.Subscribe("id0", packets.Topic{Name: "a", Qos: packets.QOS_1})
+	// the subscriptions written by the versions without the client index.
+	mr.Del(s.key(keyClientIndex))
+
+	var visited []string
+	_, done := s.IterateFrom(func(clientID string, topic packets.Topic) bool {
+		visited = append(visited, clientID)
+		return true
+	}, subscription.IterationOptions{}, "")
+	a.True(done)
+	a.Equal([]string{"id0", "id1"}, visited)
+	members, err := mr.ZMembers(s.key(keyClientIndex))
+	a.Nil(err)
+	a.Equal([]string{"id0", "id1"}, members)
+}
+
+func TestStore_KeyPrefix(t *testing.T) {
+	a := assert.New(t)
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mr.Close()
+	pool := &redigo.Pool{
+		Dial: func() (redigo.Conn, error) {
+			return redigo.Dial("tcp", mr.Addr())
+		},
+	}
+	s0 := New(pool, WithKeyPrefix("broker0:"))
+	s1 := New(pool, WithKeyPrefix("broker1:"))
+	shared := New(pool, WithKeyPrefix("broker0:"))
+
+	s0.Subscribe("id0", packets.Topic{Name: "a", Qos: packets.QOS_1})
+	a.Len(s1.GetTopicMatched("a"), 0)
+	a.Len(shared.GetTopicMatched("a"), 1)
+	a.True(mr.Exists("broker0:" + keyClient + "id0"))
+}
+
+func TestStore_RedisError(t *testing.T) {
+	a := assert.New(t)
+	s, mr := newTestStore(t)
+	mr.Close()
+
+	rs := s.Subscribe("id0", packets.Topic{Name: "a", Qos: packets.QOS_1})
+	a.NotNil(rs[0].Err)
+	a.Len(s.GetTopicMatched("a"), 0)
+	_, err := s.GetClientStats("id0")
+	a.NotNil(err)
+}
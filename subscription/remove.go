@@ -0,0 +1,58 @@
+package subscription
+
+import (
+	"github.com/DrmagicE/gmqtt/pkg/packets"
+)
+
+// filterMatched returns whether the topic filter of a subscription is matched by the pattern.
+// The topic filter is treated as a plain topic name, so the wildcards in it are matched literally,
+// e.g: the pattern "sensor/#" matches "sensor/+/temperature" and "sensor/#".
+func filterMatched(topicFilter, pattern string) bool {
+	return topicFilter == pattern || packets.TopicMatch([]byte(topicFilter), []byte(pattern))
+}
+
+// UnsubscribeMatched removes all subscriptions of the client whose topic filter is matched by the pattern,
+// and returns the removed subscriptions.
+// The pattern is a topic filter, the topic filters of the subscriptions are matched against it
+// as if they were topic names, e.g: "sensor/#" removes both "sensor/+/temperature" and "sensor/room1".
+// Notice:
+// This function will not trigger any gmqtt hooks.
+func UnsubscribeMatched(store Store, clientID string, pattern string) []packets.Topic {
+	var removed []packets.Topic
+	var filters []string
+	for _, v := range store.GetClientSubscriptions(clientID) {
+		if filterMatched(v.Name, pattern) {
+			removed = append(removed, v)
+			filters = append(filters, v.Name)
+		}
+	}
+	if len(filters) != 0 {
+		store.Unsubscribe(clientID, filters...)
+	}
+	return removed
+}
+
+// RemoveByFilter removes the subscriptions of all clients whose topic filter is matched by the pattern,
+// and returns the removed subscriptions. It is used to decommission topics administratively.
+// See UnsubscribeMatched for the matching rule.
+// Notice:
+// This function walks through all subscriptions, do not call it frequently.
+// This function will not trigger any gmqtt hooks.
+func RemoveByFilter(store Store, pattern string) ClientTopics {
+	removed := make(ClientTopics)
+	// the store can not be modified during the iteration, collect the subscriptions first.
+	store.Iterate(func(clientID string, topic packets.Topic) bool {
+		if filterMatched(topic.Name, pattern) {
+			removed[clientID] = append(removed[clientID], topic)
+		}
+		return true
+	})
+	for clientID, topics := range removed {
+		filters := make([]string, len(topics))
+		for k, v := range topics {
+			filters[k] = v.Name
+		}
+		store.Unsubscribe(clientID, filters...)
+	}
+	return removed
+}
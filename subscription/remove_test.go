@@ -0,0 +1,67 @@
+package subscription_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/DrmagicE/gmqtt/pkg/packets"
+	"github.com/DrmagicE/gmqtt/subscription"
+	"github.com/DrmagicE/gmqtt/subscription/trie"
+)
+
+func TestUnsubscribeMatched(t *testing.T) {
+	a := assert.New(t)
+	db := trie.NewStore()
+	db.Subscribe("id0",
+		packets.Topic{Name: "sensor/+/temperature", Qos: packets.QOS_0},
+		packets.Topic{Name: "sensor/room1", Qos: packets.QOS_1},
+		packets.Topic{Name: "sensor/#", Qos: packets.QOS_1},
+		packets.Topic{Name: "other", Qos: packets.QOS_1},
+		packets.Topic{Name: "$SYS/sensor", Qos: packets.QOS_1},
+	)
+	db.Subscribe("id1", packets.Topic{Name: "sensor/room1", Qos: packets.QOS_1})
+
+	removed := subscription.UnsubscribeMatched(db, "id0", "sensor/#")
+	a.ElementsMatch([]packets.Topic{
+		{Name: "sensor/+/temperature", Qos: packets.QOS_0},
+		{Name: "sensor/room1", Qos: packets.QOS_1},
+		{Name: "sensor/#", Qos: packets.QOS_1},
+	}, removed)
+	a.ElementsMatch([]packets.Topic{
+		{Name: "other", Qos: packets.QOS_1},
+		{Name: "$SYS/sensor", Qos: packets.QOS_1},
+	}, db.GetClientSubscriptions("id0"))
+	// other clients are not affected.
+	a.Len(db.GetClientSubscriptions("id1"), 1)
+
+	a.Len(subscription.UnsubscribeMatched(db, "id0", "not/exists"), 0)
+}
+
+func TestRemoveByFilter(t *testing.T) {
+	a := assert.New(t)
+	db := trie.NewStore()
+	db.Subscribe("id0",
+		packets.Topic{Name: "a/b", Qos: packets.QOS_0},
+		packets.Topic{Name: "b", Qos: packets.QOS_1},
+	)
+	db.Subscribe("id1",
+		packets.Topic{Name: "a/+", Qos: packets.QOS_2},
+		packets.Topic{Name: "$SYS/a", Qos: packets.QOS_2},
+	)
+
+	removed := subscription.RemoveByFilter(db, "a/+")
+	a.Equal(subscription.ClientTopics{
+		"id0": {{Name: "a/b", Qos: packets.QOS_0}},
+		"id1": {{Name: "a/+", Qos: packets.QOS_2}},
+	}, removed)
+	a.Len(db.GetTopicMatched("a/b"), 0)
+	a.Equal(subscription.Stats{SubscriptionsTotal: 4, SubscriptionsCurrent: 2}, db.GetStats())
+
+	// "#" does not match the system topic filters.
+	removed = subscription.RemoveByFilter(db, "#")
+	a.Equal(subscription.ClientTopics{
+		"id0": {{Name: "b", Qos: packets.QOS_1}},
+	}, removed)
+	a.Equal([]packets.Topic{{Name: "$SYS/a", Qos: packets.QOS_2}}, db.GetClientSubscriptions("id1"))
+}
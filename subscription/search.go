@@ -0,0 +1,89 @@
+package subscription
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/DrmagicE/gmqtt/pkg/packets"
+)
+
+// compileGlob converts the shell-style glob pattern into a regular expression.
+// '*' matches any sequence of characters within a topic level, '?' matches any single character within a topic level.
+// All other characters, including the MQTT wildcards '+' and '#', are matched literally.
+func compileGlob(glob string) *regexp.Regexp {
+	var b strings.Builder
+	b.WriteString("^")
+	for _, r := range glob {
+		switch r {
+		case '*':
+			b.WriteString("[^/]*")
+		case '?':
+			b.WriteString("[^/]")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.MustCompile(b.String())
+}
+
+// Search returns the subscriptions whose topic filter matches the shell-style glob pattern.
+// Notice that the glob pattern is matched against the topic filters as plain strings,
+// it is not the MQTT topic matching, e.g: "sensor/*/temperature" matches both
+// "sensor/+/temperature" and "sensor/room1/temperature".
+// '*' matches any sequence of characters within a topic level, '?' matches any single character within a topic level.
+// The t restricts the type of the topic filters to be searched.
+// This function walks through all subscriptions, do not call it frequently.
+func Search(store Store, glob string, t Type) ClientTopics {
+	re := compileGlob(glob)
+	rs := make(ClientTopics)
+	store.Iterate(func(clientID string, topic packets.Topic) bool {
+		if t.Match(topic.Name) && re.MatchString(topic.Name) {
+			rs[clientID] = append(rs[clientID], topic)
+		}
+		return true
+	})
+	return rs
+}
+
+// HasSubscriber returns whether there is at least one subscription of the type t that matches the topic name.
+// It stops the iteration as soon as the first matched subscription is found.
+func HasSubscriber(store Store, topicName string, t Type) bool {
+	var found bool
+	store.Iterate(func(clientID string, topic packets.Topic) bool {
+		if t.Match(topic.Name) && packets.TopicMatch([]byte(topicName), []byte(topic.Name)) {
+			found = true
+			return false
+		}
+		return true
+	})
+	return found
+}
+
+// MultiMatcher is implemented by the stores which can match multiple topic names in one traversal.
+type MultiMatcher interface {
+	GetTopicMatchedMulti(topicNames []string, t Type) map[string]ClientTopics
+}
+
+// GetTopicMatchedMulti returns the subscriptions of the type t that match each of the topic names, key by topic name.
+// The duplicated topic names are matched once.
+// If the store implements MultiMatcher, the topic names are matched in one traversal,
+// otherwise GetTopicMatched is called for each of them.
+func GetTopicMatchedMulti(store Store, topicNames []string, t Type) map[string]ClientTopics {
+	if m, ok := store.(MultiMatcher); ok {
+		return m.GetTopicMatchedMulti(topicNames, t)
+	}
+	rs := make(map[string]ClientTopics, len(topicNames))
+	for _, topicName := range topicNames {
+		if _, ok := rs[topicName]; ok {
+			continue
+		}
+		// system topics can only be matched by system topic filters, and vice versa.
+		if !t.Match(topicName) {
+			rs[topicName] = make(ClientTopics)
+			continue
+		}
+		rs[topicName] = store.GetTopicMatched(topicName)
+	}
+	return rs
+}
@@ -0,0 +1,177 @@
+package subscription_test
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/DrmagicE/gmqtt/pkg/packets"
+	"github.com/DrmagicE/gmqtt/subscription"
+	"github.com/DrmagicE/gmqtt/subscription/trie"
+)
+
+func TestSearch(t *testing.T) {
+	a := assert.New(t)
+	db := trie.NewStore()
+	db.Subscribe("id0",
+		packets.Topic{Name: "sensor/+/temperature", Qos: packets.QOS_0},
+		packets.Topic{Name: "sensor/room1/temperature", Qos: packets.QOS_1},
+		packets.Topic{Name: "sensor/room1/humidity", Qos: packets.QOS_1},
+	)
+	db.Subscribe("id1",
+		packets.Topic{Name: "sensor/a/b/temperature", Qos: packets.QOS_2},
+		packets.Topic{Name: "sensor/#", Qos: packets.QOS_2},
+		packets.Topic{Name: "$SYS/sensor/x/temperature", Qos: packets.QOS_2},
+	)
+
+	sortTopics := func(ct subscription.ClientTopics) subscription.ClientTopics {
+		for _, v := range ct {
+			sort.Slice(v, func(i, j int) bool {
+				return v[i].Name < v[j].Name
+			})
+		}
+		return ct
+	}
+	var tt = []struct {
+		glob string
+		t    subscription.Type
+		want subscription.ClientTopics
+	}{
+		{
+			glob: "sensor/*/temperature",
+			t:    subscription.TypeAll,
+			want: subscription.ClientTopics{
+				"id0": {
+					{Name: "sensor/+/temperature", Qos: packets.QOS_0},
+					{Name: "sensor/room1/temperature", Qos: packets.QOS_1},
+				},
+			},
+		},
+		{
+			// '+' is matched literally
+			glob: "sensor/+/*",
+			t:    subscription.TypeAll,
+			want: subscription.ClientTopics{
+				"id0": {{Name: "sensor/+/temperature", Qos: packets.QOS_0}},
+			},
+		},
+		{
+			glob: "sensor/#",
+			t:    subscription.TypeAll,
+			want: subscription.ClientTopics{
+				"id1": {{Name: "sensor/#", Qos: packets.QOS_2}},
+			},
+		},
+		{
+			glob: "sensor/room?/*",
+			t:    subscription.TypeAll,
+			want: subscription.ClientTopics{
+				"id0": {
+					{Name: "sensor/room1/humidity", Qos: packets.QOS_1},
+					{Name: "sensor/room1/temperature", Qos: packets.QOS_1},
+				},
+			},
+		},
+		{
+			glob: "*/sensor/*/temperature",
+			t:    subscription.TypeSYS,
+			want: subscription.ClientTopics{
+				"id1": {{Name: "$SYS/sensor/x/temperature", Qos: packets.QOS_2}},
+			},
+		},
+		{
+			glob: "*/sensor/*/temperature",
+			t:    subscription.TypeNonSYS,
+			want: subscription.ClientTopics{},
+		},
+	}
+	for _, v := range tt {
+		a.Equal(v.want, sortTopics(subscription.Search(db, v.glob, v.t)), v.glob)
+	}
+}
+
+// countingStore counts the subscriptions visited by Iterate.
+type countingStore struct {
+	subscription.Store
+	visited int
+}
+
+func (c *countingStore) Iterate(fn subscription.IterateFn) {
+	c.Store.Iterate(func(clientID string, topic packets.Topic) bool {
+		c.visited++
+		return fn(clientID, topic)
+	})
+}
+
+func TestHasSubscriber(t *testing.T) {
+	a := assert.New(t)
+	db := trie.NewStore()
+	for i := 0; i < 10; i++ {
+		db.Subscribe(fmt.Sprintf("id%d", i), packets.Topic{Name: "a/+", Qos: packets.QOS_0})
+	}
+	db.Subscribe("id", packets.Topic{Name: "$SYS/#", Qos: packets.QOS_0})
+	store := &countingStore{Store: db}
+
+	a.True(subscription.HasSubscriber(store, "a/1", subscription.TypeAll))
+	a.Equal(1, store.visited, "the iteration should stop on the first hit")
+	a.False(subscription.HasSubscriber(store, "b", subscription.TypeAll))
+	a.True(subscription.HasSubscriber(store, "$SYS/a", subscription.TypeSYS))
+	a.False(subscription.HasSubscriber(store, "$SYS/a", subscription.TypeNonSYS))
+	a.False(subscription.HasSubscriber(store, "a/1", subscription.TypeSYS))
+
+}
+
+func TestGetTopicMatchedMulti(t *testing.T) {
+	a := assert.New(t)
+	db := trie.NewStore()
+	filters := []string{"#", "a/#", "a/+", "a/b", "a/+/c", "+/b/#", "a/b/c/#", "$SYS/#", "$SYS/+/b", "b/", "+/+/+"}
+	for k, v := range filters {
+		db.Subscribe(fmt.Sprintf("id%d", k%3), packets.Topic{Name: v, Qos: uint8(k % 3)})
+	}
+	topicNames := []string{"a", "a/b", "a/b", "a/b/c", "a/c/c", "b/b", "b/", "a/b/c/d", "$SYS/a/b", "$SYS", "x/y/z"}
+	sortTopics := func(ct subscription.ClientTopics) subscription.ClientTopics {
+		for _, v := range ct {
+			sort.Slice(v, func(i, j int) bool {
+				return v[i].Name < v[j].Name
+			})
+		}
+		return ct
+	}
+	for _, store := range []subscription.Store{db, &countingStore{Store: db}} {
+		for _, typ := range []subscription.Type{subscription.TypeAll, subscription.TypeSYS, subscription.TypeNonSYS} {
+			rs := subscription.GetTopicMatchedMulti(store, topicNames, typ)
+			a.Len(rs, len(topicNames)-1)
+			for _, v := range topicNames {
+				want := subscription.ClientTopics{}
+				if typ.Match(v) {
+					want = db.GetTopicMatched(v)
+				}
+				a.Equal(sortTopics(want), sortTopics(rs[v]), v)
+			}
+		}
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	a := assert.New(t)
+	db := trie.NewStore()
+	db.Subscribe("id0", packets.Topic{Name: "a", Qos: packets.QOS_1})
+	r := subscription.ReadOnly(db)
+	_, ok := r.(subscription.Store)
+	a.False(ok)
+
+	// the view reflects the live data
+	db.Subscribe("id0", packets.Topic{Name: "b", Qos: packets.QOS_1})
+	var n int
+	r.Iterate(func(clientID string, topic packets.Topic) bool {
+		n++
+		return true
+	})
+	a.Equal(2, n)
+	a.Equal(db.GetStats(), r.GetStats())
+	stats, err := r.GetClientStats("id0")
+	a.Nil(err)
+	a.EqualValues(2, stats.SubscriptionsCurrent)
+}
@@ -0,0 +1,176 @@
+package trie
+
+import (
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/DrmagicE/gmqtt/pkg/packets"
+	"github.com/DrmagicE/gmqtt/subscription"
+)
+
+// linearStore matches the topic by iterating all subscriptions,
+// it is the baseline to compare with the trie.
+type linearStore struct {
+	subs map[string]map[string]uint8 // [clientID][topicFilter]qos
+}
+
+func (l *linearStore) subscribe(clientID string, topic packets.Topic) {
+	if l.subs[clientID] == nil {
+		l.subs[clientID] = make(map[string]uint8)
+	}
+	l.subs[clientID][topic.Name] = topic.Qos
+}
+
+func (l *linearStore) getTopicMatched(topicName string) subscription.ClientTopics {
+	rs := make(subscription.ClientTopics)
+	for clientID, filters := range l.subs {
+		for filter, qos := range filters {
+			if packets.TopicMatch([]byte(topicName), []byte(filter)) {
+				rs[clientID] = append(rs[clientID], packets.Topic{Qos: qos, Name: filter})
+			}
+		}
+	}
+	return rs
+}
+
+// benchmarkTopics returns n topic filters like "device/{i}/+/temperature" and "device/{i}/#" for n/2 devices.
+func benchmarkTopics(n int) []packets.Topic {
+	topics := make([]packets.Topic, 0, n)
+	for i := 0; len(topics) < n; i++ {
+		id := strconv.Itoa(i)
+		topics = append(topics,
+			packets.Topic{Name: "device/" + id + "/+/temperature", Qos: packets.QOS_1},
+			packets.Topic{Name: "device/" + id + "/#", Qos: packets.QOS_0},
+		)
+	}
+	return topics[:n]
+}
+
+func benchmarkGetTopicMatched(b *testing.B, n int, linear bool) {
+	topics := benchmarkTopics(n)
+	var match func(topicName string) subscription.ClientTopics
+	if linear {
+		l := &linearStore{subs: make(map[string]map[string]uint8)}
+		for k, v := range topics {
+			l.subscribe("client"+strconv.Itoa(k), v)
+		}
+		match = l.getTopicMatched
+	} else {
+		db := NewStore()
+		for k, v := range topics {
+			db.Subscribe("client"+strconv.Itoa(k), v)
+		}
+		match = db.GetTopicMatched
+	}
+	topicName := "device/" + strconv.Itoa(n/4) + "/room/temperature"
+	if len(match(topicName)) != 2 {
+		b.Fatalf("unexpected matched result")
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		match(topicName)
+	}
+}
+
+func BenchmarkGetTopicMatched_Trie_1000(b *testing.B) {
+	benchmarkGetTopicMatched(b, 1000, false)
+}
+
+func BenchmarkGetTopicMatched_Linear_1000(b *testing.B) {
+	benchmarkGetTopicMatched(b, 1000, true)
+}
+
+func BenchmarkGetTopicMatched_Trie_100000(b *testing.B) {
+	benchmarkGetTopicMatched(b, 100000, false)
+}
+
+func BenchmarkGetTopicMatched_Linear_100000(b *testing.B) {
+	benchmarkGetTopicMatched(b, 100000, true)
+}
+
+func BenchmarkSubscribe(b *testing.B) {
+	topics := benchmarkTopics(b.N)
+	db := NewStore()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		db.Subscribe("client", topics[i])
+	}
+}
+
+// globalLockStore serializes all calls of the store by a single lock,
+// it is the baseline to compare with the lock striping of the trieDB.
+type globalLockStore struct {
+	mu sync.RWMutex
+	db *trieDB
+}
+
+func (g *globalLockStore) Subscribe(clientID string, topics ...packets.Topic) subscription.SubscribeResult {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.db.Subscribe(clientID, topics...)
+}
+
+func (g *globalLockStore) Unsubscribe(clientID string, topics ...string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.db.Unsubscribe(clientID, topics...)
+}
+
+func (g *globalLockStore) GetTopicMatched(topicName string) subscription.ClientTopics {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.db.GetTopicMatched(topicName)
+}
+
+type churnStore interface {
+	Subscribe(clientID string, topics ...packets.Topic) subscription.SubscribeResult
+	Unsubscribe(clientID string, topics ...string)
+	GetTopicMatched(topicName string) subscription.ClientTopics
+}
+
+// benchmarkChurn runs the subscribe/unsubscribe churn of the different clients concurrently with the matching,
+// one of every 4 operations is a GetTopicMatched call.
+// The topic filters of the churn share the first level with the existing subscriptions if shared is true.
+func benchmarkChurn(b *testing.B, db churnStore, shared bool) {
+	for k, v := range benchmarkTopics(10000) {
+		db.Subscribe("client"+strconv.Itoa(k), v)
+	}
+	var clients uint64
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		id := strconv.FormatUint(atomic.AddUint64(&clients, 1), 10)
+		clientID := "churn" + id
+		topic := packets.Topic{Name: "churn" + id + "/+/temperature", Qos: packets.QOS_1}
+		if shared {
+			topic.Name = "device/" + topic.Name
+		}
+		for i := 0; pb.Next(); i++ {
+			switch i % 4 {
+			case 0:
+				db.GetTopicMatched("device/" + strconv.Itoa(i%5000) + "/room/temperature")
+			case 1, 3:
+				db.Subscribe(clientID, topic)
+			default:
+				db.Unsubscribe(clientID, topic.Name)
+			}
+		}
+	})
+}
+
+func BenchmarkChurn_Striped_SharedLevel(b *testing.B) {
+	benchmarkChurn(b, NewStore(), true)
+}
+
+func BenchmarkChurn_GlobalLock_SharedLevel(b *testing.B) {
+	benchmarkChurn(b, &globalLockStore{db: NewStore()}, true)
+}
+
+func BenchmarkChurn_Striped_DistinctLevels(b *testing.B) {
+	benchmarkChurn(b, NewStore(), false)
+}
+
+func BenchmarkChurn_GlobalLock_DistinctLevels(b *testing.B) {
+	benchmarkChurn(b, &globalLockStore{db: NewStore()}, false)
+}
@@ -0,0 +1,168 @@
+package trie
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"sort"
+
+	"github.com/DrmagicE/gmqtt/pkg/packets"
+	"github.com/DrmagicE/gmqtt/subscription"
+)
+
+var _ subscription.PagedIterator = (*trieDB)(nil)
+
+// cursor is the decoded subscription.Cursor, which is the last visited subscription.
+type cursor struct {
+	System    bool   `json:"s"`
+	ClientID  string `json:"c"`
+	TopicName string `json:"t"`
+}
+
+func encodeCursor(c cursor) subscription.Cursor {
+	b, _ := json.Marshal(c)
+	return subscription.Cursor(base64.RawURLEncoding.EncodeToString(b))
+}
+
+func decodeCursor(token subscription.Cursor) (c *cursor, ok bool) {
+	if token == "" {
+		return nil, true
+	}
+	b, err := base64.RawURLEncoding.DecodeString(string(token))
+	if err != nil {
+		return nil, false
+	}
+	c = &cursor{}
+	if err := json.Unmarshal(b, c); err != nil {
+		return nil, false
+	}
+	return c, true
+}
+
+// clientIterator merges the sorted client ids of the shards.
+type clientIterator struct {
+	heads [][]string
+}
+
+// newClientIterator returns the clientIterator of the system or user index from the client id.
+// Each shard is read locked only while its sorted client ids are got.
+func (db *trieDB) newClientIterator(system bool, from string) *clientIterator {
+	it := &clientIterator{heads: make([][]string, 0, len(db.shards))}
+	for i := range db.shards {
+		s := &db.shards[i]
+		s.RLock()
+		ids := s.sortedClients(system)
+		s.RUnlock()
+		// ids is not modified after it is built, so it can be read without the lock.
+		if ids = ids[sort.SearchStrings(ids, from):]; len(ids) != 0 {
+			it.heads = append(it.heads, ids)
+		}
+	}
+	return it
+}
+
+// next returns the next client id in order, false if there are no more client ids.
+func (it *clientIterator) next() (string, bool) {
+	least := -1
+	for i, ids := range it.heads {
+		if least == -1 || ids[0] < it.heads[least][0] {
+			least = i
+		}
+	}
+	if least == -1 {
+		return "", false
+	}
+	clientID := it.heads[least][0]
+	if it.heads[least] = it.heads[least][1:]; len(it.heads[least]) == 0 {
+		it.heads = append(it.heads[:least], it.heads[least+1:]...)
+	}
+	return clientID, true
+}
+
+// clientTopics returns the subscriptions of the client in the system or user index, sorted by the topic filter.
+func (db *trieDB) clientTopics(system bool, clientID string) []packets.Topic {
+	s := db.shard(clientID)
+	s.RLock()
+	defer s.RUnlock()
+	index := s.userIndex
+	if system {
+		index = s.systemIndex
+	}
+	topics := make([]packets.Topic, 0, len(index[clientID]))
+	for topicName, qos := range index[clientID] {
+		topics = append(topics, packets.Topic{Qos: qos, Name: topicName})
+	}
+	sort.Slice(topics, func(i, j int) bool {
+		return topics[i].Name < topics[j].Name
+	})
+	return topics
+}
+
+// IterateFrom iterates the subscriptions from the position of the token and returns the position of the next call.
+// The subscriptions are visited in a stable order: non-system topic filters first, then sorted by client id and topic filter.
+// The iteration stops when fn returns false or options.Limit subscriptions have been visited,
+// in which case the returned next cursor can be passed to the next call to resume the iteration.
+// done is true if all subscriptions have been visited.
+// Pass an empty token to start from the beginning, an invalid token is treated as the end of the iteration.
+//
+// Each call resumes every shard from the client id of the cursor by the sorted client ids cached in the shard,
+// which are only rebuilt after clients are added or removed. The shards are locked one at a time and fn is called
+// with no lock held, so the iteration is weakly consistent if the store is modified concurrently:
+// the subscriptions which exist during the whole iteration are visited exactly once,
+// the subscriptions which are added after the cursor passed their position are missed.
+func (db *trieDB) IterateFrom(fn subscription.IterateFn, options subscription.IterationOptions, token subscription.Cursor) (next subscription.Cursor, done bool) {
+	pos, ok := decodeCursor(token)
+	if !ok {
+		return "", true
+	}
+	t := options.Type
+	if t == 0 {
+		t = subscription.TypeAll
+	}
+	indexes := []struct {
+		system bool
+		t      subscription.Type
+	}{
+		{system: false, t: subscription.TypeNonSYS},
+		{system: true, t: subscription.TypeSYS},
+	}
+	var n int
+	for _, v := range indexes {
+		if t&v.t == 0 {
+			continue
+		}
+		if pos != nil && pos.System && !v.system {
+			continue
+		}
+		// resume is true if the cursor points into this index.
+		resume := pos != nil && pos.System == v.system
+		var from string
+		if resume {
+			from = pos.ClientID
+		}
+		var it *clientIterator
+		if options.ClientID != "" {
+			it = &clientIterator{}
+			if options.ClientID >= from {
+				it.heads = [][]string{{options.ClientID}}
+			}
+		} else {
+			it = db.newClientIterator(v.system, from)
+		}
+		for clientID, ok := it.next(); ok; clientID, ok = it.next() {
+			for _, topic := range db.clientTopics(v.system, clientID) {
+				if resume && clientID == pos.ClientID && topic.Name <= pos.TopicName {
+					continue
+				}
+				n++
+				c := cursor{System: v.system, ClientID: clientID, TopicName: topic.Name}
+				if !fn(clientID, topic) {
+					return encodeCursor(c), false
+				}
+				if options.Limit > 0 && n >= options.Limit {
+					return encodeCursor(c), false
+				}
+			}
+		}
+	}
+	return "", true
+}
@@ -0,0 +1,83 @@
+package trie
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// sampleBufferSize is the capacity of the ring buffer which holds the match samples.
+const sampleBufferSize = 1024
+
+// MatchedTopic represents the number of matched subscriptions of a topic.
+type MatchedTopic struct {
+	Topic string
+	Count int
+}
+
+// matchSampler records every Nth GetTopicMatched call into a bounded ring buffer.
+type matchSampler struct {
+	// calls must be the first field to guarantee 64-bit alignment for atomic operations.
+	calls uint64
+	every uint64
+
+	mu      sync.Mutex
+	samples [sampleBufferSize]MatchedTopic
+	next    int
+	full    bool
+}
+
+func newMatchSampler(every int) *matchSampler {
+	return &matchSampler{
+		every: uint64(every),
+	}
+}
+
+// shouldSample reports whether the current call should be sampled.
+func (m *matchSampler) shouldSample() bool {
+	return atomic.AddUint64(&m.calls, 1)%m.every == 0
+}
+
+func (m *matchSampler) record(topic string, count int) {
+	m.mu.Lock()
+	m.samples[m.next] = MatchedTopic{Topic: topic, Count: count}
+	m.next++
+	if m.next == sampleBufferSize {
+		m.next = 0
+		m.full = true
+	}
+	m.mu.Unlock()
+}
+
+// top returns the k topics with the highest matched count in the ring buffer.
+// If a topic is sampled multiple times, the highest count is used.
+func (m *matchSampler) top(k int) []MatchedTopic {
+	m.mu.Lock()
+	n := m.next
+	if m.full {
+		n = sampleBufferSize
+	}
+	counts := make(map[string]int)
+	for i := 0; i < n; i++ {
+		s := m.samples[i]
+		if c, ok := counts[s.Topic]; !ok || s.Count > c {
+			counts[s.Topic] = s.Count
+		}
+	}
+	m.mu.Unlock()
+
+	rs := make([]MatchedTopic, 0, len(counts))
+	for topic, count := range counts {
+		rs = append(rs, MatchedTopic{Topic: topic, Count: count})
+	}
+	sort.Slice(rs, func(i, j int) bool {
+		if rs[i].Count == rs[j].Count {
+			return rs[i].Topic < rs[j].Topic
+		}
+		return rs[i].Count > rs[j].Count
+	})
+	if k >= 0 && k < len(rs) {
+		rs = rs[:k]
+	}
+	return rs
+}
@@ -0,0 +1,281 @@
+package trie
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/DrmagicE/gmqtt/pkg/packets"
+	"github.com/DrmagicE/gmqtt/subscription"
+)
+
+// clientShards is the number of the shards of the client indexes, which must be a power of 2.
+const clientShards = 32
+
+// clientShard holds the subscriptions of the clients whose client id hashes into the shard.
+type clientShard struct {
+	sync.RWMutex
+	userIndex map[string]map[string]uint8 // [clientID][topicName]qos
+
+	// system topic which begin with "$"
+	systemIndex map[string]map[string]uint8 // [clientID][topicName]qos
+
+	// statistics of each client
+	clientStats map[string]*subscription.Stats // [clientID]
+	// clientVersions is the version of the latest change of each client's subscriptions.
+	clientVersions map[string]uint64 // [clientID]
+
+	// sortedMu guards the sorted client ids which are built with the read lock held.
+	sortedMu sync.Mutex
+	// userSorted and systemSorted are the sorted client ids of userIndex and systemIndex used by IterateFrom,
+	// they are reset with the write lock held when a client is added to or removed from the index.
+	userSorted, systemSorted []string
+}
+
+func (s *clientShard) init() {
+	s.userIndex = make(map[string]map[string]uint8)
+	s.systemIndex = make(map[string]map[string]uint8)
+	s.clientStats = make(map[string]*subscription.Stats)
+	s.clientVersions = make(map[string]uint64)
+}
+
+func (s *clientShard) getIndex(topicName string) map[string]map[string]uint8 {
+	if isSystemTopic(topicName) {
+		return s.systemIndex
+	}
+	return s.userIndex
+}
+
+// sortedClients returns the sorted client ids of the system or user index, the caller must hold the read lock.
+// The result is cached until the client ids of the index change, it must not be modified.
+func (s *clientShard) sortedClients(system bool) []string {
+	s.sortedMu.Lock()
+	defer s.sortedMu.Unlock()
+	index, sorted := s.userIndex, &s.userSorted
+	if system {
+		index, sorted = s.systemIndex, &s.systemSorted
+	}
+	if *sorted == nil {
+		ids := make([]string, 0, len(index))
+		for clientID := range index {
+			ids = append(ids, clientID)
+		}
+		sort.Strings(ids)
+		*sorted = ids
+	}
+	return *sorted
+}
+
+// resetSorted resets the sorted client ids of the system or user index, the caller must hold the write lock.
+func (s *clientShard) resetSorted(system bool) {
+	if system {
+		s.systemSorted = nil
+	} else {
+		s.userSorted = nil
+	}
+}
+
+// unchanged returns whether the client has already subscribed the topic with the same options.
+func (s *clientShard) unchanged(clientID string, topic packets.Topic) bool {
+	qos, ok := s.getIndex(topic.Name)[clientID][topic.Name]
+	return ok && qos == topic.Qos
+}
+
+// shardIndex returns the index of the shard of the client id by the FNV-1a hash.
+func shardIndex(clientID string) int {
+	h := uint32(2166136261)
+	for i := 0; i < len(clientID); i++ {
+		h ^= uint32(clientID[i])
+		h *= 16777619
+	}
+	return int(h & (clientShards - 1))
+}
+
+// branchTrie is the topic trie split by the first topic level. Each branch is a trie which holds the topic filters
+// of the same first level and is protected by its own lock, so the calls on the different first levels
+// do not contend with each other. Matching a topic name only locks the branches of its first level, "+" and "#".
+//
+// Lock order: branchTrie.mu before branch, the branch lock is never held while acquiring another branch lock.
+type branchTrie struct {
+	mu       sync.RWMutex
+	branches map[string]*branch
+}
+
+type branch struct {
+	sync.RWMutex
+	trie *topicTrie
+	// removed is set when the empty branch is removed from the branchTrie.
+	removed bool
+}
+
+func newBranchTrie() *branchTrie {
+	return &branchTrie{branches: make(map[string]*branch)}
+}
+
+// firstLevel returns the first level of the topic.
+func firstLevel(topic string) string {
+	if i := strings.IndexByte(topic, '/'); i >= 0 {
+		return topic[:i]
+	}
+	return topic
+}
+
+// branch returns the branch of the first level, nil if not exists.
+func (t *branchTrie) branch(lv string) *branch {
+	t.mu.RLock()
+	b := t.branches[lv]
+	t.mu.RUnlock()
+	return b
+}
+
+// snapshot returns all branches.
+func (t *branchTrie) snapshot() []*branch {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	rs := make([]*branch, 0, len(t.branches))
+	for _, b := range t.branches {
+		rs = append(rs, b)
+	}
+	return rs
+}
+
+// lockBranch returns the write locked branch of the first level, the branch is created if not exists.
+func (t *branchTrie) lockBranch(lv string) *branch {
+	for {
+		b := t.branch(lv)
+		if b == nil {
+			t.mu.Lock()
+			if b = t.branches[lv]; b == nil {
+				b = &branch{trie: newTopicTrie()}
+				t.branches[lv] = b
+			}
+			t.mu.Unlock()
+		}
+		b.Lock()
+		if !b.removed {
+			return b
+		}
+		// the branch has been removed after it was got, retry with the new one.
+		b.Unlock()
+	}
+}
+
+func (t *branchTrie) subscribe(clientID string, topic packets.Topic) {
+	b := t.lockBranch(firstLevel(topic.Name))
+	b.trie.subscribe(clientID, topic)
+	b.Unlock()
+}
+
+func (t *branchTrie) unsubscribe(clientID string, topicName string) {
+	lv := firstLevel(topicName)
+	b := t.branch(lv)
+	if b == nil {
+		return
+	}
+	b.Lock()
+	b.trie.unsubscribe(clientID, topicName)
+	empty := len(b.trie.children) == 0
+	b.Unlock()
+	if empty {
+		t.removeEmpty(lv, b)
+	}
+}
+
+// removeEmpty removes the branch if it is still empty.
+func (t *branchTrie) removeEmpty(lv string, b *branch) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	b.Lock()
+	defer b.Unlock()
+	if !b.removed && len(b.trie.children) == 0 && t.branches[lv] == b {
+		b.removed = true
+		delete(t.branches, lv)
+	}
+}
+
+// get returns the subscriptions of the topic filter, nil if not exists.
+func (t *branchTrie) get(topicFilter string) subscription.ClientTopics {
+	b := t.branch(firstLevel(topicFilter))
+	if b == nil {
+		return nil
+	}
+	b.RLock()
+	defer b.RUnlock()
+	node := b.trie.find(topicFilter)
+	if node == nil {
+		return nil
+	}
+	rs := make(subscription.ClientTopics)
+	for clientID, qos := range node.clients {
+		rs[clientID] = append(rs[clientID], packets.Topic{
+			Qos:  qos,
+			Name: node.topicName,
+		})
+	}
+	return rs
+}
+
+// getMatchedTopicFilter return a map key by clientID that contain all matched topic for the given topicName.
+func (t *branchTrie) getMatchedTopicFilter(topicName string) subscription.ClientTopics {
+	topicSlice := strings.Split(topicName, "/")
+	rs := make(subscription.ClientTopics)
+	// each branch only holds the child of its level, so matchTopic only walks through that child.
+	for _, lv := range [...]string{"#", "+", topicSlice[0]} {
+		if b := t.branch(lv); b != nil {
+			b.RLock()
+			b.trie.matchTopic(topicSlice, rs)
+			b.RUnlock()
+		}
+	}
+	return rs
+}
+
+// matchTopics is like topicTrie.matchTopics, topics[i] is the levels of the i-th topic and rs[i] is the result of it.
+func (t *branchTrie) matchTopics(topics [][]string, rs []subscription.ClientTopics) {
+	for _, lv := range [...]string{"#", "+"} {
+		if b := t.branch(lv); b != nil {
+			b.RLock()
+			b.trie.matchTopics(topics, rs)
+			b.RUnlock()
+		}
+	}
+	groups := make(map[string][]int)
+	for k, topicSlice := range topics {
+		groups[topicSlice[0]] = append(groups[topicSlice[0]], k)
+	}
+	for lv, group := range groups {
+		b := t.branch(lv)
+		if b == nil {
+			continue
+		}
+		gTopics := make([][]string, len(group))
+		gRs := make([]subscription.ClientTopics, len(group))
+		for k, i := range group {
+			gTopics[k] = topics[i]
+			gRs[k] = rs[i]
+		}
+		b.RLock()
+		b.trie.matchTopics(gTopics, gRs)
+		b.RUnlock()
+	}
+}
+
+func (t *branchTrie) preOrderTraverse(fn subscription.IterateFn) bool {
+	for _, b := range t.snapshot() {
+		b.RLock()
+		ok := b.trie.preOrderTraverse(fn)
+		b.RUnlock()
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func (t *branchTrie) treeStats(stats *TreeStats, levels map[string]struct{}) {
+	for _, b := range t.snapshot() {
+		b.RLock()
+		b.trie.treeStats(0, stats, levels)
+		b.RUnlock()
+	}
+}
@@ -136,6 +136,57 @@ func (t *topicTrie) matchTopic(topicSlice []string, rs subscription.ClientTopics
 	}
 }
 
+// matchTopics is like matchTopic, but matches multiple topics in one traversal.
+// The topics which share the same level at the current depth walk through the same child node together.
+// topics[i] is the remaining levels of the i-th topic and rs[i] is the result of it.
+func (t *topicTrie) matchTopics(topics [][]string, rs []subscription.ClientTopics) {
+	if cnode := t.children["#"]; cnode != nil {
+		for k := range topics {
+			setRs(cnode, rs[k])
+		}
+	}
+	if cnode := t.children["+"]; cnode != nil {
+		cnode.matchChild(topics, rs)
+	}
+	groups := make(map[string][]int)
+	for k, topicSlice := range topics {
+		groups[topicSlice[0]] = append(groups[topicSlice[0]], k)
+	}
+	for lv, group := range groups {
+		cnode := t.children[lv]
+		if cnode == nil {
+			continue
+		}
+		gTopics := make([][]string, len(group))
+		gRs := make([]subscription.ClientTopics, len(group))
+		for k, i := range group {
+			gTopics[k] = topics[i]
+			gRs[k] = rs[i]
+		}
+		cnode.matchChild(gTopics, gRs)
+	}
+}
+
+// matchChild matches the topics whose current level is matched by t.
+func (t *topicNode) matchChild(topics [][]string, rs []subscription.ClientTopics) {
+	var next [][]string
+	var nextRs []subscription.ClientTopics
+	for k, topicSlice := range topics {
+		if len(topicSlice) == 1 {
+			setRs(t, rs[k])
+			if n := t.children["#"]; n != nil {
+				setRs(n, rs[k])
+			}
+		} else {
+			next = append(next, topicSlice[1:])
+			nextRs = append(nextRs, rs[k])
+		}
+	}
+	if len(next) != 0 {
+		t.matchTopics(next, nextRs)
+	}
+}
+
 // getMatchedTopicFilter return a map key by clientID that contain all matched topic for the given topicName.
 func (t *topicTrie) getMatchedTopicFilter(topicName string) map[string][]packets.Topic {
 	topicLv := strings.Split(topicName, "/")
@@ -169,3 +220,16 @@ func (t *topicTrie) preOrderTraverse(fn subscription.IterateFn) bool {
 	}
 	return true
 }
+
+// treeStats walks through all nodes of the trie and collects the structural statistics into stats.
+// The distinct topic levels are recorded into levels.
+func (t *topicTrie) treeStats(depth int, stats *TreeStats, levels map[string]struct{}) {
+	for lv, c := range t.children {
+		stats.NodeCount++
+		levels[lv] = struct{}{}
+		if depth+1 > stats.MaxDepth {
+			stats.MaxDepth = depth + 1
+		}
+		c.treeStats(depth+1, stats, levels)
+	}
+}
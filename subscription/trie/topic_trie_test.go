@@ -72,14 +72,14 @@ var testSubscribeAndFind = struct {
 }{
 	subTopics: map[string][]packets.Topic{
 		"cid1": {
-			{packets.QOS_1, "t1/t2/+"},
-			{packets.QOS_2, "t1/t2/"},
-			{packets.QOS_0, "t1/t2/cid1"},
+			{Qos: packets.QOS_1, Name: "t1/t2/+"},
+			{Qos: packets.QOS_2, Name: "t1/t2/"},
+			{Qos: packets.QOS_0, Name: "t1/t2/cid1"},
 		},
 		"cid2": {
-			{packets.QOS_2, "t1/t2/+"},
-			{packets.QOS_1, "t1/t2/"},
-			{packets.QOS_0, "t1/t2/cid2"},
+			{Qos: packets.QOS_2, Name: "t1/t2/+"},
+			{Qos: packets.QOS_1, Name: "t1/t2/"},
+			{Qos: packets.QOS_0, Name: "t1/t2/cid2"},
 		},
 	},
 	findTopics: map[string][]struct { //key by clientID
@@ -112,12 +112,12 @@ var testUnsubscribe = struct {
 }{
 	subTopics: map[string][]packets.Topic{
 		"cid1": {
-			{packets.QOS_1, "t1/t2/t3"},
-			{packets.QOS_2, "t1/t2"},
+			{Qos: packets.QOS_1, Name: "t1/t2/t3"},
+			{Qos: packets.QOS_2, Name: "t1/t2"},
 		},
 		"cid2": {
-			{packets.QOS_2, "t1/t2/t3"},
-			{packets.QOS_1, "t1/t2"},
+			{Qos: packets.QOS_2, Name: "t1/t2/t3"},
+			{Qos: packets.QOS_1, Name: "t1/t2"},
 		},
 	},
 	unsubscribe: map[string][]string{
@@ -3,57 +3,140 @@ package trie
 import (
 	"errors"
 	"strings"
-	"sync"
+	"sync/atomic"
 
 	"github.com/DrmagicE/gmqtt/pkg/packets"
 	"github.com/DrmagicE/gmqtt/subscription"
 )
 
+var (
+	// ErrTooManyTopicLevels is returned in the SubscribeResult if the topic filter exceeds the WithMaxTopicLevels limit.
+	ErrTooManyTopicLevels = errors.New("too many topic levels")
+	// ErrTopicFilterTooLong is returned in the SubscribeResult if the topic filter exceeds the WithMaxFilterLength limit.
+	ErrTopicFilterTooLong = errors.New("topic filter too long")
+)
+
 // trieDB implement the subscription.Interface, it use trie tree  to store topics.
+// The locks are striped to reduce the contention: the subscriptions of the clients are indexed in the shards
+// by client id, and the topic tries are split by the first topic level, see branchTrie.
+// A call which changes the subscriptions of a client holds the lock of the client's shard,
+// so the calls of the same client are serialized.
 type trieDB struct {
-	sync.RWMutex
-	userIndex map[string]map[string]*topicNode // [clientID][topicName]
-	userTrie  *topicTrie
+	// version and stats must be the first fields to guarantee 64-bit alignment for atomic operations.
+	// version is increased on every change of the subscriptions.
+	version uint64
+	// statistics of the server
+	stats subscription.Stats
+
+	shards     [clientShards]clientShard
+	userTrie   *branchTrie
+	systemTrie *branchTrie
+
+	// sampler is nil if the match sampling is disabled.
+	sampler *matchSampler
+
+	// limits of the topic filters, 0 means no limit.
+	maxTopicLevels  int
+	maxFilterLength int
+}
+
+// Option is the option of the trieDB.
+type Option func(db *trieDB)
+
+// WithMatchSampling enables the match sampling.
+// Every Nth GetTopicMatched call records the topic name and the number of matched clients,
+// which can be retrieved by TopMatchedTopics.
+// The sampling is disabled if every <= 0.
+func WithMatchSampling(every int) Option {
+	return func(db *trieDB) {
+		if every > 0 {
+			db.sampler = newMatchSampler(every)
+		} else {
+			db.sampler = nil
+		}
+	}
+}
+
+// WithMaxTopicLevels sets the maximum number of levels of the topic filters,
+// Subscribe rejects the topic filters with more levels with ErrTooManyTopicLevels.
+// It also limits the depth of the matching: the topic names with more levels are not matched by any topic filters.
+// 0 means no limit.
+func WithMaxTopicLevels(n int) Option {
+	return func(db *trieDB) {
+		db.maxTopicLevels = n
+	}
+}
 
-	// system topic which begin with "$"
-	systemIndex map[string]map[string]*topicNode // [clientID][topicName]
-	systemTrie  *topicTrie
+// WithMaxFilterLength sets the maximum length in bytes of the topic filters,
+// Subscribe rejects the longer topic filters with ErrTopicFilterTooLong.
+// 0 means no limit.
+func WithMaxFilterLength(n int) Option {
+	return func(db *trieDB) {
+		db.maxFilterLength = n
+	}
+}
+
+// checkLimits returns an error if the topic filter exceeds the limits.
+func (db *trieDB) checkLimits(topicFilter string) error {
+	if db.maxFilterLength > 0 && len(topicFilter) > db.maxFilterLength {
+		return ErrTopicFilterTooLong
+	}
+	if db.exceedMaxLevels(topicFilter) {
+		return ErrTooManyTopicLevels
+	}
+	return nil
+}
 
-	// statistics of the server and each client
-	stats       subscription.Stats
-	clientStats map[string]*subscription.Stats // [clientID]
+// exceedMaxLevels returns whether the topic has more levels than the WithMaxTopicLevels limit.
+func (db *trieDB) exceedMaxLevels(topic string) bool {
+	return db.maxTopicLevels > 0 && strings.Count(topic, "/")+1 > db.maxTopicLevels
+}
 
+// TreeStats is the structural statistics of the topic trees in the store.
+type TreeStats struct {
+	// NodeCount is the number of nodes in the topic trees, root nodes are not counting.
+	NodeCount uint64
+	// MaxDepth is the number of levels of the deepest node.
+	MaxDepth int
+	// DistinctLevels is the number of distinct topic levels among all nodes.
+	DistinctLevels int
 }
 
-func (t *trieDB) getTrie(topicName string) *topicTrie {
+func (t *trieDB) getTrie(topicName string) *branchTrie {
 	if isSystemTopic(topicName) {
 		return t.systemTrie
 	}
 	return t.userTrie
 }
 
+// shard returns the shard of the client.
+func (db *trieDB) shard(clientID string) *clientShard {
+	return &db.shards[shardIndex(clientID)]
+}
+
 func (db *trieDB) GetClientSubscriptions(clientID string) []packets.Topic {
-	db.RLock()
-	defer db.RUnlock()
+	s := db.shard(clientID)
+	s.RLock()
+	defer s.RUnlock()
 	var rs []packets.Topic
-	for topicName, v := range db.userIndex[clientID] {
+	for topicName, qos := range s.userIndex[clientID] {
 		rs = append(rs, packets.Topic{
-			Qos:  v.clients[clientID],
+			Qos:  qos,
 			Name: topicName,
 		})
 	}
-	for topicName, v := range db.systemIndex[clientID] {
+	for topicName, qos := range s.systemIndex[clientID] {
 		rs = append(rs, packets.Topic{
-			Qos:  v.clients[clientID],
+			Qos:  qos,
 			Name: topicName,
 		})
 	}
 	return rs
 }
 
+// Iterate iterates all subscriptions. Each branch of the topic tries is locked during the iteration of it,
+// so the iteration is weakly consistent if the store is modified concurrently.
 func (db *trieDB) Iterate(fn subscription.IterateFn) {
-	db.RLock()
-	defer db.RUnlock()
 	if !db.userTrie.preOrderTraverse(fn) {
 		return
 	}
@@ -61,15 +144,28 @@ func (db *trieDB) Iterate(fn subscription.IterateFn) {
 }
 
 func (db *trieDB) GetStats() subscription.Stats {
-	db.RLock()
-	defer db.RUnlock()
-	return db.stats
+	return subscription.Stats{
+		SubscriptionsTotal:   atomic.LoadUint64(&db.stats.SubscriptionsTotal),
+		SubscriptionsCurrent: atomic.LoadUint64(&db.stats.SubscriptionsCurrent),
+	}
+}
+
+// GetTreeStats returns the structural statistics of the topic trees.
+// It walks through the trie nodes only, the subscriptions of each node are not visited.
+func (db *trieDB) GetTreeStats() TreeStats {
+	var stats TreeStats
+	levels := make(map[string]struct{})
+	db.userTrie.treeStats(&stats, levels)
+	db.systemTrie.treeStats(&stats, levels)
+	stats.DistinctLevels = len(levels)
+	return stats
 }
 
 func (db *trieDB) GetClientStats(clientID string) (subscription.Stats, error) {
-	db.RLock()
-	defer db.RUnlock()
-	if stats, ok := db.clientStats[clientID]; !ok {
+	s := db.shard(clientID)
+	s.RLock()
+	defer s.RUnlock()
+	if stats, ok := s.clientStats[clientID]; !ok {
 		return subscription.Stats{}, errors.New("client not exists")
 	} else {
 		return *stats, nil
@@ -77,89 +173,206 @@ func (db *trieDB) GetClientStats(clientID string) (subscription.Stats, error) {
 }
 
 func (db *trieDB) Get(topicFilter string) subscription.ClientTopics {
-	db.RLock()
-	defer db.RUnlock()
-	node := db.getTrie(topicFilter).find(topicFilter)
-	if node != nil {
-		rs := make(subscription.ClientTopics)
-		for clientID, qos := range node.clients {
-			rs[clientID] = append(rs[clientID], packets.Topic{
-				Qos:  qos,
-				Name: node.topicName,
-			})
+	return db.getTrie(topicFilter).get(topicFilter)
+}
+
+func (db *trieDB) GetTopicMatched(topicName string) subscription.ClientTopics {
+	if db.exceedMaxLevels(topicName) {
+		return make(subscription.ClientTopics)
+	}
+	rs := db.getTrie(topicName).getMatchedTopicFilter(topicName)
+	if db.sampler != nil && db.sampler.shouldSample() {
+		db.sampler.record(topicName, len(rs))
+	}
+	return rs
+}
+
+// GetTopicMatchedDetailed is like GetTopicMatched,
+// but also returns the matched topic name and the specificity of each subscription.
+func (db *trieDB) GetTopicMatchedDetailed(topicName string) subscription.MatchedClientTopics {
+	return subscription.NewMatchedClientTopics(topicName, db.GetTopicMatched(topicName))
+}
+
+// GetTopicMatchedMulti returns the subscriptions that match each of the topic names, key by topic name.
+// The topic names are matched in one traversal of the trie, the duplicated topic names are matched once.
+// The t restricts the type of the topic filters to be matched.
+func (db *trieDB) GetTopicMatchedMulti(topicNames []string, t subscription.Type) map[string]subscription.ClientTopics {
+	rs := make(map[string]subscription.ClientTopics, len(topicNames))
+	var userTopics, systemTopics [][]string
+	var userRs, systemRs []subscription.ClientTopics
+	for _, topicName := range topicNames {
+		if _, ok := rs[topicName]; ok {
+			continue
+		}
+		ct := make(subscription.ClientTopics)
+		rs[topicName] = ct
+		if db.exceedMaxLevels(topicName) {
+			continue
+		}
+		if !t.Match(topicName) {
+			// system topics can only be matched by system topic filters, and vice versa.
+			continue
+		}
+		if isSystemTopic(topicName) {
+			systemTopics = append(systemTopics, strings.Split(topicName, "/"))
+			systemRs = append(systemRs, ct)
+		} else {
+			userTopics = append(userTopics, strings.Split(topicName, "/"))
+			userRs = append(userRs, ct)
 		}
-		return rs
 	}
-	return nil
+	if len(userTopics) != 0 {
+		db.userTrie.matchTopics(userTopics, userRs)
+	}
+	if len(systemTopics) != 0 {
+		db.systemTrie.matchTopics(systemTopics, systemRs)
+	}
+	return rs
 }
 
-func (db *trieDB) GetTopicMatched(topicName string) subscription.ClientTopics {
-	db.RLock()
-	defer db.RUnlock()
-	return db.getTrie(topicName).getMatchedTopicFilter(topicName)
+// TopMatchedTopics returns the k sampled topics with the most matched clients in descending order.
+// It returns nil if the match sampling is disabled, see WithMatchSampling.
+func (db *trieDB) TopMatchedTopics(k int) []MatchedTopic {
+	if db.sampler == nil {
+		return nil
+	}
+	return db.sampler.top(k)
 }
 
 // NewStore create a new trieDB instance
-func NewStore() *trieDB {
-	return &trieDB{
-		userIndex: make(map[string]map[string]*topicNode),
-		userTrie:  newTopicTrie(),
-
-		systemIndex: make(map[string]map[string]*topicNode),
-		systemTrie:  newTopicTrie(),
+func NewStore(opts ...Option) *trieDB {
+	db := &trieDB{
+		userTrie:   newBranchTrie(),
+		systemTrie: newBranchTrie(),
+	}
+	for i := range db.shards {
+		db.shards[i].init()
+	}
+	for _, fn := range opts {
+		fn(db)
+	}
+	return db
+}
 
-		clientStats: make(map[string]*subscription.Stats),
+// allUnchanged returns the result if all topics are unchanged, otherwise returns nil.
+func (db *trieDB) allUnchanged(clientID string, topics []packets.Topic) subscription.SubscribeResult {
+	s := db.shard(clientID)
+	s.RLock()
+	defer s.RUnlock()
+	for _, topic := range topics {
+		if !s.unchanged(clientID, topic) {
+			return nil
+		}
+	}
+	rs := make(subscription.SubscribeResult, len(topics))
+	for k, topic := range topics {
+		rs[k].Topic = topic
+		rs[k].AlreadyExisted = true
+		rs[k].Unchanged = true
 	}
+	return rs
 }
 
 // Subscribe add subscriptions
 func (db *trieDB) Subscribe(clientID string, topics ...packets.Topic) subscription.SubscribeResult {
-	db.Lock()
-	defer db.Unlock()
-	var node *topicNode
-	var index map[string]map[string]*topicNode
+	// fast path for resubscribing with the same options, which only requires the read lock.
+	if rs := db.allUnchanged(clientID, topics); rs != nil {
+		return rs
+	}
+	s := db.shard(clientID)
+	s.Lock()
+	defer s.Unlock()
 	rs := make(subscription.SubscribeResult, len(topics))
 	for k, topic := range topics {
 		rs[k].Topic = topic
-		if isSystemTopic(topic.Name) {
-			node = db.systemTrie.subscribe(clientID, topic)
-			index = db.systemIndex
-		} else {
-			node = db.userTrie.subscribe(clientID, topic)
-			index = db.userIndex
+		if err := db.checkLimits(topic.Name); err != nil {
+			rs[k].Err = err
+			continue
+		}
+		if s.unchanged(clientID, topic) {
+			rs[k].AlreadyExisted = true
+			rs[k].Unchanged = true
+			continue
 		}
+		db.getTrie(topic.Name).subscribe(clientID, topic)
+		index := s.getIndex(topic.Name)
 		if index[clientID] == nil {
-			index[clientID] = make(map[string]*topicNode)
-			db.clientStats[clientID] = &subscription.Stats{}
+			index[clientID] = make(map[string]uint8)
+			s.clientStats[clientID] = &subscription.Stats{}
+			s.resetSorted(isSystemTopic(topic.Name))
 		}
 		if _, ok := index[clientID][topic.Name]; !ok {
-			db.stats.SubscriptionsTotal++
-			db.stats.SubscriptionsCurrent++
-			db.clientStats[clientID].SubscriptionsTotal++
-			db.clientStats[clientID].SubscriptionsCurrent++
+			atomic.AddUint64(&db.stats.SubscriptionsTotal, 1)
+			atomic.AddUint64(&db.stats.SubscriptionsCurrent, 1)
+			s.clientStats[clientID].SubscriptionsTotal++
+			s.clientStats[clientID].SubscriptionsCurrent++
 		} else {
 			rs[k].AlreadyExisted = true
 		}
-		index[clientID][topic.Name] = node
+		index[clientID][topic.Name] = topic.Qos
+		db.bumpVersion(s, clientID)
+	}
+	return rs
+}
+
+// bumpVersion marks the subscriptions of the client as changed, the caller must hold the lock of the shard.
+func (db *trieDB) bumpVersion(s *clientShard, clientID string) {
+	s.clientVersions[clientID] = atomic.AddUint64(&db.version, 1)
+}
+
+// ClientSubscriptionVersion returns the version of the client's subscriptions.
+// The version is monotonically increasing, it changes when Subscribe, Unsubscribe or UnsubscribeAll
+// actually change the subscriptions of the client.
+// The bool is false if the client is unknown, including the client which has been removed by UnsubscribeAll.
+func (db *trieDB) ClientSubscriptionVersion(clientID string) (uint64, bool) {
+	s := db.shard(clientID)
+	s.RLock()
+	defer s.RUnlock()
+	v, ok := s.clientVersions[clientID]
+	return v, ok
+}
+
+// SubscribeDryRun returns the result that Subscribe would return for the same arguments,
+// without modifying the store and the statistics.
+func (db *trieDB) SubscribeDryRun(clientID string, topics ...packets.Topic) subscription.SubscribeResult {
+	s := db.shard(clientID)
+	s.RLock()
+	defer s.RUnlock()
+	rs := make(subscription.SubscribeResult, len(topics))
+	// the topics which would be subscribed by the previous topics in this call, [topicName]qos
+	pending := make(map[string]uint8)
+	for k, topic := range topics {
+		rs[k].Topic = topic
+		if err := db.checkLimits(topic.Name); err != nil {
+			rs[k].Err = err
+			continue
+		}
+		if qos, ok := pending[topic.Name]; ok {
+			rs[k].AlreadyExisted = true
+			rs[k].Unchanged = qos == topic.Qos
+		} else if s.unchanged(clientID, topic) {
+			rs[k].AlreadyExisted = true
+			rs[k].Unchanged = true
+		} else {
+			_, rs[k].AlreadyExisted = s.getIndex(topic.Name)[clientID][topic.Name]
+		}
+		pending[topic.Name] = topic.Qos
 	}
 	return rs
 }
 
 // Unsubscribe remove  subscriptions
 func (db *trieDB) Unsubscribe(clientID string, topics ...string) {
-	db.Lock()
-	defer db.Unlock()
-	var index map[string]map[string]*topicNode
+	s := db.shard(clientID)
+	s.Lock()
+	defer s.Unlock()
 	for _, topic := range topics {
-		if isSystemTopic(topic) {
-			index = db.systemIndex
-		} else {
-			index = db.userIndex
-		}
+		index := s.getIndex(topic)
 		if _, ok := index[clientID]; ok {
 			if _, ok := index[clientID][topic]; ok {
-				db.stats.SubscriptionsCurrent--
-				db.clientStats[clientID].SubscriptionsCurrent--
+				atomic.AddUint64(&db.stats.SubscriptionsCurrent, ^uint64(0))
+				s.clientStats[clientID].SubscriptionsCurrent--
+				db.bumpVersion(s, clientID)
 			}
 			delete(index[clientID], topic)
 		}
@@ -168,28 +381,35 @@ func (db *trieDB) Unsubscribe(clientID string, topics ...string) {
 
 }
 
-func (db *trieDB) unsubscribeAll(index map[string]map[string]*topicNode, clientID string) {
-	db.stats.SubscriptionsCurrent -= uint64(len(index[clientID]))
-	if db.clientStats[clientID] != nil {
-		db.clientStats[clientID].SubscriptionsCurrent -= uint64(len(index[clientID]))
+func (db *trieDB) unsubscribeAll(s *clientShard, index map[string]map[string]uint8, trie *branchTrie, clientID string) {
+	n := uint64(len(index[clientID]))
+	if n != 0 {
+		atomic.AddUint64(&db.stats.SubscriptionsCurrent, ^uint64(n-1))
 	}
-	for topicName, node := range index[clientID] {
-		delete(node.clients, clientID)
-		if len(node.clients) == 0 && len(node.children) == 0 {
-			ss := strings.Split(topicName, "/")
-			delete(node.parent.children, ss[len(ss)-1])
-		}
+	if s.clientStats[clientID] != nil {
+		s.clientStats[clientID].SubscriptionsCurrent -= n
+	}
+	for topicName := range index[clientID] {
+		trie.unsubscribe(clientID, topicName)
 	}
 	delete(index, clientID)
 }
 
 // UnsubscribeAll delete all subscriptions of the client
 func (db *trieDB) UnsubscribeAll(clientID string) {
-	db.Lock()
-	defer db.Unlock()
+	s := db.shard(clientID)
+	s.Lock()
+	defer s.Unlock()
+	if _, ok := s.userIndex[clientID]; ok {
+		s.resetSorted(false)
+	}
+	if _, ok := s.systemIndex[clientID]; ok {
+		s.resetSorted(true)
+	}
 	// user topics
-	db.unsubscribeAll(db.userIndex, clientID)
-	db.unsubscribeAll(db.systemIndex, clientID)
+	db.unsubscribeAll(s, s.userIndex, db.userTrie, clientID)
+	db.unsubscribeAll(s, s.systemIndex, db.systemTrie, clientID)
+	delete(s.clientVersions, clientID)
 }
 
 // getMatchedTopicFilter return a map key by clientID that contain all matched topic for the given topicName.
@@ -1,6 +1,10 @@
 package trie
 
 import (
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -35,9 +39,10 @@ func TestTrieDB_UnsubscribeAll(t *testing.T) {
 			}
 			continue
 		}
-		got := db.userIndex[v.clientID][v.topic.Name]
-		a.Equal(got.topicName, v.topic.Name)
-		a.Equal(got.clients[v.clientID], v.topic.Qos)
+		a.Equal(v.topic.Qos, db.shard(v.clientID).userIndex[v.clientID][v.topic.Name])
+		got := db.Get(v.topic.Name)[v.clientID]
+		a.Equal(got[0].Name, v.topic.Name)
+		a.Equal(got[0].Qos, v.topic.Qos)
 
 		rs := db.getMatchedTopicFilter(v.topic.Name)
 		a.Equal(rs[v.clientID][0].Qos, v.topic.Qos)
@@ -213,7 +218,7 @@ func TestTrieDB_GetStats(t *testing.T) {
 	a.EqualValues(len(tt), stats.SubscriptionsCurrent)
 
 	// If subscribe duplicated topic, total and current statistics should not increase
-	db.Subscribe("id0", packets.Topic{packets.QOS_0, "name0"})
+	db.Subscribe("id0", packets.Topic{Qos: packets.QOS_0, Name: "name0"})
 	stats = db.GetStats()
 	a.EqualValues(len(tt), stats.SubscriptionsTotal)
 	a.EqualValues(len(tt), stats.SubscriptionsCurrent)
@@ -298,3 +303,457 @@ func TestTrieDB_GetClientSubscriptions(t *testing.T) {
 	rs = db.GetClientSubscriptions("id5")
 	a.Nil(rs)
 }
+
+func TestTrieDB_GetTreeStats(t *testing.T) {
+	a := assert.New(t)
+	db := NewStore()
+	a.Equal(TreeStats{}, db.GetTreeStats())
+
+	db.Subscribe("id0", packets.Topic{Name: "a/b/c", Qos: packets.QOS_0})
+	db.Subscribe("id1", packets.Topic{Name: "a/+/c", Qos: packets.QOS_1})
+	db.Subscribe("id2", packets.Topic{Name: "a/#", Qos: packets.QOS_2})
+	db.Subscribe("id2", packets.Topic{Name: "$SYS/b/c/d", Qos: packets.QOS_2})
+
+	// user trie: a, a/b, a/b/c, a/+, a/+/c, a/#
+	// system trie: $SYS, $SYS/b, $SYS/b/c, $SYS/b/c/d
+	a.Equal(TreeStats{
+		NodeCount:      10,
+		MaxDepth:       4,
+		DistinctLevels: 7, // a, b, c, +, #, $SYS, d
+	}, db.GetTreeStats())
+
+	db.UnsubscribeAll("id2")
+	stats := db.GetTreeStats()
+	a.EqualValues(3, stats.MaxDepth)
+}
+
+func TestTrieDB_TopMatchedTopics(t *testing.T) {
+	a := assert.New(t)
+	db := NewStore()
+	db.GetTopicMatched("a/b")
+	a.Nil(db.TopMatchedTopics(10))
+
+	db = NewStore(WithMatchSampling(2))
+	db.Subscribe("id0", packets.Topic{Name: "a/#", Qos: packets.QOS_0})
+	db.Subscribe("id1", packets.Topic{Name: "a/+", Qos: packets.QOS_1})
+	db.Subscribe("id2", packets.Topic{Name: "a/b", Qos: packets.QOS_2})
+	db.Subscribe("id3", packets.Topic{Name: "c", Qos: packets.QOS_2})
+
+	// only the calls with an even sequence number are sampled.
+	for _, topic := range []string{"x", "a/b", "x", "c", "x", "a/c"} {
+		db.GetTopicMatched(topic)
+	}
+	a.Equal([]MatchedTopic{
+		{Topic: "a/b", Count: 3},
+		{Topic: "a/c", Count: 2},
+		{Topic: "c", Count: 1},
+	}, db.TopMatchedTopics(10))
+	a.Equal([]MatchedTopic{
+		{Topic: "a/b", Count: 3},
+	}, db.TopMatchedTopics(1))
+
+	// the ring buffer is bounded.
+	for i := 0; i < sampleBufferSize*2; i++ {
+		db.GetTopicMatched("x")
+	}
+	a.Equal([]MatchedTopic{
+		{Topic: "x", Count: 0},
+	}, db.TopMatchedTopics(10))
+}
+
+func TestTrieDB_GetTopicMatchedDetailed(t *testing.T) {
+	a := assert.New(t)
+	db := NewStore()
+	db.Subscribe("id0",
+		packets.Topic{Name: "a/#", Qos: packets.QOS_0},
+		packets.Topic{Name: "a/b/c", Qos: packets.QOS_1},
+		packets.Topic{Name: "a/+/c", Qos: packets.QOS_2},
+	)
+	db.Subscribe("id1", packets.Topic{Name: "+/+/+", Qos: packets.QOS_1})
+	db.Subscribe("id2", packets.Topic{Name: "a/b", Qos: packets.QOS_1})
+
+	rs := db.GetTopicMatchedDetailed("a/b/c")
+	a.Len(rs, 2)
+	a.Equal([]subscription.MatchedSubscription{
+		{Topic: packets.Topic{Name: "a/b/c", Qos: packets.QOS_1}, TopicName: "a/b/c", Exact: true, Specificity: 3},
+		{Topic: packets.Topic{Name: "a/+/c", Qos: packets.QOS_2}, TopicName: "a/b/c", Specificity: 2},
+		{Topic: packets.Topic{Name: "a/#", Qos: packets.QOS_0}, TopicName: "a/b/c", Specificity: 1},
+	}, rs["id0"])
+	a.Equal([]subscription.MatchedSubscription{
+		{Topic: packets.Topic{Name: "+/+/+", Qos: packets.QOS_1}, TopicName: "a/b/c", Specificity: 0},
+	}, rs["id1"])
+}
+
+func TestTrieDB_Subscribe_Unchanged(t *testing.T) {
+	a := assert.New(t)
+	db := NewStore()
+	rs := db.Subscribe("id0", packets.Topic{Name: "a", Qos: packets.QOS_1})
+	a.False(rs[0].AlreadyExisted)
+	a.False(rs[0].Unchanged)
+
+	rs = db.Subscribe("id0", packets.Topic{Name: "a", Qos: packets.QOS_1})
+	a.True(rs[0].AlreadyExisted)
+	a.True(rs[0].Unchanged)
+
+	rs = db.Subscribe("id0",
+		packets.Topic{Name: "a", Qos: packets.QOS_1},
+		packets.Topic{Name: "a", Qos: packets.QOS_2},
+		packets.Topic{Name: "b", Qos: packets.QOS_2},
+	)
+	a.True(rs[0].AlreadyExisted)
+	a.True(rs[0].Unchanged)
+	a.True(rs[1].AlreadyExisted)
+	a.False(rs[1].Unchanged)
+	a.False(rs[2].AlreadyExisted)
+	a.False(rs[2].Unchanged)
+
+	a.Equal(packets.QOS_2, db.Get("a")["id0"][0].Qos)
+	a.Equal(subscription.Stats{SubscriptionsTotal: 2, SubscriptionsCurrent: 2}, db.GetStats())
+}
+
+func TestTrieDB_SubscribeDryRun(t *testing.T) {
+	a := assert.New(t)
+	db := NewStore()
+	db.Subscribe("id0", packets.Topic{Name: "a", Qos: packets.QOS_1}, packets.Topic{Name: "$SYS/a", Qos: packets.QOS_1})
+	stats := db.GetStats()
+	clientStats, err := db.GetClientStats("id0")
+	a.Nil(err)
+
+	topics := []packets.Topic{
+		{Name: "a", Qos: packets.QOS_1},
+		{Name: "$SYS/a", Qos: packets.QOS_2},
+		{Name: "b", Qos: packets.QOS_0},
+		{Name: "b", Qos: packets.QOS_0},
+		{Name: "b", Qos: packets.QOS_1},
+	}
+	rs := db.SubscribeDryRun("id0", topics...)
+	a.Equal(stats, db.GetStats())
+	cs, err := db.GetClientStats("id0")
+	a.Nil(err)
+	a.Equal(clientStats, cs)
+	a.Nil(db.Get("b"))
+	a.Equal(packets.QOS_1, db.Get("$SYS/a")["id0"][0].Qos)
+
+	dbCopy := NewStore()
+	dbCopy.Subscribe("id0", packets.Topic{Name: "a", Qos: packets.QOS_1}, packets.Topic{Name: "$SYS/a", Qos: packets.QOS_1})
+	a.Equal(dbCopy.Subscribe("id0", topics...), rs)
+
+	_, err = db.GetClientStats("id1")
+	db.SubscribeDryRun("id1", packets.Topic{Name: "a", Qos: packets.QOS_1})
+	_, err2 := db.GetClientStats("id1")
+	a.Equal(err, err2)
+}
+
+func TestTrieDB_IterateFrom(t *testing.T) {
+	a := assert.New(t)
+	db := NewStore()
+	db.Subscribe("id0", packets.Topic{Name: "a", Qos: packets.QOS_0}, packets.Topic{Name: "b", Qos: packets.QOS_1})
+	db.Subscribe("id1", packets.Topic{Name: "a/#", Qos: packets.QOS_2}, packets.Topic{Name: "$SYS/a", Qos: packets.QOS_1})
+	db.Subscribe("id2", packets.Topic{Name: "c", Qos: packets.QOS_1}, packets.Topic{Name: "$SYS/b", Qos: packets.QOS_2})
+
+	iterateAll := func(options subscription.IterationOptions) (rs []string, calls int) {
+		var token subscription.Cursor
+		for {
+			calls++
+			next, done := db.IterateFrom(func(clientID string, topic packets.Topic) bool {
+				rs = append(rs, clientID+":"+topic.Name)
+				return true
+			}, options, token)
+			if done {
+				return
+			}
+			token = next
+		}
+	}
+	all := []string{"id0:a", "id0:b", "id1:a/#", "id2:c", "id1:$SYS/a", "id2:$SYS/b"}
+	rs, calls := iterateAll(subscription.IterationOptions{})
+	a.Equal(all, rs)
+	a.Equal(1, calls)
+	rs, calls = iterateAll(subscription.IterationOptions{Limit: 2})
+	a.Equal(all, rs)
+	a.Equal(4, calls)
+	rs, _ = iterateAll(subscription.IterationOptions{Type: subscription.TypeSYS, Limit: 1})
+	a.Equal([]string{"id1:$SYS/a", "id2:$SYS/b"}, rs)
+	rs, _ = iterateAll(subscription.IterationOptions{Type: subscription.TypeNonSYS, ClientID: "id0", Limit: 1})
+	a.Equal([]string{"id0:a", "id0:b"}, rs)
+
+	// stop by fn
+	var got []string
+	next, done := db.IterateFrom(func(clientID string, topic packets.Topic) bool {
+		got = append(got, clientID+":"+topic.Name)
+		return len(got) < 3
+	}, subscription.IterationOptions{}, "")
+	a.False(done)
+	a.Equal(all[:3], got)
+
+	// modify the store between calls
+	db.Subscribe("id0", packets.Topic{Name: "z", Qos: packets.QOS_0}) // before the cursor, missed
+	db.Subscribe("id3", packets.Topic{Name: "d", Qos: packets.QOS_0}) // after the cursor
+	db.Unsubscribe("id2", "c")
+	next, done = db.IterateFrom(func(clientID string, topic packets.Topic) bool {
+		got = append(got, clientID+":"+topic.Name)
+		return true
+	}, subscription.IterationOptions{}, next)
+	a.True(done)
+	a.Equal(subscription.Cursor(""), next)
+	a.Equal([]string{"id0:a", "id0:b", "id1:a/#", "id3:d", "id1:$SYS/a", "id2:$SYS/b"}, got)
+
+	// invalid cursor
+	_, done = db.IterateFrom(func(clientID string, topic packets.Topic) bool {
+		t.Fatalf("unexpected call")
+		return true
+	}, subscription.IterationOptions{}, "!invalid")
+	a.True(done)
+}
+
+func TestTrieDB_IterateFrom_Concurrent(t *testing.T) {
+	a := assert.New(t)
+	db := NewStore()
+	for i := 0; i < 100; i++ {
+		db.Subscribe("stable"+strconv.Itoa(i), packets.Topic{Name: "a", Qos: packets.QOS_1})
+	}
+	// the sorted client ids are cached until the clients change.
+	s := db.shard("stable0")
+	s.RLock()
+	ids := s.sortedClients(false)
+	a.Equal(ids, s.sortedClients(false))
+	s.RUnlock()
+	db.Subscribe("stable0", packets.Topic{Name: "b", Qos: packets.QOS_1})
+	s.RLock()
+	a.NotNil(s.userSorted)
+	s.RUnlock()
+	db.UnsubscribeAll("stable0")
+	s.RLock()
+	a.Nil(s.userSorted)
+	s.RUnlock()
+	db.Subscribe("stable0", packets.Topic{Name: "a", Qos: packets.QOS_1})
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			id := "tmp" + strconv.Itoa(i%10)
+			db.Subscribe(id, packets.Topic{Name: "a", Qos: packets.QOS_1})
+			db.UnsubscribeAll(id)
+		}
+	}()
+	var token subscription.Cursor
+	visited := make(map[string]int)
+	for {
+		next, done := db.IterateFrom(func(clientID string, topic packets.Topic) bool {
+			// fn is called with no lock held.
+			db.GetClientSubscriptions(clientID)
+			visited[clientID]++
+			return true
+		}, subscription.IterationOptions{Limit: 7}, token)
+		if done {
+			break
+		}
+		token = next
+	}
+	close(stop)
+	wg.Wait()
+	for i := 0; i < 100; i++ {
+		a.Equal(1, visited["stable"+strconv.Itoa(i)])
+	}
+}
+
+func TestTrieDB_NoAliasing(t *testing.T) {
+	a := assert.New(t)
+	db := NewStore()
+	topics := []packets.Topic{{Name: "a", Qos: packets.QOS_1}}
+	rs := db.Subscribe("id0", topics...)
+	topics[0].Qos = packets.QOS_2
+	topics[0].Name = "b"
+	rs[0].Topic.Qos = packets.QOS_0
+
+	a.Equal([]packets.Topic{{Name: "a", Qos: packets.QOS_1}}, db.GetClientSubscriptions("id0"))
+	got := db.GetClientSubscriptions("id0")
+	got[0].Qos = packets.QOS_0
+	a.Equal([]packets.Topic{{Name: "a", Qos: packets.QOS_1}}, db.GetClientSubscriptions("id0"))
+	matched := db.GetTopicMatched("a")
+	matched["id0"][0].Qos = packets.QOS_0
+	a.Equal(packets.QOS_1, db.Get("a")["id0"][0].Qos)
+}
+
+func TestTrieDB_ClientSubscriptionVersion(t *testing.T) {
+	a := assert.New(t)
+	db := NewStore()
+	_, ok := db.ClientSubscriptionVersion("id0")
+	a.False(ok)
+
+	db.Subscribe("id0", packets.Topic{Name: "a", Qos: packets.QOS_1})
+	v1, ok := db.ClientSubscriptionVersion("id0")
+	a.True(ok)
+
+	// unchanged
+	db.Subscribe("id0", packets.Topic{Name: "a", Qos: packets.QOS_1})
+	db.Unsubscribe("id0", "not_exist")
+	db.Subscribe("id1", packets.Topic{Name: "a", Qos: packets.QOS_1})
+	v, _ := db.ClientSubscriptionVersion("id0")
+	a.Equal(v1, v)
+
+	db.Subscribe("id0", packets.Topic{Name: "a", Qos: packets.QOS_2})
+	v2, _ := db.ClientSubscriptionVersion("id0")
+	a.True(v2 > v1)
+
+	db.Unsubscribe("id0", "a")
+	v3, ok := db.ClientSubscriptionVersion("id0")
+	a.True(ok)
+	a.True(v3 > v2)
+
+	db.Subscribe("id0", packets.Topic{Name: "$SYS/a", Qos: packets.QOS_2})
+	db.UnsubscribeAll("id0")
+	_, ok = db.ClientSubscriptionVersion("id0")
+	a.False(ok)
+	db.Subscribe("id0", packets.Topic{Name: "a", Qos: packets.QOS_1})
+	v4, ok := db.ClientSubscriptionVersion("id0")
+	a.True(ok)
+	a.True(v4 > v3)
+}
+
+func TestTrieDB_Limits(t *testing.T) {
+	a := assert.New(t)
+	db := NewStore(WithMaxTopicLevels(3), WithMaxFilterLength(10))
+	rs := db.Subscribe("id0",
+		packets.Topic{Name: "a/b/c", Qos: packets.QOS_1},
+		packets.Topic{Name: "a/b/c/d", Qos: packets.QOS_1},
+		packets.Topic{Name: "abcdefghijk", Qos: packets.QOS_1},
+		packets.Topic{Name: "a/#", Qos: packets.QOS_1},
+	)
+	a.Nil(rs[0].Err)
+	a.Equal(ErrTooManyTopicLevels, rs[1].Err)
+	a.Equal(ErrTopicFilterTooLong, rs[2].Err)
+	a.Nil(rs[3].Err)
+	a.Equal(rs[1:3], db.SubscribeDryRun("id0", rs[1].Topic, rs[2].Topic))
+	a.Equal(subscription.Stats{SubscriptionsTotal: 2, SubscriptionsCurrent: 2}, db.GetStats())
+	a.Nil(db.Get("a/b/c/d"))
+
+	a.Len(db.GetTopicMatched("a/b/c")["id0"], 2)
+	// the topic name exceeds the max levels
+	a.Len(db.GetTopicMatched("a/b/c/d"), 0)
+	a.Len(db.GetTopicMatchedMulti([]string{"a/b/c/d"}, subscription.TypeAll)["a/b/c/d"], 0)
+}
+
+// TestTrieDB_RandomDeepTopics feeds random deep topics and topic filters to the store
+// to make sure that the matching neither overflows the stack nor blows up.
+// matchWork returns the number of the nodes visited and the depth of the recursion
+// when matching the user topic name, it walks through the trie as topicTrie.matchTopic does.
+func matchWork(db *trieDB, topicName string) (visits, depth int) {
+	var walk func(t *topicNode, topicSlice []string, d int)
+	walk = func(t *topicNode, topicSlice []string, d int) {
+		for _, lv := range [...]string{"#", "+", topicSlice[0]} {
+			cnode := t.children[lv]
+			if cnode == nil {
+				continue
+			}
+			visits++
+			if d > depth {
+				depth = d
+			}
+			if lv != "#" && len(topicSlice) > 1 {
+				walk(cnode, topicSlice[1:], d+1)
+			}
+		}
+	}
+	topicSlice := strings.Split(topicName, "/")
+	for _, lv := range [...]string{"#", "+", topicSlice[0]} {
+		if b := db.userTrie.branch(lv); b != nil {
+			walk(b.trie, topicSlice, 1)
+		}
+	}
+	return visits, depth
+}
+
+func TestTrieDB_RandomDeepTopics(t *testing.T) {
+	a := assert.New(t)
+	const maxLevels = 64
+	db := NewStore(WithMaxTopicLevels(maxLevels), WithMaxFilterLength(4096))
+	r := rand.New(rand.NewSource(1))
+	randTopic := func(wildcard bool) string {
+		n := 1 + r.Intn(maxLevels*4)
+		lvs := make([]string, n)
+		for i := range lvs {
+			switch x := r.Intn(10); {
+			case wildcard && x == 0:
+				lvs[i] = "+"
+			case x < 5:
+				lvs[i] = "a"
+			default:
+				lvs[i] = strconv.Itoa(x)
+			}
+		}
+		if wildcard && r.Intn(2) == 0 {
+			lvs[n-1] = "#"
+		}
+		return strings.Join(lvs, "/")
+	}
+	var accepted uint64
+	for i := 0; i < 2000; i++ {
+		filter := randTopic(true)
+		rs := db.Subscribe("id"+strconv.Itoa(i%10), packets.Topic{Name: filter, Qos: packets.QOS_1})
+		if strings.Count(filter, "/")+1 > maxLevels || len(filter) > 4096 {
+			a.NotNil(rs[0].Err, filter)
+		} else {
+			a.Nil(rs[0].Err, filter)
+			if !rs[0].AlreadyExisted {
+				accepted++
+			}
+		}
+	}
+	a.Equal(accepted, db.GetStats().SubscriptionsCurrent)
+	stats := db.GetTreeStats()
+	a.True(stats.MaxDepth <= maxLevels)
+
+	for i := 0; i < 2000; i++ {
+		topic := randTopic(false)
+		matched := db.GetTopicMatched(topic)
+		if strings.Count(topic, "/")+1 > maxLevels {
+			a.Len(matched, 0)
+			continue
+		}
+		// the matching visits each node at most once and never goes deeper than the tree.
+		visits, depth := matchWork(db, topic)
+		a.True(uint64(visits) <= stats.NodeCount, topic)
+		a.True(depth <= stats.MaxDepth, topic)
+	}
+}
+
+func TestTrieDB_Concurrent(t *testing.T) {
+	a := assert.New(t)
+	db := NewStore()
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			clientID := "id" + strconv.Itoa(i)
+			for j := 0; j < 200; j++ {
+				// the clients share the first levels, so they contend for the same branches.
+				topic := "a/" + strconv.Itoa(j%10)
+				db.Subscribe(clientID, packets.Topic{Name: topic, Qos: packets.QOS_1}, packets.Topic{Name: "+/" + clientID})
+				db.GetTopicMatched(topic)
+				db.GetTopicMatchedMulti([]string{topic, "b/" + clientID}, subscription.TypeAll)
+				db.Unsubscribe(clientID, topic)
+			}
+			db.Subscribe(clientID, packets.Topic{Name: "a/b", Qos: packets.QOS_1})
+		}(i)
+	}
+	wg.Wait()
+	a.Equal(subscription.Stats{SubscriptionsTotal: 8*201 + 8, SubscriptionsCurrent: 16}, db.GetStats())
+	a.Len(db.GetTopicMatched("a/b"), 8)
+	for i := 0; i < 8; i++ {
+		db.UnsubscribeAll("id" + strconv.Itoa(i))
+	}
+	a.Equal(uint64(0), db.GetStats().SubscriptionsCurrent)
+	a.Len(db.GetTopicMatched("a/b"), 0)
+	// the empty intermediate nodes "a" and "+" are kept.
+	a.Equal(TreeStats{NodeCount: 2, MaxDepth: 1, DistinctLevels: 2}, db.GetTreeStats())
+}
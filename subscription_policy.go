@@ -0,0 +1,83 @@
+package gmqtt
+
+import (
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/DrmagicE/gmqtt/pkg/packets"
+)
+
+// sharedSubscriptionPrefix is the prefix of the shared subscriptions: $share/{ShareName}/{filter}.
+const sharedSubscriptionPrefix = "$share/"
+
+// subscriptionPolicyViolation returns the reason why the topic filter violates the subscription policy,
+// empty if it does not.
+func (srv *server) subscriptionPolicyViolation(topicFilter string) string {
+	if srv.config.NoSharedSubscriptions && strings.HasPrefix(topicFilter, sharedSubscriptionPrefix) {
+		return "shared subscriptions not supported"
+	}
+	if srv.config.NoWildcardSubscriptions && strings.ContainsAny(topicFilter, "+#") {
+		return "wildcard subscriptions not supported"
+	}
+	return ""
+}
+
+// applySubscriptionPolicy applies the subscription policy to the requested topics of the SUBSCRIBE packet:
+// the topics violating the policy are set to packets.SUBSCRIBE_FAILURE, and the qos is capped by Config.MaxGrantedQos.
+// MQTT 3.1.1 has no reason codes in the SUBACK packet, the reasons are only logged.
+func (client *client) applySubscriptionPolicy(topics []packets.Topic) {
+	srv := client.server
+	for k, v := range topics {
+		if v.Qos == packets.SUBSCRIBE_FAILURE {
+			continue
+		}
+		if reason := srv.subscriptionPolicyViolation(v.Name); reason != "" {
+			subscriptionLog().Info("subscribe rejected by the policy", client.logFields(
+				zap.String("topic", v.Name),
+				zap.String("reason", reason),
+			)...)
+			topics[k].Qos = packets.SUBSCRIBE_FAILURE
+			continue
+		}
+		if v.Qos > srv.config.MaxGrantedQos {
+			topics[k].Qos = srv.config.MaxGrantedQos
+		}
+	}
+}
+
+// subscriptionQuota limits the number of the subscriptions of a client, see Config.MaxSubscriptionsPerClient.
+type subscriptionQuota struct {
+	max int
+	// subscribed is the topic filters subscribed by the client.
+	subscribed map[string]struct{}
+}
+
+// newSubscriptionQuota returns the quota of the client, nil if there is no limit.
+func (client *client) newSubscriptionQuota() *subscriptionQuota {
+	max := client.server.config.MaxSubscriptionsPerClient
+	if max <= 0 {
+		return nil
+	}
+	q := &subscriptionQuota{max: max, subscribed: make(map[string]struct{})}
+	for _, v := range client.server.subscriptionsDB.GetClientSubscriptions(client.opts.clientID) {
+		q.subscribed[v.Name] = struct{}{}
+	}
+	return q
+}
+
+// allow returns whether the topic filter can be subscribed, the existing subscriptions are always allowed
+// since resubscribing replaces them.
+func (q *subscriptionQuota) allow(topicFilter string) bool {
+	if q == nil {
+		return true
+	}
+	if _, ok := q.subscribed[topicFilter]; ok {
+		return true
+	}
+	if len(q.subscribed) >= q.max {
+		return false
+	}
+	q.subscribed[topicFilter] = struct{}{}
+	return true
+}
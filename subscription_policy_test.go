@@ -0,0 +1,48 @@
+package gmqtt
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/DrmagicE/gmqtt/pkg/packets"
+)
+
+func TestServer_SubscriptionPolicy(t *testing.T) {
+	a := assert.New(t)
+	config := DefaultConfig
+	config.MaxGrantedQos = packets.QOS_1
+	config.NoWildcardSubscriptions = true
+	config.NoSharedSubscriptions = true
+	config.MaxSubscriptionsPerClient = 2
+	srv := NewServer(WithConfig(config))
+	srv.tcpListener = append(srv.tcpListener, &testListener{acceptReady: make(chan struct{})})
+	srv.Run()
+	defer srv.Stop(context.Background())
+
+	conn := connectTestClient(srv, defaultConnectPacket())
+	subscribe := func(id packets.PacketID, topics ...packets.Topic) []byte {
+		a.NoError(writePacket(conn, &packets.Subscribe{PacketID: id, Topics: topics}))
+		p, err := readPacketWithTimeOut(conn, time.Second)
+		if !a.NoError(err) {
+			return nil
+		}
+		return p.(*packets.Suback).Payload
+	}
+	a.Equal([]byte{packets.QOS_1, packets.SUBSCRIBE_FAILURE, packets.SUBSCRIBE_FAILURE, packets.QOS_0},
+		subscribe(1,
+			packets.Topic{Name: "a", Qos: packets.QOS_2},
+			packets.Topic{Name: "a/+", Qos: packets.QOS_1},
+			packets.Topic{Name: "$share/g/a", Qos: packets.QOS_1},
+			packets.Topic{Name: "b", Qos: packets.QOS_0},
+		))
+	// the quota is 2, resubscribing the existing topic filter is allowed.
+	a.Equal([]byte{packets.QOS_0, packets.SUBSCRIBE_FAILURE},
+		subscribe(2,
+			packets.Topic{Name: "a", Qos: packets.QOS_0},
+			packets.Topic{Name: "c", Qos: packets.QOS_0},
+		))
+	a.Len(srv.subscriptionsDB.GetClientSubscriptions("MQTT"), 2)
+}
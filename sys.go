@@ -0,0 +1,99 @@
+package gmqtt
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/DrmagicE/gmqtt/pkg/packets"
+	"github.com/DrmagicE/gmqtt/subscription"
+)
+
+// Version is the version of gmqtt, which is published to the $SYS/broker/version topic.
+const Version = "0.1.0"
+
+// The $SYS topics to which the broker statistics are published, see Config.SysInterval.
+const (
+	SysTopicVersion              = "$SYS/broker/version"
+	SysTopicUptime               = "$SYS/broker/uptime"
+	SysTopicClientsConnected     = "$SYS/broker/clients/connected"
+	SysTopicClientsDisconnected  = "$SYS/broker/clients/disconnected"
+	SysTopicClientsTotal         = "$SYS/broker/clients/total"
+	SysTopicMessagesReceived     = "$SYS/broker/messages/received"
+	SysTopicMessagesSent         = "$SYS/broker/messages/sent"
+	SysTopicMessagesDropped      = "$SYS/broker/messages/dropped"
+	SysTopicBytesReceived        = "$SYS/broker/bytes/received"
+	SysTopicBytesSent            = "$SYS/broker/bytes/sent"
+	SysTopicSubscriptionsCurrent = "$SYS/broker/subscriptions/count"
+	// SysTopicTopTopics is the JSON array of the statistics of the top topics, see StatsManager.TopTopics.
+	// It is published only if the per-topic statistics are enabled by Config.MaxTopicStats.
+	SysTopicTopTopics = "$SYS/broker/topics/top"
+)
+
+// sysTopTopics is the number of the topics published to SysTopicTopTopics.
+const sysTopTopics = 10
+
+// sysLoop publishes the broker statistics to the $SYS topics every Config.SysInterval until the server exits.
+func (srv *server) sysLoop(startedAt time.Time) {
+	ticker := time.NewTicker(srv.config.SysInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-srv.exitChan:
+			return
+		case now := <-ticker.C:
+			srv.publishSys(now.Sub(startedAt))
+		}
+	}
+}
+
+// hasSysSubscriber returns whether there is any subscription to the system topics.
+func (srv *server) hasSysSubscriber() bool {
+	var found bool
+	subscription.IteratePage(srv.subscriptionsDB, func(clientID string, topic packets.Topic) bool {
+		found = true
+		return false
+	}, subscription.IterationOptions{Type: subscription.TypeSYS, Limit: 1}, "")
+	return found
+}
+
+// publishSys publishes the current broker statistics to the $SYS topics.
+// Nothing is published if no client subscribes to the system topics.
+func (srv *server) publishSys(uptime time.Duration) {
+	if !srv.hasSysSubscriber() {
+		return
+	}
+	values := sysValues(srv.statsManager.GetStats(), uptime)
+	if srv.topicStats != nil {
+		b, _ := json.Marshal(srv.topicStats.top(sysTopTopics))
+		values[SysTopicTopTopics] = string(b)
+	}
+	for topic, value := range values {
+		select {
+		case <-srv.exitChan:
+			return
+		case srv.msgRouter <- &msgRouter{msg: NewMessage(topic, []byte(value), packets.QOS_0), match: true}:
+		}
+	}
+}
+
+// sysValues returns the payloads of the $SYS topics.
+func sysValues(st *ServerStats, uptime time.Duration) map[string]string {
+	u := func(v uint64) string {
+		return strconv.FormatUint(v, 10)
+	}
+	m := st.MessageStats
+	return map[string]string{
+		SysTopicVersion:              Version,
+		SysTopicUptime:               strconv.FormatInt(int64(uptime/time.Second), 10) + " seconds",
+		SysTopicClientsConnected:     u(st.ClientStats.ActiveCurrent),
+		SysTopicClientsDisconnected:  u(st.ClientStats.InactiveCurrent),
+		SysTopicClientsTotal:         u(st.ClientStats.ActiveCurrent + st.ClientStats.InactiveCurrent),
+		SysTopicMessagesReceived:     u(m.Qos0.ReceivedTotal + m.Qos1.ReceivedTotal + m.Qos2.ReceivedTotal),
+		SysTopicMessagesSent:         u(m.Qos0.SentTotal + m.Qos1.SentTotal + m.Qos2.SentTotal),
+		SysTopicMessagesDropped:      u(m.Qos0.DroppedTotal + m.Qos1.DroppedTotal + m.Qos2.DroppedTotal),
+		SysTopicBytesReceived:        u(st.PacketStats.BytesReceived.total()),
+		SysTopicBytesSent:            u(st.PacketStats.BytesSent.total()),
+		SysTopicSubscriptionsCurrent: u(st.SubscriptionStats.SubscriptionsCurrent),
+	}
+}
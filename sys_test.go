@@ -0,0 +1,59 @@
+package gmqtt
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/DrmagicE/gmqtt/pkg/packets"
+)
+
+func TestSysValues(t *testing.T) {
+	a := assert.New(t)
+	srv := NewServer()
+	srv.statsManager.addSessionActive()
+	srv.statsManager.addSessionInactive()
+	srv.statsManager.messageReceived(packets.QOS_0)
+	srv.statsManager.messageReceived(packets.QOS_1)
+	v := sysValues(srv.statsManager.GetStats(), 90*time.Second)
+	a.Equal(Version, v[SysTopicVersion])
+	a.Equal("90 seconds", v[SysTopicUptime])
+	a.Equal("1", v[SysTopicClientsConnected])
+	a.Equal("1", v[SysTopicClientsDisconnected])
+	a.Equal("2", v[SysTopicClientsTotal])
+	a.Equal("2", v[SysTopicMessagesReceived])
+	a.Equal("0", v[SysTopicSubscriptionsCurrent])
+}
+
+func TestSysPublish(t *testing.T) {
+	a := assert.New(t)
+	srv := NewServer()
+	srv.config.SysInterval = 50 * time.Millisecond
+	srv.tcpListener = append(srv.tcpListener, &testListener{acceptReady: make(chan struct{})})
+	srv.Run()
+	defer srv.Stop(context.Background())
+
+	sub := defaultConnectPacket()
+	sub.ClientID = []byte("sub")
+	sub.WillFlag = false
+	sub.WillQos = packets.QOS_0
+	sub.WillTopic = nil
+	sub.WillMsg = nil
+	subConn := connectTestClient(srv, sub)
+	// the system topics are not matched by "#".
+	srv.subscriptionsDB.Subscribe("sub", packets.Topic{Name: "#", Qos: packets.QOS_0})
+	_, err := readPacketWithTimeOut(subConn, 200*time.Millisecond)
+	a.NotNil(err)
+
+	srv.subscriptionsDB.Subscribe("sub", packets.Topic{Name: SysTopicVersion, Qos: packets.QOS_1})
+	p, err := readPacketWithTimeOut(subConn, time.Second)
+	a.Nil(err)
+	if a.IsType(&packets.Publish{}, p) {
+		pub := p.(*packets.Publish)
+		a.Equal(SysTopicVersion, string(pub.TopicName))
+		a.Equal(Version, string(pub.Payload))
+		a.Equal(packets.QOS_0, pub.Qos)
+	}
+}
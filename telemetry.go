@@ -0,0 +1,210 @@
+package gmqtt
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	metric_noop "go.opentelemetry.io/otel/metric/noop"
+	"go.opentelemetry.io/otel/trace"
+	trace_noop "go.opentelemetry.io/otel/trace/noop"
+	"go.uber.org/zap"
+
+	"github.com/DrmagicE/gmqtt/pkg/packets"
+)
+
+// instrumentationName is the name of the OpenTelemetry tracer and meter of the server.
+const instrumentationName = "github.com/DrmagicE/gmqtt"
+
+// The names of the OpenTelemetry spans of the server.
+// MQTT 3.1.1 can not carry the trace context, so the PUBLISH span is the root of the spans of a message:
+//
+//	PUBLISH (the message is received from the publisher)
+//	└── fan-out (the message is routed to the matched subscribers)
+//	    └── deliver (the message is sent to a online subscriber)
+//	        └── ack (from sending the QoS 1/2 message to receiving the PUBACK/PUBREC)
+//
+// The messages queued for the offline subscribers do not carry the span context,
+// so they are delivered without the deliver and ack spans.
+const (
+	SpanConnect = "CONNECT"
+	SpanPublish = "PUBLISH"
+	SpanFanOut  = "fan-out"
+	SpanDeliver = "deliver"
+	SpanAck     = "ack"
+)
+
+// The names of the OpenTelemetry metrics of the server.
+const (
+	// MetricConnects counts the CONNECT packets, with the "mqtt.connack.code" attribute.
+	MetricConnects = "gmqtt.connects"
+	// MetricPublishReceived counts the PUBLISH packets received from the clients, with the "mqtt.qos" attribute.
+	MetricPublishReceived = "gmqtt.publish.received"
+	// MetricMessagesDelivered counts the messages written to the subscribers, with the "mqtt.qos" attribute.
+	MetricMessagesDelivered = "gmqtt.messages.delivered"
+	// MetricMessagesAcked counts the QoS 1/2 messages acknowledged by the subscribers.
+	MetricMessagesAcked = "gmqtt.messages.acked"
+	// MetricFanOutSubscribers is the histogram of the number of the matched subscribers of each routed message.
+	MetricFanOutSubscribers = "gmqtt.fanout.subscribers"
+	// MetricAckLatency is the histogram of the duration in seconds from delivering the QoS 1/2 message to the ack.
+	MetricAckLatency = "gmqtt.ack.latency"
+)
+
+// telemetry holds the OpenTelemetry tracer and instruments of the server.
+type telemetry struct {
+	tracer     trace.Tracer
+	connects   metric.Int64Counter
+	received   metric.Int64Counter
+	delivered  metric.Int64Counter
+	acked      metric.Int64Counter
+	fanOut     metric.Int64Histogram
+	ackLatency metric.Float64Histogram
+}
+
+func newTelemetry(tp trace.TracerProvider, mp metric.MeterProvider) *telemetry {
+	if tp == nil {
+		tp = trace_noop.NewTracerProvider()
+	}
+	if mp == nil {
+		mp = metric_noop.NewMeterProvider()
+	}
+	t := &telemetry{tracer: tp.Tracer(instrumentationName)}
+	meter := mp.Meter(instrumentationName)
+	noop := metric_noop.Meter{}
+	var err error
+	if t.connects, err = meter.Int64Counter(MetricConnects,
+		metric.WithDescription("The number of the CONNECT packets.")); err != nil {
+		t.connects, _ = noop.Int64Counter(MetricConnects)
+		serverLog().Warn("create instrument error", zap.String("name", MetricConnects), zap.Error(err))
+	}
+	if t.received, err = meter.Int64Counter(MetricPublishReceived,
+		metric.WithDescription("The number of the PUBLISH packets received from the clients.")); err != nil {
+		t.received, _ = noop.Int64Counter(MetricPublishReceived)
+		serverLog().Warn("create instrument error", zap.String("name", MetricPublishReceived), zap.Error(err))
+	}
+	if t.delivered, err = meter.Int64Counter(MetricMessagesDelivered,
+		metric.WithDescription("The number of the messages written to the subscribers.")); err != nil {
+		t.delivered, _ = noop.Int64Counter(MetricMessagesDelivered)
+		serverLog().Warn("create instrument error", zap.String("name", MetricMessagesDelivered), zap.Error(err))
+	}
+	if t.acked, err = meter.Int64Counter(MetricMessagesAcked,
+		metric.WithDescription("The number of the QoS 1/2 messages acknowledged by the subscribers.")); err != nil {
+		t.acked, _ = noop.Int64Counter(MetricMessagesAcked)
+		serverLog().Warn("create instrument error", zap.String("name", MetricMessagesAcked), zap.Error(err))
+	}
+	if t.fanOut, err = meter.Int64Histogram(MetricFanOutSubscribers,
+		metric.WithDescription("The number of the matched subscribers of each routed message.")); err != nil {
+		t.fanOut, _ = noop.Int64Histogram(MetricFanOutSubscribers)
+		serverLog().Warn("create instrument error", zap.String("name", MetricFanOutSubscribers), zap.Error(err))
+	}
+	if t.ackLatency, err = meter.Float64Histogram(MetricAckLatency, metric.WithUnit("s"),
+		metric.WithDescription("The duration from delivering the QoS 1/2 message to the ack.")); err != nil {
+		t.ackLatency, _ = noop.Float64Histogram(MetricAckLatency)
+		serverLog().Warn("create instrument error", zap.String("name", MetricAckLatency), zap.Error(err))
+	}
+	return t
+}
+
+// qosAttr returns the attribute set of the qos, the sets are preallocated to keep the hot paths allocation free.
+func qosAttr(qos uint8) metric.MeasurementOption {
+	if int(qos) < len(qosAttrs) {
+		return qosAttrs[qos]
+	}
+	return metric.WithAttributes(attribute.Int("mqtt.qos", int(qos)))
+}
+
+var qosAttrs = []metric.MeasurementOption{
+	metric.WithAttributes(attribute.Int("mqtt.qos", 0)),
+	metric.WithAttributes(attribute.Int("mqtt.qos", 1)),
+	metric.WithAttributes(attribute.Int("mqtt.qos", 2)),
+}
+
+// startConnect starts the CONNECT span of the client.
+func (t *telemetry) startConnect(client *client) trace.Span {
+	_, span := t.tracer.Start(context.Background(), SpanConnect, trace.WithSpanKind(trace.SpanKindServer))
+	if span.IsRecording() {
+		span.SetAttributes(
+			attribute.String("mqtt.client_id", client.opts.clientID),
+			attribute.String("net.peer.addr", client.opts.remoteAddr.String()),
+			attribute.Bool("mqtt.clean_session", client.opts.cleanSession),
+		)
+	}
+	return span
+}
+
+// endConnect ends the CONNECT span with the connack code and the error.
+func (t *telemetry) endConnect(span trace.Span, code uint8, err error) {
+	t.connects.Add(context.Background(), 1, metric.WithAttributes(attribute.Int("mqtt.connack.code", int(code))))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	} else if code != packets.CodeAccepted {
+		span.SetStatus(codes.Error, "connection refused")
+	}
+	span.SetAttributes(attribute.Int("mqtt.connack.code", int(code)))
+	span.End()
+}
+
+// startPublish starts the PUBLISH span of the received message.
+func (t *telemetry) startPublish(client *client, pub *packets.Publish) (context.Context, trace.Span) {
+	t.received.Add(context.Background(), 1, qosAttr(pub.Qos))
+	ctx, span := t.tracer.Start(context.Background(), SpanPublish, trace.WithSpanKind(trace.SpanKindServer))
+	if span.IsRecording() {
+		span.SetAttributes(
+			attribute.String("mqtt.client_id", client.opts.clientID),
+			attribute.String("mqtt.topic", string(pub.TopicName)),
+			attribute.Int("mqtt.qos", int(pub.Qos)),
+			attribute.Bool("mqtt.retain", pub.Retain),
+			attribute.Int("mqtt.packet_id", int(pub.PacketID)),
+			attribute.Int("mqtt.payload_size", len(pub.Payload)),
+		)
+	}
+	return ctx, span
+}
+
+// startFanOut starts the fan-out span of the routed message.
+func (t *telemetry) startFanOut(ctx context.Context, msg packets.Message, subscribers int) (context.Context, trace.Span) {
+	t.fanOut.Record(context.Background(), int64(subscribers))
+	ctx, span := t.tracer.Start(ctx, SpanFanOut)
+	if span.IsRecording() {
+		span.SetAttributes(
+			attribute.String("mqtt.topic", msg.Topic()),
+			attribute.Int("mqtt.subscribers", subscribers),
+		)
+	}
+	return ctx, span
+}
+
+// startDeliver starts the deliver span of the message sent to the subscriber.
+func (t *telemetry) startDeliver(ctx context.Context, client *client, pub *packets.Publish) trace.Span {
+	_, span := t.tracer.Start(ctx, SpanDeliver, trace.WithSpanKind(trace.SpanKindProducer))
+	if span.IsRecording() {
+		span.SetAttributes(
+			attribute.String("mqtt.client_id", client.opts.clientID),
+			attribute.String("mqtt.topic", string(pub.TopicName)),
+			attribute.Int("mqtt.qos", int(pub.Qos)),
+		)
+	}
+	return span
+}
+
+// ack records the ack of the inflight message, elem.spanContext is the span context of the deliver span.
+func (t *telemetry) ack(client *client, elem *inflightElem) {
+	now := time.Now()
+	t.acked.Add(context.Background(), 1, qosAttr(elem.packet.Qos))
+	t.ackLatency.Record(context.Background(), now.Sub(elem.at).Seconds())
+	if !elem.spanContext.IsValid() {
+		return
+	}
+	_, span := t.tracer.Start(trace.ContextWithSpanContext(context.Background(), elem.spanContext), SpanAck,
+		trace.WithTimestamp(elem.at), trace.WithSpanKind(trace.SpanKindConsumer))
+	if span.IsRecording() {
+		span.SetAttributes(
+			attribute.String("mqtt.client_id", client.opts.clientID),
+			attribute.Int("mqtt.packet_id", int(elem.packet.PacketID)),
+		)
+	}
+	span.End(trace.WithTimestamp(now))
+}
@@ -0,0 +1,166 @@
+package gmqtt
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/metric"
+	metric_noop "go.opentelemetry.io/otel/metric/noop"
+	sdk_trace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/DrmagicE/gmqtt/pkg/packets"
+)
+
+// testMeterProvider records the sums of the counters and the counts of the histograms.
+type testMeterProvider struct {
+	metric_noop.MeterProvider
+	mu         sync.Mutex
+	sums       map[string]int64
+	histograms map[string]int64
+}
+
+func newTestMeterProvider() *testMeterProvider {
+	return &testMeterProvider{
+		sums:       make(map[string]int64),
+		histograms: make(map[string]int64),
+	}
+}
+
+func (p *testMeterProvider) Meter(name string, opts ...metric.MeterOption) metric.Meter {
+	return &testMeter{p: p}
+}
+
+func (p *testMeterProvider) sum(name string) int64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.sums[name]
+}
+
+func (p *testMeterProvider) count(name string) int64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.histograms[name]
+}
+
+type testMeter struct {
+	metric_noop.Meter
+	p *testMeterProvider
+}
+
+func (m *testMeter) Int64Counter(name string, options ...metric.Int64CounterOption) (metric.Int64Counter, error) {
+	return &testInt64Counter{p: m.p, name: name}, nil
+}
+
+func (m *testMeter) Int64Histogram(name string, options ...metric.Int64HistogramOption) (metric.Int64Histogram, error) {
+	return &testInt64Histogram{p: m.p, name: name}, nil
+}
+
+func (m *testMeter) Float64Histogram(name string, options ...metric.Float64HistogramOption) (metric.Float64Histogram, error) {
+	return &testFloat64Histogram{p: m.p, name: name}, nil
+}
+
+type testInt64Counter struct {
+	metric_noop.Int64Counter
+	p    *testMeterProvider
+	name string
+}
+
+func (c *testInt64Counter) Add(ctx context.Context, incr int64, options ...metric.AddOption) {
+	c.p.mu.Lock()
+	c.p.sums[c.name] += incr
+	c.p.mu.Unlock()
+}
+
+type testInt64Histogram struct {
+	metric_noop.Int64Histogram
+	p    *testMeterProvider
+	name string
+}
+
+func (h *testInt64Histogram) Record(ctx context.Context, incr int64, options ...metric.RecordOption) {
+	h.p.mu.Lock()
+	h.p.histograms[h.name]++
+	h.p.mu.Unlock()
+}
+
+type testFloat64Histogram struct {
+	metric_noop.Float64Histogram
+	p    *testMeterProvider
+	name string
+}
+
+func (h *testFloat64Histogram) Record(ctx context.Context, incr float64, options ...metric.RecordOption) {
+	h.p.mu.Lock()
+	h.p.histograms[h.name]++
+	h.p.mu.Unlock()
+}
+
+func TestTelemetry(t *testing.T) {
+	a := assert.New(t)
+	recorder := tracetest.NewSpanRecorder()
+	mp := newTestMeterProvider()
+	srv := NewServer(
+		WithTracerProvider(sdk_trace.NewTracerProvider(sdk_trace.WithSpanProcessor(recorder))),
+		WithMeterProvider(mp),
+	)
+	srv.tcpListener = append(srv.tcpListener, &testListener{acceptReady: make(chan struct{})})
+	srv.Run()
+	defer srv.Stop(context.Background())
+	subConnect := defaultConnectPacket()
+	subConnect.ClientID = []byte("sub")
+	sub := connectTestClient(srv, subConnect)
+	pubConnect := defaultConnectPacket()
+	pubConnect.ClientID = []byte("pub")
+	pub := connectTestClient(srv, pubConnect)
+	writePacket(sub, &packets.Subscribe{
+		PacketID: 1,
+		Topics:   []packets.Topic{{Name: "a/b", Qos: packets.QOS_1}},
+	})
+	_, err := readPacket(sub)
+	a.NoError(err)
+
+	writePacket(pub, &packets.Publish{
+		Qos:       packets.QOS_1,
+		PacketID:  1,
+		TopicName: []byte("a/b"),
+		Payload:   []byte("payload"),
+	})
+	p, err := readPacket(sub)
+	a.NoError(err)
+	writePacket(sub, p.(*packets.Publish).NewPuback())
+
+	spans := make(map[string]sdk_trace.ReadOnlySpan)
+	timeout := time.After(time.Second)
+	for len(spans) < 5 {
+		select {
+		case <-timeout:
+			t.Fatalf("spans timeout, got %d spans", len(spans))
+		case <-time.After(10 * time.Millisecond):
+		}
+		for _, s := range recorder.Ended() {
+			spans[s.Name()] = s
+		}
+	}
+	a.Len(spans, 5)
+	a.True(spans[SpanConnect].SpanContext().IsValid())
+	publish := spans[SpanPublish]
+	fanOut := spans[SpanFanOut]
+	deliver := spans[SpanDeliver]
+	ack := spans[SpanAck]
+	a.False(publish.Parent().IsValid())
+	a.Equal(publish.SpanContext().SpanID(), fanOut.Parent().SpanID())
+	a.Equal(fanOut.SpanContext().SpanID(), deliver.Parent().SpanID())
+	a.Equal(deliver.SpanContext().SpanID(), ack.Parent().SpanID())
+	a.Equal(publish.SpanContext().TraceID(), ack.SpanContext().TraceID())
+
+	a.EqualValues(2, mp.sum(MetricConnects))
+	a.EqualValues(1, mp.sum(MetricPublishReceived))
+	a.EqualValues(1, mp.sum(MetricMessagesDelivered))
+	a.EqualValues(1, mp.sum(MetricMessagesAcked))
+	a.EqualValues(1, mp.count(MetricFanOutSubscribers))
+	a.EqualValues(1, mp.count(MetricAckLatency))
+}
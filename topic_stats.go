@@ -0,0 +1,181 @@
+package gmqtt
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// topicStatsShards is the number of the shards of the topic statistics, which must be a power of 2.
+// The counters of a topic are in the shard of its hash, so the clients updating different topics
+// rarely contend for the same lock.
+const topicStatsShards = 32
+
+// TopicStats is the statistics of a topic name, see Config.MaxTopicStats.
+type TopicStats struct {
+	Topic string `json:"topic"`
+	// MessagesIn is the number of the messages published to the topic.
+	MessagesIn uint64 `json:"messages_in"`
+	// MessagesOut is the number of the messages of the topic delivered to the subscribers.
+	MessagesOut uint64 `json:"messages_out"`
+	// BytesIn is the total payload size of the messages published to the topic.
+	BytesIn uint64 `json:"bytes_in"`
+	// BytesOut is the total payload size of the messages of the topic delivered to the subscribers.
+	BytesOut uint64 `json:"bytes_out"`
+	// Subscribers is the number of the subscribers matched by the last message published to the topic.
+	Subscribers uint64 `json:"subscribers"`
+}
+
+type topicCounters struct {
+	in          uint64
+	out         uint64
+	bytesIn     uint64
+	bytesOut    uint64
+	subscribers uint64
+}
+
+type topicStatsShard struct {
+	mu     sync.RWMutex
+	topics map[string]*topicCounters
+}
+
+// topicStats collects the statistics of at most max topic names, the topics beyond the limit are not collected.
+// The $SYS topics are not collected.
+type topicStats struct {
+	max int64
+	// n is the number of the collected topics.
+	n      int64
+	shards [topicStatsShards]topicStatsShard
+}
+
+// newTopicStats returns the topic statistics, nil if max is not positive which means the statistics are disabled.
+func newTopicStats(max int) *topicStats {
+	if max <= 0 {
+		return nil
+	}
+	t := &topicStats{max: int64(max)}
+	for i := range t.shards {
+		t.shards[i].topics = make(map[string]*topicCounters)
+	}
+	return t
+}
+
+// shard returns the shard of the topic by the FNV-1a hash.
+func (t *topicStats) shard(topic string) *topicStatsShard {
+	h := uint32(2166136261)
+	for i := 0; i < len(topic); i++ {
+		h ^= uint32(topic[i])
+		h *= 16777619
+	}
+	return &t.shards[h&(topicStatsShards-1)]
+}
+
+// counters returns the counters of the topic, it creates the counters if create is true and the limit is not reached.
+func (t *topicStats) counters(topic string, create bool) *topicCounters {
+	s := t.shard(topic)
+	s.mu.RLock()
+	c := s.topics[topic]
+	s.mu.RUnlock()
+	if c != nil || !create || strings.HasPrefix(topic, "$SYS/") {
+		return c
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if c = s.topics[topic]; c != nil {
+		return c
+	}
+	if atomic.AddInt64(&t.n, 1) > t.max {
+		atomic.AddInt64(&t.n, -1)
+		return nil
+	}
+	c = &topicCounters{}
+	s.topics[topic] = c
+	return c
+}
+
+// messageIn counts the message published to the topic, which matches the number of subscribers.
+func (t *topicStats) messageIn(topic string, size int, subscribers int) {
+	if t == nil {
+		return
+	}
+	if c := t.counters(topic, true); c != nil {
+		atomic.AddUint64(&c.in, 1)
+		atomic.AddUint64(&c.bytesIn, uint64(size))
+		atomic.StoreUint64(&c.subscribers, uint64(subscribers))
+	}
+}
+
+// messageOut counts the message of the topic delivered to a subscriber.
+func (t *topicStats) messageOut(topic string, size int) {
+	if t == nil {
+		return
+	}
+	if c := t.counters(topic, false); c != nil {
+		atomic.AddUint64(&c.out, 1)
+		atomic.AddUint64(&c.bytesOut, uint64(size))
+	}
+}
+
+func (c *topicCounters) stats(topic string) TopicStats {
+	return TopicStats{
+		Topic:       topic,
+		MessagesIn:  atomic.LoadUint64(&c.in),
+		MessagesOut: atomic.LoadUint64(&c.out),
+		BytesIn:     atomic.LoadUint64(&c.bytesIn),
+		BytesOut:    atomic.LoadUint64(&c.bytesOut),
+		Subscribers: atomic.LoadUint64(&c.subscribers),
+	}
+}
+
+func (t *topicStats) get(topic string) (TopicStats, bool) {
+	if t == nil {
+		return TopicStats{}, false
+	}
+	if c := t.counters(topic, false); c != nil {
+		return c.stats(topic), true
+	}
+	return TopicStats{}, false
+}
+
+// top returns at most n topics ordered by the total messages in and out in descending order,
+// n <= 0 means all topics.
+func (t *topicStats) top(n int) []TopicStats {
+	if t == nil {
+		return nil
+	}
+	rs := make([]TopicStats, 0, atomic.LoadInt64(&t.n))
+	for i := range t.shards {
+		s := &t.shards[i]
+		s.mu.RLock()
+		for topic, c := range s.topics {
+			rs = append(rs, c.stats(topic))
+		}
+		s.mu.RUnlock()
+	}
+	sort.Slice(rs, func(i, j int) bool {
+		ti, tj := rs[i].MessagesIn+rs[i].MessagesOut, rs[j].MessagesIn+rs[j].MessagesOut
+		if ti != tj {
+			return ti > tj
+		}
+		return rs[i].Topic < rs[j].Topic
+	})
+	if n > 0 && n < len(rs) {
+		rs = rs[:n]
+	}
+	return rs
+}
+
+// reset removes the statistics of all topics.
+func (t *topicStats) reset() {
+	if t == nil {
+		return
+	}
+	for i := range t.shards {
+		s := &t.shards[i]
+		s.mu.Lock()
+		atomic.AddInt64(&t.n, -int64(len(s.topics)))
+		s.topics = make(map[string]*topicCounters)
+		s.mu.Unlock()
+	}
+}
@@ -0,0 +1,98 @@
+package gmqtt
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/DrmagicE/gmqtt/pkg/packets"
+)
+
+func TestTopicStats(t *testing.T) {
+	a := assert.New(t)
+	a.Nil(newTopicStats(0))
+	var disabled *topicStats
+	disabled.messageIn("a", 1, 1)
+	a.Nil(disabled.top(1))
+
+	ts := newTopicStats(2)
+	ts.messageIn("a", 3, 1)
+	ts.messageIn("b", 1, 2)
+	ts.messageIn("b", 1, 3)
+	// the topics beyond the limit and the $SYS topics are not collected.
+	ts.messageIn("c", 1, 1)
+	ts.messageIn(SysTopicVersion, 1, 1)
+	ts.messageOut("a", 3)
+	ts.messageOut("a", 3)
+	ts.messageOut("c", 1)
+
+	a.Equal([]TopicStats{
+		{Topic: "a", MessagesIn: 1, MessagesOut: 2, BytesIn: 3, BytesOut: 6, Subscribers: 1},
+		{Topic: "b", MessagesIn: 2, BytesIn: 2, Subscribers: 3},
+	}, ts.top(0))
+	a.Len(ts.top(1), 1)
+	_, ok := ts.get("c")
+	a.False(ok)
+
+	ts.reset()
+	a.Len(ts.top(0), 0)
+	ts.messageIn("c", 1, 1)
+	st, ok := ts.get("c")
+	a.True(ok)
+	a.EqualValues(1, st.MessagesIn)
+}
+
+func TestTopicStats_Server(t *testing.T) {
+	a := assert.New(t)
+	config := DefaultConfig
+	config.MaxTopicStats = 10
+	config.SysInterval = 50 * time.Millisecond
+	srv := NewServer(WithConfig(config))
+	srv.tcpListener = append(srv.tcpListener, &testListener{acceptReady: make(chan struct{})})
+	srv.Run()
+	defer srv.Stop(context.Background())
+
+	sub := defaultConnectPacket()
+	sub.ClientID = []byte("sub")
+	sub.WillFlag = false
+	sub.WillQos = packets.QOS_0
+	sub.WillTopic = nil
+	sub.WillMsg = nil
+	subConn := connectTestClient(srv, sub)
+	srv.subscriptionsDB.Subscribe("sub", packets.Topic{Name: "a/+", Qos: packets.QOS_0})
+	for i := 0; i < 2; i++ {
+		srv.PublishService().Publish(NewMessage("a/b", []byte("ab"), packets.QOS_0))
+		_, err := readPacketWithTimeOut(subConn, time.Second)
+		a.NoError(err)
+	}
+	srv.PublishService().Publish(NewMessage("c", []byte("c"), packets.QOS_0))
+	a.Eventually(func() bool {
+		_, ok := srv.GetStatsManager().GetTopicStats("c")
+		return ok
+	}, time.Second, 10*time.Millisecond)
+	a.Eventually(func() bool {
+		st, _ := srv.GetStatsManager().GetTopicStats("a/b")
+		return st.MessagesOut == 2
+	}, time.Second, 10*time.Millisecond)
+
+	top := srv.GetStatsManager().TopTopics(1)
+	a.Equal([]TopicStats{{Topic: "a/b", MessagesIn: 2, MessagesOut: 2, BytesIn: 4, BytesOut: 4, Subscribers: 1}}, top)
+
+	srv.subscriptionsDB.Subscribe("sub", packets.Topic{Name: SysTopicTopTopics, Qos: packets.QOS_0})
+	for {
+		p, err := readPacketWithTimeOut(subConn, time.Second)
+		if !a.NoError(err) {
+			return
+		}
+		if pub := p.(*packets.Publish); string(pub.TopicName) == SysTopicTopTopics {
+			var rs []TopicStats
+			a.NoError(json.Unmarshal(pub.Payload, &rs))
+			a.Len(rs, 2)
+			a.Equal("a/b", rs[0].Topic)
+			return
+		}
+	}
+}
@@ -0,0 +1,239 @@
+package gmqtt
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/DrmagicE/gmqtt/pkg/packets"
+)
+
+// ErrInvalidTrace is the error of starting a trace with an empty client id or an invalid topic filter.
+var ErrInvalidTrace = errors.New("invalid trace value")
+
+// TraceKind is the kind of the traced value.
+type TraceKind int
+
+const (
+	// TraceClientID traces the messages published by the client and the messages delivered to the client.
+	TraceClientID TraceKind = iota
+	// TraceTopic traces the messages whose topic name matches the topic filter.
+	TraceTopic
+)
+
+func (k TraceKind) String() string {
+	switch k {
+	case TraceClientID:
+		return "client_id"
+	case TraceTopic:
+		return "topic"
+	default:
+		return "unknown"
+	}
+}
+
+// TraceHop is the hop of a message in the broker.
+type TraceHop int
+
+const (
+	// TraceReceived is the hop that the message is received from the publisher.
+	TraceReceived TraceHop = iota
+	// TraceQueued is the hop that the message is put into the message queue of the subscriber.
+	TraceQueued
+	// TraceDelivered is the hop that the message is written to the subscriber.
+	TraceDelivered
+	// TraceAcked is the hop that the subscriber acknowledges the QoS 1 (PUBACK) or QoS 2 (PUBREC) message.
+	TraceAcked
+	// TraceDropped is the hop that the message is dropped, see TraceEvent.Reason.
+	TraceDropped
+)
+
+func (h TraceHop) String() string {
+	switch h {
+	case TraceReceived:
+		return "received"
+	case TraceQueued:
+		return "queued"
+	case TraceDelivered:
+		return "delivered"
+	case TraceAcked:
+		return "acked"
+	case TraceDropped:
+		return "dropped"
+	default:
+		return "unknown"
+	}
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (h TraceHop) MarshalText() ([]byte, error) {
+	return []byte(h.String()), nil
+}
+
+// TraceEvent is a hop of a traced message. The event is shared by the traces and must not be modified.
+type TraceEvent struct {
+	Time time.Time `json:"time"`
+	Hop  TraceHop  `json:"hop"`
+	// ClientID is the publisher of the received message, or the subscriber of the other hops.
+	ClientID string           `json:"client_id"`
+	Topic    string           `json:"topic"`
+	Qos      uint8            `json:"qos"`
+	Retained bool             `json:"retained"`
+	PacketID packets.PacketID `json:"packet_id"`
+	Payload  []byte           `json:"payload"`
+	// Reason is the reason of the dropped message.
+	Reason string `json:"reason,omitempty"`
+}
+
+// Trace is an active trace.
+type Trace struct {
+	ID   string
+	Kind TraceKind
+	// Value is the client id or the topic filter.
+	Value     string
+	StartedAt time.Time
+}
+
+// TraceService provides the ability to trace the messages of a client or a topic filter at runtime,
+// every hop of the matched messages is recorded, see TraceHop.
+type TraceService interface {
+	// Start starts the trace and calls fn with the events of the matched messages until the trace is stopped.
+	// It returns ErrInvalidTrace if the client id is empty or the topic filter is invalid.
+	// fn is called synchronously by the goroutines of the clients, so it must not block.
+	Start(kind TraceKind, value string, fn func(e *TraceEvent)) (Trace, error)
+	// Stop stops the trace, and returns whether the trace existed.
+	Stop(id string) bool
+	// Traces returns the active traces ordered by StartedAt.
+	Traces() []Trace
+}
+
+// NewTraceWriter returns the trace function which writes the events to w as JSON lines.
+// The write errors are ignored.
+func NewTraceWriter(w io.Writer) func(e *TraceEvent) {
+	var mu sync.Mutex
+	enc := json.NewEncoder(w)
+	return func(e *TraceEvent) {
+		mu.Lock()
+		defer mu.Unlock()
+		enc.Encode(e)
+	}
+}
+
+type traceEntry struct {
+	Trace
+	fn func(e *TraceEvent)
+}
+
+func (t *traceEntry) match(clientID string, topic string) bool {
+	if t.Kind == TraceClientID {
+		return t.Value == clientID
+	}
+	return packets.TopicMatch([]byte(topic), []byte(t.Value))
+}
+
+type traceService struct {
+	// n is the number of the active traces, which makes record cheap if there is no trace.
+	n      int32
+	mu     sync.RWMutex
+	nextID uint64
+	traces map[string]*traceEntry
+}
+
+func newTraceService() *traceService {
+	return &traceService{
+		traces: make(map[string]*traceEntry),
+	}
+}
+
+func (t *traceService) Start(kind TraceKind, value string, fn func(e *TraceEvent)) (Trace, error) {
+	switch kind {
+	case TraceClientID:
+		if value == "" {
+			return Trace{}, ErrInvalidTrace
+		}
+	case TraceTopic:
+		if !packets.ValidTopicFilter([]byte(value)) {
+			return Trace{}, ErrInvalidTrace
+		}
+	default:
+		return Trace{}, ErrInvalidTrace
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.nextID++
+	e := &traceEntry{
+		Trace: Trace{
+			ID:        strconv.FormatUint(t.nextID, 10),
+			Kind:      kind,
+			Value:     value,
+			StartedAt: time.Now(),
+		},
+		fn: fn,
+	}
+	t.traces[e.ID] = e
+	atomic.AddInt32(&t.n, 1)
+	serverLog().Info("trace started",
+		zap.String("id", e.ID), zap.String("kind", kind.String()), zap.String("value", value))
+	return e.Trace, nil
+}
+
+func (t *traceService) Stop(id string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.traces[id]; !ok {
+		return false
+	}
+	delete(t.traces, id)
+	atomic.AddInt32(&t.n, -1)
+	serverLog().Info("trace stopped", zap.String("id", id))
+	return true
+}
+
+func (t *traceService) Traces() []Trace {
+	t.mu.RLock()
+	rs := make([]Trace, 0, len(t.traces))
+	for _, v := range t.traces {
+		rs = append(rs, v.Trace)
+	}
+	t.mu.RUnlock()
+	sort.Slice(rs, func(i, j int) bool {
+		return rs[i].StartedAt.Before(rs[j].StartedAt)
+	})
+	return rs
+}
+
+// record passes the event of the publish to the matched traces.
+func (t *traceService) record(hop TraceHop, clientID string, pub *packets.Publish, reason string) {
+	if atomic.LoadInt32(&t.n) == 0 {
+		return
+	}
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	var e *TraceEvent
+	for _, v := range t.traces {
+		if !v.match(clientID, string(pub.TopicName)) {
+			continue
+		}
+		if e == nil {
+			e = &TraceEvent{
+				Time:     time.Now(),
+				Hop:      hop,
+				ClientID: clientID,
+				Topic:    string(pub.TopicName),
+				Qos:      pub.Qos,
+				Retained: pub.Retain,
+				PacketID: pub.PacketID,
+				Payload:  pub.Payload,
+				Reason:   reason,
+			}
+		}
+		v.fn(e)
+	}
+}
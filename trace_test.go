@@ -0,0 +1,157 @@
+package gmqtt
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/DrmagicE/gmqtt/pkg/packets"
+)
+
+func TestTraceService(t *testing.T) {
+	a := assert.New(t)
+	srv := newTestServer()
+	srv.Run()
+	defer srv.Stop(context.Background())
+	subConnect := defaultConnectPacket()
+	subConnect.ClientID = []byte("sub")
+	sub := connectTestClient(srv, subConnect)
+	pubConnect := defaultConnectPacket()
+	pubConnect.ClientID = []byte("pub")
+	pub := connectTestClient(srv, pubConnect)
+
+	writePacket(sub, &packets.Subscribe{
+		PacketID: 1,
+		Topics:   []packets.Topic{{Name: "a/b", Qos: packets.QOS_1}},
+	})
+	_, err := readPacket(sub)
+	a.NoError(err)
+
+	ts := srv.TraceService()
+	_, err = ts.Start(TraceTopic, "a/#/b", func(e *TraceEvent) {})
+	a.Equal(ErrInvalidTrace, err)
+	_, err = ts.Start(TraceClientID, "", func(e *TraceEvent) {})
+	a.Equal(ErrInvalidTrace, err)
+
+	topicEvents := make(chan *TraceEvent, 10)
+	topicTrace, err := ts.Start(TraceTopic, "a/#", func(e *TraceEvent) {
+		topicEvents <- e
+	})
+	a.NoError(err)
+	clientEvents := make(chan *TraceEvent, 10)
+	clientTrace, err := ts.Start(TraceClientID, "pub", func(e *TraceEvent) {
+		clientEvents <- e
+	})
+	a.NoError(err)
+	a.Equal([]Trace{topicTrace, clientTrace}, ts.Traces())
+
+	writePacket(pub, &packets.Publish{
+		Qos:       packets.QOS_1,
+		PacketID:  1,
+		TopicName: []byte("a/b"),
+		Payload:   []byte("payload"),
+	})
+	p, err := readPacket(sub)
+	a.NoError(err)
+	writePacket(sub, p.(*packets.Publish).NewPuback())
+
+	expected := []struct {
+		hop      TraceHop
+		clientID string
+	}{
+		{TraceReceived, "pub"},
+		{TraceDelivered, "sub"},
+		{TraceAcked, "sub"},
+	}
+	for _, v := range expected {
+		select {
+		case e := <-topicEvents:
+			a.Equal(v.hop, e.Hop)
+			a.Equal(v.clientID, e.ClientID)
+			a.Equal("a/b", e.Topic)
+			a.Equal(packets.QOS_1, e.Qos)
+			a.Equal([]byte("payload"), e.Payload)
+		case <-time.After(time.Second):
+			t.Fatalf("%s event timeout", v.hop)
+		}
+	}
+	select {
+	case e := <-clientEvents:
+		a.Equal(TraceReceived, e.Hop)
+	case <-time.After(time.Second):
+		t.Fatal("received event timeout")
+	}
+	a.Len(clientEvents, 0)
+
+	a.True(ts.Stop(topicTrace.ID))
+	a.True(ts.Stop(clientTrace.ID))
+	a.False(ts.Stop(clientTrace.ID))
+	a.Empty(ts.Traces())
+	writePacket(pub, &packets.Publish{
+		Qos:       packets.QOS_0,
+		TopicName: []byte("a/b"),
+		Payload:   []byte("payload"),
+	})
+	_, err = readPacket(sub)
+	a.NoError(err)
+	a.Len(topicEvents, 0)
+}
+
+func TestTraceService_Dropped(t *testing.T) {
+	a := assert.New(t)
+	srv := newTestServer()
+	srv.config.MaxMsgQueue = 1
+	srv.config.MsgQueueDropPolicy = DropNewest
+	srv.Run()
+	defer srv.Stop(context.Background())
+	subConnect := defaultConnectPacket()
+	subConnect.ClientID = []byte("sub")
+	subConnect.CleanSession = false
+	sub := connectTestClient(srv, subConnect)
+	writePacket(sub, &packets.Subscribe{
+		PacketID: 1,
+		Topics:   []packets.Topic{{Name: "a/b", Qos: packets.QOS_1}},
+	})
+	readPacket(sub)
+	writePacket(sub, &packets.Disconnect{})
+	time.Sleep(100 * time.Millisecond)
+
+	events := make(chan *TraceEvent, 10)
+	_, err := srv.TraceService().Start(TraceClientID, "sub", func(e *TraceEvent) {
+		events <- e
+	})
+	a.NoError(err)
+	for i := 0; i < 2; i++ {
+		srv.PublishService().Publish(NewMessage("a/b", []byte("payload"), packets.QOS_1))
+	}
+	for _, hop := range []TraceHop{TraceQueued, TraceDropped} {
+		select {
+		case e := <-events:
+			a.Equal(hop, e.Hop)
+			if hop == TraceDropped {
+				a.Equal(DroppedQueueFull.String(), e.Reason)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("%s event timeout", hop)
+		}
+	}
+}
+
+func TestNewTraceWriter(t *testing.T) {
+	a := assert.New(t)
+	b := &bytes.Buffer{}
+	fn := NewTraceWriter(b)
+	fn(&TraceEvent{Hop: TraceDropped, ClientID: "id", Topic: "a/b", Reason: "reason"})
+	fn(&TraceEvent{Hop: TraceReceived})
+	lines := bytes.Split(bytes.TrimSpace(b.Bytes()), []byte("\n"))
+	a.Len(lines, 2)
+	var m map[string]interface{}
+	a.NoError(json.Unmarshal(lines[0], &m))
+	a.Equal("dropped", m["hop"])
+	a.Equal("id", m["client_id"])
+	a.Equal("reason", m["reason"])
+}
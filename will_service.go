@@ -0,0 +1,149 @@
+package gmqtt
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/DrmagicE/gmqtt/pkg/packets"
+	"github.com/DrmagicE/gmqtt/pkg/timerwheel"
+)
+
+const (
+	// willWheelTick is the precision of the will delay.
+	willWheelTick = 100 * time.Millisecond
+	// willWheelSlots is the number of slots of the will delay timer wheel.
+	willWheelSlots = 600
+)
+
+// PendingWill is a will message which is waiting for the will delay interval.
+type PendingWill struct {
+	ClientID string
+	Message  packets.Message
+	// PublishAt is the time when the will message will be published.
+	PublishAt time.Time
+	// client is the disconnected client for the OnWillPublish and OnWillPublished hooks.
+	client *client
+}
+
+// WillService provides the ability to inspect and cancel the delayed will messages.
+// See Config.WillDelayInterval.
+type WillService interface {
+	// PendingWills returns the will messages which are waiting for the will delay interval, ordered by PublishAt.
+	PendingWills() []PendingWill
+	// Cancel cancels the pending will message of the client, and returns whether the will message existed.
+	Cancel(clientID string) bool
+}
+
+type willService struct {
+	server *server
+	mu     sync.Mutex
+	wills  map[string]*PendingWill
+	// wheel is nil if the will delay is disabled.
+	wheel *timerwheel.TimerWheel
+}
+
+func newWillService(srv *server) *willService {
+	return &willService{
+		server: srv,
+		wills:  make(map[string]*PendingWill),
+	}
+}
+
+func (w *willService) start() {
+	if w.server.config.WillDelayInterval == 0 {
+		return
+	}
+	w.wheel = timerwheel.New(willWheelTick, willWheelSlots)
+	w.wheel.Start()
+}
+
+func (w *willService) stop() {
+	if w.wheel != nil {
+		w.wheel.Stop()
+	}
+}
+
+// schedule delays the will message of the client for the will delay interval.
+func (w *willService) schedule(client *client, msg packets.Message) {
+	clientID := client.opts.clientID
+	delay := w.server.config.WillDelayInterval
+	w.mu.Lock()
+	w.wills[clientID] = &PendingWill{
+		ClientID:  clientID,
+		Message:   msg,
+		PublishAt: time.Now().Add(delay),
+		client:    client,
+	}
+	w.mu.Unlock()
+	w.wheel.Add(clientID, delay, func() {
+		w.fire(clientID)
+	})
+	sessionLog().Debug("will message delayed", zap.String("client_id", clientID), zap.Duration("delay", delay))
+}
+
+func (w *willService) remove(clientID string) *PendingWill {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	will, ok := w.wills[clientID]
+	if !ok {
+		return nil
+	}
+	delete(w.wills, clientID)
+	if w.wheel != nil {
+		w.wheel.Remove(clientID)
+	}
+	return will
+}
+
+// fire publishes the pending will message of the client immediately, it is called when the delay elapses
+// or the session ends before that.
+func (w *willService) fire(clientID string) {
+	if will := w.remove(clientID); will != nil {
+		w.server.publishWill(will.client, will.Message)
+	}
+}
+
+func (w *willService) PendingWills() []PendingWill {
+	w.mu.Lock()
+	rs := make([]PendingWill, 0, len(w.wills))
+	for _, v := range w.wills {
+		rs = append(rs, *v)
+	}
+	w.mu.Unlock()
+	sort.Slice(rs, func(i, j int) bool {
+		return rs[i].PublishAt.Before(rs[j].PublishAt)
+	})
+	return rs
+}
+
+func (w *willService) Cancel(clientID string) bool {
+	return w.remove(clientID) != nil
+}
+
+// publishWill publishes the will message of the client asynchronously.
+func (srv *server) publishWill(client *client, msg packets.Message) {
+	go func() {
+		if srv.hooks.OnWillPublish != nil {
+			msg = srv.hooks.OnWillPublish(context.Background(), client, msg)
+			if msg == nil {
+				sessionLog().Info("will message suppressed", client.logFields()...)
+				return
+			}
+			if !packets.ValidTopicName([]byte(msg.Topic())) || msg.Qos() > packets.QOS_2 {
+				sessionLog().Warn("invalid will message, dropping message", client.logFields(
+					zap.String("topic", msg.Topic()),
+					zap.Uint8("qos", msg.Qos()),
+				)...)
+				return
+			}
+		}
+		srv.msgRouter <- &msgRouter{msg: msg, match: true}
+		if srv.hooks.OnWillPublished != nil {
+			srv.hooks.OnWillPublished(context.Background(), client, msg)
+		}
+	}()
+}